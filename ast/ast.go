@@ -79,6 +79,7 @@ const (
 	OperatorExtendedAnd                        // and
 	OperatorExtendedOr                         // or
 	OperatorExtendedNot                        // not
+	OperatorTilde                              // ~
 )
 
 // String returns the string representation of the operator type.
@@ -87,7 +88,7 @@ func (op OperatorType) String() string {
 	// compiler.internalOperatorNotZero.
 	return []string{"==", "!=", "<", "<=", ">", ">=", "!", "&", "|", "&&", "||",
 		"+", "-", "*", "/", "%", "^", "&^", "<<", ">>", "contains", "not contains",
-		"<-", "&", "*", "and", "or", "not", "", ""}[op]
+		"<-", "&", "*", "and", "or", "not", "~", "", ""}[op]
 }
 
 // AssignmentType represents a type of assignment.
@@ -640,6 +641,32 @@ func (n *CompositeLiteral) String() string {
 	return s + "{}"
 }
 
+// Conditional node represents a conditional expression in the form
+// "cond ? expr1 : expr2".
+type Conditional struct {
+	*expression
+	*Position            // position in the source.
+	Condition Expression // condition.
+	Expr1     Expression // expression evaluated if the condition is true.
+	Expr2     Expression // expression evaluated if the condition is false.
+}
+
+// NewConditional returns a new Conditional node.
+func NewConditional(pos *Position, cond, expr1, expr2 Expression) *Conditional {
+	return &Conditional{&expression{}, pos, cond, expr1, expr2}
+}
+
+// String returns the string representation of n.
+func (n *Conditional) String() string {
+	var s string
+	if _, ok := n.Condition.(*Conditional); ok {
+		s = "(" + n.Condition.String() + ")"
+	} else {
+		s = n.Condition.String()
+	}
+	return s + " ? " + n.Expr1.String() + " : " + n.Expr2.String()
+}
+
 // Const node represents a "const" declaration.
 type Const struct {
 	*Position               // position in the source.
@@ -803,6 +830,7 @@ type ForIn struct {
 	Expr      Expression  // range expression.
 	Body      []Node      // nodes of the body.
 	Else      *Block      // nodes to run if the body is not executed.
+	Parallel  bool        // reports whether the iterations run in parallel.
 }
 
 // NewForIn represents a new ForIn node.
@@ -810,7 +838,7 @@ func NewForIn(pos *Position, ident *Identifier, expr Expression, body []Node, el
 	if body == nil {
 		body = []Node{}
 	}
-	return &ForIn{pos, ident, expr, body, els}
+	return &ForIn{pos, ident, expr, body, els, false}
 }
 
 // ForRange node represents the "for range" statement.
@@ -819,6 +847,7 @@ type ForRange struct {
 	Assignment *Assignment // assignment.
 	Body       []Node      // nodes of the body.
 	Else       *Block      // nodes to run if the body is not executed.
+	Parallel   bool        // reports whether the iterations run in parallel.
 }
 
 // NewForRange returns a new ForRange node.
@@ -826,24 +855,25 @@ func NewForRange(pos *Position, assignment *Assignment, body []Node, els *Block)
 	if body == nil {
 		body = []Node{}
 	}
-	return &ForRange{pos, assignment, body, els}
+	return &ForRange{pos, assignment, body, els, false}
 }
 
 // Func node represents a function declaration or literal.
 type Func struct {
 	expression
 	*Position
-	Ident    *Identifier // name, nil for function literals.
-	Type     *FuncType   // type.
-	Body     *Block      // body.
-	DistFree bool        // reports whether it is distraction free.
-	Upvars   []Upvar     // Upvars of func.
-	Format   Format      // macro format.
+	Ident      *Identifier  // name, nil for function literals.
+	TypeParams []*Parameter // type parameters, nil if it is not generic.
+	Type       *FuncType    // type.
+	Body       *Block       // body.
+	DistFree   bool         // reports whether it is distraction free.
+	Upvars     []Upvar      // Upvars of func.
+	Format     Format       // macro format.
 }
 
 // NewFunc returns a new Func node.
 func NewFunc(pos *Position, name *Identifier, typ *FuncType, body *Block, distFree bool, format Format) *Func {
-	return &Func{expression{}, pos, name, typ, body, distFree, nil, format}
+	return &Func{expression{}, pos, name, nil, typ, body, distFree, nil, format}
 }
 
 // String returns the string representation of n.
@@ -1025,20 +1055,58 @@ func (n *Index) String() string {
 	return n.Expr.String() + "[" + n.Index.String() + "]"
 }
 
+// IndexList node represents an index expression with more than one index,
+// as the instantiation of a generic function with more than one type
+// argument.
+type IndexList struct {
+	*expression
+	*Position              // position in the source.
+	Expr      Expression   // expression.
+	Indices   []Expression // indices.
+}
+
+// NewIndexList returns a new IndexList node.
+func NewIndexList(pos *Position, expr Expression, indices []Expression) *IndexList {
+	return &IndexList{&expression{}, pos, expr, indices}
+}
+
+// String returns the string representation of n.
+func (n *IndexList) String() string {
+	s := n.Expr.String() + "["
+	for i, index := range n.Indices {
+		if i > 0 {
+			s += ", "
+		}
+		s += index.String()
+	}
+	return s + "]"
+}
+
 // Interface node represents an interface type.
 type Interface struct {
 	*expression
-	*Position // position in the source.
+	*Position              // position in the source.
+	Elements  []Expression // type elements, only for constraints.
 }
 
 // NewInterface returns a new Interface node.
-func NewInterface(pos *Position) *Interface {
-	return &Interface{&expression{}, pos}
+func NewInterface(pos *Position, elements []Expression) *Interface {
+	return &Interface{&expression{}, pos, elements}
 }
 
 // String returns the string representation of n.
 func (n *Interface) String() string {
-	return "interface{}"
+	if len(n.Elements) == 0 {
+		return "interface{}"
+	}
+	s := "interface{ "
+	for i, elem := range n.Elements {
+		if i > 0 {
+			s += "; "
+		}
+		s += elem.String()
+	}
+	return s + " }"
 }
 
 // KeyValue represents a key value pair in a slice, map or struct composite literal.
@@ -1152,6 +1220,25 @@ func (n *Placeholder) String() string {
 	return "[Placeholder]"
 }
 
+// Range node represents an integer range "low..high" in a "for in"
+// statement.
+type Range struct {
+	*expression
+	*Position            // position in the source.
+	Low       Expression // low bound.
+	High      Expression // high bound.
+}
+
+// NewRange returns a new Range node.
+func NewRange(pos *Position, low, high Expression) *Range {
+	return &Range{&expression{}, pos, low, high}
+}
+
+// String returns the string representation of n.
+func (n *Range) String() string {
+	return n.Low.String() + ".." + n.High.String()
+}
+
 // Raw node represents a "raw" statement.
 type Raw struct {
 	*Position        // position in the source.
@@ -1235,15 +1322,19 @@ type Selector struct {
 	*Position            // position in the source.
 	Expr      Expression // expression.
 	Ident     string     // identifier.
+	NilSafe   bool       // reports whether it is a nil-safe selector "?.".
 }
 
 // NewSelector returns a new Selector node.
 func NewSelector(pos *Position, expr Expression, ident string) *Selector {
-	return &Selector{&expression{}, pos, expr, ident}
+	return &Selector{&expression{}, pos, expr, ident, false}
 }
 
 // String returns the string representation of n.
 func (n *Selector) String() string {
+	if n.NilSafe {
+		return n.Expr.String() + "?." + n.Ident
+	}
 	return n.Expr.String() + "." + n.Ident
 }
 
@@ -1411,6 +1502,17 @@ func (n *Text) String() string {
 	return string(n.Text)
 }
 
+// Trans node represents a "trans" statement.
+type Trans struct {
+	*Position       // position in the source.
+	Text      *Text // text to translate, nil if empty.
+}
+
+// NewTrans returns a new Trans node.
+func NewTrans(pos *Position, text *Text) *Trans {
+	return &Trans{pos, text}
+}
+
 // Tree node represents a tree.
 type Tree struct {
 	*Position
@@ -0,0 +1,472 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astutil
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/open2b/scriggo/ast"
+)
+
+// ApplyFunc is called by Apply for each node, before or after its children,
+// with a Cursor that describes the node and provides the operations to
+// modify the tree. Its return value controls the traversal, see Apply.
+type ApplyFunc func(c *Cursor) bool
+
+// Apply traverses a tree recursively, starting with root, and calls pre and
+// post, if they are not nil, for each node that is not nil.
+//
+// pre is called for each node before its children are traversed. If pre
+// returns false, the children are not traversed and post is not called for
+// the node. post is called for each node after its children have been
+// traversed. If post returns false, the traversal is terminated and Apply
+// returns immediately.
+//
+// If pre replaces the current node, the children of the new node are
+// traversed. The nodes inserted with InsertBefore and InsertAfter are not
+// traversed.
+//
+// As Walk, Apply does not traverse the expanded trees of the extends,
+// import and render nodes.
+//
+// Apply returns the root, possibly replaced. The tree is modified in place.
+func Apply(root ast.Node, pre, post ApplyFunc) (result ast.Node) {
+	holder := &struct{ Root ast.Node }{root}
+	defer func() {
+		if r := recover(); r != nil && r != abort {
+			panic(r)
+		}
+		result = holder.Root
+	}()
+	a := &application{pre: pre, post: post}
+	a.applyField(nil, reflect.ValueOf(holder).Elem(), "Root")
+	return
+}
+
+// abort is used by Apply to terminate the traversal.
+var abort = new(int)
+
+// Cursor describes a node traversed by Apply. It is valid only during the
+// call to the ApplyFunc function.
+type Cursor struct {
+	parent ast.Node
+	name   string
+	field  reflect.Value // field that contains the node, or its slice.
+	iter   *iterator     // iterator of the slice, nil if not in a slice.
+	node   ast.Node
+}
+
+// iterator is the iterator of a slice of nodes.
+type iterator struct {
+	index, step int
+}
+
+// Node returns the current node.
+func (c *Cursor) Node() ast.Node { return c.node }
+
+// Parent returns the parent of the current node, or nil if the current node
+// is the root.
+func (c *Cursor) Parent() ast.Node { return c.parent }
+
+// Name returns the name of the field of the parent that contains the
+// current node, as "Expr1" for an *ast.BinaryOperator parent. For the keys
+// and values of composite literals, the parameters of function types and
+// the fields of struct types, it is the name of the field of the
+// ast.KeyValue, ast.Parameter or ast.Field value that contains the node.
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the index of the current node in the slice of nodes that
+// contains it, or -1 if the current node is not in a slice.
+func (c *Cursor) Index() int {
+	if c.iter == nil {
+		return -1
+	}
+	return c.iter.index
+}
+
+// Replace replaces the current node with n. It panics if n cannot be
+// assigned to the field of the parent that contains the current node.
+func (c *Cursor) Replace(n ast.Node) {
+	v := c.field
+	if c.iter != nil {
+		v = v.Index(c.iter.index)
+	}
+	if n == nil {
+		v.Set(reflect.Zero(v.Type()))
+	} else {
+		v.Set(reflect.ValueOf(n))
+	}
+	c.node = n
+}
+
+// Delete deletes the current node from the slice that contains it. It
+// panics if the current node is not in a slice.
+func (c *Cursor) Delete() {
+	if c.iter == nil {
+		panic("astutil: Delete node not contained in a slice")
+	}
+	i := c.iter.index
+	v := c.field
+	l := v.Len()
+	reflect.Copy(v.Slice(i, l), v.Slice(i+1, l))
+	v.Index(l - 1).Set(reflect.Zero(v.Type().Elem()))
+	v.SetLen(l - 1)
+	c.iter.step--
+}
+
+// InsertAfter inserts n after the current node in the slice that contains
+// it. It panics if the current node is not in a slice.
+func (c *Cursor) InsertAfter(n ast.Node) {
+	if c.iter == nil {
+		panic("astutil: InsertAfter node not contained in a slice")
+	}
+	i := c.iter.index
+	v := c.field
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+2, l), v.Slice(i+1, l))
+	v.Index(i + 1).Set(reflect.ValueOf(n))
+	c.iter.step++
+}
+
+// InsertBefore inserts n before the current node in the slice that contains
+// it. It panics if the current node is not in a slice.
+func (c *Cursor) InsertBefore(n ast.Node) {
+	if c.iter == nil {
+		panic("astutil: InsertBefore node not contained in a slice")
+	}
+	i := c.iter.index
+	v := c.field
+	v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+	l := v.Len()
+	reflect.Copy(v.Slice(i+1, l), v.Slice(i, l))
+	v.Index(i).Set(reflect.ValueOf(n))
+	c.iter.index++
+}
+
+// application is a traversal of a tree by Apply.
+type application struct {
+	pre, post ApplyFunc
+	cursor    Cursor
+}
+
+// node returns v as a node, or nil if v is a nil interface or pointer or an
+// interface with a nil pointer.
+func node(v reflect.Value) ast.Node {
+	if v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.IsNil() {
+		return nil
+	}
+	return v.Interface().(ast.Node)
+}
+
+// applyField applies to the node in the field with the given name of the
+// struct holder, that is the parent or a value contained in the parent.
+func (a *application) applyField(parent ast.Node, holder reflect.Value, name string) {
+	field := holder.FieldByName(name)
+	a.apply(parent, name, field, nil, node(field))
+}
+
+// applyList applies to the nodes in the slice field with the given name of
+// the struct holder, that is the parent or a value contained in the parent.
+func (a *application) applyList(parent ast.Node, holder reflect.Value, name string) {
+	field := holder.FieldByName(name)
+	iter := &iterator{}
+	for iter.index < field.Len() {
+		iter.step = 1
+		a.apply(parent, name, field, iter, node(field.Index(iter.index)))
+		iter.index += iter.step
+	}
+}
+
+// field applies to the node in the field with the given name of parent.
+func (a *application) field(parent ast.Node, name string) {
+	a.applyField(parent, reflect.ValueOf(parent).Elem(), name)
+}
+
+// list applies to the nodes in the slice field with the given name of
+// parent.
+func (a *application) list(parent ast.Node, name string) {
+	a.applyList(parent, reflect.ValueOf(parent).Elem(), name)
+}
+
+// apply applies to the node n, contained in field of parent.
+func (a *application) apply(parent ast.Node, name string, field reflect.Value, iter *iterator, n ast.Node) {
+
+	if n == nil {
+		return
+	}
+
+	saved := a.cursor
+	a.cursor = Cursor{parent: parent, name: name, field: field, iter: iter, node: n}
+
+	if a.pre != nil && !a.pre(&a.cursor) {
+		a.cursor = saved
+		return
+	}
+
+	n = a.cursor.node
+
+	switch n := n.(type) {
+
+	case nil:
+		// The node has been replaced with nil.
+
+	case *ast.ArrayType:
+		a.field(n, "Len")
+		a.field(n, "ElementType")
+
+	case *ast.Assignment:
+		a.list(n, "Lhs")
+		a.list(n, "Rhs")
+
+	case *ast.BinaryOperator:
+		a.field(n, "Expr1")
+		a.field(n, "Expr2")
+
+	case *ast.Block:
+		a.list(n, "Nodes")
+
+	case *ast.Break:
+		a.field(n, "Label")
+
+	case *ast.Call:
+		a.field(n, "Func")
+		a.list(n, "Args")
+
+	case *ast.Case:
+		a.list(n, "Expressions")
+		a.list(n, "Body")
+
+	case *ast.ChanType:
+		a.field(n, "ElementType")
+
+	case *ast.CompositeLiteral:
+		a.field(n, "Type")
+		for i := range n.KeyValues {
+			kv := reflect.ValueOf(&n.KeyValues[i]).Elem()
+			a.applyField(n, kv, "Key")
+			a.applyField(n, kv, "Value")
+		}
+
+	case *ast.Conditional:
+		a.field(n, "Condition")
+		a.field(n, "Expr1")
+		a.field(n, "Expr2")
+
+	case *ast.Const:
+		a.list(n, "Lhs")
+		a.field(n, "Type")
+		a.list(n, "Rhs")
+
+	case *ast.Continue:
+		a.field(n, "Label")
+
+	case *ast.Default:
+		a.field(n, "Expr1")
+		a.field(n, "Expr2")
+
+	case *ast.Defer:
+		a.field(n, "Call")
+
+	case *ast.DollarIdentifier:
+		a.field(n, "Ident")
+
+	case *ast.For:
+		a.field(n, "Init")
+		a.field(n, "Condition")
+		a.field(n, "Post")
+		a.list(n, "Body")
+
+	case *ast.ForIn:
+		a.field(n, "Ident")
+		a.field(n, "Expr")
+		a.list(n, "Body")
+		a.field(n, "Else")
+
+	case *ast.ForRange:
+		a.field(n, "Assignment")
+		a.list(n, "Body")
+		a.field(n, "Else")
+
+	case *ast.Func:
+		a.field(n, "Ident")
+		for _, param := range n.TypeParams {
+			a.applyParameter(n, param)
+		}
+		a.field(n, "Type")
+		a.field(n, "Body")
+
+	case *ast.FuncType:
+		for _, param := range n.Parameters {
+			a.applyParameter(n, param)
+		}
+		for _, res := range n.Result {
+			a.applyParameter(n, res)
+		}
+
+	case *ast.Go:
+		a.field(n, "Call")
+
+	case *ast.Goto:
+		a.field(n, "Label")
+
+	case *ast.If:
+		a.field(n, "Init")
+		a.field(n, "Condition")
+		a.field(n, "Then")
+		a.field(n, "Else")
+
+	case *ast.Import:
+		a.field(n, "Ident")
+		a.list(n, "For")
+
+	case *ast.Index:
+		a.field(n, "Expr")
+		a.field(n, "Index")
+
+	case *ast.IndexList:
+		a.field(n, "Expr")
+		a.list(n, "Indices")
+
+	case *ast.Interface:
+		a.list(n, "Elements")
+
+	case *ast.Label:
+		a.field(n, "Ident")
+		a.field(n, "Statement")
+
+	case *ast.MapType:
+		a.field(n, "KeyType")
+		a.field(n, "ValueType")
+
+	case *ast.Package:
+		a.list(n, "Declarations")
+
+	case *ast.Range:
+		a.field(n, "Low")
+		a.field(n, "High")
+
+	case *ast.Raw:
+		a.field(n, "Text")
+
+	case *ast.Return:
+		a.list(n, "Values")
+
+	case *ast.Select:
+		a.field(n, "LeadingText")
+		a.list(n, "Cases")
+
+	case *ast.SelectCase:
+		a.field(n, "Comm")
+		a.list(n, "Body")
+
+	case *ast.Selector:
+		a.field(n, "Expr")
+
+	case *ast.Send:
+		a.field(n, "Channel")
+		a.field(n, "Value")
+
+	case *ast.Show:
+		a.list(n, "Expressions")
+
+	case *ast.SliceType:
+		a.field(n, "ElementType")
+
+	case *ast.Slicing:
+		a.field(n, "Expr")
+		a.field(n, "Low")
+		a.field(n, "High")
+		a.field(n, "Max")
+
+	case *ast.Statements:
+		a.list(n, "Nodes")
+
+	case *ast.StructType:
+		for _, field := range n.Fields {
+			f := reflect.ValueOf(field).Elem()
+			a.applyList(n, f, "Idents")
+			a.applyField(n, f, "Type")
+		}
+
+	case *ast.Switch:
+		a.field(n, "Init")
+		a.field(n, "Expr")
+		a.field(n, "LeadingText")
+		a.list(n, "Cases")
+
+	case *ast.Trans:
+		a.field(n, "Text")
+
+	case *ast.Tree:
+		a.list(n, "Nodes")
+
+	case *ast.TypeAssertion:
+		a.field(n, "Expr")
+		a.field(n, "Type")
+
+	case *ast.TypeDeclaration:
+		a.field(n, "Ident")
+		a.field(n, "Type")
+
+	case *ast.TypeSwitch:
+		a.field(n, "Init")
+		a.field(n, "Assignment")
+		a.field(n, "LeadingText")
+		a.list(n, "Cases")
+
+	case *ast.URL:
+		a.list(n, "Value")
+
+	case *ast.UnaryOperator:
+		a.field(n, "Expr")
+
+	case *ast.Using:
+		a.field(n, "Statement")
+		a.field(n, "Type")
+		a.field(n, "Body")
+
+	case *ast.Var:
+		a.list(n, "Lhs")
+		a.field(n, "Type")
+		a.list(n, "Rhs")
+
+	case *ast.Extends, *ast.Render:
+		// Nothing to do, the expanded trees are not traversed.
+
+	case *ast.BasicLiteral,
+		*ast.Identifier,
+		*ast.Comment,
+		*ast.Text,
+		*ast.Placeholder,
+		*ast.Fallthrough:
+		// Nothing to do
+
+	default:
+		panic(fmt.Sprintf("No cases were defined for type %T on function Apply", n))
+	}
+
+	if a.post != nil && !a.post(&a.cursor) {
+		panic(abort)
+	}
+
+	a.cursor = saved
+
+}
+
+// applyParameter applies to the identifier and the type of the parameter p
+// of parent.
+func (a *application) applyParameter(parent ast.Node, p *ast.Parameter) {
+	v := reflect.ValueOf(p).Elem()
+	a.applyField(parent, v, "Ident")
+	a.applyField(parent, v, "Type")
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package astutil_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler"
+)
+
+func parseTemplate(t *testing.T, src string) *ast.Tree {
+	tree, _, err := compiler.ParseTemplateSource([]byte(src), ast.FormatHTML, false, false, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestApplyCursor(t *testing.T) {
+	tree := parseTemplate(t, `{{ f(a, 1) }}{% var s = []int{5: b} %}`)
+	var got []string
+	astutil.Apply(tree, func(c *astutil.Cursor) bool {
+		parent := "<nil>"
+		if c.Parent() != nil {
+			parent = fmt.Sprintf("%T", c.Parent())
+		}
+		got = append(got, fmt.Sprintf("%T %s %s %d", c.Node(), parent, c.Name(), c.Index()))
+		return true
+	}, nil)
+	expected := []string{
+		"*ast.Tree <nil> Root -1",
+		"*ast.Show *ast.Tree Nodes 0",
+		"*ast.Call *ast.Show Expressions 0",
+		"*ast.Identifier *ast.Call Func -1",
+		"*ast.Identifier *ast.Call Args 0",
+		"*ast.BasicLiteral *ast.Call Args 1",
+		"*ast.Var *ast.Tree Nodes 1",
+		"*ast.Identifier *ast.Var Lhs 0",
+		"*ast.CompositeLiteral *ast.Var Rhs 0",
+		"*ast.SliceType *ast.CompositeLiteral Type -1",
+		"*ast.Identifier *ast.SliceType ElementType -1",
+		"*ast.BasicLiteral *ast.CompositeLiteral Key -1",
+		"*ast.Identifier *ast.CompositeLiteral Value -1",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestApplyReplace(t *testing.T) {
+	tree := parseTemplate(t, `{{ a + f(a) }}{% var v = T{a} %}`)
+	astutil.Apply(tree, nil, func(c *astutil.Cursor) bool {
+		if ident, ok := c.Node().(*ast.Identifier); ok && ident.Name == "a" {
+			c.Replace(ast.NewIdentifier(ident.Position, "b"))
+		}
+		return true
+	})
+	if got := tree.Nodes[0].(*ast.Show).Expressions[0].String(); got != "b + f(b)" {
+		t.Fatalf("expected %q, got %q", "b + f(b)", got)
+	}
+	if got := tree.Nodes[1].(*ast.Var).Rhs[0].(*ast.CompositeLiteral).KeyValues[0].Value.String(); got != "b" {
+		t.Fatalf("expected %q, got %q", "b", got)
+	}
+	// Replace the root.
+	root := ast.NewTree("", nil, ast.FormatHTML)
+	result := astutil.Apply(tree, func(c *astutil.Cursor) bool {
+		c.Replace(root)
+		return false
+	}, nil)
+	if result != root {
+		t.Fatalf("expected the replaced root, got %v", result)
+	}
+	// Replace with a node of a different type.
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic, got no panic")
+		}
+	}()
+	astutil.Apply(parseTemplate(t, `{{ a }}`), func(c *astutil.Cursor) bool {
+		if _, ok := c.Node().(*ast.Identifier); ok {
+			c.Replace(ast.NewComment(nil, "a"))
+		}
+		return true
+	}, nil)
+}
+
+func TestApplyDeleteInsert(t *testing.T) {
+	tree := parseTemplate(t, `{# a #}{{ 1 }}{# b #}{{ 2 }}`)
+	var shows int
+	astutil.Apply(tree, func(c *astutil.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.Comment:
+			c.Delete()
+		case *ast.Show:
+			shows++
+			c.InsertBefore(ast.NewText(nil, []byte("<"), ast.Cut{}))
+			c.InsertAfter(ast.NewText(nil, []byte(">"), ast.Cut{}))
+			return false
+		case *ast.Text:
+			t.Fatalf("unexpected traversal of inserted text %q", n.Text)
+		}
+		return true
+	}, nil)
+	if shows != 2 {
+		t.Fatalf("expected 2 show nodes, got %d", shows)
+	}
+	var got string
+	for _, n := range tree.Nodes {
+		switch n := n.(type) {
+		case *ast.Text:
+			got += string(n.Text)
+		case *ast.Show:
+			got += n.Expressions[0].String()
+		default:
+			t.Fatalf("unexpected node %T", n)
+		}
+	}
+	if got != "<1><2>" {
+		t.Fatalf("expected %q, got %q", "<1><2>", got)
+	}
+	// Delete a node that is not in a slice.
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expected a panic, got no panic")
+		}
+	}()
+	astutil.Apply(parseTemplate(t, `{{ a + b }}`), func(c *astutil.Cursor) bool {
+		if c.Name() == "Expr1" {
+			c.Delete()
+		}
+		return true
+	}, nil)
+}
+
+func TestApplyAbort(t *testing.T) {
+	tree := parseTemplate(t, `{{ a }}{{ b }}{{ c }}`)
+	var names []string
+	astutil.Apply(tree, nil, func(c *astutil.Cursor) bool {
+		if ident, ok := c.Node().(*ast.Identifier); ok {
+			names = append(names, ident.Name)
+			return ident.Name != "b"
+		}
+		return true
+	})
+	if !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Fatalf("expected %q, got %q", []string{"a", "b"}, names)
+	}
+}
@@ -27,7 +27,7 @@ func CloneNode(node ast.Node) ast.Node {
 		}
 		values := make([]ast.Expression, len(n.Rhs))
 		for i, v := range n.Rhs {
-			variables[i] = CloneExpression(v)
+			values[i] = CloneExpression(v)
 		}
 		return ast.NewAssignment(ClonePosition(n.Position), variables, n.Type, values)
 
@@ -122,7 +122,9 @@ func CloneNode(node ast.Node) ast.Node {
 		if n.Else != nil {
 			els = CloneNode(n.Else).(*ast.Block)
 		}
-		return ast.NewForIn(ClonePosition(n.Position), ident, expr, body, els)
+		forIn := ast.NewForIn(ClonePosition(n.Position), ident, expr, body, els)
+		forIn.Parallel = n.Parallel
+		return forIn
 
 	case *ast.ForRange:
 		var body = make([]ast.Node, len(n.Body))
@@ -134,7 +136,9 @@ func CloneNode(node ast.Node) ast.Node {
 		if n.Else != nil {
 			els = CloneNode(n.Else).(*ast.Block)
 		}
-		return ast.NewForRange(ClonePosition(n.Position), assignment, body, els)
+		forRange := ast.NewForRange(ClonePosition(n.Position), assignment, body, els)
+		forRange.Parallel = n.Parallel
+		return forRange
 
 	case *ast.Func:
 		var ident *ast.Identifier
@@ -142,7 +146,15 @@ func CloneNode(node ast.Node) ast.Node {
 			ident = ast.NewIdentifier(ClonePosition(n.Ident.Position), n.Ident.Name)
 		}
 		typ := CloneExpression(n.Type).(*ast.FuncType)
-		return ast.NewFunc(ClonePosition(n.Position), ident, typ, CloneNode(n.Body).(*ast.Block), n.DistFree, n.Format)
+		fn := ast.NewFunc(ClonePosition(n.Position), ident, typ, CloneNode(n.Body).(*ast.Block), n.DistFree, n.Format)
+		if n.TypeParams != nil {
+			fn.TypeParams = make([]*ast.Parameter, len(n.TypeParams))
+			for i, param := range n.TypeParams {
+				ident := ast.NewIdentifier(ClonePosition(param.Ident.Position), param.Ident.Name)
+				fn.TypeParams[i] = &ast.Parameter{Ident: ident, Type: CloneExpression(param.Type)}
+			}
+		}
+		return fn
 
 	case *ast.Go:
 		return ast.NewGo(ClonePosition(n.Position), CloneExpression(n.Call))
@@ -196,6 +208,16 @@ func CloneNode(node ast.Node) ast.Node {
 	case *ast.Raw:
 		return ast.NewRaw(ClonePosition(n.Position), n.Marker, n.Tag, CloneNode(n.Text).(*ast.Text))
 
+	case *ast.Return:
+		var values []ast.Expression
+		if n.Values != nil {
+			values = make([]ast.Expression, len(n.Values))
+			for i, v := range n.Values {
+				values[i] = CloneExpression(v)
+			}
+		}
+		return ast.NewReturn(ClonePosition(n.Position), values)
+
 	case *ast.Select:
 		var text *ast.Text
 		if n.LeadingText != nil {
@@ -291,6 +313,13 @@ func CloneNode(node ast.Node) ast.Node {
 		}
 		return ast.NewText(ClonePosition(n.Position), text, n.Cut)
 
+	case *ast.Trans:
+		var text *ast.Text
+		if n.Text != nil {
+			text = CloneNode(n.Text).(*ast.Text)
+		}
+		return ast.NewTrans(ClonePosition(n.Position), text)
+
 	case *ast.TypeSwitch:
 		var init ast.Node
 		if n.Init != nil {
@@ -313,6 +342,10 @@ func CloneNode(node ast.Node) ast.Node {
 		}
 		return ast.NewTypeSwitch(ClonePosition(n.Position), init, assignment, text, cases)
 
+	case *ast.TypeDeclaration:
+		ident := ast.NewIdentifier(ClonePosition(n.Ident.Position), n.Ident.Name)
+		return ast.NewTypeDeclaration(ClonePosition(n.Position), ident, CloneExpression(n.Type), n.IsAliasDeclaration)
+
 	case *ast.Tree:
 		var nn = make([]ast.Node, 0, len(n.Nodes))
 		for _, n := range n.Nodes {
@@ -390,6 +423,9 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 		}
 		return ast.NewCompositeLiteral(ClonePosition(e.Pos()), CloneExpression(e.Type), keyValues)
 
+	case *ast.Conditional:
+		expr2 = ast.NewConditional(ClonePosition(e.Position), CloneExpression(e.Condition), CloneExpression(e.Expr1), CloneExpression(e.Expr2))
+
 	case *ast.Default:
 		expr2 = ast.NewDefault(ClonePosition(e.Position), CloneExpression(e.Expr1), CloneExpression(e.Expr2))
 
@@ -436,8 +472,22 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 	case *ast.Index:
 		expr2 = ast.NewIndex(ClonePosition(e.Position), CloneExpression(e.Expr), CloneExpression(e.Index))
 
+	case *ast.IndexList:
+		indices := make([]ast.Expression, len(e.Indices))
+		for i, index := range e.Indices {
+			indices[i] = CloneExpression(index)
+		}
+		expr2 = ast.NewIndexList(ClonePosition(e.Position), CloneExpression(e.Expr), indices)
+
 	case *ast.Interface:
-		expr2 = ast.NewInterface(ClonePosition(e.Pos()))
+		var elements []ast.Expression
+		if e.Elements != nil {
+			elements = make([]ast.Expression, len(e.Elements))
+			for i, elem := range e.Elements {
+				elements[i] = CloneExpression(elem)
+			}
+		}
+		expr2 = ast.NewInterface(ClonePosition(e.Pos()), elements)
 
 	case *ast.MapType:
 		expr2 = ast.NewMapType(ClonePosition(e.Pos()), CloneExpression(e.KeyType), CloneExpression(e.ValueType))
@@ -450,11 +500,19 @@ func CloneExpression(expr ast.Expression) ast.Expression {
 		expr2 = n
 
 	case *ast.Selector:
-		expr2 = ast.NewSelector(ClonePosition(e.Position), CloneExpression(e.Expr), e.Ident)
+		s := ast.NewSelector(ClonePosition(e.Position), CloneExpression(e.Expr), e.Ident)
+		s.NilSafe = e.NilSafe
+		expr2 = s
 
 	case *ast.SliceType:
 		expr2 = ast.NewSliceType(ClonePosition(e.Pos()), CloneExpression(e.ElementType))
 
+	case *ast.Placeholder:
+		expr2 = ast.NewPlaceholder()
+
+	case *ast.Range:
+		expr2 = ast.NewRange(ClonePosition(e.Position), CloneExpression(e.Low), CloneExpression(e.High))
+
 	case *ast.Slicing:
 		expr2 = ast.NewSlicing(ClonePosition(e.Position), CloneExpression(e.Expr), CloneExpression(e.Low),
 			CloneExpression(e.High), CloneExpression(e.Max), e.IsFull)
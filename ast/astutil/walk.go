@@ -89,6 +89,11 @@ func Walk(v Visitor, node ast.Node) {
 			Walk(v, vv.Value)
 		}
 
+	case *ast.Conditional:
+		Walk(v, n.Condition)
+		Walk(v, n.Expr1)
+		Walk(v, n.Expr2)
+
 	case *ast.Const:
 		for _, ident := range n.Lhs {
 			Walk(v, ident)
@@ -184,6 +189,17 @@ func Walk(v Visitor, node ast.Node) {
 		Walk(v, n.Expr)
 		Walk(v, n.Index)
 
+	case *ast.IndexList:
+		Walk(v, n.Expr)
+		for _, index := range n.Indices {
+			Walk(v, index)
+		}
+
+	case *ast.Interface:
+		for _, elem := range n.Elements {
+			Walk(v, elem)
+		}
+
 	case *ast.Label:
 		Walk(v, n.Ident)
 		Walk(v, n.Statement)
@@ -228,6 +244,10 @@ func Walk(v Visitor, node ast.Node) {
 	case *ast.SliceType:
 		Walk(v, n.ElementType)
 
+	case *ast.Range:
+		Walk(v, n.Low)
+		Walk(v, n.High)
+
 	case *ast.Slicing:
 		Walk(v, n.Expr)
 		if n.Low != nil {
@@ -245,6 +265,14 @@ func Walk(v Visitor, node ast.Node) {
 			Walk(v, child)
 		}
 
+	case *ast.StructType:
+		for _, field := range n.Fields {
+			for _, ident := range field.Idents {
+				Walk(v, ident)
+			}
+			Walk(v, field.Type)
+		}
+
 	case *ast.Switch:
 		Walk(v, n.Init)
 		Walk(v, n.Expr)
@@ -260,6 +288,10 @@ func Walk(v Visitor, node ast.Node) {
 	case *ast.TypeAssertion:
 		Walk(v, n.Expr)
 
+	case *ast.TypeDeclaration:
+		Walk(v, n.Ident)
+		Walk(v, n.Type)
+
 	case *ast.TypeSwitch:
 		Walk(v, n.Init)
 		Walk(v, n.Assignment)
@@ -275,6 +307,11 @@ func Walk(v Visitor, node ast.Node) {
 	case *ast.UnaryOperator:
 		Walk(v, n.Expr)
 
+	case *ast.Using:
+		Walk(v, n.Statement)
+		Walk(v, n.Type)
+		Walk(v, n.Body)
+
 	case *ast.Var:
 		for _, ident := range n.Lhs {
 			Walk(v, ident)
@@ -295,8 +332,8 @@ func Walk(v Visitor, node ast.Node) {
 		*ast.Comment,
 		*ast.Text,
 		*ast.Raw,
+		*ast.Trans,
 		*ast.Placeholder,
-		*ast.Interface,
 		*ast.Fallthrough:
 		// Nothing to do
 
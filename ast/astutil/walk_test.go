@@ -59,6 +59,8 @@ func TestWalk(t *testing.T) {
 		{`{% x := (getStruct()).field %}`, []int{0, 3, 3, 8, 8}},
 		{`{% x := -5.189 %}`, []int{0, 3, 3, 8, 9}},
 		{`{% x := vect[3:54] %}`, []int{0, 3, 3, 8, 8, 13, 15}},
+		{`{% type T []int %}`, []int{0, 3, 8, 10, 12}},
+		{`{% type S struct { A int } %}`, []int{0, 3, 8, 10, 19, 21}},
 	}
 
 	for _, c := range stringCases {
@@ -50,6 +50,13 @@
 //  	"md5":               builtin.Md5,
 //  	"unmarshalJSON":     builtin.UnmarshalJSON,
 //
+//  	// errors
+//  	"errorAs":  builtin.ErrorAs,
+//  	"errorIs":  builtin.ErrorIs,
+//  	"errorf":   builtin.Errorf,
+//  	"newError": builtin.NewError,
+//  	"unwrap":   builtin.Unwrap,
+//
 //  	// html
 //  	"htmlEscape": builtin.HtmlEscape,
 //
@@ -65,6 +72,11 @@
 //  	"form":        (*builtin.FormData)(nil),
 //  	"queryEscape": builtin.QueryEscape,
 //
+//  	// number formatting, uses the Locale run option
+//  	"formatCurrency": builtin.FormatCurrency,
+//  	"formatNumber":   builtin.FormatNumber,
+//  	"formatPercent":  builtin.FormatPercent,
+//
 //  	// regexp
 //  	"Regexp": reflect.TypeOf(builtin.Regexp{}),
 //  	"regexp": builtin.RegExp,
@@ -80,6 +92,8 @@
 //  	"parseInt":    builtin.ParseInt,
 //
 //  	// strings
+//  	"Format":        reflect.TypeOf(builtin.Format("")),
+//  	"Quoted":        reflect.TypeOf(builtin.Quoted("")),
 //  	"abbreviate":    builtin.Abbreviate,
 //  	"capitalize":    builtin.Capitalize,
 //  	"capitalizeAll": builtin.CapitalizeAll,
@@ -89,6 +103,9 @@
 //  	"indexAny":      builtin.IndexAny,
 //  	"join":          builtin.Join,
 //  	"lastIndex":     builtin.LastIndex,
+//  	"printf":        builtin.Printf,
+//  	"quote":         builtin.Quote,
+//  	"repeat":        builtin.Repeat,
 //  	"replace":       builtin.Replace,
 //  	"replaceAll":    builtin.ReplaceAll,
 //  	"runeCount":     builtin.RuneCount,
@@ -110,6 +127,7 @@
 //  	// time
 //  	"Duration":      reflect.TypeOf(builtin.Duration(0)),
 //  	"Hour":          time.Hour,
+//  	"Layout":        reflect.TypeOf(builtin.Layout("")),
 //  	"Microsecond":   time.Microsecond,
 //  	"Millisecond":   time.Millisecond,
 //  	"Minute":        time.Minute,
@@ -117,6 +135,7 @@
 //  	"Second":        time.Second,
 //  	"Time":          reflect.TypeOf(builtin.Time{}),
 //  	"date":          builtin.Date,
+//  	"formatDate":    builtin.FormatDate,
 //  	"now":           builtin.Now,
 //  	"parseDuration": builtin.ParseDuration,
 //  	"parseTime":     builtin.ParseTime,
@@ -270,6 +289,73 @@ func Date(year, month, day, hour, min, sec, nsec int, location string) (Time, er
 	return NewTime(time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc)), nil
 }
 
+// ErrorAs finds the first error in the chain of err that matches target, and
+// if so, sets target to that error value and returns true. Otherwise, it
+// returns false. The chain consists of err itself followed by the sequence of
+// errors obtained by repeatedly calling its Unwrap method.
+//
+// target must be a non-nil pointer to a type that implements error, or to
+// any interface type. ErrorAs panics if target is not such a pointer.
+func ErrorAs(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// ErrorIs reports whether any error in the chain of err matches target. The
+// chain consists of err itself followed by the sequence of errors obtained by
+// repeatedly calling its Unwrap method.
+func ErrorIs(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// Errorf formats according to a format specifier and returns the string as a
+// value that satisfies error. If the format specifier includes a %w verb with
+// an error operand, the returned error implements an Unwrap method returning
+// the operand.
+func Errorf(format string, a ...interface{}) error {
+	return fmt.Errorf(format, a...)
+}
+
+// FormatDate returns a textual representation of t formatted according to
+// layout, as the Format method of Time does. t can be a Time value, a
+// time.Time value or a string with a time in the RFC 3339 format. If env
+// implements native.LocationEnv and a location is passed as option for
+// execution, t is converted to it.
+//
+// A constant layout is validated at compile time, a non-constant layout is
+// validated when FormatDate is called. See the CheckConstant method of Layout.
+//
+// If t is not a time or a string in the RFC 3339 format, or the layout is not
+// valid, FormatDate panics.
+func FormatDate(env native.Env, t interface{}, layout Layout) string {
+	var tt time.Time
+	switch t := t.(type) {
+	case Time:
+		tt = t.t
+	case time.Time:
+		tt = t
+	case string:
+		var err error
+		tt, err = time.Parse(time.RFC3339Nano, t)
+		if err != nil {
+			panic("formatDate: cannot parse " + strconv.Quote(t) + " as RFC 3339 time")
+		}
+	default:
+		if t == nil {
+			panic("formatDate: cannot format nil value")
+		}
+		panic("formatDate: cannot format value of type " + reflect.TypeOf(t).String())
+	}
+	if err := layout.CheckConstant(); err != nil {
+		panic("formatDate: " + err.Error())
+	}
+	if env, ok := env.(native.LocationEnv); ok {
+		if loc := env.Location(); loc != nil {
+			tt = tt.In(loc)
+		}
+	}
+	return tt.Format(string(layout))
+}
+
 // FormatFloat converts the floating-point number f to a string, according to
 // the given format and precision. It can round the result.
 //
@@ -435,6 +521,12 @@ func Min(x, y int) int {
 	return x
 }
 
+// NewError returns an error that formats as the given text. Each call to
+// NewError returns a distinct error value even if the text is identical.
+func NewError(text string) error {
+	return errors.New(text)
+}
+
 // Now returns the current local time.
 func Now() Time {
 	return NewTime(time.Now())
@@ -526,6 +618,13 @@ func Pow(x, y float64) float64 {
 	return math.Pow(x, y)
 }
 
+// Printf formats according to a format specifier and returns the resulting
+// string. It is like Sprintf but a constant format is checked at compile
+// time with the types of the arguments.
+func Printf(format Format, a ...interface{}) string {
+	return fmt.Sprintf(string(format), a...)
+}
+
 // QueryEscape escapes the string, so it can be safely placed
 // inside a URL query.
 func QueryEscape(s string) string {
@@ -567,6 +666,17 @@ func QueryEscape(s string) string {
 	return string(b)
 }
 
+// Quote returns a double-quoted Go string literal representing v formatted
+// with the default format, that is strconv.Quote(fmt.Sprint(v)). Note that,
+// differently from the %q verb of the fmt package, an integer is quoted as
+// its decimal representation and not as a rune literal.
+//
+// In JavaScript and JSON contexts, the returned value is shown as a string
+// literal of that context. See the Quoted type for details.
+func Quote(v interface{}) Quoted {
+	return Quoted(strconv.Quote(fmt.Sprint(v)))
+}
+
 // RegExp parses a regular expression and returns a Regexp value that can be
 // used to match against text. It panics if the expression cannot be parsed.
 //
@@ -579,6 +689,17 @@ func RegExp(expr string) Regexp {
 	return Regexp{r: r}
 }
 
+// Repeat returns a new string consisting of count copies of the string s.
+//
+// It panics if count is negative or if the result of (len(s) * count)
+// overflows. When called from Scriggo code, the calls are compiled to a
+// dedicated instruction: a negative constant count is a compilation error,
+// the calls with constant arguments are computed at compile time and the
+// memory of the result is charged to the memory limit of the execution.
+func Repeat(s string, count int) string {
+	return strings.Repeat(s, count)
+}
+
 // Replace returns a copy of the string s with the first n
 // non-overlapping instances of old replaced by new.
 // If n < 0, there is no limit on the number of replacements.
@@ -872,6 +993,13 @@ func UnmarshalJSON(data string, v interface{}) error {
 	return nil
 }
 
+// Unwrap returns the result of calling the Unwrap method on err, if err's
+// type contains an Unwrap method returning error. Otherwise, Unwrap returns
+// nil.
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
+
 // isSeparator reports whether the rune could mark a word boundary.
 // TODO: update when package unicode captures more of the properties.
 func isSeparator(r rune) bool {
@@ -198,6 +198,30 @@ var tests = []struct {
 	{sp(Pow(-2.89, 4.11)), "NaN"},
 	{sp(Pow(12.6, 7.85)), "4.3441896761340076e+08"},
 
+	// printf
+	{Printf(""), ""},
+	{Printf("%d-%s", 5, "a"), "5-a"},
+	{Printf("%5.2f%%", 3.14159), " 3.14%"},
+
+	// quote
+	{string(Quote(``)), `""`},
+	{string(Quote(`a"b`)), `"a\"b"`},
+	{string(Quote("\tà\n")), `"\tà\n"`},
+	{string(Quote(5)), `"5"`},
+	{string(Quote(toHTML(`<b>`))), `"<b>"`},
+	{string(Quote([]string{"a", "b"})), `"[a b]"`},
+	{string(Quote(nil)), `"<nil>"`},
+	{string(Quote(`a"b`).JS()), `"a\"b"`},
+	{string(Quote(5).JS()), `"5"`},
+	{string(Quote("</script>\u2028").JS()), `"\u003c/script\u003e\u2028"`},
+	{string(Quote("\tà").JSON()), `"\tà"`},
+
+	// repeat
+	{Repeat("", 3), ``},
+	{Repeat("-", 0), ``},
+	{Repeat("-", 5), `-----`},
+	{Repeat("ab", 2), `abab`},
+
 	// regexp
 	{spf("%t", RegExp("(scriggo){2}").Match("scriggo")), "false"},
 	{spf("%t", RegExp("(scriggo){2}").Match("scriggoscriggo")), "true"},
@@ -323,3 +347,37 @@ func TestBuiltins(t *testing.T) {
 		}
 	}
 }
+
+func TestErrors(t *testing.T) {
+	base := NewError("not found")
+	if base.Error() != "not found" {
+		t.Fatalf("expecting %q, got %q", "not found", base.Error())
+	}
+	if NewError("not found") == base {
+		t.Fatal("expecting distinct errors")
+	}
+	err := Errorf("cannot read %q: %w", "a.txt", base)
+	if expected := `cannot read "a.txt": not found`; err.Error() != expected {
+		t.Fatalf("expecting %q, got %q", expected, err.Error())
+	}
+	if Unwrap(err) != base {
+		t.Fatal("expecting the wrapped error")
+	}
+	if Unwrap(base) != nil {
+		t.Fatal("expecting nil")
+	}
+	if !ErrorIs(err, base) || ErrorIs(base, err) {
+		t.Fatal("unexpected ErrorIs result")
+	}
+	var numErr *strconv.NumError
+	_, e := strconv.Atoi("a")
+	if !ErrorAs(Errorf("parse: %w", e), &numErr) {
+		t.Fatal("expecting ErrorAs to return true")
+	}
+	if numErr.Num != "a" {
+		t.Fatalf("expecting %q, got %q", "a", numErr.Num)
+	}
+	if ErrorAs(err, &numErr) {
+		t.Fatal("expecting ErrorAs to return false")
+	}
+}
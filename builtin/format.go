@@ -0,0 +1,152 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builtin
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Format is a format specifier, as in Sprintf. Constant formats are
+// checked at compile time with the types of the arguments they format. The
+// explicit argument indexes, as in "%[1]d", are not supported.
+type Format string
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var stringerType = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+
+// CheckFormat checks the format with the types of the arguments it formats.
+// It returns an error if a verb is unknown, if a verb cannot format the
+// type of its argument, or if the number of arguments differs from the
+// number of arguments read by the format.
+//
+// It implements the native.FormatChecker interface.
+func (format Format) CheckFormat(args []reflect.Type) error {
+	f := string(format)
+	n := 0 // number of read arguments.
+	for i := 0; i < len(f); i++ {
+		if f[i] != '%' {
+			continue
+		}
+		start := i
+		i++
+		// Flags.
+		for i < len(f) && strings.IndexByte("+-# 0", f[i]) >= 0 {
+			i++
+		}
+		// Width and precision.
+		for j := 0; j < 2; j++ {
+			if j == 1 {
+				if i == len(f) || f[i] != '.' {
+					break
+				}
+				i++
+			}
+			if i < len(f) && f[i] == '*' {
+				i++
+				if n == len(args) {
+					return fmt.Errorf("format %s reads arg #%d, but call has %s", f[start:i], n+1, countArgs(len(args)))
+				}
+				if k := args[n].Kind(); k != reflect.Interface && (k < reflect.Int || k > reflect.Uintptr) {
+					return fmt.Errorf("format %s uses non-int %s as argument of *", f[start:i], args[n])
+				}
+				n++
+				continue
+			}
+			for i < len(f) && '0' <= f[i] && f[i] <= '9' {
+				i++
+			}
+		}
+		if i == len(f) {
+			return fmt.Errorf("format %s is missing verb at end of string", f[start:])
+		}
+		if f[i] == '[' {
+			return errors.New("explicit argument indexes are not supported")
+		}
+		verb, size := utf8.DecodeRuneInString(f[i:])
+		i += size - 1
+		directive := f[start : i+1]
+		if verb == '%' {
+			continue
+		}
+		if !strings.ContainsRune("bcdeEfFgGopqstTUvxX", verb) {
+			return fmt.Errorf("format %s has unknown verb %c", directive, verb)
+		}
+		if n == len(args) {
+			return fmt.Errorf("format %s reads arg #%d, but call has %s", directive, n+1, countArgs(len(args)))
+		}
+		if !verbAccepts(verb, args[n], map[reflect.Type]bool{}) {
+			return fmt.Errorf("format %s has arg #%d of wrong type %s", directive, n+1, args[n])
+		}
+		n++
+	}
+	if n < len(args) {
+		return fmt.Errorf("call needs %s but has %s", countArgs(n), countArgs(len(args)))
+	}
+	return nil
+}
+
+// countArgs returns "1 arg" if n is 1, otherwise "n args".
+func countArgs(n int) string {
+	if n == 1 {
+		return "1 arg"
+	}
+	return fmt.Sprintf("%d args", n)
+}
+
+// verbAccepts reports whether verb can format a value of type t. The
+// elements of the arrays, slices and maps and the fields of the structs are
+// formatted with the same verb. seen contains the types already visited.
+func verbAccepts(verb rune, t reflect.Type, seen map[reflect.Type]bool) bool {
+	if verb == 'v' || verb == 'T' || t.Kind() == reflect.Interface {
+		return true
+	}
+	if strings.ContainsRune("sqxX", verb) && (t.Implements(errorType) || t.Implements(stringerType)) {
+		return true
+	}
+	if seen[t] {
+		return true
+	}
+	k := t.Kind()
+	switch {
+	case k == reflect.Bool:
+		return verb == 't'
+	case reflect.Int <= k && k <= reflect.Uintptr:
+		return strings.ContainsRune("bcdoOqxXU", verb)
+	case k == reflect.Float32 || k == reflect.Float64 || k == reflect.Complex64 || k == reflect.Complex128:
+		return strings.ContainsRune("beEfFgGxX", verb)
+	case k == reflect.String:
+		return strings.ContainsRune("sqxX", verb)
+	case k == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && strings.ContainsRune("sqxX", verb):
+		return true
+	case verb == 'p':
+		return k == reflect.Ptr || k == reflect.Chan || k == reflect.Func || k == reflect.Map ||
+			k == reflect.Slice || k == reflect.UnsafePointer
+	}
+	seen[t] = true
+	switch k {
+	case reflect.Array, reflect.Slice:
+		return verbAccepts(verb, t.Elem(), seen)
+	case reflect.Map:
+		return verbAccepts(verb, t.Key(), seen) && verbAccepts(verb, t.Elem(), seen)
+	case reflect.Ptr:
+		switch t.Elem().Kind() {
+		case reflect.Array, reflect.Slice, reflect.Map, reflect.Struct:
+			return verbAccepts(verb, t.Elem(), seen)
+		}
+		return strings.ContainsRune("bdoOxX", verb)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !verbAccepts(verb, t.Field(i).Type, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
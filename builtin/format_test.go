@@ -0,0 +1,70 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builtin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFormatCheckFormat(t *testing.T) {
+	var (
+		intType       = reflect.TypeOf(0)
+		float64Type   = reflect.TypeOf(0.0)
+		stringType    = reflect.TypeOf("")
+		boolType      = reflect.TypeOf(false)
+		interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+	)
+	valid := []struct {
+		format string
+		args   []reflect.Type
+	}{
+		{"", nil},
+		{"abc", nil},
+		{"100%%", nil},
+		{"%d %s", []reflect.Type{intType, stringType}},
+		{"%5.2f %t", []reflect.Type{float64Type, boolType}},
+		{"%*d", []reflect.Type{intType, intType}},
+		{"%v %T", []reflect.Type{boolType, float64Type}},
+		{"%s", []reflect.Type{interfaceType}},
+		{"%d", []reflect.Type{reflect.TypeOf([]int(nil))}},
+		{"%s", []reflect.Type{reflect.TypeOf([]byte(nil))}},
+		{"%s", []reflect.Type{reflect.TypeOf(errors.New(""))}},
+		{"%x", []reflect.Type{stringType}},
+		{"%q", []reflect.Type{reflect.TypeOf('a')}},
+		{"%p", []reflect.Type{reflect.TypeOf(map[string]int(nil))}},
+	}
+	for _, cas := range valid {
+		if err := Format(cas.format).CheckFormat(cas.args); err != nil {
+			t.Errorf("format %q: unexpected error %q", cas.format, err)
+		}
+	}
+	invalid := []struct {
+		format string
+		args   []reflect.Type
+		err    string
+	}{
+		{"%d", nil, "format %d reads arg #1, but call has 0 args"},
+		{"%d %d", []reflect.Type{intType}, "format %d reads arg #2, but call has 1 arg"},
+		{"%d", []reflect.Type{intType, intType}, "call needs 1 arg but has 2 args"},
+		{"abc", []reflect.Type{intType}, "call needs 0 args but has 1 arg"},
+		{"%d", []reflect.Type{stringType}, "format %d has arg #1 of wrong type string"},
+		{"%s", []reflect.Type{intType}, "format %s has arg #1 of wrong type int"},
+		{"%t", []reflect.Type{reflect.TypeOf([]int(nil))}, "format %t has arg #1 of wrong type []int"},
+		{"%z", []reflect.Type{intType}, "format %z has unknown verb z"},
+		{"%*d", []reflect.Type{stringType, intType}, "format %* uses non-int string as argument of *"},
+		{"%[1]d", []reflect.Type{intType}, "explicit argument indexes are not supported"},
+		{"%5", []reflect.Type{intType}, "format %5 is missing verb at end of string"},
+	}
+	for _, cas := range invalid {
+		err := Format(cas.format).CheckFormat(cas.args)
+		if err == nil {
+			t.Errorf("format %q: expecting error %q, got no error", cas.format, cas.err)
+		} else if err.Error() != cas.err {
+			t.Errorf("format %q: expecting error %q, got %q", cas.format, cas.err, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builtin
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/open2b/scriggo/native"
+)
+
+// numberFormat describes how numbers are formatted in a locale.
+type numberFormat struct {
+	decimal        string // decimal separator.
+	group          string // grouping separator.
+	percent        string // percent sign, with the preceding space if any.
+	currencyPrefix bool   // the currency symbol precedes the number.
+	currencySpace  bool   // the currency symbol is separated by a no-break space.
+}
+
+// numberFormats contains the number formats of the supported locales,
+// indexed by lower case language tag.
+var numberFormats = map[string]numberFormat{
+	"de":    {",", ".", "\u00a0%", false, true},
+	"de-ch": {".", "’", "%", true, true},
+	"en":    {".", ",", "%", true, false},
+	"es":    {",", ".", "\u00a0%", false, true},
+	"fr":    {",", "\u202f", "\u00a0%", false, true},
+	"it":    {",", ".", "%", false, true},
+	"ja":    {".", ",", "%", true, false},
+	"nl":    {",", ".", "%", true, true},
+	"pt":    {",", ".", "%", true, true},
+	"pt-pt": {",", "\u00a0", "%", false, true},
+	"zh":    {".", ",", "%", true, false},
+}
+
+// currencySymbols contains the symbols of the currencies that are not
+// represented by their ISO 4217 code.
+var currencySymbols = map[string]string{
+	"BRL": "R$",
+	"CNY": "¥",
+	"EUR": "€",
+	"GBP": "£",
+	"INR": "₹",
+	"JPY": "¥",
+	"USD": "$",
+}
+
+// currencyDecimals contains the number of decimals of the currencies that do
+// not have two decimals.
+var currencyDecimals = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+}
+
+// FormatCurrency returns the amount n, that can have any integer or
+// floating-point type, formatted in the currency with the given ISO 4217
+// code, as "USD" or "EUR", according to the locale of the execution. For
+// example, 1234.5 in "EUR" is formatted as "€1,234.50" in the "en" locale and
+// as "1.234,50 €" in the "it" locale, where the space is a no-break space.
+//
+// It panics if currency is not a valid code. When called from Go code, it
+// also panics if n is not a number.
+func FormatCurrency(env native.Env, n native.Number, currency string) string {
+	if len(currency) != 3 || strings.ToUpper(currency) != currency || strings.ToLower(currency) == currency {
+		panic("formatCurrency: invalid currency code " + strconv.Quote(currency))
+	}
+	decimals, ok := currencyDecimals[currency]
+	if !ok {
+		decimals = 2
+	}
+	f := localeNumberFormat(env)
+	neg, s := formatNumber("formatCurrency", f, n, decimals, false)
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	var b strings.Builder
+	if neg {
+		b.WriteString("-")
+	}
+	if f.currencyPrefix {
+		b.WriteString(symbol)
+		if f.currencySpace {
+			b.WriteString("\u00a0")
+		}
+		b.WriteString(s)
+	} else {
+		b.WriteString(s)
+		if f.currencySpace {
+			b.WriteString("\u00a0")
+		}
+		b.WriteString(symbol)
+	}
+	return b.String()
+}
+
+// FormatNumber returns n, that can have any integer or floating-point type,
+// formatted with the given number of decimals according to the locale of the
+// execution. For example, 1234.5 with 2 decimals is formatted as "1,234.50"
+// in the "en" locale and as "1.234,50" in the "it" locale.
+//
+// The decimals, for -1 <= decimals <= 100, controls the number of digits after
+// the decimal separator. The special value -1 uses the smallest number of
+// digits necessary to represent n exactly.
+//
+// It panics if decimals is not in the range. When called from Go code, it
+// also panics if n is not a number.
+func FormatNumber(env native.Env, n native.Number, decimals int) string {
+	f := localeNumberFormat(env)
+	neg, s := formatNumber("formatNumber", f, n, decimals, false)
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// FormatPercent returns the fraction n, that can have any integer or
+// floating-point type, formatted as a percentage with the given number of
+// decimals according to the locale of the execution. For example, 0.256 with
+// 1 decimal is formatted as "25.6%" in the "en" locale and as "25,6 %" in the
+// "de" locale, where the space is a no-break space.
+//
+// The decimals has the same meaning as in FormatNumber.
+//
+// It panics if decimals is not in the range. When called from Go code, it
+// also panics if n is not a number.
+func FormatPercent(env native.Env, n native.Number, decimals int) string {
+	f := localeNumberFormat(env)
+	neg, s := formatNumber("formatPercent", f, n, decimals, true)
+	if neg {
+		return "-" + s + f.percent
+	}
+	return s + f.percent
+}
+
+// localeNumberFormat returns the number format of the locale of env. If env
+// does not implement native.LocaleEnv or the locale is not supported, it
+// returns the format of the "en" locale.
+func localeNumberFormat(env native.Env) numberFormat {
+	var tag string
+	if env, ok := env.(native.LocaleEnv); ok {
+		tag = strings.ToLower(strings.ReplaceAll(env.Locale(), "_", "-"))
+	}
+	for tag != "" {
+		if f, ok := numberFormats[tag]; ok {
+			return f
+		}
+		i := strings.LastIndexByte(tag, '-')
+		if i == -1 {
+			break
+		}
+		tag = tag[:i]
+	}
+	return numberFormats["en"]
+}
+
+// formatNumber formats the absolute value of n with the format f and the
+// given number of decimals, and reports whether n is negative. If percent is
+// true, n is multiplied by 100. name is the name of the calling function and
+// it is used in panic messages.
+func formatNumber(name string, f numberFormat, n native.Number, decimals int, percent bool) (bool, string) {
+	if decimals < -1 || decimals > 100 {
+		panic(name + ": invalid decimals " + strconv.Itoa(decimals))
+	}
+	var neg bool
+	var s string
+	rv := reflect.ValueOf(n)
+	switch k := rv.Kind(); {
+	case reflect.Int <= k && k <= reflect.Int64 && !percent:
+		i := rv.Int()
+		neg = i < 0
+		u := uint64(i)
+		if neg {
+			u = -u
+		}
+		s = strconv.FormatUint(u, 10)
+	case reflect.Uint <= k && k <= reflect.Uintptr && !percent:
+		s = strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Int <= k && k <= reflect.Int64:
+		s, neg = formatFloat(float64(rv.Int())*100, decimals)
+	case reflect.Uint <= k && k <= reflect.Uintptr:
+		s, neg = formatFloat(float64(rv.Uint())*100, decimals)
+	case k == reflect.Float32 || k == reflect.Float64:
+		fl := rv.Float()
+		if percent {
+			fl *= 100
+		}
+		if math.IsNaN(fl) || math.IsInf(fl, 0) {
+			return false, strconv.FormatFloat(fl, 'f', -1, 64)
+		}
+		s, neg = formatFloat(fl, decimals)
+	default:
+		if n == nil {
+			panic(name + ": cannot format nil value")
+		}
+		panic(name + ": cannot format non-numeric value of type " + rv.Type().String())
+	}
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i != -1 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	if decimals > len(fracPart) {
+		fracPart += strings.Repeat("0", decimals-len(fracPart))
+	}
+	var b strings.Builder
+	for i := 0; i < len(intPart); i++ {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteByte(intPart[i])
+	}
+	if fracPart != "" {
+		b.WriteString(f.decimal)
+		b.WriteString(fracPart)
+	}
+	return neg, b.String()
+}
+
+// formatFloat formats the absolute value of f, that is not NaN or infinite,
+// with the given number of decimals and reports whether f is negative.
+// Negative values rounded to zero are not considered negative.
+func formatFloat(f float64, decimals int) (string, bool) {
+	s := strconv.FormatFloat(math.Abs(f), 'f', decimals, 64)
+	neg := f < 0 && strings.Trim(s, "0.") != ""
+	return s, neg
+}
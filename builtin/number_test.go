@@ -0,0 +1,106 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builtin
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/open2b/scriggo/native"
+)
+
+// testEnv implements native.LocaleEnv and native.LocationEnv.
+type testEnv struct {
+	native.Env
+	locale string
+	loc    *time.Location
+}
+
+func (env testEnv) Locale() string {
+	return env.locale
+}
+
+func (env testEnv) Location() *time.Location {
+	return env.loc
+}
+
+type definedFloat float64
+
+var numberTests = []struct {
+	got      func(env native.Env) string
+	locale   string
+	expected string
+}{
+	// formatNumber
+	{func(env native.Env) string { return FormatNumber(env, 0, -1) }, "", "0"},
+	{func(env native.Env) string { return FormatNumber(env, 1234567, -1) }, "", "1,234,567"},
+	{func(env native.Env) string { return FormatNumber(env, -123, 2) }, "", "-123.00"},
+	{func(env native.Env) string { return FormatNumber(env, int8(-128), 0) }, "en-US", "-128"},
+	{func(env native.Env) string { return FormatNumber(env, int64(math.MinInt64), 0) }, "", "-9,223,372,036,854,775,808"},
+	{func(env native.Env) string { return FormatNumber(env, uint64(math.MaxUint64), 0) }, "", "18,446,744,073,709,551,615"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "en", "1,234.50"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "it-IT", "1.234,50"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "it_CH", "1.234,50"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "de-CH", "1’234.50"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "fr", "1\u202f234,50"},
+	{func(env native.Env) string { return FormatNumber(env, 1234.5, 2) }, "xx", "1,234.50"},
+	{func(env native.Env) string { return FormatNumber(env, 0.125, -1) }, "", "0.125"},
+	{func(env native.Env) string { return FormatNumber(env, 0.125, 1) }, "", "0.1"},
+	{func(env native.Env) string { return FormatNumber(env, -0.001, 2) }, "", "0.00"},
+	{func(env native.Env) string { return FormatNumber(env, float32(2.5), 0) }, "", "2"},
+	{func(env native.Env) string { return FormatNumber(env, definedFloat(1e6), -1) }, "", "1,000,000"},
+	{func(env native.Env) string { return FormatNumber(env, math.Inf(-1), 2) }, "", "-Inf"},
+	{func(env native.Env) string { return FormatNumber(env, math.NaN(), 2) }, "", "NaN"},
+
+	// formatPercent
+	{func(env native.Env) string { return FormatPercent(env, 0.256, 1) }, "", "25.6%"},
+	{func(env native.Env) string { return FormatPercent(env, 0.256, 1) }, "de", "25,6\u00a0%"},
+	{func(env native.Env) string { return FormatPercent(env, -0.5, 0) }, "it", "-50%"},
+	{func(env native.Env) string { return FormatPercent(env, 12, 0) }, "", "1,200%"},
+	{func(env native.Env) string { return FormatPercent(env, uint8(1), -1) }, "", "100%"},
+
+	// formatCurrency
+	{func(env native.Env) string { return FormatCurrency(env, 1234.5, "EUR") }, "en", "€1,234.50"},
+	{func(env native.Env) string { return FormatCurrency(env, 1234.5, "EUR") }, "it", "1.234,50\u00a0€"},
+	{func(env native.Env) string { return FormatCurrency(env, -1234.5, "USD") }, "", "-$1,234.50"},
+	{func(env native.Env) string { return FormatCurrency(env, 1234, "JPY") }, "ja", "¥1,234"},
+	{func(env native.Env) string { return FormatCurrency(env, 10, "CHF") }, "de-CH", "CHF\u00a010.00"},
+	{func(env native.Env) string { return FormatCurrency(env, 10, "BRL") }, "pt-BR", "R$\u00a010,00"},
+}
+
+func TestNumberFormatting(t *testing.T) {
+	for _, test := range numberTests {
+		got := test.got(testEnv{locale: test.locale})
+		if got != test.expected {
+			t.Errorf("locale %q: expecting %q, got %q", test.locale, test.expected, got)
+		}
+	}
+}
+
+var numberPanicTests = []struct {
+	f        func(env native.Env) string
+	expected string
+}{
+	{func(env native.Env) string { return FormatNumber(env, "5", 0) }, "formatNumber: cannot format non-numeric value of type string"},
+	{func(env native.Env) string { return FormatNumber(env, nil, 0) }, "formatNumber: cannot format nil value"},
+	{func(env native.Env) string { return FormatNumber(env, 5, -2) }, "formatNumber: invalid decimals -2"},
+	{func(env native.Env) string { return FormatPercent(env, 5, 101) }, "formatPercent: invalid decimals 101"},
+	{func(env native.Env) string { return FormatCurrency(env, 5, "eur") }, `formatCurrency: invalid currency code "eur"`},
+	{func(env native.Env) string { return FormatCurrency(env, 5, "EURO") }, `formatCurrency: invalid currency code "EURO"`},
+}
+
+func TestNumberFormattingPanics(t *testing.T) {
+	for _, test := range numberPanicTests {
+		func() {
+			defer func() {
+				if got := recover(); got != test.expected {
+					t.Errorf("expecting panic %q, got %v", test.expected, got)
+				}
+			}()
+			_ = test.f(testEnv{})
+		}()
+	}
+}
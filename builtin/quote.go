@@ -0,0 +1,47 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builtin
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/open2b/scriggo/native"
+)
+
+// Quoted is a double-quoted Go string literal, as returned by Quote.
+//
+// In HTML, CSS, Markdown and text contexts, and in JavaScript and JSON
+// strings, a Quoted value is shown as the Go string literal, escaped
+// according to the context. In JavaScript and JSON contexts it is shown as a
+// string literal of that context with the same unquoted value.
+type Quoted string
+
+// String returns q as a string.
+func (q Quoted) String() string {
+	return string(q)
+}
+
+// JS returns q as a JavaScript string literal.
+func (q Quoted) JS() native.JS {
+	return native.JS(q.literal())
+}
+
+// JSON returns q as a JSON string literal.
+func (q Quoted) JSON() native.JSON {
+	return native.JSON(q.literal())
+}
+
+// literal returns the unquoted value of q as a JSON string literal. As the
+// HTML characters and the line and paragraph separators are escaped, it is
+// also a valid JavaScript string literal.
+func (q Quoted) literal() string {
+	s, err := strconv.Unquote(string(q))
+	if err != nil {
+		s = string(q)
+	}
+	b, _ := json.Marshal(s)
+	return string(b)
+}
@@ -9,6 +9,7 @@
 package builtin
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -20,6 +21,32 @@ import (
 // largest representable duration to approximately 290 years.
 type Duration = time.Duration
 
+// A Layout is a layout that defines the format of a time value, as in the
+// Format method of Time. Constant layouts are validated at compile time.
+type Layout string
+
+// layoutTimes are two times that differ in every element of a layout.
+var layoutTimes = [2]time.Time{
+	time.Date(2006, 1, 2, 15, 4, 5, 999999999, time.FixedZone("MST", -7*60*60)),
+	time.Date(2017, 11, 28, 3, 37, 48, 123456789, time.FixedZone("CET", 1*60*60)),
+}
+
+// CheckConstant checks the layout. It returns an error if layout is empty or
+// if it does not contain any element of the reference time. For example, it
+// returns an error for the layouts "YYYY-MM-DD" and "%Y-%m-%d".
+//
+// It implements the native.ConstantChecker interface.
+func (layout Layout) CheckConstant() error {
+	if layout == "" {
+		return errors.New("invalid empty layout")
+	}
+	l := string(layout)
+	if layoutTimes[0].Format(l) == layoutTimes[1].Format(l) {
+		return fmt.Errorf("invalid layout %q: it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006", l)
+	}
+	return nil
+}
+
 // A Time represents an instant in time.
 //
 // It is a stripped down version of the Go time.Time type, with additional
@@ -104,3 +104,80 @@ func TestTime(t *testing.T) {
 		}
 	}
 }
+
+func TestLayoutCheckConstant(t *testing.T) {
+	for _, cas := range parseTimeTests {
+		if err := Layout(cas.layout).CheckConstant(); err != nil {
+			t.Errorf("layout %q: unexpected error %q", cas.layout, err)
+		}
+	}
+	for _, layout := range []string{time.Kitchen, time.Stamp, "Jan", "2006", "PM", "MST", ".000"} {
+		if err := Layout(layout).CheckConstant(); err != nil {
+			t.Errorf("layout %q: unexpected error %q", layout, err)
+		}
+	}
+	invalid := []struct {
+		layout string
+		err    string
+	}{
+		{"", "invalid empty layout"},
+		{"YYYY-MM-DD", `invalid layout "YYYY-MM-DD": it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006`},
+		{"%Y-%m-%d", `invalid layout "%Y-%m-%d": it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006`},
+		{"dd/mm/yyyy HH:MM", `invalid layout "dd/mm/yyyy HH:MM": it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006`},
+	}
+	for _, cas := range invalid {
+		err := Layout(cas.layout).CheckConstant()
+		if err == nil {
+			t.Errorf("layout %q: expecting error %q, got no error", cas.layout, cas.err)
+		} else if err.Error() != cas.err {
+			t.Errorf("layout %q: expecting error %q, got %q", cas.layout, cas.err, err)
+		}
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skip(err)
+	}
+	tt := time.Date(2021, 3, 27, 11, 21, 14, 0, time.UTC)
+	tests := []struct {
+		t        interface{}
+		layout   Layout
+		loc      *time.Location
+		expected string
+	}{
+		{tt, "2006-01-02 15:04 MST", nil, "2021-03-27 11:21 UTC"},
+		{NewTime(tt), "Jan 2, 2006", nil, "Mar 27, 2021"},
+		{"2021-03-27T11:21:14+01:00", time.Kitchen, nil, "11:21AM"},
+		{"2021-03-27T11:21:14.5Z", "15:04:05.0", nil, "11:21:14.5"},
+		{tt, "2006-01-02 15:04 MST", rome, "2021-03-27 12:21 CET"},
+		{"2021-03-27T11:21:14Z", "15:04", rome, "12:21"},
+	}
+	for _, test := range tests {
+		got := FormatDate(testEnv{loc: test.loc}, test.t, test.layout)
+		if got != test.expected {
+			t.Errorf("expecting %q, got %q", test.expected, got)
+		}
+	}
+	panics := []struct {
+		t      interface{}
+		layout Layout
+		msg    string
+	}{
+		{"2021-03-27", "15:04", `formatDate: cannot parse "2021-03-27" as RFC 3339 time`},
+		{5, "15:04", "formatDate: cannot format value of type int"},
+		{nil, "15:04", "formatDate: cannot format nil value"},
+		{tt, "hh:mm", `formatDate: invalid layout "hh:mm": it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006`},
+	}
+	for _, test := range panics {
+		func() {
+			defer func() {
+				if got := recover(); got != test.msg {
+					t.Errorf("expecting panic %q, got %v", test.msg, got)
+				}
+			}()
+			_ = FormatDate(testEnv{}, test.t, test.layout)
+		}()
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/native"
+)
+
+// buildSite renders the site rooted at the directory root and writes it to
+// the directory out. The HTML and Markdown files are rendered as the serve
+// command renders them, and written as HTML files, except the files extended,
+// imported or rendered by other files, as layouts and partials. The other
+// files are copied. Files and directories whose names start with '.' are
+// ignored, as is the directory out if it is in root.
+//
+// The pages are built and rendered in parallel, and their builds share the
+// same types registry.
+func buildSite(root, out string) error {
+
+	fsys := os.DirFS(root)
+
+	// Ignore the output directory if it is in the root directory.
+	var outName string
+	if rel, err := filepath.Rel(root, out); err == nil {
+		rel = filepath.ToSlash(rel)
+		if rel != ".." && !strings.HasPrefix(rel, "../") {
+			outName = rel
+		}
+	}
+	if outName == "." {
+		return fmt.Errorf("output directory cannot be the root directory")
+	}
+
+	// Read the pages to render and the files to copy.
+	var pages, files []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") || name == outName {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		switch path.Ext(name) {
+		case ".html":
+			pages = append(pages, name)
+		case ".md":
+			// As for the serve command, an HTML file takes precedence over
+			// the Markdown file with the same name.
+			if _, err := fs.Stat(fsys, strings.TrimSuffix(name, ".md")+".html"); err == nil {
+				return nil
+			}
+			pages = append(pages, name)
+		default:
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Build the pages in parallel, recording the files they depend on.
+	site := &siteBuilder{
+		fsys:         fsys,
+		out:          out,
+		mdConverter:  newMarkdownConverter(),
+		types:        scriggo.NewTypesRegistry(),
+		dependencies: map[string]bool{},
+	}
+	templates := make([]*scriggo.Template, len(pages))
+	errs := make([]error, len(pages))
+	parallel(len(pages), func(i int) {
+		templates[i], errs[i] = site.build(pages[i])
+	})
+
+	// Render, in parallel, the pages that are not dependencies of other
+	// pages, as layouts and partials.
+	var n int
+	for i, name := range pages {
+		if site.dependencies[name] {
+			continue
+		}
+		if errs[i] != nil {
+			return errs[i]
+		}
+		pages[n], templates[n] = name, templates[i]
+		n++
+	}
+	pages, templates = pages[:n], templates[:n]
+	errs = errs[:n]
+	parallel(n, func(i int) {
+		errs[i] = site.render(pages[i], templates[i])
+	})
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// Copy the other files.
+	for _, name := range files {
+		err = site.copy(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%d pages rendered, %d files copied to %s\n", len(pages), len(files), out)
+
+	return nil
+}
+
+// siteBuilder builds and renders the pages and copies the files of a site.
+type siteBuilder struct {
+	fsys        fs.FS
+	out         string
+	mdConverter scriggo.Converter
+	types       *scriggo.TypesRegistry
+
+	mu           sync.Mutex
+	dependencies map[string]bool // files extended, imported or rendered.
+}
+
+// build builds the named page and records the files it depends on.
+func (site *siteBuilder) build(name string) (*scriggo.Template, error) {
+	opts := scriggo.BuildOptions{
+		AllowGoStmt:       true,
+		MarkdownConverter: site.mdConverter,
+		Globals:           make(native.Declarations, len(globals)+1),
+		TreeTransformer:   site.addDependencies,
+		TypesRegistry:     site.types,
+	}
+	for n, v := range globals {
+		opts.Globals[n] = v
+	}
+	opts.Globals["filepath"] = strings.TrimSuffix(name, path.Ext(name))
+	return scriggo.BuildTemplate(site.fsys, name, &opts)
+}
+
+// addDependencies records the files extended, imported and rendered by tree.
+func (site *siteBuilder) addDependencies(tree *ast.Tree) error {
+	var dependencies []string
+	for _, node := range tree.Nodes {
+		astutil.Inspect(node, func(node ast.Node) bool {
+			var ref *ast.Tree
+			switch n := node.(type) {
+			case *ast.Extends:
+				ref = n.Tree
+			case *ast.Import:
+				ref = n.Tree
+			case *ast.Render:
+				ref = n.Tree
+			}
+			if ref != nil {
+				dependencies = append(dependencies, ref.Path)
+			}
+			return true
+		})
+	}
+	site.mu.Lock()
+	for _, name := range dependencies {
+		site.dependencies[name] = true
+	}
+	site.mu.Unlock()
+	return nil
+}
+
+// render renders the template of the named page and writes it to the output
+// directory with the '.html' extension.
+func (site *siteBuilder) render(name string, template *scriggo.Template) error {
+	var b bytes.Buffer
+	err := template.Run(&b, nil, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return site.write(strings.TrimSuffix(name, path.Ext(name))+".html", b.Bytes())
+}
+
+// copy copies the named file to the output directory.
+func (site *siteBuilder) copy(name string) error {
+	src, err := site.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := site.create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// write writes data to the named file in the output directory.
+func (site *siteBuilder) write(name string, data []byte) error {
+	f, err := site.create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// create creates the named file in the output directory, creating also its
+// parent directories.
+func (site *siteBuilder) create(name string) (*os.File, error) {
+	name = filepath.Join(site.out, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(name), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
+
+// parallel calls f(i), for i from 0 to n-1, with as many goroutines as the
+// number of CPUs, and waits for the calls to return.
+func parallel(n int, f func(i int)) {
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			for i := range indexes {
+				f(i)
+			}
+			wg.Done()
+		}()
+	}
+	for i := 0; i < n; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
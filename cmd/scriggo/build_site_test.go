@@ -0,0 +1,77 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBuildSite tests the buildSite function.
+func TestBuildSite(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"index.html":          `{% import "imports/macros.html" %}{{ Title(filepath) }}`,
+		"imports/macros.html": `{% macro Title(s string) %}<h1>{{ s }}</h1>{% end %}`,
+		"about.html":          `<p>about</p>`,
+		"about.md":            `# About`,
+		"blog/post.md":        `{% extends "/layout.html" %}{% macro Content %}# {{ filepath }}{% end %}`,
+		"layout.html":         `<main>{{ Content() }}</main>`,
+		"css/style.css":       `body { margin: 0 }`,
+		".git/HEAD":           `ref: refs/heads/main`,
+	}
+	for name, data := range files {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(name, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(root, "public")
+	err := buildSite(root, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"index.html":     `<h1>index</h1>`,
+		"about.html":     `<p>about</p>`,
+		"blog/post.html": "<main><h1 id=\"blogpost\">blog/post</h1>\n</main>",
+		"css/style.css":  `body { margin: 0 }`,
+	}
+	var got []string
+	err = filepath.Walk(out, func(name string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(out, name)
+		got = append(got, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("expected files %d, got %q", len(expected), got)
+	}
+	for name, data := range expected {
+		b, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != data {
+			t.Fatalf("%s: expected %q, got %q", name, data, b)
+		}
+	}
+	// The output directory cannot be the root directory.
+	err = buildSite(root, root)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
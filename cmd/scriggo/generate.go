@@ -18,6 +18,8 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/open2b/scriggo/native"
+
 	pkgs "golang.org/x/tools/go/packages"
 )
 
@@ -227,9 +229,12 @@ func init() {
 	{{- range .Declarations}}
 	decs["{{.Name}}"] = {{.Value}}
 	{{- end}}
-	{{.Variable}}[{{.Path}}] = native.Package{
-		Name:         {{.Name}},
-		Declarations: decs,
+	{{.Variable}}[{{.Path}}] = native.VersionedPackage{
+		Package: native.Package{
+			Name:         {{.Name}},
+			Declarations: decs,
+		},
+		ABI: {{$.ABIVersion}},
 	}
 
 	{{- end}}
@@ -245,6 +250,7 @@ func init() {
 		"MustImportReflect": mustImportReflect,
 		"Variable":          sf.variable,
 		"PkgContent":        allPkgsContent,
+		"ABIVersion":        native.ABIVersion,
 	}
 
 	t := template.Must(template.New("packages").Parse(pkgsSkeleton))
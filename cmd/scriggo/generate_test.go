@@ -64,9 +64,12 @@ func Test_renderPackages(t *testing.T) {
 				decs["Sscanln"] = fmt.Sscanln
 				decs["State"] = reflect.TypeOf((*fmt.State)(nil)).Elem()
 				decs["Stringer"] = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
-				packages["custom/fmt/path"] = native.Package{
-					Name: "fmt",
-					Declarations: decs,
+				packages["custom/fmt/path"] = native.VersionedPackage{
+					Package: native.Package{
+						Name: "fmt",
+						Declarations: decs,
+					},
+					ABI: 1,
 				}
 			}`,
 		},
@@ -119,9 +122,12 @@ func Test_renderPackages(t *testing.T) {
 				decs["TypeXGlobalHeader"] = native.UntypedNumericConst("103")
 				decs["TypeXHeader"] = native.UntypedNumericConst("120")
 				decs["Writer"] = reflect.TypeOf((*tar.Writer)(nil)).Elem()
-				packages["archive/tar"] = native.Package{
-					Name: "tar",
-					Declarations: decs,
+				packages["archive/tar"] = native.VersionedPackage{
+					Package: native.Package{
+						Name: "tar",
+						Declarations: decs,
+					},
+					ABI: 1,
 				}
 			}`,
 		},
@@ -170,9 +176,12 @@ func Test_renderPackages(t *testing.T) {
 				decs["Sscanln"] = fmt.Sscanln
 				decs["State"] = reflect.TypeOf((*fmt.State)(nil)).Elem()
 				decs["Stringer"] = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
-				packages["fmt"] = native.Package{
-					Name: "fmt",
-					Declarations: decs,
+				packages["fmt"] = native.VersionedPackage{
+					Package: native.Package{
+						Name: "fmt",
+						Declarations: decs,
+					},
+					ABI: 1,
 				}
 			}`,
 		},
@@ -201,9 +210,12 @@ func Test_renderPackages(t *testing.T) {
 				// "fmt"
 				decs = make(native.Declarations, 1)
 				decs["Println"] = fmt.Println
-				packages["fmt"] = native.Package{
-					Name:      "fmt",
-					Declarations: decs,
+				packages["fmt"] = native.VersionedPackage{
+					Package: native.Package{
+						Name:      "fmt",
+						Declarations: decs,
+					},
+					ABI: 1,
 				}
 			}`,
 		},
@@ -20,6 +20,8 @@ The commands are:
     serve       run a web server and serve the template rooted at the current
                 directory
 
+    build-site  render the template rooted at a directory to a static site
+
     init        initialize an interpreter for Go programs
 
     import      generate the source for an importer used by Scriggo to import 
@@ -230,6 +232,27 @@ maximum length, in runes, of disassembled Text instructions
 The --metrics flags prints metrics about execution time.
 `
 
+const helpBuildSite = `
+usage: scriggo build-site [-o dir] [root]
+
+Build-site renders the template rooted at the directory root, or at the
+current directory if root is not given, and writes the resulting static site
+to the directory dir, by default 'public'.
+
+The HTML and Markdown files are rendered as the serve command renders them
+and are written with the '.html' extension. For example:
+
+    article.html       is written to  public/article.html
+    blog/index.md      is written to  public/blog/index.html
+
+If both 'article.html' and 'article.md' exist, only 'article.html' is
+rendered. The other files are copied unchanged. Files and directories whose
+names start with '.' are ignored, as is the output directory.
+
+The pages are rendered in parallel. If a page fails to build or to render,
+build-site exits with its error.
+`
+
 const helpScriggofile = `
 A Scriggofile is a file with a specific format used by the scriggo command.
 The scriggo command uses the instructions in a Scriggofile to initialize an
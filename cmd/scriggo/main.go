@@ -107,6 +107,9 @@ var commandsHelp = map[string]func(){
 	},
 
 	// Commands helps.
+	"build-site": func() {
+		txtToHelp(helpBuildSite)
+	},
 	"bug": func() {
 		stderr(
 			`usage: scriggo bug`,
@@ -151,6 +154,25 @@ var commandsHelp = map[string]func(){
 //		scriggo command
 //
 var commands = map[string]func(){
+	"build-site": func() {
+		flag.Usage = commandsHelp["build-site"]
+		o := flag.String("o", "public", "write the site to the named directory.")
+		flag.Parse()
+		root := "."
+		switch n := len(flag.Args()); n {
+		case 0:
+		case 1:
+			root = flag.Arg(0)
+		default:
+			flag.Usage()
+			exitError(`bad number of arguments`)
+		}
+		err := buildSite(root, *o)
+		if err != nil {
+			exitError("%s", err)
+		}
+		exit(0)
+	},
 	"bug": func() {
 		flag.Usage = commandsHelp["bug"]
 		fmt.Fprintf(os.Stdout, "If you encountered an issue, report it at:\n\n\thttps://github.com/open2b/scriggo/issues/new\n\n")
@@ -48,17 +48,10 @@ func serve(asm int, metrics bool) error {
 	}
 	defer fsys.Close()
 
-	md := goldmark.New(
-		goldmark.WithRendererOptions(html.WithUnsafe()),
-		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
-		goldmark.WithExtensions(extension.GFM))
-
 	srv := &server{
-		fsys:   fsys,
-		static: http.FileServer(http.Dir(".")),
-		mdConverter: func(src []byte, out io.Writer) error {
-			return md.Convert(src, out)
-		},
+		fsys:                  fsys,
+		static:                http.FileServer(http.Dir(".")),
+		mdConverter:           newMarkdownConverter(),
 		templates:             map[string]*scriggo.Template{},
 		templatesDependencies: map[string]map[string]struct{}{},
 		asm:                   asm,
@@ -114,6 +107,19 @@ func serve(asm int, metrics bool) error {
 	return s.ListenAndServe()
 }
 
+// newMarkdownConverter returns the converter used to convert Markdown to HTML.
+// It uses the Goldmark parser with the options html.WithUnsafe,
+// parser.WithAutoHeadingID and extension.GFM.
+func newMarkdownConverter() scriggo.Converter {
+	md := goldmark.New(
+		goldmark.WithRendererOptions(html.WithUnsafe()),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+		goldmark.WithExtensions(extension.GFM))
+	return func(src []byte, out io.Writer) error {
+		return md.Convert(src, out)
+	}
+}
+
 func (srv *server) updateTemplateDependencies(tree *ast.Tree) error {
 
 	var treeNavigation func(*ast.Tree, bool) []string
@@ -419,6 +425,11 @@ var globals = native.Declarations{
 	"form":        (*builtin.FormData)(nil),
 	"queryEscape": builtin.QueryEscape,
 
+	// number formatting
+	"formatCurrency": builtin.FormatCurrency,
+	"formatNumber":   builtin.FormatNumber,
+	"formatPercent":  builtin.FormatPercent,
+
 	// regexp
 	"Regexp": reflect.TypeOf(builtin.Regexp{}),
 	"regexp": builtin.RegExp,
@@ -443,6 +454,8 @@ var globals = native.Declarations{
 	"indexAny":      builtin.IndexAny,
 	"join":          builtin.Join,
 	"lastIndex":     builtin.LastIndex,
+	"quote":         builtin.Quote,
+	"repeat":        builtin.Repeat,
 	"replace":       builtin.Replace,
 	"replaceAll":    builtin.ReplaceAll,
 	"runeCount":     builtin.RuneCount,
@@ -464,6 +477,7 @@ var globals = native.Declarations{
 	// time
 	"Duration":      reflect.TypeOf(builtin.Duration(0)),
 	"Hour":          time.Hour,
+	"Layout":        reflect.TypeOf(builtin.Layout("")),
 	"Microsecond":   time.Microsecond,
 	"Millisecond":   time.Millisecond,
 	"Minute":        time.Minute,
@@ -471,6 +485,7 @@ var globals = native.Declarations{
 	"Second":        time.Second,
 	"Time":          reflect.TypeOf(builtin.Time{}),
 	"date":          builtin.Date,
+	"formatDate":    builtin.FormatDate,
 	"now":           builtin.Now,
 	"parseDuration": builtin.ParseDuration,
 	"parseTime":     builtin.ParseTime,
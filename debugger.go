@@ -0,0 +1,255 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/open2b/scriggo/internal/compiler"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// Debugger debugs the execution of the programs and templates built with the
+// Debug build option. It is set with the Debugger run option.
+//
+// The execution stops before a statement, calling the stop function passed
+// to NewDebugger, if the statement is on a line with a breakpoint or if the
+// Step method has been called. The execution resumes when the stop function
+// returns. Multiple statements on the same line stop the execution only once.
+//
+// The execution also stops after the assignment of a package-level variable
+// watched with the Watch method. Watchpoints do not require the Debug build
+// option.
+//
+// The methods of a Debugger can be called concurrently, also by the stop
+// function.
+type Debugger struct {
+	stop        func(frame *DebugFrame)
+	mu          sync.Mutex
+	breakpoints map[breakpoint]bool
+	watched     map[string]bool
+	step        bool
+	path        string // path of the last executed statement.
+	line        int    // line of the last executed statement.
+}
+
+// breakpoint is a breakpoint of a Debugger.
+type breakpoint struct {
+	path string
+	line int
+}
+
+// NewDebugger returns a new debugger that calls stop when the execution
+// stops. stop is called in the goroutine that executes the statement, so it
+// can be called concurrently if the executed code starts goroutines.
+func NewDebugger(stop func(frame *DebugFrame)) *Debugger {
+	return &Debugger{stop: stop, breakpoints: map[breakpoint]bool{}, watched: map[string]bool{}}
+}
+
+// SetBreakpoint sets a breakpoint at the given line of the file with the
+// given path. For templates, the path is the path of the file, as
+// "partials/header.html", and for programs it is the path of the package, as
+// "main".
+func (d *Debugger) SetBreakpoint(path string, line int) {
+	d.mu.Lock()
+	d.breakpoints[breakpoint{path, line}] = true
+	d.mu.Unlock()
+}
+
+// ClearBreakpoint clears the breakpoint at the given line of the file with
+// the given path, if it exists.
+func (d *Debugger) ClearBreakpoint(path string, line int) {
+	d.mu.Lock()
+	delete(d.breakpoints, breakpoint{path, line})
+	d.mu.Unlock()
+}
+
+// Watch stops the execution after each assignment to the package-level
+// variable with the given name, as in the WatchVars run option.
+func (d *Debugger) Watch(name string) {
+	d.mu.Lock()
+	d.watched[name] = true
+	d.mu.Unlock()
+}
+
+// Unwatch undoes a previous call to Watch with the given name.
+func (d *Debugger) Unwatch(name string) {
+	d.mu.Lock()
+	delete(d.watched, name)
+	d.mu.Unlock()
+}
+
+// Step stops the execution before the next statement on another line. It is
+// usually called by the stop function before returning.
+func (d *Debugger) Step() {
+	d.mu.Lock()
+	d.step = true
+	d.mu.Unlock()
+}
+
+// Continue resumes the execution until the next breakpoint, undoing a
+// previous call to Step.
+func (d *Debugger) Continue() {
+	d.mu.Lock()
+	d.step = false
+	d.mu.Unlock()
+}
+
+// statement is called before the execution of a statement.
+func (d *Debugger) statement(frame *runtime.DebugFrame) {
+	path := frame.Path()
+	line := frame.Position().Line
+	d.mu.Lock()
+	if path == d.path && line == d.line {
+		d.mu.Unlock()
+		return
+	}
+	d.path = path
+	d.line = line
+	stop := d.step || d.breakpoints[breakpoint{path, line}]
+	if stop {
+		d.step = false
+	}
+	d.mu.Unlock()
+	if stop {
+		d.stop(newDebugFrame(frame))
+	}
+}
+
+// assigned is called after the assignment of the package-level variable
+// with the given name.
+func (d *Debugger) assigned(frame *runtime.DebugFrame, name string) {
+	d.mu.Lock()
+	stop := d.watched[name]
+	d.mu.Unlock()
+	if stop {
+		f := newDebugFrame(frame)
+		f.Var = name
+		f.Stack = frame.Stack()
+		d.stop(f)
+	}
+}
+
+// debuggerHook implements the runtime.Debugger interface for a Debugger.
+type debuggerHook struct {
+	d *Debugger
+}
+
+func (h debuggerHook) Statement(frame *runtime.DebugFrame) {
+	h.d.statement(frame)
+}
+
+// DebugFrame is the frame of a function whose execution has been stopped by
+// a Debugger.
+type DebugFrame struct {
+
+	// Path is the path of the file of the statement, for templates, or the
+	// path of its package, for programs. See the SetBreakpoint method.
+	Path string
+
+	// Position is the position of the statement that is going to be
+	// executed. After the assignment of a watched variable, it is the
+	// position of the assignment statement, if the program or template has
+	// been built with the Debug build option, otherwise it is zero.
+	Position Position
+
+	// Function is the name of the function, as "main.f". For templates, it
+	// is the name of the macro, or "main" for the code outside macros.
+	Function string
+
+	// Registers are the registers of the function. Local variables are
+	// stored in the registers, but their names are not recorded by the
+	// compiler.
+	Registers DebugRegisters
+
+	// Var is the name of the watched variable, if the execution has been
+	// stopped after its assignment. Otherwise it is empty.
+	Var string
+
+	// Stack is the stack trace, if the execution has been stopped after the
+	// assignment of a watched variable. Otherwise it is nil.
+	Stack []byte
+}
+
+// DebugRegisters are the registers of a function, by kind.
+type DebugRegisters struct {
+	Int     []int64
+	Float   []float64
+	String  []string
+	General []reflect.Value
+}
+
+// newDebugFrame returns a new DebugFrame from a runtime frame.
+func newDebugFrame(frame *runtime.DebugFrame) *DebugFrame {
+	fn := frame.Function()
+	pos := frame.Position()
+	regs := frame.Registers()
+	name := fn.Name
+	if fn.Pkg != "" {
+		name = fn.Pkg + "." + name
+	}
+	return &DebugFrame{
+		Path:     frame.Path(),
+		Position: Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End},
+		Function: name,
+		Registers: DebugRegisters{
+			Int:     regs.Int,
+			Float:   regs.Float,
+			String:  regs.String,
+			General: regs.General,
+		},
+	}
+}
+
+// setWatchpoints sets the watchpoints of vm for the WatchVars and Debugger
+// run options. globals are the global variables of the program or template.
+func setWatchpoints(vm *runtime.VM, globals []compiler.Global, options *RunOptions) {
+	d := options.Debugger
+	watch := options.Watch
+	if watch == nil && d == nil {
+		return
+	}
+	watched := map[string]bool{}
+	if watch != nil {
+		for _, name := range options.WatchVars {
+			watched[name] = true
+		}
+	}
+	// The variables watched by the debugger can change during the
+	// execution, so all variables are watched if there is a debugger.
+	var indexes []int
+	for i, global := range globals {
+		if d != nil || watched[globalName(global)] {
+			indexes = append(indexes, i)
+		}
+	}
+	if indexes == nil {
+		return
+	}
+	vm.SetWatchpoints(indexes, func(frame *runtime.DebugFrame, global int) {
+		name := globalName(globals[global])
+		if watched[name] {
+			f := newDebugFrame(frame)
+			f.Var = name
+			f.Stack = frame.Stack()
+			watch(f)
+		}
+		if d != nil {
+			d.assigned(frame, name)
+		}
+	})
+}
+
+// globalName returns the name of a global variable as it is watched: in the
+// form "path:name" for the package-level variables, as returned by the
+// InitOrder methods, and "pkg.name" for the native variables, as returned by
+// the NativeRefs methods.
+func globalName(global compiler.Global) string {
+	if global.Path != "" {
+		return global.Path + ":" + global.Name
+	}
+	return global.Pkg + "." + global.Name
+}
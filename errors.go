@@ -5,7 +5,11 @@
 package scriggo
 
 import (
+	"bytes"
+	"fmt"
+	"runtime/debug"
 	"strconv"
+	"strings"
 
 	"github.com/open2b/scriggo/internal/compiler"
 	"github.com/open2b/scriggo/internal/runtime"
@@ -27,6 +31,7 @@ func (p Position) String() string {
 // BuildError represents an error occurred building a program or template.
 type BuildError struct {
 	err compiler.Error
+	src []byte // source of the file, if available.
 }
 
 // Error returns a string representation of the error.
@@ -50,6 +55,42 @@ func (err *BuildError) Message() string {
 	return err.err.Message()
 }
 
+// Excerpt returns the line of the source where the error occurred, followed
+// by a line with a caret under the column of the error. For example:
+//
+//   {{ a + "b" }}
+//          ^
+//
+// The tabs before the column are kept so that the caret is correctly aligned.
+// Excerpt returns an empty string if the source is not available, as for
+// programs, or if the error has no position.
+func (err *BuildError) Excerpt() string {
+	pos := err.err.Position()
+	if err.src == nil || pos.Line == 0 || pos.Start > len(err.src) {
+		return ""
+	}
+	start := bytes.LastIndexByte(err.src[:pos.Start], '\n') + 1
+	end := bytes.IndexByte(err.src[pos.Start:], '\n')
+	if end == -1 {
+		end = len(err.src)
+	} else {
+		end += pos.Start
+	}
+	line := bytes.TrimSuffix(err.src[start:end], []byte("\r"))
+	var b strings.Builder
+	b.Write(line)
+	b.WriteByte('\n')
+	for _, r := range string(err.src[start:pos.Start]) {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
 // ExitError represents an exit from an execution with a non-zero status code.
 // It may wrap the error that caused the exit.
 //
@@ -122,3 +163,171 @@ func (p *PanicError) Position() Position {
 	pos := p.p.Position()
 	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
 }
+
+// Stack returns the stack trace of the panic, from the function that
+// panicked to the outermost function. Macros and the functions of the
+// imported and extended files are included.
+func (p *PanicError) Stack() []StackFrame {
+	frames := p.p.Stack()
+	stack := make([]StackFrame, len(frames))
+	for i, frame := range frames {
+		name := frame.Function.Name
+		if pkg := frame.Function.Pkg; pkg != "" {
+			name = pkg + "." + name
+		}
+		stack[i] = StackFrame{
+			Function: name,
+			Path:     frame.Path,
+			Position: Position{Line: frame.Position.Line, Column: frame.Position.Column},
+		}
+	}
+	return stack
+}
+
+// StackFrame represents a frame of the stack trace of a panic.
+type StackFrame struct {
+	Function string   // function name, as "main.f"; it is "main." for function literals.
+	Path     string   // path of the file.
+	Position Position // position of the executing instruction; zero if not known.
+}
+
+// OperationLimitError is the error returned by the Run methods when an
+// execution exceeds one of the limits of OperationLimits.
+type OperationLimitError struct {
+	err *runtime.OperationLimitError
+}
+
+// Error returns a string representing the error, for example "limit of 100
+// native calls exceeded".
+func (err *OperationLimitError) Error() string {
+	return err.err.Error()
+}
+
+// Operations returns the category of the operations that exceeded the
+// limit: "native calls", "map allocations" or "channel operations".
+func (err *OperationLimitError) Operations() string {
+	return err.err.Category.String()
+}
+
+// Limit returns the exceeded limit.
+func (err *OperationLimitError) Limit() int {
+	return err.err.Limit
+}
+
+// MemoryLimitError is the error returned by the Run methods when an
+// execution exceeds the MemoryLimit run option.
+type MemoryLimitError struct {
+	err *runtime.MemoryLimitError
+}
+
+// Error returns a string representing the error, with the path and the
+// position of the allocation that exceeded the limit.
+func (err *MemoryLimitError) Error() string {
+	return err.err.Error()
+}
+
+// Path returns the path of the file that allocates the memory.
+func (err *MemoryLimitError) Path() string {
+	return err.err.Path
+}
+
+// Position returns the position, in the file, of the statement or the
+// expression that allocates the memory.
+func (err *MemoryLimitError) Position() Position {
+	pos := err.err.Position
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
+
+// Limit returns the exceeded limit in bytes.
+func (err *MemoryLimitError) Limit() int {
+	return err.err.Limit
+}
+
+// MarkdownError is the error returned by the Run method of Template when the
+// conversion of a Markdown block to HTML fails or exceeds one of the limits
+// MaxMarkdownSize and MaxMarkdownHTMLSize.
+type MarkdownError struct {
+	err *runtime.MarkdownError
+}
+
+// Error returns a string representing the error, with the path and the
+// position of the conversion and the first line of the block.
+func (err *MarkdownError) Error() string {
+	return err.err.Error()
+}
+
+// Path returns the path of the file that converts the block.
+func (err *MarkdownError) Path() string {
+	return err.err.Path
+}
+
+// Position returns the position, in the file, of the statement or the
+// expression that converts the block.
+func (err *MarkdownError) Position() Position {
+	pos := err.err.Position
+	return Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
+}
+
+// Block returns the Markdown block.
+func (err *MarkdownError) Block() []byte {
+	return err.err.Block
+}
+
+// Unwrap returns the error returned by the converter or the error of the
+// exceeded limit.
+func (err *MarkdownError) Unwrap() error {
+	return err.err.Err
+}
+
+// InternalError represents an internal error occurred building or running a
+// program or template. Build, BuildTemplate and the Run methods return an
+// *InternalError, instead of panicking, when an unexpected panic occurs. It
+// should be reported as a bug.
+type InternalError struct {
+	msg   string
+	stack []byte
+}
+
+// newInternalError returns a new internal error for the recovered panic
+// value r and the stack trace of the panic.
+func newInternalError(r interface{}, stack []byte) *InternalError {
+	msg := strings.TrimPrefix(fmt.Sprint(r), "scriggo: internal error: ")
+	return &InternalError{msg: msg, stack: stack}
+}
+
+// recoverInternalError recovers a panic, if any, and stores in *err an
+// *InternalError. It must be called directly as a deferred function.
+func recoverInternalError(err *error) {
+	if r := recover(); r != nil {
+		*err = newInternalError(r, debug.Stack())
+	}
+}
+
+// recoverRunInternalError is like recoverInternalError but, if *running is
+// true, it panics again with the recovered value. The Run methods set
+// *running while the virtual machine runs, so a panic raised by a call to
+// the Fatal method of native.Env is not recovered. It must be called
+// directly as a deferred function.
+func recoverRunInternalError(err *error, running *bool) {
+	if r := recover(); r != nil {
+		if *running {
+			panic(r)
+		}
+		*err = newInternalError(r, debug.Stack())
+	}
+}
+
+// Error returns a string representation of the error.
+func (err *InternalError) Error() string {
+	return "scriggo: internal error: " + err.msg
+}
+
+// Message returns the error message.
+func (err *InternalError) Message() string {
+	return err.msg
+}
+
+// Stack returns the stack trace of the panic that caused the error.
+func (err *InternalError) Stack() []byte {
+	return err.stack
+}
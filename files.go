@@ -7,7 +7,6 @@ package scriggo
 import (
 	"io"
 	"io/fs"
-	"os"
 	"path"
 	"sort"
 	"strings"
@@ -34,7 +33,7 @@ func (fsys Files) Open(name string) (fs.File, error) {
 			}
 		}
 	}
-	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 }
 
 type filesDir struct {
@@ -98,16 +97,16 @@ type filesFile struct {
 	name   string
 	data   []byte
 	offset int
-	mode   os.FileMode
+	mode   fs.FileMode
 }
 
-func (f *filesFile) Stat() (os.FileInfo, error) {
+func (f *filesFile) Stat() (fs.FileInfo, error) {
 	return (*filesFileInfo)(f), nil
 }
 
 func (f *filesFile) Read(p []byte) (int, error) {
 	if f.offset < 0 {
-		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrInvalid}
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
 	}
 	if f.offset == len(f.data) {
 		return 0, io.EOF
@@ -126,7 +125,7 @@ type filesFileInfo filesFile
 
 func (i *filesFileInfo) Name() string       { return path.Base(i.name) }
 func (i *filesFileInfo) Size() int64        { return int64(len(i.data)) }
-func (i *filesFileInfo) Mode() os.FileMode  { return i.mode }
+func (i *filesFileInfo) Mode() fs.FileMode  { return i.mode }
 func (i *filesFileInfo) ModTime() time.Time { return time.Time{} }
 func (i *filesFileInfo) IsDir() bool        { return i.mode&fs.ModeDir == fs.ModeDir }
 func (i *filesFileInfo) Sys() interface{}   { return nil }
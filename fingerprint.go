@@ -0,0 +1,208 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"reflect"
+	"sort"
+
+	"github.com/open2b/scriggo/internal/compiler"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// fingerprinter computes the fingerprint of compiled code.
+type fingerprinter struct {
+	h     hash.Hash
+	buf   [binary.MaxVarintLen64]byte
+	funcs map[*runtime.Function]int // functions already written.
+}
+
+// fingerprint returns the fingerprint of the code with the main function fn,
+// the globals, the native references, the HTML of the pre-converted Markdown
+// values, and the prologue and epilogue.
+func fingerprint(fn *runtime.Function, globals []compiler.Global, nativeRefs []string, markdownHTML map[string][]byte, prologue, epilogue string) string {
+	fp := &fingerprinter{h: sha256.New(), funcs: map[*runtime.Function]int{}}
+	fp.writeFunction(fn)
+	fp.writeInt(int64(len(globals)))
+	for _, global := range globals {
+		fp.writeString(global.Pkg)
+		fp.writeString(global.Name)
+		fp.writeType(global.Type)
+	}
+	fp.writeInt(int64(len(nativeRefs)))
+	for _, ref := range nativeRefs {
+		fp.writeString(ref)
+	}
+	sources := make([]string, 0, len(markdownHTML))
+	for src := range markdownHTML {
+		sources = append(sources, src)
+	}
+	sort.Strings(sources)
+	fp.writeInt(int64(len(sources)))
+	for _, src := range sources {
+		fp.writeString(src)
+		fp.writeString(string(markdownHTML[src]))
+	}
+	fp.writeString(prologue)
+	fp.writeString(epilogue)
+	return hex.EncodeToString(fp.h.Sum(nil))
+}
+
+// writeFunction writes the function fn and, recursively, the functions it
+// refers to. A function already written is written as a reference.
+func (fp *fingerprinter) writeFunction(fn *runtime.Function) {
+	if fn == nil {
+		fp.writeInt(-1)
+		return
+	}
+	if id, ok := fp.funcs[fn]; ok {
+		fp.writeInt(int64(id))
+		return
+	}
+	id := len(fp.funcs)
+	fp.funcs[fn] = id
+	fp.writeInt(int64(id))
+	fp.writeString(fn.Pkg)
+	fp.writeString(fn.Name)
+	fp.writeString(fn.File)
+	fp.writeType(fn.Type)
+	fp.writeBool(fn.Macro)
+	fp.writeInt(int64(fn.Format))
+	for _, n := range fn.NumReg {
+		fp.writeInt(int64(n))
+	}
+	fp.writeInt(int64(len(fn.Body)))
+	for _, in := range fn.Body {
+		fp.writeInt(int64(in.Op))
+		fp.writeInt(int64(in.A))
+		fp.writeInt(int64(in.B))
+		fp.writeInt(int64(in.C))
+	}
+	fp.writeInt(int64(len(fn.Text)))
+	for _, txt := range fn.Text {
+		fp.writeString(string(txt))
+	}
+	fp.writeInt(int64(len(fn.Types)))
+	for _, t := range fn.Types {
+		fp.writeType(t)
+	}
+	fp.writeInt(int64(len(fn.VarRefs)))
+	for _, ref := range fn.VarRefs {
+		fp.writeInt(int64(ref))
+	}
+	fp.writeInt(int64(len(fn.FinalRegs)))
+	for _, regs := range fn.FinalRegs {
+		fp.writeInt(int64(regs[0]))
+		fp.writeInt(int64(regs[1]))
+	}
+	fp.writeInt(int64(len(fn.FieldIndexes)))
+	for _, index := range fn.FieldIndexes {
+		fp.writeInt(int64(len(index)))
+		for _, i := range index {
+			fp.writeInt(int64(i))
+		}
+	}
+	fp.writeValues(fn.Values)
+	fp.writeInt(int64(len(fn.NativeFunctions)))
+	for _, nf := range fn.NativeFunctions {
+		fp.writeString(nf.Package())
+		fp.writeString(nf.Name())
+		fp.writeType(reflect.TypeOf(nf.Func()))
+	}
+	fp.writeDebugInfo(fn.DebugInfo)
+	fp.writeDebugInfo(fn.StmtDebugInfo)
+	fp.writeFunction(fn.Parent)
+	fp.writeInt(int64(len(fn.Functions)))
+	for _, f := range fn.Functions {
+		fp.writeFunction(f)
+	}
+}
+
+// writeDebugInfo writes the debug information of a function, sorted by
+// address.
+func (fp *fingerprinter) writeDebugInfo(debugInfo map[runtime.Addr]runtime.DebugInfo) {
+	addrs := make([]runtime.Addr, 0, len(debugInfo))
+	for addr := range debugInfo {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	fp.writeInt(int64(len(addrs)))
+	for _, addr := range addrs {
+		info := debugInfo[addr]
+		fp.writeInt(int64(addr))
+		fp.writeString(info.Path)
+		fp.writeInt(int64(info.Position.Line))
+		fp.writeInt(int64(info.Position.Column))
+		fp.writeInt(int64(info.Position.Start))
+		fp.writeInt(int64(info.Position.End))
+	}
+}
+
+// writeValues writes the constant values of a function. Only the types of
+// the general values are written, with the values of the basic kinds.
+func (fp *fingerprinter) writeValues(values runtime.Registers) {
+	fp.writeInt(int64(len(values.Int)))
+	for _, v := range values.Int {
+		fp.writeInt(v)
+	}
+	fp.writeInt(int64(len(values.Float)))
+	for _, v := range values.Float {
+		fp.writeString(fmt.Sprint(v))
+	}
+	fp.writeInt(int64(len(values.String)))
+	for _, v := range values.String {
+		fp.writeString(v)
+	}
+	fp.writeInt(int64(len(values.General)))
+	for _, v := range values.General {
+		if !v.IsValid() {
+			fp.writeType(nil)
+			continue
+		}
+		fp.writeType(v.Type())
+		switch v.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+			reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128, reflect.String:
+			fp.writeString(fmt.Sprint(v))
+		}
+	}
+}
+
+// writeType writes the type t. The types declared in Scriggo are written
+// with their underlying Go types.
+func (fp *fingerprinter) writeType(t reflect.Type) {
+	if t == nil {
+		fp.writeString("")
+		return
+	}
+	fp.writeString(t.String())
+	if st, ok := t.(runtime.ScriggoType); ok {
+		fp.writeString(st.GoType().String())
+	}
+}
+
+func (fp *fingerprinter) writeBool(b bool) {
+	if b {
+		fp.writeInt(1)
+	} else {
+		fp.writeInt(0)
+	}
+}
+
+func (fp *fingerprinter) writeInt(n int64) {
+	m := binary.PutVarint(fp.buf[:], n)
+	fp.h.Write(fp.buf[:m])
+}
+
+func (fp *fingerprinter) writeString(s string) {
+	fp.writeInt(int64(len(s)))
+	fp.h.Write([]byte(s))
+}
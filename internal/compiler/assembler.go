@@ -0,0 +1,658 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// assemblerTypes contains the types of the parameters and results that can
+// be assembled, indexed by name.
+var assemblerTypes = map[string]reflect.Type{
+	"bool":    reflect.TypeOf(false),
+	"int":     reflect.TypeOf(0),
+	"int8":    reflect.TypeOf(int8(0)),
+	"int16":   reflect.TypeOf(int16(0)),
+	"int32":   reflect.TypeOf(int32(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint":    reflect.TypeOf(uint(0)),
+	"uint8":   reflect.TypeOf(uint8(0)),
+	"uint16":  reflect.TypeOf(uint16(0)),
+	"uint32":  reflect.TypeOf(uint32(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"uintptr": reflect.TypeOf(uintptr(0)),
+	"float32": reflect.TypeOf(float32(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"string":  reflect.TypeOf(""),
+}
+
+// assemblerOperations contains the operations of the binary instructions
+// that can be assembled, indexed by name and register type of the operands.
+var assemblerOperations = map[string][4]runtime.Operation{
+	"Add":    {intRegister: runtime.OpAddInt, floatRegister: runtime.OpAddFloat64},
+	"And":    {intRegister: runtime.OpAnd},
+	"AndNot": {intRegister: runtime.OpAndNot},
+	"Concat": {stringRegister: runtime.OpConcat},
+	"Div":    {intRegister: runtime.OpDivInt, floatRegister: runtime.OpDivFloat64},
+	"Mul":    {intRegister: runtime.OpMulInt, floatRegister: runtime.OpMulFloat64},
+	"Or":     {intRegister: runtime.OpOr},
+	"Rem":    {intRegister: runtime.OpRemInt},
+	"Shl":    {intRegister: runtime.OpShlInt},
+	"Shr":    {intRegister: runtime.OpShrInt},
+	"Sub":    {intRegister: runtime.OpSubInt, floatRegister: runtime.OpSubFloat64},
+	"SubInv": {intRegister: runtime.OpSubInvInt, floatRegister: runtime.OpSubInvFloat64},
+	"Xor":    {intRegister: runtime.OpXor},
+}
+
+// assemblerConditions contains the conditions of the If instructions that
+// can be assembled, indexed by name.
+var assemblerConditions = map[string]runtime.Condition{
+	"Equal":           runtime.ConditionEqual,
+	"NotEqual":        runtime.ConditionNotEqual,
+	"Less":            runtime.ConditionLess,
+	"LessEqual":       runtime.ConditionLessEqual,
+	"Greater":         runtime.ConditionGreater,
+	"GreaterEqual":    runtime.ConditionGreaterEqual,
+	"LenEqual":        runtime.ConditionLenEqual,
+	"LenNotEqual":     runtime.ConditionLenNotEqual,
+	"LenLess":         runtime.ConditionLenLess,
+	"LenLessEqual":    runtime.ConditionLenLessEqual,
+	"LenGreater":      runtime.ConditionLenGreater,
+	"LenGreaterEqual": runtime.ConditionLenGreaterEqual,
+}
+
+// Assemble assembles a function from its textual representation, in the
+// format returned by DisassembleFunction, and returns it.
+//
+// Only a subset of the instructions can be assembled: Add, Sub, SubInv, Mul,
+// Div and Rem on int and float registers, And, AndNot, Or, Xor, Shl, Shr,
+// Concat, Move and Load on int, float and string registers, If with the
+// comparison and length conditions on int, float and string registers, Goto
+// and Return. Move+, the Move on int registers fused with the following Add,
+// can also be assembled. The parameters and the results of the function must
+// have a boolean, numeric or string type.
+//
+// A Move can be prefixed by Wide, as in 'Wide Move i1 i200', to address the
+// registers from 128 to 32767, that are the wide registers of the function.
+// Their count is given by the comment '; wide(0,0,0,0)' after the registers
+// count.
+//
+// The values of the Load instructions are added to the values of the function
+// in the order in which they are loaded. The comments with a position, as
+// '; main:5:2', are added to the position table of the function.
+func Assemble(src []byte) (*runtime.Function, error) {
+	lines := strings.Split(string(src), "\n")
+	as := &assembler{
+		fn:     &runtime.Function{},
+		labels: map[int]runtime.Addr{},
+	}
+	if err := as.header(lines[0]); err != nil {
+		return nil, fmt.Errorf("1: %s", err)
+	}
+	for i, line := range lines[1:] {
+		if err := as.line(line); err != nil {
+			return nil, fmt.Errorf("%d: %s", i+2, err)
+		}
+	}
+	if n := len(as.fn.Body); n > 0 {
+		if err := checkFusedInstruction(as.fn.Body[n-1], runtime.OpNone); err != nil {
+			return nil, fmt.Errorf("%d: %s", len(lines), err)
+		}
+	}
+	for addr, label := range as.gotos {
+		labelAddr, ok := as.labels[label]
+		if !ok {
+			return nil, fmt.Errorf("undefined label %d", label)
+		}
+		in := &as.fn.Body[addr]
+		in.A, in.B, in.C = encodeUint24(uint32(labelAddr))
+	}
+	return as.fn, nil
+}
+
+// assembler assembles a function.
+type assembler struct {
+	fn     *runtime.Function
+	labels map[int]runtime.Addr // addresses of the labels.
+	gotos  map[runtime.Addr]int // labels of the Goto instructions.
+}
+
+// header assembles the header of a function, as 'Func f(i1 int) (s1 string)'.
+func (as *assembler) header(line string) error {
+	if strings.HasPrefix(line, "Macro ") {
+		return errors.New("macros cannot be assembled")
+	}
+	if !strings.HasPrefix(line, "Func ") {
+		return errors.New("expected Func")
+	}
+	line = line[len("Func "):]
+	p := strings.IndexByte(line, '(')
+	if p == -1 {
+		return errors.New("expected (")
+	}
+	as.fn.Name = line[:p]
+	line = line[p:]
+	in, line, err := as.parameters(line)
+	if err != nil {
+		return err
+	}
+	var out []reflect.Type
+	if line != "" {
+		if line[0] != ' ' {
+			return fmt.Errorf("unexpected %q", line)
+		}
+		out, line, err = as.parameters(line[1:])
+		if err != nil {
+			return err
+		}
+		if line != "" {
+			return fmt.Errorf("unexpected %q", line)
+		}
+	}
+	as.fn.Type = reflect.FuncOf(in, out, false)
+	return nil
+}
+
+// parameters parses a list of parameters, as '(i1 int, s1 string)', at the
+// beginning of s and returns their types and the rest of s.
+func (as *assembler) parameters(s string) ([]reflect.Type, string, error) {
+	if s == "" || s[0] != '(' {
+		return nil, "", errors.New("expected (")
+	}
+	p := strings.IndexByte(s, ')')
+	if p == -1 {
+		return nil, "", errors.New("expected )")
+	}
+	var types []reflect.Type
+	if list := s[1:p]; list != "" {
+		for _, param := range strings.Split(list, ", ") {
+			fields := strings.Fields(param)
+			if len(fields) != 2 {
+				return nil, "", fmt.Errorf("invalid parameter %q", param)
+			}
+			typ, ok := assemblerTypes[fields[1]]
+			if !ok {
+				return nil, "", fmt.Errorf("unsupported type %s", fields[1])
+			}
+			types = append(types, typ)
+		}
+	}
+	return types, s[p+1:], nil
+}
+
+// line assembles a line of the body of a function.
+func (as *assembler) line(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "; regs(") && strings.HasSuffix(line, ")") {
+		regs := strings.Split(line[len("; regs("):len(line)-1], ",")
+		if len(regs) != 4 {
+			return errors.New("invalid registers count")
+		}
+		for t, r := range regs {
+			n, err := strconv.ParseInt(r, 10, 8)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid registers count %q", r)
+			}
+			as.fn.NumReg[t] = int8(n)
+		}
+		return nil
+	}
+	if strings.HasPrefix(line, "; wide(") && strings.HasSuffix(line, ")") {
+		regs := strings.Split(line[len("; wide("):len(line)-1], ",")
+		if len(regs) != 4 {
+			return errors.New("invalid wide registers count")
+		}
+		for t, r := range regs {
+			n, err := strconv.ParseInt(r, 10, 16)
+			if err != nil || n < 0 || n > maxWideRegistersCount {
+				return fmt.Errorf("invalid wide registers count %q", r)
+			}
+			as.fn.NumWideReg[t] = int16(n)
+		}
+		return nil
+	}
+	if strings.HasPrefix(line, "; ") {
+		return as.position(line[2:])
+	}
+	// Parse the label.
+	if p := strings.IndexByte(line, ':'); p > 0 {
+		if label, err := strconv.Atoi(line[:p]); err == nil {
+			if _, ok := as.labels[label]; ok {
+				return fmt.Errorf("label %d redeclared", label)
+			}
+			as.labels[label] = runtime.Addr(len(as.fn.Body))
+			line = strings.TrimSpace(line[p+1:])
+		}
+	}
+	tokens, err := tokenizeInstruction(line)
+	if err != nil {
+		return err
+	}
+	var words []runtime.Instruction
+	if tokens[0] == "Wide" {
+		words, err = as.wide(tokens[1:])
+	} else {
+		var in runtime.Instruction
+		in, err = as.instruction(tokens)
+		words = []runtime.Instruction{in}
+	}
+	if err != nil {
+		return err
+	}
+	// A fused instruction must be followed by the instruction it fuses.
+	if n := len(as.fn.Body); n > 0 {
+		if err := checkFusedInstruction(as.fn.Body[n-1], words[0].Op); err != nil {
+			return err
+		}
+	}
+	as.fn.Body = append(as.fn.Body, words...)
+	return nil
+}
+
+// position assembles an entry of the position table, as 'main:5:2', for the
+// next instruction.
+func (as *assembler) position(s string) error {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return fmt.Errorf("invalid position %q", s)
+	}
+	j := strings.LastIndexByte(s[:i], ':')
+	if j < 0 {
+		return fmt.Errorf("invalid position %q", s)
+	}
+	line, err := strconv.Atoi(s[j+1 : i])
+	if err != nil || line < 0 {
+		return fmt.Errorf("invalid position %q", s)
+	}
+	column, err := strconv.Atoi(s[i+1:])
+	if err != nil || column < 0 {
+		return fmt.Errorf("invalid position %q", s)
+	}
+	as.fn.Positions = append(as.fn.Positions, runtime.PositionEntry{
+		Addr:     runtime.Addr(len(as.fn.Body)),
+		Path:     s[:j],
+		Position: runtime.Position{Line: line, Column: column},
+	})
+	return nil
+}
+
+// instruction assembles the instruction with the given tokens.
+func (as *assembler) instruction(tokens []string) (runtime.Instruction, error) {
+	name, args := tokens[0], tokens[1:]
+	switch name {
+	case "Return":
+		if len(args) != 0 {
+			return runtime.Instruction{}, errors.New("unexpected operands")
+		}
+		return runtime.Instruction{Op: runtime.OpReturn}, nil
+	case "Goto":
+		if len(args) != 1 {
+			return runtime.Instruction{}, errors.New("expected label")
+		}
+		label, err := strconv.Atoi(args[0])
+		if err != nil {
+			return runtime.Instruction{}, fmt.Errorf("invalid label %q", args[0])
+		}
+		if as.gotos == nil {
+			as.gotos = map[runtime.Addr]int{}
+		}
+		as.gotos[runtime.Addr(len(as.fn.Body))] = label
+		return runtime.Instruction{Op: runtime.OpGoto}, nil
+	case "Move", "Move+":
+		if len(args) != 2 {
+			return runtime.Instruction{}, errors.New("expected 2 operands")
+		}
+		t, z, err := as.register(args[1])
+		if err != nil {
+			return runtime.Instruction{}, err
+		}
+		x, k, err := as.operand(args[0], t)
+		if err != nil {
+			return runtime.Instruction{}, err
+		}
+		op := runtime.OpMove
+		if name == "Move+" {
+			if t != intRegister {
+				return runtime.Instruction{}, fmt.Errorf("unsupported operand %s", args[1])
+			}
+			op = runtime.OpMoveAddInt
+		}
+		if k {
+			op = -op
+		}
+		return runtime.Instruction{Op: op, A: int8(t), B: x, C: z}, nil
+	case "Load":
+		if len(args) != 2 {
+			return runtime.Instruction{}, errors.New("expected 2 operands")
+		}
+		t, z, err := as.register(args[1])
+		if err != nil {
+			return runtime.Instruction{}, err
+		}
+		i, err := as.value(args[0], t)
+		if err != nil {
+			return runtime.Instruction{}, err
+		}
+		a, b := encodeValueIndex(t, i)
+		return runtime.Instruction{Op: runtime.OpLoad, A: a, B: b, C: z}, nil
+	case "If":
+		if len(args) != 3 {
+			return runtime.Instruction{}, errors.New("expected 3 operands")
+		}
+		t, x, err := as.register(args[0])
+		if err != nil {
+			return runtime.Instruction{}, err
+		}
+		cond, ok := assemblerConditions[args[1]]
+		if !ok {
+			return runtime.Instruction{}, fmt.Errorf("unsupported condition %s", args[1])
+		}
+		var op runtime.Operation
+		yt := t
+		switch t {
+		case intRegister:
+			op = runtime.OpIfInt
+		case floatRegister:
+			op = runtime.OpIfFloat
+		case stringRegister:
+			op = runtime.OpIfString
+			if cond > runtime.ConditionLenEqual {
+				yt = intRegister
+			}
+		}
+		if cond >= runtime.ConditionLenEqual && t != stringRegister {
+			return runtime.Instruction{}, fmt.Errorf("unsupported condition %s", args[1])
+		}
+		var y int8
+		var k bool
+		if yt == stringRegister && isQuoted(args[2]) {
+			// A constant string operand of If is a single byte.
+			s, _ := strconv.Unquote(args[2])
+			if len(s) != 1 || s[0] > 127 {
+				return runtime.Instruction{}, fmt.Errorf("unsupported operand %s", args[2])
+			}
+			y, k = int8(s[0]), true
+		} else {
+			y, k, err = as.operand(args[2], yt)
+			if err != nil {
+				return runtime.Instruction{}, err
+			}
+		}
+		if k {
+			op = -op
+		}
+		return runtime.Instruction{Op: op, A: x, B: int8(cond), C: y}, nil
+	}
+	ops, ok := assemblerOperations[name]
+	if !ok {
+		return runtime.Instruction{}, fmt.Errorf("unsupported instruction %s", name)
+	}
+	if len(args) != 3 {
+		return runtime.Instruction{}, errors.New("expected 3 operands")
+	}
+	t, x, err := as.register(args[0])
+	if err != nil {
+		return runtime.Instruction{}, err
+	}
+	op := ops[t]
+	if op == 0 {
+		return runtime.Instruction{}, fmt.Errorf("unsupported operand %s", args[0])
+	}
+	y, k, err := as.operand(args[1], t)
+	if err != nil {
+		return runtime.Instruction{}, err
+	}
+	zt, z, err := as.register(args[2])
+	if err != nil {
+		return runtime.Instruction{}, err
+	}
+	if zt != t {
+		return runtime.Instruction{}, fmt.Errorf("unexpected operand %s", args[2])
+	}
+	if k {
+		op = -op
+	}
+	return runtime.Instruction{Op: op, A: x, B: y, C: z}, nil
+}
+
+// wide assembles a Wide instruction, with the tokens of the Move instruction
+// that it extends, and returns its two words.
+func (as *assembler) wide(tokens []string) ([]runtime.Instruction, error) {
+	if len(tokens) == 0 || tokens[0] != "Move" {
+		return nil, errors.New("expected Move after Wide")
+	}
+	args := tokens[1:]
+	if len(args) != 2 {
+		return nil, errors.New("expected 2 operands")
+	}
+	t, x, err := as.wideRegister(args[0])
+	if err != nil {
+		return nil, err
+	}
+	zt, z, err := as.wideRegister(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if zt != t {
+		return nil, fmt.Errorf("unexpected operand %s", args[1])
+	}
+	xh, xl := encodeInt16(x)
+	zh, zl := encodeInt16(z)
+	return []runtime.Instruction{
+		{Op: runtime.OpWide, B: xh, C: zh},
+		{Op: runtime.OpMove, A: int8(t), B: xl, C: zl},
+	}, nil
+}
+
+// checkFusedInstruction checks that the instruction in, if it is a fused
+// instruction, is followed by an instruction with operation next.
+func checkFusedInstruction(in runtime.Instruction, next runtime.Operation) error {
+	op := in.Op
+	if op < 0 {
+		op = -op
+	}
+	ops, ok := fusedOperations[op]
+	if !ok {
+		return nil
+	}
+	if next < 0 {
+		next = -next
+	}
+	if next != ops[1] {
+		return fmt.Errorf("expected %s after %s", operationName[ops[1]], operationName[op])
+	}
+	return nil
+}
+
+// register parses a register operand, as 'i1' or '(i1)', and returns its
+// type and its value. Only int, float and string registers are supported.
+func (as *assembler) register(s string) (registerType, int8, error) {
+	indirect := len(s) > 2 && s[0] == '(' && s[len(s)-1] == ')'
+	if indirect {
+		s = s[1 : len(s)-1]
+	}
+	t, n, err := parseRegister(s, 8)
+	if err != nil {
+		return 0, 0, err
+	}
+	if indirect {
+		n = -n
+	}
+	return t, int8(n), nil
+}
+
+// wideRegister parses a register operand of a Wide instruction, as 'i200',
+// and returns its type and its value.
+func (as *assembler) wideRegister(s string) (registerType, int16, error) {
+	t, n, err := parseRegister(s, 16)
+	return t, int16(n), err
+}
+
+// parseRegister parses a register, as 'i1', whose value has the given bit
+// size. Only int, float and string registers are supported.
+func parseRegister(s string, bitSize int) (registerType, int64, error) {
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("invalid register %q", s)
+	}
+	var t registerType
+	switch s[0] {
+	case 'i':
+		t = intRegister
+	case 'f':
+		t = floatRegister
+	case 's':
+		t = stringRegister
+	default:
+		return 0, 0, fmt.Errorf("unsupported register %q", s)
+	}
+	n, err := strconv.ParseInt(s[1:], 10, bitSize)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid register %q", s)
+	}
+	return t, n, nil
+}
+
+// operand parses an operand of type t that can be a register or a constant.
+// It returns the operand and reports whether it is a constant.
+func (as *assembler) operand(s string, t registerType) (int8, bool, error) {
+	if len(s) >= 2 && (strings.IndexByte("ifsg", s[0]) >= 0 && '0' <= s[1] && s[1] <= '9' || s[0] == '(') {
+		rt, r, err := as.register(s)
+		if err != nil {
+			return 0, false, err
+		}
+		if rt != t {
+			return 0, false, fmt.Errorf("unexpected operand %s", s)
+		}
+		return r, false, nil
+	}
+	switch t {
+	case intRegister:
+		n, err := strconv.ParseInt(s, 10, 8)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid int constant %q", s)
+		}
+		return int8(n), true, nil
+	case floatRegister:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || f != math.Trunc(f) || f < math.MinInt8 || f > math.MaxInt8 {
+			return 0, false, fmt.Errorf("invalid float constant %q", s)
+		}
+		return int8(f), true, nil
+	case stringRegister:
+		if !isQuoted(s) {
+			return 0, false, fmt.Errorf("invalid string constant %q", s)
+		}
+		i, err := as.value(s, stringRegister)
+		if err != nil {
+			return 0, false, err
+		}
+		if i > math.MaxUint8 {
+			return 0, false, errors.New("too many string constants")
+		}
+		return int8(uint8(i)), true, nil
+	}
+	return 0, false, fmt.Errorf("unsupported operand %s", s)
+}
+
+// value adds a value of type t, represented by s, to the values of the
+// function and returns its index. If the value already exists, it returns
+// the index of the existing value.
+func (as *assembler) value(s string, t registerType) (int, error) {
+	values := &as.fn.Values
+	switch t {
+	case intRegister:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid int value %q", s)
+		}
+		for i, v := range values.Int {
+			if v == n {
+				return i, nil
+			}
+		}
+		values.Int = append(values.Int, n)
+		return len(values.Int) - 1, nil
+	case floatRegister:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid float value %q", s)
+		}
+		for i, v := range values.Float {
+			if v == f {
+				return i, nil
+			}
+		}
+		values.Float = append(values.Float, f)
+		return len(values.Float) - 1, nil
+	case stringRegister:
+		str, err := strconv.Unquote(s)
+		if err != nil || !isQuoted(s) {
+			return 0, fmt.Errorf("invalid string value %s", s)
+		}
+		for i, v := range values.String {
+			if v == str {
+				return i, nil
+			}
+		}
+		values.String = append(values.String, str)
+		return len(values.String) - 1, nil
+	}
+	return 0, fmt.Errorf("unsupported value %s", s)
+}
+
+// tokenizeInstruction splits an instruction into tokens separated by spaces.
+// A token can be a double-quoted string containing spaces.
+func tokenizeInstruction(line string) ([]string, error) {
+	var tokens []string
+	src := []byte(line)
+	for len(src) > 0 {
+		if src[0] == ' ' || src[0] == '\t' {
+			src = src[1:]
+			continue
+		}
+		if src[0] == ';' {
+			break
+		}
+		n := bytes.IndexAny(src, " \t")
+		if src[0] == '"' {
+			n = -1
+			for i := 1; i < len(src); i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '"' {
+					n = i + 1
+					break
+				}
+			}
+			if n == -1 {
+				return nil, errors.New("unterminated string")
+			}
+		} else if n == -1 {
+			n = len(src)
+		}
+		tokens = append(tokens, string(src[:n]))
+		src = src[n:]
+	}
+	if tokens == nil {
+		return nil, errors.New("expected instruction")
+	}
+	return tokens, nil
+}
+
+// isQuoted reports whether s is a double-quoted string.
+func isQuoted(s string) bool {
+	return len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"'
+}
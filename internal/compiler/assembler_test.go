@@ -0,0 +1,140 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+func TestAssembleRoundTrip(t *testing.T) {
+	src := `package main
+
+	func sum(a, b int) int {
+		s := 0
+		for i := a; i < b; i++ {
+			if i == 5 {
+				continue
+			}
+			s += i*2 - 1000
+		}
+		s += a
+		return s
+	}
+
+	func half(x float64) float64 {
+		return x/2 + 0.25
+	}
+
+	func greet(name string) string {
+		if len(name) > 10 {
+			return "hi"
+		}
+		return "hello, " + name
+	}
+
+	func wide(v0 int) int {
+		VARS
+		return v1 + v100
+	}
+
+	func main() {
+		_ = sum(1, 10)
+		_ = half(3)
+		_ = greet("scriggo")
+		_ = wide(5)
+	}`
+	// wide declares enough variables to store some of them in wide registers.
+	var vars strings.Builder
+	for i := 1; i <= 100; i++ {
+		_, _ = fmt.Fprintf(&vars, "v%d := v%d + %d\n\t\t", i, i-1, i)
+	}
+	src = strings.Replace(src, "VARS", vars.String(), 1)
+	code, err := BuildProgram(fstest.Files{"main.go": src}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, fn := range code.Main.Functions {
+		if fn.Name == "main" {
+			continue
+		}
+		n++
+		asm := DisassembleFunction(fn, nil, 0)
+		got, err := Assemble(asm)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s\n%s", fn.Name, err, asm)
+		}
+		if got.Name != fn.Name {
+			t.Fatalf("%s: expected name %q, got %q", fn.Name, fn.Name, got.Name)
+		}
+		if got.Type != fn.Type {
+			t.Fatalf("%s: expected type %s, got %s", fn.Name, fn.Type, got.Type)
+		}
+		if got.NumReg != fn.NumReg {
+			t.Fatalf("%s: expected registers %v, got %v", fn.Name, fn.NumReg, got.NumReg)
+		}
+		if got.NumWideReg != fn.NumWideReg {
+			t.Fatalf("%s: expected wide registers %v, got %v", fn.Name, fn.NumWideReg, got.NumWideReg)
+		}
+		if fn.Name == "wide" && !strings.Contains(string(asm), "\tWide Move i") {
+			t.Fatalf("%s: expected Wide Move instructions, got\n%s", fn.Name, asm)
+		}
+		if !reflect.DeepEqual(got.Body, fn.Body) {
+			t.Fatalf("%s: expected body %v, got %v\n%s", fn.Name, fn.Body, got.Body, asm)
+		}
+		if !reflect.DeepEqual(got.Values, fn.Values) {
+			t.Fatalf("%s: expected values %v, got %v", fn.Name, fn.Values, got.Values)
+		}
+		if asm2 := DisassembleFunction(got, nil, 0); string(asm2) != string(asm) {
+			t.Fatalf("%s: expected disassembly\n%s\ngot\n%s", fn.Name, asm, asm2)
+		}
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 functions, got %d", n)
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	cases := []struct {
+		src string
+		err string
+	}{
+		{"", "1: expected Func"},
+		{"Macro M", "1: macros cannot be assembled"},
+		{"Func f(g1 []int)", "1: unsupported type []int"},
+		{"Func f()\n\tNew int g1", "2: unsupported instruction New"},
+		{"Func f()\n\tMove 1 g1", "2: unsupported register \"g1\""},
+		{"Func f()\n\tMove 1000 i1", "2: invalid int constant \"1000\""},
+		{"Func f()\n\tAdd i1 f1 i1", "2: unexpected operand f1"},
+		{"Func f()\n\tIf i1 LenEqual 2", "2: unsupported condition LenEqual"},
+		{"Func f()\n\tMove \"a", "2: unterminated string"},
+		{"Func f()\n\tGoto 1", "undefined label 1"},
+		{"Func f()\n1:\tReturn\n1:\tReturn", "3: label 1 redeclared"},
+		{"Func f()\n\tMove+ f2 f1\n\tAdd f1 f1 f1", "2: unsupported operand f1"},
+		{"Func f()\n\tMove+ 1 i1\n\tReturn", "3: expected Add after Move+"},
+		{"Func f()\n\tMove+ 1 i1", "2: expected Add after Move+"},
+		{"Func f()\n\tWide Add i1 i2 i200", "2: expected Move after Wide"},
+		{"Func f()\n\tWide Move 1 i200", "2: invalid register \"1\""},
+		{"Func f()\n\tWide Move (i1) i200", "2: unsupported register \"(i1)\""},
+		{"Func f()\n\tWide Move i1 s200", "2: unexpected operand s200"},
+		{"Func f()\n\tWide Move i1 i40000", "2: invalid register \"i40000\""},
+		{"Func f()\n\tMove+ 1 i1\n\tWide Move i1 i200", "3: expected Add after Move+"},
+		{"Func f()\n\t; wide(1,2,3)", "2: invalid wide registers count"},
+	}
+	for _, cas := range cases {
+		_, err := Assemble([]byte(cas.src))
+		if err == nil {
+			t.Fatalf("%q: expected error %q, got no error", cas.src, cas.err)
+		}
+		if err.Error() != cas.err {
+			t.Fatalf("%q: expected error %q, got %q", cas.src, cas.err, err)
+		}
+	}
+}
@@ -18,6 +18,7 @@ import (
 const (
 	// Functions.
 	maxRegistersCount        = 127
+	maxWideRegistersCount    = 1<<15 - 1 - maxRegistersCount // 32640
 	maxNativeFunctionsCount  = 256
 	maxScriggoFunctionsCount = 256
 	maxFieldIndexesCount     = 256
@@ -163,15 +164,19 @@ func newNativeFunction(pkg, name string, fn interface{}) *runtime.NativeFunction
 }
 
 type functionBuilder struct {
-	fn                     *runtime.Function
-	labelAddrs             []runtime.Addr // addresses of the labels; the address of the label n is labelAddrs[n-1]
-	gotos                  map[runtime.Addr]label
-	maxRegs                map[registerType]int8 // max number of registers allocated at the same time.
-	numRegs                map[registerType]int8
-	scopes                 []map[string]int8
-	scopeShifts            []runtime.StackShift
-	complexBinaryOpIndexes map[ast.OperatorType]int8 // indexes of complex binary op. functions.
-	complexUnaryOpIndex    int8                      // index of complex negation function.
+	fn          *runtime.Function
+	labelAddrs  []runtime.Addr // addresses of the labels; the address of the label n is labelAddrs[n-1]
+	gotos       map[runtime.Addr]label
+	maxRegs     map[registerType]int8 // max number of registers allocated at the same time.
+	numRegs     map[registerType]int8
+	scopes      []map[string]int16 // registers of the variables; a register greater than 127 is a wide register.
+	scopeShifts []runtime.StackShift
+
+	// numWideRegs is the number of wide registers allocated for each type,
+	// and wideShifts contains the numbers at the entry of each scope, so the
+	// wide registers of the variables of a scope are reused after exiting it.
+	numWideRegs [4]int16
+	wideShifts  [][4]int16
 
 	// text refers to the latest emitted Text instruction with its text to be flushed into the function.
 	text struct {
@@ -184,21 +189,33 @@ type functionBuilder struct {
 	// expression in a template the file path changes even if the function
 	// remains the same.
 	path string
+
+	// intSize is the size in bits of the int, uint and uintptr values on the
+	// target. Zero means the size on the host.
+	intSize int
+
+	// stmtPos is the position of the statement being emitted, if known. It
+	// is reported by the errors of the exceeded limits.
+	stmtPos *ast.Position
+
+	// retargetAddr is the address of the last emitted instruction whose
+	// result register can be changed to remove a following Move instruction.
+	// See removeTrailingMove.
+	retargetAddr runtime.Addr
 }
 
 // newBuilder returns a new function builder for the function fn in the given
 // path.
-func newBuilder(fn *runtime.Function, path string) *functionBuilder {
+func newBuilder(fn *runtime.Function, path string, intSize int) *functionBuilder {
 	fn.Body = nil
 	builder := &functionBuilder{
-		fn:                     fn,
-		gotos:                  map[runtime.Addr]label{},
-		maxRegs:                map[registerType]int8{},
-		numRegs:                map[registerType]int8{},
-		scopes:                 []map[string]int8{},
-		complexBinaryOpIndexes: map[ast.OperatorType]int8{},
-		complexUnaryOpIndex:    -1,
-		path:                   path,
+		fn:      fn,
+		gotos:   map[runtime.Addr]label{},
+		maxRegs: map[registerType]int8{},
+		numRegs: map[registerType]int8{},
+		scopes:  []map[string]int16{},
+		path:    path,
+		intSize: intSize,
 	}
 	return builder
 }
@@ -216,7 +233,8 @@ func (fb *functionBuilder) currentStackShift() runtime.StackShift {
 // enterScope enters a new scope.
 // Every enterScope call must be paired with a corresponding exitScope call.
 func (fb *functionBuilder) enterScope() {
-	fb.scopes = append(fb.scopes, map[string]int8{})
+	fb.scopes = append(fb.scopes, map[string]int16{})
+	fb.wideShifts = append(fb.wideShifts, fb.numWideRegs)
 	fb.enterStack()
 }
 
@@ -224,6 +242,8 @@ func (fb *functionBuilder) enterScope() {
 // Every exitScope call must be paired with a corresponding enterScope call.
 func (fb *functionBuilder) exitScope() {
 	fb.scopes = fb.scopes[:len(fb.scopes)-1]
+	fb.numWideRegs = fb.wideShifts[len(fb.wideShifts)-1]
+	fb.wideShifts = fb.wideShifts[:len(fb.wideShifts)-1]
 	fb.exitStack()
 }
 
@@ -253,6 +273,7 @@ func (fb *functionBuilder) enterStack() {
 // See enterStack documentation for further details and usage.
 func (fb *functionBuilder) exitStack() {
 	shift := fb.scopeShifts[len(fb.scopeShifts)-1]
+	fb.removeTrailingMove(shift)
 	fb.numRegs[intRegister] = shift[intRegister]
 	fb.numRegs[floatRegister] = shift[floatRegister]
 	fb.numRegs[stringRegister] = shift[stringRegister]
@@ -260,12 +281,91 @@ func (fb *functionBuilder) exitStack() {
 	fb.scopeShifts = fb.scopeShifts[:len(fb.scopeShifts)-1]
 }
 
+// removeTrailingMove removes the last instruction, if it is a Move from a
+// register released by exiting the stack with the given shift, changing the
+// result register of the previous instruction if it computes that register.
+// For example
+//
+//     Add x y t
+//     Move t z
+//
+// becomes
+//
+//     Add x y z
+//
+func (fb *functionBuilder) removeTrailingMove(shift runtime.StackShift) {
+	body := fb.fn.Body
+	n := len(body)
+	if n < 2 {
+		return
+	}
+	move := body[n-1]
+	if move.Op != runtime.OpMove || body[n-2].Op == runtime.OpWide {
+		return
+	}
+	t := registerType(move.A)
+	if move.B <= shift[t] || move.B == move.C {
+		return
+	}
+	// The previous instruction must be retargetable, and not an operand of
+	// an instruction with more than one word.
+	if fb.retargetAddr != runtime.Addr(n-2) {
+		return
+	}
+	prev := body[n-2]
+	if prev.C != move.B || !isRetargetableOperation(prev.Op) {
+		return
+	}
+	// A Move of a general register copies the arrays and the structs, as
+	// GetVar already does for a variable that does not have an interface
+	// type.
+	if t == generalRegister {
+		if prev.Op != runtime.OpGetVar || fb.fn.DebugInfo[runtime.Addr(n-2)].OperandKind[2] == reflect.Interface {
+			return
+		}
+	}
+	// The Move instruction must not be the target of a jump.
+	for _, addr := range fb.labelAddrs {
+		if addr >= runtime.Addr(n-1) {
+			return
+		}
+	}
+	if _, ok := fb.fn.DebugInfo[runtime.Addr(n-1)]; ok {
+		return
+	}
+	if _, ok := fb.fn.StmtDebugInfo[runtime.Addr(n-1)]; ok {
+		return
+	}
+	body[n-2].C = move.C
+	fb.fn.Body = body[:n-1]
+}
+
+// isRetargetableOperation reports whether op, or its constant version, can
+// write its result to the destination register of a following Move
+// instruction. op must only set the register c, after reading the registers
+// a and b.
+func isRetargetableOperation(op runtime.Operation) bool {
+	if op < 0 {
+		op = -op
+	}
+	switch op {
+	case runtime.OpAddInt, runtime.OpAddFloat64,
+		runtime.OpSubInt, runtime.OpSubFloat64,
+		runtime.OpSubInvInt, runtime.OpSubInvFloat64,
+		runtime.OpMulInt, runtime.OpMulFloat64,
+		runtime.OpAnd, runtime.OpOr, runtime.OpXor,
+		runtime.OpConcat, runtime.OpGetVar:
+		return true
+	}
+	return false
+}
+
 // newRegister makes a new register of a given kind.
 func (fb *functionBuilder) newRegister(kind reflect.Kind) int8 {
 	t := kindToType(kind)
 	num := fb.numRegs[t]
 	if num == maxRegistersCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "%s registers count exceeded %d", t, maxRegistersCount))
+		panic(fb.limitExceededError("%s registers count exceeded %d", t, maxRegistersCount))
 	}
 	fb.allocRegister(t, num+1)
 	return num + 1
@@ -276,16 +376,56 @@ func (fb *functionBuilder) newIndirectRegister() int8 {
 	return -fb.newRegister(reflect.Interface)
 }
 
+// needsWideRegister reports whether a new local variable with type typ must
+// be stored in a wide register. It is so when most of the registers of its
+// type are already allocated, leaving the others to the temporary values.
+//
+// A wide register is accessed only by a Wide Move instruction, so the
+// variables that are changed in place, the arrays and the structs, are not
+// stored in wide registers.
+func (fb *functionBuilder) needsWideRegister(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Array, reflect.Struct:
+		return false
+	}
+	return fb.numRegs[kindToType(typ.Kind())] >= wideVarsThreshold
+}
+
+// wideVarsThreshold is the number of allocated registers of a type from
+// which the new local variables of that type are stored in wide registers.
+const wideVarsThreshold = 96
+
+// newWideRegister makes a new wide register of a given kind.
+func (fb *functionBuilder) newWideRegister(kind reflect.Kind) int16 {
+	t := kindToType(kind)
+	num := fb.numWideRegs[t]
+	if num == maxWideRegistersCount {
+		panic(fb.limitExceededError("%s wide registers count exceeded %d", t, maxWideRegistersCount))
+	}
+	num++
+	fb.numWideRegs[t] = num
+	if num > fb.fn.NumWideReg[t] {
+		fb.fn.NumWideReg[t] = num
+	}
+	return maxRegistersCount + num
+}
+
 // bindVarReg binds name with register reg. To create a new variable, use
 // VariableRegister in conjunction with bindVarReg.
 func (fb *functionBuilder) bindVarReg(name string, reg int8) {
+	fb.scopes[len(fb.scopes)-1][name] = int16(reg)
+}
+
+// bindWideVar binds name with the wide register reg.
+func (fb *functionBuilder) bindWideVar(name string, reg int16) {
 	fb.scopes[len(fb.scopes)-1][name] = reg
 }
 
 // declaredInCurrentScope returns the register where v is stored and true in
 // case of v is a variable declared in the current scope, else returns 0 and
-// false.
-func (fb *functionBuilder) declaredInCurrentScope(v string) (int8, bool) {
+// false. The register is a wide register if it is greater than
+// maxRegistersCount.
+func (fb *functionBuilder) declaredInCurrentScope(v string) (int16, bool) {
 	reg, ok := fb.scopes[len(fb.scopes)-1][v]
 	return reg, ok
 }
@@ -301,17 +441,36 @@ func (fb *functionBuilder) declaredInFunc(v string) bool {
 	return false
 }
 
-// scopeLookup returns n's register.
+// scopeLookup returns n's register. n must not be stored in a wide register.
 func (fb *functionBuilder) scopeLookup(n string) int8 {
 	for i := len(fb.scopes) - 1; i >= 0; i-- {
 		reg, ok := fb.scopes[i][n]
 		if ok {
-			return reg
+			if reg > maxRegistersCount {
+				panic(fmt.Sprintf("bug: %s is stored in a wide register", n))
+			}
+			return int8(reg)
 		}
 	}
 	panic(fmt.Sprintf("bug: %s not found", n))
 }
 
+// wideScopeLookup returns the wide register of n and true, if n is a variable
+// declared within the function and stored in a wide register. Otherwise it
+// returns 0 and false.
+func (fb *functionBuilder) wideScopeLookup(n string) (int16, bool) {
+	for i := len(fb.scopes) - 1; i >= 0; i-- {
+		reg, ok := fb.scopes[i][n]
+		if ok {
+			if reg > maxRegistersCount {
+				return reg, true
+			}
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
 func (fb *functionBuilder) addPosAndPath(pos *ast.Position) {
 	pc := runtime.Addr(len(fb.fn.Body))
 	if fb.fn.DebugInfo == nil {
@@ -329,6 +488,41 @@ func (fb *functionBuilder) addPosAndPath(pos *ast.Position) {
 	}
 	debugInfo.Path = fb.path
 	fb.fn.DebugInfo[pc] = debugInfo
+	fb.addPosition(debugInfo.Position)
+}
+
+// addPosition adds an entry to the position table of the function for the
+// next instruction, with the current path. If there is already an entry for
+// the next instruction, it is replaced.
+func (fb *functionBuilder) addPosition(pos runtime.Position) {
+	fn := fb.fn
+	entry := runtime.PositionEntry{Addr: runtime.Addr(len(fn.Body)), Path: fb.path, Position: pos}
+	if n := len(fn.Positions); n > 0 {
+		last := fn.Positions[n-1]
+		if last.Path == entry.Path && last.Position == entry.Position {
+			return
+		}
+		if last.Addr == entry.Addr {
+			fn.Positions[n-1] = entry
+			return
+		}
+	}
+	fn.Positions = append(fn.Positions, entry)
+}
+
+// addStmtPosAndPath adds the position and the path of the statement whose
+// first instruction is the next instruction. If another statement starts at
+// the same instruction, as a statement that begins with a nested statement,
+// the position of the last statement is kept.
+func (fb *functionBuilder) addStmtPosAndPath(pos *ast.Position) {
+	pc := runtime.Addr(len(fb.fn.Body))
+	if fb.fn.StmtDebugInfo == nil {
+		fb.fn.StmtDebugInfo = map[runtime.Addr]runtime.DebugInfo{}
+	}
+	fb.fn.StmtDebugInfo[pc] = runtime.DebugInfo{
+		Position: *convertPosition(pos),
+		Path:     fb.path,
+	}
 }
 
 // addOperandKinds adds the kind of the three operands of the next instruction.
@@ -394,7 +588,7 @@ func (fb *functionBuilder) addType(typ reflect.Type, preserveType bool) int {
 	}
 	index := len(fn.Types)
 	if index == maxTypesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "types count exceeded %d", maxTypesCount))
+		panic(fb.limitExceededError("types count exceeded %d", maxTypesCount))
 	}
 	fn.Types = append(fn.Types, typ)
 	return index
@@ -405,7 +599,7 @@ func (fb *functionBuilder) addNativeFunction(f *runtime.NativeFunction) int8 {
 	fn := fb.fn
 	r := len(fn.NativeFunctions)
 	if r == maxNativeFunctionsCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "native functions count exceeded %d", maxNativeFunctionsCount))
+		panic(fb.limitExceededError("native functions count exceeded %d", maxNativeFunctionsCount))
 	}
 	fn.NativeFunctions = append(fn.NativeFunctions, f)
 	return int8(r)
@@ -416,7 +610,7 @@ func (fb *functionBuilder) addFunction(f *runtime.Function) int8 {
 	fn := fb.fn
 	r := len(fn.Functions)
 	if r == maxScriggoFunctionsCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "Scriggo functions count exceeded %d", maxScriggoFunctionsCount))
+		panic(fb.limitExceededError("Scriggo functions count exceeded %d", maxScriggoFunctionsCount))
 	}
 	fn.Functions = append(fn.Functions, f)
 	return int8(r)
@@ -431,7 +625,7 @@ func (fb *functionBuilder) makeStringValue(v string) int8 {
 	}
 	r := len(fb.fn.Values.String)
 	if r == maxStringValuesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "string values count exceeded %d", maxStringValuesCount))
+		panic(fb.limitExceededError("string values count exceeded %d", maxStringValuesCount))
 	}
 	fb.fn.Values.String = append(fb.fn.Values.String, v)
 	return int8(r)
@@ -471,7 +665,7 @@ func (fb *functionBuilder) makeGeneralValue(v reflect.Value) int8 {
 	}
 	r := len(fb.fn.Values.General)
 	if r == maxGeneralValuesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "general values count exceeded %d", maxGeneralValuesCount))
+		panic(fb.limitExceededError("general values count exceeded %d", maxGeneralValuesCount))
 	}
 	fb.fn.Values.General = append(fb.fn.Values.General, v)
 	return int8(r)
@@ -486,7 +680,7 @@ func (fb *functionBuilder) makeFloatValue(v float64) int {
 	}
 	r := len(fb.fn.Values.Float)
 	if r == maxFloatValuesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "floating-point values count exceeded %d", maxFloatValuesCount))
+		panic(fb.limitExceededError("floating-point values count exceeded %d", maxFloatValuesCount))
 	}
 	fb.fn.Values.Float = append(fb.fn.Values.Float, v)
 	return r
@@ -501,7 +695,7 @@ func (fb *functionBuilder) makeIntValue(v int64) int {
 	}
 	r := len(fb.fn.Values.Int)
 	if r == maxIntValuesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "integer values count exceeded %d", maxIntValuesCount))
+		panic(fb.limitExceededError("integer values count exceeded %d", maxIntValuesCount))
 	}
 	fb.fn.Values.Int = append(fb.fn.Values.Int, v)
 	return r
@@ -529,12 +723,40 @@ func (fb *functionBuilder) makeFieldIndex(index []int) int8 {
 	}
 	r := len(fb.fn.FieldIndexes)
 	if r == maxFieldIndexesCount {
-		panic(newLimitExceededError(fb.fn.Pos, fb.path, "field indexes count exceeded %d", maxFieldIndexesCount))
+		panic(fb.limitExceededError("field indexes count exceeded %d", maxFieldIndexesCount))
 	}
 	fb.fn.FieldIndexes = append(fb.fn.FieldIndexes, index)
 	return int8(r)
 }
 
+// limitExceededError returns a LimitExceededError reporting that the function
+// being built has exceeded a limit of the implementation. The error refers to
+// the statement being emitted, if known, otherwise to the function, and
+// suggests how to stay within the limit.
+func (fb *functionBuilder) limitExceededError(format string, a ...interface{}) *LimitExceededError {
+	pos := fb.fn.Pos
+	if fb.stmtPos != nil {
+		pos = convertPosition(fb.stmtPos)
+	}
+	fn := fb.fn
+	var msg string
+	switch {
+	case fn.Name == "" && fn.Macro:
+		msg = "in macro; split it into smaller macros"
+	case fn.Name == "":
+		msg = "in function literal; split it into smaller functions"
+	case fn.Name == "$initvars":
+		msg = "in package variable initialization; initialize the variables with functions"
+	case fn.Macro && fn.Name == "main" && fn.Parent == nil:
+		msg = "in file; move part of its content into macros"
+	case fn.Macro:
+		msg = "in macro " + fn.Name + "; split it into smaller macros"
+	default:
+		msg = "in function " + fn.Name + "; split it into smaller functions"
+	}
+	return newLimitExceededError(pos, fb.path, format+" "+msg, a...)
+}
+
 // currentAddr returns builder's current address.
 func (fb *functionBuilder) currentAddr() runtime.Addr {
 	return runtime.Addr(len(fb.fn.Body))
@@ -552,23 +774,50 @@ func (fb *functionBuilder) setLabelAddr(lab label) {
 	fb.labelAddrs[lab-1] = fb.currentAddr()
 }
 
-// flushText flushes the buffered text of the emitted Text instructions.
+// flushText flushes the buffered text of the emitted Text instructions. If
+// the buffered texts are contiguous in memory, as the adjacent texts of a
+// source file, the flushed text refers to their memory without copying it.
 func (fb *functionBuilder) flushText() {
 	if len(fb.text.txt) == 0 {
 		return
 	}
-	var size int
-	for _, b := range fb.text.txt {
-		size += len(b)
-	}
-	text := make([]byte, 0, size)
-	for _, b := range fb.text.txt {
-		text = append(text, b...)
+	text, ok := contiguousText(fb.text.txt)
+	if !ok {
+		var size int
+		for _, b := range fb.text.txt {
+			size += len(b)
+		}
+		text = make([]byte, 0, size)
+		for _, b := range fb.text.txt {
+			text = append(text, b...)
+		}
 	}
 	fb.text.txt = fb.text.txt[0:0]
 	fb.fn.Text = append(fb.fn.Text, text)
 }
 
+// contiguousText returns the concatenation of texts and true if every text
+// immediately follows the previous one in memory. The returned slice refers
+// to the memory of texts. Otherwise it returns nil and false.
+func contiguousText(texts [][]byte) ([]byte, bool) {
+	var text []byte
+	for _, b := range texts {
+		if len(b) == 0 {
+			continue
+		}
+		if text == nil {
+			text = b
+			continue
+		}
+		n := len(text)
+		if cap(text)-n < len(b) || &text[:n+1][n] != &b[0] {
+			return nil, false
+		}
+		text = text[:n+len(b)]
+	}
+	return text[:len(text):len(text)], true
+}
+
 func (fb *functionBuilder) end() {
 	fn := fb.fn
 	fb.flushText()
@@ -586,6 +835,8 @@ func (fb *functionBuilder) end() {
 		fn.Body[addr] = i
 	}
 	fb.gotos = nil
+	cleanUpBody(fn)
+	fuseInstructions(fn)
 	for typ, num := range fb.maxRegs {
 		if num > fn.NumReg[typ] {
 			fn.NumReg[typ] = num
@@ -602,132 +853,25 @@ func (fb *functionBuilder) allocRegister(typ registerType, reg int8) {
 	}
 }
 
-// complexOperationIndex returns the index of the function which performs the
-// binary or unary operation specified by op.
-func (fb *functionBuilder) complexOperationIndex(op ast.OperatorType, unary bool) int8 {
-	if unary {
-		if fb.complexUnaryOpIndex != -1 {
-			return fb.complexUnaryOpIndex
-		}
-		fn := newNativeFunction("scriggo.complex", "neg", negComplex)
-		index := fb.addNativeFunction(fn)
-		fb.complexUnaryOpIndex = index
-		return index
-	}
-	if index, ok := fb.complexBinaryOpIndexes[op]; ok {
-		return index
-	}
-	var f interface{}
-	var n string
-	switch op {
-	case ast.OperatorAddition:
-		f = addComplex
-		n = "add"
-	case ast.OperatorSubtraction:
-		f = subComplex
-		n = "sub"
-	case ast.OperatorMultiplication:
-		f = mulComplex
-		n = "mul"
-	case ast.OperatorDivision:
-		f = divComplex
-		n = "div"
-	}
-	_ = n
-	fn := newNativeFunction("scriggo.complex", n, f)
-	index := fb.addNativeFunction(fn)
-	fb.complexBinaryOpIndexes[op] = index
-	return index
-}
-
-func negComplex(c interface{}) interface{} {
-	switch c := c.(type) {
-	case complex64:
-		return -c
-	case complex128:
-		return -c
-	}
-	v := reflect.ValueOf(c)
-	v2 := reflect.New(v.Type()).Elem()
-	v2.SetComplex(-v.Complex())
-	return v2.Interface()
-}
-
-func addComplex(c1, c2 interface{}) interface{} {
-	switch c1 := c1.(type) {
-	case complex64:
-		return c1 + c2.(complex64)
-	case complex128:
-		return c1 + c2.(complex128)
-	}
-	v1 := reflect.ValueOf(c1)
-	v2 := reflect.ValueOf(c2)
-	v3 := reflect.New(v1.Type()).Elem()
-	v3.SetComplex(v1.Complex() + v2.Complex())
-	return v3.Interface()
-}
-
-func subComplex(c1, c2 interface{}) interface{} {
-	switch c1 := c1.(type) {
-	case complex64:
-		return c1 - c2.(complex64)
-	case complex128:
-		return c1 - c2.(complex128)
-	}
-	v1 := reflect.ValueOf(c1)
-	v2 := reflect.ValueOf(c2)
-	v3 := reflect.New(v1.Type()).Elem()
-	v3.SetComplex(v1.Complex() - v2.Complex())
-	return v3.Interface()
-}
-
-func mulComplex(c1, c2 interface{}) interface{} {
-	switch c1 := c1.(type) {
-	case complex64:
-		return c1 * c2.(complex64)
-	case complex128:
-		return c1 * c2.(complex128)
-	}
-	v1 := reflect.ValueOf(c1)
-	v2 := reflect.ValueOf(c2)
-	v3 := reflect.New(v1.Type()).Elem()
-	v3.SetComplex(v1.Complex() * v2.Complex())
-	return v3.Interface()
-}
-
-func divComplex(c1, c2 interface{}) interface{} {
-	switch c1 := c1.(type) {
-	case complex64:
-		return c1 / c2.(complex64)
-	case complex128:
-		return c1 / c2.(complex128)
-	}
-	v1 := reflect.ValueOf(c1)
-	v2 := reflect.ValueOf(c2)
-	v3 := reflect.New(v1.Type()).Elem()
-	v3.SetComplex(v1.Complex() / v2.Complex())
-	return v3.Interface()
-}
-
 // TODO: find a better name and description for this function.
-func flattenIntegerKind(k reflect.Kind) reflect.Kind {
+func (fb *functionBuilder) flattenIntegerKind(k reflect.Kind) reflect.Kind {
 	switch k {
 	case reflect.Bool:
 		return reflect.Int64
 	case reflect.Int:
-		if strconv.IntSize == 32 {
+		if fb.intSize == 32 || fb.intSize == 0 && strconv.IntSize == 32 {
 			return reflect.Int32
 		} else {
 			return reflect.Int64
 		}
 	case reflect.Uint:
-		if strconv.IntSize == 32 {
+		if fb.intSize == 32 || fb.intSize == 0 && strconv.IntSize == 32 {
 			return reflect.Uint32
 		} else {
 			return reflect.Uint64
 		}
 	case reflect.Uintptr:
-		if ^uintptr(0) == math.MaxUint32 {
+		if fb.intSize == 32 || fb.intSize == 0 && ^uintptr(0) == math.MaxUint32 {
 			return reflect.Uint32
 		} else {
 			return reflect.Uint64
@@ -736,3 +880,10 @@ func flattenIntegerKind(k reflect.Kind) reflect.Kind {
 		return k
 	}
 }
+
+// truncatesInt reports whether the int, uint and uintptr values must be
+// truncated to 32 bits because the target has 32-bit integers and the host
+// has 64-bit integers.
+func (fb *functionBuilder) truncatesInt() bool {
+	return fb.intSize == 32 && strconv.IntSize == 64
+}
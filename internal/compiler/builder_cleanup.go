@@ -0,0 +1,338 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// cleanUpBody cleans up the body of fn, after its jump addresses have been
+// resolved. It threads the jumps to Goto instructions and removes
+//
+//   - the unreachable instructions,
+//   - the Goto instructions that jump to the next instruction,
+//   - the Move and Load instructions that store into a register overwritten
+//     by the next instruction,
+//
+// and then compacts the body, fixing the jump addresses and the debug
+// information.
+//
+// The instruction following an instruction that can skip it, as If and Case,
+// or that refers to it, as Range, is never removed.
+func cleanUpBody(fn *runtime.Function) {
+
+	body := fn.Body
+	n := runtime.Addr(len(body))
+	if n == 0 {
+		return
+	}
+
+	// isInstr reports whether an address is the address of an instruction
+	// and not of a word of an instruction with more than one word.
+	isInstr := make([]bool, n)
+	// pinned reports whether the instruction at an address cannot be
+	// removed.
+	pinned := make([]bool, n)
+	for addr := runtime.Addr(0); addr < n; addr += instructionSize(body[addr]) {
+		isInstr[addr] = true
+		if next := addr + instructionSize(body[addr]); next < n && canSkipNext(body[addr].Op) {
+			pinned[next] = true
+		}
+	}
+
+	// Thread the jumps to Goto instructions.
+	for addr := runtime.Addr(0); addr < n; addr++ {
+		if !isInstr[addr] || body[addr].Op != runtime.OpGoto {
+			continue
+		}
+		target := jumpAddr(body[addr])
+		for i := 0; i < int(n) && body[target].Op == runtime.OpGoto; i++ {
+			next := jumpAddr(body[target])
+			if next == target {
+				break
+			}
+			target = next
+		}
+		body[addr].A, body[addr].B, body[addr].C = encodeUint24(uint32(target))
+	}
+
+	// Mark the reachable instructions.
+	reachable := make([]bool, n)
+	stack := []runtime.Addr{0}
+	for len(stack) > 0 {
+		addr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if addr >= n || reachable[addr] {
+			continue
+		}
+		reachable[addr] = true
+		in := body[addr]
+		next := addr + instructionSize(in)
+		switch in.Op {
+		case runtime.OpGoto:
+			stack = append(stack, jumpAddr(in))
+		case runtime.OpReturn, runtime.OpPanic, runtime.OpBreak, runtime.OpContinue:
+		default:
+			stack = append(stack, next)
+			if canSkipNext(in.Op) && next < n {
+				stack = append(stack, next+instructionSize(body[next]))
+			}
+		}
+	}
+
+	// removed reports whether the instruction at an address is removed.
+	// redundant reports whether a removed instruction is reachable, so its
+	// statement debug information can be moved to the next instruction.
+	removed := make([]bool, n)
+	redundant := make([]bool, n)
+	for addr := runtime.Addr(0); addr < n; addr++ {
+		removed[addr] = !reachable[addr] && isInstr[addr]
+		if removed[addr] {
+			for i := runtime.Addr(1); i < instructionSize(body[addr]); i++ {
+				removed[addr+i] = true
+			}
+		}
+	}
+
+	// Remove the stores into registers overwritten by the next instruction.
+	for addr := runtime.Addr(0); addr+1 < n; addr++ {
+		if !reachable[addr] || pinned[addr] || !overwrites(body[addr+1], body[addr]) {
+			continue
+		}
+		if _, ok := fn.StmtDebugInfo[addr]; ok {
+			if _, ok := fn.StmtDebugInfo[addr+1]; ok {
+				continue
+			}
+		}
+		removed[addr] = true
+		redundant[addr] = true
+	}
+
+	// Remove the Goto instructions that jump to the next instruction,
+	// starting from the last one, so the removal of a Goto instruction can
+	// make the previous one removable.
+	for addr := n - 1; ; addr-- {
+		if reachable[addr] && !pinned[addr] && !removed[addr] && body[addr].Op == runtime.OpGoto {
+			target := jumpAddr(body[addr])
+			if target > addr {
+				i := addr + 1
+				for i < target && removed[i] {
+					i++
+				}
+				if i == target {
+					removed[addr] = true
+					redundant[addr] = true
+				}
+			}
+		}
+		if addr == 0 {
+			break
+		}
+	}
+
+	// Compute the new addresses. The new address of a removed instruction
+	// is the new address of the next instruction that is not removed.
+	newAddr := make([]runtime.Addr, n+1)
+	var size runtime.Addr
+	for addr := runtime.Addr(0); addr < n; addr++ {
+		newAddr[addr] = size
+		if !removed[addr] {
+			size++
+		}
+	}
+	if size == n {
+		return
+	}
+	newAddr[n] = size
+
+	// Compact the body.
+	compacted := make([]runtime.Instruction, 0, size)
+	for addr := runtime.Addr(0); addr < n; addr++ {
+		if removed[addr] {
+			continue
+		}
+		in := body[addr]
+		if isInstr[addr] {
+			switch in.Op {
+			case runtime.OpGoto, runtime.OpBreak, runtime.OpContinue:
+				in.A, in.B, in.C = encodeUint24(uint32(newAddr[jumpAddr(in)]))
+			}
+		}
+		compacted = append(compacted, in)
+	}
+	fn.Body = compacted
+
+	// Fix the debug information.
+	if fn.DebugInfo != nil {
+		debugInfo := make(map[runtime.Addr]runtime.DebugInfo, len(fn.DebugInfo))
+		for addr, info := range fn.DebugInfo {
+			if addr < n && !removed[addr] {
+				debugInfo[newAddr[addr]] = info
+			}
+		}
+		fn.DebugInfo = debugInfo
+	}
+	if fn.StmtDebugInfo != nil {
+		stmtDebugInfo := make(map[runtime.Addr]runtime.DebugInfo, len(fn.StmtDebugInfo))
+		for addr, info := range fn.StmtDebugInfo {
+			if addr < n && !removed[addr] {
+				stmtDebugInfo[newAddr[addr]] = info
+			}
+		}
+		for addr, info := range fn.StmtDebugInfo {
+			if addr < n && redundant[addr] && newAddr[addr] < size {
+				if _, ok := stmtDebugInfo[newAddr[addr]]; !ok {
+					stmtDebugInfo[newAddr[addr]] = info
+				}
+			}
+		}
+		fn.StmtDebugInfo = stmtDebugInfo
+	}
+	if fn.Positions != nil {
+		// The entry of a removed instruction applies to the next instruction,
+		// unless it has its own entry.
+		positions := fn.Positions[:0]
+		for _, entry := range fn.Positions {
+			if entry.Addr > n {
+				break
+			}
+			entry.Addr = newAddr[entry.Addr]
+			if i := len(positions) - 1; i >= 0 && positions[i].Addr == entry.Addr {
+				positions[i] = entry
+				continue
+			}
+			positions = append(positions, entry)
+		}
+		fn.Positions = positions
+	}
+
+}
+
+// fusedOperations contains, for each fused operation, the operations of the
+// two instructions that it fuses.
+var fusedOperations = map[runtime.Operation][2]runtime.Operation{
+	runtime.OpGetVarCallIndirect: {runtime.OpGetVar, runtime.OpCallIndirect},
+	runtime.OpIndexStringIfInt:   {runtime.OpIndexString, runtime.OpIfInt},
+	runtime.OpMoveAddInt:         {runtime.OpMove, runtime.OpAddInt},
+}
+
+// fuseInstructions fuses the pairs of consecutive instructions of the body of
+// fn that are frequently executed together, as IndexString followed by IfInt,
+// so that the virtual machine executes them with a single dispatch.
+//
+// The operation of the first instruction is replaced with the fused
+// operation, and the second instruction is left unchanged, so it can still be
+// the target of a jump. A pair is not fused if the debugger can stop at the
+// second instruction.
+func fuseInstructions(fn *runtime.Function) {
+	body := fn.Body
+	n := runtime.Addr(len(body))
+	for addr := runtime.Addr(0); addr+1 < n; addr += instructionSize(body[addr]) {
+		op, ok := fusedOperation(body[addr], body[addr+1])
+		if !ok {
+			continue
+		}
+		if _, ok := fn.StmtDebugInfo[addr+1]; ok {
+			continue
+		}
+		body[addr].Op = op
+	}
+}
+
+// fusedOperation returns the fused operation of the instruction in followed
+// by the instruction next. The boolean return value reports whether the
+// instructions can be fused.
+func fusedOperation(in, next runtime.Instruction) (runtime.Operation, bool) {
+	op, nextOp := in.Op, next.Op
+	if op < 0 {
+		op = -op
+	}
+	if nextOp < 0 {
+		nextOp = -nextOp
+	}
+	var fused runtime.Operation
+	switch {
+	case op == runtime.OpGetVar && nextOp == runtime.OpCallIndirect:
+		fused = runtime.OpGetVarCallIndirect
+	case op == runtime.OpIndexString && nextOp == runtime.OpIfInt:
+		fused = runtime.OpIndexStringIfInt
+	case op == runtime.OpMove && registerType(in.A) == intRegister && nextOp == runtime.OpAddInt:
+		fused = runtime.OpMoveAddInt
+	default:
+		return 0, false
+	}
+	if in.Op < 0 {
+		fused = -fused
+	}
+	return fused, true
+}
+
+// instructionSize returns the number of words of the instruction in.
+func instructionSize(in runtime.Instruction) runtime.Addr {
+	switch in.Op {
+	case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative,
+		runtime.OpTailCall, runtime.OpSlice, runtime.OpStringSlice, runtime.OpWide:
+		return 2
+	case runtime.OpDefer:
+		return 3
+	case runtime.OpMakeSlice:
+		if in.B > 0 {
+			return 2
+		}
+	}
+	return 1
+}
+
+// canSkipNext reports whether an instruction with operation op can skip the
+// next instruction, or refers to it, so that the next instruction cannot be
+// removed.
+func canSkipNext(op runtime.Operation) bool {
+	if op < 0 {
+		op = -op
+	}
+	switch op {
+	case runtime.OpIf, runtime.OpIfInt, runtime.OpIfFloat, runtime.OpIfString,
+		runtime.OpAssert, runtime.OpCase, runtime.OpGo, runtime.OpRange, runtime.OpRangeString:
+		return true
+	}
+	return false
+}
+
+// jumpAddr returns the address of a Goto, Break or Continue instruction.
+func jumpAddr(in runtime.Instruction) runtime.Addr {
+	return runtime.Addr(decodeUint24(in.A, in.B, in.C))
+}
+
+// overwrites reports whether the instruction in overwrites the register
+// stored by the instruction store, a Move or Load instruction, without
+// reading it.
+func overwrites(in, store runtime.Instruction) bool {
+	typ, reg, ok := storedRegister(store)
+	if !ok {
+		return false
+	}
+	t, r, ok := storedRegister(in)
+	if !ok || t != typ || r != reg {
+		return false
+	}
+	// A Move instruction, with a non-constant operand, reads the register B.
+	return in.Op != runtime.OpMove || registerType(in.A) != typ || in.B != reg
+}
+
+// storedRegister returns the type and the register stored by a Move or Load
+// instruction, if the register is not indirect.
+func storedRegister(in runtime.Instruction) (registerType, int8, bool) {
+	if in.C <= 0 {
+		return 0, 0, false
+	}
+	switch in.Op {
+	case runtime.OpMove, -runtime.OpMove:
+		return registerType(in.A), in.C, true
+	case runtime.OpLoad:
+		t, _ := decodeValueIndex(in.A, in.B)
+		return t, in.C, true
+	}
+	return 0, 0, false
+}
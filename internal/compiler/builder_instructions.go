@@ -23,6 +23,9 @@ func (fb *functionBuilder) emitNop() {
 //     z = x + y
 //
 func (fb *functionBuilder) emitAdd(k bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -33,12 +36,13 @@ func (fb *functionBuilder) emitAdd(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpAdd
 	}
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -61,6 +65,7 @@ func (fb *functionBuilder) emitAnd(k bool, x, y, z int8, kind reflect.Kind) {
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -78,8 +83,9 @@ func (fb *functionBuilder) emitAndNot(k bool, x, y, z int8, kind reflect.Kind) {
 
 // emitAppend appends a new "Append" instruction to the function body.
 //
-func (fb *functionBuilder) emitAppend(start, end, s int8, elementsKind reflect.Kind) {
+func (fb *functionBuilder) emitAppend(start, end, s int8, elementsKind reflect.Kind, pos *ast.Position) {
 	fb.addOperandKinds(elementsKind, elementsKind, 0)
+	fb.addPosAndPath(pos)
 	fn := fb.fn
 	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpAppend, A: start, B: end, C: s})
 }
@@ -209,12 +215,36 @@ func (fb *functionBuilder) emitComplex(x, y, z int8, kind reflect.Kind) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
+// emitComplexOp appends a new "AddComplex", "SubComplex", "MulComplex" or
+// "DivComplex" instruction to the function body, depending on op.
+//
+//	z = x op y
+//
+func (fb *functionBuilder) emitComplexOp(op ast.OperatorType, x, y, z int8) {
+	var o runtime.Operation
+	switch op {
+	case ast.OperatorAddition:
+		o = runtime.OpAddComplex
+	case ast.OperatorSubtraction:
+		o = runtime.OpSubComplex
+	case ast.OperatorMultiplication:
+		o = runtime.OpMulComplex
+	case ast.OperatorDivision:
+		o = runtime.OpDivComplex
+	default:
+		panic(internalError("unexpected operator %s", op))
+	}
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: o, A: x, B: y, C: z})
+}
+
 // emitConcat appends a new "concat" instruction to the function body.
 //
 //     z = concat(s, t)
 //
-func (fb *functionBuilder) emitConcat(s, t, z int8) {
+func (fb *functionBuilder) emitConcat(s, t, z int8, pos *ast.Position) {
+	fb.addPosAndPath(pos)
 	fn := fb.fn
+	fb.retargetAddr = fb.currentAddr()
 	fn.Body = append(fn.Body, runtime.Instruction{Op: runtime.OpConcat, A: s, B: t, C: z})
 }
 
@@ -234,6 +264,17 @@ func (fb *functionBuilder) emitContinue(lab label) {
 //
 func (fb *functionBuilder) emitConvert(src int8, typ reflect.Type, dst int8, srcKind reflect.Kind) {
 	fn := fb.fn
+	if fb.truncatesInt() && kindToType(srcKind) != generalRegister {
+		// Truncate the value to 32 bits before converting it to typ.
+		switch typ.Kind() {
+		case reflect.Int:
+			fb.emitConvert(src, int32Type, dst, srcKind)
+			src, srcKind = dst, reflect.Int32
+		case reflect.Uint, reflect.Uintptr:
+			fb.emitConvert(src, uint32Type, dst, srcKind)
+			src, srcKind = dst, reflect.Uint32
+		}
+	}
 	regType := fb.addType(typ, false)
 	var op runtime.Operation
 	switch kindToType(srcKind) {
@@ -293,6 +334,9 @@ func (fb *functionBuilder) emitDelete(m, k int8) {
 //     z = x / y
 //
 func (fb *functionBuilder) emitDiv(ky bool, x, y, z int8, kind reflect.Kind, pos *ast.Position) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -303,7 +347,7 @@ func (fb *functionBuilder) emitDiv(ky bool, x, y, z int8, kind reflect.Kind, pos
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpDiv
 	}
 	fb.addPosAndPath(pos)
@@ -322,6 +366,16 @@ func (fb *functionBuilder) emitField(a, field, c int8, dstKind reflect.Kind) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpField, A: a, B: field, C: c})
 }
 
+// emitFieldByName appends a new "FieldByName" instruction to the function
+// body.
+//
+//     c = a?.name
+//
+func (fb *functionBuilder) emitFieldByName(a int8, name string, c int8) {
+	b := fb.makeStringValue(name)
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpFieldByName, A: a, B: b, C: c})
+}
+
 // emitGetVar appends a new "GetVar" instruction to the function body.
 //
 //     r = v
@@ -329,6 +383,7 @@ func (fb *functionBuilder) emitField(a, field, c int8, dstKind reflect.Kind) {
 func (fb *functionBuilder) emitGetVar(v int, r int8, varKind reflect.Kind) {
 	a, b := encodeInt16(int16(v))
 	fb.addOperandKinds(0, 0, varKind)
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpGetVar, A: a, B: b, C: r})
 }
 
@@ -436,7 +491,14 @@ func (fb *functionBuilder) emitIndex(ki bool, expr, i, dst int8, t reflect.Type,
 		}
 		fb.addOperandKinds(0, 0, t.Elem().Kind())
 	case reflect.Map:
-		op = runtime.OpMapIndex
+		switch t.Key().Kind() {
+		case reflect.Int, reflect.Int64:
+			op = runtime.OpMapIndexInt
+		case reflect.String:
+			op = runtime.OpMapIndexString
+		default:
+			op = runtime.OpMapIndex
+		}
 		fb.addOperandKinds(0, t.Key().Kind(), t.Elem().Kind())
 	case reflect.String:
 		op = runtime.OpIndexString
@@ -449,6 +511,20 @@ func (fb *functionBuilder) emitIndex(ki bool, expr, i, dst int8, t reflect.Type,
 	fn.Body = append(fn.Body, runtime.Instruction{Op: op, A: expr, B: i, C: dst})
 }
 
+// emitLeadingZeros appends a new "LeadingZeros" instruction to the function
+// body.
+//
+//     z = bits.LeadingZeros(x)
+//
+func (fb *functionBuilder) emitLeadingZeros(k bool, x, z int8, kind reflect.Kind) {
+	op := runtime.OpLeadingZeros
+	if k {
+		op = -op
+	}
+	a := int8(fb.flattenIntegerKind(kind))
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: a, B: x, C: z})
+}
+
 // emitLen appends a new "len" instruction to the function body.
 //
 //     l = len(s)
@@ -481,6 +557,19 @@ func (fb *functionBuilder) emitLoad(index int, dst int8, kind reflect.Kind) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpLoad, A: a, B: b, C: dst})
 }
 
+// emitLoadUint appends a new "LoadBigEndian" or "LoadLittleEndian"
+// instruction to the function body.
+//
+//     z = binary.BigEndian.Uint32(s)
+//
+func (fb *functionBuilder) emitLoadUint(littleEndian bool, s, z int8, kind reflect.Kind) {
+	op := runtime.OpLoadBigEndian
+	if littleEndian {
+		op = runtime.OpLoadLittleEndian
+	}
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: int8(kind), B: s, C: z})
+}
+
 // emitMakeArray appends a new "MakeArray" instruction to the function body.
 func (fb *functionBuilder) emitMakeArray(typ reflect.Type, dst int8) {
 	if typ.Kind() != reflect.Array {
@@ -513,7 +602,8 @@ func (fb *functionBuilder) emitMakeChan(typ reflect.Type, kCapacity bool, capaci
 //
 //     dst = make(typ, size)
 //
-func (fb *functionBuilder) emitMakeMap(typ reflect.Type, kSize bool, size int8, dst int8) {
+func (fb *functionBuilder) emitMakeMap(typ reflect.Type, kSize bool, size int8, dst int8, pos *ast.Position) {
+	fb.addPosAndPath(pos)
 	fn := fb.fn
 	t := fb.addType(typ, false)
 	op := runtime.OpMakeMap
@@ -584,11 +674,29 @@ func (fb *functionBuilder) emitMove(k bool, x, z int8, kind reflect.Kind) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: a, B: x, C: z})
 }
 
+// emitWideMove appends a new "Wide" instruction, followed by a "Move"
+// instruction, to the function body.
+//
+//     z = x
+//
+// x and z can be wide registers.
+func (fb *functionBuilder) emitWideMove(x, z int16, kind reflect.Kind) {
+	xh, xl := encodeInt16(x)
+	zh, zl := encodeInt16(z)
+	a := int8(kindToType(kind))
+	fb.fn.Body = append(fb.fn.Body,
+		runtime.Instruction{Op: runtime.OpWide, B: xh, C: zh},
+		runtime.Instruction{Op: runtime.OpMove, A: a, B: xl, C: zl})
+}
+
 // emitMul appends a new "mul" instruction to the function body.
 //
 //     z = x * y
 //
 func (fb *functionBuilder) emitMul(ky bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -599,12 +707,13 @@ func (fb *functionBuilder) emitMul(ky bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpMul
 	}
 	if ky {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -613,10 +722,18 @@ func (fb *functionBuilder) emitMul(ky bool, x, y, z int8, kind reflect.Kind) {
 //     z = -y
 //
 func (fb *functionBuilder) emitNeg(y, z int8, kind reflect.Kind) {
-	x := int8(flattenIntegerKind(kind))
+	x := int8(fb.flattenIntegerKind(kind))
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpNeg, A: x, B: y, C: z})
 }
 
+// emitNegComplex appends a new "NegComplex" instruction to the function body.
+//
+//	z = -x
+//
+func (fb *functionBuilder) emitNegComplex(x, z int8) {
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpNegComplex, A: x, C: z})
+}
+
 // emitNew appends a new "new" instruction to the function body.
 //
 //     z = new(t)
@@ -637,6 +754,19 @@ func (fb *functionBuilder) emitNotZero(kind reflect.Kind, dst, src int8) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpZero, A: regType, B: src, C: dst})
 }
 
+// emitOnesCount appends a new "OnesCount" instruction to the function body.
+//
+//     z = bits.OnesCount(x)
+//
+func (fb *functionBuilder) emitOnesCount(k bool, x, z int8, kind reflect.Kind) {
+	op := runtime.OpOnesCount
+	if k {
+		op = -op
+	}
+	a := int8(fb.flattenIntegerKind(kind))
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: a, B: x, C: z})
+}
+
 // emitOr appends a new "Or" instruction to the function body.
 //
 //     z = x | y
@@ -646,6 +776,7 @@ func (fb *functionBuilder) emitOr(k bool, x, y, z int8, kind reflect.Kind) {
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -666,6 +797,15 @@ func (fb *functionBuilder) emitPanic(v int8, typ reflect.Type, pos *ast.Position
 	fn.Body = append(fn.Body, in)
 }
 
+// emitParallel appends a new "Parallel" instruction to the function body.
+//
+//     for parallel e in s { f(e) }
+//
+func (fb *functionBuilder) emitParallel(f, s int8, pos *ast.Position) {
+	fb.addPosAndPath(pos)
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpParallel, A: f, B: s})
+}
+
 // emitPrint appends a new "Print" instruction to the function body.
 //
 //     print(arg)
@@ -737,6 +877,9 @@ func (fb *functionBuilder) emitRecover(r int8, down bool) {
 //     z = x % y
 //
 func (fb *functionBuilder) emitRem(ky bool, x, y, z int8, kind reflect.Kind, pos *ast.Position) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	fb.addPosAndPath(pos)
 	var op runtime.Operation
 	switch kind {
@@ -746,7 +889,7 @@ func (fb *functionBuilder) emitRem(ky bool, x, y, z int8, kind reflect.Kind, pos
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpRem
 	}
 	if ky {
@@ -755,6 +898,19 @@ func (fb *functionBuilder) emitRem(ky bool, x, y, z int8, kind reflect.Kind, pos
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
+// emitRepeat appends a new "Repeat" instruction to the function body.
+//
+//     z = strings.Repeat(s, n)
+//
+func (fb *functionBuilder) emitRepeat(kn bool, s, n, z int8, pos *ast.Position) {
+	fb.addPosAndPath(pos)
+	op := runtime.OpRepeat
+	if kn {
+		op = -op
+	}
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: s, B: n, C: z})
+}
+
 // emitReturn appends a new "return" instruction to the function body.
 //
 //     return
@@ -763,6 +919,19 @@ func (fb *functionBuilder) emitReturn() {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpReturn})
 }
 
+// emitRotateLeft appends a new "RotateLeft" instruction to the function body.
+//
+//     x = bits.RotateLeft(x, y)
+//
+func (fb *functionBuilder) emitRotateLeft(k bool, x, y int8, kind reflect.Kind) {
+	op := runtime.OpRotateLeft
+	if k {
+		op = -op
+	}
+	a := int8(fb.flattenIntegerKind(kind))
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: a, B: y, C: x})
+}
+
 // emitSelect appends a new "Select" instruction to the function body.
 //
 //     select
@@ -843,6 +1012,9 @@ func (fb *functionBuilder) emitSetVar(k bool, r int8, v int, dstKind reflect.Kin
 //     z = x << y
 //
 func (fb *functionBuilder) emitShl(k bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -851,7 +1023,7 @@ func (fb *functionBuilder) emitShl(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpShl
 	}
 	if k {
@@ -864,7 +1036,8 @@ func (fb *functionBuilder) emitShl(k bool, x, y, z int8, kind reflect.Kind) {
 //
 //     show(type, value, ctx)
 //
-func (fb *functionBuilder) emitShow(typ reflect.Type, v int8, ctx ast.Context, inURL, isURLSet bool) {
+func (fb *functionBuilder) emitShow(typ reflect.Type, v int8, ctx ast.Context, inURL, isURLSet bool, pos *ast.Position) {
+	fb.addPosAndPath(pos)
 	t := fb.addType(typ, true)
 	c := encodeRenderContext(ctx, inURL, isURLSet)
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpShow, A: int8(t), B: v, C: int8(c)})
@@ -875,6 +1048,9 @@ func (fb *functionBuilder) emitShow(typ reflect.Type, v int8, ctx ast.Context, i
 //     z = x >> y
 //
 func (fb *functionBuilder) emitShr(k bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -883,7 +1059,7 @@ func (fb *functionBuilder) emitShr(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpShr
 	}
 	if k {
@@ -913,6 +1089,22 @@ func (fb *functionBuilder) emitSlice(klow, khigh, kmax bool, src, dst, low, high
 	fn.Body = append(fn.Body, runtime.Instruction{A: low, B: high, C: max})
 }
 
+// emitStoreUint appends a new "StoreBigEndian" or "StoreLittleEndian"
+// instruction to the function body.
+//
+//     binary.BigEndian.PutUint32(s, x)
+//
+func (fb *functionBuilder) emitStoreUint(littleEndian bool, k bool, x, s int8, kind reflect.Kind) {
+	op := runtime.OpStoreBigEndian
+	if littleEndian {
+		op = runtime.OpStoreLittleEndian
+	}
+	if k {
+		op = -op
+	}
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: int8(kind), B: x, C: s})
+}
+
 // emitStringSlice appends a new "StringSlice" instruction to the function body.
 //
 //	string[low:high]
@@ -936,6 +1128,9 @@ func (fb *functionBuilder) emitStringSlice(klow, khigh bool, src, dst, low, high
 //     z = x - y
 //
 func (fb *functionBuilder) emitSub(k bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -946,12 +1141,13 @@ func (fb *functionBuilder) emitSub(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpSub
 	}
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -960,6 +1156,9 @@ func (fb *functionBuilder) emitSub(k bool, x, y, z int8, kind reflect.Kind) {
 //     z = y - x
 //
 func (fb *functionBuilder) emitSubInv(k bool, x, y, z int8, kind reflect.Kind) {
+	if kind == reflect.Int && fb.truncatesInt() {
+		kind = reflect.Int32
+	}
 	var op runtime.Operation
 	switch kind {
 	case reflect.Int:
@@ -970,12 +1169,13 @@ func (fb *functionBuilder) emitSubInv(k bool, x, y, z int8, kind reflect.Kind) {
 		if z != x {
 			panic(fmt.Errorf("z must be == x for kind %s", kind))
 		}
-		x = int8(flattenIntegerKind(kind))
+		x = int8(fb.flattenIntegerKind(kind))
 		op = runtime.OpSubInv
 	}
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -1015,6 +1215,17 @@ func (fb *functionBuilder) emitText(txt []byte, inURL, isURLSet bool) {
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpText, A: a, B: b, C: c})
 }
 
+// emitTrans appends a new "Trans" instruction to the function body.
+//
+//     trans(txt)
+//
+func (fb *functionBuilder) emitTrans(txt []byte) {
+	fb.flushText()
+	a, b := encodeUint16(uint16(len(fb.fn.Text)))
+	fb.fn.Text = append(fb.fn.Text, txt)
+	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: runtime.OpTrans, A: a, B: b})
+}
+
 // emitTailCall appends a new "TailCall" instruction to the function body.
 //
 //     f()
@@ -1044,6 +1255,7 @@ func (fb *functionBuilder) emitXor(k bool, x, y, z int8, kind reflect.Kind) {
 	if k {
 		op = -op
 	}
+	fb.retargetAddr = fb.currentAddr()
 	fb.fn.Body = append(fb.fn.Body, runtime.Instruction{Op: op, A: x, B: y, C: z})
 }
 
@@ -1,234 +1,14 @@
 package compiler
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/runtime"
 )
 
-func TestComplex128(t *testing.T) {
-	operations := []struct {
-		c1, c2, neg, add, sub, mul, div complex128
-	}{
-		{c1: 0, c2: 0, neg: 0, add: 0, sub: 0, mul: 0},
-		{c1: 1, c2: 1, neg: -1, add: 2, sub: 0, mul: 1, div: 1},
-		{c1: 1i, c2: 1i, neg: -1i, add: 2i, sub: 0, mul: -1, div: 1},
-		{
-			c1:  1 + 2i,
-			c2:  3 + 5i,
-			neg: -1 - 2i,
-			add: 4 + 7i,
-			sub: -2 - 3i,
-			mul: -7 + 11i,
-			div: 0.382352941176470617623550651842379011213779449462890625 + 0.02941176470588234559411233703940524719655513763427734375i,
-		},
-		{
-			c1:  23.95 - 93.04i,
-			c2:  7.50 + 2i,
-			neg: -23.95 + 93.04i,
-			add: 31.45 - 91.04i,
-			sub: 16.45 - 95.04i,
-			mul: 365.7050000000000409272615797817707061767578125 - 649.90000000000009094947017729282379150390625i,
-			div: -0.10713692946058138433240713993654935620725154876708984375 - 12.376763485477180637417404795996844768524169921875i,
-		},
-		{
-			c1:  73829571043429.02756423 + 928746285629.7836396i,
-			c2:  29470173655.93846244 + 79549687362.927342745i,
-			neg: -73829571043429.02756423 - 928746285629.7836396i,
-			add: 73859041217084.968750 + 1008295972992.711060i,
-			sub: 73800100869773.09375 + 849196598266.856323i,
-			mul: 2101888802931970056126464 + 5900489608963630053720064i,
-			div: 312.5973424729687621947959996759891510009765625 - 812.288209022923865632037632167339324951171875i,
-		},
-	}
-	for _, op := range operations {
-		c := negComplex(op.c1)
-		c3, ok := c.(complex128)
-		if !ok {
-			t.Fatalf("-(%f): unexpected result type %T, expected complex128", op.c1, c)
-		}
-		if c3 != op.neg {
-			t.Fatalf("-(%f): unexpected result %f, expected %f", op.c1, c3, op.neg)
-		}
-		c = addComplex(op.c1, op.c2)
-		c3, ok = c.(complex128)
-		if !ok {
-			t.Fatalf("%f + %f: unexpected result type %T, expected complex128", op.c1, op.c2, c)
-		}
-		if c3 != op.add {
-			t.Fatalf("%f + %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.add)
-		}
-		c = subComplex(op.c1, op.c2)
-		c3, ok = c.(complex128)
-		if !ok {
-			t.Fatalf("%f - %f: unexpected result type %T, expected complex128", op.c1, op.c2, c)
-		}
-		if c3 != op.sub {
-			t.Fatalf("%f - %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.sub)
-		}
-		c = mulComplex(op.c1, op.c2)
-		c3, ok = c.(complex128)
-		if !ok {
-			t.Fatalf("%f * %f: unexpected result type %T, expected complex128", op.c1, op.c2, c)
-		}
-		if c3 != op.mul {
-			t.Fatalf("%f * %f: unexpected result %.54f, expected %.54f", op.c1, op.c2, c3, op.mul)
-		}
-		if op.c2 != 0 {
-			c = divComplex(op.c1, op.c2)
-			c3, ok = c.(complex128)
-			if !ok {
-				t.Fatalf("%f / %f: unexpected result type %T, expected complex128", op.c1, op.c2, c)
-			}
-			if c3 != op.div {
-				t.Fatalf("%f / %f: unexpected result %.60f, expected %.60f", op.c1, op.c2, c3, op.div)
-			}
-		}
-	}
-}
-
-func TestComplex64(t *testing.T) {
-	operations := []struct {
-		c1, c2, neg, add, sub, mul, div complex64
-	}{
-		{c1: 0, c2: 0, neg: 0, add: 0, sub: 0, mul: 0},
-		{c1: 1, c2: 1, neg: -1, add: 2, sub: 0, mul: 1, div: 1},
-		{c1: 1i, c2: 1i, neg: -1i, add: 2i, sub: 0, mul: -1, div: 1},
-		{
-			c1:  1 + 2i,
-			c2:  3 + 5i,
-			neg: -1 - 2i,
-			add: 4 + 7i,
-			sub: -2 - 3i,
-			mul: -7 + 11i,
-			div: 0.38235294818878173828125 + 0.02941176481544971466064453125i,
-		},
-		{
-			c1:  23.95 - 93.04i,
-			c2:  7.50 + 2i,
-			neg: -23.95 + 93.04i,
-			add: 31.45 - 91.04i,
-			sub: 16.45 - 95.04i,
-			mul: 365.70501708984375 - 649.9000244140625i,
-			div: -0.107136867940425872802734375 - 12.37676334381103515625i,
-		},
-		{
-			c1:  7382.02756423 + 92.7836396i,
-			c2:  294.9384765625 + 795.9273681640625i,
-			neg: -7382.02756423 - 92.7836396i,
-			add: 7676.9658203125 + 888.71099853515625i,
-			sub: 7087.0888671875 - 703.14373779296875i,
-			mul: 2103394.75 + 5902923i,
-			div: 3.1243956089019775390625 - 8.1169757843017578125i,
-		},
-	}
-	for _, op := range operations {
-		c := negComplex(op.c1)
-		c3, ok := c.(complex64)
-		if !ok {
-			t.Fatalf("-(%f): unexpected result type %T, expected complex64", op.c1, c)
-		}
-		if c3 != op.neg {
-			t.Fatalf("-(%f): unexpected result %f, expected %f", op.c1, c3, op.neg)
-		}
-		c = addComplex(op.c1, op.c2)
-		c3, ok = c.(complex64)
-		if !ok {
-			t.Fatalf("%f + %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.add {
-			t.Fatalf("%f + %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.add)
-		}
-		c = subComplex(op.c1, op.c2)
-		c3, ok = c.(complex64)
-		if !ok {
-			t.Fatalf("%f - %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.sub {
-			t.Fatalf("%f - %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.sub)
-		}
-		c = mulComplex(op.c1, op.c2)
-		c3, ok = c.(complex64)
-		if !ok {
-			t.Fatalf("%f * %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.mul {
-			t.Fatalf("%f * %f: unexpected result %.20f, expected %.20f", op.c1, op.c2, c3, op.mul)
-		}
-		if op.c2 != 0 {
-			c = divComplex(op.c1, op.c2)
-			c3, ok = c.(complex64)
-			if !ok {
-				t.Fatalf("%f / %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-			}
-			if c3 != op.div {
-				t.Fatalf("%f / %f: unexpected result %.20f, expected %.20f", op.c1, op.c2, c3, op.div)
-			}
-		}
-	}
-}
-
-func TestComplexNotPredeclared(t *testing.T) {
-	type Complex complex64
-	operations := []struct {
-		c1, c2, neg, add, sub, mul, div Complex
-	}{
-		{
-			c1:  1 + 2i,
-			c2:  3 + 5i,
-			neg: -1 - 2i,
-			add: 4 + 7i,
-			sub: -2 - 3i,
-			mul: -7 + 11i,
-			div: 0.38235294818878173828125 + 0.02941176481544971466064453125i,
-		},
-	}
-	for _, op := range operations {
-		c := negComplex(op.c1)
-		c3, ok := c.(Complex)
-		if !ok {
-			t.Fatalf("-(%f): unexpected result type %T, expected complex64", op.c1, c)
-		}
-		if c3 != op.neg {
-			t.Fatalf("-(%f): unexpected result %f, expected %f", op.c1, c3, op.neg)
-		}
-		c = addComplex(op.c1, op.c2)
-		c3, ok = c.(Complex)
-		if !ok {
-			t.Fatalf("%f + %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.add {
-			t.Fatalf("%f + %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.add)
-		}
-		c = subComplex(op.c1, op.c2)
-		c3, ok = c.(Complex)
-		if !ok {
-			t.Fatalf("%f - %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.sub {
-			t.Fatalf("%f - %f: unexpected result %f, expected %f", op.c1, op.c2, c3, op.sub)
-		}
-		c = mulComplex(op.c1, op.c2)
-		c3, ok = c.(Complex)
-		if !ok {
-			t.Fatalf("%f * %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-		}
-		if c3 != op.mul {
-			t.Fatalf("%f * %f: unexpected result %.20f, expected %.20f", op.c1, op.c2, c3, op.mul)
-		}
-		if op.c2 != 0 {
-			c = divComplex(op.c1, op.c2)
-			c3, ok = c.(Complex)
-			if !ok {
-				t.Fatalf("%f / %f: unexpected result type %T, expected complex64", op.c1, op.c2, c)
-			}
-			if c3 != op.div {
-				t.Fatalf("%f / %f: unexpected result %.20f, expected %.20f", op.c1, op.c2, c3, op.div)
-			}
-		}
-	}
-}
-
 func TestEncodeDecodeRenderContext(t *testing.T) {
 	test := func(inURL, isURLSet bool) {
 		for ctx := ast.ContextText; ctx <= ast.ContextSpacesCodeBlock; ctx++ {
@@ -248,3 +28,223 @@ func TestEncodeDecodeRenderContext(t *testing.T) {
 	test(true, false)
 	test(true, true)
 }
+
+func TestContiguousText(t *testing.T) {
+	src := []byte("<a href=\"b\">c</a>")
+	text, ok := contiguousText([][]byte{src[0:9], src[9:10], {}, src[10:]})
+	if !ok {
+		t.Fatal("expected contiguous text")
+	}
+	if !bytes.Equal(text, src) {
+		t.Fatalf("expected text %q, got %q", src, text)
+	}
+	if &text[0] != &src[0] {
+		t.Fatal("expected text to refer to the source")
+	}
+	if cap(text) != len(text) {
+		t.Fatalf("expected capacity %d, got %d", len(text), cap(text))
+	}
+	for _, texts := range [][][]byte{
+		{src[0:9], src[10:]},
+		{src[9:10], src[0:9]},
+		{src[0:9], []byte("\"")},
+	} {
+		if _, ok := contiguousText(texts); ok {
+			t.Fatalf("unexpected contiguous text for %q", texts)
+		}
+	}
+}
+
+func TestRemoveTrailingMove(t *testing.T) {
+
+	// Add x y t; Move t z, with t released, becomes Add x y z.
+	fb := newTestBuilder()
+	x, y, z := fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int)
+	fb.enterStack()
+	tmp := fb.newRegister(reflect.Int)
+	fb.emitAdd(false, x, y, tmp, reflect.Int)
+	fb.emitMove(false, tmp, z, reflect.Int)
+	fb.exitStack()
+	expected := []runtime.Instruction{{Op: runtime.OpAddInt, A: x, B: y, C: z}}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+	// Add x y t; Move t z, with t not released, is not changed.
+	fb = newTestBuilder()
+	x, y, tmp, z = fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int)
+	fb.enterStack()
+	fb.emitAdd(false, x, y, tmp, reflect.Int)
+	fb.emitMove(false, tmp, z, reflect.Int)
+	fb.exitStack()
+	if len(fb.fn.Body) != 2 {
+		t.Fatalf("expected 2 instructions, got %d", len(fb.fn.Body))
+	}
+
+	// Add x y t; Move t z, with a label at Move, is not changed.
+	fb = newTestBuilder()
+	x, y, z = fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int)
+	fb.enterStack()
+	tmp = fb.newRegister(reflect.Int)
+	fb.emitAdd(false, x, y, tmp, reflect.Int)
+	fb.setLabelAddr(fb.newLabel())
+	fb.emitMove(false, tmp, z, reflect.Int)
+	fb.exitStack()
+	if len(fb.fn.Body) != 2 {
+		t.Fatalf("expected 2 instructions, got %d", len(fb.fn.Body))
+	}
+
+	// GetVar v t; Move t z, with t released, becomes GetVar v z.
+	fb = newTestBuilder()
+	z = fb.newRegister(reflect.Func)
+	fb.enterStack()
+	tmp = fb.newRegister(reflect.Func)
+	fb.emitGetVar(3, tmp, reflect.Func)
+	fb.emitMove(false, tmp, z, reflect.Func)
+	fb.exitStack()
+	expected = []runtime.Instruction{{Op: runtime.OpGetVar, A: 0, B: 3, C: z}}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+	// GetVar v t; Move t z, with v of interface type, is not changed.
+	fb = newTestBuilder()
+	z = fb.newRegister(reflect.Interface)
+	fb.enterStack()
+	tmp = fb.newRegister(reflect.Interface)
+	fb.emitGetVar(3, tmp, reflect.Interface)
+	fb.emitMove(false, tmp, z, reflect.Interface)
+	fb.exitStack()
+	if len(fb.fn.Body) != 2 {
+		t.Fatalf("expected 2 instructions, got %d", len(fb.fn.Body))
+	}
+
+}
+
+func TestCleanUpBody(t *testing.T) {
+
+	// Move 1 x; Move 2 x; Goto L; L: Return, keeps only Move 2 x and Return.
+	fb := newTestBuilder()
+	x := fb.newRegister(reflect.Int)
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.emitMove(true, 2, x, reflect.Int)
+	lab := fb.newLabel()
+	fb.emitGoto(lab)
+	fb.setLabelAddr(lab)
+	fb.end()
+	expected := []runtime.Instruction{
+		{Op: -runtime.OpMove, A: int8(intRegister), B: 2, C: x},
+		{Op: runtime.OpReturn},
+	}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+	// If x == 0; Move 1 x; Move 2 x; Return, keeps the Move that can be skipped.
+	fb = newTestBuilder()
+	x = fb.newRegister(reflect.Int)
+	fb.emitIf(true, x, runtime.ConditionEqual, 0, reflect.Int, &ast.Position{})
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.emitMove(true, 2, x, reflect.Int)
+	fb.end()
+	if len(fb.fn.Body) != 4 {
+		t.Fatalf("expected 4 instructions, got %d", len(fb.fn.Body))
+	}
+
+	// Move 1 x; Move x x; Return, keeps the Move read by the next one.
+	fb = newTestBuilder()
+	x = fb.newRegister(reflect.Int)
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.emitMove(false, x, x, reflect.Int)
+	fb.end()
+	if len(fb.fn.Body) != 3 {
+		t.Fatalf("expected 3 instructions, got %d", len(fb.fn.Body))
+	}
+
+	// Goto L1; Move 1 x; L1: Goto L2; Move 2 x; L2: Return, keeps only Return.
+	fb = newTestBuilder()
+	x = fb.newRegister(reflect.Int)
+	lab1, lab2 := fb.newLabel(), fb.newLabel()
+	fb.emitGoto(lab1)
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.setLabelAddr(lab1)
+	fb.emitGoto(lab2)
+	fb.emitMove(true, 2, x, reflect.Int)
+	fb.setLabelAddr(lab2)
+	fb.end()
+	expected = []runtime.Instruction{{Op: runtime.OpReturn}}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+	// L: Move 1 x; Goto L, threads and keeps the loop.
+	fb = newTestBuilder()
+	x = fb.newRegister(reflect.Int)
+	lab = fb.newLabel()
+	fb.setLabelAddr(lab)
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.emitGoto(lab)
+	fb.end()
+	expected = []runtime.Instruction{
+		{Op: -runtime.OpMove, A: int8(intRegister), B: 1, C: x},
+		{Op: runtime.OpGoto},
+	}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+}
+
+func TestFuseInstructions(t *testing.T) {
+
+	// Move x t; Add t y z fuses the Move with the Add.
+	fb := newTestBuilder()
+	x, y, z, tmp := fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int)
+	fb.emitMove(false, x, tmp, reflect.Int)
+	fb.emitAdd(true, tmp, 1, z, reflect.Int)
+	fb.end()
+	expected := []runtime.Instruction{
+		{Op: runtime.OpMoveAddInt, A: int8(intRegister), B: x, C: tmp},
+		{Op: -runtime.OpAddInt, A: tmp, B: 1, C: z},
+		{Op: runtime.OpReturn},
+	}
+	if !reflect.DeepEqual(fb.fn.Body, expected) {
+		t.Fatalf("expected body %v, got %v", expected, fb.fn.Body)
+	}
+
+	// Index s 2 x; If x == 97 fuses the Index with the If.
+	fb = newTestBuilder()
+	s, x := fb.newRegister(reflect.String), fb.newRegister(reflect.Int)
+	fb.emitIndex(true, s, 2, x, reflect.TypeOf(""), &ast.Position{}, false)
+	fb.emitIf(true, x, runtime.ConditionEqual, 97, reflect.Int, &ast.Position{})
+	fb.emitMove(true, 1, x, reflect.Int)
+	fb.end()
+	if op := fb.fn.Body[0].Op; op != -runtime.OpIndexStringIfInt {
+		t.Fatalf("expected operation %d, got %d", -runtime.OpIndexStringIfInt, op)
+	}
+	if op := fb.fn.Body[1].Op; op != -runtime.OpIfInt {
+		t.Fatalf("expected operation %d, got %d", -runtime.OpIfInt, op)
+	}
+
+	// Move x y; Add y 1 z is not fused if the debugger can stop at the Add.
+	fb = newTestBuilder()
+	x, y, z = fb.newRegister(reflect.Int), fb.newRegister(reflect.Int), fb.newRegister(reflect.Int)
+	fb.emitMove(false, x, y, reflect.Int)
+	fb.addStmtPosAndPath(&ast.Position{Line: 2, Column: 1})
+	fb.emitAdd(true, y, 1, z, reflect.Int)
+	fb.end()
+	if op := fb.fn.Body[0].Op; op != runtime.OpMove {
+		t.Fatalf("expected operation %d, got %d", runtime.OpMove, op)
+	}
+
+	// Move f g; Add g f h, on float registers, is not fused.
+	fb = newTestBuilder()
+	f, g, h := fb.newRegister(reflect.Float64), fb.newRegister(reflect.Float64), fb.newRegister(reflect.Float64)
+	fb.emitMove(false, f, g, reflect.Float64)
+	fb.emitAdd(false, g, f, h, reflect.Float64)
+	fb.end()
+	if op := fb.fn.Body[0].Op; op != runtime.OpMove {
+		t.Fatalf("expected operation %d, got %d", runtime.OpMove, op)
+	}
+
+}
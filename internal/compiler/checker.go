@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"reflect"
 	"strings"
 
@@ -58,6 +59,9 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 			Name:         "main",
 			Declarations: opts.globals,
 		}
+		if err := checkABIVersion(globals); err != nil {
+			return nil, fmt.Errorf("scriggo: %s", err)
+		}
 		globalScope = toTypeCheckerScope(globals, opts.mod, true, 0)
 	}
 
@@ -72,6 +76,9 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 	}
 
 	compilation := newCompilation(globalScope)
+	if opts.mod == templateMod && opts.globals != nil {
+		compilation.enumNames = enumNameFuncs(native.Package{Declarations: opts.globals})
+	}
 	tc := newTypechecker(compilation, tree.Path, opts, importer)
 
 	// If tree extends another template file, transform it swapping the files
@@ -98,6 +105,14 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 		tc.path = extends.Tree.Path
 	}
 
+	// Type check concurrently the imported template files.
+	if opts.mod == templateMod && opts.concurrency > 1 {
+		err := checkImportedFiles(compilation, tree.Nodes, tree.Path, importer, opts, opts.concurrency)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Type check a template file or a script.
 	var err error
 	tree.Nodes, err = tc.checkNodesInNewScopeError(tree, tree.Nodes)
@@ -107,10 +122,22 @@ func typecheck(tree *ast.Tree, importer native.Importer, opts checkerOptions) (m
 	mainPkgInfo := &packageInfo{}
 	mainPkgInfo.IndirectVars = tc.compilation.indirectVars
 	mainPkgInfo.TypeInfos = tc.compilation.typeInfos
+	mainPkgInfo.InitOrder = tc.compilation.initOrder
+	mainPkgInfo.NativeRefs = tc.compilation.nativeRefs
 	err = compilation.finalizeUsingStatements(tc)
 	if err != nil {
 		return nil, err
 	}
+	err = compilation.disallowedGlobalsError()
+	if err != nil {
+		return nil, err
+	}
+	if opts.checkUnusedMacros {
+		err = compilation.unusedMacro()
+		if err != nil {
+			return nil, err
+		}
+	}
 	return map[string]*packageInfo{"main": mainPkgInfo}, nil
 }
 
@@ -123,6 +150,32 @@ type checkerOptions struct {
 	// allowGoStmt enable the "go" statement.
 	allowGoStmt bool
 
+	// allowedGlobals, if not nil, contains the patterns of the globals that
+	// can be used.
+	allowedGlobals []string
+
+	// checkUnusedMacros reports an error for the macros declared in imported
+	// and extending files that are not used.
+	checkUnusedMacros bool
+
+	// concurrency is the maximum number of template files that are checked
+	// concurrently. Zero and one mean that the files are checked sequentially.
+	concurrency int
+
+	// disabledBuiltins are the names of the builtins that cannot be used.
+	disabledBuiltins []string
+
+	// maxConstantStringSize, when not zero, is the maximum size in bytes of a
+	// constant string resulting from a concatenation.
+	maxConstantStringSize int
+
+	// scopeQuery, if not nil, collects the names in scope at a position.
+	scopeQuery *scopeQuery
+
+	// scopeObserver, if not nil, is called with the names in scope at the
+	// top level of each template file.
+	scopeObserver func(path string, names []ScopeName)
+
 	// format types.
 	formatTypes map[ast.Format]reflect.Type
 
@@ -131,6 +184,29 @@ type checkerOptions struct {
 
 	// mdConverter converts a Markdown source code to HTML.
 	mdConverter Converter
+
+	// intSize is the size in bits of the int, uint and uintptr values on the
+	// target. Zero means the size on the host.
+	intSize int
+
+	// orDefault makes the or operator, with a non-constant and non-boolean
+	// left operand, evaluate to the left operand or to the right operand.
+	orDefault bool
+
+	// sanitizers contains the functions that convert a value from a format
+	// type to another, indexed by source and destination type.
+	sanitizers map[[2]reflect.Type]reflect.Value
+
+	// strictShows reports an error for the shown values with the empty
+	// interface type.
+	strictShows bool
+
+	// types, if not nil, creates the types. If it is nil, each type checker
+	// has its own instance.
+	types *types.Types
+
+	// warn, if not nil, is called with the warnings.
+	warn func(path string, pos ast.Position, msg string)
 }
 
 // typechecker represents the state of the type checking.
@@ -196,6 +272,22 @@ type typechecker struct {
 	// toBeEmitted reports whether the current branch of the tree will be
 	// emitted or not.
 	toBeEmitted bool
+
+	// parallelFunc is the function literal that replaces the body of the
+	// innermost parallel for statement currently checked, if any.
+	parallelFunc *ast.Func
+
+	// stmtPos is the position of the statement currently checked, if any. It
+	// is the position of the internal errors.
+	stmtPos *ast.Position
+
+	// instances contains the instances of the generic functions whose body
+	// has not been checked yet.
+	instances []*funcInstance
+
+	// instance is the instance of a generic function whose body is currently
+	// checked, if any.
+	instance *funcInstance
 }
 
 // usingCheck contains information about the type checking of a 'using'
@@ -209,8 +301,10 @@ type usingCheck struct {
 	toBeEmitted bool
 	// itea is the declaration of the 'itea' identifier.
 	itea *ast.Var
-	// pos is the position of the 'using' statement.
-	pos *ast.Position
+	// path and pos are the path of the file and the position of the 'using'
+	// statement.
+	path string
+	pos  *ast.Position
 	// typ is type of the 'itea' predeclared identifier, as denoted in the
 	// 'using' statement (implicitly or explicitly).
 	typ ast.Expression
@@ -219,7 +313,10 @@ type usingCheck struct {
 // newTypechecker creates a new type checker. A global scope may be provided
 // for scripts and templates.
 func newTypechecker(compilation *compilation, path string, opts checkerOptions, importer native.Importer) *typechecker {
-	tt := types.NewTypes()
+	tt := opts.types
+	if tt == nil {
+		tt = types.NewTypes()
+	}
 	tc := typechecker{
 		compilation:   compilation,
 		path:          path,
@@ -345,6 +442,48 @@ func (tc *typechecker) getNestedFuncs(name string) []*ast.Func {
 	panic(internalError("unexpected"))
 }
 
+// checkAllowedGlobal checks that the global with the given name, referenced
+// by node, is allowed. If it is not allowed, the reference is recorded so that
+// all the references to disallowed globals are reported at the end of the
+// type checking.
+func (tc *typechecker) checkAllowedGlobal(node ast.Node, name string) {
+	if tc.opts.allowedGlobals == nil {
+		return
+	}
+	for _, pattern := range tc.opts.allowedGlobals {
+		if ok, _ := path.Match(pattern, name); ok {
+			return
+		}
+	}
+	pos := node.Pos()
+	for _, ref := range tc.compilation.disallowedGlobals {
+		if ref.path == tc.path && *ref.pos == *pos {
+			return
+		}
+	}
+	ref := globalReference{path: tc.path, pos: pos, name: name}
+	tc.compilation.disallowedGlobals = append(tc.compilation.disallowedGlobals, ref)
+}
+
+// checkDisabledBuiltin checks that the builtin with the given name,
+// referenced by node, is not disabled.
+func (tc *typechecker) checkDisabledBuiltin(node ast.Node, name string) {
+	for _, disabled := range tc.opts.disabledBuiltins {
+		if disabled == name {
+			panic(tc.errorf(node, "use of disabled builtin %s", name))
+		}
+	}
+}
+
+// addNativeRef records the reference to the native function, variable or
+// type with the given type info and name, if it will be emitted.
+func (tc *typechecker) addNativeRef(ti *typeInfo, name string) {
+	if !tc.toBeEmitted || !ti.IsNative() || ti.NativePackageName == "" {
+		return
+	}
+	tc.compilation.nativeRefs[ti.NativePackageName+"."+name] = true
+}
+
 // errorf builds and returns a type checking error. This method is used
 // internally by the type checker: when it finds an error, instead of returning
 // it the type checker panics with a CheckingError argument; this type of panics
@@ -361,6 +500,22 @@ func (tc *typechecker) errorf(nodeOrPos interface{}, format string, args ...inte
 	return checkError(tc.path, nodeOrPos, format, args...)
 }
 
+// internalCheckingError returns a checking error for r, the value of a
+// recovered panic that is not a checking error, so that a bug in the type
+// checker is reported as an error and does not crash the caller. The error
+// has the position of the statement currently checked.
+func (tc *typechecker) internalCheckingError(r interface{}) *CheckingError {
+	msg := fmt.Sprint(r)
+	if !strings.HasPrefix(msg, "scriggo: ") {
+		msg = internalError("%s", msg)
+	}
+	err := &CheckingError{path: tc.path, err: errors.New(msg)}
+	if tc.stmtPos != nil {
+		err.pos = ast.Position{Line: tc.stmtPos.Line, Column: tc.stmtPos.Column, Start: tc.stmtPos.Start, End: tc.stmtPos.End}
+	}
+	return err
+}
+
 func checkError(path string, nodeOrPos interface{}, format string, args ...interface{}) error {
 	var pos *ast.Position
 	if node, ok := nodeOrPos.(ast.Node); ok {
@@ -6,6 +6,7 @@ package compiler
 
 import (
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/open2b/scriggo/ast"
@@ -467,6 +468,9 @@ func (tc *typechecker) declareVariable(lh *ast.Identifier, typ reflect.Type) {
 
 // checkAssignTo checks that it is possible to assign to the expression expr.
 func (tc *typechecker) checkAssignTo(ti *typeInfo, expr ast.Expression) {
+	if tc.parallelFunc != nil {
+		tc.checkParallelAssignTo(expr)
+	}
 	if ti.Addressable() && !ti.IsMacroDeclaration() || tc.isMapIndexing(expr) {
 		return
 	}
@@ -494,6 +498,79 @@ func (tc *typechecker) checkAssignTo(ti *typeInfo, expr ast.Expression) {
 	panic(tc.errorf(expr, format, expr))
 }
 
+// checkParallelAssignTo checks that the expression expr, assigned in the body
+// of a parallel for statement, refers to a variable declared in the body and
+// that it is not assigned through a map, a slice or a pointer, as the
+// iterations could assign to it concurrently.
+func (tc *typechecker) checkParallelAssignTo(expr ast.Expression) {
+	indirect := false
+	root := expr
+	for {
+		switch e := root.(type) {
+		case *ast.Selector:
+			if tc.selectsThroughPointer(e) {
+				indirect = true
+			}
+			root = e.Expr
+			continue
+		case *ast.Index:
+			if ti := tc.compilation.typeInfos[e.Expr]; ti.Type.Kind() != reflect.Array {
+				indirect = true
+			}
+			root = e.Expr
+			continue
+		case *ast.UnaryOperator:
+			if e.Op == ast.OperatorPointer {
+				indirect = true
+				root = e.Expr
+				continue
+			}
+		}
+		break
+	}
+	if ident, ok := root.(*ast.Identifier); ok {
+		if isBlankIdentifier(ident) {
+			return
+		}
+		if !tc.scopes.DeclaredInFunc(ident.Name, tc.parallelFunc) {
+			panic(tc.errorf(expr, "cannot assign to %s in parallel for (%s is declared outside the loop)", expr, ident.Name))
+		}
+	} else {
+		indirect = true
+	}
+	if indirect {
+		panic(tc.errorf(expr, "cannot assign to %s in parallel for (it may be shared by the iterations)", expr))
+	}
+}
+
+// selectsThroughPointer reports whether the selector expr selects a field
+// through a pointer, as the operand is a pointer or the field is promoted
+// from an embedded pointer.
+func (tc *typechecker) selectsThroughPointer(expr *ast.Selector) bool {
+	ti := tc.compilation.typeInfos[expr.Expr]
+	if ti == nil || ti.IsPackage() || ti.Type == nil {
+		return false
+	}
+	t := ti.Type
+	if t.Kind() == reflect.Ptr {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	field, ok := t.FieldByName(expr.Ident)
+	if !ok {
+		return false
+	}
+	for _, i := range field.Index[:len(field.Index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
 // mustBeAssignableTo ensures that the type info of rhExpr is assignable to the
 // given type, otherwise panics. unbalanced reports whether the assignment is
 // unbalanced and in this case unbalancedLh is its left expression that is
@@ -568,6 +645,9 @@ func (tc *typechecker) rebalancedRightSide(node ast.Node) []ast.Expression {
 
 	if call, ok := rhExpr.(*ast.Call); ok {
 		tis := tc.checkCallExpression(call)
+		if len(tis) == 1 && tc.opts.mod == templateMod && isArrayOrSlice(tis[0]) {
+			return tc.destructuredRightSide(node, len(nodeLhs), call, tis[0])
+		}
 		if len(nodeLhs) != len(tis) {
 			ti := tc.compilation.typeInfos[call.Func]
 			if ti.IsBuiltinFunction() {
@@ -583,6 +663,28 @@ func (tc *typechecker) rebalancedRightSide(node ast.Node) []ast.Expression {
 		return rhsExpr
 	}
 
+	// In templates, an array or a slice value is destructured into its
+	// elements, unless the value is a comma-ok expression.
+	if tc.opts.mod == templateMod && len(nodeRhs) == 1 {
+		commaOk := false
+		if len(nodeLhs) == 2 {
+			switch v := rhExpr.(type) {
+			case *ast.TypeAssertion:
+				commaOk = true
+			case *ast.Index:
+				ti := tc.checkExpr(v.Expr)
+				commaOk = !ti.Nil() && ti.Type.Kind() == reflect.Map
+			case *ast.UnaryOperator:
+				commaOk = v.Op == ast.OperatorReceive
+			}
+		}
+		if !commaOk {
+			if ti := tc.checkExpr(rhExpr); isArrayOrSlice(ti) {
+				return tc.destructuredRightSide(node, len(nodeLhs), rhExpr, ti)
+			}
+		}
+	}
+
 	if len(nodeLhs) == 2 && len(nodeRhs) == 1 {
 		switch v := rhExpr.(type) {
 		case *ast.TypeAssertion:
@@ -614,3 +716,29 @@ func (tc *typechecker) rebalancedRightSide(node ast.Node) []ast.Expression {
 	panic(tc.errorf(node, "assignment mismatch: %d variables but %d values", len(nodeLhs), len(nodeRhs)))
 
 }
+
+// destructuredRightSide returns the right side of an unbalanced assignment or
+// declaration, represented by node, with n variables and the array or slice
+// expression expr, with type info ti, as the only value. The returned right
+// side has the index expressions expr[0], expr[1], ..., expr[n-1], that share
+// the expr node, so that the emitter evaluates expr only once.
+//
+// The tree is changed for the emitter, and if expr is a slice with less than
+// n elements, the assignment panics at run time.
+func (tc *typechecker) destructuredRightSide(node ast.Node, n int, expr ast.Expression, ti *typeInfo) []ast.Expression {
+	if ti.Type.Kind() == reflect.Array && ti.Type.Len() != n {
+		panic(tc.errorf(node, "assignment mismatch: %d variables but %s has %d elements", n, expr, ti.Type.Len()))
+	}
+	pos := expr.Pos()
+	rhs := make([]ast.Expression, n)
+	for i := range rhs {
+		rhs[i] = ast.NewIndex(pos, expr, ast.NewBasicLiteral(pos, ast.IntLiteral, strconv.Itoa(i)))
+	}
+	switch node := node.(type) {
+	case *ast.Var:
+		node.Rhs = rhs
+	case *ast.Assignment:
+		node.Rhs = rhs
+	}
+	return rhs
+}
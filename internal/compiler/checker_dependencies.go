@@ -116,6 +116,14 @@ func (d *deps) analyzeGlobalDeclarationAssignment(n *ast.Assignment) {
 // analyzeGlobalFunc analyzes a global function declaration.
 func (d *deps) analyzeGlobalFunc(n *ast.Func) {
 	scopes := depScopes{map[string]struct{}{}}
+	for _, p := range n.TypeParams {
+		scopes = declareLocally(scopes, p.Ident.Name)
+	}
+	for _, p := range n.TypeParams {
+		if p.Type != nil {
+			d.addDepsToGlobal(n.Ident, p.Type, scopes)
+		}
+	}
 	for _, f := range n.Type.Parameters {
 		if f.Ident != nil {
 			scopes = declareLocally(scopes, f.Ident.Name)
@@ -254,6 +262,10 @@ func (d *deps) nodeDeps(n ast.Node, scopes depScopes) []*ast.Identifier {
 		return deps
 	case *ast.Comment:
 		return nil
+	case *ast.Conditional:
+		deps := d.nodeDeps(n.Condition, scopes)
+		deps = append(deps, d.nodeDeps(n.Expr1, scopes)...)
+		return append(deps, d.nodeDeps(n.Expr2, scopes)...)
 	case *ast.Const:
 		deps := []*ast.Identifier{}
 		for _, right := range n.Lhs {
@@ -379,13 +391,26 @@ func (d *deps) nodeDeps(n ast.Node, scopes depScopes) []*ast.Identifier {
 	case *ast.Index:
 		deps := d.nodeDeps(n.Expr, scopes)
 		return append(deps, d.nodeDeps(n.Index, scopes)...)
+	case *ast.IndexList:
+		deps := d.nodeDeps(n.Expr, scopes)
+		for _, index := range n.Indices {
+			deps = append(deps, d.nodeDeps(index, scopes)...)
+		}
+		return deps
 	case *ast.Interface:
-		return nil
+		deps := []*ast.Identifier{}
+		for _, elem := range n.Elements {
+			deps = append(deps, d.nodeDeps(elem, scopes)...)
+		}
+		return deps
 	case *ast.Label:
 		return nil
 	case *ast.MapType:
 		deps := d.nodeDeps(n.KeyType, scopes)
 		return append(deps, d.nodeDeps(n.ValueType, scopes)...)
+	case *ast.Range:
+		deps := d.nodeDeps(n.Low, scopes)
+		return append(deps, d.nodeDeps(n.High, scopes)...)
 	case *ast.Raw:
 		return nil
 	case *ast.Return:
@@ -447,6 +472,8 @@ func (d *deps) nodeDeps(n ast.Node, scopes depScopes) []*ast.Identifier {
 		return deps
 	case *ast.Text:
 		return nil
+	case *ast.Trans:
+		return nil
 	case *ast.TypeAssertion:
 		deps := d.nodeDeps(n.Expr, scopes)
 		deps = append(deps, d.nodeDeps(n.Type, scopes)...)
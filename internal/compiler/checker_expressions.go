@@ -14,6 +14,7 @@ import (
 	"unicode"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
 	"github.com/open2b/scriggo/internal/compiler/types"
 )
 
@@ -24,13 +25,21 @@ func (tc *typechecker) checkIdentifier(ident *ast.Identifier, used bool) *typeIn
 
 	ti, decl, ok := tc.scopes.Lookup(ident.Name)
 	if !ok {
-		panic(tc.errorf(ident, "undefined: %s", ident.Name))
+		panic(tc.errorf(ident, "undefined: %s%s", ident.Name, didYouMean(ident.Name, tc.scopes.Names())))
+	}
+
+	if ti.Global() {
+		tc.checkAllowedGlobal(ident, ident.Name)
+	} else if ti.InUniverse() {
+		tc.checkDisabledBuiltin(ident, ident.Name)
 	}
 
 	if ti.IsPackage() {
 		panic(tc.errorf(ident, "use of package %s without selector", ident))
 	}
 
+	tc.addNativeRef(ti, ident.Name)
+
 	// Check if the identifier is the builtin 'iota'.
 	if ti == universe["iota"].ti {
 		// Check if iota is defined in the current expression evaluation.
@@ -67,10 +76,29 @@ func (tc *typechecker) checkIdentifier(ident *ast.Identifier, used bool) *typeIn
 		}
 	}
 
+	// 'comparable' can only be used as a type constraint, and type parameters
+	// are not supported.
+	if ti == universe["comparable"].ti {
+		panic(tc.errorf(ident, "cannot use type comparable outside a type constraint: interface is (or embeds) comparable"))
+	}
+
 	if ti.IsBuiltinFunction() {
 		panic(tc.errorf(ident, "use of builtin %s not in function call", ident.Name))
 	}
 
+	switch ti.value.(type) {
+	case *genericFunc:
+		panic(tc.errorf(ident, "cannot use generic function %s without instantiation", ident.Name))
+	case *typeConstraint:
+		panic(tc.errorf(ident, "cannot use type %s outside a type constraint: interface contains type constraints", ident.Name))
+	}
+
+	if tc.opts.checkUnusedMacros && ti.IsMacroDeclaration() {
+		if decl, ok := decl.(*ast.Identifier); ok {
+			tc.compilation.usedMacros[decl] = true
+		}
+	}
+
 	// Check if it is an upvar.
 	isUpVar := ti.Addressable() && tc.scopes.Function(ident.Name) != tc.scopes.CurrentFunction()
 
@@ -164,7 +192,7 @@ func (tc *typechecker) checkArrayType(array *ast.ArrayType, length int) *typeInf
 	if !len.IsConstant() {
 		panic(tc.errorf(array, "non-constant array bound %s", array.Len))
 	}
-	c, err := len.Constant.representedBy(intType)
+	c, err := tc.representedBy(len.Constant, intType)
 	if err != nil {
 		panic(tc.errorf(array, "%s", err))
 	}
@@ -185,6 +213,9 @@ func (tc *typechecker) checkExpr(expr ast.Expression) *typeInfo {
 	if ti.IsType() {
 		panic(tc.errorf(expr, "type %s is not an expression", ti))
 	}
+	if tc.parallelFunc != nil {
+		tc.checkParallelFuncValue(expr, ti)
+	}
 	tc.compilation.typeInfos[expr] = ti
 	return ti
 }
@@ -228,10 +259,37 @@ func (tc *typechecker) checkType(expr ast.Expression) *typeInfo {
 // info.
 func (tc *typechecker) checkExprOrType(expr ast.Expression) *typeInfo {
 	ti := tc.typeof(expr, false)
+	if tc.parallelFunc != nil && !ti.IsType() {
+		tc.checkParallelFuncValue(expr, ti)
+	}
 	tc.compilation.typeInfos[expr] = ti
 	return ti
 }
 
+// checkParallelFuncValue checks that the expression expr, with type info ti,
+// in the body of a parallel for statement, is not a macro or a function
+// literal declared outside of the body, as calling it, the iterations could
+// assign concurrently to the variables declared outside of the body. Native
+// functions, methods and function literals declared in the body are allowed.
+func (tc *typechecker) checkParallelFuncValue(expr ast.Expression, ti *typeInfo) {
+	if ti.Type == nil || ti.Type.Kind() != reflect.Func || ti.MethodType != noMethod {
+		return
+	}
+	if ti.IsNative() && !ti.Addressable() {
+		return
+	}
+	switch e := expr.(type) {
+	case *ast.Func:
+		return
+	case *ast.Identifier:
+		if !ti.IsMacroDeclaration() && tc.scopes.DeclaredInFunc(e.Name, tc.parallelFunc) {
+			return
+		}
+		panic(tc.errorf(expr, "cannot use %s in parallel for (%s is declared outside the loop)", expr, e.Name))
+	}
+	panic(tc.errorf(expr, "cannot use %s in parallel for (it may be a function declared outside the loop)", expr))
+}
+
 // typeof type checks an expression or type and returns its type info.
 // typeExpected reports whether a type is expected; it only affects error
 // messages.
@@ -276,6 +334,9 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		}
 
 	case *ast.UnaryOperator:
+		if expr.Op == ast.OperatorTilde {
+			panic(tc.errorf(expr, "cannot use ~ outside of interface or type constraint"))
+		}
 		t := tc.checkExprOrType(expr.Expr)
 		if t.IsType() {
 			if expr.Op == ast.OperatorPointer {
@@ -313,7 +374,7 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 			if t.IsConstant() {
 				ti.Constant, _ = t.Constant.unaryOp(ast.OperatorSubtraction, nil)
 				if !t.Untyped() {
-					if _, err := ti.Constant.representedBy(ti.Type); err != nil {
+					if _, err := tc.representedBy(ti.Constant, ti.Type); err != nil {
 						panic(tc.errorf(expr, "%s", err))
 					}
 				}
@@ -402,11 +463,30 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 
 		// Handle 'a and b' and 'a or b' expressions.
 		if expr.Op == ast.OperatorExtendedAnd || expr.Op == ast.OperatorExtendedOr {
+			// In a chained comparison 'a < b and b < c', b is shared by the
+			// two comparisons. If it is untyped, or constant, it can have a
+			// different type in each comparison, so clone it.
+			if c1, c2, ok := chainedComparisons(expr); ok {
+				if ti := tc.checkExpr(c1.Expr2); ti.Untyped() || ti.IsConstant() {
+					c2.Expr1 = astutil.CloneExpression(c1.Expr2)
+				}
+			}
 			t1 := tc.checkExpr(expr.Expr1)
 			t2 := tc.checkExpr(expr.Expr2)
 			if t1.Nil() || t2.Nil() {
 				panic(tc.errorf(expr, "invalid operation: %s (operator '%s' not defined on nil)", expr, expr.Op))
 			}
+			// With the orDefault option, if the left operand of 'or' is a
+			// non-constant and non-boolean value and the right operand is
+			// assignable to its type, the expression has the type of the
+			// left operand and evaluates to the left operand if it is not
+			// the zero of its type, otherwise to the right operand.
+			if expr.Op == ast.OperatorExtendedOr && tc.opts.orDefault && !t1.IsConstant() && t1.Type.Kind() != reflect.Bool {
+				if tc.isAssignableTo(t2, expr.Expr2, t1.Type) == nil {
+					t2.setValue(t1.Type)
+					return &typeInfo{Type: t1.Type}
+				}
+			}
 			if t1.IsConstant() && t2.IsConstant() {
 				nz1 := !t1.Constant.zero()
 				nz2 := !t2.Constant.zero()
@@ -448,9 +528,19 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 
 		t, err := tc.binaryOp(expr.Expr1, expr.Op, expr.Expr2)
 		if err != nil {
-			if err == errDivisionByZero {
+			if err == errDivisionByZero || err == errConstantStringTooLarge {
 				panic(tc.errorf(expr, "%s", err))
 			}
+			if expr.Op == ast.OperatorContains || expr.Op == ast.OperatorNotContains {
+				// Give a hint if the element is a value, and not a key, of the map.
+				t1 := tc.compilation.typeInfos[expr.Expr1]
+				if !t1.Nil() && t1.Type.Kind() == reflect.Map {
+					t2 := tc.compilation.typeInfos[expr.Expr2]
+					if tc.isAssignableTo(t2, expr.Expr2, t1.Type.Elem()) == nil {
+						panic(tc.errorf(expr, "invalid operation: %v (%s; %s on a map checks its keys, not its values)", expr, err, expr.Op))
+					}
+				}
+			}
 			panic(tc.errorf(expr, "invalid operation: %v (%s)", expr, err))
 		}
 		return t
@@ -531,10 +621,16 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 	case *ast.CompositeLiteral:
 		return tc.checkCompositeLiteral(expr, nil)
 
+	case *ast.Conditional:
+		return tc.checkConditional(expr)
+
 	case *ast.Default:
 		panic(tc.errorf(expr, "cannot use default expression in this context"))
 
 	case *ast.Interface:
+		if len(expr.Elements) > 0 {
+			panic(tc.errorf(expr, "cannot use type %s outside a type constraint: interface contains type constraints", expr))
+		}
 		return &typeInfo{Type: emptyInterfaceType, Properties: propertyIsType | propertyUniverse}
 
 	case *ast.FuncType:
@@ -571,8 +667,22 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 			}
 		}
 		if expr.Macro {
-			ident := expr.Result[0].Type.(*ast.Identifier)
+			ident, ok := expr.Result[0].Type.(*ast.Identifier)
+			if !ok {
+				panic(tc.errorf(expr.Result[0].Type, "invalid macro result type %s", expr.Result[0].Type))
+			}
 			ti, ok := tc.scopes.Universe(ident.Name)
+			if ok && out[0] == ti.Type {
+				// The result type must be string or a format type, also
+				// if there are other results.
+				ok = false
+				for _, name := range formatTypeName {
+					if ident.Name == name {
+						ok = true
+						break
+					}
+				}
+			}
 			if !ok || out[0] != ti.Type {
 				for _, ud := range tc.compilation.iteaToUsingCheck {
 					if ud.typ == ident {
@@ -608,6 +718,9 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 		return tis[0]
 
 	case *ast.Index:
+		if g := tc.genericFuncOf(expr.Expr); g != nil {
+			return tc.checkInstantiation(expr, g, expr.Expr, []ast.Expression{expr.Index})
+		}
 		t := tc.checkExpr(expr.Expr)
 		if t.Nil() {
 			panic(tc.errorf(expr, "use of untyped nil"))
@@ -675,9 +788,6 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 			if expr.IsFull {
 				panic(tc.errorf(expr, "invalid operation %s (3-index slice of string)", expr))
 			}
-			if t.Type != stringType && tc.isFormatType(t.Type) {
-				panic(tc.errorf(expr, "invalid operation %s (slice of %s)", expr, t))
-			}
 		case reflect.Slice:
 		case reflect.Array:
 			if !t.Addressable() {
@@ -726,15 +836,37 @@ func (tc *typechecker) typeof(expr ast.Expression, typeExpected bool) *typeInfo
 			expr.Expr = unOp
 		}
 		switch kind {
-		case reflect.String, reflect.Slice:
+		case reflect.String:
+			// A slice of a value of a format type is no longer trusted
+			// content, so it has type string and it is escaped when shown.
+			if t.Type != stringType && tc.isFormatType(t.Type) {
+				return &typeInfo{Type: stringType}
+			}
+			return &typeInfo{Type: t.Type}
+		case reflect.Slice:
 			return &typeInfo{Type: t.Type}
 		case reflect.Array, reflect.Ptr:
 			return &typeInfo{Type: tc.types.SliceOf(realType.Elem())}
 		}
 
+	case *ast.IndexList:
+		if g := tc.genericFuncOf(expr.Expr); g != nil {
+			return tc.checkInstantiation(expr, g, expr.Expr, expr.Indices)
+		}
+		panic(tc.errorf(expr, "invalid operation: more than one index"))
+
 	case *ast.Selector:
+		if expr.NilSafe {
+			return tc.checkNilSafeSelector(expr)
+		}
 		// Package selector.
 		if ti, ok := tc.checkPackageSelector(expr); ok {
+			switch ti.value.(type) {
+			case *genericFunc:
+				panic(tc.errorf(expr, "cannot use generic function %s without instantiation", expr))
+			case *typeConstraint:
+				panic(tc.errorf(expr, "cannot use type %s outside a type constraint: interface contains type constraints", expr))
+			}
 			return ti
 		}
 		t := tc.checkExprOrType(expr.Expr)
@@ -794,7 +926,7 @@ func (tc *typechecker) checkIndex(expr ast.Expression, t *typeInfo, isSlice bool
 	}
 	index.setValue(intType)
 	if index.IsConstant() {
-		c, err := index.Constant.representedBy(intType)
+		c, err := tc.representedBy(index.Constant, intType)
 		if err != nil {
 			panic(tc.errorf(expr, "%s", err))
 		}
@@ -831,6 +963,9 @@ func (tc *typechecker) binaryOp(expr1 ast.Expression, op ast.OperatorType, expr2
 
 	var isStringContains bool
 	if op == ast.OperatorContains || op == ast.OperatorNotContains {
+		if t1.Nil() {
+			return nil, fmt.Errorf("operator %s not defined on nil", op)
+		}
 		switch t1.Type.Kind() {
 		case reflect.String:
 			isStringContains = true
@@ -838,6 +973,8 @@ func (tc *typechecker) binaryOp(expr1 ast.Expression, op ast.OperatorType, expr2
 			t1 = &typeInfo{Type: t1.Type.Elem()}
 		case reflect.Map:
 			t1 = &typeInfo{Type: t1.Type.Key()}
+		default:
+			return nil, fmt.Errorf("operator %s not defined on %s", op, t1.Type.Kind())
 		}
 	}
 
@@ -933,6 +1070,15 @@ func (tc *typechecker) binaryOp(expr1 ast.Expression, op ast.OperatorType, expr2
 			}
 		}
 
+		// Check the size of a constant string before concatenating it.
+		if max := tc.opts.maxConstantStringSize; max > 0 && op == ast.OperatorAddition {
+			if s1, ok := t1.Constant.(stringConst); ok {
+				if s2, ok := t2.Constant.(stringConst); ok && len(s1)+len(s2) > max {
+					return nil, errConstantStringTooLarge
+				}
+			}
+		}
+
 		c, err := t1.Constant.binaryOp(op, t2.Constant)
 		if err != nil {
 			switch err {
@@ -959,7 +1105,7 @@ func (tc *typechecker) binaryOp(expr1 ast.Expression, op ast.OperatorType, expr2
 		}
 
 		if !t1.Untyped() && !evalToBoolOperators[op] {
-			c, err = c.representedBy(t1.Type)
+			c, err = tc.representedBy(c, t1.Type)
 			if err != nil {
 				return nil, err
 			}
@@ -1109,7 +1255,7 @@ func (tc *typechecker) checkSize(expr ast.Expression, typ reflect.Type, name str
 	}
 	size.setValue(intType)
 	if size.IsConstant() {
-		c, err := size.Constant.representedBy(intType)
+		c, err := tc.representedBy(size.Constant, intType)
 		if err != nil {
 			panic(tc.errorf(expr, "%s", err))
 		}
@@ -1126,6 +1272,16 @@ func (tc *typechecker) checkBuiltinCall(expr *ast.Call) []*typeInfo {
 
 	ident := expr.Func.(*ast.Identifier)
 
+	// In the body of a parallel for statement, the builtins that write to the
+	// values of their arguments cannot be called, as these values could be
+	// shared by the iterations.
+	if tc.parallelFunc != nil {
+		switch ident.Name {
+		case "append", "copy", "delete":
+			panic(tc.errorf(expr, "cannot use %s in parallel for (it may write to values shared by the iterations)", ident.Name))
+		}
+	}
+
 	if expr.IsVariadic && ident.Name != "append" {
 		panic(tc.errorf(expr, "invalid use of ... with builtin %s", ident.Name))
 	}
@@ -1592,11 +1748,15 @@ func (tc *typechecker) checkCallExpression(expr *ast.Call) []*typeInfo {
 	// Check a builtin function call.
 	if ident, ok := expr.Func.(*ast.Identifier); ok {
 		if ti, _, ok := tc.scopes.Lookup(ident.Name); ok && ti.IsBuiltinFunction() {
+			tc.checkDisabledBuiltin(ident, ident.Name)
 			tc.compilation.typeInfos[expr.Func] = ti
 			return tc.checkBuiltinCall(expr)
 		}
 	}
 
+	// Instantiate a generic function.
+	tc.checkGenericCall(expr)
+
 	t := tc.checkExprOrType(expr.Func)
 
 	switch t.MethodType {
@@ -1704,6 +1864,22 @@ func (tc *typechecker) checkCallExpression(expr *ast.Call) []*typeInfo {
 		}
 	}
 
+	// Check a constant format argument with the arguments it formats.
+	if funcIsVariadic && !callIsVariadic && !special && lastIn > 0 {
+		tc.checkFormat(args[lastIn-1], t.Type.In(lastIn-1), args[lastIn:])
+	}
+
+	// Check the count of a call to builtin.Repeat.
+	if !special && t.IsNative() && !t.Addressable() && t.MethodType == noMethod {
+		if fn, ok := t.value.(reflect.Value); ok && fn.Kind() == reflect.Func {
+			if in, ok := nativeIntrinsic(fn); ok && in.op == intrinsicRepeat {
+				if n := tc.compilation.typeInfos[args[1]]; n.IsConstant() && n.Constant.int64() < 0 {
+					panic(tc.errorf(args[1], "invalid argument: negative count %s in call to %s", n.Constant, expr.Func))
+				}
+			}
+		}
+	}
+
 	numOut := t.Type.NumOut()
 	resultTypes := make([]*typeInfo, numOut)
 	for i := 0; i < numOut; i++ {
@@ -1766,6 +1942,20 @@ func (tc *typechecker) checkExplicitConversion(expr *ast.Call) *typeInfo {
 		return ti
 	}
 
+	// Check the conversion between format types with a sanitizer. The
+	// conversion is replaced by a call to the sanitizer.
+	if t.IsFormatType() && t.Type != arg.Type && !arg.IsUntypedConstant() {
+		if fn, ok := tc.opts.sanitizers[[2]reflect.Type{arg.Type, t.Type}]; ok {
+			tc.compilation.typeInfos[expr.Func] = &typeInfo{
+				Properties: propertyIsNative | propertyHasValue | propertyIsSanitizer,
+				Type:       fn.Type(),
+				value:      fn,
+			}
+			arg.setValue(arg.Type)
+			return &typeInfo{Type: t.Type}
+		}
+	}
+
 	var c constant
 	var err error
 
@@ -1776,7 +1966,7 @@ func (tc *typechecker) checkExplicitConversion(expr *ast.Call) *typeInfo {
 		k := t.Type.Kind()
 		if k == reflect.Interface {
 			if t.Type.NumMethod() == 0 {
-				_, err = arg.Constant.representedBy(arg.Type)
+				_, err = tc.representedBy(arg.Constant, arg.Type)
 			} else {
 				err = errTypeConversion
 			}
@@ -1803,7 +1993,7 @@ func (tc *typechecker) checkExplicitConversion(expr *ast.Call) *typeInfo {
 					err = errTypeConversion
 				}
 			default:
-				c, err = arg.Constant.representedBy(t.Type)
+				c, err = tc.representedBy(arg.Constant, t.Type)
 				if err == errNotRepresentable {
 					err = errTypeConversion
 				}
@@ -1851,7 +2041,7 @@ func (tc *typechecker) maxIndex(node *ast.CompositeLiteral) int {
 			currentIndex = -1
 			ti := tc.checkExpr(kv.Key)
 			if ti.IsConstant() {
-				c, _ := ti.Constant.representedBy(intType)
+				c, _ := tc.representedBy(ti.Constant, intType)
 				if c != nil {
 					currentIndex = int(c.int64())
 				}
@@ -1889,6 +2079,9 @@ func (tc *typechecker) checkCompositeLiteral(node *ast.CompositeLiteral, typ ref
 
 	// Handle composite literal nodes with implicit type.
 	if node.Type == nil {
+		if typ == nil {
+			panic(tc.errorf(node, "missing type in composite literal"))
+		}
 		node.Type = ast.NewPlaceholder()
 		tc.compilation.typeInfos[node.Type] = &typeInfo{Properties: propertyIsType, Type: typ}
 	}
@@ -1931,6 +2124,7 @@ func (tc *typechecker) checkCompositeLiteral(node *ast.CompositeLiteral, typ ref
 	case reflect.Slice, reflect.Array:
 
 		hasIndex := map[int]struct{}{}
+		index := -1
 		for i := range node.KeyValues {
 			kv := &node.KeyValues[i]
 			if kv.Key != nil {
@@ -1938,14 +2132,16 @@ func (tc *typechecker) checkCompositeLiteral(node *ast.CompositeLiteral, typ ref
 				if keyTi.Constant == nil {
 					panic(tc.errorf(node, "index must be non-negative integer constant"))
 				}
-				if keyTi.IsConstant() {
-					index := int(keyTi.Constant.int64())
-					if _, ok := hasIndex[index]; ok {
-						panic(tc.errorf(node, "duplicate index in %s literal: %s", ti.Type.Kind(), kv.Key))
-					}
-					hasIndex[index] = struct{}{}
-				}
+				index = int(keyTi.Constant.int64())
+			} else {
+				// An element without a key has the index of the previous
+				// element plus one.
+				index++
+			}
+			if _, ok := hasIndex[index]; ok {
+				panic(tc.errorf(node, "duplicate index in %s literal: %d", ti.Type.Kind(), index))
 			}
+			hasIndex[index] = struct{}{}
 			var elemTi *typeInfo
 			if cl, ok := kv.Value.(*ast.CompositeLiteral); ok {
 				if ti.Type.Elem().Kind() == reflect.Ptr {
@@ -2208,6 +2404,116 @@ func (tc *typechecker) isCompileConstant(expr ast.Expression) bool {
 	return true
 }
 
+// checkConditional type checks a conditional expression cond ? x : y. x and
+// y must be assignable to a common type, that is the type of the expression.
+func (tc *typechecker) checkConditional(expr *ast.Conditional) *typeInfo {
+
+	// As for the 'if' statement, a non-boolean condition is true if it is not
+	// the zero value of its type.
+	cond := tc.checkExpr(expr.Condition)
+	if cond.Nil() {
+		panic(tc.errorf(expr.Condition, "use of untyped nil"))
+	}
+	if cond.Type.Kind() != reflect.Bool {
+		if cond.IsConstant() {
+			cond = &typeInfo{
+				Constant:   boolConst(!cond.Constant.zero()),
+				Properties: propertyUntyped,
+				Type:       boolType,
+			}
+			tc.compilation.typeInfos[expr.Condition] = cond
+		} else {
+			expr.Condition = ast.NewUnaryOperator(expr.Condition.Pos(), internalOperatorNotZero, expr.Condition)
+			cond = tc.checkExpr(expr.Condition)
+		}
+	}
+
+	t1 := tc.checkExpr(expr.Expr1)
+	t2 := tc.checkExpr(expr.Expr2)
+	if t1.Nil() && t2.Nil() {
+		panic(tc.errorf(expr, "use of untyped nil"))
+	}
+
+	// Determine the type of the expression. It does not depend on whether
+	// the condition is constant.
+	var typ reflect.Type
+	switch {
+	case t1.Nil():
+		typ = t2.Type
+	case t2.Nil():
+		typ = t1.Type
+	case t1.Untyped() && t2.Untyped():
+		k1, k2 := t1.Type.Kind(), t2.Type.Kind()
+		switch {
+		case isNumeric(k1) && isNumeric(k2):
+			// Use the default type of the kind that comes later in the
+			// list int, rune, float and complex.
+			typ = t1.Type
+			if k2 > k1 {
+				typ = t2.Type
+			}
+		case k1 == k2:
+			typ = t1.Type
+		}
+	case t1.Untyped():
+		typ = t2.Type
+	case t2.Untyped():
+		typ = t1.Type
+	case types.AssignableTo(t2.Type, t1.Type):
+		typ = t1.Type
+	case types.AssignableTo(t1.Type, t2.Type):
+		typ = t2.Type
+	}
+	if typ == nil {
+		panic(tc.errorf(expr, "invalid operation: %s (mismatched types %s and %s)", expr, t1.ShortString(), t2.ShortString()))
+	}
+
+	for i, ti := range [2]*typeInfo{t1, t2} {
+		e := expr.Expr1
+		if i == 1 {
+			e = expr.Expr2
+		}
+		if err := tc.isAssignableTo(ti, e, typ); err != nil {
+			if _, ok := err.(nilConversionError); ok {
+				panic(tc.errorf(e, "cannot use nil as type %s in conditional expression", typ))
+			}
+			panic(tc.errorf(e, "%s in conditional expression", err))
+		}
+		if ti.Nil() {
+			tc.compilation.typeInfos[e] = tc.nilOf(typ)
+		} else {
+			ti.setValue(typ)
+		}
+	}
+
+	// If all the operands are constant, the expression is constant and it
+	// has the value of the selected operand represented by typ.
+	if cond.IsConstant() && t1.IsConstant() && t2.IsConstant() {
+		c1, c2 := t1.Constant, t2.Constant
+		if t1.Untyped() && t2.Untyped() && t1.IsNumeric() && t2.IsNumeric() && reflect.TypeOf(c1) != reflect.TypeOf(c2) {
+			// Represent an untyped integer as a floating-point or complex
+			// constant if the other operand is.
+			c1, c2 = toSameConstImpl(c1, c2)
+		}
+		c := c2
+		if cond.Constant.bool() {
+			c = c1
+		}
+		c, err := tc.representedBy(c, typ)
+		if err != nil {
+			panic(tc.errorf(expr, "%s", err))
+		}
+		ti := &typeInfo{Type: typ, Constant: c}
+		if t1.Untyped() && t2.Untyped() {
+			ti.Properties = propertyUntyped
+		}
+		return ti
+	}
+	cond.setValue(nil)
+
+	return &typeInfo{Type: typ}
+}
+
 // checkDollarIdentifier type checks a dollar identifier $x.
 func (tc *typechecker) checkDollarIdentifier(expr *ast.DollarIdentifier) *typeInfo {
 
@@ -2244,8 +2550,8 @@ func (tc *typechecker) checkDollarIdentifier(expr *ast.DollarIdentifier) *typeIn
 	// expr.IR.Ident is set to "interface{}(x)" or "interface{}(nil)".
 	expr.IR.Ident = ast.NewCall(
 		pos,
-		ast.NewInterface(pos), // "interface{}"
-		[]ast.Expression{arg}, // "x" or "nil"
+		ast.NewInterface(pos, nil), // "interface{}"
+		[]ast.Expression{arg},      // "x" or "nil"
 		false,
 	)
 
@@ -2282,6 +2588,10 @@ func (tc *typechecker) checkDefault(expr *ast.Default, show bool) typeInfoPair {
 			if !tis[0].InUniverse() && !tis[0].Global() {
 				panic(tc.errorf(n, "use of non-builtin %s on left side of default", n))
 			}
+			if tis[0].Global() {
+				tc.checkAllowedGlobal(n, n.Name)
+			}
+			tc.addNativeRef(tis[0], n.Name)
 			if tis[0].IsType() {
 				panic(tc.errorf(n, "unexpected type on left side of default"))
 			}
@@ -2372,26 +2682,7 @@ func (tc *typechecker) checkRender(render *ast.Render) *typeInfo {
 
 	tree := render.Tree
 
-	stored, ok := tc.compilation.renderImportMacro[tree]
-	if !ok {
-		macroDecl := ast.NewFunc(
-			nil,
-			ast.NewIdentifier(nil, "M"+strconv.Quote(tree.Path)),
-			ast.NewFuncType(nil, true, nil, nil, false), // func()
-			ast.NewBlock(nil, tree.Nodes),
-			false,
-			tree.Format,
-		)
-		// The same 'import' declaration may be shared by different template
-		// files that 'render' the same file. This is the expected and intended
-		// behavior.
-		importt := ast.NewImport(nil, ast.NewIdentifier(nil, "."), "/"+render.Path, nil)
-		importt.Tree = tree
-		importt.Tree.Nodes = []ast.Node{macroDecl}
-		stored.Macro = macroDecl
-		stored.Import = importt
-		tc.compilation.renderImportMacro[tree] = stored
-	}
+	stored := tc.compilation.renderIR(tree, render.Path)
 
 	render.IR.Call = ast.NewCall(render.Pos(), stored.Macro.Ident, nil, false)
 	render.IR.Import = stored.Import
@@ -2411,7 +2702,7 @@ func (tc *typechecker) checkImplicitField(field *ast.Field) reflect.StructField
 	//  a pointer to a non-interface type name *T, and T itself
 	//  may not be a pointer type".
 	k := typ.Kind()
-	if typ.Name() == "" {
+	if typ.Name() == "" && k == reflect.Ptr {
 		k = typ.Elem().Kind()
 		if k == reflect.Interface {
 			panic(tc.errorf(field.Type, "embedded type cannot be a pointer to interface"))
@@ -2469,7 +2760,18 @@ func (tc *typechecker) checkPackageSelector(expr *ast.Selector) (*typeInfo, bool
 
 	ti, ok := pkg.value.(*packageInfo).Declarations[expr.Ident]
 	if !ok {
-		panic(tc.errorf(expr, "undefined: %v", expr))
+		panic(tc.errorf(expr, "undefined: %v%s", expr, didYouMean(expr.Ident, declarationNames(pkg.value.(*packageInfo)))))
+	}
+
+	if pkg.Global() {
+		tc.checkAllowedGlobal(expr, ident.Name+"."+expr.Ident)
+	}
+
+	tc.addNativeRef(ti, expr.Ident)
+
+	if tc.opts.checkUnusedMacros && ti.IsMacroDeclaration() {
+		decl := pkg.value.(*packageInfo).DeclarationNodes[expr.Ident]
+		tc.compilation.usedMacros[decl] = true
 	}
 
 	if rv, ok := ti.value.(*reflect.Value); ok && ti.Addressable() {
@@ -2557,7 +2859,7 @@ func (tc *typechecker) checkMethodValue(t *typeInfo, expr *ast.Selector) (*typeI
 
 	method, ok := t.Type.MethodByName(name)
 	if !ok {
-		if kind == reflect.Interface || kind == reflect.Ptr || !t.Addressable() {
+		if kind == reflect.Interface || kind == reflect.Ptr {
 			return nil, false
 		}
 		// Transform t.Mp into (&t).Mp.
@@ -2566,6 +2868,11 @@ func (tc *typechecker) checkMethodValue(t *typeInfo, expr *ast.Selector) (*typeI
 		if !ok {
 			return nil, false
 		}
+		if !t.Addressable() {
+			// The method set of a non-addressable value does not include
+			// the methods with a pointer receiver.
+			panic(tc.errorf(expr, "cannot call pointer method %s on %s", name, t))
+		}
 		if ident, ok := expr.Expr.(*ast.Identifier); ok {
 			if _, decl, ok := tc.scopes.LookupInFunc(ident.Name); ok {
 				tc.compilation.indirectVars[decl] = true
@@ -2598,6 +2905,56 @@ func (tc *typechecker) checkMethodValue(t *typeInfo, expr *ast.Selector) (*typeI
 	}, true
 }
 
+// checkNilSafeSelector checks a nil-safe selector. Its operand must be a
+// pointer to a struct, a map with string keys or an interface and, if it is
+// nil, the selector evaluates to the zero value of the selected field.
+//
+// For a map, x?.k selects the element with key "k", as x["k"]. For an
+// interface, the field, or the element, is selected on the dynamic value at
+// run time and the selector has type interface{}.
+func (tc *typechecker) checkNilSafeSelector(expr *ast.Selector) *typeInfo {
+	t := tc.checkExprOrType(expr.Expr)
+	if t.Nil() {
+		panic(tc.errorf(expr.Expr, "use of untyped nil"))
+	}
+	if t.IsPackage() {
+		panic(tc.errorf(expr.Expr, "use of package %s without selector", expr.Expr))
+	}
+	if t.IsType() {
+		panic(tc.errorf(expr, "invalid operation: %s (?. cannot be used with type %s)", expr, t))
+	}
+	switch t.Type.Kind() {
+	case reflect.Ptr:
+	case reflect.Map:
+		if t.Type.Key().Kind() != reflect.String {
+			panic(tc.errorf(expr, "invalid operation: %s (?. requires a map with string keys, not %s)", expr, t))
+		}
+	case reflect.Interface:
+	default:
+		panic(tc.errorf(expr, "invalid operation: %s (?. requires a pointer, map or interface operand, not %s)", expr, t))
+	}
+	if expr.Ident == "_" {
+		panic(tc.errorf(expr, "cannot refer to blank field or method"))
+	}
+	if t.Type.Kind() != reflect.Ptr {
+		if _, ok := t.Type.MethodByName(expr.Ident); ok {
+			panic(tc.errorf(expr, "invalid operation: %s (?. cannot select method %s)", expr, expr.Ident))
+		}
+		if t.Type.Kind() == reflect.Map {
+			return &typeInfo{Type: t.Type.Elem()}
+		}
+		return &typeInfo{Type: emptyInterfaceType}
+	}
+	if _, ok := tc.checkMethodValue(t, expr); ok {
+		panic(tc.errorf(expr, "invalid operation: %s (?. cannot select method %s)", expr, expr.Ident))
+	}
+	ti := tc.checkFieldSelector(t, expr)
+	// The value of a nil-safe selector can be the zero value, so it is never
+	// addressable.
+	ti.Properties &^= propertyAddressable
+	return ti
+}
+
 // checkFieldSelector checks a field selector.
 func (tc *typechecker) checkFieldSelector(t *typeInfo, expr *ast.Selector) *typeInfo {
 
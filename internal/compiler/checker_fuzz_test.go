@@ -0,0 +1,40 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package compiler
+
+import (
+	"testing"
+)
+
+// FuzzCheckExpr checks that the type checker returns an error, instead of
+// panicking, on expressions that are syntactically valid but not valid
+// for the type checker.
+func FuzzCheckExpr(f *testing.F) {
+	for _, expr := range checkerExprs {
+		f.Add(expr.src)
+	}
+	for _, expr := range checkerExprErrors {
+		f.Add(expr.src)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tree, err := parseSource([]byte("package main\n\nfunc main() {\n\t_ = "+src+"\n}\n"), false)
+		if err != nil {
+			if _, ok := err.(*SyntaxError); !ok {
+				t.Fatalf("expecting a syntax error, got %T: %s", err, err)
+			}
+			return
+		}
+		_, err = typecheck(tree, nil, checkerOptions{mod: programMod})
+		if err == nil {
+			return
+		}
+		if _, ok := err.(*CheckingError); !ok {
+			t.Fatalf("expecting a checking error, got %T: %s", err, err)
+		}
+	})
+}
@@ -0,0 +1,702 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler/types"
+)
+
+// Generic functions are instantiated by the type checker. Every instance is
+// a copy of the declaration of the generic function, with the name of the
+// instance, as "Map[int,string]", and it is type checked, and then emitted,
+// as a non-generic function with the type parameters declared as the type
+// arguments. The generic functions are not emitted.
+
+// maxInstantiationDepth is the maximum depth of the instantiations, within
+// the bodies of the instances, before an instantiation cycle is reported.
+const maxInstantiationDepth = 100
+
+// genericFunc is the value of the type info of a generic function.
+type genericFunc struct {
+	decl      *ast.Func        // declaration.
+	tc        *typechecker     // type checker of the package of the declaration.
+	pkg       *ast.Package     // package of the declaration.
+	params    []*ast.Parameter // type parameters, each one with its constraint.
+	instances []*funcInstance  // instances.
+}
+
+// funcInstance is an instance of a generic function.
+type funcInstance struct {
+	generic *genericFunc
+	args    []reflect.Type // type arguments.
+	decl    *ast.Func      // declaration of the instance.
+	typ     reflect.Type   // type of the instance.
+	depth   int            // depth of the instantiation.
+}
+
+// instanceName is the value of the type info of an expression that refers to
+// an instance of a generic function. It is the name of the instance, as
+// "Map[int,string]", qualified by the package name, as "slices.Map[int]", if
+// the expression is a selector.
+type instanceName string
+
+// typeConstraint is the type set of a type constraint. A type is in the type
+// set if it is comparable, when comparable is true, if it is in every union
+// and if it implements every interface in ifaces.
+type typeConstraint struct {
+	comparable bool
+	unions     [][]typeTerm
+	ifaces     []reflect.Type
+}
+
+// typeTerm is a term of a union, as "int" or "~string".
+type typeTerm struct {
+	typ   reflect.Type
+	tilde bool
+}
+
+// String returns the string representation of term.
+func (term typeTerm) String() string {
+	if term.tilde {
+		return "~" + term.typ.String()
+	}
+	return term.typ.String()
+}
+
+// includes reports whether the term includes the type t.
+func (term typeTerm) includes(t reflect.Type) bool {
+	if term.typ.Kind() == reflect.Interface {
+		return types.Implements(t, term.typ)
+	}
+	if !term.tilde {
+		return t == term.typ
+	}
+	if t.Kind() != term.typ.Kind() {
+		return false
+	}
+	// term.typ is either a predeclared type or a type literal.
+	return term.typ.Name() != "" || types.AssignableTo(t, term.typ)
+}
+
+// declareGenericFunc declares the generic function f of the package pkg in
+// the file/package block.
+func (tc *typechecker) declareGenericFunc(f *ast.Func, pkg *ast.Package) {
+	if tc.opts.mod != programMod {
+		panic(tc.errorf(f.Ident, "generic functions are only supported in programs"))
+	}
+	if name := f.Ident.Name; name == "init" || name == "main" {
+		panic(tc.errorf(f.Ident, "func %s must have no type parameters", name))
+	}
+	g := &genericFunc{decl: f, tc: tc, pkg: pkg, params: make([]*ast.Parameter, len(f.TypeParams))}
+	names := map[string]bool{}
+	for i := len(f.TypeParams) - 1; i >= 0; i-- {
+		param := f.TypeParams[i]
+		if names[param.Ident.Name] && !isBlankIdentifier(param.Ident) {
+			panic(tc.errorf(param.Ident, "%s redeclared in this block", param.Ident.Name))
+		}
+		names[param.Ident.Name] = true
+		constraint := param.Type
+		if constraint == nil {
+			constraint = g.params[i+1].Type
+		}
+		g.params[i] = ast.NewParameter(param.Ident, constraint)
+	}
+	if isBlankIdentifier(f.Ident) {
+		return
+	}
+	if _, ok := tc.scopes.FilePackage(f.Ident.Name); ok {
+		panic(tc.errorf(f.Ident, "%s redeclared in this block", f.Ident.Name))
+	}
+	tc.scopes.Declare(f.Ident.Name, &typeInfo{value: g}, f.Ident, nil)
+}
+
+// genericFuncOf returns the generic function referred by expr, if expr is an
+// identifier or a package selector that refers to a generic function.
+// Otherwise it returns nil.
+func (tc *typechecker) genericFuncOf(expr ast.Expression) *genericFunc {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		if ti, _, ok := tc.scopes.Lookup(expr.Name); ok {
+			if g, ok := ti.value.(*genericFunc); ok {
+				tc.scopes.Use(expr.Name)
+				return g
+			}
+		}
+	case *ast.Selector:
+		if ti, ok := tc.checkPackageSelector(expr); ok {
+			if g, ok := ti.value.(*genericFunc); ok {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// checkGenericCall checks, if call calls a generic function, its
+// instantiation, inferring from the call arguments the type arguments that
+// are not explicitly given.
+func (tc *typechecker) checkGenericCall(call *ast.Call) {
+	fun := call.Func
+	var explicit []ast.Expression
+	switch f := fun.(type) {
+	case *ast.Index:
+		fun, explicit = f.Expr, []ast.Expression{f.Index}
+	case *ast.IndexList:
+		fun, explicit = f.Expr, f.Indices
+	}
+	g := tc.genericFuncOf(fun)
+	if g == nil {
+		return
+	}
+	args := tc.checkTypeArguments(g, explicit)
+	if len(args) < len(g.params) {
+		args = tc.inferTypeArguments(g, args, call)
+	}
+	tc.compilation.typeInfos[call.Func] = tc.instantiate(g, args, fun, call)
+}
+
+// checkInstantiation checks the explicit instantiation expr of the generic
+// function g, where fun is the expression that refers to g and explicit are
+// the type arguments.
+func (tc *typechecker) checkInstantiation(expr ast.Expression, g *genericFunc, fun ast.Expression, explicit []ast.Expression) *typeInfo {
+	args := tc.checkTypeArguments(g, explicit)
+	if len(args) < len(g.params) {
+		panic(tc.errorf(expr, "cannot infer %s", g.params[len(args)].Ident.Name))
+	}
+	return tc.instantiate(g, args, fun, expr)
+}
+
+// checkTypeArguments checks the explicit type arguments of the generic
+// function g and returns their types.
+func (tc *typechecker) checkTypeArguments(g *genericFunc, explicit []ast.Expression) []reflect.Type {
+	if len(explicit) > len(g.params) {
+		panic(tc.errorf(explicit[len(g.params)], "got %d type arguments but want %d", len(explicit), len(g.params)))
+	}
+	args := make([]reflect.Type, len(explicit), len(g.params))
+	for i, arg := range explicit {
+		args[i] = tc.checkType(arg).Type
+	}
+	return args
+}
+
+// inferTypeArguments infers the type arguments of the generic function g, not
+// given in args, from the arguments of call and the core types of the
+// constraints. It returns all the type arguments.
+func (tc *typechecker) inferTypeArguments(g *genericFunc, args []reflect.Type, call *ast.Call) []reflect.Type {
+
+	u := unifier{tc: tc, call: call, g: g, index: map[string]int{}, bound: make([]reflect.Type, len(g.params))}
+	copy(u.bound, args)
+	for i, param := range g.params {
+		u.index[param.Ident.Name] = i
+	}
+
+	params := g.decl.Type.Parameters
+	paramType := func(i int) ast.Expression {
+		for ; params[i].Type == nil; i++ {
+		}
+		return params[i].Type
+	}
+	variadic := g.decl.Type.IsVariadic
+
+	// Unify the types of the parameters with the types of the typed
+	// arguments, and collect the untyped arguments of parameters whose type
+	// is a type parameter.
+	untyped := make([][]*typeInfo, len(g.params))
+	for i, arg := range call.Args {
+		k := i
+		if k >= len(params) {
+			if !variadic {
+				break
+			}
+			k = len(params) - 1
+		}
+		typ := paramType(k)
+		ti := tc.checkExpr(arg)
+		if ti.Nil() {
+			continue
+		}
+		if ti.Untyped() {
+			if ident, ok := typ.(*ast.Identifier); ok {
+				if j, ok := u.index[ident.Name]; ok {
+					untyped[j] = append(untyped[j], ti)
+				}
+			}
+			continue
+		}
+		t := ti.Type
+		if variadic && call.IsVariadic && k == len(params)-1 {
+			if t.Kind() != reflect.Slice {
+				continue
+			}
+			t = t.Elem()
+		}
+		u.arg = arg
+		u.unify(typ, t)
+	}
+
+	// Use the default types of the untyped arguments.
+	for i, tis := range untyped {
+		if u.bound[i] != nil || tis == nil {
+			continue
+		}
+		t := tis[0]
+		for _, ti := range tis[1:] {
+			switch {
+			case ti.Type == t.Type:
+			case ti.IsNumeric() && t.IsNumeric():
+				if numericRank(ti.Type) > numericRank(t.Type) {
+					t = ti
+				}
+			default:
+				panic(tc.errorf(call, "in call to %s, mismatched types %s and %s (cannot infer %s)",
+					call.Func, t, ti, g.params[i].Ident.Name))
+			}
+		}
+		u.bound[i] = t.Type
+	}
+
+	// Unify the type arguments with the core types of the constraints.
+	u.arg = nil
+	for {
+		n := u.numBound()
+		for i, param := range g.params {
+			if u.bound[i] != nil {
+				if core := coreTypeExpr(param.Type); core != nil {
+					u.unify(core, u.bound[i])
+				}
+			}
+		}
+		if u.numBound() == n {
+			break
+		}
+	}
+
+	for i, t := range u.bound {
+		if t == nil {
+			panic(tc.errorf(call, "in call to %s, cannot infer %s", call.Func, g.params[i].Ident.Name))
+		}
+	}
+
+	return u.bound
+}
+
+// numericRank returns the rank of the default type of an untyped numeric
+// constant. Mixing untyped constants, the one with the highest rank wins.
+func numericRank(t reflect.Type) int {
+	switch t {
+	case runeType:
+		return 1
+	case float64Type:
+		return 2
+	case complex128Type:
+		return 3
+	}
+	return 0
+}
+
+// coreTypeExpr returns the expression of the core type of the constraint
+// expr, if it has a single term as "~[]E". Otherwise it returns nil.
+func coreTypeExpr(expr ast.Expression) ast.Expression {
+	if iface, ok := expr.(*ast.Interface); ok {
+		if len(iface.Elements) != 1 {
+			return nil
+		}
+		expr = iface.Elements[0]
+	}
+	if op, ok := expr.(*ast.UnaryOperator); ok && op.Op == ast.OperatorTilde {
+		expr = op.Expr
+	}
+	switch expr.(type) {
+	case *ast.ArrayType, *ast.ChanType, *ast.FuncType, *ast.MapType, *ast.SliceType:
+		return expr
+	}
+	if op, ok := expr.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+		return expr
+	}
+	return nil
+}
+
+// unifier unifies the types of the parameters of a generic function with
+// the types of the arguments of a call, binding the type parameters.
+type unifier struct {
+	tc    *typechecker
+	call  *ast.Call
+	arg   ast.Expression // argument, nil when unifying with a core type.
+	g     *genericFunc
+	index map[string]int // indexes of the type parameters.
+	bound []reflect.Type // bound types.
+}
+
+// numBound returns the number of bound type parameters.
+func (u *unifier) numBound() int {
+	n := 0
+	for _, t := range u.bound {
+		if t != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// unify unifies the type expression expr, that can refer to the type
+// parameters, with the type t. The structural mismatches are ignored, as
+// they are reported when the call is checked.
+func (u *unifier) unify(expr ast.Expression, t reflect.Type) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		i, ok := u.index[expr.Name]
+		if !ok {
+			return
+		}
+		if u.bound[i] == nil {
+			u.bound[i] = t
+			return
+		}
+		if u.bound[i] != t {
+			name := expr.Name
+			if u.arg == nil {
+				panic(u.tc.errorf(u.call, "in call to %s, %s (type %s) does not match inferred type %s for %s",
+					u.call.Func, name, t, u.bound[i], name))
+			}
+			panic(u.tc.errorf(u.arg, "in call to %s, type %s of %s does not match inferred type %s for %s",
+				u.call.Func, t, u.arg, u.bound[i], name))
+		}
+	case *ast.ArrayType:
+		if t.Kind() == reflect.Array {
+			u.unify(expr.ElementType, t.Elem())
+		}
+	case *ast.ChanType:
+		if t.Kind() == reflect.Chan {
+			u.unify(expr.ElementType, t.Elem())
+		}
+	case *ast.FuncType:
+		if t.Kind() != reflect.Func || t.NumIn() != len(expr.Parameters) || t.NumOut() != len(expr.Result) {
+			return
+		}
+		for i := len(expr.Parameters) - 1; i >= 0; i-- {
+			typ := expr.Parameters[i].Type
+			for j := i + 1; typ == nil; j++ {
+				typ = expr.Parameters[j].Type
+			}
+			in := t.In(i)
+			if expr.IsVariadic && i == len(expr.Parameters)-1 {
+				in = in.Elem()
+			}
+			u.unify(typ, in)
+		}
+		for i := len(expr.Result) - 1; i >= 0; i-- {
+			typ := expr.Result[i].Type
+			for j := i + 1; typ == nil; j++ {
+				typ = expr.Result[j].Type
+			}
+			u.unify(typ, t.Out(i))
+		}
+	case *ast.MapType:
+		if t.Kind() == reflect.Map {
+			u.unify(expr.KeyType, t.Key())
+			u.unify(expr.ValueType, t.Elem())
+		}
+	case *ast.SliceType:
+		if t.Kind() == reflect.Slice {
+			u.unify(expr.ElementType, t.Elem())
+		}
+	case *ast.UnaryOperator:
+		if expr.Op == ast.OperatorPointer && t.Kind() == reflect.Ptr {
+			u.unify(expr.Expr, t.Elem())
+		}
+	}
+}
+
+// instantiate instantiates the generic function g with the type arguments
+// args and returns the type info of fun, the expression that refers to g.
+// node is the instantiation or the call node, used for error messages.
+func (tc *typechecker) instantiate(g *genericFunc, args []reflect.Type, fun ast.Expression, node ast.Node) *typeInfo {
+
+	var inst *funcInstance
+
+	// Look for an existing instance.
+Instances:
+	for _, in := range g.instances {
+		for i, arg := range in.args {
+			if arg != args[i] {
+				continue Instances
+			}
+		}
+		inst = in
+		break
+	}
+
+	if inst == nil {
+		depth := 0
+		if tc.instance != nil {
+			depth = tc.instance.depth + 1
+		}
+		if depth > maxInstantiationDepth {
+			panic(tc.errorf(node, "instantiation cycle"))
+		}
+		if err := g.tc.checkConstraints(g, args); err != "" {
+			panic(tc.errorf(node, "%s", err))
+		}
+		inst = g.tc.newInstance(g, args, depth)
+		if g.tc != tc {
+			// The package of the generic function has already been checked.
+			g.tc.checkInstances()
+		}
+	}
+
+	name := inst.decl.Ident.Name
+	if sel, ok := fun.(*ast.Selector); ok {
+		name = sel.Expr.(*ast.Identifier).Name + "." + name
+	}
+
+	return &typeInfo{Type: inst.typ, value: instanceName(name)}
+}
+
+// newInstance returns a new instance of the generic function g, declared in
+// the package of tc, with the type arguments args. Its body will be checked
+// by the checkInstances method.
+func (tc *typechecker) newInstance(g *genericFunc, args []reflect.Type, depth int) *funcInstance {
+
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = arg.String()
+	}
+	name := g.decl.Ident.Name + "[" + strings.Join(names, ",") + "]"
+	for _, in := range g.instances {
+		if in.decl.Ident.Name == name {
+			// Distinct types with the same name.
+			name += "#" + strconv.Itoa(len(g.instances))
+			break
+		}
+	}
+
+	decl := astutil.CloneNode(g.decl).(*ast.Func)
+	decl.Ident.Name = name
+	decl.TypeParams = nil
+
+	exit := tc.enterTypeParams(g, args)
+	typ := tc.checkType(decl.Type).Type
+	exit()
+
+	inst := &funcInstance{generic: g, args: args, decl: decl, typ: typ, depth: depth}
+	g.instances = append(g.instances, inst)
+	g.pkg.Declarations = append(g.pkg.Declarations, decl)
+	tc.instances = append(tc.instances, inst)
+
+	return inst
+}
+
+// checkInstances checks the bodies of the instances of the generic functions
+// declared in the package, that have not been checked yet.
+func (tc *typechecker) checkInstances() {
+	for len(tc.instances) > 0 {
+		inst := tc.instances[0]
+		tc.instances = tc.instances[1:]
+		tc.instance = inst
+		exit := tc.enterTypeParams(inst.generic, inst.args)
+		tc.checkFunc(inst.decl)
+		exit()
+		tc.instance = nil
+	}
+}
+
+// enterTypeParams enters a new block, nested in the file/package block, with
+// the type parameters of g declared as the types in args. It returns a
+// function that exits from the block and restores the previous scopes.
+func (tc *typechecker) enterTypeParams(g *genericFunc, args []reflect.Type) func() {
+	s := tc.scopes.s
+	tc.scopes.s = s[:4:4]
+	tc.scopes.Enter(g.decl.Type)
+	for i, param := range g.params {
+		if !isBlankIdentifier(param.Ident) {
+			tc.scopes.Declare(param.Ident.Name, &typeInfo{Type: args[i], Properties: propertyIsType}, param.Ident, nil)
+		}
+	}
+	return func() {
+		tc.scopes.Exit()
+		tc.scopes.s = s
+	}
+}
+
+// checkConstraints checks that the type arguments args satisfy the
+// constraints of the type parameters of g. If a type argument does not
+// satisfy its constraint, it returns the error message.
+func (tc *typechecker) checkConstraints(g *genericFunc, args []reflect.Type) string {
+	exit := tc.enterTypeParams(g, args)
+	defer exit()
+	for i, param := range g.params {
+		// Check a copy of the constraint, as it can refer to the type
+		// parameters.
+		expr := astutil.CloneExpression(param.Type)
+		c := tc.checkConstraint(expr)
+		t := args[i]
+		if c.comparable && !t.Comparable() {
+			return t.String() + " does not satisfy comparable"
+		}
+		for _, union := range c.unions {
+			in := false
+			for _, term := range union {
+				if term.includes(t) {
+					in = true
+					break
+				}
+			}
+			if !in {
+				terms := make([]string, len(union))
+				for j, term := range union {
+					terms[j] = term.String()
+				}
+				return t.String() + " does not satisfy " + param.Type.String() + " (" + t.String() +
+					" missing in " + strings.Join(terms, " | ") + ")"
+			}
+		}
+		for _, iface := range c.ifaces {
+			if !types.Implements(t, iface) {
+				for j := 0; j < iface.NumMethod(); j++ {
+					if m := iface.Method(j); !hasMethod(t, m.Name) {
+						return t.String() + " does not satisfy " + param.Type.String() + " (missing method " + m.Name + ")"
+					}
+				}
+				return t.String() + " does not satisfy " + param.Type.String()
+			}
+		}
+	}
+	return ""
+}
+
+// hasMethod reports whether the type t has a method with the given name.
+func hasMethod(t reflect.Type, name string) bool {
+	_, ok := t.MethodByName(name)
+	return ok
+}
+
+// checkConstraint checks the type constraint expr and returns its type set.
+func (tc *typechecker) checkConstraint(expr ast.Expression) *typeConstraint {
+	c := &typeConstraint{}
+	tc.addConstraint(c, expr)
+	return c
+}
+
+// addConstraint adds to c the constraint expr, that is a constraint or an
+// element of a constraint interface.
+func (tc *typechecker) addConstraint(c *typeConstraint, expr ast.Expression) {
+	var ti *typeInfo
+	switch e := expr.(type) {
+	case *ast.Interface:
+		for _, elem := range e.Elements {
+			tc.addConstraint(c, elem)
+		}
+		return
+	case *ast.Identifier:
+		if t, _, ok := tc.scopes.Lookup(e.Name); ok {
+			if t == universe["comparable"].ti {
+				c.comparable = true
+				return
+			}
+			if _, ok := t.value.(*typeConstraint); ok {
+				tc.scopes.Use(e.Name)
+				ti = t
+			}
+		}
+	case *ast.Selector:
+		if t, ok := tc.checkPackageSelector(e); ok {
+			if _, ok := t.value.(*typeConstraint); ok {
+				ti = t
+			}
+		}
+	case *ast.BinaryOperator, *ast.UnaryOperator:
+		c.unions = append(c.unions, tc.checkUnion(expr))
+		return
+	}
+	if ti != nil {
+		cc := ti.value.(*typeConstraint)
+		c.comparable = c.comparable || cc.comparable
+		c.unions = append(c.unions, cc.unions...)
+		c.ifaces = append(c.ifaces, cc.ifaces...)
+		return
+	}
+	t := tc.checkType(expr).Type
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() > 0 {
+			c.ifaces = append(c.ifaces, t)
+		}
+		return
+	}
+	c.unions = append(c.unions, []typeTerm{{typ: t}})
+}
+
+// checkUnion checks the union expr, as "~int | ~string", and returns its
+// terms.
+func (tc *typechecker) checkUnion(expr ast.Expression) []typeTerm {
+	switch e := expr.(type) {
+	case *ast.BinaryOperator:
+		if e.Op == ast.OperatorBitOr {
+			return append(tc.checkUnion(e.Expr1), tc.checkUnion(e.Expr2)...)
+		}
+	case *ast.UnaryOperator:
+		if e.Op == ast.OperatorTilde {
+			t := tc.checkType(e.Expr).Type
+			if name := t.Name(); name != "" {
+				if n, ok := universe[name]; !ok || n.ti.Type != t {
+					panic(tc.errorf(e, "invalid use of ~ (underlying type of %s is not %s)", t, t))
+				}
+			}
+			return []typeTerm{{typ: t, tilde: true}}
+		}
+	}
+	t := tc.checkType(expr).Type
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 {
+		panic(tc.errorf(expr, "cannot use %s in union (%s contains methods)", expr, expr))
+	}
+	return []typeTerm{{typ: t}}
+}
+
+// checkConstraintDeclaration checks the declaration of a constraint
+// interface, as "type Number interface{ ~int | ~float64 }", and returns its
+// type info.
+func (tc *typechecker) checkConstraintDeclaration(node *ast.TypeDeclaration) *typeInfo {
+	return &typeInfo{
+		Type:       emptyInterfaceType,
+		Properties: propertyIsType,
+		value:      tc.checkConstraint(node.Type),
+	}
+}
+
+// finalizeGenericFuncs checks the instances of the generic functions of the
+// package pkg, marks as used the imports referred by the generic functions,
+// also if they have not been instantiated, and removes the generic functions
+// from the declarations, as only their instances are emitted.
+func (tc *typechecker) finalizeGenericFuncs(pkg *ast.Package) {
+	tc.checkInstances()
+	useImports := func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			if _, ok := tc.scopes.LookupImport(ident.Name); ok {
+				tc.scopes.Use(ident.Name)
+			}
+		}
+		return true
+	}
+	decls := pkg.Declarations[:0]
+	for _, d := range pkg.Declarations {
+		if f, ok := d.(*ast.Func); ok && f.TypeParams != nil {
+			for _, param := range f.TypeParams {
+				if param.Type != nil {
+					astutil.Inspect(param.Type, useImports)
+				}
+			}
+			astutil.Inspect(f.Type, useImports)
+			astutil.Inspect(f.Body, useImports)
+			continue
+		}
+		decls = append(decls, d)
+	}
+	pkg.Declarations = decls
+}
@@ -62,6 +62,27 @@ func parseNumericConst(s string) (constant, reflect.Type, error) {
 	return n, intType, nil
 }
 
+// checkABIVersion checks that pkg, and the packages auto-imported by pkg,
+// have been generated for the current ABI version. The auto-imported
+// packages are checked before toTypeCheckerScope is called, so that an
+// error can be returned instead of a panic.
+func checkABIVersion(pkg native.ImportablePackage) error {
+	if err := native.CheckABIVersion(pkg); err != nil {
+		return err
+	}
+	var err error
+	_ = pkg.LookupFunc(func(ident string, decl native.Declaration) error {
+		if p, ok := decl.(native.ImportablePackage); ok {
+			if e := native.CheckABIVersion(p); e != nil {
+				err = fmt.Errorf("cannot import %s: %s", ident, e)
+				return native.StopLookup
+			}
+		}
+		return nil
+	})
+	return err
+}
+
 // toTypeCheckerScope generates a type checker scope given a native package.
 // depth must be 0 unless toTypeCheckerScope is called recursively.
 func toTypeCheckerScope(pkg native.ImportablePackage, mod checkingMod, global bool, depth int) map[string]scopeName {
@@ -122,6 +143,28 @@ func toTypeCheckerScope(pkg native.ImportablePackage, mod checkingMod, global bo
 			// Import a type.
 			ti.Type = v
 			ti.Properties |= propertyIsType | propertyIsNative
+		case native.Enum:
+			// Import an enumeration type and its constants.
+			name := ident
+			if p := pkg.PackageName(); p != "main" {
+				name = p + "." + name
+			}
+			ti.Type = v.Type()
+			if ti.Type == nil {
+				panic(fmt.Errorf("scriggo: cannot import %s: invalid enum declaration", name))
+			}
+			ti.Properties |= propertyIsType | propertyIsNative
+			for i, c := range v.Names() {
+				if _, ok := scope[c]; ok || pkg.Lookup(c) != nil {
+					panic(fmt.Errorf("scriggo: cannot import %s: %s is already declared", name, c))
+				}
+				cti := &typeInfo{Type: ti.Type, NativePackageName: ti.NativePackageName}
+				if global {
+					cti.Properties = propertyGlobal
+				}
+				cti.Constant = convertToConstant(reflect.ValueOf(i).Convert(ti.Type))
+				scope[c] = scopeName{ti: cti}
+			}
 		case native.UntypedBooleanConst:
 			// Import an untyped boolean constant.
 			ti.Type = boolType
@@ -147,12 +190,71 @@ func toTypeCheckerScope(pkg native.ImportablePackage, mod checkingMod, global bo
 	return scope
 }
 
+// enumNameFuncs returns, for each enumeration type declared in pkg and in
+// its auto-imported packages, a function that returns the name of a value of
+// the type. The function returns the type name followed by the number in
+// parentheses for the values without a name.
+func enumNameFuncs(pkg native.ImportablePackage) map[reflect.Type]reflect.Value {
+	var funcs map[reflect.Type]reflect.Value
+	_ = pkg.LookupFunc(func(ident string, decl native.Declaration) error {
+		switch d := decl.(type) {
+		case native.Enum:
+			typ, names := d.Type(), d.Names()
+			if typ == nil {
+				return nil
+			}
+			fn := reflect.MakeFunc(reflect.FuncOf([]reflect.Type{typ}, []reflect.Type{stringType}, false),
+				func(args []reflect.Value) []reflect.Value {
+					var s string
+					if v := args[0]; isSigned(v.Kind()) {
+						if n := v.Int(); 0 <= n && n < int64(len(names)) {
+							s = names[n]
+						} else {
+							s = typ.Name() + "(" + strconv.FormatInt(n, 10) + ")"
+						}
+					} else {
+						if n := v.Uint(); n < uint64(len(names)) {
+							s = names[n]
+						} else {
+							s = typ.Name() + "(" + strconv.FormatUint(n, 10) + ")"
+						}
+					}
+					return []reflect.Value{reflect.ValueOf(s)}
+				})
+			if funcs == nil {
+				funcs = map[reflect.Type]reflect.Value{}
+			}
+			funcs[typ] = fn
+		case native.ImportablePackage:
+			for typ, fn := range enumNameFuncs(d) {
+				if funcs == nil {
+					funcs = map[reflect.Type]reflect.Value{}
+				}
+				funcs[typ] = fn
+			}
+		}
+		return nil
+	})
+	return funcs
+}
+
 type packageInfo struct {
 	Name             string
 	Declarations     map[string]*typeInfo
 	DeclarationNodes map[string]*ast.Identifier
 	IndirectVars     map[*ast.Identifier]bool
 	TypeInfos        map[ast.Node]*typeInfo
+	InitOrder        []string
+	NativeRefs       map[string]bool
+}
+
+// declarationNames returns the names of the declarations of pkg.
+func declarationNames(pkg *packageInfo) []string {
+	names := make([]string, 0, len(pkg.Declarations))
+	for name := range pkg.Declarations {
+		names = append(names, name)
+	}
+	return names
 }
 
 func depsOf(name string, deps packageDeclsDeps) []*ast.Identifier {
@@ -515,18 +617,33 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 		return
 	}
 
+	// If the package is checked concurrently by another forked compilation,
+	// wait for it to be checked.
+	if s := compilation.scheduler; s != nil {
+		info, checked, err := s.claim(compilation, path)
+		if checked {
+			if err == nil {
+				compilation.pkgInfos[path] = info
+			}
+			return err
+		}
+		defer func() {
+			s.release(path, compilation.pkgInfos[path], err)
+		}()
+	}
+
+	tc := newTypechecker(compilation, path, opts, importer)
+
 	defer func() {
 		if r := recover(); r != nil {
 			if rerr, ok := r.(*CheckingError); ok {
 				err = rerr
 			} else {
-				panic(r)
+				err = tc.internalCheckingError(r)
 			}
 		}
 	}()
 
-	tc := newTypechecker(compilation, path, opts, importer)
-
 	// Check package level names for "init" and "main"
 	// and check that constant declarations are balanced.
 	for _, decl := range pkg.Declarations {
@@ -593,6 +710,10 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 			if f.Body == nil {
 				return tc.errorf(f.Ident.Pos(), "missing function body")
 			}
+			if f.TypeParams != nil {
+				tc.declareGenericFunc(f, pkg)
+				continue
+			}
 			if f.Ident.Name == "init" || f.Ident.Name == "main" {
 				if len(f.Type.Parameters) > 0 || len(f.Type.Result) > 0 {
 					return tc.errorf(f.Ident, "func %s must have no arguments and no return values", f.Ident.Name)
@@ -617,6 +738,9 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 				if extendingFile {
 					ti.Properties |= propertyMacroDeclaredInFileWithExtends
 				}
+				if opts.checkUnusedMacros {
+					compilation.declaredMacros[f.Ident] = path
+				}
 			}
 			tc.scopes.Declare(f.Ident.Name, ti, f.Ident, nil)
 		}
@@ -626,14 +750,22 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 	for _, d := range pkg.Declarations {
 		switch d := d.(type) {
 		case *ast.Func:
-			tc.checkFunc(d)
+			if d.TypeParams == nil {
+				tc.checkFunc(d)
+			}
 		case *ast.Const:
 			tc.checkConstantDeclaration(d)
 		case *ast.Var:
 			tc.checkVariableDeclaration(d)
+			for _, v := range d.Lhs {
+				compilation.initOrder = append(compilation.initOrder, path+":"+v.Name)
+			}
 		}
 	}
 
+	// Check the instances of the generic functions.
+	tc.finalizeGenericFuncs(pkg)
+
 	if tc.opts.mod != templateMod {
 		// Check that the imported packages have been used.
 		if node := tc.scopes.UnusedImport(); node != nil {
@@ -653,13 +785,33 @@ func checkPackage(compilation *compilation, pkg *ast.Package, path string, impor
 		}
 	}
 
+	if opts.mod == templateMod && opts.scopeObserver != nil {
+		opts.scopeObserver(path, scopeNames(tc.scopes, 0))
+	}
+
+	// In a multi-level extends chain, a file that extends a file and is
+	// extended by another file forwards the declarations of the extending
+	// file, so that the extended files see the declarations of all the
+	// files that extend them.
+	var forward *ast.Import
+	if extendingFile && compilation.extendedTrees[path] {
+		for _, d := range pkg.Declarations {
+			if d, ok := d.(*ast.Import); ok && d.Tree != nil && compilation.extendingTrees[d.Tree.Path] {
+				forward = d
+				break
+			}
+		}
+	}
+
 	// Create a package info and store it into the compilation.
 	compilation.pkgInfos[path] = &packageInfo{
 		Name:             pkg.Name,
-		Declarations:     tc.scopes.ExportedDeclarations(),
-		DeclarationNodes: tc.scopes.ExportedDeclarationNodes(),
+		Declarations:     tc.scopes.ExportedDeclarations(forward),
+		DeclarationNodes: tc.scopes.ExportedDeclarationNodes(forward),
 		IndirectVars:     tc.compilation.indirectVars,
 		TypeInfos:        tc.compilation.typeInfos,
+		InitOrder:        compilation.initOrder,
+		NativeRefs:       compilation.nativeRefs,
 	}
 
 	err = compilation.finalizeUsingStatements(tc)
@@ -6,6 +6,7 @@ package compiler
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/open2b/scriggo/ast"
@@ -349,6 +350,27 @@ var toTypeCheckerScopeCases = []struct {
 		},
 		expected: "scriggo: cannot import foo.A: to import a variable use a pointer to that variable",
 	},
+	{
+		name: "foo.Status",
+		pkg: native.Package{
+			Name: "foo",
+			Declarations: native.Declarations{
+				"Status": native.EnumOf(reflect.TypeOf(0), []string{"Active"}),
+				"Active": 1,
+			},
+		},
+		expected: "scriggo: cannot import foo.Status: Active is already declared",
+	},
+	{
+		name: "main.Status",
+		pkg: native.Package{
+			Name: "main",
+			Declarations: native.Declarations{
+				"Status": native.Enum{},
+			},
+		},
+		expected: "scriggo: cannot import Status: invalid enum declaration",
+	},
 }
 
 // TestToTypeCheckerScope tests the toTypeCheckerScope function.
@@ -0,0 +1,191 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/native"
+)
+
+// checkScheduler schedules the concurrent type checking of the template files
+// imported by a template. Every file is checked in its own compilation, forked
+// from the main compilation, and a file is checked only once its imported
+// files have been checked.
+type checkScheduler struct {
+	mu       sync.Mutex
+	main     *compilation
+	packages map[string]*scheduledPackage
+
+	// usingChecks contains the using checks of the packages, indexed by
+	// package path. They are moved to the compilation that checks the
+	// package.
+	usingChecks map[string]map[string]usingCheck
+}
+
+// scheduledPackage is a package whose type checking has been scheduled.
+type scheduledPackage struct {
+	done chan struct{} // closed when the type checking is completed.
+	info *packageInfo
+	err  error
+}
+
+// claim claims, for compilation, the type checking of the package with the
+// given path. If the package has not been claimed yet, it adds the using
+// checks of the package to compilation and returns false, and the caller
+// must check the package and then call release. Otherwise it waits for the
+// type checking to be completed and returns its package info, true and its
+// error.
+func (s *checkScheduler) claim(compilation *compilation, path string) (*packageInfo, bool, error) {
+	s.mu.Lock()
+	p, ok := s.packages[path]
+	if !ok {
+		s.packages[path] = &scheduledPackage{done: make(chan struct{})}
+	}
+	s.mu.Unlock()
+	if !ok {
+		for name, uc := range s.usingChecks[path] {
+			if compilation.iteaToUsingCheck == nil {
+				compilation.iteaToUsingCheck = map[string]usingCheck{}
+			}
+			compilation.iteaToUsingCheck[name] = uc
+		}
+		return nil, false, nil
+	}
+	<-p.done
+	return p.info, true, p.err
+}
+
+// release releases the package with the given path, claimed with claim,
+// with its package info and the error of the type checking.
+func (s *checkScheduler) release(path string, info *packageInfo, err error) {
+	s.mu.Lock()
+	p := s.packages[path]
+	s.mu.Unlock()
+	p.info = info
+	p.err = err
+	close(p.done)
+}
+
+// checkImportedFiles type checks, with n goroutines, the template files
+// imported, directly or indirectly, by the nodes of a template file. When it
+// returns, the imported files have been checked as if they were checked
+// sequentially in the main compilation.
+//
+// The files imported by more than one file are checked only once, and the
+// error is the same one reported by a sequential type checking.
+func checkImportedFiles(main *compilation, nodes []ast.Node, path string, importer native.Importer, opts checkerOptions, n int) error {
+
+	// Transform the imported files into packages, as the type checker does
+	// when it checks the imports, and sort them in the order in which they
+	// would be checked.
+	tc := newTypechecker(main, path, opts, importer)
+	var imports []*ast.Import
+	visited := map[string]bool{}
+	var visit func(nodes []ast.Node)
+	visit = func(nodes []ast.Node) {
+		for _, node := range nodes {
+			impor, ok := node.(*ast.Import)
+			if !ok || impor.Tree == nil || visited[impor.Tree.Path] {
+				continue
+			}
+			visited[impor.Tree.Path] = true
+			tc.templateFileToPackage(impor.Tree)
+			pkg := impor.Tree.Nodes[0].(*ast.Package)
+			if pkg.Name == "main" {
+				continue
+			}
+			visit(pkg.Declarations)
+			imports = append(imports, impor)
+		}
+	}
+	visit(nodes)
+	if len(imports) == 0 {
+		return nil
+	}
+
+	// Assign the unique indexes in a deterministic order and move the using
+	// checks of the packages, added by the transformation, to the scheduler.
+	order := make(map[string]int, len(imports))
+	usingChecks := map[string]map[string]usingCheck{}
+	for i, impor := range imports {
+		path := impor.Tree.Path
+		order[path] = i
+		main.UniqueIndex(path)
+		for name := range impor.Tree.Nodes[0].(*ast.Package).IR.IteaNameToVarIdents {
+			if usingChecks[path] == nil {
+				usingChecks[path] = map[string]usingCheck{}
+			}
+			usingChecks[path][name] = main.iteaToUsingCheck[name]
+			delete(main.iteaToUsingCheck, name)
+		}
+	}
+
+	// Check the files.
+	scheduler := &checkScheduler{
+		main:        main,
+		packages:    map[string]*scheduledPackage{},
+		usingChecks: usingChecks,
+	}
+	forks := make([]*compilation, len(imports))
+	errs := make([]error, len(imports))
+	jobs := make(chan int, len(imports))
+	for i := range imports {
+		jobs <- i
+	}
+	close(jobs)
+	if n > len(imports) {
+		n = len(imports)
+	}
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for w := 0; w < n; w++ {
+		go func() {
+			for i := range jobs {
+				impor := imports[i]
+				fork := main.fork(scheduler)
+				pkg := impor.Tree.Nodes[0].(*ast.Package)
+				errs[i] = checkPackage(fork, pkg, impor.Tree.Path, importer, opts, main.extendingTrees[impor.Tree.Path])
+				forks[i] = fork
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// Merge the forked compilations into main.
+	start := len(main.initOrder)
+	for _, fork := range forks {
+		main.merge(fork)
+	}
+	orderOf := func(path string) int {
+		if i, ok := order[path]; ok {
+			return i
+		}
+		return len(order)
+	}
+	initOrder := main.initOrder[start:]
+	sort.SliceStable(initOrder, func(i, j int) bool {
+		p1 := initOrder[i][:strings.LastIndexByte(initOrder[i], ':')]
+		p2 := initOrder[j][:strings.LastIndexByte(initOrder[j], ':')]
+		o1, o2 := orderOf(p1), orderOf(p2)
+		return o1 < o2 || o1 == o2 && o1 == len(order) && p1 < p2
+	})
+	refs := main.disallowedGlobals
+	sort.SliceStable(refs, func(i, j int) bool {
+		o1, o2 := orderOf(refs[i].path), orderOf(refs[j].path)
+		return o1 < o2 || o1 == o2 && o1 == len(order) && refs[i].path < refs[j].path
+	})
+
+	return nil
+}
@@ -137,13 +137,26 @@ func (scopes *scopes) Current(name string) (*ast.Identifier, bool) {
 	return n.decl, ok
 }
 
+// Names returns the names declared in all the scopes, including the universe
+// block. A name declared in more scopes is returned more times.
+func (scopes *scopes) Names() []string {
+	var names []string
+	for _, s := range scopes.s {
+		for name := range s.names {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // ExportedDeclarations returns the exported declarations in the file/package
 // block, as a name/type info map, that have not been imported from another
-// package.
-func (scopes *scopes) ExportedDeclarations() map[string]*typeInfo {
+// package. If forward is not nil, also the declarations imported by forward
+// are returned.
+func (scopes *scopes) ExportedDeclarations(forward *ast.Import) map[string]*typeInfo {
 	decls := map[string]*typeInfo{}
 	for name, n := range scopes.s[3].names {
-		if n.impor == nil && isExported(name) {
+		if (n.impor == nil || n.impor == forward) && isExported(name) {
 			decls[name] = n.ti
 		}
 	}
@@ -152,11 +165,12 @@ func (scopes *scopes) ExportedDeclarations() map[string]*typeInfo {
 
 // ExportedDeclarationNodes returns the exported declarations nodes in the
 // file/package block, as a name/declaration's identifier map, that have not
-// been imported from another package.
-func (scopes *scopes) ExportedDeclarationNodes() map[string]*ast.Identifier {
+// been imported from another package. If forward is not nil, also the
+// declarations nodes imported by forward are returned.
+func (scopes *scopes) ExportedDeclarationNodes(forward *ast.Import) map[string]*ast.Identifier {
 	decls := map[string]*ast.Identifier{}
 	for name, n := range scopes.s[3].names {
-		if n.impor == nil && isExported(name) {
+		if (n.impor == nil || n.impor == forward) && isExported(name) {
 			decls[name] = n.decl
 		}
 	}
@@ -321,7 +335,7 @@ func (scopes *scopes) UseLabel(stmt string, ident *ast.Identifier) *ast.Label {
 				return lbl.node
 			}
 		}
-		panic(checkError(scopes.path, lbl.block, "goto %s jumps into block starting at :%s", name, lbl.block))
+		panic(checkError(scopes.path, ident, "goto %s jumps into block starting at %s:%s", name, scopes.path, lbl.block))
 	}
 	if lbl.node == nil {
 		panic(checkError(scopes.path, ident, "%s label not defined: %s", stmt, name))
@@ -373,6 +387,18 @@ func (scopes *scopes) Function(name string) *ast.Func {
 	return nil
 }
 
+// DeclaredInFunc reports whether name is declared in the function fn, or in
+// a function literal nested in fn.
+func (scopes *scopes) DeclaredInFunc(name string, fn *ast.Func) bool {
+	_, i := scopes.lookup(name, 4)
+	for ; i >= 4; i-- {
+		if scopes.s[i].fn.node == fn {
+			return true
+		}
+	}
+	return false
+}
+
 // Functions returns all the functions up to the function of the current
 // scope. If there is no function, it returns nil. There is no function for
 // the main block of scripts.
@@ -398,6 +424,13 @@ func (scopes *scopes) Functions() []*ast.Func {
 // Enter enters a new scope. block is the block of the scope.
 func (scopes *scopes) Enter(block ast.Node) {
 	s := scope{block: block.Pos()}
+	if c := len(scopes.s) - 1; s.block == nil && scopes.s[c].block != nil {
+		// Blocks of template statements have no position. Use the position
+		// of the enclosing block, but with a distinct pointer, because the
+		// goto checks compare blocks by pointer.
+		pos := *scopes.s[c].block
+		s.block = &pos
+	}
 	if node, ok := block.(*ast.Func); ok {
 		s.fn.node = node
 	} else {
@@ -475,6 +508,7 @@ var boolType = reflect.TypeOf(false)
 var uintType = reflect.TypeOf(uint(0))
 var uint8Type = reflect.TypeOf(uint8(0))
 var int32Type = reflect.TypeOf(int32(0))
+var uint32Type = reflect.TypeOf(uint32(0))
 var errorType = reflect.TypeOf((*error)(nil)).Elem()
 
 // universe is the universe scope.
@@ -497,10 +531,12 @@ var universe = map[string]scopeName{
 	"println":    {ti: &typeInfo{Properties: propertyUniverse}},
 	"real":       {ti: &typeInfo{Properties: propertyUniverse}},
 	"recover":    {ti: &typeInfo{Properties: propertyUniverse}},
+	"any":        {ti: &typeInfo{Type: emptyInterfaceType, Alias: "any", Properties: propertyIsType | propertyUniverse}},
 	"byte":       {ti: &typeInfo{Type: uint8Type, Alias: "byte", Properties: propertyIsType | propertyUniverse}},
 	"bool":       {ti: &typeInfo{Type: boolType, Properties: propertyIsType | propertyUniverse}},
 	"complex128": {ti: &typeInfo{Type: complex128Type, Properties: propertyIsType | propertyUniverse}},
 	"complex64":  {ti: &typeInfo{Type: complex64Type, Properties: propertyIsType | propertyUniverse}},
+	"comparable": {ti: &typeInfo{Type: emptyInterfaceType, Properties: propertyIsType | propertyUniverse}},
 	"error":      {ti: &typeInfo{Type: errorType, Properties: propertyIsType | propertyUniverse}},
 	"float32":    {ti: &typeInfo{Type: reflect.TypeOf(float32(0)), Properties: propertyIsType | propertyUniverse}},
 	"float64":    {ti: &typeInfo{Type: float64Type, Properties: propertyIsType | propertyUniverse}},
@@ -6,6 +6,7 @@ package compiler
 
 import (
 	"fmt"
+	"io"
 	"reflect"
 	"strconv"
 	"time"
@@ -18,9 +19,11 @@ import (
 var (
 	stringerType    = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
 	envStringerType = reflect.TypeOf((*native.EnvStringer)(nil)).Elem()
+	writerToType    = reflect.TypeOf((*io.WriterTo)(nil)).Elem()
 
 	htmlStringerType    = reflect.TypeOf((*native.HTMLStringer)(nil)).Elem()
 	htmlEnvStringerType = reflect.TypeOf((*native.HTMLEnvStringer)(nil)).Elem()
+	htmlWriterToType    = reflect.TypeOf((*native.HTMLWriterTo)(nil)).Elem()
 
 	cssStringerType    = reflect.TypeOf((*native.CSSStringer)(nil)).Elem()
 	cssEnvStringerType = reflect.TypeOf((*native.CSSEnvStringer)(nil)).Elem()
@@ -59,7 +62,7 @@ func (tc *typechecker) templateFileToPackage(tree *ast.Tree) {
 			nodes = append(nodes, n.Nodes...)
 		case *ast.Using:
 			iteaName := tc.compilation.generateIteaName()
-			iteaDeclaration, statement := tc.explodeUsingStatement(n, iteaName)
+			iteaDeclaration, statement := tc.explodeUsingStatement(n, tree.Path, iteaName)
 			nodes = append(nodes, iteaDeclaration, statement)
 			if iteaToDeclarations == nil {
 				iteaToDeclarations = map[string][]*ast.Identifier{}
@@ -124,12 +127,15 @@ func (tc *typechecker) checkNodesInNewScopeError(block ast.Node, nodes []ast.Nod
 			if rerr, ok := r.(*CheckingError); ok {
 				err = rerr
 			} else {
-				panic(r)
+				err = tc.internalCheckingError(r)
 			}
 		}
 	}()
 	tc.scopes.Enter(block)
 	newNodes = tc.checkNodes(nodes)
+	if tc.opts.scopeObserver != nil {
+		tc.opts.scopeObserver(tc.path, scopeNames(tc.scopes, 0))
+	}
 	tc.scopes.Exit()
 	return
 }
@@ -151,7 +157,7 @@ func (tc *typechecker) checkNodesError(nodes []ast.Node) (newNodes []ast.Node, e
 				if rerr, ok := r.(*CheckingError); ok {
 					err = rerr
 				} else {
-					panic(r)
+					err = tc.internalCheckingError(r)
 				}
 			}
 		}()
@@ -172,9 +178,23 @@ nodesLoop:
 	for {
 
 		if i >= len(nodes) {
+			if q := tc.opts.scopeQuery; q != nil && i > 0 {
+				if pos := nodes[i-1].Pos(); pos != nil {
+					q.record(tc.path, pos.End+1, tc.scopes)
+				}
+			}
 			break nodesLoop
 		}
 		node := nodes[i]
+		if pos := node.Pos(); pos != nil {
+			tc.stmtPos = pos
+		}
+
+		if q := tc.opts.scopeQuery; q != nil {
+			if pos := node.Pos(); pos != nil {
+				q.record(tc.path, pos.Start, tc.scopes)
+			}
+		}
 
 		switch node := node.(type) {
 
@@ -259,68 +279,83 @@ nodesLoop:
 			tc.terminating = node.Condition == nil && !tc.hasBreak[node]
 
 		case *ast.ForIn:
-			// Check range expression.
-			expr := node.Expr
-			ti := tc.checkExpr(expr)
-			if ti.Nil() {
-				panic(tc.errorf(node, "cannot range over nil"))
-			}
-			ti.setValue(nil)
 			// Replace the node with a ForRange node.
+			expr := node.Expr
 			ipos := node.Ident.Pos()
-			blank := ast.NewIdentifier(ipos.WithEnd(ipos.Start), "_")
 			aPos := ipos.WithEnd(node.Expr.Pos().End)
 			var lhs []ast.Expression
-			switch ti.Type.Kind() {
-			default:
-				lhs = []ast.Expression{blank, node.Ident}
-			case reflect.Map:
-				lhs = []ast.Expression{node.Ident, blank}
-			case reflect.Chan:
+			if _, ok := expr.(*ast.Range); ok {
+				// The range bounds are checked with the ForRange node.
 				lhs = []ast.Expression{node.Ident}
+			} else {
+				ti := tc.checkExpr(expr)
+				if ti.Nil() {
+					panic(tc.errorf(node, "cannot range over nil"))
+				}
+				ti.setValue(nil)
+				blank := ast.NewIdentifier(ipos.WithEnd(ipos.Start), "_")
+				switch ti.Type.Kind() {
+				default:
+					lhs = []ast.Expression{blank, node.Ident}
+				case reflect.Map:
+					lhs = []ast.Expression{node.Ident, blank}
+				case reflect.Chan:
+					lhs = []ast.Expression{node.Ident}
+				}
 			}
 			assignment := ast.NewAssignment(aPos, lhs, ast.AssignmentDeclaration, []ast.Expression{expr})
 			assignment.End = node.Expr.Pos().End
-			nodes[i] = ast.NewForRange(node.Pos(), assignment, node.Body, node.Else)
+			forRange := ast.NewForRange(node.Pos(), assignment, node.Body, node.Else)
+			forRange.Parallel = node.Parallel
+			nodes[i] = forRange
 			continue
 
 		case *ast.ForRange:
+			if node.Parallel {
+				tc.checkParallelForRange(node)
+				break
+			}
 			tc.scopes.Enter(node)
 			tc.addToAncestors(node)
 			// Check range expression.
 			expr := node.Assignment.Rhs[0]
-			ti := tc.checkExpr(expr)
-			if ti.Nil() {
-				panic(tc.errorf(node, "cannot range over nil"))
-			}
-			ti.setValue(nil)
 			maxLhs := 2
 			lhs := node.Assignment.Lhs
 			var typ1, typ2 reflect.Type
-			switch typ := ti.Type; typ.Kind() {
-			case reflect.Array, reflect.Slice:
-				typ1 = intType
-				typ2 = typ.Elem()
-			case reflect.Map:
-				typ1 = typ.Key()
-				typ2 = typ.Elem()
-			case reflect.String:
-				typ1 = intType
-				typ2 = runeType
-			case reflect.Ptr:
-				if typ.Elem().Kind() != reflect.Array {
-					panic(tc.errorf(expr, "cannot range over %s (type %s)", expr, ti))
+			if r, ok := expr.(*ast.Range); ok {
+				typ1 = tc.checkRange(r)
+				maxLhs = 1
+			} else {
+				ti := tc.checkExpr(expr)
+				if ti.Nil() {
+					panic(tc.errorf(node, "cannot range over nil"))
 				}
-				typ1 = intType
-				typ2 = typ.Elem().Elem()
-			case reflect.Chan:
-				if dir := typ.ChanDir(); dir == reflect.SendDir {
-					panic(tc.errorf(node.Assignment.Rhs[0], "invalid operation: range %s (receive from send-only type %s)", expr, ti.String()))
+				ti.setValue(nil)
+				switch typ := ti.Type; typ.Kind() {
+				case reflect.Array, reflect.Slice:
+					typ1 = intType
+					typ2 = typ.Elem()
+				case reflect.Map:
+					typ1 = typ.Key()
+					typ2 = typ.Elem()
+				case reflect.String:
+					typ1 = intType
+					typ2 = runeType
+				case reflect.Ptr:
+					if typ.Elem().Kind() != reflect.Array {
+						panic(tc.errorf(expr, "cannot range over %s (type %s)", expr, ti))
+					}
+					typ1 = intType
+					typ2 = typ.Elem().Elem()
+				case reflect.Chan:
+					if dir := typ.ChanDir(); dir == reflect.SendDir {
+						panic(tc.errorf(node.Assignment.Rhs[0], "invalid operation: range %s (receive from send-only type %s)", expr, ti.String()))
+					}
+					typ1 = typ.Elem()
+					maxLhs = 1
+				default:
+					panic(tc.errorf(node.Assignment.Rhs[0], "cannot range over %s (type %s)", expr, ti.StringWithNumber(true)))
 				}
-				typ1 = typ.Elem()
-				maxLhs = 1
-			default:
-				panic(tc.errorf(node.Assignment.Rhs[0], "cannot range over %s (type %s)", expr, ti.StringWithNumber(true)))
 			}
 			// Check variables.
 			if lhs != nil {
@@ -558,6 +593,11 @@ nodesLoop:
 				panic(tc.errorf(node, "cannot type switch on non-interface value %v (type %s)", ta.Expr,
 					t.StringWithNumber(true)))
 			}
+			guard := t
+			// The symbol declared in the switch guard is declared in a scope
+			// between the switch scope and the case scopes, so that it can
+			// have the same name as a variable declared in the init statement.
+			tc.scopes.Enter(node)
 			var name string
 			var ti *typeInfo
 			if a := node.Assignment; a.Type == ast.AssignmentDeclaration {
@@ -586,11 +626,19 @@ nodesLoop:
 							panic(tc.errorf(cas, "multiple nil cases in type switch (first at %s)", positionOfNil))
 						}
 						positionOfNil = ex.Pos()
+						if name != "" && len(cas.Expressions) == 1 {
+							// In a case with only nil, the symbol has the type of the guard.
+							tc.scopes.Declare(name, ti, ast.NewIdentifier(ex.Pos(), name), nil)
+						}
 						continue
 					}
 					if !t.IsType() {
 						panic(tc.errorf(cas, "%v (type %s) is not a type", expr, t.StringWithNumber(true)))
 					}
+					if t.Type.Kind() != reflect.Interface && !types.Implements(t.Type, guard.Type) {
+						panic(tc.errorf(ex, "impossible type switch case: %v (type %s) cannot have dynamic type %s%s",
+							ta.Expr, guard, t, tc.notImplementedReason(t.Type, guard.Type)))
+					}
 					if name != "" && len(cas.Expressions) == 1 {
 						ti := &typeInfo{Type: t.Type, Properties: propertyAddressable}
 						ident := ast.NewIdentifier(cas.Expressions[0].Pos(), name)
@@ -602,7 +650,7 @@ nodesLoop:
 					}
 					positionOf[t.Type] = ex.Pos()
 				}
-				if name != "" && len(cas.Expressions) != 1 {
+				if name != "" && (len(cas.Expressions) != 1) {
 					tc.scopes.Declare(name, ti, ast.NewIdentifier(cas.Position, name), nil)
 				}
 				cas.Body = tc.checkNodes(cas.Body)
@@ -614,6 +662,7 @@ nodesLoop:
 				}
 				terminating = terminating && tc.terminating
 			}
+			tc.scopes.Exit()
 			tc.removeLastAncestor()
 			tc.scopes.Exit()
 			tc.terminating = terminating && !tc.hasBreak[node] && positionOfDefault != nil
@@ -625,6 +674,7 @@ nodesLoop:
 			terminating := true
 			var positionOfDefault *ast.Position
 			for _, cas := range node.Cases {
+				tc.scopes.Enter(cas)
 				switch comm := cas.Comm.(type) {
 				case nil:
 					if positionOfDefault != nil {
@@ -647,8 +697,9 @@ nodesLoop:
 				case *ast.Send:
 					_ = tc.checkNodes([]ast.Node{comm})
 				}
-				cas.Body = tc.checkNodesInNewScope(node, cas.Body)
+				cas.Body = tc.checkNodes(cas.Body)
 				terminating = terminating && tc.terminating
+				tc.scopes.Exit()
 			}
 			tc.removeLastAncestor()
 			tc.scopes.Exit()
@@ -708,7 +759,7 @@ nodesLoop:
 				}
 			}
 
-			for _, expr := range node.Expressions {
+			for j, expr := range node.Expressions {
 				tis := tc.checkExpr2(expr, true)
 				for _, ti := range tis {
 					if ti == nil {
@@ -717,12 +768,34 @@ nodesLoop:
 					if ti.Nil() {
 						panic(tc.errorf(node, "use of untyped nil"))
 					}
+					if tc.opts.strictShows && ti.Type == emptyInterfaceType {
+						panic(tc.errorf(node, "cannot show %s (type %s must be converted explicitly)", expr, ti.Type))
+					}
 					err := checkShow(ti.Type, node.Context)
 					if err != nil {
 						panic(tc.errorf(node, "cannot show %s (%s)", expr, err))
 					}
+					if tc.opts.warn != nil && node.Context == ast.ContextJSON && !ti.IsConstant() &&
+						canBeNonFiniteInJSON(ti.Type, map[reflect.Type]bool{}) {
+						tc.opts.warn(tc.path, *expr.Pos(), fmt.Sprintf("%s shown in JSON context can be NaN or infinite", expr))
+					}
 				}
 				ti := tis.TypeInfo()
+				// Show the values of the enumeration types as their names.
+				if tis[0] == nil {
+					if fn, ok := tc.compilation.enumNames[ti.Type]; ok && !ti.Type.Implements(stringerType) && !ti.Type.Implements(envStringerType) {
+						ti.setValue(ti.Type)
+						call := ast.NewCall(expr.Pos(), ast.NewIdentifier(expr.Pos(), ti.Type.Name()), []ast.Expression{expr}, false)
+						tc.compilation.typeInfos[call.Func] = &typeInfo{
+							Properties: propertyIsNative | propertyHasValue,
+							Type:       fn.Type(),
+							value:      fn,
+						}
+						tc.compilation.typeInfos[call] = &typeInfo{Type: stringType}
+						node.Expressions[j] = call
+						continue
+					}
+				}
 				ti.setValue(nil)
 			}
 
@@ -732,7 +805,7 @@ nodesLoop:
 
 			iteaName := tc.compilation.generateIteaName()
 
-			iteaDeclaration, statement := tc.explodeUsingStatement(node, iteaName)
+			iteaDeclaration, statement := tc.explodeUsingStatement(node, tc.path, iteaName)
 
 			// Type check the dummy assignment of the 'using' statement, along
 			// with its content, and transform the tree.
@@ -776,7 +849,7 @@ nodesLoop:
 					tc.compilation.typeInfos[call.Func] = deferGoBuiltin(name)
 				}
 			}
-			if ti.IsType() {
+			if ti.IsType() || ti.IsSanitizer() {
 				panic(tc.errorf(node, "defer requires function call, not conversion"))
 			}
 			tc.terminating = false
@@ -800,7 +873,7 @@ nodesLoop:
 					tc.compilation.typeInfos[call.Func] = deferGoBuiltin(name)
 				}
 			}
-			if ti.IsType() {
+			if ti.IsType() || ti.IsSanitizer() {
 				panic(tc.errorf(node, "go requires function call, not conversion"))
 			}
 			if !tc.opts.allowGoStmt {
@@ -857,7 +930,7 @@ nodesLoop:
 				_ = tc.checkNodes([]ast.Node{node.Statement})
 			}
 
-		case *ast.Comment, *ast.Raw:
+		case *ast.Comment, *ast.Raw, *ast.Trans:
 
 		case *ast.Call:
 			tis := tc.checkCallExpression(node)
@@ -880,6 +953,9 @@ nodesLoop:
 
 			// Handle function and macro declarations in scripts and templates.
 			if fun, ok := node.(*ast.Func); ok && fun.Ident != nil && tc.opts.mod != programMod {
+				if fun.TypeParams != nil {
+					panic(tc.errorf(fun.Ident, "generic functions are only supported in programs"))
+				}
 				if fun.Type.Macro && len(fun.Type.Result) == 0 {
 					tc.makeMacroResultExplicit(fun)
 				}
@@ -961,6 +1037,9 @@ func (tc *typechecker) checkImport(impor *ast.Import) error {
 		if pkg == nil {
 			return tc.errorf(impor, "cannot find package %q", impor.Path)
 		}
+		if err := checkABIVersion(pkg); err != nil {
+			return tc.errorf(impor, "cannot import %q: %s", impor.Path, err)
+		}
 
 		// 'import _ "pkg"': nothing to do.
 		if isBlankImport(impor) {
@@ -982,7 +1061,7 @@ func (tc *typechecker) checkImport(impor *ast.Import) error {
 			for _, ident := range impor.For {
 				ti, ok := imported.Declarations[ident.Name]
 				if !ok {
-					return tc.errorf(impor, "undefined: %s", ident)
+					return tc.errorf(impor, "undefined: %s%s", ident, didYouMean(ident.Name, declarationNames(imported)))
 				}
 				tc.scopes.Declare(ident.Name, ti, nil, impor)
 			}
@@ -1057,7 +1136,7 @@ func (tc *typechecker) checkImport(impor *ast.Import) error {
 		for _, ident := range impor.For {
 			ti, ok := imported.Declarations[ident.Name]
 			if !ok {
-				return tc.errorf(impor, "undefined: %s", ident)
+				return tc.errorf(impor, "undefined: %s%s", ident, didYouMean(ident.Name, declarationNames(imported)))
 			}
 			decl, ok := imported.DeclarationNodes[ident.Name]
 			if !ok {
@@ -1153,6 +1232,15 @@ func (tc *typechecker) checkFunc(node *ast.Func) {
 	//
 	// Any blank identifier is transformed into something like "$blank0" so
 	// that it can be assigned as any other parameter.
+	//
+	// The results of a macro with more than one result are unnamed, so they
+	// are made blank to initialize them. The first result is the rendered
+	// content and the others are the values of the return statements.
+	if node.Type.Macro && len(node.Type.Result) > 1 {
+		for _, ret := range node.Type.Result {
+			ret.Ident = ast.NewIdentifier(ret.Type.Pos(), "_")
+		}
+	}
 	var initRetParams []ast.Node
 	for i := 0; i < t.NumOut(); i++ {
 		ret := node.Type.Result[i]
@@ -1188,6 +1276,87 @@ func (tc *typechecker) checkFunc(node *ast.Func) {
 	tc.scopes.Exit()
 }
 
+// checkParallelForRange type checks a parallel for statement, as in
+// "{% for parallel v in items %}", and replaces its body with a function
+// literal, with the element as parameter, that is called for each element.
+// Only slices, arrays and pointers to arrays can be ranged in parallel, and
+// only if the go statement is allowed.
+func (tc *typechecker) checkParallelForRange(node *ast.ForRange) {
+	if !tc.opts.allowGoStmt {
+		panic(tc.errorf(node, "\"for parallel\" statement not available"))
+	}
+	expr := node.Assignment.Rhs[0]
+	if _, ok := expr.(*ast.Range); ok {
+		panic(tc.errorf(expr, "cannot range in parallel over %s", expr))
+	}
+	ti := tc.checkExpr(expr)
+	if ti.Nil() {
+		panic(tc.errorf(node, "cannot range over nil"))
+	}
+	ti.setValue(nil)
+	var elem reflect.Type
+	switch typ := ti.Type; typ.Kind() {
+	case reflect.Array, reflect.Slice:
+		elem = typ.Elem()
+	case reflect.Ptr:
+		if typ.Elem().Kind() == reflect.Array {
+			elem = typ.Elem().Elem()
+		}
+	}
+	if elem == nil {
+		panic(tc.errorf(expr, "cannot range in parallel over %s (type %s)", expr, ti.StringWithNumber(true)))
+	}
+	T := ast.NewPlaceholder()
+	tc.compilation.typeInfos[T] = &typeInfo{Properties: propertyIsType, Type: elem}
+	ident := node.Assignment.Lhs[1].(*ast.Identifier)
+	typ := ast.NewFuncType(nil, false, []*ast.Parameter{ast.NewParameter(ident, T)}, nil, false)
+	fn := ast.NewFunc(node.Pos(), nil, typ, ast.NewBlock(node.Pos(), node.Body), false, ast.FormatText)
+	parallelFunc := tc.parallelFunc
+	tc.parallelFunc = fn
+	tc.checkExpr(fn)
+	tc.parallelFunc = parallelFunc
+	node.Body = []ast.Node{fn}
+	if node.Else != nil {
+		node.Else.Nodes = tc.checkNodesInNewScope(node.Else, node.Else.Nodes)
+	}
+}
+
+// checkRange type checks the integer range of a "for in" statement and
+// returns the type of the values of the range. If both the bounds are
+// untyped, the type is int.
+func (tc *typechecker) checkRange(r *ast.Range) reflect.Type {
+	bounds := [2]ast.Expression{r.Low, r.High}
+	tis := [2]*typeInfo{tc.checkExpr(r.Low), tc.checkExpr(r.High)}
+	for i, ti := range tis {
+		if ti.Nil() || ti.Untyped() && !ti.IsNumeric() || !ti.Untyped() && !ti.IsInteger() {
+			panic(tc.errorf(bounds[i], "non-integer range bound %s", bounds[i]))
+		}
+	}
+	low, high := tis[0], tis[1]
+	typ := intType
+	switch {
+	case !low.Untyped() && !high.Untyped():
+		if low.Type != high.Type {
+			panic(tc.errorf(r, "invalid range %s (mismatched types %s and %s)", r, low.ShortString(), high.ShortString()))
+		}
+		typ = low.Type
+	case !low.Untyped():
+		typ = low.Type
+	case !high.Untyped():
+		typ = high.Type
+	}
+	for i, ti := range tis {
+		if ti.IsConstant() {
+			if _, err := tc.representedBy(ti.Constant, typ); err != nil {
+				panic(tc.errorf(bounds[i], "%s", err))
+			}
+		}
+		ti.setValue(typ)
+	}
+	tc.compilation.typeInfos[r] = &typeInfo{Type: typ}
+	return typ
+}
+
 // checkReturn type checks a return statement.
 //
 // If the return statement has an expression list and the returning function has
@@ -1211,13 +1380,16 @@ func (tc *typechecker) checkFunc(node *ast.Func) {
 func (tc *typechecker) checkReturn(node *ast.Return) ast.Node {
 
 	fn := tc.scopes.CurrentFunction()
-	if fn.Type.Macro {
-		return nil
-	}
 
 	expected := fn.Type.Result
 	got := node.Values
 
+	// The first result of a macro is the rendered content, so the values
+	// of the return statement are the other results.
+	if fn.Type.Macro {
+		expected = expected[1:]
+	}
+
 	if len(expected) == 0 && len(got) == 0 {
 		return nil
 	}
@@ -1326,6 +1498,13 @@ func (tc *typechecker) checkReturn(node *ast.Return) ast.Node {
 //  type Int = int
 //
 func (tc *typechecker) checkTypeDeclaration(node *ast.TypeDeclaration) (string, *typeInfo) {
+	if iface, ok := node.Type.(*ast.Interface); ok && len(iface.Elements) > 0 {
+		ti := tc.checkConstraintDeclaration(node)
+		if isBlankIdentifier(node.Ident) {
+			return "", nil
+		}
+		return node.Ident.Name, ti
+	}
 	typ := tc.checkType(node.Type)
 	if isBlankIdentifier(node.Ident) {
 		return "", nil
@@ -1336,7 +1515,8 @@ func (tc *typechecker) checkTypeDeclaration(node *ast.TypeDeclaration) (string,
 		return name, &typeInfo{Type: typ.Type, Alias: node.Ident.Name, Properties: typ.Properties}
 	}
 	// Create a new Scriggo type.
-	defType := tc.types.DefinedOf(name, typ.Type)
+	decl := tc.path + ":" + node.Pos().String()
+	defType := tc.types.DefinedOf(decl, name, typ.Type)
 	// Associate to
 	//
 	//    type T struct { .. }
@@ -1351,8 +1531,9 @@ func (tc *typechecker) checkTypeDeclaration(node *ast.TypeDeclaration) (string,
 	}
 }
 
-// explodeUsingStatement explodes an 'using' statement.
-func (tc *typechecker) explodeUsingStatement(using *ast.Using, iteaIdent string) (*ast.Var, ast.Node) {
+// explodeUsingStatement explodes an 'using' statement of the file with the
+// given path.
+func (tc *typechecker) explodeUsingStatement(using *ast.Using, path, iteaIdent string) (*ast.Var, ast.Node) {
 
 	// Make the type explicit, if necessary.
 	if using.Type == nil {
@@ -1388,6 +1569,7 @@ func (tc *typechecker) explodeUsingStatement(using *ast.Using, iteaIdent string)
 	)
 	uc := usingCheck{
 		itea: iteaDeclaration,
+		path: path,
 		pos:  using.Position,
 		typ:  using.Type,
 	}
@@ -1417,6 +1599,7 @@ func checkShow(t reflect.Type, ctx ast.Context) error {
 		case kind == reflect.String:
 		case reflect.Bool <= kind && kind <= reflect.Complex128:
 		case ctx == ast.ContextCSSString && t == byteSliceType:
+		case ctx == ast.ContextText && t.Implements(writerToType):
 		case t.Implements(stringerType):
 		case t.Implements(envStringerType):
 		case t.Implements(errorType):
@@ -1432,6 +1615,8 @@ func checkShow(t reflect.Type, ctx ast.Context) error {
 		case t.Implements(envStringerType):
 		case t.Implements(htmlStringerType):
 		case t.Implements(htmlEnvStringerType):
+		case t.Implements(htmlWriterToType):
+		case t.Implements(writerToType):
 		case t.Implements(errorType):
 		default:
 			return fmt.Errorf("cannot show type %s as HTML", t)
@@ -1479,6 +1664,31 @@ func checkShow(t reflect.Type, ctx ast.Context) error {
 	return nil
 }
 
+// canBeNonFiniteInJSON reports whether a value of type t, shown in JSON
+// context, can be or contain a floating-point value that is NaN or infinite.
+// seen contains the types already visited.
+func canBeNonFiniteInJSON(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] || t.Implements(jsonStringerType) || t.Implements(jsonEnvStringerType) {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Array, reflect.Ptr, reflect.Slice:
+		return canBeNonFiniteInJSON(t.Elem(), seen)
+	case reflect.Map:
+		return canBeNonFiniteInJSON(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.PkgPath == "" && f.Tag.Get("json") != "-" && canBeNonFiniteInJSON(f.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // checkShowJS reports whether a type can be shown as JavaScript. It returns
 // an error if the type cannot be shown.
 func checkShowJS(t reflect.Type, types []reflect.Type) error {
@@ -147,6 +147,7 @@ var checkerTemplateExprs = []struct {
 
 	// macro type literal
 	{`(macro() string)(nil)`, &typeInfo{Type: reflect.TypeOf((func() string)(nil))}, nil},
+	{`(macro() (html, int))(nil)`, &typeInfo{Type: reflect.TypeOf((func() (html, int))(nil))}, nil},
 	{`(macro() html)(nil)`, &typeInfo{Type: reflect.TypeOf((func() html)(nil))}, nil},
 	{`(macro() css)(nil)`, &typeInfo{Type: reflect.TypeOf((func() css)(nil))}, nil},
 	{`(macro() js)(nil)`, &typeInfo{Type: reflect.TypeOf((func() js)(nil))}, nil},
@@ -156,6 +157,15 @@ var checkerTemplateExprs = []struct {
 	// conversion from markdown to html
 	{`html(a)`, tiHTMLConst("<h1>title</h1>"), map[string]*typeInfo{"a": tiMarkdownConst("# title")}},
 	{`html(a)`, tiHTML(), map[string]*typeInfo{"a": tiMarkdown()}},
+
+	// indexing and slicing of a format type
+	{`a[1]`, tiByte(), map[string]*typeInfo{"a": tiHTMLConst("<b>a</b>")}},
+	{`a[1]`, tiByte(), map[string]*typeInfo{"a": tiHTML()}},
+	{`a[1:2]`, tiString(), map[string]*typeInfo{"a": tiHTMLConst("<b>a</b>")}},
+	{`a[1:2]`, tiString(), map[string]*typeInfo{"a": tiHTML()}},
+	{`a[:]`, tiString(), map[string]*typeInfo{"a": tiMarkdown()}},
+	{`len(a)`, tiIntConst(8), map[string]*typeInfo{"a": tiHTMLConst("<b>a</b>")}},
+	{`len(a)`, tiInt(), map[string]*typeInfo{"a": tiMarkdown()}},
 }
 
 func TestCheckerTemplateExpressions(t *testing.T) {
@@ -168,7 +178,7 @@ func TestCheckerTemplateExpressions(t *testing.T) {
 	}
 	options := checkerOptions{mod: templateMod, formatTypes: formatTypes, mdConverter: mdConverter}
 	for _, expr := range checkerTemplateExprs {
-		var lex = scanTemplate([]byte("{{ "+expr.src+" }}"), ast.FormatText, false, false, false)
+		var lex = scanTemplate([]byte("{{ "+expr.src+" }}"), ast.FormatText, false, false, false, false)
 		func() {
 			defer func() {
 				if r := recover(); r != nil {
@@ -227,21 +237,28 @@ var checkerTemplateExprErrors = []struct {
 	{`[]int{} contains int32(5)`, tierr(1, 12, `invalid operation: []int{} contains int32(5) (mismatched types int and rune)`), nil},
 	{`[]int{} contains i`, tierr(1, 12, `invalid operation: []int{} contains i (mismatched types int and compiler.definedInt)`), map[string]*typeInfo{"i": definedIntTypeInfo}},
 	{`[2]int{0,1} contains rune('a')`, tierr(1, 16, `invalid operation: [2]int{...} contains rune('a') (mismatched types int and rune)`), nil},
+	{`m contains 1`, tierr(1, 6, `invalid operation: m contains 1 (cannot convert 1 (type untyped int) to type string; contains on a map checks its keys, not its values)`), map[string]*typeInfo{"m": stringToIntMapTypeInfo}},
+	{`m not contains a`, tierr(1, 6, `invalid operation: m not contains a (mismatched types string and int; not contains on a map checks its keys, not its values)`), map[string]*typeInfo{"m": stringToIntMapTypeInfo, "a": tiInt()}},
+	{`m contains true`, tierr(1, 6, `invalid operation: m contains true (cannot convert true (type untyped bool) to type string)`), map[string]*typeInfo{"m": stringToIntMapTypeInfo}},
+	{`5 contains 1`, tierr(1, 6, `invalid operation: 5 contains 1 (operator contains not defined on int)`), nil},
+	{`nil contains 1`, tierr(1, 8, `invalid operation: nil contains 1 (operator contains not defined on nil)`), nil},
+	{`a not contains 1`, tierr(1, 6, `invalid operation: a not contains 1 (operator not contains not defined on interface)`), map[string]*typeInfo{"a": tiInterface()}},
 
 	// macro type literal
 	{`(macro() css)(nil)`, tierr(1, 13, `invalid macro result type css`), map[string]*typeInfo{"css": {Type: reflect.TypeOf(0), Properties: propertyIsType}}},
 	{`(macro() html)(nil)`, tierr(1, 13, `invalid macro result type html`), map[string]*typeInfo{"html": {Type: reflect.TypeOf(definedInt(0)), Properties: propertyIsType}}},
 	{`(macro() markdown)(nil)`, tierr(1, 13, `invalid macro result type markdown`), map[string]*typeInfo{"markdown": {Type: reflect.TypeOf(js("")), Properties: propertyIsType}}},
+	{`(macro() (int, html))(nil)`, tierr(1, 14, `invalid macro result type int`), nil},
+	{`(macro() ([]html, int))(nil)`, tierr(1, 14, `invalid macro result type []html`), nil},
 
-	// slicing of a format type
-	{`a[1:2]`, tierr(1, 5, `invalid operation a[1:2] (slice of compiler.html)`), map[string]*typeInfo{"a": tiHTMLConst("<b>a</b>")}},
-	{`a[1:2]`, tierr(1, 5, `invalid operation a[1:2] (slice of compiler.html)`), map[string]*typeInfo{"a": tiHTML()}},
+	// 3-index slicing of a format type
+	{`a[1:2:3]`, tierr(1, 5, `invalid operation a[1:2:3] (3-index slice of string)`), map[string]*typeInfo{"a": tiHTML()}},
 }
 
 func TestCheckerTemplateExpressionErrors(t *testing.T) {
 	options := checkerOptions{mod: templateMod, formatTypes: formatTypes}
 	for _, expr := range checkerTemplateExprErrors {
-		var lex = scanTemplate([]byte("{{ "+expr.src+" }}"), ast.FormatText, false, false, false)
+		var lex = scanTemplate([]byte("{{ "+expr.src+" }}"), ast.FormatText, false, false, false, false)
 		func() {
 			defer func() {
 				if r := recover(); r != nil {
@@ -371,6 +388,16 @@ var checkerTemplateStmts = []struct {
 		expected: ok,
 	},
 
+	{
+		src:      `{% a := "" %}{% var b bool = a or "b" %}`,
+		expected: ok,
+	},
+
+	{
+		src:      `{% a := "" %}{% var b string = a or "b" %}`,
+		expected: `cannot use a || "b" (type bool) as type string in assignment`,
+	},
+
 	{
 		src:      `{% a := 20 %}{{ 3 and a }}`,
 		expected: ok,
@@ -606,6 +633,94 @@ var checkerTemplateStmts = []struct {
 	{src: `{{ 5 + ( x default 3 ) - 2 }}`, expected: `cannot use default expression in this context`},
 	{src: `{{ -x default 3 }}`, expected: `cannot use default expression in this context`},
 
+	// Nil-safe selector.
+	{src: `{% type T struct{ N int } %}{% var t *T %}{% var n int = t?.N %}`, expected: ok},
+	{src: `{% type N struct{ V string } %}{% type T struct{ N *N } %}{% var t *T %}{% var v string = t?.N?.V %}`, expected: ok},
+	{src: `{% type T struct{ N int } %}{% var t T %}{{ t?.N }}`, expected: `invalid operation: t?.N (?. requires a pointer, map or interface operand, not T)`},
+	{src: `{% var t interface{} %}{% var v interface{} = t?.N?.M %}`, expected: ok},
+	{src: `{% var t interface{} %}{% var v int = t?.N %}`, expected: `cannot use t?.N (type interface {}) as type int in assignment`},
+	{src: `{% var t error %}{{ t?.Error }}`, expected: `invalid operation: t?.Error (?. cannot select method Error)`},
+	{src: `{% var m map[string]int %}{% var n int = m?.N %}`, expected: ok},
+	{src: `{% type K string %}{% var m map[K][]int %}{% var s []int = m?.N %}`, expected: ok},
+	{src: `{% var m map[int]int %}{{ m?.N }}`, expected: `invalid operation: m?.N (?. requires a map with string keys, not map[int]int)`},
+	{src: `{% var m map[string]int %}{% m?.N = 5 %}`, expected: `cannot assign to m?.N`},
+	{src: `{% type T struct{ N int } %}{{ T?.N }}`, expected: `invalid operation: T?.N (?. cannot be used with type T)`},
+	{src: `{{ nil?.N }}`, expected: `use of untyped nil`},
+	{src: `{{ p?.N }}`, expected: `use of package p without selector`},
+	{src: `{% type T struct{ N int } %}{% var t *T %}{{ t?.M }}`, expected: `t?.M undefined (type *T has no field or method M)`},
+	{src: `{% type T struct{ N int } %}{% var t *T %}{{ t?._ }}`, expected: `cannot refer to blank field or method`},
+	{src: `{% type T struct{ N int } %}{% var t *T %}{% t?.N = 5 %}`, expected: `cannot assign to t?.N`},
+	{src: `{% type T struct{ N int } %}{% var t *T %}{% _ = &t?.N %}`, expected: `cannot take the address of t?.N`},
+
+	// Conditional expression.
+	{src: `{% var a int = true ? 1 : 2 %}`, expected: ok},
+	{src: `{% var a float64 = 1 > 2 ? 1 : 2 %}`, expected: ok},
+	{src: `{% b := true %}{% var a float64 = b ? 1 : 2 %}`, expected: `cannot use b ? 1 : 2 (type int) as type float64 in assignment`},
+	{src: `{% b := true %}{% var a = b ? nil : 2 %}`, expected: `cannot use nil as type int in conditional expression`},
+	{src: `{% b := true %}{% var a interface{} = b ? nil : interface{}(2) %}`, expected: ok},
+	{src: `{% var a *int = 1 > 2 ? nil : nil %}`, expected: `use of untyped nil`},
+	{src: `{% s := "a" %}{% var a html = s ? "a" : html("b") %}`, expected: ok},
+	{src: `{% s := "a" %}{% var a = s == "" ? 1 : "b" %}`, expected: `invalid operation: s == "" ? 1 : "b" (mismatched types int and string)`},
+	{src: `{% s := "a" %}{% var a = s == "" ? 1 : s %}`, expected: `cannot use 1 (type untyped int) as type string in conditional expression`},
+	{src: `{% s := "a" %}{% var a = s == "" ? []int{} : s %}`, expected: `invalid operation: s == "" ? []int{} : s (mismatched types []int and string)`},
+	{src: `{% s := "a" %}{% var a = s == "" ? nil : s %}`, expected: `cannot use nil as type string in conditional expression`},
+	{src: `{% var a = nil ? 1 : 2 %}`, expected: `use of untyped nil`},
+	{src: `{% const c = true ? 1 : 2.5 %}`, expected: ok},
+	{src: `{% const c string = false ? 1 : "a" %}`, expected: `invalid operation: false ? 1 : "a" (mismatched types int and string)`},
+	{src: `{% b := true ? 1 : 2.5 %}{% var f float64 = b %}`, expected: ok},
+	{src: `{% c := true %}{% b := c ? 1 : 2.5 %}{% var f float64 = b %}`, expected: ok},
+	{src: `{% const c = true ? 1 : 2.5 %}{% var f float64 = c / 2 %}{% var i int = c %}`, expected: ok},
+	{src: `{% var i int = false ? 1 : 2.5 %}`, expected: `constant 2.5 truncated to integer`},
+	{src: `{% const c = true ? int8(1) : 300 %}`, expected: `constant 300 overflows int8 in conditional expression`},
+	{src: `{% s := "a" %}{% const c = s == "" ? 1 : 2 %}`, expected: `const initializer s == "" ? 1 : 2 is not a constant`},
+
+	// Integer ranges.
+	{src: `{% for i in 1..10 %}{% var _ int = i %}{% end %}`, expected: ok},
+	{src: `{% n := 5 %}{% for i in 0..n-1 %}{% var _ int = i %}{% end %}`, expected: ok},
+	{src: `{% n := int8(5) %}{% for i in 1..n %}{% var _ int8 = i %}{% end %}`, expected: ok},
+	{src: `{% n := uint(5) %}{% for i in n..10 %}{% var _ uint = i %}{% end %}`, expected: ok},
+	{src: `{% for i in 1.0..3 %}{% var _ int = i %}{% end %}`, expected: ok},
+	{src: `{%% for i in 1..3 { var _ int = i } %%}`, expected: ok},
+	{src: `{% for i in 1..3 %}{% else %}{% end %}`, expected: ok},
+	{src: `{% for i in 1.5..3 %}{% end %}`, expected: `constant 1.5 truncated to integer`},
+	{src: `{% for i in 1.."a" %}{% end %}`, expected: `non-integer range bound "a"`},
+	{src: `{% f := 2.0 %}{% for i in 1..f %}{% end %}`, expected: `non-integer range bound f`},
+	{src: `{% for i in nil..3 %}{% end %}`, expected: `non-integer range bound nil`},
+	{src: `{% n := int8(5) %}{% for i in 1..n %}{% var _ int = i %}{% end %}`, expected: `cannot use i (type int8) as type int in assignment`},
+	{src: `{% a, b := 1, int8(2) %}{% for i in a..b %}{% end %}`, expected: `invalid range a..b (mismatched types int and int8)`},
+	{src: `{% n := int8(5) %}{% for i in 1..300 %}{% _ = i + n %}{% end %}`, expected: `invalid operation: i + n (mismatched types int and int8)`},
+	{src: `{% n := int8(5) %}{% for i in n..300 %}{% end %}`, expected: `constant 300 overflows int8`},
+
+	// Parallel for.
+	{src: `{% for parallel v in []int{1, 2} %}{% var _ int = v %}{% end %}`, expected: ok},
+	{src: `{% a := [2]string{} %}{% for parallel v in &a %}{% var _ string = v %}{% end %}`, expected: ok},
+	{src: `{% for parallel v in []int{1, 2} %}{% s := v %}{% s = 2 %}{{ s }}{% else %}{% end %}`, expected: ok},
+	{src: `{% n := 0 %}{% for parallel v in []int{1, 2} %}{{ n + v }}{% end %}`, expected: ok},
+	{src: `{% for parallel v in []int{1, 2} %}{% v = 3 %}{% end %}`, expected: ok},
+	{src: `{% for parallel _ in []int{1, 2} %}{% _ = 5 %}{% end %}`, expected: ok},
+	{src: `{% n := 0 %}{% for parallel v in []int{1, 2} %}{% n = v %}{% end %}`, expected: `cannot assign to n in parallel for (n is declared outside the loop)`},
+	{src: `{% s := []int{0} %}{% for parallel v in []int{1, 2} %}{% s[0] += v %}{% end %}`, expected: `cannot assign to s[0] in parallel for (s is declared outside the loop)`},
+	{src: `{% for parallel v in []int{1, 2} %}{% break %}{% end %}`, expected: `break is not in a loop, switch, or select`},
+	{src: `{% for parallel v in "ab" %}{% end %}`, expected: `cannot range in parallel over "ab" (type string)`},
+	{src: `{% for parallel v in 1..3 %}{% end %}`, expected: `cannot range in parallel over 1..3`},
+	{src: `{% for parallel v in []int{1, 2} %}{% n := 0 %}{% f := func() { n += v } %}{% f() %}{{ n }}{% end %}`, expected: ok},
+	{src: `{% for parallel v in []int{1, 2} %}{% func() { v++ }() %}{% end %}`, expected: ok},
+	{src: `{% for parallel v in []int{1, 2} %}{{ string(rune(v)) }}{{ len("a") }}{% end %}`, expected: ok},
+	{src: `{% n := 0 %}{% for parallel v in []int{1, 2} %}{% _ = func() { n = v } %}{% end %}`, expected: `cannot assign to n in parallel for (n is declared outside the loop)`},
+	{src: `{% n := 0 %}{% f := func() { n++ } %}{% for parallel v in []int{1, 2} %}{% f() %}{% end %}`, expected: `cannot use f in parallel for (f is declared outside the loop)`},
+	{src: `{% n := 0 %}{% f := func() { n++ } %}{% for parallel v in []int{1, 2} %}{% g := f %}{% g() %}{% end %}`, expected: `cannot use f in parallel for (f is declared outside the loop)`},
+	{src: `{% fs := []func(){} %}{% for parallel v in []int{1, 2} %}{% fs[0]() %}{% end %}`, expected: `cannot use fs[0] in parallel for (it may be a function declared outside the loop)`},
+	{src: `{% macro M %}{% end %}{% for parallel v in []int{1, 2} %}{{ M() }}{% end %}`, expected: `cannot use M in parallel for (M is declared outside the loop)`},
+	{src: `{% m := map[int]int{} %}{% for parallel v in []int{1, 2} %}{% mm := m %}{% mm[v] = v %}{% end %}`, expected: `cannot assign to mm[v] in parallel for (it may be shared by the iterations)`},
+	{src: `{% s := []int{0} %}{% for parallel v in []int{1, 2} %}{% t := s %}{% t[0]++ %}{% end %}`, expected: `cannot assign to t[0] in parallel for (it may be shared by the iterations)`},
+	{src: `{% n := 0 %}{% for parallel v in []int{1, 2} %}{% p := &n %}{% *p = v %}{% end %}`, expected: `cannot assign to *p in parallel for (it may be shared by the iterations)`},
+	{src: `{% type T struct{ X int } %}{% t := &T{} %}{% for parallel v in []int{1, 2} %}{% p := t %}{% p.X = v %}{% end %}`, expected: `cannot assign to p.X in parallel for (it may be shared by the iterations)`},
+	{src: `{% type T struct{ X int } %}{% type U struct{ *T } %}{% u := U{&T{}} %}{% for parallel v in []int{1, 2} %}{% w := u %}{% w.X = v %}{% end %}`, expected: `cannot assign to w.X in parallel for (it may be shared by the iterations)`},
+	{src: `{% type T struct{ X [2]int } %}{% for parallel v in []int{1, 2} %}{% var t T %}{% t.X[0] = v %}{{ t.X[0] }}{% end %}`, expected: ok},
+	{src: `{% m := map[int]int{} %}{% for parallel v in []int{1, 2} %}{% delete(m, v) %}{% end %}`, expected: `cannot use delete in parallel for (it may write to values shared by the iterations)`},
+	{src: `{% s := make([]int, 0, 2) %}{% for parallel v in []int{1, 2} %}{% t := append(s, v) %}{{ t[0] }}{% end %}`, expected: `cannot use append in parallel for (it may write to values shared by the iterations)`},
+	{src: `{% s := []int{0} %}{% for parallel v in []int{1, 2} %}{% copy(s, []int{v}) %}{% end %}`, expected: `cannot use copy in parallel for (it may write to values shared by the iterations)`},
+
 	// Labels.
 	{src: `{% L: for %}{% break L %}{% end %}`, expected: ok},
 	//{src: `{% L: for %}{% continue L %}{% end %}`, expected: ok}, TODO: panic "panic: TODO(Gianluca): not implemented"
@@ -623,6 +738,7 @@ func TestCheckerTemplatesStatements(t *testing.T) {
 		Declarations: native.Declarations{},
 	}
 	options := Options{
+		AllowGoStmt: true,
 		FormatTypes: formatTypes,
 		Globals: native.Declarations{
 			"p":  p,
@@ -653,6 +769,140 @@ func TestCheckerTemplatesStatements(t *testing.T) {
 	}
 }
 
+func TestCheckerTemplatesUnusedMacros(t *testing.T) {
+	macros := `{% macro A %}a{% end %}{% macro B %}{{ c() }}{% end %}{% macro c %}c{% end %}`
+	tests := []struct {
+		files    fstest.Files
+		expected string
+	}{
+		{fstest.Files{"index.html": `{% import "macros.html" %}{{ A() }}{{ B() }}`}, ok},
+		{fstest.Files{"index.html": `{% import m "macros.html" %}{{ m.A() }}{{ m.B() }}`}, ok},
+		{fstest.Files{"index.html": `{% import "macros.html" for A, B %}{% show A(), B() %}`}, ok},
+		{fstest.Files{"index.html": `{% import "macros.html" %}{{ A() }}{{ render "partial.html" }}`, "partial.html": `{% import "macros.html" %}{{ B() }}`}, ok},
+		{fstest.Files{"index.html": `{% import "macros.html" %}{% _, _ = A, B %}`}, ok},
+		{fstest.Files{"index.html": `{% import "macros.html" %}{{ A() }}`}, `macros.html:1:33: macro B declared and not used`},
+		{fstest.Files{"index.html": `{% import m "macros.html" %}{{ m.B() }}`}, `macros.html:1:10: macro A declared and not used`},
+		{fstest.Files{"index.html": `{% import "macros.html" %}{% import "other.html" %}{{ A() }}{{ B() }}`, "other.html": `{% macro D %}{% end %}`}, `other.html:1:10: macro D declared and not used`},
+		{fstest.Files{"index.html": `{% extends "layout.html" %}{% macro Title %}{% end %}{% macro Body %}{% end %}`, "layout.html": `{{ Body() }}`}, `index.html:1:37: macro Title declared and not used`},
+		{fstest.Files{"index.html": `{% extends "layout.html" %}{% macro Body %}{% end %}`, "layout.html": `{{ Body() }}`}, ok},
+	}
+	for _, test := range tests {
+		test.files["macros.html"] = macros
+		t.Run(test.files["index.html"], func(t *testing.T) {
+			_, err := BuildTemplate(test.files, "index.html", Options{FormatTypes: formatTypes, CheckUnusedMacros: true})
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %q", err)
+			case test.expected != "" && err == nil:
+				t.Fatalf("expecting error %q, got nothing", test.expected)
+			case test.expected != "" && err != nil && err.Error() != test.expected:
+				t.Fatalf("expecting error %q, got %q", test.expected, err.Error())
+			}
+			if test.expected != "" {
+				// Without the option, the unused macros are not reported.
+				_, err = BuildTemplate(test.files, "index.html", Options{FormatTypes: formatTypes})
+				if err != nil {
+					t.Fatalf("unexpected error without the option: %q", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckerTemplatesOrDefault(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{% a := "" %}{% var b string = a or "b" %}`, ok},
+		{`{% a := "" %}{% var b bool = a or "b" %}`, `index.html:1:32: cannot use a or "b" (type string) as type bool in assignment`},
+		{`{% a := 20 %}{% var b bool = a or "b" %}`, ok},
+		{`{% a := 20 %}{% var b int = a or 3.5 %}`, `index.html:1:31: cannot use a || 3.5 (type bool) as type int in assignment`},
+		{`{% a := true %}{% var b bool = a or 0 %}`, ok},
+		{`{% var b int = 0 or 3 %}`, `index.html:1:18: cannot use 0 or 3 (type untyped bool) as type int in assignment`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			fsys := fstest.Files{"index.html": test.src}
+			_, err := BuildTemplate(fsys, "index.html", Options{FormatTypes: formatTypes, OrDefault: true})
+			switch {
+			case test.expected == "" && err != nil:
+				t.Fatalf("unexpected error: %q", err)
+			case test.expected != "" && err == nil:
+				t.Fatalf("expecting error %q, got nothing", test.expected)
+			case test.expected != "" && err != nil && err.Error() != test.expected:
+				t.Fatalf("expecting error %q, got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestCheckerTemplatesDidYouMean(t *testing.T) {
+	macros := `{% macro Button %}{% end %}{% macro Link %}{% end %}`
+	globals := native.Declarations{"price": (*int)(nil), "strings": native.Package{Name: "strings", Declarations: native.Declarations{"ToUpper": strings.ToUpper}}}
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{% userName := "a" %}{{ usrName }}`, `index.html:1:25: undefined: usrName (did you mean userName?)`},
+		{`{{ prise }}`, `index.html:1:4: undefined: prise (did you mean price?)`},
+		{`{% a := 1 %}{{ b }}`, `index.html:1:16: undefined: b`},
+		{`{{ lenght("a") }}`, `index.html:1:4: undefined: lenght`},
+		{`{% a, b := 1, 2 %}{{ ab }}`, `index.html:1:22: undefined: ab`},
+		{`{{ strings.ToUper("a") }}`, `index.html:1:11: undefined: strings.ToUper (did you mean ToUpper?)`},
+		{`{% import m "macros.html" %}{{ m.Buton() }}`, `index.html:1:33: undefined: m.Buton (did you mean Button?)`},
+		{`{% import "macros.html" for Buton %}`, `index.html:1:11: undefined: Buton (did you mean Button?)`},
+		{`{% import "macros.html" for Lnk %}`, `index.html:1:11: undefined: Lnk (did you mean Link?)`},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			files := fstest.Files{"index.html": test.src, "macros.html": macros}
+			_, err := BuildTemplate(files, "index.html", Options{FormatTypes: formatTypes, Globals: globals})
+			if err == nil {
+				t.Fatalf("expecting error %q, got nothing", test.expected)
+			}
+			if err.Error() != test.expected {
+				t.Fatalf("expecting error %q, got %q", test.expected, err.Error())
+			}
+		})
+	}
+}
+
+func TestCheckerTemplatesStrictShows(t *testing.T) {
+	globals := native.Declarations{"v": (*interface{})(nil), "e": (*error)(nil), "s": (*[]interface{})(nil)}
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{{ v }}`, `index.html:1:1: cannot show v (type interface {} must be converted explicitly)`},
+		{`<a href="{{ v }}">`, `index.html:1:10: cannot show v (type interface {} must be converted explicitly)`},
+		{`{{ s[0] }}`, `index.html:1:1: cannot show s[0] (type interface {} must be converted explicitly)`},
+		{`{% show 1, v %}`, `index.html:1:4: cannot show v (type interface {} must be converted explicitly)`},
+		{`{{ v.(string) }}{{ e }}{{ len(s) }}`, ``},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			files := fstest.Files{"index.html": test.src}
+			_, err := BuildTemplate(files, "index.html", Options{FormatTypes: formatTypes, Globals: globals, StrictShows: true})
+			if err == nil {
+				if test.expected != "" {
+					t.Fatalf("expecting error %q, got nothing", test.expected)
+				}
+				return
+			}
+			if err.Error() != test.expected {
+				t.Fatalf("expecting error %q, got %q", test.expected, err.Error())
+			}
+		})
+	}
+	// Without StrictShows, the values are checked at run time.
+	files := fstest.Files{"index.html": `{{ v }}`}
+	_, err := BuildTemplate(files, "index.html", Options{FormatTypes: formatTypes, Globals: globals})
+	if err != nil {
+		t.Fatalf("unexpected error %q", err)
+	}
+}
+
 type S []V
 type V []S
 type L struct {
@@ -452,6 +452,8 @@ var checkerExprs = []struct {
 	{`(*int)(nil)`, tiIntPtr(), nil},
 	{`interface{}(nil)`, &typeInfo{Type: emptyInterfaceType}, nil},
 	{`(func())(nil)`, &typeInfo{Type: reflect.TypeOf((func())(nil))}, nil},
+	{`[4]byte(a)`, &typeInfo{Type: reflect.ArrayOf(4, uint8Type)}, map[string]*typeInfo{"a": tiByteSlice()}},
+	{`(*[4]byte)(a)`, &typeInfo{Type: reflect.PtrTo(reflect.ArrayOf(4, uint8Type))}, map[string]*typeInfo{"a": tiByteSlice()}},
 
 	// append
 	{`append([]byte{})`, tiByteSlice(), nil},
@@ -1063,6 +1065,13 @@ var checkerStmts = map[string]string{
 	`_ = map[string]string{"k1": 2}`:           `cannot use 2 (type untyped int) as type string in map value`,
 	`_ = map[string]string{2: "v1"}`:           `cannot use 2 (type untyped int) as type string in map key`,
 
+	// Conversions of slices to arrays and to array pointers.
+	`_ = [2]int([]int{1, 2})`:     ok,
+	`_ = (*[2]int)([]int{1, 2})`:  ok,
+	`_ = [2]int([]int8{1, 2})`:    `cannot convert []int8{...} (type []int8) to type [2]int`,
+	`_ = (*[2]int)([]int8{1, 2})`: `cannot convert []int8{...} (type []int8) to type *[2]int`,
+	`_ = []int([2]int{1, 2})`:     `cannot convert [2]int{...} (type [2]int) to type []int`,
+
 	// Map keys.
 	`a, ok := map[int]string{}[0]; var _ string = a; var _ bool = ok;`: ok,
 	`a, ok := map[int]string{}[0]; var _ string = a; var _ int = ok;`:  `cannot use ok (type bool) as type int in assignment`,
@@ -1083,6 +1092,42 @@ var checkerStmts = map[string]string{
 	`_ = pointInt{X: 2, X: 2}`:     `duplicate field name in struct literal: X`,
 	`type T struct { F int }; type S struct{ T }; _ = S{F: 2}`: `cannot use promoted field T.F in struct literal of type S`,
 
+	// Elided types in composite literals.
+	`type T struct{ A int }; _ = []*T{{A: 1}, {2}, nil}`:         ok,
+	`type T struct{ A int }; _ = [2]*T{{A: 1}}`:                  ok,
+	`type T struct{ A int }; _ = map[*T]*T{{A: 1}: {A: 2}}`:      ok,
+	`type T struct{ A int }; _ = map[string][]*T{"a": {{A: 1}}}`: ok,
+	`type T struct{ A int }; type P *T; _ = []P{{A: 1}}`:         ok,
+	`_ = []*[]int{{1, 2}}`:                                       ok,
+	`_ = []interface{}{{1}}`:                                     `invalid type for composite literal: interface {}`,
+	`_ = []*int{{1}}`:                                            `invalid type for composite literal: int`,
+	`type T struct{ A int }; _ = []**T{{A: 1}}`:                  `invalid type for composite literal: *T`,
+	`type T struct{ A int }; _ = []*T{{B: 1}}`:                   `unknown field 'B' in struct literal of type T`,
+	`type S struct{}; type T struct{ p *S }; _ = T{p: {}}`:       `missing type in composite literal`,
+	`type S struct{}; type T struct{ p *S }; _ = T{{}}`:          `missing type in composite literal`,
+
+	// Duplicates in composite literals.
+	`_ = []int{0: 1, 1, 1: 2}`:                               `duplicate index in slice literal: 1`,
+	`_ = [3]int{1, 2, 0: 3}`:                                 `duplicate index in array literal: 0`,
+	`_ = [...]int{5: 1, 2, 6: 3}`:                            `duplicate index in array literal: 6`,
+	`_ = []int{1, 2, 3}`:                                     ok,
+	`_ = []int{2: 1, 0: 2, 3}`:                               ok,
+	`_ = [][]int{{0: 1, 0: 2}}`:                              `duplicate index in slice literal: 0`,
+	`_ = [][2]int{{}, {1, 1: 2}}`:                            ok,
+	`_ = map[string][]int{"a": {1, 0: 2}}`:                   `duplicate index in slice literal: 0`,
+	`_ = map[interface{}]int{1: 1, 1: 2}`:                    `duplicate key 1 in map literal`,
+	`_ = map[interface{}]int{1: 1, 1.0: 2, "1": 3}`:          ok,
+	`_ = map[interface{}]int{int8(1): 1, 1: 2, uint8(1): 3}`: ok,
+	`_ = map[interface{}]int{int8(1): 1, int8(1): 2}`:        `duplicate key int8(1) in map literal`,
+	`_ = map[int8]int{1: 1, 1 + 0: 2}`:                       `duplicate key 1 + 0 in map literal`,
+	`_ = map[bool]int{true: 1, true: 2}`:                     `duplicate key true in map literal`,
+	`_ = map[float64]int{1: 1, 1.0: 2}`:                      `duplicate key 1.0 in map literal`,
+	`_ = map[string]map[string]int{"a": {"b": 1, "b": 2}}`:   `duplicate key "b" in map literal`,
+	`_ = map[[2]int]int{{1, 2}: 1, {1, 2}: 2}`:               ok,
+	`_ = []pointInt{{X: 1, X: 2}}`:                           `duplicate field name in struct literal: X`,
+	`_ = map[pointInt]int{{X: 1}: 1, {X: 1}: 2}`:             ok,
+	`const c = "a"; _ = map[string]int{c: 1, "a": 2}`:        `duplicate key "a" in map literal`,
+
 	// Field selector.
 	`type S struct{F int}; _ = S{}.F`:                                                        ok,
 	`type S *struct{F int}; _ = (*S(nil)).F`:                                                 ok,
@@ -1128,11 +1173,29 @@ var checkerStmts = map[string]string{
 	`x := Mei(nil); _ = x.N`:          `x.N undefined (type compiler.Mei has no field or method N)`,
 	`v := Mei(nil); x := &v; _ = x.M`: `undefined (type *compiler.Mei has no field or method M)`,
 
+	// Method sets of addressable and non-addressable values.
+	`s := []Me{0}; _ = s[0].Mp`:               ok,
+	`a := [1]Me{}; _ = a[0].Mp`:               ok,
+	`m := map[int]Me{}; _ = m[0].Mv`:          ok,
+	`m := map[int]Me{}; _ = m[0].Mp`:          `cannot call pointer method Mp on compiler.Me`,
+	`_ = Me(0).Mp`:                            `cannot call pointer method Mp on compiler.Me`,
+	`f := func() Me { return 0 }; _ = f().Mp`: `cannot call pointer method Mp on compiler.Me`,
+	`f := func() Me { return 0 }; f().Mp()`:   `cannot call pointer method Mp on compiler.Me`,
+
 	// Interfaces.
 	`_ = interface{}(0)`:                ok,
 	`_ = []interface{}{}`:               ok,
 	`_ = map[interface{}]interface{}{}`: ok,
 
+	// Predeclared identifiers 'any' and 'comparable'.
+	`var a any = 5; _ = a.(int)`:            ok,
+	`var a []any = []interface{}{1}; _ = a`: ok,
+	`_ = struct{ any }{any: 1}`:             ok,
+	`any := 3; _ = any`:                     ok,
+	`var a comparable; _ = a`:               `cannot use type comparable outside a type constraint: interface is (or embeds) comparable`,
+	`_ = []comparable{}`:                    `cannot use type comparable outside a type constraint: interface is (or embeds) comparable`,
+	`comparable := 3; _ = comparable`:       ok,
+
 	// nil comparison
 	`_ = true == nil`: `cannot convert nil to type bool`,
 	`_ = 1 == nil`:    `cannot convert nil to type int`,
@@ -1287,6 +1350,23 @@ var checkerStmts = map[string]string{
 	`v := interface{}(3); switch x := v.(type) { default: case int: }`:           `x declared but not used`,
 	`v := interface{}(3); switch x := v.(type) { case string: case int: _ = x }`: ok,
 
+	// Type switch guard symbol.
+	`v := interface{}(3); switch x := v.(type) { case nil: _ = x }`:                                                ok,
+	`v := interface{}(3); switch x := v.(type) { case nil: var _ int = x }`:                                        `cannot use x (type interface {}) as type int in assignment`,
+	`v := interface{}(3); switch x := v.(type) { case int, string: var _ int = x }`:                                `cannot use x (type interface {}) as type int in assignment`,
+	`v := interface{}(3); switch x := v.(type) { case int: var _ int = x; case nil, int8: var _ interface{} = x }`: ok,
+	`switch x := interface{}(3); y := x.(type) { case int: _ = y }`:                                                ok,
+	`switch x := interface{}(3); x := x.(type) { case int: var _ int = x }`:                                        ok,
+	`switch x := interface{}(3); x := x.(type) { case string: var _ int = x }`:                                     `cannot use x (type string) as type int in assignment`,
+	`switch x := 3; y := interface{}(x).(type) { }`:                                                                `y declared but not used`,
+	`switch x := 3; interface{}(5).(type) { }`:                                                                     `x declared but not used`,
+	`switch x := interface{}(3); x := interface{}(4).(type) { case int: _ = x }`:                                   `x declared but not used`,
+	`var e error; switch x := e.(type) { case nil, *int: _ = x.Error() }`:                                          `impossible type switch case: e (type error) cannot have dynamic type *int (missing Error method)`,
+	`var e error; switch x := e.(type) { case nil: _ = x.Error() }`:                                                ok,
+	`switch x := interface{}(3).(type) { case int: x := "a"; _ = x }`:                                              `no new variables on left side of :=`,
+	`v := interface{}(3); switch x := v.(type) { case int: x = 2 }`:                                                `x declared but not used`,
+	`v := interface{}(3); switch x := v.(type) { case int: { x := 2; _ = x } }`:                                    `x declared but not used`,
+
 	// Fallthrough
 	`switch 1 { case 1: fallthrough; default: }`:                      ok,
 	`switch 1 { case 1: _ = 5; fallthrough; /* comment */ default: }`: ok,
@@ -2549,3 +2629,32 @@ func sameTypeCheckError(err1, err2 *CheckingError) error {
 	}
 	return nil
 }
+
+// unknownNode is a node that the type checker does not know.
+type unknownNode struct {
+	*ast.Position
+}
+
+// TestCheckerInternalError tests that a panic of the type checker, that is
+// not a checking error, is returned as a checking error at the position of
+// the statement being checked.
+func TestCheckerInternalError(t *testing.T) {
+	compilation := newCompilation(nil)
+	tc := newTypechecker(compilation, "index.html", checkerOptions{mod: templateMod}, nil)
+	nodes := []ast.Node{
+		ast.NewText(p(1, 1, 0, 2), []byte("abc"), ast.Cut{}),
+		unknownNode{p(1, 4, 3, 5)},
+	}
+	_, err := tc.checkNodesError(nodes)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	cerr, ok := err.(*CheckingError)
+	if !ok {
+		t.Fatalf("expected a checking error, got %T", err)
+	}
+	expected := "index.html:1:4: scriggo: internal error: checkNodes not implemented for nodes with type compiler.unknownNode"
+	if cerr.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, cerr.Error())
+	}
+}
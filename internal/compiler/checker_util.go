@@ -8,15 +8,21 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/compiler/types"
+	"github.com/open2b/scriggo/internal/runtime"
 	"github.com/open2b/scriggo/native"
 )
 
 var envType = reflect.TypeOf((*native.Env)(nil)).Elem()
+var constantCheckerType = reflect.TypeOf((*native.ConstantChecker)(nil)).Elem()
+var formatCheckerType = reflect.TypeOf((*native.FormatChecker)(nil)).Elem()
+var numberType = reflect.TypeOf((*native.Number)(nil)).Elem()
 var errTypeConversion = errors.New("failed type conversion")
 
 type nilConversionError struct {
@@ -34,6 +40,81 @@ const (
 	maxUint  = ^uint(0)
 )
 
+// representedBy is like c.representedBy(typ) but it also takes into account
+// the size of the int, uint and uintptr values on the target and, if typ
+// implements native.ConstantChecker, calls its CheckConstant method.
+func (tc *typechecker) representedBy(c constant, typ reflect.Type) (constant, error) {
+	c, err := c.representedBy(typ)
+	if err != nil {
+		return c, err
+	}
+	if tc.opts.intSize == 32 && strconv.IntSize == 64 {
+		switch typ.Kind() {
+		case reflect.Int:
+			_, err = c.representedBy(int32Type)
+		case reflect.Uint, reflect.Uintptr:
+			_, err = c.representedBy(uint32Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("constant %s overflows %s", c, typ)
+		}
+	}
+	if _, ok := typ.(runtime.ScriggoType); !ok && typ.Implements(constantCheckerType) {
+		err = checkConstant(c, typ)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// checkConstant calls the CheckConstant method on the value with type typ,
+// that implements native.ConstantChecker, represented by the constant c.
+func checkConstant(c constant, typ reflect.Type) error {
+	v := reflect.New(typ).Elem()
+	switch k := typ.Kind(); {
+	case k == reflect.Bool:
+		v.SetBool(c.bool())
+	case k == reflect.String:
+		v.SetString(c.string())
+	case reflect.Int <= k && k <= reflect.Int64:
+		v.SetInt(c.int64())
+	case reflect.Uint <= k && k <= reflect.Uintptr:
+		v.SetUint(c.uint64())
+	case k == reflect.Float32 || k == reflect.Float64:
+		v.SetFloat(c.float64())
+	case k == reflect.Complex64 || k == reflect.Complex128:
+		v.SetComplex(c.complex128())
+	default:
+		return nil
+	}
+	return v.Interface().(native.ConstantChecker).CheckConstant()
+}
+
+// checkFormat calls the CheckFormat method on the value of the argument
+// format, if it is a constant and its type typ implements
+// native.FormatChecker, with the types of the arguments args. format and
+// args must have been already checked.
+func (tc *typechecker) checkFormat(format ast.Expression, typ reflect.Type, args []ast.Expression) {
+	if _, ok := typ.(runtime.ScriggoType); ok || typ.Kind() != reflect.String || !typ.Implements(formatCheckerType) {
+		return
+	}
+	ti := tc.compilation.typeInfos[format]
+	if !ti.IsConstant() {
+		return
+	}
+	types := make([]reflect.Type, len(args))
+	for i, arg := range args {
+		types[i] = tc.compilation.typeInfos[arg].Type
+	}
+	v := reflect.New(typ).Elem()
+	v.SetString(ti.Constant.string())
+	err := v.Interface().(native.FormatChecker).CheckFormat(types)
+	if err != nil {
+		panic(tc.errorf(format, "%s", err))
+	}
+}
+
 // isSigned reports whether kind is a signed integer kind.
 func isSigned(kind reflect.Kind) bool {
 	return reflect.Int <= kind && kind <= reflect.Int64
@@ -176,10 +257,10 @@ func (tc *typechecker) convert(ti *typeInfo, expr ast.Expression, t2 reflect.Typ
 			if t2.NumMethod() > 0 {
 				return nil, errTypeConversion
 			}
-			_, err := ti.Constant.representedBy(ti.Type)
+			_, err := tc.representedBy(ti.Constant, ti.Type)
 			return nil, err
 		}
-		return ti.Constant.representedBy(t2)
+		return tc.representedBy(ti.Constant, t2)
 
 	case ti.Type == boolType:
 		// untyped boolean value.
@@ -313,6 +394,9 @@ func newInvalidTypeInAssignment(x *typeInfo, expr ast.Expression, t reflect.Type
 // isAssignableTo reports whether x is assignable to type t.
 // See https://golang.org/ref/spec#Assignability for details.
 func (tc *typechecker) isAssignableTo(x *typeInfo, expr ast.Expression, t reflect.Type) error {
+	if t == numberType && !isNumber(x) {
+		return newInvalidTypeInAssignment(x, expr, t)
+	}
 	if x.Untyped() {
 		_, err := tc.convert(x, expr, t)
 		if err == errNotRepresentable || err == errTypeConversion {
@@ -326,6 +410,19 @@ func (tc *typechecker) isAssignableTo(x *typeInfo, expr ast.Expression, t reflec
 	return nil
 }
 
+// isNumber reports whether x is assignable to the native.Number type, that
+// is x has an integer or floating-point type, or it is native.Number.
+func isNumber(x *typeInfo) bool {
+	if x.Nil() {
+		return false
+	}
+	if x.Type == numberType {
+		return true
+	}
+	k := x.Type.Kind()
+	return reflect.Int <= k && k <= reflect.Float64
+}
+
 // isBlankIdentifier reports whether expr is an identifier representing the
 // blank identifier "_".
 func isBlankIdentifier(expr ast.Expression) bool {
@@ -333,6 +430,57 @@ func isBlankIdentifier(expr ast.Expression) bool {
 	return ok && ident.Name == "_"
 }
 
+// didYouMean returns a suggestion, as " (did you mean userName?)", for the
+// undefined name, if a name in names is similar to it. The similarity is
+// given by the Levenshtein distance, that must be at most a third of the
+// length of name. If there is no similar name, it returns an empty string.
+func didYouMean(name string, names []string) string {
+	max := utf8.RuneCountInString(name) / 3
+	if max == 0 {
+		return ""
+	}
+	var similar string
+	for _, n := range names {
+		if n == name || !isIdentifierName(n) {
+			continue
+		}
+		if d := levenshtein(name, n); d < max || d == max && (similar == "" || n < similar) {
+			similar, max = n, d
+		}
+	}
+	if similar == "" {
+		return ""
+	}
+	return " (did you mean " + similar + "?)"
+}
+
+// levenshtein returns the Levenshtein distance, in runes, between a and b.
+func levenshtein(a, b string) int {
+	r1, r2 := []rune(a), []rune(b)
+	row := make([]int, len(r2)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(r2); j++ {
+			d := prev
+			if r1[i-1] != r2[j-1] {
+				d++
+				if row[j]+1 < d {
+					d = row[j] + 1
+				}
+				if row[j-1]+1 < d {
+					d = row[j-1] + 1
+				}
+			}
+			prev, row[j] = row[j], d
+		}
+	}
+	return row[len(r2)]
+}
+
 // isPeriodImport reports whether the import node has a period as import name.
 func isPeriodImport(impor *ast.Import) bool {
 	return impor.Ident != nil && impor.Ident.Name == "."
@@ -350,6 +498,41 @@ func isComparison(op ast.OperatorType) bool {
 		op == ast.OperatorContains || op == ast.OperatorNotContains
 }
 
+// chainedComparisons returns the comparisons c1 and c2 of the expression
+// 'c1 and c2', as parsed from the chained comparison 'a op1 b op2 c', and
+// true. The right operand of c1 and the left operand of c2 are the same node.
+// If expr is not a chained comparison, it returns false.
+func chainedComparisons(expr *ast.BinaryOperator) (c1, c2 *ast.BinaryOperator, ok bool) {
+	c1, ok = expr.Expr1.(*ast.BinaryOperator)
+	if !ok {
+		return nil, nil, false
+	}
+	right := expr.Expr2
+	for {
+		c2, ok = right.(*ast.BinaryOperator)
+		if !ok {
+			return nil, nil, false
+		}
+		if c2.Op != ast.OperatorExtendedAnd && c2.Op != ast.OperatorAnd {
+			break
+		}
+		right = c2.Expr1
+	}
+	if c1.Expr2 != c2.Expr1 {
+		return nil, nil, false
+	}
+	return c1, c2, true
+}
+
+// isArrayOrSlice reports whether t is a typed array or slice value.
+func isArrayOrSlice(t *typeInfo) bool {
+	if t.Nil() || t.IsType() {
+		return false
+	}
+	k := t.Type.Kind()
+	return k == reflect.Array || k == reflect.Slice
+}
+
 // isComplex reports whether a reflect kind is complex.
 func isComplex(k reflect.Kind) bool {
 	return k == reflect.Complex64 || k == reflect.Complex128
@@ -547,7 +730,13 @@ func (tc *typechecker) typedValue(ti *typeInfo, t reflect.Type) interface{} {
 // errTypeAssertion is called when the type typ does not implement the
 // interface iface. It returns the corresponding compile-time error.
 func (tc *typechecker) errTypeAssertion(typ reflect.Type, iface reflect.Type) error {
-	msg := fmt.Sprintf("impossible type assertion:\n\t%s does not implement %s", typ, iface)
+	return fmt.Errorf("impossible type assertion:\n\t%s does not implement %s%s",
+		typ, iface, tc.notImplementedReason(typ, iface))
+}
+
+// notImplementedReason returns the reason, in parenthesis and preceded by a
+// space, why the type typ does not implement the interface iface.
+func (tc *typechecker) notImplementedReason(typ reflect.Type, iface reflect.Type) string {
 	num := iface.NumMethod()
 	for i := 0; i < num; i++ {
 		mi := iface.Method(i)
@@ -556,9 +745,9 @@ func (tc *typechecker) errTypeAssertion(typ reflect.Type, iface reflect.Type) er
 			ptr := tc.types.PtrTo(typ)
 			_, ok = ptr.MethodByName(mi.Name)
 			if ok {
-				return fmt.Errorf("%s (%s method has pointer receiver)", msg, mi.Name)
+				return fmt.Sprintf(" (%s method has pointer receiver)", mi.Name)
 			}
-			return fmt.Errorf("%s (missing %s method)", msg, mi.Name)
+			return fmt.Sprintf(" (missing %s method)", mi.Name)
 		}
 		numIn := mt.Type.NumIn() - 1
 		numOut := mt.Type.NumOut()
@@ -588,7 +777,7 @@ func (tc *typechecker) errTypeAssertion(typ reflect.Type, iface reflect.Type) er
 			}
 			have = "func(" + have[p:]
 			want := mi.Type.String()
-			return fmt.Errorf("%s (wrong type for %s method)\n\t\thave %s\n\t\twant %s", msg, mi.Name, have, want)
+			return fmt.Sprintf(" (wrong type for %s method)\n\t\thave %s\n\t\twant %s", mi.Name, have, want)
 		}
 	}
 	panic("unexpected")
@@ -641,6 +830,7 @@ func isValidIdentifier(name string, mod checkingMod) bool {
 		"raw",
 		"render",
 		"show",
+		"trans",
 		"using":
 		return mod != templateMod
 	case
@@ -5,8 +5,11 @@
 package compiler
 
 import (
+	"fmt"
+	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/open2b/scriggo/ast"
 )
@@ -66,6 +69,10 @@ type compilation struct {
 	// globalScope is the global scope.
 	globalScope map[string]scopeName
 
+	// enumNames contains, for each enumeration type declared in the template
+	// globals, the function that returns the name of a value of the type.
+	enumNames map[reflect.Type]reflect.Value
+
 	// extendingTrees reports if a tree with a certain path is extending
 	// another file.
 	// This information must be kept here because it becomes lost after
@@ -77,6 +84,41 @@ type compilation struct {
 	// This information must be kept here because it becomes lost after
 	// transforming the tree in case of extends.
 	extendedTrees map[string]bool
+
+	// declaredMacros maps the identifiers of the macros declared in imported
+	// and extending files to the paths of the files. It is only populated if
+	// the unused macros are checked.
+	declaredMacros map[*ast.Identifier]string
+
+	// usedMacros contains the identifiers of the declared macros that have
+	// been used.
+	usedMacros map[*ast.Identifier]bool
+
+	// initOrder contains the package-level variables, in the form
+	// "path:name", in the order in which they are initialized in their
+	// packages. The packages are in the order in which they are checked.
+	initOrder []string
+
+	// nativeRefs contains the native functions, variables and types, in the
+	// form "pkg.name", referenced by the code that will be emitted.
+	nativeRefs map[string]bool
+
+	// disallowedGlobals contains the references to the globals that are
+	// not allowed, in the order in which they are checked.
+	disallowedGlobals []globalReference
+
+	// scheduler, if not nil, is the scheduler of a compilation forked to
+	// check template files concurrently. The package infos, the unique
+	// indexes, the 'itea' names and the render IRs are then shared, through
+	// the scheduler, with the main compilation.
+	scheduler *checkScheduler
+}
+
+// globalReference is a reference to a global.
+type globalReference struct {
+	path string
+	pos  *ast.Position
+	name string
 }
 
 type renderIR struct {
@@ -97,6 +139,9 @@ func newCompilation(globalScope map[string]scopeName) *compilation {
 		globalScope:       globalScope,
 		extendingTrees:    map[string]bool{},
 		extendedTrees:     map[string]bool{},
+		declaredMacros:    map[*ast.Identifier]string{},
+		usedMacros:        map[*ast.Identifier]bool{},
+		nativeRefs:        map[string]bool{},
 	}
 }
 
@@ -106,6 +151,11 @@ func newCompilation(globalScope map[string]scopeName) *compilation {
 // TODO(Gianluca): we should keep an index of the last (or the next) package
 // index, instead of recalculate it every time.
 func (compilation *compilation) UniqueIndex(path string) int {
+	if s := compilation.scheduler; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.main.UniqueIndex(path)
+	}
 	i, ok := compilation.pkgPathToIndex[path]
 	if ok {
 		return i
@@ -123,10 +173,128 @@ func (compilation *compilation) UniqueIndex(path string) int {
 // generateIteaName generates a new name that can be used when transforming the
 // predeclared identifier 'itea'.
 func (compilation *compilation) generateIteaName() string {
+	if s := compilation.scheduler; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.main.generateIteaName()
+	}
 	compilation.currentIteaIndex++
 	return "$itea" + strconv.Itoa(compilation.currentIteaIndex)
 }
 
+// renderIR returns the dummy 'import' node and the dummy macro declaration
+// of the 'render' expressions that render tree, creating them if they do
+// not exist yet. path is the path of the rendered file.
+func (compilation *compilation) renderIR(tree *ast.Tree, path string) renderIR {
+	if s := compilation.scheduler; s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.main.renderIR(tree, path)
+	}
+	stored, ok := compilation.renderImportMacro[tree]
+	if !ok {
+		macroDecl := ast.NewFunc(
+			nil,
+			ast.NewIdentifier(nil, "M"+strconv.Quote(tree.Path)),
+			ast.NewFuncType(nil, true, nil, nil, false), // func()
+			ast.NewBlock(nil, tree.Nodes),
+			false,
+			tree.Format,
+		)
+		// The same 'import' declaration may be shared by different template
+		// files that 'render' the same file. This is the expected and intended
+		// behavior.
+		importt := ast.NewImport(nil, ast.NewIdentifier(nil, "."), "/"+path, nil)
+		importt.Tree = tree
+		importt.Tree.Nodes = []ast.Node{macroDecl}
+		stored.Macro = macroDecl
+		stored.Import = importt
+		compilation.renderImportMacro[tree] = stored
+	}
+	return stored
+}
+
+// fork returns a new compilation, forked from compilation, that checks
+// template files concurrently with other forked compilations. The returned
+// compilation shares with compilation the state that does not change during
+// the type checking of a file.
+func (compilation *compilation) fork(scheduler *checkScheduler) *compilation {
+	fork := newCompilation(compilation.globalScope)
+	fork.enumNames = compilation.enumNames
+	fork.extendingTrees = compilation.extendingTrees
+	fork.extendedTrees = compilation.extendedTrees
+	fork.scheduler = scheduler
+	return fork
+}
+
+// merge merges into compilation the state of the forked compilation fork.
+func (compilation *compilation) merge(fork *compilation) {
+	for path, info := range fork.pkgInfos {
+		compilation.pkgInfos[path] = info
+	}
+	for node, ti := range fork.typeInfos {
+		compilation.typeInfos[node] = ti
+	}
+	for pkg := range fork.alreadySortedPkgs {
+		compilation.alreadySortedPkgs[pkg] = true
+	}
+	for ident := range fork.indirectVars {
+		compilation.indirectVars[ident] = true
+	}
+	for name, uc := range fork.iteaToUsingCheck {
+		if compilation.iteaToUsingCheck == nil {
+			compilation.iteaToUsingCheck = map[string]usingCheck{}
+		}
+		compilation.iteaToUsingCheck[name] = uc
+	}
+	for ident, path := range fork.declaredMacros {
+		compilation.declaredMacros[ident] = path
+	}
+	for ident := range fork.usedMacros {
+		compilation.usedMacros[ident] = true
+	}
+	compilation.initOrder = append(compilation.initOrder, fork.initOrder...)
+	for ref := range fork.nativeRefs {
+		compilation.nativeRefs[ref] = true
+	}
+	compilation.disallowedGlobals = append(compilation.disallowedGlobals, fork.disallowedGlobals...)
+}
+
+// unusedMacro returns an error for the first unused macro, by path and
+// position in the source, among the macros declared in imported and
+// extending files. If all macros are used, it returns nil.
+func (compilation *compilation) unusedMacro() error {
+	var ident *ast.Identifier
+	var path string
+	for decl, p := range compilation.declaredMacros {
+		if compilation.usedMacros[decl] {
+			continue
+		}
+		if ident == nil || p < path || p == path && decl.Start < ident.Start {
+			ident, path = decl, p
+		}
+	}
+	if ident == nil {
+		return nil
+	}
+	return checkError(path, ident, "macro %s declared and not used", ident.Name)
+}
+
+// disallowedGlobalsError returns an error that lists the references to the
+// globals that are not allowed. If there are no such references, it returns
+// nil.
+func (compilation *compilation) disallowedGlobalsError() error {
+	refs := compilation.disallowedGlobals
+	if len(refs) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, ref := range refs {
+		_, _ = fmt.Fprintf(&b, "\n\t%s:%s: %s", ref.path, ref.pos, ref.name)
+	}
+	return checkError(refs[0].path, refs[0].pos, "use of disallowed global %s%s", refs[0].name, b.String())
+}
+
 // finalizeUsingStatements finalizes the 'using' statements neutralizing 'itea'
 // declarations that should not be emitted. It also returns a type checking
 // error if the 'itea' identifier of a 'using' statement is not used.
@@ -139,7 +307,7 @@ func (compilation *compilation) finalizeUsingStatements(tc *typechecker) error {
 	for _, name := range names {
 		uc := compilation.iteaToUsingCheck[name]
 		if !uc.used {
-			return tc.errorf(uc.pos, "predeclared identifier itea not used")
+			return checkError(uc.path, uc.pos, "predeclared identifier itea not used")
 		}
 		if !uc.toBeEmitted {
 			if len(uc.itea.Lhs) != 1 || len(uc.itea.Rhs) != 1 {
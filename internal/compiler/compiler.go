@@ -15,14 +15,21 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"reflect"
+	"sort"
+	"strconv"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler/types"
 	"github.com/open2b/scriggo/internal/runtime"
 	"github.com/open2b/scriggo/native"
 )
@@ -38,7 +45,7 @@ var formatTypeName = [...]string{"string", "html", "css", "js", "json", "markdow
 // As a special case, if the operand is an interface type then its value is
 // compared with the zero of the dynamic type of the interface.
 const (
-	internalOperatorZero = ast.OperatorExtendedNot + iota + 1
+	internalOperatorZero = ast.OperatorTilde + iota + 1
 	internalOperatorNotZero
 )
 
@@ -63,6 +70,28 @@ type Options struct {
 	AllowGoStmt          bool
 	NoParseShortShowStmt bool
 
+	// AllowedGlobals, if not nil, contains the patterns, with the syntax of
+	// path.Match, of the globals that can be used. A declaration of a global
+	// package is matched as package.Name. Used for templates only.
+	AllowedGlobals []string
+
+	// CheckUnusedMacros, when true, reports an error for the macros declared
+	// in imported and extending files that are not used. Used for templates
+	// only.
+	CheckUnusedMacros bool
+
+	// Concurrency is the maximum number of imported template files that are
+	// type checked concurrently. If it is zero or one, they are checked
+	// sequentially. Used for templates only.
+	Concurrency int
+
+	// Debug, when true, records in the StmtDebugInfo field of the functions
+	// the position of the statements, so that the code can be debugged.
+	Debug bool
+
+	// DisabledBuiltins are the names of the builtins that cannot be used.
+	DisabledBuiltins []string
+
 	// DollarIdentifier, when true, keeps the backward compatibility by
 	// supporting the dollar identifier.
 	//
@@ -70,18 +99,91 @@ type Options struct {
 	// future version of Scriggo.
 	DollarIdentifier bool
 
+	// ExecuteMarkdownCodeFences, when true, parses the fenced code blocks of
+	// the Markdown files as the rest of the files, instead of as text. Used
+	// for templates only.
+	ExecuteMarkdownCodeFences bool
+
 	FormatTypes map[ast.Format]reflect.Type
 	Globals     native.Declarations
 
+	// KeepTree, when true, keeps a copy of the parsed tree in the Tree
+	// field of Code. Used for templates only.
+	KeepTree bool
+
+	// IntSize is the size in bits of the int, uint and uintptr values on the
+	// target. It can be 0, 32 or 64. If it is 0, the size on the host is used.
+	IntSize int
+
 	// Importer imports the native packages.
 	Importer native.Importer
 
 	// MDConverter converts a Markdown source code to HTML.
 	MDConverter Converter
 
+	// MaxExpressionDepth, MaxNestingDepth and MaxFileSize, when not zero,
+	// are the maximum depth of the nested expressions, the maximum depth of
+	// the nested statements and the maximum size in bytes of a file. If a
+	// limit is exceeded, a syntax error is returned. Used for templates only.
+	MaxExpressionDepth int
+	MaxNestingDepth    int
+	MaxFileSize        int
+
+	// MaxConstantStringSize, when not zero, is the maximum size in bytes of
+	// a constant string. If a constant string concatenation exceeds it, a
+	// type checking error is returned.
+	MaxConstantStringSize int
+
+	// OrDefault, when true, makes the or operator, when the left operand is
+	// a non-constant value that is not a boolean and the right operand is
+	// assignable to its type, evaluate to the left operand if it is not the
+	// zero value, otherwise to the right operand. Used for templates only.
+	OrDefault bool
+
+	// StrictShows, when true, reports an error if a shown value has the
+	// empty interface type. Used for templates only.
+	StrictShows bool
+
+	// Sanitizers are the functions that convert a value from a format type
+	// to another. Used for templates only.
+	Sanitizers []interface{}
+
+	// ScopeObserver, if not nil, is called for each template file, after it
+	// has been type checked, with its path and the names in scope at its top
+	// level, including the builtins and the globals. If Concurrency is
+	// greater than one, it can be called concurrently. Used for templates
+	// only.
+	ScopeObserver func(path string, names []ScopeName)
+
+	// Warn, if not nil, is called with the warnings of the type checker. A
+	// warning does not stop the compilation. If Concurrency is greater than
+	// one, it can be called concurrently. Used for templates only.
+	Warn func(path string, pos ast.Position, msg string)
+
+	// Sources, if not nil, is filled with the sources of the parsed files,
+	// indexed by path, also if an error occurs. Used for templates only.
+	Sources map[string][]byte
+
+	// Metrics, if not nil, is filled with the metrics of the compilation.
+	Metrics *Metrics
+
+	// Types, if not nil, creates the types of the compiled code. It can be
+	// shared by several compilations so that the same type declarations
+	// produce the same types.
+	Types *types.Types
+
 	TreeTransformer func(*ast.Tree) error
 }
 
+// parserLimits returns the parser limits of the options.
+func (opts Options) parserLimits() parserLimits {
+	return parserLimits{
+		exprDepth: opts.MaxExpressionDepth,
+		nesting:   opts.MaxNestingDepth,
+		fileSize:  opts.MaxFileSize,
+	}
+}
+
 // GoModError represents an error in a go.mod file.
 type GoModError struct {
 	path string
@@ -117,7 +219,14 @@ func (e *GoModError) Position() ast.Position {
 // If a compilation error occurs, it returns a CompilerError error.
 func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 
+	// Check the options.
+	err := checkIntSize(opts.IntSize)
+	if err != nil {
+		return nil, err
+	}
+
 	// Parse the source code.
+	start := time.Now()
 	tree, err := ParseProgram(fsys)
 	if err != nil {
 		return nil, err
@@ -130,17 +239,32 @@ func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 			return nil, err
 		}
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.ParseTime = time.Since(start)
+		opts.Metrics.Nodes = countNodes(tree)
+	}
 
 	// Type check the tree.
+	start = time.Now()
+	if opts.Types == nil {
+		opts.Types = types.NewTypes()
+	}
 	checkerOpts := checkerOptions{
-		mod:         programMod,
-		allowGoStmt: opts.AllowGoStmt,
-		globals:     opts.Globals,
+		mod:                   programMod,
+		allowGoStmt:           opts.AllowGoStmt,
+		disabledBuiltins:      opts.DisabledBuiltins,
+		globals:               opts.Globals,
+		intSize:               opts.IntSize,
+		maxConstantStringSize: opts.MaxConstantStringSize,
+		types:                 opts.Types,
 	}
 	tci, err := typecheck(tree, opts.Importer, checkerOpts)
 	if err != nil {
 		return nil, err
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.CheckTime = time.Since(start)
+	}
 	typeInfos := map[ast.Node]*typeInfo{}
 	for _, pkgInfos := range tci {
 		for node, ti := range pkgInfos.TypeInfos {
@@ -149,10 +273,17 @@ func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 	}
 
 	// Emit the code.
-	code, err := emitProgram(tree.Nodes[0].(*ast.Package), typeInfos, tci["main"].IndirectVars)
+	start = time.Now()
+	code, err := emitProgram(tree.Nodes[0].(*ast.Package), typeInfos, tci["main"].IndirectVars, opts)
 	if err != nil {
 		return nil, err
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.EmitTime = time.Since(start)
+		opts.Metrics.Functions = functionMetrics(code.Main)
+	}
+	code.InitOrder = tci["main"].InitOrder
+	code.NativeRefs = sortedNativeRefs(tci["main"].NativeRefs)
 
 	return code, nil
 }
@@ -160,10 +291,16 @@ func BuildProgram(fsys fs.FS, opts Options) (*Code, error) {
 // BuildScript builds a script.
 // Any error related to the compilation itself is returned as a CompilerError.
 func BuildScript(r io.Reader, opts Options) (*Code, error) {
-	var tree *ast.Tree
+
+	// Check the options.
+	err := checkIntSize(opts.IntSize)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the source code.
-	var err error
+	start := time.Now()
+	var tree *ast.Tree
 	tree, err = ParseScript(r, opts.Importer)
 	if err != nil {
 		return nil, err
@@ -176,17 +313,32 @@ func BuildScript(r io.Reader, opts Options) (*Code, error) {
 			return nil, err
 		}
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.ParseTime = time.Since(start)
+		opts.Metrics.Nodes = countNodes(tree)
+	}
 
 	// Type check the tree.
+	start = time.Now()
+	if opts.Types == nil {
+		opts.Types = types.NewTypes()
+	}
 	checkerOpts := checkerOptions{
-		mod:         scriptMod,
-		allowGoStmt: opts.AllowGoStmt,
-		globals:     opts.Globals,
+		mod:                   scriptMod,
+		allowGoStmt:           opts.AllowGoStmt,
+		disabledBuiltins:      opts.DisabledBuiltins,
+		globals:               opts.Globals,
+		intSize:               opts.IntSize,
+		maxConstantStringSize: opts.MaxConstantStringSize,
+		types:                 opts.Types,
 	}
 	tci, err := typecheck(tree, opts.Importer, checkerOpts)
 	if err != nil {
 		return nil, err
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.CheckTime = time.Since(start)
+	}
 	typeInfos := map[ast.Node]*typeInfo{}
 	for _, pkgInfos := range tci {
 		for node, ti := range pkgInfos.TypeInfos {
@@ -195,9 +347,17 @@ func BuildScript(r io.Reader, opts Options) (*Code, error) {
 	}
 
 	// Emit the code.
-	code, err := emitScript(tree, typeInfos, tci["main"].IndirectVars)
+	start = time.Now()
+	code, err := emitScript(tree, typeInfos, tci["main"].IndirectVars, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Metrics != nil {
+		opts.Metrics.EmitTime = time.Since(start)
+		opts.Metrics.Functions = functionMetrics(code.Main)
+	}
 
-	return code, err
+	return code, nil
 }
 
 // BuildTemplate builds the named template file rooted at the given file
@@ -205,12 +365,41 @@ func BuildScript(r io.Reader, opts Options) (*Code, error) {
 // Format method, otherwise it depends on the extension of the file name.
 // Any error related to the compilation itself is returned as a CompilerError.
 func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
+	return buildTemplate(opts, func() (*ast.Tree, error) {
+		return parseTemplate(fsys, name, opts.NoParseShortShowStmt, opts.DollarIdentifier, opts.ExecuteMarkdownCodeFences, opts.parserLimits(), opts.Sources)
+	})
+}
 
-	var tree *ast.Tree
+// BuildTemplateSource builds the template source src with the given path and
+// format. The source cannot extend, import and render other files.
+// Any error related to the compilation itself is returned as a CompilerError.
+func BuildTemplateSource(src []byte, path string, format ast.Format, opts Options) (*Code, error) {
+	return buildTemplate(opts, func() (*ast.Tree, error) {
+		return parseTemplateSourceOnly(src, path, format, opts.NoParseShortShowStmt, opts.DollarIdentifier, opts.ExecuteMarkdownCodeFences, opts.parserLimits(), opts.Sources)
+	})
+}
+
+// buildTemplate builds a template parsing its tree with parse.
+func buildTemplate(opts Options, parse func() (*ast.Tree, error)) (*Code, error) {
+
+	// Check the options.
+	err := checkIntSize(opts.IntSize)
+	if err != nil {
+		return nil, err
+	}
+	sanitizers, err := sanitizersByType(opts.Sanitizers, opts.FormatTypes)
+	if err != nil {
+		return nil, err
+	}
+	err = checkAllowedGlobals(opts.AllowedGlobals)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the source code.
-	var err error
-	tree, err = ParseTemplate(fsys, name, opts.NoParseShortShowStmt, opts.DollarIdentifier)
+	start := time.Now()
+	var tree *ast.Tree
+	tree, err = parse()
 	if err != nil {
 		return nil, err
 	}
@@ -222,19 +411,48 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 			return nil, err
 		}
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.ParseTime = time.Since(start)
+		opts.Metrics.Nodes = countNodes(tree)
+	}
+
+	// Copy the tree before the type checker changes it.
+	var kept *ast.Tree
+	if opts.KeepTree {
+		kept = astutil.CloneTree(tree)
+	}
 
 	// Type check the tree.
+	start = time.Now()
+	if opts.Types == nil {
+		opts.Types = types.NewTypes()
+	}
 	checkerOpts := checkerOptions{
-		allowGoStmt: opts.AllowGoStmt,
-		formatTypes: opts.FormatTypes,
-		globals:     opts.Globals,
-		mdConverter: opts.MDConverter,
-		mod:         templateMod,
+		allowGoStmt:           opts.AllowGoStmt,
+		allowedGlobals:        opts.AllowedGlobals,
+		checkUnusedMacros:     opts.CheckUnusedMacros,
+		concurrency:           opts.Concurrency,
+		disabledBuiltins:      opts.DisabledBuiltins,
+		formatTypes:           opts.FormatTypes,
+		globals:               opts.Globals,
+		intSize:               opts.IntSize,
+		maxConstantStringSize: opts.MaxConstantStringSize,
+		mdConverter:           opts.MDConverter,
+		mod:                   templateMod,
+		orDefault:             opts.OrDefault,
+		sanitizers:            sanitizers,
+		scopeObserver:         opts.ScopeObserver,
+		strictShows:           opts.StrictShows,
+		types:                 opts.Types,
+		warn:                  opts.Warn,
 	}
 	tci, err := typecheck(tree, opts.Importer, checkerOpts)
 	if err != nil {
 		return nil, err
 	}
+	if opts.Metrics != nil {
+		opts.Metrics.CheckTime = time.Since(start)
+	}
 	typeInfos := map[ast.Node]*typeInfo{}
 	for _, pkgInfos := range tci {
 		for node, ti := range pkgInfos.TypeInfos {
@@ -243,9 +461,96 @@ func BuildTemplate(fsys fs.FS, name string, opts Options) (*Code, error) {
 	}
 
 	// Emit the code.
-	code, err := emitTemplate(tree, typeInfos, tci["main"].IndirectVars, opts.FormatTypes)
+	start = time.Now()
+	code, err := emitTemplate(tree, typeInfos, tci["main"].IndirectVars, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Metrics != nil {
+		opts.Metrics.EmitTime = time.Since(start)
+		opts.Metrics.Functions = functionMetrics(code.Main)
+	}
+	code.Tree = kept
+	code.InitOrder = tci["main"].InitOrder
+	code.NativeRefs = sortedNativeRefs(tci["main"].NativeRefs)
 
-	return code, err
+	return code, nil
+}
+
+// sortedNativeRefs returns the native references refs as a sorted slice.
+func sortedNativeRefs(refs map[string]bool) []string {
+	sorted := make([]string, 0, len(refs))
+	for ref := range refs {
+		sorted = append(sorted, ref)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// checkIntSize checks that size is a valid value for the IntSize option.
+func checkIntSize(size int) error {
+	switch size {
+	case 0, 32:
+		return nil
+	case 64:
+		if strconv.IntSize == 64 {
+			return nil
+		}
+		return errors.New("scriggo: IntSize 64 is not supported on a 32-bit host")
+	}
+	return fmt.Errorf("scriggo: invalid IntSize %d", size)
+}
+
+// checkAllowedGlobals checks that the patterns of the AllowedGlobals option
+// are valid.
+func checkAllowedGlobals(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("scriggo: invalid allowed global pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// sanitizersByType checks the sanitizers and returns them indexed by source
+// and destination type. A sanitizer must be a function with a parameter and a
+// result, both with a format type, and the result type cannot be string.
+func sanitizersByType(sanitizers []interface{}, formatTypes map[ast.Format]reflect.Type) (map[[2]reflect.Type]reflect.Value, error) {
+	if len(sanitizers) == 0 {
+		return nil, nil
+	}
+	isFormatType := func(t reflect.Type) bool {
+		if t == stringType {
+			return true
+		}
+		for _, ft := range formatTypes {
+			if t == ft {
+				return true
+			}
+		}
+		return false
+	}
+	byType := make(map[[2]reflect.Type]reflect.Value, len(sanitizers))
+	for _, s := range sanitizers {
+		fn := reflect.ValueOf(s)
+		t := fn.Type()
+		if t.Kind() != reflect.Func || fn.IsNil() || t.NumIn() != 1 || t.NumOut() != 1 || t.IsVariadic() {
+			return nil, fmt.Errorf("scriggo: invalid sanitizer type %s", t)
+		}
+		in, out := t.In(0), t.Out(0)
+		if !isFormatType(in) || out == stringType || !isFormatType(out) || in == out {
+			return nil, fmt.Errorf("scriggo: invalid sanitizer type %s", t)
+		}
+		if in == formatTypes[ast.FormatMarkdown] && out == formatTypes[ast.FormatHTML] {
+			return nil, fmt.Errorf("scriggo: invalid sanitizer type %s: conversion from markdown to html uses the Markdown converter", t)
+		}
+		key := [2]reflect.Type{in, out}
+		if _, ok := byType[key]; ok {
+			return nil, fmt.Errorf("scriggo: duplicate sanitizer for conversion from %s to %s", in, out)
+		}
+		byType[key] = fn
+	}
+	return byType, nil
 }
 
 // CheckingError records a type checking error with the path and the position
@@ -279,10 +584,13 @@ func (e *CheckingError) Position() ast.Position {
 
 // Global represents a global variable with a package, name, type (only for
 // not predefined globals) and value (only for predefined globals). Value, if
-// present, must be a pointer to the variable value.
+// present, must be a pointer to the variable value. Path is the path of the
+// package or file that declares the variable, only for not predefined
+// globals.
 type Global struct {
 	Pkg   string
 	Name  string
+	Path  string
 	Type  reflect.Type
 	Value reflect.Value
 }
@@ -297,12 +605,22 @@ type Code struct {
 	Main *runtime.Function
 	// TypeOf returns the type of a value, including new types defined in code.
 	TypeOf runtime.TypeOfFunc
+	// Tree is a copy of the parsed tree, if the KeepTree option is true.
+	Tree *ast.Tree
+	// InitOrder contains the package-level variables, in the form
+	// "path:name", in the order in which they are initialized.
+	InitOrder []string
+	// NativeRefs contains the native functions, variables and types, in the
+	// form "pkg.name", referenced by the code. It is sorted.
+	NativeRefs []string
+	// TransTexts contains the texts of the trans statements. It is sorted.
+	TransTexts []string
 }
 
-// emitProgram emits the code for a program given its ast node, the type info
-// and indirect variables. emitProgram returns an emittedPackage  instance
-// with the global variables and the main function.
-func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool) (_ *Code, err error) {
+// emitProgram emits the code for a program given its ast node, the type info,
+// indirect variables and options. emitProgram returns an emittedPackage
+// instance with the global variables and the main function.
+func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, opts Options) (_ *Code, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if e, ok := r.(*LimitExceededError); ok {
@@ -312,7 +630,7 @@ func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirec
 			panic(r)
 		}
 	}()
-	e := newEmitter(typeInfos, nil, indirectVars)
+	e := newEmitter(typeInfos, indirectVars, opts)
 	functions, _, _ := e.emitPackage(pkgMain, false, "main")
 	main, _ := e.fnStore.availableScriggoFn(pkgMain, "main")
 	pkg := &Code{
@@ -325,20 +643,20 @@ func emitProgram(pkgMain *ast.Package, typeInfos map[ast.Node]*typeInfo, indirec
 }
 
 // emitScript emits the code for a script given its tree, the type info and
-// indirect variables. emitScript returns a function that is the entry point
-// of the script and the global variables.
-func emitScript(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool) (_ *Code, err error) {
+// indirect variables and options. emitScript returns a function that is the
+// entry point of the script and the global variables.
+func emitScript(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, opts Options) (_ *Code, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if e, ok := r.(*LimitExceededError); ok {
 				err = e
 				return
 			}
-			panic(err)
+			panic(r)
 		}
 	}()
-	e := newEmitter(typeInfos, nil, indirectVars)
-	e.fb = newBuilder(newFunction("main", "main", reflect.FuncOf(nil, nil, false), tree.Path, tree.Pos()), tree.Path)
+	e := newEmitter(typeInfos, indirectVars, opts)
+	e.fb = newBuilder(newFunction("main", "main", reflect.FuncOf(nil, nil, false), tree.Path, tree.Pos()), tree.Path, e.intSize)
 	e.fb.enterScope()
 	e.emitNodes(tree.Nodes)
 	e.fb.exitScope()
@@ -347,9 +665,9 @@ func emitScript(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars m
 }
 
 // emitTemplate emits the code for a template given its tree, the type info and
-// indirect variables. emitTemplate returns a function that is the entry point
-// of the template and the global variables.
-func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, formatTypes map[ast.Format]reflect.Type) (_ *Code, err error) {
+// indirect variables and options. emitTemplate returns a function that is
+// the entry point of the template and the global variables.
+func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, opts Options) (_ *Code, err error) {
 	// Recover and eventually return a LimitExceededError.
 	defer func() {
 		if r := recover(); r != nil {
@@ -360,17 +678,25 @@ func emitTemplate(tree *ast.Tree, typeInfos map[ast.Node]*typeInfo, indirectVars
 			panic(r)
 		}
 	}()
-	e := newEmitter(typeInfos, formatTypes, indirectVars)
+	e := newEmitter(typeInfos, indirectVars, opts)
 	e.pkg = &ast.Package{}
 	e.isTemplate = true
 	typ := reflect.FuncOf(nil, nil, false)
-	e.fb = newBuilder(newMacro("main", "main", typ, tree.Format, tree.Path, tree.Pos()), tree.Path)
+	e.fb = newBuilder(newMacro("main", "main", typ, tree.Format, tree.Path, tree.Pos()), tree.Path, e.intSize)
 	e.fb.changePath(tree.Path)
 	e.fb.enterScope()
 	e.emitNodes(tree.Nodes)
 	e.fb.exitScope()
 	e.fb.end()
-	return &Code{Main: e.fb.fn, TypeOf: e.types.TypeOf, Globals: e.varStore.getGlobals()}, nil
+	var texts []string
+	if e.transTexts != nil {
+		texts = make([]string, 0, len(e.transTexts))
+		for txt := range e.transTexts {
+			texts = append(texts, txt)
+		}
+		sort.Strings(texts)
+	}
+	return &Code{Main: e.fb.fn, TypeOf: e.types.TypeOf, Globals: e.varStore.getGlobals(), TransTexts: texts}, nil
 }
 
 // isExported reports whether name is exported, according to
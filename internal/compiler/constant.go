@@ -22,6 +22,7 @@ var errNotRepresentable = errors.New("not representable")
 var errInvalidOperation = errors.New("invalid operation")
 var errDivisionByZero = errors.New("division by zero")
 var errComplexDivisionByZero = errors.New("complex division by zero")
+var errConstantStringTooLarge = errors.New("constant string too large")
 
 // constant represents boolean, string, integer, floating point and complex
 // constant values.
@@ -1106,7 +1107,7 @@ func (c1 complexConst) binaryOp(op ast.OperatorType, c2 constant) (constant, err
 		ad, _ := n1.r.binaryOp(op, n2.i)
 		c := complexConst{}
 		c.r, _ = ac.binaryOp(ast.OperatorSubtraction, bd)
-		c.i, _ = bc.binaryOp(ast.OperatorSubtraction, ad)
+		c.i, _ = bc.binaryOp(ast.OperatorAddition, ad)
 		return c, nil
 	case ast.OperatorDivision:
 		if n2.zero() {
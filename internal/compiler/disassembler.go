@@ -165,6 +165,8 @@ func Disassemble(main *runtime.Function, globals []Global, n int) map[string][]b
 }
 
 // DisassembleFunction disassembles the function fn with the given globals.
+// The entries of the position table are disassembled as comments, as in
+// '; main:5:2', before the instructions they refer to.
 //
 // n determines the maximum length, in runes, of the disassembled text in a
 // Text instruction:
@@ -254,8 +256,19 @@ func disassembleFunction(b *bytes.Buffer, globals []Global, fn *runtime.Function
 	b.WriteByte('\n')
 	_, _ = fmt.Fprintf(b, "%s\t; regs(%d,%d,%d,%d)\n", indent,
 		fn.NumReg[intRegister], fn.NumReg[floatRegister], fn.NumReg[stringRegister], fn.NumReg[generalRegister])
+	if n := fn.NumWideReg; n != [4]int16{} {
+		_, _ = fmt.Fprintf(b, "%s\t; wide(%d,%d,%d,%d)\n", indent,
+			n[intRegister], n[floatRegister], n[stringRegister], n[generalRegister])
+	}
 	instrNum := runtime.Addr(len(fn.Body))
+	positions := fn.Positions
 	for addr := runtime.Addr(0); addr < instrNum; addr++ {
+		for len(positions) > 0 && positions[0].Addr <= addr {
+			if entry := positions[0]; entry.Addr == addr {
+				_, _ = fmt.Fprintf(b, "%s\t; %s:%s\n", indent, entry.Path, entry.Position)
+			}
+			positions = positions[1:]
+		}
 		if label, ok := labelOf[runtime.Addr(addr)]; ok {
 			_, _ = fmt.Fprintf(b, "%s%d:", indent, label)
 		}
@@ -278,7 +291,7 @@ func disassembleFunction(b *bytes.Buffer, globals []Global, fn *runtime.Function
 		}
 		switch in.Op {
 		case runtime.OpCallFunc, runtime.OpCallMacro, runtime.OpCallIndirect, runtime.OpCallNative,
-			runtime.OpTailCall, runtime.OpSlice, runtime.OpStringSlice:
+			runtime.OpTailCall, runtime.OpSlice, runtime.OpStringSlice, runtime.OpWide:
 			addr += 1
 		case runtime.OpDefer:
 			addr += 2
@@ -319,6 +332,11 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		k = true
 	}
 	s := operationName[op]
+	// A fused instruction is disassembled as the first of the instructions
+	// it fuses, with the name followed by '+'.
+	if ops, ok := fusedOperations[op]; ok {
+		op = ops[0]
+	}
 	switch op {
 	case runtime.OpAdd, runtime.OpSub, runtime.OpSubInv, runtime.OpMul,
 		runtime.OpDiv, runtime.OpRem, runtime.OpShl, runtime.OpShr:
@@ -336,6 +354,10 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + disassembleOperand(fn, a, reflect.Float64, false)
 		s += " " + disassembleOperand(fn, b, reflect.Float64, k)
 		s += " " + disassembleOperand(fn, c, reflect.Float64, false)
+	case runtime.OpAddComplex, runtime.OpSubComplex, runtime.OpMulComplex, runtime.OpDivComplex:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 	case runtime.OpAnd, runtime.OpAndNot, runtime.OpOr, runtime.OpXor:
 		s += " " + disassembleOperand(fn, a, reflect.Int, false)
 		s += " " + disassembleOperand(fn, b, reflect.Int, k)
@@ -516,6 +538,10 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 		s += " " + disassembleFieldIndex(fn.FieldIndexes[uint8(b)])
 		s += " " + disassembleOperand(fn, c, getKind('c', fn, addr), false)
+	case runtime.OpFieldByName:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.String, true)
+		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 	case runtime.OpGetVar:
 		s += " " + disassembleVarRef(fn, globals, int16(int(a)<<8|int(uint8(b))))
 		s += " " + disassembleOperand(fn, c, getKind('c', fn, addr), false)
@@ -553,6 +579,30 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 			s += " " + packageName(f.Package()) + "." + f.Name()
 			s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 		}
+	case runtime.OpLeadingZeros, runtime.OpOnesCount:
+		kind := reflect.Kind(a)
+		s += " " + kind.String()
+		s += " " + disassembleOperand(fn, b, kind, k)
+		s += " " + disassembleOperand(fn, c, reflect.Int, false)
+	case runtime.OpLoadBigEndian, runtime.OpLoadLittleEndian:
+		kind := reflect.Kind(a)
+		s += " " + kind.String()
+		s += " " + disassembleOperand(fn, b, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, c, kind, false)
+	case runtime.OpRepeat:
+		s += " " + disassembleOperand(fn, a, reflect.String, false)
+		s += " " + disassembleOperand(fn, b, reflect.Int, k)
+		s += " " + disassembleOperand(fn, c, reflect.String, false)
+	case runtime.OpRotateLeft:
+		kind := reflect.Kind(a)
+		s += " " + kind.String()
+		s += " " + disassembleOperand(fn, b, reflect.Int, k)
+		s += " " + disassembleOperand(fn, c, kind, false)
+	case runtime.OpStoreBigEndian, runtime.OpStoreLittleEndian:
+		kind := reflect.Kind(a)
+		s += " " + kind.String()
+		s += " " + disassembleOperand(fn, b, kind, k)
+		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 	case runtime.OpLoad:
 		t, i := decodeValueIndex(a, b)
 		switch t {
@@ -577,6 +627,9 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 	case runtime.OpMakeArray, runtime.OpMakeStruct, runtime.OpNew:
 		s += " " + fn.Types[int(uint(b))].String()
 		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
+	case runtime.OpParallel:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, b, reflect.Interface, false)
 	case runtime.OpMakeChan, runtime.OpMakeMap:
 		s += " " + fn.Types[int(uint(a))].String()
 		s += " " + disassembleOperand(fn, b, reflect.Int, k)
@@ -591,7 +644,7 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 			s += " 0 0"
 		}
 		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
-	case runtime.OpMapIndex:
+	case runtime.OpMapIndex, runtime.OpMapIndexInt, runtime.OpMapIndexString:
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 		s += " " + disassembleOperand(fn, b, getKind('b', fn, addr), k)
 		s += " " + disassembleOperand(fn, c, getKind('c', fn, addr), false)
@@ -621,6 +674,9 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		}
 		s += " " + disassembleOperand(fn, b, kind, false)
 		s += " " + disassembleOperand(fn, c, kind, false)
+	case runtime.OpNegComplex:
+		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
+		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
 	case runtime.OpRange:
 		s += " " + disassembleOperand(fn, a, reflect.Interface, false)
 		s += " " + disassembleOperand(fn, b, reflect.Int, false)
@@ -697,7 +753,7 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + disassembleOperand(fn, fn.Body[addr+1].A, reflect.Int, b&1 != 0)
 		s += " " + disassembleOperand(fn, high, reflect.Int, khigh)
 		s += " " + disassembleOperand(fn, c, reflect.String, false)
-	case runtime.OpText:
+	case runtime.OpText, runtime.OpTrans:
 		if textSize != 0 {
 			i := int(decodeUint16(a, b))
 			s += " " + disassembleText(fn.Text[i], textSize)
@@ -707,6 +763,14 @@ func disassembleInstruction(fn *runtime.Function, globals []Global, addr runtime
 		s += " " + typ.String()
 		s += " " + disassembleOperand(fn, b, reflectToRegisterKind(typ.Kind()), k)
 		s += " " + disassembleOperand(fn, c, reflect.Interface, false)
+	case runtime.OpWide:
+		// Wide is disassembled together with the Move instruction that it
+		// extends, whose operands are 16-bit registers.
+		move := fn.Body[addr+1]
+		label := string("ifsg"[move.A])
+		s += " " + operationName[move.Op]
+		s += " " + label + strconv.Itoa(int(decodeInt16(b, move.B)))
+		s += " " + label + strconv.Itoa(int(decodeInt16(c, move.C)))
 	case runtime.OpZero:
 		if a >= 10 {
 			a -= 10
@@ -982,6 +1046,7 @@ var operationName = [...]string{
 	runtime.OpAdd:        "Add",
 	runtime.OpAddInt:     "Add",
 	runtime.OpAddFloat64: "Add",
+	runtime.OpAddComplex: "Add",
 
 	runtime.OpAddr: "Addr",
 
@@ -1030,13 +1095,18 @@ var operationName = [...]string{
 	runtime.OpDiv:        "Div",
 	runtime.OpDivInt:     "Div",
 	runtime.OpDivFloat64: "Div",
+	runtime.OpDivComplex: "Div",
 
 	runtime.OpField: "Field",
 
+	runtime.OpFieldByName: "FieldByName",
+
 	runtime.OpGetVar: "GetVar",
 
 	runtime.OpGetVarAddr: "GetVarAddr",
 
+	runtime.OpGetVarCallIndirect: "GetVar+",
+
 	runtime.OpGo: "Go",
 
 	runtime.OpGoto: "Goto",
@@ -1046,15 +1116,21 @@ var operationName = [...]string{
 	runtime.OpIfFloat:  "If",
 	runtime.OpIfString: "If",
 
-	runtime.OpIndex:       "Index",
-	runtime.OpIndexString: "Index",
+	runtime.OpIndex:            "Index",
+	runtime.OpIndexString:      "Index",
+	runtime.OpIndexStringIfInt: "Index+",
 
 	runtime.OpIndexRef: "IndexRef",
 
+	runtime.OpLeadingZeros: "LeadingZeros",
+
 	runtime.OpLen: "Len",
 
 	runtime.OpLoad: "Load",
 
+	runtime.OpLoadBigEndian:    "LoadBigEndian",
+	runtime.OpLoadLittleEndian: "LoadLittleEndian",
+
 	runtime.OpLoadFunc: "LoadFunc",
 
 	runtime.OpMakeArray: "MakeArray",
@@ -1067,24 +1143,33 @@ var operationName = [...]string{
 
 	runtime.OpMakeStruct: "MakeStruct",
 
-	runtime.OpMapIndex: "MapIndex",
+	runtime.OpMapIndex:       "MapIndex",
+	runtime.OpMapIndexInt:    "MapIndex",
+	runtime.OpMapIndexString: "MapIndex",
 
 	runtime.OpMethodValue: "MethodValue",
 
-	runtime.OpMove: "Move",
+	runtime.OpMove:       "Move",
+	runtime.OpMoveAddInt: "Move+",
 
 	runtime.OpMul:        "Mul",
 	runtime.OpMulInt:     "Mul",
 	runtime.OpMulFloat64: "Mul",
+	runtime.OpMulComplex: "Mul",
 
-	runtime.OpNeg: "Neg",
+	runtime.OpNeg:        "Neg",
+	runtime.OpNegComplex: "Neg",
 
 	runtime.OpNew: "New",
 
+	runtime.OpOnesCount: "OnesCount",
+
 	runtime.OpOr: "Or",
 
 	runtime.OpPanic: "Panic",
 
+	runtime.OpParallel: "Parallel",
+
 	runtime.OpPrint: "Print",
 
 	runtime.OpRange: "Range",
@@ -1100,8 +1185,12 @@ var operationName = [...]string{
 	runtime.OpRem:    "Rem",
 	runtime.OpRemInt: "Rem",
 
+	runtime.OpRepeat: "Repeat",
+
 	runtime.OpReturn: "Return",
 
+	runtime.OpRotateLeft: "RotateLeft",
+
 	runtime.OpSelect: "Select",
 
 	runtime.OpSend: "Send",
@@ -1124,11 +1213,15 @@ var operationName = [...]string{
 
 	runtime.OpSlice: "Slice",
 
+	runtime.OpStoreBigEndian:    "StoreBigEndian",
+	runtime.OpStoreLittleEndian: "StoreLittleEndian",
+
 	runtime.OpStringSlice: "Slice",
 
 	runtime.OpSub:        "Sub",
 	runtime.OpSubInt:     "Sub",
 	runtime.OpSubFloat64: "Sub",
+	runtime.OpSubComplex: "Sub",
 
 	runtime.OpSubInv:        "SubInv",
 	runtime.OpSubInvInt:     "SubInv",
@@ -1138,8 +1231,12 @@ var operationName = [...]string{
 
 	runtime.OpText: "Text",
 
+	runtime.OpTrans: "Trans",
+
 	runtime.OpTypify: "Typify",
 
+	runtime.OpWide: "Wide",
+
 	runtime.OpXor: "Xor",
 
 	runtime.OpZero: "Zero",
@@ -36,6 +36,9 @@ type emitter struct {
 	// isTemplate reports whether the emitter is currently emitting a template.
 	isTemplate bool
 
+	// transTexts contains the texts of the emitted trans statements.
+	transTexts map[string]bool
+
 	// rangeLabels contains the addresses of the current active Range instructions.
 	rangeLabels []label
 
@@ -83,19 +86,36 @@ type emitter struct {
 	// alreadyInitializedTemplatePkgs keeps track of the template packages for
 	// which the initialization code has already been emitted.
 	alreadyInitializedTemplatePkgs map[string]bool
+
+	// intSize is the size in bits of the int, uint and uintptr values on the
+	// target. Zero means the size on the host.
+	intSize int
+
+	// debug reports whether the position of the statements is recorded.
+	debug bool
+
+	// maxConstantStringSize, when not zero, is the maximum size in bytes of
+	// a string constant added to the constant table of a function.
+	maxConstantStringSize int
 }
 
 // newEmitter returns a new emitter with the given type infos, format types,
 // indirect variables and options.
-func newEmitter(typeInfos map[ast.Node]*typeInfo, formatTypes map[ast.Format]reflect.Type, indirectVars map[*ast.Identifier]bool) *emitter {
+func newEmitter(typeInfos map[ast.Node]*typeInfo, indirectVars map[*ast.Identifier]bool, opts Options) *emitter {
 	em := &emitter{
 		labels:                         make(map[*runtime.Function]map[string]label),
 		typeInfos:                      typeInfos,
-		formatTypes:                    formatTypes,
-		types:                          types.NewTypes(), // TODO: this is wrong: the instance should be taken from the type checker.
+		formatTypes:                    opts.FormatTypes,
+		types:                          opts.Types,
 		alreadyEmittedFuncs:            map[*ast.Func]*runtime.Function{},
 		alreadyInitializedVars:         map[*ast.Identifier]int16{},
 		alreadyInitializedTemplatePkgs: map[string]bool{},
+		intSize:                        opts.IntSize,
+		debug:                          opts.Debug,
+		maxConstantStringSize:          opts.MaxConstantStringSize,
+	}
+	if em.types == nil {
+		em.types = types.NewTypes()
 	}
 	em.fnStore = newFunctionStore(em)
 	em.varStore = newVarStore(em, indirectVars)
@@ -131,10 +151,27 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 	// List of all "init" functions in current package.
 	inits := []*runtime.Function{}
 
+	// Package level functions.
+	functions := map[string]*runtime.Function{}
+
+	// Package level variables.
+	vars := map[string]int16{}
+
 	// Emit the imports.
 	for _, decl := range pkg.Declarations {
 		if node, ok := decl.(*ast.Import); ok {
-			pkgInits := em.emitImport(node, false)
+			pkgFuncs, pkgVars, pkgInits := em.emitImport(node, false)
+			// In a multi-level extends chain, forward the functions and the
+			// variables of the file that extends this file, so that they are
+			// available to the files extended by this file.
+			if importsExtendingFile(node) {
+				for name, fn := range pkgFuncs {
+					functions[name] = fn
+				}
+				for name, v := range pkgVars {
+					vars[name] = v
+				}
+			}
 			// Do not add duplicated init functions.
 			for _, pkgInit := range pkgInits {
 				add := true
@@ -151,9 +188,6 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 		}
 	}
 
-	// Package level functions.
-	functions := map[string]*runtime.Function{}
-
 	// initToBuild is the index of the next "init" function to build.
 	initToBuild := len(inits)
 
@@ -188,9 +222,6 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 		}
 	}
 
-	// Package level variables.
-	vars := map[string]int16{}
-
 	// Emit the package variables.
 	var initVarsFn *runtime.Function
 	var initVarsFb *functionBuilder
@@ -204,12 +235,19 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 			if initVarsFn == nil {
 				initVarsFn = newFunction("main", "$initvars", reflect.FuncOf(nil, nil, false), path, &ast.Position{})
 				em.fnStore.makeAvailableScriggoFn(em.pkg, "$initvars", initVarsFn)
-				initVarsFb = newBuilder(initVarsFn, path)
+				initVarsFb = newBuilder(initVarsFn, path, em.intSize)
 			}
 			em.fb = initVarsFb
 			addresses := make([]address, len(n.Lhs))
-			pkgVarRegs := map[string]int8{}
-			pkgVarTypes := map[string]reflect.Type{}
+			// pkgVars contains the package variables in the order in which
+			// they are declared, so that the emitted code does not depend on
+			// the map iteration order.
+			type pkgVar struct {
+				reg   int8
+				index int16
+				kind  reflect.Kind
+			}
+			pkgVars := make([]pkgVar, 0, len(n.Lhs))
 			for i, v := range n.Lhs {
 				if isBlankIdentifier(v) {
 					addresses[i] = em.addressBlankIdent(v.Pos())
@@ -225,18 +263,18 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 				varType := em.typ(v)
 				varr := em.fb.newRegister(varType.Kind())
 				addresses[i] = em.addressLocalVar(varr, varType, v.Pos(), 0)
-				// Store the variable register. It will be used later to store
-				// initialized value inside the proper global index.
-				pkgVarRegs[v.Name] = varr
-				pkgVarTypes[v.Name] = varType
-				index := em.varStore.createScriggoPackageVar(em.pkg, newGlobal(pkg.Name, v.Name, varType, reflect.Value{}))
+				global := newGlobal(pkg.Name, v.Name, varType, reflect.Value{})
+				global.Path = path
+				index := em.varStore.createScriggoPackageVar(em.pkg, global)
 				em.alreadyInitializedVars[v] = index
 				vars[v.Name] = index
+				// Store the variable register. It will be used later to store
+				// initialized value inside the proper global index.
+				pkgVars = append(pkgVars, pkgVar{reg: varr, index: index, kind: varType.Kind()})
 			}
 			em.assignValuesToAddresses(addresses, n.Rhs)
-			for name, reg := range pkgVarRegs {
-				index := vars[name]
-				em.fb.emitSetVar(false, reg, int(index), pkgVarTypes[name].Kind())
+			for _, v := range pkgVars {
+				em.fb.emitSetVar(false, v.reg, int(v.index), v.kind)
 			}
 			em.fb = backupFb
 		}
@@ -262,7 +300,7 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 			} else {
 				fn, _ = em.fnStore.availableScriggoFn(em.pkg, n.Ident.Name)
 			}
-			em.fb = newBuilder(fn, path)
+			em.fb = newBuilder(fn, path, em.intSize)
 			em.fb.enterScope()
 			// If this is the main function, functions that initialize variables
 			// must be called before executing every other statement of the main
@@ -303,6 +341,24 @@ func (em *emitter) emitPackage(pkg *ast.Package, extendingFile bool, path string
 
 }
 
+// importsExtendingFile reports whether the import node is the import, added
+// by the type checker, of a template file that extends the importing file.
+func importsExtendingFile(node *ast.Import) bool {
+	if node.Tree == nil {
+		return false
+	}
+	pkg, ok := node.Tree.Nodes[0].(*ast.Package)
+	if !ok {
+		return false
+	}
+	for _, decl := range pkg.Declarations {
+		if _, ok := decl.(*ast.Extends); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // callOptions holds information about a function call.
 type callOptions struct {
 	predefined    bool
@@ -565,6 +621,13 @@ func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toF
 
 	funTi := em.ti(call.Func)
 
+	// Call of a native function with an intrinsic.
+	if !goStmt && !deferStmt {
+		if in, ok := em.intrinsic(call); ok {
+			return em.emitIntrinsic(call, in)
+		}
+	}
+
 	// Method call on a interface value.
 	if funTi.MethodType == methodCallInterface {
 		rcvrExpr := call.Func.(*ast.Selector).Expr
@@ -640,9 +703,15 @@ func (em *emitter) emitCallNode(call *ast.Call, goStmt bool, deferStmt bool, toF
 		return regs, types
 	}
 
-	// Scriggo-defined function (identifier).
-	if ident, ok := call.Func.(*ast.Identifier); ok && !em.fb.declaredInFunc(ident.Name) {
-		if fn, ok := em.fnStore.availableScriggoFn(em.pkg, ident.Name); ok {
+	// Scriggo-defined function (identifier or instance of a generic function).
+	var name string
+	if inst, ok := funTi.value.(instanceName); ok {
+		name = string(inst)
+	} else if ident, ok := call.Func.(*ast.Identifier); ok && !em.fb.declaredInFunc(ident.Name) {
+		name = ident.Name
+	}
+	if name != "" {
+		if fn, ok := em.fnStore.availableScriggoFn(em.pkg, name); ok {
 			stackShift := em.fb.currentStackShift()
 			regs, types := em.prepareCallParameters(fn.Type, call.Args, callOptions{callHasDots: call.IsVariadic})
 			index := em.fnStore.scriggoFnIndex(fn)
@@ -749,7 +818,7 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		}
 		// TODO(Gianluca): if len(appendArgs) > 255 split in blocks
 		if len(elems) > 0 {
-			em.fb.emitAppend(elems[0], elems[0]+int8(len(elems)), tmp, sliceType.Elem().Kind())
+			em.fb.emitAppend(elems[0], elems[0]+int8(len(elems)), tmp, sliceType.Elem().Kind(), call.Pos())
 		}
 		em.changeRegister(false, tmp, reg, sliceType, dstType)
 		em.fb.exitStack()
@@ -825,10 +894,10 @@ func (em *emitter) emitBuiltin(call *ast.Call, reg int8, dstType reflect.Type) {
 		switch typ.Kind() {
 		case reflect.Map:
 			if len(args) == 1 {
-				em.fb.emitMakeMap(typ, true, 0, reg)
+				em.fb.emitMakeMap(typ, true, 0, reg, call.Pos())
 			} else {
 				size, kSize := em.emitExprK(args[1], intType)
-				em.fb.emitMakeMap(typ, kSize, size, reg)
+				em.fb.emitMakeMap(typ, kSize, size, reg, call.Pos())
 			}
 		case reflect.Slice:
 			lenExpr := args[1]
@@ -1167,19 +1236,16 @@ func (em *emitter) emitCondition(cond ast.Expression) {
 // emitComplexOperation emits the operation on the given complex numbers putting
 // the result into the given register.
 func (em *emitter) emitComplexOperation(exprType reflect.Type, expr1 ast.Expression, op ast.OperatorType, expr2 ast.Expression, reg int8, dstType reflect.Type) {
-	stackShift := em.fb.currentStackShift()
-	em.fb.enterScope()
-	index := em.fb.complexOperationIndex(op, false)
-	ret := em.fb.newRegister(reflect.Complex128)
-	c1 := em.fb.newRegister(reflect.Complex128)
-	c2 := em.fb.newRegister(reflect.Complex128)
-	em.fb.enterScope()
-	em.emitExprR(expr1, exprType, c1)
-	em.fb.exitScope()
-	em.fb.enterScope()
-	em.emitExprR(expr2, exprType, c2)
-	em.fb.exitScope()
-	em.fb.emitCallNative(index, 0, stackShift, expr1.Pos())
-	em.changeRegister(false, ret, reg, exprType, dstType)
-	em.fb.exitScope()
+	em.fb.enterStack()
+	c1 := em.emitExpr(expr1, exprType)
+	c2 := em.emitExpr(expr2, exprType)
+	if reg != 0 && canEmitDirectly(exprType.Kind(), dstType.Kind()) {
+		em.fb.emitComplexOp(op, c1, c2, reg)
+		em.fb.exitStack()
+		return
+	}
+	tmp := em.fb.newRegister(exprType.Kind())
+	em.fb.emitComplexOp(op, c1, c2, tmp)
+	em.changeRegister(false, tmp, reg, exprType, dstType)
+	em.fb.exitStack()
 }
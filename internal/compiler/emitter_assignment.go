@@ -22,6 +22,7 @@ type address struct {
 	pos           *ast.Position      // position of the addressed element in the source code.
 	operator      ast.AssignmentType // type of the assignment that involves this address.
 	nonLocal      int                // index of non-local vars. Not relevant if the assignment happens locally.
+	wide          int16              // wide register of a local variable. Only relevant if it is stored in a wide register.
 }
 
 // assignmentTarget is the target of an assignment.
@@ -35,6 +36,7 @@ const (
 	// Assign to a variable.
 	assignLocalVar    // local.
 	assignNonLocalVar // non-local.
+	assignWideVar     // local, stored in a wide register.
 
 	// Assign to a map index.
 	assignLocalMapIndex    // local.
@@ -75,6 +77,21 @@ func (em *emitter) addressLocalVar(reg int8, typ reflect.Type, pos *ast.Position
 	}
 }
 
+// addressWideVar returns a new address that addresses the local variable with
+// the given type that is stored in the wide register reg.
+// op is the type of the assignment that involves this address, and pos is the
+// position of the assignment in the source code.
+func (em *emitter) addressWideVar(reg int16, typ reflect.Type, pos *ast.Position, op ast.AssignmentType) address {
+	return address{
+		addressedType: typ,
+		em:            em,
+		operator:      op,
+		pos:           pos,
+		target:        assignWideVar,
+		wide:          reg,
+	}
+}
+
 // addressNonLocalVar returns a new address that addresses the non-local
 // variable with the given type that is indexed by index. op is the type of the
 // assignment that involves this address, and pos is the position of the
@@ -237,6 +254,17 @@ func (a address) assign(k bool, value int8, valueType reflect.Type) {
 		// Nothing to do.
 	case assignLocalVar:
 		a.em.changeRegister(k, value, a.op1, a.targetType(), a.addressedType)
+	case assignWideVar:
+		// A wide register can only be moved from a register.
+		if k || value < 0 {
+			a.em.fb.enterStack()
+			tmp := a.em.fb.newRegister(a.addressedType.Kind())
+			a.em.changeRegister(k, value, tmp, a.targetType(), a.addressedType)
+			a.em.fb.emitWideMove(int16(tmp), a.wide, a.addressedType.Kind())
+			a.em.fb.exitStack()
+		} else {
+			a.em.fb.emitWideMove(int16(value), a.wide, a.addressedType.Kind())
+		}
 	case assignNewIndirectVar:
 		a.em.fb.emitNew(a.addressedType, -a.op1)
 		a.em.changeRegister(k, value, a.op1, a.targetType(), a.addressedType)
@@ -246,17 +274,22 @@ func (a address) assign(k bool, value int8, valueType reflect.Type) {
 		a.em.fb.emitSetSlice(k, a.op1, value, a.op2, a.pos, valueType.Kind())
 	case assignNonLocalSliceIndex:
 		a.em.fb.emitSetSlice(k, a.op1, value, a.op2, a.pos, valueType.Kind())
-		a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
-	case assignLocalMapIndex:
-		a.em.fb.emitSetMap(k, a.op1, value, a.op2, a.addressedType, a.pos)
-	case assignNonLocalMapIndex:
+		// Only an array must be stored back; a slice shares its elements,
+		// and storing it back would undo a preceding assignment to the
+		// variable in a multiple assignment.
+		if a.addressedType.Kind() == reflect.Array {
+			a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
+		}
+	case assignLocalMapIndex, assignNonLocalMapIndex:
 		a.em.fb.emitSetMap(k, a.op1, value, a.op2, a.addressedType, a.pos)
-		a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
 	case assignLocalStructSelector:
 		a.em.fb.emitSetField(k, a.op1, a.op2, value, valueType.Kind())
 	case assignNonLocalStructSelector:
 		a.em.fb.emitSetField(k, a.op1, a.op2, value, valueType.Kind())
-		a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
+		// As for the slices, a pointer to a struct is not stored back.
+		if a.addressedType.Kind() == reflect.Struct {
+			a.em.fb.emitSetVar(false, a.op1, a.nonLocal, a.addressedType.Kind())
+		}
 	}
 }
 
@@ -274,6 +307,8 @@ func (a address) targetType() reflect.Type {
 		return a.addressedType
 	case assignLocalVar:
 		return a.addressedType
+	case assignWideVar:
+		return a.addressedType
 	case assignLocalMapIndex,
 		assignNonLocalMapIndex:
 		return a.addressedType.Elem()
@@ -314,13 +349,15 @@ func (em *emitter) emitAssignmentOperation(addr address, rh ast.Expression) {
 		em.fb.emitGetVar(addr.nonLocal, c, addrTyp.Kind())
 	case assignLocalVar:
 		em.changeRegister(false, addr.op1, c, addrTyp, typ)
+	case assignWideVar:
+		em.fb.emitWideMove(addr.wide, int16(c), addrTyp.Kind())
 	case assignLocalMapIndex,
 		assignLocalSliceIndex,
 		assignNonLocalMapIndex,
 		assignNonLocalSliceIndex:
 		em.fb.emitIndex(false, addr.op1, addr.op2, c, addrTyp, addr.pos, false)
 	case assignPtrIndirection:
-		em.changeRegister(false, addr.op1, c, addrTyp, addrTyp)
+		em.changeRegister(false, -addr.op1, c, typ, typ)
 	case assignLocalStructSelector,
 		assignNonLocalStructSelector:
 		em.fb.emitField(addr.op1, addr.op2, c, typ.Kind())
@@ -335,23 +372,13 @@ func (em *emitter) emitAssignmentOperation(addr address, rh ast.Expression) {
 	// be put back into the left side.
 	if k := typ.Kind(); k == reflect.Complex64 || k == reflect.Complex128 {
 		// Operation on complex numbers.
-		stackShift := em.fb.currentStackShift()
-		em.fb.enterScope()
-		ret := em.fb.newRegister(reflect.Complex128)
-		c1 := em.fb.newRegister(reflect.Complex128)
-		c2 := em.fb.newRegister(reflect.Complex128)
-		em.changeRegister(false, b, c1, typ, typ)
-		em.changeRegister(false, c, c2, typ, typ)
-		index := em.fb.complexOperationIndex(operatorFromAssignmentType(addr.operator), false)
-		em.fb.emitCallNative(index, 0, stackShift, addr.pos)
-		em.changeRegister(false, ret, c, typ, typ)
-		em.fb.exitScope()
+		em.fb.emitComplexOp(operatorFromAssignmentType(addr.operator), c, b, c)
 		addr.assign(false, c, typ)
 	} else {
 		switch addr.operator {
 		case ast.AssignmentAddition:
 			if typ.Kind() == reflect.String {
-				em.fb.emitConcat(c, b, c)
+				em.fb.emitConcat(c, b, c, addr.pos)
 			} else {
 				em.fb.emitAdd(false, c, b, c, typ.Kind())
 			}
@@ -406,6 +433,28 @@ func (em *emitter) assignValuesToAddresses(addresses []address, values []ast.Exp
 	}
 
 	if len(addresses) == len(values) {
+		// Emit the destructured array or slice only once.
+		if index, ok := values[0].(*ast.Index); ok && isDestructuring(values) {
+			if _, isIdent := index.Expr.(*ast.Identifier); !isIdent {
+				expr := index.Expr
+				typ := em.typ(expr)
+				em.fb.enterScope()
+				r := em.fb.newRegister(typ.Kind())
+				em.emitExprR(expr, typ, r)
+				em.fb.bindVarReg("$destructured", r)
+				ident := ast.NewIdentifier(expr.Pos(), "$destructured")
+				em.typeInfos[ident] = &typeInfo{Type: typ}
+				for _, v := range values {
+					v.(*ast.Index).Expr = ident
+				}
+				em.assignValuesToAddresses(addresses, values)
+				for _, v := range values {
+					v.(*ast.Index).Expr = expr
+				}
+				em.fb.exitScope()
+				return
+			}
+		}
 		em.fb.enterStack()
 		regs := make([]int8, len(values))
 		types := make([]reflect.Type, len(values))
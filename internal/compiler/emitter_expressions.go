@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"math"
 	"reflect"
+	"strconv"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/runtime"
@@ -72,7 +73,7 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 		// Expr cannot be emitted as immediate: check if it's possible to emit
 		// it without allocating a new register.
 		if expr, ok := expr.(*ast.Identifier); ok && em.fb.declaredInFunc(expr.Name) {
-			if canEmitDirectly(ti.Type.Kind(), dstType.Kind()) {
+			if _, wide := em.fb.wideScopeLookup(expr.Name); !wide && canEmitDirectly(ti.Type.Kind(), dstType.Kind()) {
 				return em.fb.scopeLookup(expr.Name), false
 			}
 		}
@@ -93,6 +94,16 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 		return reg, false
 	}
 
+	// expr is an instance of a generic function.
+	if ti != nil {
+		if name, ok := ti.value.(instanceName); ok {
+			fun, _ := em.fnStore.availableScriggoFn(em.pkg, string(name))
+			em.fb.emitLoadFunc(false, em.fnStore.scriggoFnIndex(fun), reg)
+			em.changeRegister(false, reg, reg, ti.Type, dstType)
+			return reg, false
+		}
+	}
+
 	switch expr := expr.(type) {
 
 	case *ast.BinaryOperator:
@@ -160,6 +171,11 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 		// emitting expr.IR.Ident.
 		return em._emitExpr(expr.IR.Ident, dstType, reg, useGivenReg, allowK)
 
+	case *ast.Conditional:
+
+		em.emitConditional(expr, reg, dstType)
+		return reg, false
+
 	case *ast.Default:
 		ex := expr.Expr1
 		if ti := em.ti(expr.Expr1); ti == nil {
@@ -220,7 +236,7 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 		em.fb.emitLoadFunc(false, em.fb.addFunction(fn), tmp)
 		em.setFunctionVarRefs(fn, expr.Upvars)
 
-		funcLitBuilder := newBuilder(fn, em.fb.getPath())
+		funcLitBuilder := newBuilder(fn, em.fb.getPath(), em.intSize)
 		currFB := em.fb
 		em.fb = funcLitBuilder
 
@@ -242,6 +258,20 @@ func (em *emitter) _emitExpr(expr ast.Expression, dstType reflect.Type, reg int8
 
 		typ := ti.Type
 
+		// Local variables stored in wide registers.
+		if wide, ok := em.fb.wideScopeLookup(expr.Name); ok {
+			if reg > 0 && canEmitDirectly(typ.Kind(), dstType.Kind()) {
+				em.fb.emitWideMove(wide, int16(reg), typ.Kind())
+				return reg, false
+			}
+			em.fb.enterStack()
+			tmp := em.fb.newRegister(typ.Kind())
+			em.fb.emitWideMove(wide, int16(tmp), typ.Kind())
+			em.changeRegister(false, tmp, reg, typ, dstType)
+			em.fb.exitStack()
+			return reg, false
+		}
+
 		if em.fb.declaredInFunc(expr.Name) {
 			ident := em.fb.scopeLookup(expr.Name)
 			em.changeRegister(false, ident, reg, typ, dstType)
@@ -376,12 +406,57 @@ func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType refl
 		pos  = expr.Pos()
 	)
 
+	// Emit code for the operator 'or' with a non-boolean left operand, type
+	// checked with the orDefault option. The expression evaluates to the
+	// left operand if it is not the zero of its type, otherwise to the right
+	// operand.
+	if op == ast.OperatorExtendedOr {
+		em.fb.enterStack()
+		x := em.fb.newRegister(kind)
+		em.emitExprR(expr.Expr1, typ, x)
+		z := em.fb.newRegister(reflect.Bool)
+		em.fb.emitNotZero(kind, z, x)
+		endIf := em.fb.newLabel()
+		em.fb.emitIf(true, z, runtime.ConditionEqual, 0, reflect.Int, pos)
+		em.fb.emitGoto(endIf)
+		em.emitExprR(expr.Expr2, typ, x)
+		em.fb.setLabelAddr(endIf)
+		em.changeRegister(false, x, reg, typ, regType)
+		em.fb.exitStack()
+		return
+	}
+
 	// Emit code for complex numbers.
 	if kind == reflect.Complex64 || kind == reflect.Complex128 {
 		em.emitComplexOperation(typ, expr.Expr1, op, expr.Expr2, reg, regType)
 		return
 	}
 
+	// Emit code for a chained comparison 'a < b and b < c', evaluating the
+	// shared operand b only once.
+	if op == ast.OperatorAnd {
+		if c1, c2, ok := chainedComparisons(expr); ok {
+			if _, isIdent := c1.Expr2.(*ast.Identifier); !isIdent {
+				b := c1.Expr2
+				bType := em.typ(b)
+				em.fb.enterScope()
+				r := em.fb.newRegister(bType.Kind())
+				em.emitExprR(b, bType, r)
+				// The name depends on the register because, with more than
+				// two comparisons, the 'and' expressions are nested.
+				name := "$chained" + strconv.Itoa(int(r))
+				em.fb.bindVarReg(name, r)
+				ident := ast.NewIdentifier(b.Pos(), name)
+				em.typeInfos[ident] = &typeInfo{Type: bType}
+				c1.Expr2, c2.Expr1 = ident, ident
+				em.emitBinaryOp(expr, reg, regType)
+				c1.Expr2, c2.Expr1 = b, b
+				em.fb.exitScope()
+				return
+			}
+		}
+	}
+
 	// Emit code for the operators && and ||.
 	if op == ast.OperatorAnd || op == ast.OperatorOr {
 		x := reg
@@ -430,12 +505,12 @@ func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType refl
 			y = em.emitExpr(expr.Expr2, t2)
 		}
 		if canEmitDirectly(kind, regType.Kind()) {
-			em.fb.emitConcat(x, y, reg)
+			em.fb.emitConcat(x, y, reg, expr.Pos())
 			return
 		}
 		em.fb.enterStack()
 		tmp := em.fb.newRegister(kind)
-		em.fb.emitConcat(x, y, tmp)
+		em.fb.emitConcat(x, y, tmp, expr.Pos())
 		em.changeRegister(false, tmp, reg, typ, regType)
 		em.fb.exitStack()
 		return
@@ -471,7 +546,7 @@ func (em *emitter) emitBinaryOp(expr *ast.BinaryOperator, reg int8, regType refl
 	if ast.OperatorAddition <= op && op <= ast.OperatorModulo ||
 		op == ast.OperatorLeftShift || op == ast.OperatorRightShift {
 
-		if kind == reflect.Int {
+		if kind == reflect.Int && !em.fb.truncatesInt() {
 			// TODO(gianluca): also add reflect.Float64.
 			z := reg
 			direct := canEmitDirectly(kind, regType.Kind())
@@ -694,12 +769,12 @@ func (em *emitter) emitCompositeLiteral(expr *ast.CompositeLiteral, reg int8, ds
 		tmp := em.fb.newRegister(reflect.Map)
 		size := len(expr.KeyValues)
 		if size <= 127 {
-			em.fb.emitMakeMap(typ, true, int8(size), tmp)
+			em.fb.emitMakeMap(typ, true, int8(size), tmp, expr.Pos())
 		} else {
 			index := em.fb.makeIntValue(int64(size))
 			sizeReg := em.fb.newRegister(reflect.Int)
 			em.fb.emitLoad(index, sizeReg, reflect.Int)
-			em.fb.emitMakeMap(typ, false, sizeReg, tmp)
+			em.fb.emitMakeMap(typ, false, sizeReg, tmp, expr.Pos())
 		}
 		for _, kv := range expr.KeyValues {
 			em.fb.enterStack()
@@ -719,6 +794,12 @@ func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type)
 
 	ti := em.ti(v)
 
+	// Nil-safe selector.
+	if v.NilSafe {
+		em.emitNilSafeSelector(v, reg, dstType)
+		return
+	}
+
 	// Method value on concrete and interface values.
 	if ti.MethodType == methodValueConcrete || ti.MethodType == methodValueInterface {
 		expr := v.Expr
@@ -792,6 +873,128 @@ func (em *emitter) emitSelector(v *ast.Selector, reg int8, dstType reflect.Type)
 
 }
 
+// emitConditional emits the conditional expression expr into register reg
+// of type dstType.
+func (em *emitter) emitConditional(expr *ast.Conditional, reg int8, dstType reflect.Type) {
+	typ := em.typ(expr)
+	elseLabel := em.fb.newLabel()
+	endLabel := em.fb.newLabel()
+	em.fb.enterStack()
+	em.emitCondition(expr.Condition)
+	em.fb.exitStack()
+	em.fb.emitGoto(elseLabel)
+	for i, ex := range [2]ast.Expression{expr.Expr1, expr.Expr2} {
+		if i == 1 {
+			em.fb.emitGoto(endLabel)
+			em.fb.setLabelAddr(elseLabel)
+		}
+		em.fb.enterStack()
+		if typ == dstType {
+			em.emitExprR(ex, dstType, reg)
+		} else {
+			// Emit the expression with the type of the conditional
+			// expression, so that a value with a different type, assignable
+			// to it, is converted before being moved to reg.
+			tmp := em.emitExpr(ex, typ)
+			em.changeRegister(false, tmp, reg, typ, dstType)
+		}
+		em.fb.exitStack()
+	}
+	em.fb.setLabelAddr(endLabel)
+}
+
+// emitNilSafeSelector emits the nil-safe selector v into register reg of
+// type dstType. If the operand of v, or an embedded pointer through which the
+// field is promoted, is nil, it emits the zero value of the field instead of
+// the field.
+func (em *emitter) emitNilSafeSelector(v *ast.Selector, reg int8, dstType reflect.Type) {
+	typ := em.typ(v.Expr)
+	switch typ.Kind() {
+	case reflect.Map:
+		// A nil map has no elements, so indexing it gives the zero value.
+		elem := typ.Elem()
+		em.fb.enterStack()
+		m := em.emitExpr(v.Expr, typ)
+		key := em.fb.makeStringValue(v.Ident)
+		if canEmitDirectly(elem.Kind(), dstType.Kind()) {
+			em.fb.emitIndex(true, m, key, reg, typ, v.Pos(), false)
+		} else {
+			tmp := em.fb.newRegister(elem.Kind())
+			em.fb.emitIndex(true, m, key, tmp, typ, v.Pos(), false)
+			em.changeRegister(false, tmp, reg, elem, dstType)
+		}
+		em.fb.exitStack()
+		return
+	case reflect.Interface:
+		em.fb.enterStack()
+		x := em.emitExpr(v.Expr, typ)
+		if canEmitDirectly(reflect.Interface, dstType.Kind()) {
+			em.fb.emitFieldByName(x, v.Ident, reg)
+		} else {
+			tmp := em.fb.newRegister(reflect.Interface)
+			em.fb.emitFieldByName(x, v.Ident, tmp)
+			em.changeRegister(false, tmp, reg, emptyInterfaceType, dstType)
+		}
+		em.fb.exitStack()
+		return
+	}
+	field, _ := typ.Elem().FieldByName(v.Ident)
+	isNil := em.fb.newLabel()
+	end := em.fb.newLabel()
+	em.fb.enterStack()
+	exprReg := em.emitExpr(v.Expr, typ)
+	em.fb.emitIf(false, exprReg, runtime.ConditionNotNil, 0, reflect.Ptr, v.Pos())
+	em.fb.emitGoto(isNil)
+	// Check the embedded pointers through which the field is promoted.
+	start := 0
+	t := typ.Elem()
+	for i, x := range field.Index[:len(field.Index)-1] {
+		t = t.Field(x).Type
+		if t.Kind() != reflect.Ptr {
+			continue
+		}
+		ptr := em.fb.newRegister(reflect.Ptr)
+		em.fb.emitField(exprReg, em.fb.makeFieldIndex(field.Index[start:i+1]), ptr, reflect.Ptr)
+		em.fb.emitIf(false, ptr, runtime.ConditionNotNil, 0, reflect.Ptr, v.Pos())
+		em.fb.emitGoto(isNil)
+		exprReg = ptr
+		start = i + 1
+		t = t.Elem()
+	}
+	index := em.fb.makeFieldIndex(field.Index[start:])
+	if canEmitDirectly(field.Type.Kind(), dstType.Kind()) {
+		em.fb.emitField(exprReg, index, reg, dstType.Kind())
+	} else {
+		tmp := em.fb.newRegister(field.Type.Kind())
+		em.fb.emitField(exprReg, index, tmp, field.Type.Kind())
+		em.changeRegister(false, tmp, reg, field.Type, dstType)
+	}
+	em.fb.emitGoto(end)
+	em.fb.setLabelAddr(isNil)
+	em.emitZeroValue(field.Type, reg, dstType)
+	em.fb.setLabelAddr(end)
+	em.fb.exitStack()
+}
+
+// emitZeroValue emits the zero value of type typ into register reg of type
+// dstType.
+func (em *emitter) emitZeroValue(typ reflect.Type, reg int8, dstType reflect.Type) {
+	ti := &typeInfo{Type: typ}
+	switch k := typ.Kind(); {
+	case k == reflect.Bool, reflect.Int <= k && k <= reflect.Uintptr:
+		ti.value = int64(0)
+	case k == reflect.Float32, k == reflect.Float64:
+		ti.value = float64(0)
+	case k == reflect.String:
+		ti.value = ""
+	case k == reflect.Interface:
+		// A nil interface value is represented by a nil ti.value.
+	default:
+		ti.value = em.types.Zero(typ).Interface()
+	}
+	em.emitValueNotPredefined(ti, reg, dstType)
+}
+
 // emitUnaryOp emits the code for the unary expression expr and stores the
 // result in the register reg of type regType.
 func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflect.Type) {
@@ -848,25 +1051,6 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 		return
 	}
 
-	// Emit code for the negation of a complex number.
-	if exprKind == reflect.Complex64 || exprKind == reflect.Complex128 {
-		if op != ast.OperatorSubtraction {
-			panic("bug: expected operator subtraction")
-		}
-		stackShift := em.fb.currentStackShift()
-		em.fb.enterScope()
-		index := em.fb.complexOperationIndex(ast.OperatorSubtraction, true)
-		src := em.fb.newRegister(reflect.Complex128)
-		arg := em.fb.newRegister(reflect.Complex128)
-		em.fb.enterScope()
-		em.emitExprR(operand, exprType, arg)
-		em.fb.exitScope()
-		em.fb.emitCallNative(index, 0, stackShift, expr.Pos())
-		em.changeRegister(false, src, reg, exprType, regType)
-		em.fb.exitScope()
-		return
-	}
-
 	// Emit code for the other operand types.
 	switch op {
 
@@ -1007,7 +1191,15 @@ func (em *emitter) emitUnaryOp(expr *ast.UnaryOperator, reg int8, regType reflec
 		}
 		em.fb.enterScope()
 		y := em.emitExpr(operand, operandType)
-		if canEmitDirectly(operandKind, regType.Kind()) {
+		if operandKind == reflect.Complex64 || operandKind == reflect.Complex128 {
+			if canEmitDirectly(operandKind, regType.Kind()) {
+				em.fb.emitNegComplex(y, reg)
+			} else {
+				z := em.fb.newRegister(operandKind)
+				em.fb.emitNegComplex(y, z)
+				em.changeRegister(false, z, reg, operandType, regType)
+			}
+		} else if canEmitDirectly(operandKind, regType.Kind()) {
 			em.fb.emitNeg(y, reg, regType.Kind())
 		} else {
 			z := em.fb.newRegister(operandKind)
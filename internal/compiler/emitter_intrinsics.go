@@ -0,0 +1,226 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"reflect"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/open2b/scriggo/ast"
+)
+
+// intrinsicOp is the operation of an intrinsic.
+type intrinsicOp int8
+
+const (
+	intrinsicLeadingZeros intrinsicOp = iota + 1 // bits.LeadingZeros
+	intrinsicOnesCount                           // bits.OnesCount
+	intrinsicRotateLeft                          // bits.RotateLeft
+	intrinsicLoadUint                            // binary.ByteOrder.Uint
+	intrinsicStoreUint                           // binary.ByteOrder.PutUint
+	intrinsicRepeat                              // builtin.Repeat
+)
+
+// intrinsic is a native function whose calls are emitted as a dedicated
+// instruction instead of a call.
+type intrinsic struct {
+	op           intrinsicOp
+	kind         reflect.Kind // kind of the unsigned integer operand.
+	littleEndian bool         // byte order of loads and stores.
+}
+
+// bitsIntrinsics maps the code pointers of the functions of the math/bits
+// package to their intrinsics.
+var bitsIntrinsics = map[uintptr]intrinsic{
+	funcPointer(bits.LeadingZeros):   {op: intrinsicLeadingZeros, kind: reflect.Uint},
+	funcPointer(bits.LeadingZeros8):  {op: intrinsicLeadingZeros, kind: reflect.Uint8},
+	funcPointer(bits.LeadingZeros16): {op: intrinsicLeadingZeros, kind: reflect.Uint16},
+	funcPointer(bits.LeadingZeros32): {op: intrinsicLeadingZeros, kind: reflect.Uint32},
+	funcPointer(bits.LeadingZeros64): {op: intrinsicLeadingZeros, kind: reflect.Uint64},
+	funcPointer(bits.OnesCount):      {op: intrinsicOnesCount, kind: reflect.Uint},
+	funcPointer(bits.OnesCount8):     {op: intrinsicOnesCount, kind: reflect.Uint8},
+	funcPointer(bits.OnesCount16):    {op: intrinsicOnesCount, kind: reflect.Uint16},
+	funcPointer(bits.OnesCount32):    {op: intrinsicOnesCount, kind: reflect.Uint32},
+	funcPointer(bits.OnesCount64):    {op: intrinsicOnesCount, kind: reflect.Uint64},
+	funcPointer(bits.RotateLeft):     {op: intrinsicRotateLeft, kind: reflect.Uint},
+	funcPointer(bits.RotateLeft8):    {op: intrinsicRotateLeft, kind: reflect.Uint8},
+	funcPointer(bits.RotateLeft16):   {op: intrinsicRotateLeft, kind: reflect.Uint16},
+	funcPointer(bits.RotateLeft32):   {op: intrinsicRotateLeft, kind: reflect.Uint32},
+	funcPointer(bits.RotateLeft64):   {op: intrinsicRotateLeft, kind: reflect.Uint64},
+}
+
+// namedIntrinsics maps the names of the native functions, as returned by
+// runtime.FuncForPC, to their intrinsics. It contains the functions of the
+// packages that cannot be imported by the compiler.
+var namedIntrinsics = map[string]intrinsic{
+	"github.com/open2b/scriggo/builtin.Repeat": {op: intrinsicRepeat},
+}
+
+// maxFoldedRepeatSize is the maximum size of the string returned by a call
+// to builtin.Repeat with constant arguments that is computed at compile time.
+const maxFoldedRepeatSize = 4096
+
+// byteOrderIntrinsics maps the names of the methods of binary.BigEndian and
+// binary.LittleEndian to their intrinsics, in big endian byte order.
+var byteOrderIntrinsics = map[string]intrinsic{
+	"Uint16":    {op: intrinsicLoadUint, kind: reflect.Uint16},
+	"Uint32":    {op: intrinsicLoadUint, kind: reflect.Uint32},
+	"Uint64":    {op: intrinsicLoadUint, kind: reflect.Uint64},
+	"PutUint16": {op: intrinsicStoreUint, kind: reflect.Uint16},
+	"PutUint32": {op: intrinsicStoreUint, kind: reflect.Uint32},
+	"PutUint64": {op: intrinsicStoreUint, kind: reflect.Uint64},
+}
+
+var (
+	bigEndianType    = reflect.TypeOf(binary.BigEndian)
+	littleEndianType = reflect.TypeOf(binary.LittleEndian)
+)
+
+// funcPointer returns the code pointer of the function f.
+func funcPointer(f interface{}) uintptr {
+	return reflect.ValueOf(f).Pointer()
+}
+
+// nativeIntrinsic returns the intrinsic of the native function fn and true,
+// if fn has an intrinsic. Otherwise it returns false.
+func nativeIntrinsic(fn reflect.Value) (intrinsic, bool) {
+	p := fn.Pointer()
+	if in, ok := bitsIntrinsics[p]; ok {
+		return in, true
+	}
+	if f := goruntime.FuncForPC(p); f != nil {
+		in, ok := namedIntrinsics[f.Name()]
+		return in, ok
+	}
+	return intrinsic{}, false
+}
+
+// intrinsic returns the intrinsic of the function called by call and true,
+// if the called function is a native function with an intrinsic. Otherwise
+// it returns false.
+func (em *emitter) intrinsic(call *ast.Call) (intrinsic, bool) {
+	ti := em.ti(call.Func)
+	if !ti.IsNative() || ti.Addressable() || call.IsVariadic {
+		return intrinsic{}, false
+	}
+	// Calls as f(g()), where g returns multiple values, are not replaced.
+	if len(call.Args) != ti.Type.NumIn() {
+		return intrinsic{}, false
+	}
+	switch ti.MethodType {
+	case noMethod:
+		fn, ok := ti.value.(reflect.Value)
+		if !ok || fn.Kind() != reflect.Func {
+			return intrinsic{}, false
+		}
+		return nativeIntrinsic(fn)
+	case methodCallConcrete:
+		// The receiver is not evaluated, so it must not have side effects.
+		sel := call.Func.(*ast.Selector)
+		switch rcv := sel.Expr.(type) {
+		case *ast.Identifier:
+		case *ast.Selector:
+			// A native package variable.
+			if rti := em.ti(rcv); !rti.IsNative() || !rti.Addressable() {
+				return intrinsic{}, false
+			}
+		default:
+			return intrinsic{}, false
+		}
+		in, ok := byteOrderIntrinsics[sel.Ident]
+		if !ok {
+			return intrinsic{}, false
+		}
+		switch em.typ(sel.Expr) {
+		case bigEndianType:
+		case littleEndianType:
+			in.littleEndian = true
+		default:
+			return intrinsic{}, false
+		}
+		return in, true
+	}
+	return intrinsic{}, false
+}
+
+// emitIntrinsic emits the instruction of the intrinsic in that replaces the
+// call. It returns the registers and the reflect types of the returned
+// values, as emitCallNode does.
+func (em *emitter) emitIntrinsic(call *ast.Call, in intrinsic) ([]int8, []reflect.Type) {
+	fnType := em.typ(call.Func)
+	switch in.op {
+	case intrinsicLeadingZeros, intrinsicOnesCount:
+		n := em.fb.newRegister(reflect.Int)
+		em.fb.enterStack()
+		x, k := em.emitExprK(call.Args[0], fnType.In(0))
+		if in.op == intrinsicLeadingZeros {
+			em.fb.emitLeadingZeros(k, x, n, in.kind)
+		} else {
+			em.fb.emitOnesCount(k, x, n, in.kind)
+		}
+		em.fb.exitStack()
+		return []int8{n}, []reflect.Type{intType}
+	case intrinsicRotateLeft:
+		typ := fnType.In(0)
+		x := em.fb.newRegister(typ.Kind())
+		em.fb.enterStack()
+		em.emitExprR(call.Args[0], typ, x)
+		k, ky := em.emitExprK(call.Args[1], intType)
+		em.fb.emitRotateLeft(ky, x, k, in.kind)
+		em.fb.exitStack()
+		return []int8{x}, []reflect.Type{typ}
+	case intrinsicLoadUint:
+		typ := fnType.Out(0)
+		v := em.fb.newRegister(typ.Kind())
+		em.fb.enterStack()
+		s := em.emitExpr(call.Args[0], fnType.In(0))
+		em.fb.emitLoadUint(in.littleEndian, s, v, in.kind)
+		em.fb.exitStack()
+		return []int8{v}, []reflect.Type{typ}
+	case intrinsicStoreUint:
+		em.fb.enterStack()
+		s := em.fb.newRegister(reflect.Slice)
+		em.emitExprR(call.Args[0], fnType.In(0), s)
+		x, k := em.emitExprK(call.Args[1], fnType.In(1))
+		em.fb.emitStoreUint(in.littleEndian, k, x, s, in.kind)
+		em.fb.exitStack()
+	case intrinsicRepeat:
+		z := em.fb.newRegister(reflect.String)
+		if v, ok := em.foldRepeat(call); ok {
+			em.fb.emitMove(true, em.fb.makeStringValue(v), z, reflect.String)
+			return []int8{z}, []reflect.Type{stringType}
+		}
+		em.fb.enterStack()
+		s := em.emitExpr(call.Args[0], stringType)
+		n, k := em.emitExprK(call.Args[1], intType)
+		em.fb.emitRepeat(k, s, n, z, call.Pos())
+		em.fb.exitStack()
+		return []int8{z}, []reflect.Type{stringType}
+	}
+	return nil, nil
+}
+
+// foldRepeat returns the string returned by the call to builtin.Repeat and
+// true, if its arguments are constants and the string is not larger than
+// maxFoldedRepeatSize and the maximum size of the constant strings.
+// Otherwise it returns false.
+func (em *emitter) foldRepeat(call *ast.Call) (string, bool) {
+	s, n := em.ti(call.Args[0]), em.ti(call.Args[1])
+	if !s.IsConstant() || !n.IsConstant() {
+		return "", false
+	}
+	str, count := s.Constant.string(), n.Constant.int64()
+	max := int64(maxFoldedRepeatSize)
+	if m := em.maxConstantStringSize; m > 0 && int64(m) < max {
+		max = int64(m)
+	}
+	if count < 0 || len(str) > 0 && count > max/int64(len(str)) {
+		return "", false
+	}
+	return strings.Repeat(str, int(count)), true
+}
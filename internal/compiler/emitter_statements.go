@@ -16,6 +16,17 @@ import (
 func (em *emitter) emitNodes(nodes []ast.Node) {
 
 	for _, node := range nodes {
+		if pos := node.Pos(); pos != nil {
+			em.fb.stmtPos = pos
+			switch node.(type) {
+			case *ast.Block, *ast.Comment, *ast.Statements:
+			default:
+				em.fb.addPosition(*convertPosition(pos))
+				if em.debug {
+					em.fb.addStmtPosAndPath(pos)
+				}
+			}
+		}
 		switch node := node.(type) {
 
 		case *ast.Assignment:
@@ -70,7 +81,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 					Parent: em.fb.fn,
 				}
 				em.fb.emitLoadFunc(false, em.fb.addFunction(fn), fnReg)
-				em.fb = newBuilder(fn, em.fb.getPath())
+				em.fb = newBuilder(fn, em.fb.getPath(), em.intSize)
 				em.fb.emitRecover(0, true)
 				em.fb.emitReturn()
 				em.fb = backup
@@ -87,7 +98,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 				// Precompiled packages have been already handled by the type
 				// checker and should be ignored by the emitter.
 				if ext := filepath.Ext(node.Path); ext != "" {
-					inits := em.emitImport(node, true)
+					_, _, inits := em.emitImport(node, true)
 					if len(inits) > 0 && !em.alreadyInitializedTemplatePkgs[node.Tree.Path] {
 						for _, initFunc := range inits {
 							index := em.fb.addFunction(initFunc)
@@ -308,7 +319,7 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 					ti := em.ti(expr)
 					em.fb.enterStack()
 					r := em.emitExpr(expr, ti.Type)
-					em.fb.emitShow(ti.Type, r, ctx, em.inURL, em.isURLSet)
+					em.fb.emitShow(ti.Type, r, ctx, em.inURL, em.isURLSet, expr.Pos())
 					em.fb.exitStack()
 				}
 			}
@@ -331,6 +342,18 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 				em.fb.emitText(txt, em.inURL, em.isURLSet)
 			}
 
+		case *ast.Trans:
+			if text := node.Text; text != nil {
+				txt := text.Text[text.Cut.Left : len(text.Text)-text.Cut.Right]
+				if len(txt) != 0 {
+					em.fb.emitTrans(txt)
+					if em.transTexts == nil {
+						em.transTexts = map[string]bool{}
+					}
+					em.transTexts[string(txt)] = true
+				}
+			}
+
 		case *ast.TypeDeclaration:
 			// Nothing to do.
 
@@ -367,26 +390,37 @@ func (em *emitter) emitNodes(nodes []ast.Node) {
 			// variable with the same name on the right (they are two different
 			// variables).
 			varsToBind := make(map[string]int8, len(node.Lhs))
+			var wideVarsToBind map[string]int16
 			for i, v := range node.Lhs {
 				if isBlankIdentifier(v) {
 					addresses[i] = em.addressBlankIdent(v.Pos())
 				} else {
 					staticType := em.typ(v)
-					var varr int8
 					if em.varStore.mustBeDeclaredAsIndirect(v) {
-						varr = em.fb.newIndirectRegister()
+						varr := em.fb.newIndirectRegister()
+						varsToBind[v.Name] = varr
 						addresses[i] = em.addressNewIndirectVar(varr, staticType, v.Pos(), 0)
+					} else if em.fb.needsWideRegister(staticType) {
+						wide := em.fb.newWideRegister(staticType.Kind())
+						if wideVarsToBind == nil {
+							wideVarsToBind = map[string]int16{}
+						}
+						wideVarsToBind[v.Name] = wide
+						addresses[i] = em.addressWideVar(wide, staticType, v.Pos(), 0)
 					} else {
-						varr = em.fb.newRegister(staticType.Kind())
+						varr := em.fb.newRegister(staticType.Kind())
+						varsToBind[v.Name] = varr
 						addresses[i] = em.addressLocalVar(varr, staticType, v.Pos(), 0)
 					}
-					varsToBind[v.Name] = varr
 				}
 			}
 			em.assignValuesToAddresses(addresses, node.Rhs)
 			for name, reg := range varsToBind {
 				em.fb.bindVarReg(name, reg)
 			}
+			for name, reg := range wideVarsToBind {
+				em.fb.bindWideVar(name, reg)
+			}
 
 		case ast.Expression:
 			em.fb.enterStack()
@@ -435,6 +469,7 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 	if node.Type == ast.AssignmentDeclaration {
 		addresses := make([]address, len(node.Lhs))
 		varsToBind := make(map[string]int8, len(node.Lhs))
+		var wideVarsToBind map[string]int16
 		for i, v := range node.Lhs {
 			pos := v.Pos()
 			if isBlankIdentifier(v) {
@@ -452,7 +487,19 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 			}
 			// The identifier may already be declared in the current scope.
 			if reg, ok := em.fb.declaredInCurrentScope(v.Name); ok {
-				addresses[i] = em.addressLocalVar(reg, varType, pos, node.Type)
+				if reg > maxRegistersCount {
+					addresses[i] = em.addressWideVar(reg, varType, pos, node.Type)
+				} else {
+					addresses[i] = em.addressLocalVar(int8(reg), varType, pos, node.Type)
+				}
+			} else if em.fb.needsWideRegister(varType) {
+				// Declare a local variable stored in a wide register.
+				wide := em.fb.newWideRegister(varType.Kind())
+				if wideVarsToBind == nil {
+					wideVarsToBind = map[string]int16{}
+				}
+				wideVarsToBind[v.Name] = wide
+				addresses[i] = em.addressWideVar(wide, varType, pos, node.Type)
 			} else {
 				// Declare a local variable.
 				varr := em.fb.newRegister(varType.Kind())
@@ -464,10 +511,30 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 		for name, reg := range varsToBind {
 			em.fb.bindVarReg(name, reg)
 		}
+		for name, reg := range wideVarsToBind {
+			em.fb.bindWideVar(name, reg)
+		}
 		return
 	}
 
-	// Emit an assignment.
+	// Emit an assignment. The registers of the operands and of the values are
+	// released after the assignment.
+	em.fb.enterStack()
+
+	// emitOperand emits an operand of an address that is not changed by the
+	// assignment of the address. In a multiple assignment, the operand is
+	// emitted into a new register, so that the assignments to the preceding
+	// addresses do not change it, as the operands are evaluated before any
+	// assignment.
+	emitOperand := func(expr ast.Expression, typ reflect.Type) int8 {
+		if len(node.Lhs) == 1 {
+			return em.emitExpr(expr, typ)
+		}
+		reg := em.fb.newRegister(typ.Kind())
+		em.emitExprR(expr, typ, reg)
+		return reg
+	}
+
 	addresses := make([]address, len(node.Lhs))
 	for i, v := range node.Lhs {
 		pos := v.Pos()
@@ -480,6 +547,10 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 			}
 			varType := em.typ(v)
 			// Local variable.
+			if reg, ok := em.fb.wideScopeLookup(v.Name); ok {
+				addresses[i] = em.addressWideVar(reg, varType, pos, node.Type)
+				break
+			}
 			if em.fb.declaredInFunc(v.Name) {
 				reg := em.fb.scopeLookup(v.Name)
 				addresses[i] = em.addressLocalVar(reg, varType, pos, node.Type)
@@ -494,12 +565,21 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 
 		case *ast.Index:
 			exprType := em.typ(v.Expr)
-			expr := em.emitExpr(v.Expr, exprType)
+			var expr int8
+			if op, ok := v.Expr.(*ast.UnaryOperator); ok && op.Op == ast.OperatorPointer {
+				// Index of a pointer to an array. The array is addressed
+				// through the pointer, so the element is assigned in place.
+				expr = -emitOperand(op.Expr, em.typ(op.Expr))
+			} else if k := exprType.Kind(); k == reflect.Map || k == reflect.Slice {
+				expr = emitOperand(v.Expr, exprType)
+			} else {
+				expr = em.emitExpr(v.Expr, exprType)
+			}
 			indexType := intType
 			if exprType.Kind() == reflect.Map {
 				indexType = exprType.Key()
 			}
-			index := em.emitExpr(v.Index, indexType)
+			index := emitOperand(v.Index, indexType)
 			switch exprType.Kind() {
 			case reflect.Map:
 				if nonLocalMap, ok := em.varStore.nonLocalVarIndex(v.Expr); ok {
@@ -524,7 +604,12 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 				expr = op.Expr
 			}
 			typ := em.typ(expr)
-			reg := em.emitExpr(expr, typ)
+			var reg int8
+			if typ.Kind() == reflect.Ptr {
+				reg = emitOperand(expr, typ)
+			} else {
+				reg = em.emitExpr(expr, typ)
+			}
 			var field reflect.StructField
 			if typ.Kind() == reflect.Ptr {
 				field, _ = typ.Elem().FieldByName(v.Ident)
@@ -542,16 +627,18 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 				panic(internalError("unexpected operator %s", v.Operator()))
 			}
 			typ := em.typ(v.Expr)
-			reg := em.emitExpr(v.Expr, typ)
+			reg := emitOperand(v.Expr, typ)
 			addresses[i] = em.addressPtrIndirect(reg, typ, pos, node.Type)
 		default:
 			panic(internalError("unexpected"))
 		}
 	}
 	em.assignValuesToAddresses(addresses, node.Rhs)
+	em.fb.exitStack()
 }
 
-// emitImport emits an import node, returning the list of all 'init' functions
+// emitImport emits an import node, returning the exported functions and
+// variables of the imported package and the list of all 'init' functions
 // emitted.
 //
 // TODO: the argument isTemplate must be passed explicitly because it's
@@ -560,14 +647,14 @@ func (em *emitter) emitAssignmentNode(node *ast.Assignment) {
 // TODO: this function works correctly but its code looks very ugly and hard
 // to understand. Review and improve the code.
 //
-func (em *emitter) emitImport(node *ast.Import, isTemplate bool) []*runtime.Function {
+func (em *emitter) emitImport(node *ast.Import, isTemplate bool) (map[string]*runtime.Function, map[string]int16, []*runtime.Function) {
 
 	// If the imported package is predefined the emitter does not have to do
 	// anything: the predefined values have already been added to the type infos
 	// of the tree, and the init functions have already been called when gc
 	// imported the predefined package.
 	if node.Tree == nil {
-		return nil
+		return nil, nil, nil
 	}
 
 	backupPkg := em.pkg
@@ -645,7 +732,7 @@ func (em *emitter) emitImport(node *ast.Import, isTemplate bool) []*runtime.Func
 		em.fb.changePath(backupPath)
 	}
 
-	return inits
+	return funcs, vars, inits
 }
 
 // emitSelect emits the 'select' statements. The emission is composed by 4 main
@@ -744,6 +831,7 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 	for i, cas := range selectNode.Cases {
 		// Make the previous 'goto' point here.
 		em.fb.setLabelAddr(casesLabel[i])
+		em.fb.enterScope()
 		// Emit an assignment if it is a receive case with an assignment.
 		if assignment, isAssignment := cas.Comm.(*ast.Assignment); isAssignment {
 			receiveExpr := assignment.Rhs[0].(*ast.UnaryOperator)
@@ -771,6 +859,7 @@ func (em *emitter) emitSelect(selectNode *ast.Select) {
 		}
 		// Emit the nodes of the body of the case.
 		em.emitNodes(cas.Body)
+		em.fb.exitScope()
 		// All 'case' bodies jump to the end of the 'select' bodies, except for the last one.
 		if i < len(selectNode.Cases)-1 {
 			em.fb.emitGoto(casesEnd)
@@ -1015,6 +1104,15 @@ func (em *emitter) emitTypeSwitch(node *ast.TypeSwitch) {
 // emitForRange emits a for range statement.
 func (em *emitter) emitForRange(node *ast.ForRange) {
 
+	if node.Parallel {
+		em.emitParallelForRange(node)
+		return
+	}
+	if r, ok := node.Assignment.Rhs[0].(*ast.Range); ok {
+		em.emitForIntRange(node, r)
+		return
+	}
+
 	inForRange := em.inForRange
 	em.inForRange = true
 
@@ -1032,10 +1130,11 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	// The instruction OpRange knows nothing about indirect registers. So, if
 	// indirect registers are involved, declare them both as  direct and
 	// indirect and move values between them before executing the instructions
-	// of the for statement's body.
+	// of the for statement's body. The same is done for the wide registers.
 
 	var index, elem int8
 	var indirectIndex, indirectElem int8
+	var wideIndex, wideElem int16
 	var indexType, elemType reflect.Type
 
 	if len(vars) >= 1 && !isBlankIdentifier(vars[0]) {
@@ -1050,6 +1149,9 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 			} else {
 				em.fb.bindVarReg(name, index)
 			}
+		} else if wide, ok := em.fb.wideScopeLookup(name); ok {
+			index = em.fb.newRegister(indexType.Kind())
+			wideIndex = wide
 		} else {
 			index = em.fb.scopeLookup(name)
 		}
@@ -1067,6 +1169,9 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 			} else {
 				em.fb.bindVarReg(name, elem)
 			}
+		} else if wide, ok := em.fb.wideScopeLookup(name); ok {
+			elem = em.fb.newRegister(elemType.Kind())
+			wideElem = wide
 		} else {
 			elem = em.fb.scopeLookup(name)
 		}
@@ -1086,6 +1191,12 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	if indirectElem != 0 {
 		em.changeRegister(false, elem, indirectElem, elemType, elemType)
 	}
+	if wideIndex != 0 {
+		em.fb.emitWideMove(int16(index), wideIndex, indexType.Kind())
+	}
+	if wideElem != 0 {
+		em.fb.emitWideMove(int16(elem), wideElem, elemType.Kind())
+	}
 
 	em.emitNodes(node.Body)
 	em.fb.emitContinue(rangeLabel)
@@ -1106,3 +1217,109 @@ func (em *emitter) emitForRange(node *ast.ForRange) {
 	}
 
 }
+
+// emitParallelForRange emits the parallel for range statement node. The type
+// checker has replaced its body with a function literal that is called, in
+// parallel, for each element of the ranged expression.
+func (em *emitter) emitParallelForRange(node *ast.ForRange) {
+	expr := node.Assignment.Rhs[0]
+	fn := node.Body[0].(*ast.Func)
+	em.fb.enterStack()
+	s := em.emitExpr(expr, em.typ(expr))
+	f := em.fb.newRegister(reflect.Func)
+	em.emitExprR(fn, em.typ(fn), f)
+	em.fb.emitParallel(f, s, node.Pos())
+	em.fb.exitStack()
+	if node.Else != nil {
+		endForLabel := em.fb.newLabel()
+		em.fb.emitIf(false, 0, runtime.ConditionNotOK, 0, reflect.Interface, nil)
+		em.fb.emitGoto(endForLabel)
+		em.fb.enterScope()
+		em.emitNodes(node.Else.Nodes)
+		em.fb.exitScope()
+		em.fb.setLabelAddr(endForLabel)
+	}
+}
+
+// emitForIntRange emits the for range statement node that ranges over the
+// integer range r, from the low to the high bound inclusive, as a counted
+// loop. The bounds are evaluated only once and the loop variable receives a
+// copy of the counter, so changing it in the body does not change the
+// iterations.
+func (em *emitter) emitForIntRange(node *ast.ForRange, r *ast.Range) {
+
+	currentBreakable := em.breakable
+	currentBreakLabel := em.breakLabel
+	inForRange := em.inForRange
+	em.breakable = true
+	em.breakLabel = nil
+	em.inForRange = false
+
+	em.fb.enterScope()
+
+	typ := em.typ(r)
+	kind := typ.Kind()
+	lessEqual := runtime.ConditionLessEqual
+	if reflect.Uint <= kind && kind <= reflect.Uintptr {
+		lessEqual = runtime.ConditionLessEqualU
+	}
+
+	counter := em.fb.newRegister(kind)
+	em.emitExprR(r.Low, typ, counter)
+	high := em.fb.newRegister(kind)
+	em.emitExprR(r.High, typ, high)
+
+	var elem, indirectElem int8
+	if ident := node.Assignment.Lhs[0].(*ast.Identifier); !isBlankIdentifier(ident) {
+		elem = em.fb.newRegister(kind)
+		if em.varStore.mustBeDeclaredAsIndirect(ident) {
+			indirectElem = em.fb.newIndirectRegister()
+			em.fb.emitNew(typ, -indirectElem)
+			em.fb.bindVarReg(ident.Name, indirectElem)
+		} else {
+			em.fb.bindVarReg(ident.Name, elem)
+		}
+	}
+
+	loopLabel := em.fb.newLabel()
+	postLabel := em.fb.newLabel()
+	elseLabel := em.fb.newLabel()
+	endLabel := em.fb.newLabel()
+
+	em.fb.emitIf(false, counter, lessEqual, high, kind, r.Pos())
+	em.fb.emitGoto(elseLabel)
+	em.fb.setLabelAddr(loopLabel)
+	if elem != 0 {
+		em.fb.emitMove(false, counter, elem, kind)
+		if indirectElem != 0 {
+			em.changeRegister(false, elem, indirectElem, typ, typ)
+		}
+	}
+	em.rangeLabels = append(em.rangeLabels, postLabel)
+	em.fb.enterScope()
+	em.emitNodes(node.Body)
+	em.fb.exitScope()
+	em.rangeLabels = em.rangeLabels[:len(em.rangeLabels)-1]
+	em.fb.setLabelAddr(postLabel)
+	em.fb.emitIf(false, counter, runtime.ConditionNotEqual, high, kind, nil)
+	em.fb.emitGoto(endLabel)
+	em.fb.emitAdd(true, counter, 1, counter, kind)
+	em.fb.emitGoto(loopLabel)
+
+	em.fb.setLabelAddr(elseLabel)
+	if node.Else != nil {
+		em.fb.enterScope()
+		em.emitNodes(node.Else.Nodes)
+		em.fb.exitScope()
+	}
+	em.fb.setLabelAddr(endLabel)
+
+	em.fb.exitScope()
+	if em.breakLabel != nil {
+		em.fb.setLabelAddr(*em.breakLabel)
+	}
+	em.breakable = currentBreakable
+	em.breakLabel = currentBreakLabel
+	em.inForRange = inForRange
+
+}
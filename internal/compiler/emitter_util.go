@@ -333,6 +333,13 @@ func (em *emitter) emitValueNotPredefined(ti *typeInfo, reg int8, dstType reflec
 		em.changeRegister(false, tmp, reg, typ, dstType)
 		return reg, false
 	case string:
+		if max := em.maxConstantStringSize; max > 0 && len(v) > max {
+			pos := em.fb.fn.Pos
+			if em.fb.stmtPos != nil {
+				pos = convertPosition(em.fb.stmtPos)
+			}
+			panic(newLimitExceededError(pos, em.fb.path, "constant string too large"))
+		}
 		c := em.fb.makeStringValue(v)
 		em.changeRegister(true, c, reg, typ, dstType)
 		return reg, false
@@ -504,3 +511,22 @@ func convertPosition(pos *ast.Position) *runtime.Position {
 		End:    pos.End,
 	}
 }
+
+// isDestructuring reports whether values are the index expressions of a
+// destructured array or slice, that share the same indexed expression.
+func isDestructuring(values []ast.Expression) bool {
+	if len(values) < 2 {
+		return false
+	}
+	first, ok := values[0].(*ast.Index)
+	if !ok {
+		return false
+	}
+	for _, v := range values[1:] {
+		index, ok := v.(*ast.Index)
+		if !ok || index.Expr != first.Expr {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,406 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"bytes"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+)
+
+// SymbolKind represents the kind of a symbol.
+type SymbolKind int
+
+const (
+	BuiltinSymbol SymbolKind = iota // builtin
+	ConstSymbol                     // constant
+	FuncSymbol                      // function
+	MacroSymbol                     // macro
+	PackageSymbol                   // package
+	TypeSymbol                      // type
+	VarSymbol                       // variable
+)
+
+// String returns the name of the kind.
+func (k SymbolKind) String() string {
+	switch k {
+	case BuiltinSymbol:
+		return "builtin"
+	case ConstSymbol:
+		return "const"
+	case FuncSymbol:
+		return "func"
+	case MacroSymbol:
+		return "macro"
+	case PackageSymbol:
+		return "package"
+	case TypeSymbol:
+		return "type"
+	case VarSymbol:
+		return "var"
+	}
+	panic("invalid symbol kind")
+}
+
+// Symbol represents a macro, variable, constant or type declared at the top
+// level of a template file.
+type Symbol struct {
+	Name string       // name.
+	Kind SymbolKind   // kind.
+	Type string       // type, as it is reported in the checking errors.
+	Path string       // path of the file.
+	Pos  ast.Position // position of the name in the file.
+	Doc  string       // text of the comment that precedes the declaration.
+}
+
+// symbolDecl is a declaration of a symbol, collected before the type checking
+// because the type checker changes the tree.
+type symbolDecl struct {
+	symbol Symbol
+	node   ast.Node // declaration node, or the identifier for variables.
+	index  int      // index of the identifier in a constant declaration.
+}
+
+// IndexTemplates returns the symbols declared at the top level of the named
+// template files rooted at fsys, and of every file extended, imported and
+// rendered by them. A file reachable from more than one root is indexed once.
+//
+// Files are parsed and type checked as BuildTemplate does, so any error that
+// BuildTemplate would return for a root is returned.
+//
+// Symbols are sorted by path and position, so the result does not depend on
+// the order in which the files are reached.
+func IndexTemplates(fsys fs.FS, roots []string, opts Options) ([]Symbol, error) {
+
+	// Check the options.
+	err := checkIntSize(opts.IntSize)
+	if err != nil {
+		return nil, err
+	}
+	sanitizers, err := sanitizersByType(opts.Sanitizers, opts.FormatTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	var symbols []Symbol
+	indexed := map[string]bool{}
+
+	for _, name := range roots {
+
+		// Parse the source code.
+		tree, err := parseTemplate(fsys, name, opts.NoParseShortShowStmt, opts.DollarIdentifier, opts.ExecuteMarkdownCodeFences, opts.parserLimits(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		// Transform the tree.
+		if opts.TreeTransformer != nil {
+			err := opts.TreeTransformer(tree)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Collect the declarations.
+		var decls []symbolDecl
+		collectSymbolDecls(tree, indexed, &decls)
+
+		// Type check the tree.
+		checkerOpts := checkerOptions{
+			allowGoStmt:           opts.AllowGoStmt,
+			checkUnusedMacros:     opts.CheckUnusedMacros,
+			disabledBuiltins:      opts.DisabledBuiltins,
+			formatTypes:           opts.FormatTypes,
+			globals:               opts.Globals,
+			intSize:               opts.IntSize,
+			maxConstantStringSize: opts.MaxConstantStringSize,
+			mdConverter:           opts.MDConverter,
+			mod:                   templateMod,
+			orDefault:             opts.OrDefault,
+			sanitizers:            sanitizers,
+			strictShows:           opts.StrictShows,
+		}
+		tci, err := typecheck(tree, opts.Importer, checkerOpts)
+		if err != nil {
+			return nil, err
+		}
+		typeInfos := tci["main"].TypeInfos
+
+		// Set the types.
+		for _, d := range decls {
+			var ti *typeInfo
+			switch n := d.node.(type) {
+			case *ast.Identifier:
+				ti = typeInfos[n]
+			case *ast.Const:
+				if n.Type != nil {
+					ti = typeInfos[n.Type]
+				} else if d.index < len(n.Rhs) {
+					ti = typeInfos[n.Rhs[d.index]]
+				}
+			case *ast.TypeDeclaration:
+				ti = typeInfos[n.Type]
+			case *ast.Func:
+				if n.Type.Reflect != nil {
+					ti = &typeInfo{Type: n.Type.Reflect}
+				}
+			}
+			if ti != nil {
+				d.symbol.Type = ti.String()
+			}
+			symbols = append(symbols, d.symbol)
+		}
+
+	}
+
+	sort.SliceStable(symbols, func(i, j int) bool {
+		s1, s2 := symbols[i], symbols[j]
+		if s1.Path != s2.Path {
+			return s1.Path < s2.Path
+		}
+		return s1.Pos.Start < s2.Pos.Start
+	})
+
+	return symbols, nil
+}
+
+// collectSymbolDecls appends to decls the declarations at the top level of
+// tree and of the files extended, imported and rendered by tree, skipping the
+// files already indexed. It marks the visited files as indexed.
+func collectSymbolDecls(tree *ast.Tree, indexed map[string]bool, decls *[]symbolDecl) {
+	if indexed[tree.Path] {
+		return
+	}
+	indexed[tree.Path] = true
+	var doc *ast.Comment
+	for _, node := range tree.Nodes {
+		if n, ok := node.(*ast.Text); ok && len(bytes.TrimSpace(n.Text)) == 0 {
+			continue
+		}
+		if n, ok := node.(*ast.Comment); ok {
+			doc = n
+			continue
+		}
+		nodes := []ast.Node{node}
+		if n, ok := node.(*ast.Statements); ok {
+			nodes = n.Nodes
+		}
+		for _, n := range nodes {
+			appendSymbolDecls(tree.Path, n, doc, decls)
+			doc = nil
+		}
+		doc = nil
+	}
+	astutil.Inspect(tree, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Extends:
+			collectSymbolDecls(n.Tree, indexed, decls)
+		case *ast.Import:
+			if n.Tree != nil {
+				collectSymbolDecls(n.Tree, indexed, decls)
+			}
+		case *ast.Render:
+			collectSymbolDecls(n.Tree, indexed, decls)
+		}
+		return true
+	})
+}
+
+// appendSymbolDecls appends to decls the symbols declared by node, if it is
+// a declaration, in the file with the given path. doc is the comment that
+// precedes the declaration, if any.
+func appendSymbolDecls(path string, node ast.Node, doc *ast.Comment, decls *[]symbolDecl) {
+	var text string
+	if doc != nil {
+		text = strings.TrimSpace(doc.Text)
+	}
+	add := func(ident *ast.Identifier, kind SymbolKind, node ast.Node, index int) {
+		if isBlankIdentifier(ident) {
+			return
+		}
+		*decls = append(*decls, symbolDecl{
+			symbol: Symbol{Name: ident.Name, Kind: kind, Path: path, Pos: *ident.Pos(), Doc: text},
+			node:   node,
+			index:  index,
+		})
+	}
+	switch n := node.(type) {
+	case *ast.Func:
+		if n.Ident != nil && n.Type.Macro {
+			add(n.Ident, MacroSymbol, n, 0)
+		}
+	case *ast.Var:
+		for _, ident := range n.Lhs {
+			add(ident, VarSymbol, ident, 0)
+		}
+	case *ast.Const:
+		for i, ident := range n.Lhs {
+			add(ident, ConstSymbol, n, i)
+		}
+	case *ast.TypeDeclaration:
+		add(n.Ident, TypeSymbol, n, 0)
+	}
+}
+
+// ScopeName is a name in scope.
+type ScopeName struct {
+	Name   string     // name.
+	Kind   SymbolKind // kind.
+	Type   string     // type, as it is reported in the checking errors. Empty for packages and builtins.
+	Global bool       // reports whether it is declared in the universe or in the global block.
+}
+
+// NamesInScope returns the names in scope, excluding the names of the
+// universe block, at the given offset of the file with the given path, as
+// the type checker sees them when it checks the template file named name.
+// The names are sorted.
+//
+// The names in scope are the ones at the start of the statement, or text,
+// that contains offset or that precedes it in the same block. If the file is
+// not reached from name, NamesInScope returns no names.
+//
+// If a checking error occurs, NamesInScope returns the names collected until
+// the error and the error.
+func NamesInScope(fsys fs.FS, name, path string, offset int, opts Options) ([]ScopeName, error) {
+
+	// Check the options.
+	err := checkIntSize(opts.IntSize)
+	if err != nil {
+		return nil, err
+	}
+	sanitizers, err := sanitizersByType(opts.Sanitizers, opts.FormatTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the source code.
+	tree, err := parseTemplate(fsys, name, opts.NoParseShortShowStmt, opts.DollarIdentifier, opts.ExecuteMarkdownCodeFences, opts.parserLimits(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transform the tree.
+	if opts.TreeTransformer != nil {
+		err := opts.TreeTransformer(tree)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Type check the tree.
+	query := &scopeQuery{path: path, offset: offset, pos: -1}
+	checkerOpts := checkerOptions{
+		allowGoStmt:           opts.AllowGoStmt,
+		checkUnusedMacros:     opts.CheckUnusedMacros,
+		disabledBuiltins:      opts.DisabledBuiltins,
+		formatTypes:           opts.FormatTypes,
+		globals:               opts.Globals,
+		intSize:               opts.IntSize,
+		maxConstantStringSize: opts.MaxConstantStringSize,
+		mdConverter:           opts.MDConverter,
+		mod:                   templateMod,
+		orDefault:             opts.OrDefault,
+		sanitizers:            sanitizers,
+		scopeQuery:            query,
+		strictShows:           opts.StrictShows,
+	}
+	_, err = typecheck(tree, opts.Importer, checkerOpts)
+
+	return query.names, err
+}
+
+// scopeQuery collects the names in scope at an offset of a file during the
+// type checking. The type checker calls the record method at the start of
+// every statement and at the end of every block.
+type scopeQuery struct {
+	path   string      // path of the file.
+	offset int         // offset in the file.
+	pos    int         // position of the last recorded names.
+	names  []ScopeName // last recorded names.
+}
+
+// record records the names in scope if pos, in the file with the given path,
+// is the nearest position, not after the offset, recorded so far. For equal
+// positions, the last call wins because blocks end before the statements
+// that contain them.
+//
+// The first call for the file, at its first statement, always records the
+// names, so that they are returned also for an offset preceding it.
+func (q *scopeQuery) record(path string, pos int, scopes *scopes) {
+	if path != q.path {
+		return
+	}
+	if q.names != nil && (pos > q.offset || pos < q.pos) {
+		return
+	}
+	if pos <= q.offset {
+		q.pos = pos
+	}
+	q.names = scopeNames(scopes, 2)
+}
+
+// scopeNames returns the names in scope, starting from the scope with index
+// from, sorted by name. If a name is declared in more scopes, only the
+// innermost declaration is returned.
+func scopeNames(scopes *scopes, from int) []ScopeName {
+	type declared struct {
+		ti     *typeInfo
+		global bool
+	}
+	names := map[string]declared{}
+	for i, s := range scopes.s[from:] {
+		for name, n := range s.names {
+			if n.ti != nil && isIdentifierName(name) {
+				names[name] = declared{n.ti, from+i <= 2}
+			}
+		}
+	}
+	scopeNames := make([]ScopeName, 0, len(names))
+	for name, d := range names {
+		ti := d.ti
+		n := ScopeName{Name: name, Global: d.global}
+		switch {
+		case ti.IsPackage():
+			n.Kind = PackageSymbol
+		case ti.IsType():
+			n.Kind = TypeSymbol
+			n.Type = ti.Type.String()
+		case ti.IsConstant():
+			n.Kind = ConstSymbol
+			n.Type = ti.String()
+		case ti.IsMacroDeclaration():
+			n.Kind = MacroSymbol
+			n.Type = ti.String()
+		case ti.Type == nil:
+			n.Kind = BuiltinSymbol
+		case !ti.Addressable() && ti.Type.Kind() == reflect.Func:
+			n.Kind = FuncSymbol
+			n.Type = ti.String()
+		default:
+			n.Kind = VarSymbol
+			n.Type = ti.String()
+		}
+		scopeNames = append(scopeNames, n)
+	}
+	sort.Slice(scopeNames, func(i, j int) bool { return scopeNames[i].Name < scopeNames[j].Name })
+	return scopeNames
+}
+
+// isIdentifierName reports whether name can be the name of an identifier in
+// the source code. Names used internally by the type checker cannot.
+func isIdentifierName(name string) bool {
+	for i, r := range name {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return name != ""
+}
@@ -0,0 +1,153 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/internal/fstest"
+	"github.com/open2b/scriggo/native"
+)
+
+func TestIndexTemplates(t *testing.T) {
+	fsys := fstest.Files{
+		"index.txt":  "{% extends \"layout.txt\" %}{% import \"macros.txt\" %}\n{# Title is the page title. #}\n{% macro Title %}{{ Button(\"a\") }}{% end %}",
+		"layout.txt": "{% var n = 2 %}{{ Title() }}{{ render \"footer.txt\" }}",
+		"macros.txt": "{# Button renders a button. #}{% macro Button(label string) %}{{ label }}{% end %}" +
+			"{% const c, d = 1, \"x\" %}{% const e int8 = 3 %}{% type T []int %}{% var _, s = 0, \"\" %}",
+		"footer.txt": "{# not a doc #}footer{% var year = 2021 %}",
+		"other.txt":  "{% import \"macros.txt\" %}{%% const ( A = iota; B ) %%}",
+	}
+	symbols, err := IndexTemplates(fsys, []string{"index.txt", "other.txt"}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Symbol{
+		{Name: "year", Kind: VarSymbol, Type: "int", Path: "footer.txt"},
+		{Name: "Title", Kind: MacroSymbol, Type: "func() string", Path: "index.txt", Doc: "Title is the page title."},
+		{Name: "n", Kind: VarSymbol, Type: "int", Path: "layout.txt"},
+		{Name: "Button", Kind: MacroSymbol, Type: "func(string) string", Path: "macros.txt", Doc: "Button renders a button."},
+		{Name: "c", Kind: ConstSymbol, Type: "untyped int", Path: "macros.txt"},
+		{Name: "d", Kind: ConstSymbol, Type: "untyped string", Path: "macros.txt"},
+		{Name: "e", Kind: ConstSymbol, Type: "int8", Path: "macros.txt"},
+		{Name: "T", Kind: TypeSymbol, Type: "[]int", Path: "macros.txt"},
+		{Name: "s", Kind: VarSymbol, Type: "string", Path: "macros.txt"},
+		{Name: "A", Kind: ConstSymbol, Type: "untyped int", Path: "other.txt"},
+		{Name: "B", Kind: ConstSymbol, Type: "untyped int", Path: "other.txt"},
+	}
+	if len(symbols) != len(expected) {
+		t.Fatalf("expecting %d symbols, got %d: %v", len(expected), len(symbols), symbols)
+	}
+	for i, symbol := range symbols {
+		pos := symbol.Pos
+		symbol.Pos.Line, symbol.Pos.Column, symbol.Pos.Start, symbol.Pos.End = 0, 0, 0, 0
+		if symbol != expected[i] {
+			t.Fatalf("expecting symbol %v, got %v", expected[i], symbol)
+		}
+		src := fsys[symbol.Path]
+		if src[pos.Start:pos.End+1] != symbol.Name {
+			t.Fatalf("symbol %s: unexpected position %s", symbol.Name, pos)
+		}
+	}
+	_, err = IndexTemplates(fsys, []string{"index.txt", "missing.txt"}, Options{})
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+}
+
+func TestNamesInScope(t *testing.T) {
+	fsys := fstest.Files{
+		"index.txt":  "{% import \"macros.txt\" %}{% a := 1 %}A{% if a > 0 %}{% b := \"b\" %}B{% end %}C{% for i in []int{1} %}{% _ = i %}D{% end %}",
+		"macros.txt": "{% type T int %}{% const c = 2 %}{% macro M(x int) %}E{% end %}",
+	}
+	opts := Options{Globals: native.Declarations{"g": (*bool)(nil), "f": func() {}, "p": native.Package{Name: "p"}}}
+	globals := "f func func() g var bool "
+	tests := []struct {
+		path     string
+		offset   int
+		expected string
+	}{
+		{"index.txt", 0, globals + "p package "},
+		{"index.txt", 37, "M macro func(int) string T type T a var int " + globals + "p package "},
+		{"index.txt", 66, "M macro func(int) string T type T a var int b var string " + globals + "p package "},
+		{"index.txt", 76, "M macro func(int) string T type T a var int " + globals + "p package "},
+		{"index.txt", 107, "M macro func(int) string T type T a var int " + globals + "i var int p package "},
+		{"macros.txt", 54, "M macro func(int) string T type T c const untyped int " + globals + "p package x var int "},
+		{"other.txt", 0, ""},
+	}
+	for _, test := range tests {
+		names, err := NamesInScope(fsys, "index.txt", test.path, test.offset, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		for _, n := range names {
+			b.WriteString(n.Name + " " + n.Kind.String() + " ")
+			if n.Type != "" {
+				b.WriteString(n.Type + " ")
+			}
+		}
+		if b.String() != test.expected {
+			t.Fatalf("%s at %d: expecting %q, got %q", test.path, test.offset, test.expected, b.String())
+		}
+	}
+}
+
+func TestScopeObserver(t *testing.T) {
+	fsys := fstest.Files{
+		"index.txt":  "{% extends \"layout.txt\" %}{% import \"macros.txt\" %}{% var g = 5 %}{% macro Title %}{% end %}",
+		"layout.txt": "{% import m \"macros.txt\" %}{{ Title() }}",
+		"macros.txt": "{% type T int %}{% const c = 2 %}{% macro M(x int) %}{% end %}",
+	}
+	opts := Options{
+		Globals: native.Declarations{"g": (*bool)(nil), "f": func() {}, "p": native.Package{Name: "p"}},
+	}
+	observed := map[string]string{}
+	opts.ScopeObserver = func(path string, names []ScopeName) {
+		var b strings.Builder
+		var builtins int
+		for _, n := range names {
+			if _, ok := universe[n.Name]; ok {
+				if !n.Global {
+					t.Fatalf("%s: expecting builtin %s to be global", path, n.Name)
+				}
+				builtins++
+				continue
+			}
+			b.WriteString(n.Name + " " + n.Kind.String() + " ")
+			if n.Type != "" {
+				b.WriteString(n.Type + " ")
+			}
+			if n.Global {
+				b.WriteString("global ")
+			}
+		}
+		if builtins != len(universe) {
+			t.Fatalf("%s: expecting %d builtins, got %d", path, len(universe), builtins)
+		}
+		if _, ok := observed[path]; ok {
+			t.Fatalf("%s: observed more times", path)
+		}
+		observed[path] = b.String()
+	}
+	_, err := BuildTemplate(fsys, "index.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"index.txt":  "M macro func(int) string T type T Title macro func() string f func func() global g var int p package global ",
+		"layout.txt": "Title macro func() string f func func() global g var bool global m package p package global ",
+		"macros.txt": "M macro func(int) string T type T c const untyped int f func func() global g var bool global p package global ",
+	}
+	for path, names := range expected {
+		if observed[path] != names {
+			t.Fatalf("%s: expecting %q, got %q", path, names, observed[path])
+		}
+	}
+	if len(observed) != len(expected) {
+		t.Fatalf("expecting %d observed files, got %d", len(expected), len(observed))
+	}
+}
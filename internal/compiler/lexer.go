@@ -49,21 +49,24 @@ func scanScript(text []byte) *lexer {
 	return lex
 }
 
-// scanTemplate scans a template file and returns a lexer.
-func scanTemplate(text []byte, format ast.Format, parseShebang, noParseShow, dollarIdentifier bool) *lexer {
+// scanTemplate scans a template file and returns a lexer. If
+// executeCodeFences is true, the fenced code blocks of a Markdown file are
+// scanned as the rest of the file, otherwise they are scanned as text.
+func scanTemplate(text []byte, format ast.Format, parseShebang, noParseShow, dollarIdentifier, executeCodeFences bool) *lexer {
 	tokens := make(chan token, 20)
 	lex := &lexer{
-		text:             text,
-		src:              text,
-		line:             1,
-		column:           1,
-		ctx:              ast.Context(format),
-		tokens:           tokens,
-		templateSyntax:   true,
-		extendedSyntax:   true,
-		parseShebang:     parseShebang,
-		dollarIdentifier: dollarIdentifier,
-		noParseShow:      noParseShow,
+		text:              text,
+		src:               text,
+		line:              1,
+		column:            1,
+		ctx:               ast.Context(format),
+		tokens:            tokens,
+		templateSyntax:    true,
+		extendedSyntax:    true,
+		parseShebang:      parseShebang,
+		dollarIdentifier:  dollarIdentifier,
+		noParseShow:       noParseShow,
+		executeCodeFences: executeCodeFences,
 	}
 	lex.tag.ctx = ast.ContextHTML
 	if lex.ctx == ast.ContextMarkdown {
@@ -94,6 +97,9 @@ var cdataEnd = []byte("]]>")
 
 var emptyMarker = []byte{}
 
+var rawKeyword = []byte("raw")
+var transKeyword = []byte("trans")
+
 // lexer maintains the scanner status.
 type lexer struct {
 	text     []byte        // text on which the scans are performed
@@ -108,16 +114,18 @@ type lexer struct {
 		index int         // index of first byte of the current attribute value in src
 		ctx   ast.Context // context of the tag's content
 	}
-	rawMarker        []byte     // raw marker, not nil when a raw statement has been lexed
-	tokens           chan token // tokens, is closed at the end of the scan
-	lastTokenType    tokenTyp   // type of the last non-empty emitted token
-	totals           int        // total number of emitted tokens, excluding automatically inserted semicolons
-	err              error      // error, reports whether there was an error
-	templateSyntax   bool       // support template syntax with tokens 'end', 'extends', 'in', 'macro', 'raw', 'render' and 'show'
-	extendedSyntax   bool       // support extended syntax with tokens 'and', 'or', 'not' and 'contains' (also support 'dollar' but only if 'dollarIdentifier' is true)
-	parseShebang     bool       // parse the shebang line.
-	dollarIdentifier bool       // support the dollar identifier, only if 'extendedSyntax' is true
-	noParseShow      bool       // do not parse the short show statement.
+	rawMarker         []byte     // raw marker, not nil when a raw or trans statement has been lexed
+	rawKeyword        []byte     // keyword, raw or trans, of the statement whose content is raw
+	tokens            chan token // tokens, is closed at the end of the scan
+	lastTokenType     tokenTyp   // type of the last non-empty emitted token
+	totals            int        // total number of emitted tokens, excluding automatically inserted semicolons
+	err               error      // error, reports whether there was an error
+	templateSyntax    bool       // support template syntax with tokens 'end', 'extends', 'in', 'macro', 'raw', 'render', 'show' and 'trans'
+	extendedSyntax    bool       // support extended syntax with tokens 'and', 'or', 'not' and 'contains' (also support 'dollar' but only if 'dollarIdentifier' is true)
+	parseShebang      bool       // parse the shebang line.
+	dollarIdentifier  bool       // support the dollar identifier, only if 'extendedSyntax' is true
+	noParseShow       bool       // do not parse the short show statement.
+	executeCodeFences bool       // scan the Markdown fenced code blocks as the rest of the source.
 }
 
 // newline is called when the lexer encounters a new line.
@@ -184,6 +192,12 @@ func (l *lexer) emitAtLineColumn(line, column int, typ tokenTyp, length int) {
 		case tokenRaw:
 			if l.lastTokenType == tokenStartStatement {
 				l.rawMarker = emptyMarker
+				l.rawKeyword = rawKeyword
+			}
+		case tokenTrans:
+			if l.lastTokenType == tokenStartStatement {
+				l.rawMarker = emptyMarker
+				l.rawKeyword = transKeyword
 			}
 		case tokenIdentifier:
 			if l.lastTokenType == tokenRaw && l.rawMarker != nil {
@@ -232,6 +246,10 @@ func (l *lexer) scan() {
 
 		fileContext := l.ctx
 
+		// textContext is the context of the text outside of the tags. In a
+		// Markdown file, it is HTML in the HTML blocks.
+		textContext := fileContext
+
 		// Indicates if the current line contains only spaces. Used only for Markdown context.
 		spacesOnlyLine := true
 
@@ -239,6 +257,11 @@ func (l *lexer) scan() {
 
 		if l.ctx == ast.ContextMarkdown {
 			p, l.ctx = l.scanCodeBlock(0)
+			if l.ctx == ast.ContextMarkdown {
+				p, textContext = l.scanMarkdownLine(p)
+				l.ctx = textContext
+				l.tag.ctx = textContext
+			}
 		}
 
 	LOOP:
@@ -246,8 +269,10 @@ func (l *lexer) scan() {
 
 			c := l.src[p]
 
-			if l.ctx == ast.ContextMarkdown {
+			if fileContext == ast.ContextMarkdown {
 				spacesOnlyLine = spacesOnlyLine && isSpace(c)
+			}
+			if l.ctx == ast.ContextMarkdown {
 				if c == '\\' {
 					p++
 					l.column++
@@ -394,7 +419,7 @@ func (l *lexer) scan() {
 					// End tag.
 					l.ctx = l.tag.ctx
 					l.tag.name = ""
-					l.tag.ctx = fileContext
+					l.tag.ctx = textContext
 					if c == '/' {
 						p++
 						l.column++
@@ -462,13 +487,13 @@ func (l *lexer) scan() {
 								if bytes.EqualFold(typ, jsonLDMimeType) {
 									l.tag.ctx = ast.ContextJSON
 								} else if !bytes.EqualFold(typ, jsMimeType) {
-									l.tag.ctx = fileContext
+									l.tag.ctx = textContext
 								}
 							}
 						case "style":
 							if typ := bytes.TrimSpace(l.src[l.tag.index:p]); len(typ) > 0 {
 								if !bytes.EqualFold(typ, cssMimeType) {
-									l.tag.ctx = fileContext
+									l.tag.ctx = textContext
 								}
 							}
 						}
@@ -484,7 +509,7 @@ func (l *lexer) scan() {
 			case ast.ContextCSS:
 				if isHTML && c == '<' && isEndStyle(l.src[p:]) {
 					// </style>
-					l.ctx = fileContext
+					l.ctx = textContext
 					p += 7
 					l.column += 7
 				} else if c == '"' || c == '\'' {
@@ -504,7 +529,7 @@ func (l *lexer) scan() {
 					quote = 0
 				case '<':
 					if isHTML && isEndStyle(l.src[p:]) {
-						l.ctx = fileContext
+						l.ctx = textContext
 						quote = 0
 						p += 7
 						l.column += 7
@@ -514,7 +539,7 @@ func (l *lexer) scan() {
 			case ast.ContextJS:
 				if isHTML && c == '<' && isEndScript(l.src[p:]) {
 					// </script>
-					l.ctx = fileContext
+					l.ctx = textContext
 					p += 8
 					l.column += 8
 				} else if c == '"' || c == '\'' {
@@ -534,7 +559,7 @@ func (l *lexer) scan() {
 					quote = 0
 				case '<':
 					if isHTML && isEndScript(l.src[p:]) {
-						l.ctx = fileContext
+						l.ctx = textContext
 						quote = 0
 						p += 8
 						l.column += 8
@@ -544,7 +569,7 @@ func (l *lexer) scan() {
 			case ast.ContextJSON:
 				if isHTML && c == '<' && isEndScript(l.src[p:]) {
 					// </script>
-					l.ctx = fileContext
+					l.ctx = textContext
 					p += 8
 					l.column += 8
 				} else if c == '"' {
@@ -564,7 +589,7 @@ func (l *lexer) scan() {
 					quote = 0
 				case '<':
 					if isHTML && isEndScript(l.src[p:]) {
-						l.ctx = fileContext
+						l.ctx = textContext
 						quote = 0
 						p += 8
 						l.column += 8
@@ -588,6 +613,22 @@ func (l *lexer) scan() {
 					} else {
 						spacesOnlyLine = true
 					}
+				case ast.ContextHTML:
+					if textContext == ast.ContextHTML && fileContext == ast.ContextMarkdown {
+						if spacesOnlyLine {
+							// A blank line ends the HTML block.
+							textContext = ast.ContextMarkdown
+							l.tag.ctx = ast.ContextMarkdown
+							p, l.ctx = l.scanCodeBlock(p)
+						} else {
+							spacesOnlyLine = true
+						}
+					}
+				}
+				if l.ctx == ast.ContextMarkdown {
+					p, textContext = l.scanMarkdownLine(p)
+					l.ctx = textContext
+					l.tag.ctx = textContext
 				}
 				continue
 			}
@@ -642,6 +683,145 @@ func (l *lexer) scanCodeBlock(p int) (int, ast.Context) {
 	return p, ast.ContextMarkdown
 }
 
+// scanMarkdownLine scans the start of a Markdown line at p, that is not in a
+// code block.
+//
+// If the line starts a fenced code block, and the code fences are not
+// executed, it skips the code block, that is scanned as text, and returns
+// the position of the newline that ends the closing fence, or the end of the
+// source if the code block is not closed. If the line starts an HTML block,
+// it returns p and the HTML context. Otherwise, it returns p and the Markdown
+// context.
+func (l *lexer) scanMarkdownLine(p int) (int, ast.Context) {
+	i := p
+	for i < len(l.src) && i-p < 3 && l.src[i] == ' ' {
+		i++
+	}
+	if i == len(l.src) {
+		return p, ast.ContextMarkdown
+	}
+	switch c := l.src[i]; c {
+	case '`', '~':
+		if l.executeCodeFences {
+			break
+		}
+		n := 0
+		for i+n < len(l.src) && l.src[i+n] == c {
+			n++
+		}
+		if n < 3 {
+			break
+		}
+		end := bytes.IndexByte(l.src[i:], '\n')
+		if end == -1 {
+			end = len(l.src)
+		} else {
+			end += i
+		}
+		if c == '`' && bytes.IndexByte(l.src[i+n:end], '`') != -1 {
+			// A backtick fence cannot have backticks in the info string.
+			break
+		}
+		for end < len(l.src) && !isClosingFence(l.src[end+1:], c, n) {
+			e := bytes.IndexByte(l.src[end+1:], '\n')
+			if e == -1 {
+				end = len(l.src)
+			} else {
+				end += e + 1
+			}
+		}
+		if end < len(l.src) {
+			if e := bytes.IndexByte(l.src[end+1:], '\n'); e == -1 {
+				end = len(l.src)
+			} else {
+				end += e + 1
+			}
+		}
+		for ; p < end; p++ {
+			if c := l.src[p]; c == '\n' {
+				l.newline()
+			} else if isStartChar(c) {
+				l.column++
+			}
+		}
+		return end, ast.ContextMarkdown
+	case '<':
+		if isHTMLBlockStart(l.src[i+1:]) {
+			return p, ast.ContextHTML
+		}
+	}
+	return p, ast.ContextMarkdown
+}
+
+// isClosingFence reports whether the line s, that is the rest of the source
+// starting at a line, is a closing fence for a fenced code block opened by
+// n characters c.
+func isClosingFence(s []byte, c byte, n int) bool {
+	i := 0
+	for i < len(s) && i < 3 && s[i] == ' ' {
+		i++
+	}
+	m := 0
+	for i < len(s) && s[i] == c {
+		i++
+		m++
+	}
+	if m < n {
+		return false
+	}
+	for ; i < len(s) && s[i] != '\n'; i++ {
+		if s[i] != ' ' && s[i] != '\t' && s[i] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// htmlBlockTags contains the names of the tags that start an HTML block in
+// Markdown.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "base": true, "basefont": true,
+	"blockquote": true, "body": true, "caption": true, "center": true, "col": true,
+	"colgroup": true, "dd": true, "details": true, "dialog": true, "dir": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "frame": true, "frameset": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"head": true, "header": true, "hr": true, "html": true, "iframe": true,
+	"legend": true, "li": true, "link": true, "main": true, "menu": true,
+	"menuitem": true, "nav": true, "noframes": true, "ol": true, "optgroup": true,
+	"option": true, "p": true, "param": true, "pre": true, "script": true,
+	"search": true, "section": true, "style": true, "summary": true, "table": true,
+	"tbody": true, "td": true, "textarea": true, "tfoot": true, "th": true,
+	"thead": true, "title": true, "tr": true, "track": true, "ul": true,
+}
+
+// isHTMLBlockStart reports whether s, that follows a '<' character at the
+// start of a Markdown line, starts an HTML block. The HTML block ends at the
+// first blank line.
+func isHTMLBlockStart(s []byte) bool {
+	i := 0
+	if i < len(s) && s[i] == '/' {
+		i++
+	}
+	j := i
+	for j < len(s) && (isAlpha(s[j]) || j > i && isDecDigit(s[j])) {
+		j++
+	}
+	if j == i || !htmlBlockTags[strings.ToLower(string(s[i:j]))] {
+		return false
+	}
+	if j == len(s) {
+		return true
+	}
+	switch s[j] {
+	case ' ', '\t', '\n', '\r', '>':
+		return true
+	case '/':
+		return j+1 < len(s) && s[j+1] == '>'
+	}
+	return false
+}
+
 // containsURL reports whether the attribute attr of tag contains an URL or a
 // comma-separated list of URL.
 //
@@ -734,11 +914,11 @@ func (l *lexer) scanTag(p int) (string, int) {
 // returns the attribute name and the next position to scan.
 //
 // For example, if l.src[p:] is
-//    - `src="a"` it returns "src" and p+4
-//    - `src=a` it returns "src" and p+4
-//    - `src>` it returns "" and p+3
-//    - `src img` it returns "" and p+4.
-//    - `,` it returns "" and p.
+//   - `src="a"` it returns "src" and p+4
+//   - `src=a` it returns "src" and p+4
+//   - `src>` it returns "" and p+3
+//   - `src img` it returns "" and p+4.
+//   - `,` it returns "" and p.
 func (l *lexer) scanAttribute(p int) (string, int) {
 	// Reads the attribute name.
 	s := p
@@ -901,7 +1081,7 @@ func (l *lexer) lexComment() error {
 		}
 		if i > 0 && l.src[p+i-1] == '{' {
 			nested++
-		} else if i < len(l.src)-p && l.src[p+i+1] == '}' {
+		} else if p+i+1 < len(l.src) && l.src[p+i+1] == '}' {
 			nested--
 			p++
 		}
@@ -924,14 +1104,13 @@ func (l *lexer) lexComment() error {
 // lexCode emits code tokens returning as soon as encounters a token based on
 // the given end parameter.
 //
-//   if end is tokenEOF, it returns when encounters tokenEOF
+//	if end is tokenEOF, it returns when encounters tokenEOF
 //
-//   if end is tokenEndStatement or tokenEndStatements, it returns when
-//   encounters tokenEOF, tokenEndStatement or tokenEndStatements
-//
-//   if end is tokenRightBraces, it returns when encounters tokenEOF,
-//   tokenEndStatement, tokenEndStatements or tokenRightBraces
+//	if end is tokenEndStatement or tokenEndStatements, it returns when
+//	encounters tokenEOF, tokenEndStatement or tokenEndStatements
 //
+//	if end is tokenRightBraces, it returns when encounters tokenEOF,
+//	tokenEndStatement, tokenEndStatements or tokenRightBraces
 func (l *lexer) lexCode(end tokenTyp) error {
 	if len(l.src) == 0 {
 		if end != tokenEOF {
@@ -985,6 +1164,10 @@ LOOP:
 				l.emit(tokenEllipsis, 3)
 				l.column += 3
 				endLineAsSemicolon = false
+			} else if l.templateSyntax && len(l.src) > 1 && l.src[1] == '.' {
+				l.emit(tokenDoublePeriod, 2)
+				l.column += 2
+				endLineAsSemicolon = false
 			} else {
 				l.emit(tokenPeriod, 1)
 				l.column++
@@ -1120,6 +1303,9 @@ LOOP:
 						return l.errorf("unexpected %%}, expecting %s", end)
 					}
 				case '%':
+					if len(l.src) == 2 || l.src[2] != '}' {
+						break
+					}
 					switch end {
 					case tokenEndStatements:
 						if endLineAsSemicolon {
@@ -1225,6 +1411,18 @@ LOOP:
 				l.column++
 			}
 			endLineAsSemicolon = false
+		case '?':
+			if !l.templateSyntax {
+				return l.errorf("invalid character U+003F '?'")
+			}
+			if len(l.src) > 1 && l.src[1] == '.' && !(len(l.src) > 2 && '0' <= l.src[2] && l.src[2] <= '9') {
+				l.emit(tokenNilSafePeriod, 2)
+				l.column += 2
+			} else {
+				l.emit(tokenQuestionMark, 1)
+				l.column++
+			}
+			endLineAsSemicolon = false
 		case '$':
 			if l.extendedSyntax && l.dollarIdentifier {
 				l.emit(tokenDollar, 1)
@@ -1282,6 +1480,10 @@ LOOP:
 				l.column++
 			}
 			endLineAsSemicolon = false
+		case '~':
+			l.emit(tokenTilde, 1)
+			l.column++
+			endLineAsSemicolon = false
 		case ':':
 			if len(l.src) > 1 && l.src[1] == '=' {
 				l.emit(tokenDeclaration, 2)
@@ -1505,6 +1707,8 @@ func (l *lexer) lexIdentifierOrKeyword(s int) (tokenTyp, string) {
 			typ = tokenRender
 		case "show":
 			typ = tokenShow
+		case "trans":
+			typ = tokenTrans
 		case "using":
 			typ = tokenUsing
 		}
@@ -1621,6 +1825,10 @@ DIGITS:
 				if dot || exponent != 0 {
 					break DIGITS
 				}
+				if l.templateSyntax && p+1 < len(l.src) && l.src[p+1] == '.' {
+					// Integer range as in "1..10".
+					break DIGITS
+				}
 				if base == 8 && !is0o {
 					base = 10
 				}
@@ -1954,14 +2162,14 @@ func (l *lexer) lexRuneLiteral() error {
 	return nil
 }
 
-// skipRawContent skips the content of a raw statement, updating l.line and
-// l.column, and returns the index of the end statement or EOF if there is no
-// end statement.
+// skipRawContent skips the content of a raw or trans statement, updating
+// l.line and l.column, and returns the index of the end statement or EOF if
+// there is no end statement.
 //
 // It expects that l.rawMarker is not nil and l.src starts with the raw
 // content.
 func (l *lexer) skipRawContent() int {
-	p := endRawIndex(l.src, l.rawMarker)
+	p := endRawIndex(l.src, l.rawKeyword, l.rawMarker)
 	if p == 0 {
 		return 0
 	}
@@ -1980,13 +2188,14 @@ func (l *lexer) skipRawContent() int {
 }
 
 // endRawIndex returns the index of the first instance of the end of a raw
-// statement in src with the given marker, or -1 if it is not present.
-// If the raw statement has no marker, marker's length is zero.
+// statement in src with the given keyword, "raw" or "trans", and marker, or
+// -1 if it is not present. If the raw statement has no marker, marker's
+// length is zero.
 //
 // It allows the syntax {% end marker %} and allows non-printable characters
 // as spaces (see the skipRawSpaces function) for which the parser will still
 // returns an error.
-func endRawIndex(src []byte, marker []byte) int {
+func endRawIndex(src []byte, keyword, marker []byte) int {
 	for i := 0; i < len(src); i++ {
 		j := bytes.IndexByte(src[i:], '{')
 		if j == -1 {
@@ -2007,14 +2216,14 @@ func endRawIndex(src []byte, marker []byte) int {
 		}
 		i += 3
 		i = skipRawSpaces(src, i)
-		// Read 'raw'.
-		if isSpace(src[i-1]) && len(src) >= i+3 && src[i] == 'r' && src[i+1] == 'a' && src[i+2] == 'w' {
-			i += 3
+		// Read the keyword.
+		if k := len(keyword); isSpace(src[i-1]) && len(src) >= i+k && bytes.Equal(src[i:i+k], keyword) {
+			i += k
 			i = skipRawSpaces(src, i)
 		}
 		// Read the marker.
 		if l := len(marker); l > 0 {
-			if len(src) < i+l || !bytes.Equal(src[i:i+l], marker) {
+			if !isSpace(src[i-1]) || len(src) < i+l || !bytes.Equal(src[i:i+l], marker) {
 				i = p
 				continue
 			}
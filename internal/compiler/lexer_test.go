@@ -42,6 +42,9 @@ var typeTestsText = map[string][]tokenTyp{
 	"{% for a;\n\t%}":              {tokenStartStatement, tokenFor, tokenIdentifier, tokenSemicolon, tokenEndStatement},
 	"{% for in %}":                 {tokenStartStatement, tokenFor, tokenIn, tokenEndStatement},
 	"{% for range %}":              {tokenStartStatement, tokenFor, tokenRange, tokenEndStatement},
+	"{% for i in 1..10 %}":         {tokenStartStatement, tokenFor, tokenIdentifier, tokenIn, tokenInt, tokenDoublePeriod, tokenInt, tokenEndStatement},
+	"{% for i in a .. b %}":        {tokenStartStatement, tokenFor, tokenIdentifier, tokenIn, tokenIdentifier, tokenDoublePeriod, tokenIdentifier, tokenEndStatement},
+	"{% for i in 1.5..2 %}":        {tokenStartStatement, tokenFor, tokenIdentifier, tokenIn, tokenFloat, tokenDoublePeriod, tokenInt, tokenEndStatement},
 	"{%end%}":                      {tokenStartStatement, tokenEnd, tokenEndStatement},
 	"{%\tend\n%}":                  {tokenStartStatement, tokenEnd, tokenEndStatement},
 	"{% end %}":                    {tokenStartStatement, tokenEnd, tokenEndStatement},
@@ -75,6 +78,7 @@ var typeTestsText = map[string][]tokenTyp{
 	"{% show `a`, 7, true %}":      {tokenStartStatement, tokenShow, tokenRawString, tokenComma, tokenInt, tokenComma, tokenIdentifier, tokenEndStatement},
 	"{%% a := 1  %%}":              {tokenStartStatements, tokenIdentifier, tokenDeclaration, tokenInt, tokenSemicolon, tokenEndStatements},
 	"{%% var a int;\na = 1; %%}":   {tokenStartStatements, tokenVar, tokenIdentifier, tokenIdentifier, tokenSemicolon, tokenIdentifier, tokenSimpleAssignment, tokenInt, tokenSemicolon, tokenEndStatements},
+	"{%% a %% b %%}":               {tokenStartStatements, tokenIdentifier, tokenModulo, tokenModulo, tokenIdentifier, tokenSemicolon, tokenEndStatements},
 	"{# comment #}":                {tokenComment},
 	"{# nested {# comment #} #}":   {tokenComment},
 	`a{{b}}c`:                      {tokenText, tokenLeftBraces, tokenIdentifier, tokenRightBraces, tokenText},
@@ -184,6 +188,9 @@ var typeTestsText = map[string][]tokenTyp{
 	"{{ a(1) }}":            {tokenLeftBraces, tokenIdentifier, tokenLeftParenthesis, tokenInt, tokenRightParenthesis, tokenRightBraces},
 	"{{ a(1,2) }}":          {tokenLeftBraces, tokenIdentifier, tokenLeftParenthesis, tokenInt, tokenComma, tokenInt, tokenRightParenthesis, tokenRightBraces},
 	"{{ a.b }}":             {tokenLeftBraces, tokenIdentifier, tokenPeriod, tokenIdentifier, tokenRightBraces},
+	"{{ a?.b }}":            {tokenLeftBraces, tokenIdentifier, tokenNilSafePeriod, tokenIdentifier, tokenRightBraces},
+	"{{ a ? b : c }}":       {tokenLeftBraces, tokenIdentifier, tokenQuestionMark, tokenIdentifier, tokenColon, tokenIdentifier, tokenRightBraces},
+	"{{ a?.5:c }}":          {tokenLeftBraces, tokenIdentifier, tokenQuestionMark, tokenFloat, tokenColon, tokenIdentifier, tokenRightBraces},
 	"{{ \"\" }}":            {tokenLeftBraces, tokenInterpretedString, tokenRightBraces},
 	"{{ \"\\u09AF\" }}":     {tokenLeftBraces, tokenInterpretedString, tokenRightBraces},
 	"{{ \"\\u09af\" }}":     {tokenLeftBraces, tokenInterpretedString, tokenRightBraces},
@@ -206,6 +213,8 @@ var typeTestsText = map[string][]tokenTyp{
 	"{% raw %}t{% end %}":           {tokenStartStatement, tokenRaw, tokenEndStatement, tokenText, tokenStartStatement, tokenEnd, tokenEndStatement},
 	"{% raw %}{% if {% end %}":      {tokenStartStatement, tokenRaw, tokenEndStatement, tokenText, tokenStartStatement, tokenEnd, tokenEndStatement},
 	"{% raw %} if %}{% end %}":      {tokenStartStatement, tokenRaw, tokenEndStatement, tokenText, tokenStartStatement, tokenEnd, tokenEndStatement},
+	"{% trans %}t{% end %}":         {tokenStartStatement, tokenTrans, tokenEndStatement, tokenText, tokenStartStatement, tokenEnd, tokenEndStatement},
+	"{% trans %}{{a}}{%end trans%}": {tokenStartStatement, tokenTrans, tokenEndStatement, tokenText, tokenStartStatement, tokenEnd, tokenTrans, tokenEndStatement},
 	"{{ a default b }}":             {tokenLeftBraces, tokenIdentifier, tokenDefault, tokenIdentifier, tokenRightBraces},
 	"{% a = itea; using %}":         {tokenStartStatement, tokenIdentifier, tokenSimpleAssignment, tokenIdentifier, tokenSemicolon, tokenUsing, tokenEndStatement},
 	"{% a = itea(); using macro %}": {tokenStartStatement, tokenIdentifier, tokenSimpleAssignment, tokenIdentifier, tokenLeftParenthesis, tokenRightParenthesis, tokenSemicolon, tokenUsing, tokenMacro, tokenEndStatement},
@@ -439,15 +448,32 @@ var contextTests = map[ast.Context]map[string][]ast.Context{
 		" \t\n\t{{a}}":                  {ast.ContextText, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock},
 		"\t \n    {{a}}":                {ast.ContextText, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock},
 		"{# #}\n\t{{a}}":                {ast.ContextMarkdown, ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		"<style>s{{a}}t</style>{{a}}":   {ast.ContextText, ast.ContextCSS, ast.ContextCSS, ast.ContextCSS, ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		"<script>s{{a}}t</script>{{a}}": {ast.ContextText, ast.ContextJS, ast.ContextJS, ast.ContextJS, ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		`<script type="application/ld+json">s{{a}}t</script>{{a}}`: {ast.ContextText, ast.ContextJSON, ast.ContextJSON, ast.ContextJSON, ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		`a\{{a}\}a`:                {ast.ContextText},
-		`a\<a href="{{a}}}">s</a>`: {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextText},
-		"a\\\n{{a}}":               {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		`a\`:                       {ast.ContextText},
-		"a\n\\[\n\t{{a}}":          {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
-		"\t\\{{a}}":                {ast.ContextText, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock},
+		"<style>s{{a}}t</style>{{a}}":   {ast.ContextText, ast.ContextCSS, ast.ContextCSS, ast.ContextCSS, ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		"<script>s{{a}}t</script>{{a}}": {ast.ContextText, ast.ContextJS, ast.ContextJS, ast.ContextJS, ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		`<script type="application/ld+json">s{{a}}t</script>{{a}}`: {ast.ContextText, ast.ContextJSON, ast.ContextJSON, ast.ContextJSON, ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		"<script>s</script>\n\n{{a}}":                              {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"a <style>s</style>{{a}}":                                  {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"<div>\n{{a}}\n\n{{a}}":                                    {ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML, ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"  <DIV class=\"{{a}}\">\n{{a}}":                           {ast.ContextText, ast.ContextQuotedAttr, ast.ContextQuotedAttr, ast.ContextQuotedAttr, ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		"</div>\n \n    {{a}}":                                     {ast.ContextText, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock},
+		"a\n<p/>{{a}}":                                             {ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		"<span>{{a}}</span>":                                       {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextText},
+		"<divs>{{a}}":                                              {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"    <div>{{a}}":                                           {ast.ContextText, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock},
+		"```\n{{a}}\n```\n{{a}}":                                   {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"~~~~ go\n{{a}}\n~~~\n~~~~ \n{{a}}":                        {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"a\n   ```\n{% a %}\n{{a}}":                                {ast.ContextText},
+		"```\n{{a}}\n```\n    {{a}}":                               {ast.ContextText, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock, ast.ContextSpacesCodeBlock},
+		"``` a`b\n{{a}}":                                           {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"``\n{{a}}":                                                {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"    ```\n{{a}}":                                           {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"<div>\n```\n{{a}}":                                        {ast.ContextText, ast.ContextHTML, ast.ContextHTML, ast.ContextHTML},
+		`a\{{a}\}a`:                                                {ast.ContextText},
+		`a\<a href="{{a}}}">s</a>`:                                 {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextText},
+		"a\\\n{{a}}":                                               {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		`a\`:                                                       {ast.ContextText},
+		"a\n\\[\n\t{{a}}":                                          {ast.ContextText, ast.ContextMarkdown, ast.ContextMarkdown, ast.ContextMarkdown},
+		"\t\\{{a}}":                                                {ast.ContextText, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock, ast.ContextTabCodeBlock},
 	},
 	ast.ContextTabCodeBlock: {
 		`a`:       {ast.ContextText},
@@ -598,7 +624,7 @@ TYPES:
 	for source, types := range test {
 		var lex *lexer
 		if isTemplate {
-			lex = scanTemplate([]byte(source), format, true, false, true)
+			lex = scanTemplate([]byte(source), format, true, false, true, false)
 		} else {
 			lex = scanScript([]byte(source))
 		}
@@ -688,7 +714,7 @@ func TestLexerMacroOrUsingContexts(t *testing.T) {
 CONTEXTS:
 	for source, contexts := range macroAndUsingContextTests {
 		text := []byte(source)
-		lex := scanTemplate(text, ast.FormatText, false, false, false)
+		lex := scanTemplate(text, ast.FormatText, false, false, false, false)
 		var i int
 		for tok := range lex.Tokens() {
 			if tok.typ == tokenEOF {
@@ -718,7 +744,7 @@ CONTEXTS:
 
 func TestPositions(t *testing.T) {
 	for _, test := range positionTests {
-		var lex = scanTemplate([]byte(test.src), ast.FormatHTML, false, false, false)
+		var lex = scanTemplate([]byte(test.src), ast.FormatHTML, false, false, false, false)
 		var i int
 		for tok := range lex.Tokens() {
 			if tok.typ == tokenEOF {
@@ -830,6 +856,8 @@ var endRawIndexTests = []struct {
 	{"ab {% end raw", "", -1},
 	{"ab {% end raw code %} cd", "code", 3},
 	{"ab {% end code %} cd", "code", 3},
+	{"ab {% endcode %} cd", "code", -1},
+	{"ab {% end rawcode %} cd", "code", -1},
 	{"ab {% end raw doc %} cd", "code", -1},
 	{"ab {% end raw doc %} {% end raw code %} cd", "code", 21},
 	{"ab {%\tend\r\n%}", "", 3},
@@ -837,21 +865,36 @@ var endRawIndexTests = []struct {
 	{"ab {% \uFFFD end %}", "", -1},
 }
 
+var endTransIndexTests = []struct {
+	src   string
+	index int
+}{
+	{"ab {% end %} cd", 3},
+	{"ab {% end trans %} cd", 3},
+	{"ab {% end raw %} {% end trans %} cd", 17},
+	{"ab {% end transx %} cd", -1},
+}
+
 func TestLexRawContent(t *testing.T) {
 	for _, test := range endRawIndexTests {
 		var marker []byte
 		if test.marker != "" {
 			marker = []byte(test.marker)
 		}
-		if i := endRawIndex([]byte(test.src), marker); i != test.index {
+		if i := endRawIndex([]byte(test.src), rawKeyword, marker); i != test.index {
 			t.Errorf("source: %q, marker: %q: unexpected index %d, expecting %d",
 				test.src, test.marker, i, test.index)
 		}
 	}
+	for _, test := range endTransIndexTests {
+		if i := endRawIndex([]byte(test.src), transKeyword, nil); i != test.index {
+			t.Errorf("source: %q: unexpected trans index %d, expecting %d", test.src, i, test.index)
+		}
+	}
 }
 
 func TestNoParseShow(t *testing.T) {
-	var lex = scanTemplate([]byte("a{{ v }}b"), ast.FormatHTML, false, true, false)
+	var lex = scanTemplate([]byte("a{{ v }}b"), ast.FormatHTML, false, true, false, false)
 	tokens := lex.Tokens()
 	if tok := <-tokens; tok.typ != tokenText {
 		t.Errorf("unexpected token %s, expecting text", tok)
@@ -862,6 +905,38 @@ func TestNoParseShow(t *testing.T) {
 	lex.Stop()
 }
 
+func TestCodeFences(t *testing.T) {
+	src := "a\n```go\n{{ v }}\n```\n{{ v }}"
+	// The fenced code block is text.
+	lex := scanTemplate([]byte(src), ast.FormatMarkdown, false, false, false, false)
+	tokens := lex.Tokens()
+	if tok := <-tokens; tok.typ != tokenText || string(tok.txt) != "a\n```go\n{{ v }}\n```\n" {
+		t.Errorf("unexpected token %s, expecting text", tok)
+	}
+	if tok := <-tokens; tok.typ != tokenLeftBraces || tok.pos.Line != 5 || tok.pos.Column != 1 || tok.pos.Start != 20 {
+		t.Errorf("unexpected token %s at %s, expecting {{ at 5:1", tok, tok.pos)
+	}
+	lex.Stop()
+	// The fenced code block is executed.
+	lex = scanTemplate([]byte(src), ast.FormatMarkdown, false, false, false, true)
+	tokens = lex.Tokens()
+	if tok := <-tokens; tok.typ != tokenText || string(tok.txt) != "a\n```go\n" {
+		t.Errorf("unexpected token %s, expecting text", tok)
+	}
+	if tok := <-tokens; tok.typ != tokenLeftBraces || tok.pos.Line != 3 || tok.pos.Column != 1 || tok.pos.Start != 8 {
+		t.Errorf("unexpected token %s at %s, expecting {{ at 3:1", tok, tok.pos)
+	}
+	lex.Stop()
+	// Fences are not recognized in other formats.
+	lex = scanTemplate([]byte(src), ast.FormatText, false, false, false, false)
+	tokens = lex.Tokens()
+	<-tokens
+	if tok := <-tokens; tok.typ != tokenLeftBraces || tok.pos.Line != 3 {
+		t.Errorf("unexpected token %s, expecting {{ at line 3", tok)
+	}
+	lex.Stop()
+}
+
 // TestNumbers tests the lexNumber method. The tests are adapted from the
 // tests in the "/src/cmd/compile/internal/syntax/scanner_test.go" file in the
 // Go repository. That file is copyright "The Go Authors".
@@ -14,7 +14,8 @@ import (
 // A LimitExceededError is an error returned by the compiler reporting that the
 // compilation has exceeded a limit imposed by the implementation.
 type LimitExceededError struct {
-	// pos is the position of the function that cannot be compiled.
+	// pos is the position of the statement, or of the function, that
+	// cannot be compiled.
 	pos *ast.Position
 	// path of file in which the function is defined.
 	path string
@@ -23,7 +24,7 @@ type LimitExceededError struct {
 }
 
 // newLimitExceededError returns a new LimitError that occurred in the file path
-// inside a function declared at the given pos.
+// at the given pos.
 func newLimitExceededError(pos *runtime.Position, path, format string, a ...interface{}) *LimitExceededError {
 	astPos := &ast.Position{
 		Line:   pos.Line,
@@ -38,7 +39,8 @@ func newLimitExceededError(pos *runtime.Position, path, format string, a ...inte
 	}
 }
 
-// Position returns the position of the function that caused the LimitError.
+// Position returns the position of the statement, or of the function, that
+// caused the LimitError.
 func (e *LimitExceededError) Position() ast.Position {
 	return *e.pos
 }
@@ -15,7 +15,7 @@ import (
 
 func newTestBuilder() *functionBuilder {
 	fn := newFunction("", "", reflect.FuncOf(nil, nil, false), "", &ast.Position{})
-	return newBuilder(fn, "")
+	return newBuilder(fn, "", 0)
 }
 
 func TestRegistersLimit(t *testing.T) {
@@ -56,6 +56,46 @@ func TestRegistersLimit(t *testing.T) {
 	}
 }
 
+func TestWideRegistersLimit(t *testing.T) {
+	cases := []reflect.Kind{
+		reflect.Int,
+		reflect.String,
+		reflect.Float64,
+		reflect.Interface,
+	}
+	for _, kind := range cases {
+		t.Run(kind.String(), func(t *testing.T) {
+
+			var i int
+
+			defer func() {
+				r := recover()
+				if r == nil {
+					t.Fatal("test should have failed")
+				} else {
+					if _, ok := r.(*LimitExceededError); ok {
+						// The type of the error is correct. Now check if the
+						// test panicked at the correct index.
+						if maxWideRegistersCount != i {
+							t.Fatalf("test should have panicked at index %d, but it panicked at index %d", maxWideRegistersCount, i)
+						}
+					} else {
+						t.Fatalf("expecting a LimitExceededError, got error %s (of type %T)", r, r)
+					}
+				}
+			}()
+
+			fb := newTestBuilder()
+			for i = 0; i < 40000; i++ {
+				if reg := fb.newWideRegister(kind); reg != int16(maxRegistersCount+i+1) {
+					t.Fatalf("expected wide register %d, got %d", maxRegistersCount+i+1, reg)
+				}
+			}
+
+		})
+	}
+}
+
 func TestFunctionsLimit(t *testing.T) {
 
 	var i int
@@ -0,0 +1,91 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"time"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/runtime"
+)
+
+// Metrics contains the metrics of a compilation.
+type Metrics struct {
+	// ParseTime, CheckTime and EmitTime are the durations of the parsing,
+	// including the tree transformation, of the type checking and of the
+	// emission.
+	ParseTime time.Duration
+	CheckTime time.Duration
+	EmitTime  time.Duration
+	// Nodes is the number of nodes of the parsed trees, including the trees
+	// of the extended, imported and rendered files.
+	Nodes int
+	// Functions contains the metrics of the emitted functions.
+	Functions []FunctionMetrics
+}
+
+// FunctionMetrics contains the metrics of an emitted function.
+type FunctionMetrics struct {
+	Pkg  string
+	Name string // empty for function literals.
+	File string
+	// Registers is the number of registers used by the function for each
+	// register type: int, float, string and general.
+	Registers [4]int
+}
+
+// countNodes returns the number of nodes of tree, including the nodes of the
+// trees of the extended, imported and rendered files.
+func countNodes(tree *ast.Tree) int {
+	n := 0
+	counted := map[*ast.Tree]bool{}
+	var count func(*ast.Tree)
+	count = func(tree *ast.Tree) {
+		if tree == nil || counted[tree] {
+			return
+		}
+		counted[tree] = true
+		astutil.Inspect(tree, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case nil:
+				return false
+			case *ast.Extends:
+				count(node.Tree)
+			case *ast.Import:
+				count(node.Tree)
+			case *ast.Render:
+				count(node.Tree)
+			}
+			n++
+			return true
+		})
+	}
+	count(tree)
+	return n
+}
+
+// functionMetrics returns the metrics of main and of the functions, including
+// the function literals, that it references directly or indirectly.
+func functionMetrics(main *runtime.Function) []FunctionMetrics {
+	functions := []*runtime.Function{main}
+	added := map[*runtime.Function]bool{main: true}
+	metrics := []FunctionMetrics{}
+	for i := 0; i < len(functions); i++ {
+		fn := functions[i]
+		m := FunctionMetrics{Pkg: fn.Pkg, Name: fn.Name, File: fn.File}
+		for t, n := range fn.NumReg {
+			m.Registers[t] = int(n)
+		}
+		metrics = append(metrics, m)
+		for _, f := range fn.Functions {
+			if !added[f] {
+				functions = append(functions, f)
+				added[f] = true
+			}
+		}
+	}
+	return metrics
+}
@@ -107,6 +107,30 @@ func firstNonSpacePosition(tok token) *ast.Position {
 	return nil
 }
 
+// parserLimits represents the limits of the parsing of a template file.
+// A zero value means no limit.
+type parserLimits struct {
+	exprDepth int // maximum depth of nested expressions.
+	nesting   int // maximum depth of nested statements.
+	fileSize  int // maximum size of the file in bytes.
+}
+
+// offsetPosition returns the position of the byte of src at offset n.
+func offsetPosition(src []byte, n int) *ast.Position {
+	pos := &ast.Position{Line: 1, Column: 1, Start: n, End: n}
+	for i := 0; i < n; {
+		r, size := utf8.DecodeRune(src[i:])
+		if r == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+		i += size
+	}
+	return pos
+}
+
 // parsing is a parsing state.
 type parsing struct {
 
@@ -134,11 +158,39 @@ type parsing struct {
 
 	// Unexpanded Extends, Import and Render nodes.
 	unexpanded []ast.Node
+
+	// Parsing limits.
+	limits parserLimits
+
+	// Depth of the expression currently parsed.
+	exprDepth int
 }
 
-// addToAncestors adds node to the ancestors.
+// addToAncestors adds node to the ancestors. It panics with a syntax error
+// if the limit on the nesting of the statements is exceeded.
 func (p *parsing) addToAncestors(node ast.Node) {
 	p.ancestors = append(p.ancestors, node)
+	if p.limits.nesting > 0 && p.nesting() > p.limits.nesting {
+		pos := node.Pos()
+		for i := len(p.ancestors) - 2; pos == nil; i-- {
+			pos = p.ancestors[i].Pos()
+		}
+		panic(syntaxError(pos, "statements nested too deeply (maximum depth is %d)", p.limits.nesting))
+	}
+}
+
+// nesting returns the depth of the nested statements, that is the number of
+// blocks, including the bodies of the for, switch and select statements,
+// among the ancestors.
+func (p *parsing) nesting() int {
+	depth := 0
+	for _, node := range p.ancestors[1:] {
+		switch node.(type) {
+		case *ast.Block, *ast.For, *ast.ForIn, *ast.ForRange, *ast.Switch, *ast.TypeSwitch, *ast.Select:
+			depth++
+		}
+	}
+	return depth
 }
 
 // removeLastAncestor removes the last ancestor from the ancestors.
@@ -240,19 +292,32 @@ func parseSource(src []byte, script bool) (tree *ast.Tree, err error) {
 // format can be Text, HTML, CSS, JS, JSON and Markdown. imported indicates
 // whether it is imported.
 func ParseTemplateSource(src []byte, format ast.Format, parseShebang, imported, noParseShow, dollarIdentifier bool) (tree *ast.Tree, unexpanded []ast.Node, err error) {
+	return parseTemplateSource(src, format, parseShebang, imported, noParseShow, dollarIdentifier, false, parserLimits{})
+}
+
+// parseTemplateSource is like ParseTemplateSource but parses src with the
+// given limits. If a limit is exceeded, it returns a syntax error. If
+// executeCodeFences is true, the fenced code blocks of a Markdown source are
+// parsed as the rest of the source, otherwise they are parsed as text.
+func parseTemplateSource(src []byte, format ast.Format, parseShebang, imported, noParseShow, dollarIdentifier, executeCodeFences bool, limits parserLimits) (tree *ast.Tree, unexpanded []ast.Node, err error) {
 
 	if format < ast.FormatText || format > ast.FormatMarkdown {
 		return nil, nil, errors.New("scriggo: invalid format")
 	}
 
+	if limits.fileSize > 0 && len(src) > limits.fileSize {
+		return nil, nil, syntaxError(offsetPosition(src, limits.fileSize), "file size exceeds the maximum of %d bytes", limits.fileSize)
+	}
+
 	tree = ast.NewTree("", nil, format)
 
 	var p = &parsing{
-		lex:        scanTemplate(src, format, parseShebang, noParseShow, dollarIdentifier),
+		lex:        scanTemplate(src, format, parseShebang, noParseShow, dollarIdentifier, executeCodeFences),
 		format:     format,
 		imported:   imported,
 		ancestors:  []ast.Node{tree},
 		unexpanded: []ast.Node{},
+		limits:     limits,
 	}
 
 	defer func() {
@@ -451,6 +516,8 @@ func ParseTemplateSource(src []byte, format ast.Format, parseShebang, imported,
 			stmt = "select"
 		case *ast.Switch, *ast.TypeSwitch:
 			stmt = "switch"
+		case *ast.Trans:
+			stmt = "trans"
 		}
 		if marker != "" {
 			return nil, nil, syntaxError(tok.pos, "unexpected EOF, expecting {%% end raw %s %%}", marker)
@@ -629,8 +696,21 @@ LABEL:
 			assignment.End = expr.Pos().End
 			pos.End = tok.pos.End
 			node = ast.NewForRange(pos, assignment, nil, nil)
-		case tokenIn:
+		case tokenIn, tokenIdentifier:
 			// Parse: {% for id in expr %}
+			//        {% for parallel id in expr %}
+			parallel := false
+			if tok.typ == tokenIdentifier {
+				if ident, ok := init.(*ast.Identifier); !ok || ident.Name != "parallel" || !p.lex.templateSyntax {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+				}
+				parallel = true
+				init = ast.NewIdentifier(tok.pos, string(tok.txt))
+				tok = p.next()
+				if tok.typ != tokenIn {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting in", tok))
+				}
+			}
 			if init == nil {
 				panic(syntaxError(tok.pos, "unexpected in, expecting expression"))
 			}
@@ -643,7 +723,18 @@ LABEL:
 			if expr == nil {
 				panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
 			}
-			node = ast.NewForIn(pos, ident, expr, nil, nil)
+			if tok.typ == tokenDoublePeriod {
+				// Parse: {% for id in low..high %}
+				var high ast.Expression
+				high, tok = p.parseExpr(p.next(), false, false, false, true)
+				if high == nil {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+				}
+				expr = ast.NewRange(expr.Pos().WithEnd(high.Pos().End), expr, high)
+			}
+			forIn := ast.NewForIn(pos, ident, expr, nil, nil)
+			forIn.Parallel = parallel
+			node = forIn
 		default:
 			panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
 		}
@@ -793,6 +884,9 @@ LABEL:
 
 	// }
 	case tokenRightBrace:
+		if _, ok := p.parent().(*ast.Label); ok {
+			p.removeLastAncestor()
+		}
 		var unexpected bool
 		switch end {
 		case tokenEOF:
@@ -807,9 +901,6 @@ LABEL:
 		if unexpected {
 			panic(syntaxError(tok.pos, "unexpected }, expecting statement"))
 		}
-		if _, ok := p.parent().(*ast.Label); ok {
-			p.removeLastAncestor()
-		}
 		bracesEnd := tok.pos.End
 		p.parent().Pos().End = bracesEnd
 		tok = p.next()
@@ -894,9 +985,13 @@ LABEL:
 			panic(syntaxError(tok.pos, "unexpected else"))
 		}
 		p.removeLastAncestor()
-		if _, ok := p.parent().(*ast.If); !ok {
+		n, ok := p.parent().(*ast.If)
+		if !ok {
 			panic(syntaxError(tok.pos, "unexpected else at end of statement"))
 		}
+		if n.Else != nil {
+			panic(syntaxError(tok.pos, "unexpected else"))
+		}
 		p.cutSpacesToken = true
 		tok = p.next()
 		if end == tokenEndStatement && tok.typ == tokenEndStatement || end != tokenEndStatement && tok.typ == tokenLeftBrace {
@@ -956,11 +1051,9 @@ LABEL:
 		pos := tok.pos
 		tok = p.next()
 		var values []ast.Expression
-		if end == tokenEOF {
-			values, tok = p.parseExprList(tok, false, false, false)
-			if values != nil {
-				pos.End = values[len(values)-1].Pos().End
-			}
+		values, tok = p.parseExprList(tok, false, false, false)
+		if values != nil {
+			pos.End = values[len(values)-1].Pos().End
 		}
 		node := ast.NewReturn(pos, values)
 		p.addNode(node)
@@ -1217,6 +1310,10 @@ LABEL:
 					}
 					tok = p.next()
 				}
+			case *ast.Trans:
+				if tok.typ != tokenTrans {
+					panic(syntaxError(pos, "unexpected %s, expecting trans or %%}", tok))
+				}
 			case *ast.Using:
 				if tok.typ != tokenUsing {
 					panic(syntaxError(pos, "unexpected %s, expecting using or %%}", tok))
@@ -1298,8 +1395,8 @@ LABEL:
 	// goto
 	case tokenGoto:
 		pos := tok.pos
-		if end != tokenEOF {
-			panic(syntaxError(tok.pos, "goto statement outside function body"))
+		if end == tokenEndStatement {
+			panic(syntaxError(tok.pos, "cannot use goto between {%% and %%}"))
 		}
 		tok = p.next()
 		if tok.typ != tokenIdentifier {
@@ -1348,6 +1445,23 @@ LABEL:
 		tok = p.parseEnd(tok, tokenSemicolon, end)
 		return tok
 
+	// trans
+	case tokenTrans:
+		if end == tokenEndStatements {
+			panic(syntaxError(tok.pos, "cannot use trans between {%%%% and %%%%}"))
+		}
+		switch tok.ctx {
+		case ast.ContextText, ast.ContextHTML, ast.ContextMarkdown:
+		default:
+			panic(syntaxError(tok.pos, "cannot use trans in %s", tok.ctx))
+		}
+		node := ast.NewTrans(tok.pos, nil)
+		p.addNode(node)
+		p.cutSpacesToken = true
+		tok = p.next()
+		tok = p.parseEnd(tok, tokenSemicolon, end)
+		return tok
+
 	// func
 	case tokenFunc:
 		if end != tokenEndStatement {
@@ -1602,7 +1716,13 @@ func (p *parsing) parseTypeDecl(tok token) (*ast.TypeDeclaration, token) {
 		tok = p.next()
 	}
 	var typ ast.Expression
-	typ, tok = p.parseExpr(tok, false, false, true, false)
+	if tok.typ == tokenLeftBracket && !alias {
+		// Parse an array or slice type, as "type T [N]E", distinguishing it
+		// from a generic type, as "type T[P any] E".
+		typ, tok = p.parseTypeDeclArray(tok)
+	} else {
+		typ, tok = p.parseExpr(tok, false, false, true, false)
+	}
 	if typ == nil {
 		panic(syntaxError(tok.pos, "unexpected %s in type declaration", tok))
 	}
@@ -1610,6 +1730,46 @@ func (p *parsing) parseTypeDecl(tok token) (*ast.TypeDeclaration, token) {
 	return node, tok
 }
 
+// parseTypeDeclArray parses the array or slice type of a type declaration
+// starting with the token '['. It returns a syntax error if the type
+// declaration is a generic type.
+func (p *parsing) parseTypeDeclArray(tok token) (ast.Expression, token) {
+	pos := tok.pos
+	tok = p.next()
+	var length ast.Expression
+	isEllipsis := false
+	switch tok.typ {
+	case tokenRightBracket:
+	case tokenEllipsis:
+		isEllipsis = true
+		tok = p.next()
+	default:
+		length, tok = p.parseExpr(tok, false, false, false, false)
+		if length == nil {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+		}
+		if _, ok := length.(*ast.Identifier); ok {
+			switch tok.typ {
+			case tokenIdentifier, tokenComma, tokenInterface, tokenTilde, tokenLeftBracket, tokenFunc, tokenMap, tokenChan:
+				panic(syntaxError(length.Pos(), "generic types are not supported in this release of Scriggo"))
+			}
+		}
+	}
+	if tok.typ != tokenRightBracket {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting ]", tok))
+	}
+	var typ ast.Expression
+	typ, tok = p.parseExpr(p.next(), false, false, true, false)
+	if typ == nil {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+	}
+	pos.End = typ.Pos().End
+	if length == nil && !isEllipsis {
+		return ast.NewSliceType(pos, typ), tok
+	}
+	return ast.NewArrayType(pos, length, typ), tok
+}
+
 // group is nil if parseVarOrConst is called when not in a declaration group.
 func (p *parsing) parseVarOrConst(tok token, pos *ast.Position, decType tokenTyp, iotaValue int) (ast.Node, token) {
 	if tok.typ != tokenIdentifier {
@@ -1791,6 +1951,9 @@ func (p *parsing) parseAssignment(variables []ast.Expression, tok token, canBeRa
 	if !ok {
 		panic(syntaxError(tok.pos, "unexpected %s, expecting := or = or comma", tok))
 	}
+	if len(variables) == 0 {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+	}
 	vp := variables[0].Pos()
 	pos := vp.WithEnd(tok.pos.End)
 	var values []ast.Expression
@@ -1902,6 +2065,8 @@ func (p *parsing) addNode(node ast.Node) {
 		p.removeLastAncestor()
 	case *ast.Raw:
 		n.Text = node.(*ast.Text)
+	case *ast.Trans:
+		n.Text = node.(*ast.Text)
 	default:
 		panic("scriggo/parser: unexpected parent node")
 	}
@@ -1930,7 +2095,8 @@ func (p *parsing) addNode(node ast.Node) {
 		*ast.Label,
 		*ast.Statements,
 		*ast.URL,
-		*ast.Raw:
+		*ast.Raw,
+		*ast.Trans:
 		p.addToAncestors(n)
 	}
 }
@@ -20,6 +20,14 @@ import (
 // whether a left brace block is expected after the expression.
 func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeType, nextIsBlockBrace bool) (ast.Expression, token) {
 
+	if p.limits.exprDepth > 0 {
+		p.exprDepth++
+		defer func() { p.exprDepth-- }()
+		if p.exprDepth > p.limits.exprDepth {
+			panic(syntaxError(tok.pos, "expression nested too deeply (maximum depth is %d)", p.limits.exprDepth))
+		}
+	}
+
 	// canCompositeLiteral reports whether the currently parsed expression can
 	// be used as type in composite literals.
 	canCompositeLiteral := false
@@ -91,21 +99,34 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 			}
 			operand = ast.NewStructType(pos.WithEnd(tok.pos.End), fields)
 			tok = p.next()
-		case tokenInterface: // interface{}
+		case tokenInterface: // interface{}, interface{ ~int | ~string }
 			pos := tok.pos
 			tok = p.next()
 			if tok.typ != tokenLeftBrace {
 				panic(syntaxError(tok.pos, "unexpected %s, expecting {", tok))
 			}
 			tok = p.next()
-			if tok.typ != tokenRightBrace {
-				if tok.typ == tokenIdentifier {
-					panic(syntaxError(tok.pos, "non-empty interfaces are not supported in this release of Scriggo"))
+			var elements []ast.Expression
+			for tok.typ != tokenRightBrace {
+				var elem ast.Expression
+				elem, tok = p.parseExpr(tok, false, false, false, false)
+				if elem == nil {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting }", tok))
+				}
+				if _, ok := elem.(*ast.Call); ok || tok.typ == tokenLeftParenthesis {
+					panic(syntaxError(elem.Pos(), "non-empty interfaces are not supported in this release of Scriggo"))
+				}
+				elements = append(elements, elem)
+				switch tok.typ {
+				case tokenSemicolon:
+					tok = p.next()
+				case tokenRightBrace:
+				default:
+					panic(syntaxError(tok.pos, "unexpected %s, expecting semicolon or newline or }", tok))
 				}
-				panic(syntaxError(tok.pos, "unexpected %s, expecting }", tok))
 			}
 			pos.End = tok.pos.End
-			operand = ast.NewInterface(pos)
+			operand = ast.NewInterface(pos, elements)
 			tok = p.next()
 		case tokenFunc: // func
 			var node ast.Node
@@ -155,6 +176,7 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 			tokenNot,            // !e
 			tokenExtendedNot,    // not e
 			tokenXor,            // ^e
+			tokenTilde,          // ~T
 			tokenMultiplication, // *t, *T
 			tokenAmpersand:      // &e
 			operator = ast.NewUnaryOperator(tok.pos, operatorFromTokenType(tok.typ, false), nil)
@@ -344,12 +366,34 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 				operand = ast.NewCall(pos, operand, args, isVariadic)
 				canCompositeLiteral = false
 				tok = p.next()
-			case tokenLeftBracket: // e[...], e[.. : ..], e[.. : .. : ..],
+			case tokenLeftBracket: // e[...], e[.. : ..], e[.. : .. : ..], e[.., ..]
 				pos := tok.pos
 				pos.Start = operand.Pos().Start
 				var index ast.Expression
 				index, tok = p.parseExpr(p.next(), false, false, false, false)
-				if tok.typ == tokenColon {
+				if tok.typ == tokenComma && index != nil {
+					indices := []ast.Expression{index}
+					for tok.typ == tokenComma {
+						tok = p.next()
+						if tok.typ == tokenRightBracket {
+							break
+						}
+						index, tok = p.parseExpr(tok, false, false, false, false)
+						if index == nil {
+							panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+						}
+						indices = append(indices, index)
+					}
+					if tok.typ != tokenRightBracket {
+						panic(syntaxError(tok.pos, "unexpected %s, expecting comma or ]", tok))
+					}
+					pos.End = tok.pos.End
+					if len(indices) == 1 {
+						operand = ast.NewIndex(pos, operand, indices[0])
+					} else {
+						operand = ast.NewIndexList(pos, operand, indices)
+					}
+				} else if tok.typ == tokenColon {
 					low := index
 					isFull := false
 					var high, max ast.Expression
@@ -415,6 +459,19 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 					panic(syntaxError(tok.pos, "unexpected %s, expecting name or (", tok))
 				}
 				tok = p.next()
+			case tokenNilSafePeriod: // e?.
+				pos := tok.pos
+				pos.Start = operand.Pos().Start
+				tok = p.next()
+				if tok.typ != tokenIdentifier {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok))
+				}
+				// e?.ident
+				pos.End = tok.pos.End
+				selector := ast.NewSelector(pos, operand, string(tok.txt))
+				selector.NilSafe = true
+				operand = selector
+				tok = p.next()
 			case
 				tokenEqual,          // e ==
 				tokenNotEqual,       // e !=
@@ -440,6 +497,32 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 				tokenContains:       // e contains
 				operator = ast.NewBinaryOperator(tok.pos, operatorFromTokenType(tok.typ, true), nil, nil)
 				tok = p.next()
+			case tokenQuestionMark: // e ?
+				// The conditional operator has the lowest precedence, so the
+				// expression parsed so far is the condition.
+				if mustBeSwitchGuard {
+					panic(syntaxError(tok.pos, "use of .(type) outside type switch"))
+				}
+				if len(path) > 0 {
+					operand = addLastOperand(operand, path)
+					path = nil
+				}
+				pos := tok.pos
+				pos.Start = operand.Pos().Start
+				node := ast.NewConditional(pos, operand, nil, nil)
+				node.Expr1, tok = p.parseExpr(p.next(), false, false, false, false)
+				if node.Expr1 == nil {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+				}
+				if tok.typ != tokenColon {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting :", tok))
+				}
+				node.Expr2, tok = p.parseExpr(p.next(), false, false, false, nextIsBlockBrace)
+				if node.Expr2 == nil {
+					panic(syntaxError(tok.pos, "unexpected %s, expecting expression", tok))
+				}
+				node.Pos().End = node.Expr2.Pos().End
+				return node, tok
 			case tokenDefault, // e default
 				tokenExtendedNot: // e not contains
 				if tok.typ == tokenDefault && p.lex.extendedSyntax {
@@ -503,6 +586,9 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 			}
 			// operator becomes the new leaf operator.
 			path = append(path, op)
+			if p.limits.exprDepth > 0 && p.exprDepth+len(path) > p.limits.exprDepth {
+				panic(syntaxError(op.Pos(), "expression nested too deeply (maximum depth is %d)", p.limits.exprDepth))
+			}
 
 		case *ast.BinaryOperator:
 			// For a binary operator ("*", "/", "+", "-", "<", ">", ...),
@@ -520,19 +606,37 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 				}
 			}
 
+			templateSyntax := p.lex.templateSyntax
+
 			// p is the position in the path where to add the operator.
 			var p = len(path)
 			for p > 0 && op.Precedence() <= path[p-1].Precedence() {
 				p--
 			}
+
+			// In templates, a chained comparison 'a < b <= c' is parsed as
+			// 'a < b and b <= c', where b is the same expression node and
+			// is evaluated only once.
+			var chain *ast.BinaryOperator
+			if templateSyntax && p < len(path) && isOrderedComparison(op.Op) {
+				if prev, ok := path[p].(*ast.BinaryOperator); ok && isOrderedComparison(prev.Op) {
+					pos := *prev.Position
+					chain = ast.NewBinaryOperator(&pos, ast.OperatorExtendedAnd, prev, op)
+				}
+			}
+
 			if p > 0 {
 				// operator becomes the child of the operator with lower
 				// precedence found going up the path.
+				var child ast.Expression = op
+				if chain != nil {
+					child = chain
+				}
 				switch o := path[p-1].(type) {
 				case *ast.UnaryOperator:
-					o.Expr = op
+					o.Expr = child
 				case *ast.BinaryOperator:
-					o.Expr2 = op
+					o.Expr2 = child
 				}
 			}
 			if p < len(path) {
@@ -552,11 +656,20 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 						o.Position.End = operand.Pos().End
 					}
 				}
-				// operator becomes the new leaf operator.
-				op.Expr1 = path[p]
-				op.Position.Start = path[p].Pos().Start
-				path[p] = op
-				path = path[0 : p+1]
+				if chain != nil {
+					// The right operand of the previous comparison is shared,
+					// and operator becomes the new leaf operator.
+					op.Expr1 = chain.Expr1.(*ast.BinaryOperator).Expr2
+					op.Position.Start = op.Expr1.Pos().Start
+					path[p] = chain
+					path = append(path[0:p+1], op)
+				} else {
+					// operator becomes the new leaf operator.
+					op.Expr1 = path[p]
+					op.Position.Start = path[p].Pos().Start
+					path[p] = op
+					path = path[0 : p+1]
+				}
 			} else {
 				// operator becomes the new leaf operator.
 				op.Expr1 = operand
@@ -570,6 +683,12 @@ func (p *parsing) parseExpr(tok token, canBeSwitchGuard, canElideType, mustBeTyp
 
 }
 
+// isOrderedComparison reports whether op is one of the ordered comparison
+// operators <, <=, > and >=.
+func isOrderedComparison(op ast.OperatorType) bool {
+	return op >= ast.OperatorLess && op <= ast.OperatorGreaterEqual
+}
+
 // addLastOperand adds the last operand to the expression parsing path and
 // returns the operand resulting from the parsing of the entire expression.
 func addLastOperand(op ast.Expression, path []ast.Operator) ast.Expression {
@@ -814,6 +933,8 @@ func operatorFromTokenType(typ tokenTyp, binary bool) ast.OperatorType {
 		return ast.OperatorLeftShift
 	case tokenRightShift:
 		return ast.OperatorRightShift
+	case tokenTilde:
+		return ast.OperatorTilde
 	default:
 		panic("invalid token type")
 	}
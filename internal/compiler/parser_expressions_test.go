@@ -153,6 +153,34 @@ var exprTests = []struct {
 		ast.NewRender(p(1, 1, 0, 9), "a"),
 		ast.NewIdentifier(p(1, 20, 19, 19), "b")),
 	},
+	{"a < b <= c", ast.NewBinaryOperator(p(1, 3, 0, 9), ast.OperatorExtendedAnd,
+		ast.NewBinaryOperator(p(1, 3, 0, 4), ast.OperatorLess,
+			ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+			ast.NewIdentifier(p(1, 5, 4, 4), "b")),
+		ast.NewBinaryOperator(p(1, 7, 4, 9), ast.OperatorLessEqual,
+			ast.NewIdentifier(p(1, 5, 4, 4), "b"),
+			ast.NewIdentifier(p(1, 10, 9, 9), "c"))),
+	},
+	{"a > b + 1 >= c and d", ast.NewBinaryOperator(p(1, 16, 0, 19), ast.OperatorExtendedAnd,
+		ast.NewBinaryOperator(p(1, 3, 0, 13), ast.OperatorExtendedAnd,
+			ast.NewBinaryOperator(p(1, 3, 0, 8), ast.OperatorGreater,
+				ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+				ast.NewBinaryOperator(p(1, 7, 4, 8), ast.OperatorAddition,
+					ast.NewIdentifier(p(1, 5, 4, 4), "b"),
+					ast.NewBasicLiteral(p(1, 9, 8, 8), ast.IntLiteral, "1"))),
+			ast.NewBinaryOperator(p(1, 11, 4, 13), ast.OperatorGreaterEqual,
+				ast.NewBinaryOperator(p(1, 7, 4, 8), ast.OperatorAddition,
+					ast.NewIdentifier(p(1, 5, 4, 4), "b"),
+					ast.NewBasicLiteral(p(1, 9, 8, 8), ast.IntLiteral, "1")),
+				ast.NewIdentifier(p(1, 14, 13, 13), "c"))),
+		ast.NewIdentifier(p(1, 20, 19, 19), "d")),
+	},
+	{"a == b < c", ast.NewBinaryOperator(p(1, 8, 0, 9), ast.OperatorLess,
+		ast.NewBinaryOperator(p(1, 3, 0, 5), ast.OperatorEqual,
+			ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+			ast.NewIdentifier(p(1, 6, 5, 5), "b")),
+		ast.NewIdentifier(p(1, 10, 9, 9), "c")),
+	},
 	{"a + b default c", ast.NewBinaryOperator(p(1, 3, 0, 14), ast.OperatorAddition,
 		ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewDefault(p(1, 7, 4, 14),
 			ast.NewIdentifier(p(1, 5, 4, 4), "b"),
@@ -210,6 +238,9 @@ var exprTests = []struct {
 	{"a(1,2)", ast.NewCall(p(1, 2, 0, 5), ast.NewIdentifier(p(1, 1, 0, 0), "a"),
 		[]ast.Expression{ast.NewBasicLiteral(p(1, 3, 2, 2), ast.IntLiteral, "1"), ast.NewBasicLiteral(p(1, 5, 4, 4), ast.IntLiteral, "2")}, false)},
 	{"a[1]", ast.NewIndex(p(1, 2, 0, 3), ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewBasicLiteral(p(1, 3, 2, 2), ast.IntLiteral, "1"))},
+	{"a[b,c]", ast.NewIndexList(p(1, 2, 0, 5), ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+		[]ast.Expression{ast.NewIdentifier(p(1, 3, 2, 2), "b"), ast.NewIdentifier(p(1, 5, 4, 4), "c")})},
+	{"a[b,]", ast.NewIndex(p(1, 2, 0, 4), ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewIdentifier(p(1, 3, 2, 2), "b"))},
 	{"a[:]", ast.NewSlicing(p(1, 2, 0, 3), ast.NewIdentifier(p(1, 1, 0, 0), "a"), nil, nil, nil, false)},
 	{"a[:2]", ast.NewSlicing(p(1, 2, 0, 4), ast.NewIdentifier(p(1, 1, 0, 0), "a"), nil, ast.NewBasicLiteral(p(1, 4, 3, 3), ast.IntLiteral, "2"), nil, false)},
 	{"a[1:]", ast.NewSlicing(p(1, 2, 0, 4), ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewBasicLiteral(p(1, 3, 2, 2), ast.IntLiteral, "1"), nil, nil, false)},
@@ -258,6 +289,34 @@ var exprTests = []struct {
 		ast.NewSelector(p(1, 4, 2, 4), ast.NewIdentifier(p(1, 3, 2, 2), "b"), "C"))},
 	{"a.B(c)", ast.NewCall(p(1, 4, 0, 5), ast.NewSelector(p(1, 2, 0, 2), ast.NewIdentifier(p(1, 1, 0, 0), "a"), "B"),
 		[]ast.Expression{ast.NewIdentifier(p(1, 5, 4, 4), "c")}, false)},
+	{"a?.b", nilSafeSelector(p(1, 2, 0, 3), ast.NewIdentifier(p(1, 1, 0, 0), "a"), "b")},
+	{"a?.b?.c", nilSafeSelector(p(1, 5, 0, 6), nilSafeSelector(p(1, 2, 0, 3), ast.NewIdentifier(p(1, 1, 0, 0), "a"), "b"), "c")},
+	{"a.b?.c", nilSafeSelector(p(1, 4, 0, 5), ast.NewSelector(p(1, 2, 0, 2), ast.NewIdentifier(p(1, 1, 0, 0), "a"), "b"), "c")},
+	{"a?.B(c)", ast.NewCall(p(1, 5, 0, 6), nilSafeSelector(p(1, 2, 0, 3), ast.NewIdentifier(p(1, 1, 0, 0), "a"), "B"),
+		[]ast.Expression{ast.NewIdentifier(p(1, 6, 5, 5), "c")}, false)},
+	{"a ? b : c", ast.NewConditional(p(1, 3, 0, 8), ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+		ast.NewIdentifier(p(1, 5, 4, 4), "b"), ast.NewIdentifier(p(1, 9, 8, 8), "c"))},
+	{"a || b ? c : d + e", ast.NewConditional(p(1, 8, 0, 17),
+		ast.NewBinaryOperator(p(1, 3, 0, 5), ast.OperatorOr, ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewIdentifier(p(1, 6, 5, 5), "b")),
+		ast.NewIdentifier(p(1, 10, 9, 9), "c"),
+		ast.NewBinaryOperator(p(1, 16, 13, 17), ast.OperatorAddition, ast.NewIdentifier(p(1, 14, 13, 13), "d"), ast.NewIdentifier(p(1, 18, 17, 17), "e")))},
+	{"a ? b : c ? d : e", ast.NewConditional(p(1, 3, 0, 16), ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+		ast.NewIdentifier(p(1, 5, 4, 4), "b"), ast.NewConditional(p(1, 11, 8, 16), ast.NewIdentifier(p(1, 9, 8, 8), "c"),
+			ast.NewIdentifier(p(1, 13, 12, 12), "d"), ast.NewIdentifier(p(1, 17, 16, 16), "e")))},
+	{"-a ? b[1:2] : c", ast.NewConditional(p(1, 4, 0, 14),
+		ast.NewUnaryOperator(p(1, 1, 0, 1), ast.OperatorSubtraction, ast.NewIdentifier(p(1, 2, 1, 1), "a")),
+		ast.NewSlicing(p(1, 7, 5, 10), ast.NewIdentifier(p(1, 6, 5, 5), "b"), ast.NewBasicLiteral(p(1, 8, 7, 7), ast.IntLiteral, "1"),
+			ast.NewBasicLiteral(p(1, 10, 9, 9), ast.IntLiteral, "2"), nil, false),
+		ast.NewIdentifier(p(1, 15, 14, 14), "c"))},
+	{"s[c ? 1 : 2]", ast.NewIndex(p(1, 2, 0, 11), ast.NewIdentifier(p(1, 1, 0, 0), "s"),
+		ast.NewConditional(p(1, 5, 2, 10), ast.NewIdentifier(p(1, 3, 2, 2), "c"),
+			ast.NewBasicLiteral(p(1, 7, 6, 6), ast.IntLiteral, "1"), ast.NewBasicLiteral(p(1, 11, 10, 10), ast.IntLiteral, "2")))},
+	{"s[c ? 1 : 2:3]", ast.NewSlicing(p(1, 2, 0, 13), ast.NewIdentifier(p(1, 1, 0, 0), "s"),
+		ast.NewConditional(p(1, 5, 2, 10), ast.NewIdentifier(p(1, 3, 2, 2), "c"),
+			ast.NewBasicLiteral(p(1, 7, 6, 6), ast.IntLiteral, "1"), ast.NewBasicLiteral(p(1, 11, 10, 10), ast.IntLiteral, "2")),
+		ast.NewBasicLiteral(p(1, 13, 12, 12), ast.IntLiteral, "3"), nil, false)},
+	{"a ? .5 : b", ast.NewConditional(p(1, 3, 0, 9), ast.NewIdentifier(p(1, 1, 0, 0), "a"),
+		ast.NewBasicLiteral(p(1, 5, 4, 5), ast.FloatLiteral, ".5"), ast.NewIdentifier(p(1, 10, 9, 9), "b"))},
 	{"a.(string)", ast.NewTypeAssertion(p(1, 2, 0, 9), ast.NewIdentifier(p(1, 1, 0, 0), "a"), ast.NewIdentifier(p(1, 4, 3, 8), "string"))},
 	{"html(a).(html)", ast.NewTypeAssertion(p(1, 8, 0, 13), ast.NewCall(p(1, 5, 0, 6),
 		ast.NewIdentifier(p(1, 1, 0, 3), "html"), []ast.Expression{ast.NewIdentifier(p(1, 6, 5, 5), "a")}, false), ast.NewIdentifier(p(1, 10, 9, 12), "html"))},
@@ -277,7 +336,7 @@ var exprTests = []struct {
 			p(1, 20, 0, 35),
 			ast.NewMapType(p(1, 1, 0, 18),
 				ast.NewIdentifier(p(1, 5, 4, 6), "int"),
-				ast.NewInterface(p(1, 9, 8, 18))),
+				ast.NewInterface(p(1, 9, 8, 18), nil)),
 			[]ast.KeyValue{
 				{
 					ast.NewIdentifier(p(1, 21, 20, 20), "a"),
@@ -545,14 +604,21 @@ var exprTests = []struct {
 		),
 	},
 	{`interface{}`,
-		ast.NewInterface(p(1, 1, 0, 10)),
+		ast.NewInterface(p(1, 1, 0, 10), nil),
+	},
+	{`interface{ ~int | string }`,
+		ast.NewInterface(p(1, 1, 0, 25), []ast.Expression{
+			ast.NewBinaryOperator(p(1, 17, 12, 23), ast.OperatorBitOr,
+				ast.NewUnaryOperator(p(1, 12, 12, 14), ast.OperatorTilde, ast.NewIdentifier(p(1, 13, 12, 14), "int")),
+				ast.NewIdentifier(p(1, 19, 18, 23), "string")),
+		}),
 	},
 	{`[]interface{}{1,2,3}`,
 		ast.NewCompositeLiteral(
 			p(1, 14, 0, 19),
 			ast.NewSliceType(
 				p(1, 1, 0, 12),
-				ast.NewInterface(p(1, 3, 2, 12)),
+				ast.NewInterface(p(1, 3, 2, 12), nil),
 			),
 			[]ast.KeyValue{
 				{nil, ast.NewBasicLiteral(p(1, 15, 14, 14), ast.IntLiteral, "1")},
@@ -569,7 +635,7 @@ var exprTests = []struct {
 				ast.NewBasicLiteral(p(1, 1, 0, 0), ast.IntLiteral, "1"),
 				ast.NewCall(
 					p(1, 16, 4, 17),
-					ast.NewInterface(p(1, 5, 4, 14)),
+					ast.NewInterface(p(1, 5, 4, 14), nil),
 					[]ast.Expression{ast.NewBasicLiteral(p(1, 17, 16, 16), ast.IntLiteral, "2")}, false,
 				)),
 			ast.NewBasicLiteral(p(1, 22, 21, 21), ast.IntLiteral, "4"),
@@ -631,7 +697,7 @@ var exprTests = []struct {
 
 func TestExpressions(t *testing.T) {
 	for _, expr := range exprTests {
-		var lex = scanTemplate([]byte("{{"+expr.src+"}}"), ast.FormatText, false, false, true)
+		var lex = scanTemplate([]byte("{{"+expr.src+"}}"), ast.FormatText, false, false, true, false)
 		<-lex.Tokens()
 		func() {
 			defer func() {
@@ -659,3 +725,9 @@ func TestExpressions(t *testing.T) {
 		}()
 	}
 }
+
+func nilSafeSelector(pos *ast.Position, expr ast.Expression, ident string) *ast.Selector {
+	s := ast.NewSelector(pos, expr, ident)
+	s.NilSafe = true
+	return s
+}
@@ -22,8 +22,9 @@ const (
 func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 	isMacro := tok.typ == tokenMacro
 	pos := tok.pos
-	// Parses the function name if present.
+	// Parses the function name and the type parameters if present.
 	var ident *ast.Identifier
+	var typeParams []*ast.Parameter
 	tok = p.next()
 	if tok.typ == tokenIdentifier {
 		if kind&parseFuncDecl == 0 {
@@ -31,6 +32,12 @@ func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 		}
 		ident = ast.NewIdentifier(tok.pos, string(tok.txt))
 		tok = p.next()
+		if tok.typ == tokenLeftBracket {
+			if isMacro {
+				panic(syntaxError(tok.pos, "macro cannot have type parameters"))
+			}
+			typeParams, tok = p.parseTypeParameters(tok)
+		}
 	} else if kind == parseFuncDecl {
 		// This check could be avoided (the code panics anyway) but improves the
 		// readability of the error message.
@@ -66,6 +73,7 @@ func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 		return typ, tok
 	}
 	node := ast.NewFunc(pos, ident, typ, nil, false, ast.Format(tok.ctx))
+	node.TypeParams = typeParams
 	if !isMacro && tok.typ != tokenLeftBrace {
 		return node, tok
 	}
@@ -102,6 +110,46 @@ func (p *parsing) parseFunc(tok token, kind funcKindToParse) (ast.Node, token) {
 	return node, p.next()
 }
 
+// parseTypeParameters parses the type parameters of a function declaration.
+// tok is the token "[". Consecutive parameters with the same constraint, as
+// in "[K, V any]", have a nil Type except the last one.
+//
+// Returns the type parameters and the next token.
+func (p *parsing) parseTypeParameters(tok token) ([]*ast.Parameter, token) {
+	var params []*ast.Parameter
+	tok = p.next()
+	if tok.typ == tokenRightBracket {
+		panic(syntaxError(tok.pos, "empty type parameter list"))
+	}
+	for {
+		if tok.typ != tokenIdentifier {
+			panic(syntaxError(tok.pos, "unexpected %s, expecting name", tok))
+		}
+		param := ast.NewParameter(p.parseIdentifierNode(tok), nil)
+		params = append(params, param)
+		tok = p.next()
+		if tok.typ == tokenComma {
+			tok = p.next()
+			continue
+		}
+		param.Type, tok = p.parseExpr(tok, false, false, false, false)
+		if param.Type == nil {
+			panic(syntaxError(tok.pos, "missing type constraint"))
+		}
+		if tok.typ != tokenComma {
+			break
+		}
+		tok = p.next()
+		if tok.typ == tokenRightBracket {
+			break
+		}
+	}
+	if tok.typ != tokenRightBracket {
+		panic(syntaxError(tok.pos, "unexpected %s, expecting comma or ]", tok))
+	}
+	return params, p.next()
+}
+
 // parseFuncParameters parses the parameters of a function or macro. tok is
 // the first token of the parameters. isMacro indicates if it is a macro and
 // isResult indicates if the parameters to parse are the result parameters.
@@ -119,13 +167,16 @@ func (p *parsing) parseFuncParameters(tok token, isMacro, isResult bool) ([]*ast
 			case "string", "html", "css", "js", "json", "markdown":
 				return []*ast.Parameter{{nil, ast.NewIdentifier(tok.pos, name)}}, false, tok.pos, p.next()
 			}
-			return nil, false, nil, tok
-		}
-		switch tok.typ {
-		case tokenLeftBracket, tokenFunc, tokenIdentifier, tokenInterface, tokenMap, tokenMultiplication, tokenStruct, tokenChan:
-			var expr ast.Expression
-			expr, tok = p.parseExpr(tok, false, false, true, true)
-			return []*ast.Parameter{ast.NewParameter(nil, expr)}, false, expr.Pos(), tok
+			if tok.typ != tokenLeftParenthesis {
+				return nil, false, nil, tok
+			}
+		} else {
+			switch tok.typ {
+			case tokenLeftBracket, tokenFunc, tokenIdentifier, tokenInterface, tokenMap, tokenMultiplication, tokenStruct, tokenChan:
+				var expr ast.Expression
+				expr, tok = p.parseExpr(tok, false, false, true, true)
+				return []*ast.Parameter{ast.NewParameter(nil, expr)}, false, expr.Pos(), tok
+			}
 		}
 	}
 
@@ -188,6 +239,10 @@ func (p *parsing) parseFuncParameters(tok token, isMacro, isResult bool) ([]*ast
 		last = parameters[len(parameters)-1]
 	}
 
+	if isMacro && isResult && last != nil && last.Ident != nil {
+		panic(syntaxError(last.Ident.Pos(), "macro results cannot be named"))
+	}
+
 	for _, param := range parameters {
 		if last.Ident == nil {
 			if param.Ident != nil {
@@ -0,0 +1,66 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/ast"
+)
+
+// FuzzParserLimits checks that the parser, with limits, returns a syntax
+// error instead of panicking or exhausting the stack on deeply nested
+// sources.
+func FuzzParserLimits(f *testing.F) {
+	f.Add("{{ a }}", 3)
+	f.Add("{{ "+strings.Repeat("(", 10000)+"a"+strings.Repeat(")", 10000)+" }}", 1000)
+	f.Add("{{ "+strings.Repeat("f(", 10000)+strings.Repeat(")", 10000)+" }}", 1000)
+	f.Add("{{ "+strings.Repeat("!", 10000)+"a }}", 1000)
+	f.Add("{{ "+strings.Repeat("[]int{", 1000)+strings.Repeat("}", 1000)+" }}", 1000)
+	f.Add(strings.Repeat("{% if a %}", 10000)+strings.Repeat("{% end %}", 10000), 1000)
+	f.Add(strings.Repeat("{% for %}{% macro M %}", 1000), 1000)
+	f.Add("{%% "+strings.Repeat("if a { ", 10000)+strings.Repeat("} ", 10000)+" %%}", 1000)
+	f.Fuzz(func(t *testing.T, src string, n int) {
+		m := int(uint(n) % 4096)
+		limits := parserLimits{exprDepth: m%100 + 1, nesting: m%50 + 1, fileSize: m*64 + 1}
+		_, _, err := parseTemplateSource([]byte(src), ast.FormatHTML, false, false, false, false, false, limits)
+		if err == nil {
+			if len(src) > limits.fileSize {
+				t.Fatalf("expecting an error for a source of %d bytes", len(src))
+			}
+			return
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("expecting a syntax error, got %T: %s", err, err)
+		}
+	})
+}
+
+// FuzzParseTemplate checks that the parser returns a syntax error, instead
+// of panicking, on invalid template sources.
+func FuzzParseTemplate(f *testing.F) {
+	for _, tree := range treeTests {
+		f.Add(tree.src, uint8(ast.FormatHTML))
+	}
+	for src := range typeTestsText {
+		f.Add(src, uint8(ast.FormatText))
+	}
+	for src := range typeTestsMarkdown {
+		f.Add(src, uint8(ast.FormatMarkdown))
+	}
+	f.Fuzz(func(t *testing.T, src string, format uint8) {
+		_, _, err := ParseTemplateSource([]byte(src), ast.Format(format%6), false, false, false, false)
+		if err == nil {
+			return
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Fatalf("expecting a syntax error, got %T: %s", err, err)
+		}
+	})
+}
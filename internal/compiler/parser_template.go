@@ -8,7 +8,6 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
-	"os"
 	"path"
 	"strings"
 
@@ -29,12 +28,22 @@ type FormatFS interface {
 //
 // If noParseShow is true, short show statements are not parsed.
 //
+// The fenced code blocks of the Markdown files are parsed as text.
+//
 // ParseTemplate expands the nodes Extends, Import and Render parsing the
 // relative trees.
 func ParseTemplate(fsys fs.FS, name string, noParseShow, dollarIdentifier bool) (*ast.Tree, error) {
+	return parseTemplate(fsys, name, noParseShow, dollarIdentifier, false, parserLimits{}, nil)
+}
+
+// parseTemplate is like ParseTemplate but parses the files with the given
+// limits and, if sources is not nil, it also stores in sources the sources of
+// the parsed files indexed by path. If executeCodeFences is true, the fenced
+// code blocks of the Markdown files are parsed as the rest of the files.
+func parseTemplate(fsys fs.FS, name string, noParseShow, dollarIdentifier, executeCodeFences bool, limits parserLimits, sources map[string][]byte) (*ast.Tree, error) {
 
 	if name == "." || strings.HasSuffix(name, "/") {
-		return nil, os.ErrInvalid
+		return nil, fs.ErrInvalid
 	}
 
 	src, format, err := readFileAndFormat(fsys, name)
@@ -43,12 +52,15 @@ func ParseTemplate(fsys fs.FS, name string, noParseShow, dollarIdentifier bool)
 	}
 
 	pp := &templateExpansion{
-		fsys:             fsys,
-		trees:            map[string]parsedTree{},
-		paths:            []string{},
-		canExtend:        true,
-		noParseShow:      noParseShow,
-		dollarIdentifier: dollarIdentifier,
+		fsys:              fsys,
+		trees:             map[string]parsedTree{},
+		paths:             []string{},
+		canExtend:         true,
+		noParseShow:       noParseShow,
+		dollarIdentifier:  dollarIdentifier,
+		executeCodeFences: executeCodeFences,
+		limits:            limits,
+		sources:           sources,
 	}
 
 	tree, err := pp.parseSource(src, name, format, true, false)
@@ -64,14 +76,33 @@ func ParseTemplate(fsys fs.FS, name string, noParseShow, dollarIdentifier bool)
 	return tree, nil
 }
 
+// parseTemplateSourceOnly parses the template source src, with the given
+// path and format, that cannot extend, import and render other files. The
+// other parameters are as in parseTemplate.
+func parseTemplateSourceOnly(src []byte, path string, format ast.Format, noParseShow, dollarIdentifier, executeCodeFences bool, limits parserLimits, sources map[string][]byte) (*ast.Tree, error) {
+	pp := &templateExpansion{
+		trees:             map[string]parsedTree{},
+		paths:             []string{},
+		noParseShow:       noParseShow,
+		dollarIdentifier:  dollarIdentifier,
+		executeCodeFences: executeCodeFences,
+		limits:            limits,
+		sources:           sources,
+	}
+	return pp.parseSource(src, path, format, true, false)
+}
+
 // templateExpansion represents the state of a template expansion.
 type templateExpansion struct {
-	fsys             fs.FS
-	trees            map[string]parsedTree
-	paths            []string
-	canExtend        bool
-	noParseShow      bool
-	dollarIdentifier bool
+	fsys              fs.FS // nil if the files cannot be extended, imported and rendered.
+	trees             map[string]parsedTree
+	paths             []string
+	canExtend         bool
+	noParseShow       bool
+	dollarIdentifier  bool
+	executeCodeFences bool
+	limits            parserLimits
+	sources           map[string][]byte
 }
 
 // parsedTree represents a parsed tree. parent is the file path and node that
@@ -89,18 +120,17 @@ type parsedTree struct {
 //
 // Supposing that a/b/c is the parent path
 //
-//   if name is /d/e, the rooted path name is d/e
-//   if name is d/e, the rooted path name is a/b/d/e
-//   if name is ../d/e, the rooted path name is a/d/e
-//   if name is ../../d/e, the rooted path name is d/e
-//
+//	if name is /d/e, the rooted path name is d/e
+//	if name is d/e, the rooted path name is a/b/d/e
+//	if name is ../d/e, the rooted path name is a/d/e
+//	if name is ../../d/e, the rooted path name is d/e
 func rooted(parent, name string) (string, error) {
 	if path.IsAbs(name) {
 		return name[1:], nil
 	}
 	r := path.Join(path.Dir(parent), name)
 	if strings.HasPrefix(r, "..") {
-		return "", os.ErrNotExist
+		return "", fs.ErrNotExist
 	}
 	return r, nil
 }
@@ -184,7 +214,11 @@ func (pp *templateExpansion) parseNodeFile(node ast.Node) (*ast.Tree, error) {
 // the file is imported. path must be absolute and cleared.
 func (pp *templateExpansion) parseSource(src []byte, path string, format ast.Format, parseShebang, imported bool) (*ast.Tree, error) {
 
-	tree, unexpanded, err := ParseTemplateSource(src, format, parseShebang, imported, pp.noParseShow, pp.dollarIdentifier)
+	if pp.sources != nil {
+		pp.sources[path] = src
+	}
+
+	tree, unexpanded, err := parseTemplateSource(src, format, parseShebang, imported, pp.noParseShow, pp.dollarIdentifier, pp.executeCodeFences, pp.limits)
 	if err != nil {
 		if se, ok := err.(*SyntaxError); ok {
 			se.path = path
@@ -212,6 +246,19 @@ func (pp *templateExpansion) expand(nodes []ast.Node) error {
 
 	for _, node := range nodes {
 
+		if pp.fsys == nil {
+			var stmt string
+			switch node.(type) {
+			case *ast.Extends:
+				stmt = "extends"
+			case *ast.Import:
+				stmt = "import"
+			default:
+				stmt = "render"
+			}
+			return syntaxError(node.Pos(), "%s is not allowed in a template source", stmt)
+		}
+
 		switch n := node.(type) {
 
 		case *ast.Extends:
@@ -225,7 +272,7 @@ func (pp *templateExpansion) expand(nodes []ast.Node) error {
 			if err != nil {
 				parent := pp.paths[len(pp.paths)-1]
 				rootedPath, _ := rooted(parent, n.Path)
-				if errors.Is(err, os.ErrNotExist) {
+				if errors.Is(err, fs.ErrNotExist) {
 					err = syntaxError(n.Pos(), "extends path %q does not exist", rootedPath)
 				} else if e, ok := err.(*CycleError); ok {
 					e.msg = "\n\textends " + rootedPath + e.msg
@@ -249,7 +296,7 @@ func (pp *templateExpansion) expand(nodes []ast.Node) error {
 			var err error
 			pp.canExtend = false
 			n.Tree, err = pp.parseNodeFile(n)
-			if err != nil && !errors.Is(err, os.ErrNotExist) {
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
 				if e, ok := err.(*CycleError); ok {
 					parent := pp.paths[len(pp.paths)-1]
 					rootedPath, _ := rooted(parent, n.Path)
@@ -280,10 +327,10 @@ func (pp *templateExpansion) expand(nodes []ast.Node) error {
 			var err error
 			pp.canExtend = false
 			r.Tree, err = pp.parseNodeFile(r)
-			if err != nil && (!special || !errors.Is(err, os.ErrNotExist)) {
+			if err != nil && (!special || !errors.Is(err, fs.ErrNotExist)) {
 				parent := pp.paths[len(pp.paths)-1]
 				rootedPath, _ := rooted(parent, r.Path)
-				if errors.Is(err, os.ErrNotExist) {
+				if errors.Is(err, fs.ErrNotExist) {
 					err = syntaxError(n.Pos(), "render path %q does not exist", rootedPath)
 				} else if e, ok := err.(*CycleError); ok {
 					e.msg = "\n\trenders " + rootedPath + e.msg
@@ -310,7 +357,7 @@ func readFileAndFormat(fsys fs.FS, name string) ([]byte, ast.Format, error) {
 	if err != nil {
 		return nil, 0, err
 	}
-	format := ast.FormatText
+	var format ast.Format
 	if ff, ok := fsys.(FormatFS); ok {
 		format, err = ff.Format(name)
 		if err != nil {
@@ -320,18 +367,25 @@ func readFileAndFormat(fsys fs.FS, name string) ([]byte, ast.Format, error) {
 			return nil, 0, fmt.Errorf("unknown format %d", format)
 		}
 	} else {
-		switch path.Ext(name) {
-		case ".html":
-			format = ast.FormatHTML
-		case ".css":
-			format = ast.FormatCSS
-		case ".js":
-			format = ast.FormatJS
-		case ".json":
-			format = ast.FormatJSON
-		case ".md", ".mkd", ".mkdn", ".mdown", ".markdown":
-			format = ast.FormatMarkdown
-		}
+		format = ExtensionFormat(name)
 	}
 	return src, format, nil
 }
+
+// ExtensionFormat returns the format of the file with the given name as
+// determined by the extension of the name.
+func ExtensionFormat(name string) ast.Format {
+	switch path.Ext(name) {
+	case ".html":
+		return ast.FormatHTML
+	case ".css":
+		return ast.FormatCSS
+	case ".js":
+		return ast.FormatJS
+	case ".json":
+		return ast.FormatJSON
+	case ".md", ".mkd", ".mkdn", ".mdown", ".markdown":
+		return ast.FormatMarkdown
+	}
+	return ast.FormatText
+}
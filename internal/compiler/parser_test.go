@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/open2b/scriggo/ast"
@@ -318,7 +319,7 @@ var goContextTreeTests = []struct {
 				ast.NewMapType(
 					p(1, 14, 13, 34),
 					ast.NewIdentifier(p(1, 18, 17, 22), "string"),
-					ast.NewInterface(p(1, 25, 24, 34)),
+					ast.NewInterface(p(1, 25, 24, 34), nil),
 				),
 				true,
 			),
@@ -1208,6 +1209,22 @@ var treeTests = []struct {
 			ast.NewIdentifier(p(1, 8, 7, 7), "v"),
 			ast.NewIdentifier(p(1, 13, 12, 12), "e"),
 			[]ast.Node{ast.NewText(p(1, 17, 16, 16), []byte("b"), ast.Cut{})}, nil)}, ast.FormatHTML)},
+	{"{% for i in 1..n %}b{% end %}", ast.NewTree("", []ast.Node{
+		ast.NewForIn(p(1, 4, 3, 25),
+			ast.NewIdentifier(p(1, 8, 7, 7), "i"),
+			ast.NewRange(p(1, 13, 12, 15),
+				ast.NewBasicLiteral(p(1, 13, 12, 12), ast.IntLiteral, "1"),
+				ast.NewIdentifier(p(1, 16, 15, 15), "n")),
+			[]ast.Node{ast.NewText(p(1, 20, 19, 19), []byte("b"), ast.Cut{})}, nil)}, ast.FormatHTML)},
+	{"{% for parallel v in e %}b{% end %}", ast.NewTree("", []ast.Node{
+		func() *ast.ForIn {
+			node := ast.NewForIn(p(1, 4, 3, 31),
+				ast.NewIdentifier(p(1, 17, 16, 16), "v"),
+				ast.NewIdentifier(p(1, 22, 21, 21), "e"),
+				[]ast.Node{ast.NewText(p(1, 26, 25, 25), []byte("b"), ast.Cut{})}, nil)
+			node.Parallel = true
+			return node
+		}()}, ast.FormatHTML)},
 	{"{% for v in e %}{% break %}{% end %}", ast.NewTree("", []ast.Node{
 		ast.NewForIn(p(1, 4, 3, 32),
 			ast.NewIdentifier(p(1, 8, 7, 7), "v"),
@@ -1504,6 +1521,47 @@ func TestShebang(t *testing.T) {
 	}
 }
 
+func TestParserLimits(t *testing.T) {
+	limits := parserLimits{exprDepth: 5, nesting: 3, fileSize: 100}
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"{{ ((((a)))) }}", ""},
+		{"{{ (((((a))))) }}", ":1:9: syntax error: expression nested too deeply (maximum depth is 5)"},
+		{"{{ f(g(h(i(j)))) }}", ""},
+		{"{{ f(g(h(i(j(k))))) }}", ":1:14: syntax error: expression nested too deeply (maximum depth is 5)"},
+		{"{{ []int{len([]int{1})} }}", ""},
+		{"{{ !!!!a }}", ""},
+		{"{{ !!!!!a }}", ":1:8: syntax error: expression nested too deeply (maximum depth is 5)"},
+		{"{{ a + (b * (c - (d / (e)))) }}", ""},
+		{"{% if a %}{% for %}{% if b %}{% end %}{% end %}{% end %}", ""},
+		{"{% if a %}{% for %}{% if b %}{% if c %}{% end %}{% end %}{% end %}{% end %}", ":1:33: syntax error: statements nested too deeply (maximum depth is 3)"},
+				{"{% if a %}{% else if b %}{% else if c %}{% else if d %}{% else %}{% end %}", ""},
+		{"{% macro M %}{% switch %}{% case true %}{% for %}{% end %}{% end %}{% end %}", ""},
+		{"{%% if a { if b { if c { if d { } } } } %%}", ":1:31: syntax error: statements nested too deeply (maximum depth is 3)"},
+		{strings.Repeat("a", 100), ""},
+		{strings.Repeat("a", 30) + "\nè" + strings.Repeat("a", 80), ":2:69: syntax error: file size exceeds the maximum of 100 bytes"},
+	}
+	for _, test := range tests {
+		_, _, err := parseTemplateSource([]byte(test.src), ast.FormatText, false, false, false, false, false, limits)
+		if err == nil {
+			if test.err != "" {
+				t.Errorf("source: %q, expected error %q, got nothing", test.src, test.err)
+			}
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source: %q, expected error %q, got %q", test.src, test.err, err)
+		}
+		// Without limits, the source is parsed.
+		_, _, err = ParseTemplateSource([]byte(test.src), ast.FormatText, false, false, false, false)
+		if err != nil {
+			t.Errorf("source: %q, unexpected error without limits: %s", test.src, err)
+		}
+	}
+}
+
 func TestTrees(t *testing.T) {
 	for _, tree := range treeTests {
 		node, _, err := ParseTemplateSource([]byte(tree.src), ast.FormatHTML, false, false, false, true)
@@ -1808,6 +1866,9 @@ func equals(n1, n2 ast.Node, p int) error {
 		if nn1.Ident != nn2.Ident {
 			return fmt.Errorf("unexpected ident %q, expecting %q", nn1.Ident, nn2.Ident)
 		}
+		if nn1.NilSafe != nn2.NilSafe {
+			return fmt.Errorf("unexpected nil-safe %t, expecting %t", nn1.NilSafe, nn2.NilSafe)
+		}
 
 	case *ast.CompositeLiteral:
 		nn2, ok := n2.(*ast.CompositeLiteral)
@@ -1833,10 +1894,19 @@ func equals(n1, n2 ast.Node, p int) error {
 		}
 
 	case *ast.Interface:
-		_, ok := n2.(*ast.Interface)
+		nn2, ok := n2.(*ast.Interface)
 		if !ok {
 			return fmt.Errorf("unexpected %#v, expecting %#v", n1, n2)
 		}
+		if len(nn1.Elements) != len(nn2.Elements) {
+			return fmt.Errorf("unexpected elements len %d, expecting %d", len(nn1.Elements), len(nn2.Elements))
+		}
+		for i, e := range nn1.Elements {
+			err := equals(e, nn2.Elements[i], p)
+			if err != nil {
+				return err
+			}
+		}
 
 	case *ast.ArrayType:
 		nn2, ok := n2.(*ast.ArrayType)
@@ -1996,6 +2066,25 @@ func equals(n1, n2 ast.Node, p int) error {
 			return err
 		}
 
+	case *ast.IndexList:
+		nn2, ok := n2.(*ast.IndexList)
+		if !ok {
+			return fmt.Errorf("unexpected %#v, expecting %#v", n1, n2)
+		}
+		err := equals(nn1.Expr, nn2.Expr, p)
+		if err != nil {
+			return err
+		}
+		if len(nn1.Indices) != len(nn2.Indices) {
+			return fmt.Errorf("unexpected indices len %d, expecting %d", len(nn1.Indices), len(nn2.Indices))
+		}
+		for i, index := range nn1.Indices {
+			err = equals(index, nn2.Indices[i], p)
+			if err != nil {
+				return err
+			}
+		}
+
 	case *ast.Slicing:
 		nn2, ok := n2.(*ast.Slicing)
 		if !ok {
@@ -2129,6 +2218,9 @@ func equals(n1, n2 ast.Node, p int) error {
 		if !ok {
 			return fmt.Errorf("unexpected %#v, expecting %#v", n1, n2)
 		}
+		if nn1.Parallel != nn2.Parallel {
+			return fmt.Errorf("unexpected parallel %t, expecting %t", nn1.Parallel, nn2.Parallel)
+		}
 		err := equals(nn1.Ident, nn2.Ident, p)
 		if err != nil {
 			return err
@@ -2507,6 +2599,24 @@ func equals(n1, n2 ast.Node, p int) error {
 			return err
 		}
 
+	case *ast.Conditional:
+		nn2, ok := n2.(*ast.Conditional)
+		if !ok {
+			return fmt.Errorf("unexpected %#v, expecting %#v", n1, n2)
+		}
+		err := equals(nn1.Condition, nn2.Condition, p)
+		if err != nil {
+			return err
+		}
+		err = equals(nn1.Expr1, nn2.Expr1, p)
+		if err != nil {
+			return err
+		}
+		err = equals(nn1.Expr2, nn2.Expr2, p)
+		if err != nil {
+			return err
+		}
+
 	case *ast.Default:
 		nn2, ok := n2.(*ast.Default)
 		if !ok {
@@ -2618,6 +2728,20 @@ func equals(n1, n2 ast.Node, p int) error {
 			return err
 		}
 
+	case *ast.Range:
+		nn2, ok := n2.(*ast.Range)
+		if !ok {
+			return fmt.Errorf("unexpected %#v, expecting %#v", n1, n2)
+		}
+		err := equals(nn1.Low, nn2.Low, p)
+		if err != nil {
+			return err
+		}
+		err = equals(nn1.High, nn2.High, p)
+		if err != nil {
+			return err
+		}
+
 	case *ast.Raw:
 		nn2, ok := n2.(*ast.Raw)
 		if !ok {
@@ -0,0 +1,72 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"github.com/open2b/scriggo/ast"
+)
+
+// Scanner scans the tokens of a source with the same lexer used by the
+// parser. It is used by the scanner package.
+type Scanner struct {
+	lex *lexer
+	eof *token
+}
+
+// NewProgramScanner returns a scanner for the source of a program file.
+func NewProgramScanner(src []byte) *Scanner {
+	return &Scanner{lex: scanProgram(src)}
+}
+
+// NewScriptScanner returns a scanner for the source of a script.
+func NewScriptScanner(src []byte) *Scanner {
+	return &Scanner{lex: scanScript(src)}
+}
+
+// NewTemplateScanner returns a scanner for the source of a template file
+// with the given format. noParseShow, dollarIdentifier and executeCodeFences
+// have the same meaning as in parseTemplate.
+func NewTemplateScanner(src []byte, format ast.Format, noParseShow, dollarIdentifier, executeCodeFences bool) *Scanner {
+	return &Scanner{lex: scanTemplate(src, format, true, noParseShow, dollarIdentifier, executeCodeFences)}
+}
+
+// Next returns the type, the position, the text and the context of the next
+// token. After the EOF token, it returns the EOF token again. If a syntax
+// error occurs, it returns a *SyntaxError error.
+//
+// The text is nil for the semicolons inserted automatically.
+func (s *Scanner) Next() (int, ast.Position, []byte, ast.Context, error) {
+	if s.eof != nil {
+		return int(tokenEOF), *s.eof.pos, nil, s.eof.ctx, nil
+	}
+	tok, ok := <-s.lex.Tokens()
+	if !ok {
+		if err := s.lex.error(); err != nil {
+			return 0, ast.Position{}, nil, 0, err
+		}
+		// The scanning has been stopped.
+		return int(tokenEOF), ast.Position{}, nil, 0, nil
+	}
+	if tok.typ == tokenEOF {
+		s.eof = &tok
+	}
+	return int(tok.typ), *tok.pos, tok.txt, tok.ctx, nil
+}
+
+// Stop stops the scanning. It must be called if Next is not called until
+// it returns the EOF token or an error.
+func (s *Scanner) Stop() {
+	s.lex.Stop()
+}
+
+// TokenTypes returns the names of the token types, indexed by type, as they
+// are reported in the syntax errors.
+func TokenTypes() []string {
+	names := make([]string, len(tokenString))
+	for typ, name := range tokenString {
+		names[typ] = name
+	}
+	return names
+}
@@ -118,6 +118,11 @@ const (
 	tokenContains                          // contains
 	tokenRaw                               // raw
 	tokenUsing                             // using
+	tokenNilSafePeriod                     // ?.
+	tokenQuestionMark                      // ?
+	tokenDoublePeriod                      // ..
+	tokenTilde                             // ~
+	tokenTrans                             // trans
 )
 
 var tokenString = map[tokenTyp]string{
@@ -225,6 +230,11 @@ var tokenString = map[tokenTyp]string{
 	tokenContains:                 "contains",
 	tokenRaw:                      "raw",
 	tokenUsing:                    "using",
+	tokenNilSafePeriod:            "?.",
+	tokenQuestionMark:             "?",
+	tokenDoublePeriod:             "..",
+	tokenTilde:                    "~",
+	tokenTrans:                    "trans",
 }
 
 func (tt tokenTyp) String() string {
@@ -24,6 +24,7 @@ const (
 	propertyHasValue                                              // has a value
 	propertyIsMacroDeclaration                                    // is macro declaration
 	propertyMacroDeclaredInFileWithExtends                        // is macro declared in file with extends
+	propertyIsSanitizer                                           // is a sanitizer that replaces a conversion
 )
 
 // A typeInfo holds the type checking information. For example, every expression
@@ -108,6 +109,11 @@ func (ti *typeInfo) Addressable() bool {
 	return ti.Properties&propertyAddressable != 0
 }
 
+// IsSanitizer reports whether it is a sanitizer that replaces a conversion.
+func (ti *typeInfo) IsSanitizer() bool {
+	return ti.Properties&propertyIsSanitizer != 0
+}
+
 // IsNative reports whether it is native.
 func (ti *typeInfo) IsNative() bool {
 	return ti.Properties&propertyIsNative != 0
@@ -29,14 +29,39 @@ type definedType struct {
 	sign *byte
 }
 
+// definedKey is the key of a defined type in Types.
+type definedKey struct {
+	decl       string
+	name       string
+	underlying reflect.Type
+}
+
 // DefinedOf returns the defined type with the given name and underlying type.
-// For example, if n is "Int" and k represents int, DefinedOf(n, k) represents
-// the type Int declared with 'type Int int'.
-func (types *Types) DefinedOf(name string, underlyingType reflect.Type) reflect.Type {
+// For example, if n is "Int" and k represents int, DefinedOf(d, n, k)
+// represents the type Int declared with 'type Int int'.
+//
+// decl identifies the declaration, for example with its path and position.
+// DefinedOf returns the same type when called with the same declaration,
+// name and underlying type. If decl is empty, it returns a new type.
+func (types *Types) DefinedOf(decl, name string, underlyingType reflect.Type) reflect.Type {
 	if name == "" {
 		panic(internalError("name cannot be empty"))
 	}
-	return definedType{Type: underlyingType, name: name, sign: new(byte)}
+	if decl == "" {
+		return definedType{Type: underlyingType, name: name, sign: new(byte)}
+	}
+	key := definedKey{decl: decl, name: name, underlying: underlyingType}
+	types.mu.Lock()
+	defer types.mu.Unlock()
+	t, ok := types.definedTypes[key]
+	if !ok {
+		t = definedType{Type: underlyingType, name: name, sign: new(byte)}
+		if types.definedTypes == nil {
+			types.definedTypes = map[definedKey]reflect.Type{}
+		}
+		types.definedTypes[key] = t
+	}
+	return t
 }
 
 func (x definedType) Name() string {
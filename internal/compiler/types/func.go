@@ -42,6 +42,8 @@ func (types *Types) FuncOf(in, out []reflect.Type, variadic bool) reflect.Type {
 		}
 	}
 
+	types.mu.Lock()
+	defer types.mu.Unlock()
 	return funcType{
 		in:   types.funcParamsStore.deduplicate(in),
 		out:  types.funcParamsStore.deduplicate(out),
@@ -54,6 +54,8 @@ func equalFields(fs1, fs2 map[int]reflect.StructField) bool {
 // ensuring that every pointer to map returned by this method is equal if and
 // only if the underlying map is equal.
 func (types *Types) addFields(fields map[int]reflect.StructField) *map[int]reflect.StructField {
+	types.mu.Lock()
+	defer types.mu.Unlock()
 	for _, storedFields := range types.structFieldsLists {
 		if equalFields(*storedFields, fields) {
 			return storedFields
@@ -9,14 +9,19 @@ package types
 import (
 	"fmt"
 	"reflect"
+	"sync"
 
 	"github.com/open2b/scriggo/internal/runtime"
 )
 
 // Types allows to create and manage types and values, as the reflect package
-// does, for a specific compilation and for both the types compiled by Scriggo
-// and by gc.
+// does, for both the types compiled by Scriggo and by gc. An instance can be
+// shared by several compilations, also concurrently, so that the same type
+// declarations produce the same types.
 type Types struct {
+	// mu protects the following fields.
+	mu sync.Mutex
+
 	// funcParamsStore provides the function parameters necessary to create
 	// funcTypes.
 	funcParamsStore funcParams
@@ -24,6 +29,10 @@ type Types struct {
 	// structFieldsLists avoid the creation of two different structTypes with
 	// the same struct fields.
 	structFieldsLists []*map[int]reflect.StructField
+
+	// definedTypes holds the defined types created by DefinedOf, indexed by
+	// declaration.
+	definedTypes map[definedKey]reflect.Type
 }
 
 // NewTypes returns a new instance of Types.
@@ -139,6 +148,11 @@ func ConvertibleTo(x, y reflect.Type) bool {
 		}
 	}
 
+	// x is a slice, y is an array type, and the slice and array have the same element types.
+	if xk == reflect.Slice && yk == reflect.Array && y.Elem() == x.Elem() {
+		return true
+	}
+
 	// If y is an interface type, x must implement y.
 	if yk == reflect.Interface {
 		return Implements(x, y)
@@ -0,0 +1,69 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"reflect"
+)
+
+var complex64Type = reflect.TypeOf(complex64(0))
+var complex128Type = reflect.TypeOf(complex128(0))
+
+// complexOp returns the result of the operation op, that is OpAddComplex,
+// OpSubComplex, OpMulComplex or OpDivComplex, on the complex values x and y
+// with the same type. Values with kind Complex64 are computed with the
+// precision of complex64.
+func complexOp(op Operation, x, y reflect.Value) reflect.Value {
+	var z complex128
+	if x.Kind() == reflect.Complex64 {
+		c1, c2 := complex64(x.Complex()), complex64(y.Complex())
+		var c complex64
+		switch op {
+		case OpAddComplex:
+			c = c1 + c2
+		case OpSubComplex:
+			c = c1 - c2
+		case OpMulComplex:
+			c = c1 * c2
+		case OpDivComplex:
+			c = c1 / c2
+		}
+		if x.Type() == complex64Type {
+			return reflect.ValueOf(c)
+		}
+		z = complex128(c)
+	} else {
+		c1, c2 := x.Complex(), y.Complex()
+		switch op {
+		case OpAddComplex:
+			z = c1 + c2
+		case OpSubComplex:
+			z = c1 - c2
+		case OpMulComplex:
+			z = c1 * c2
+		case OpDivComplex:
+			z = c1 / c2
+		}
+		if x.Type() == complex128Type {
+			return reflect.ValueOf(z)
+		}
+	}
+	v := reflect.New(x.Type()).Elem()
+	v.SetComplex(z)
+	return v
+}
+
+// negComplex returns the negation of the complex value x.
+func negComplex(x reflect.Value) reflect.Value {
+	switch x.Type() {
+	case complex64Type:
+		return reflect.ValueOf(-complex64(x.Complex()))
+	case complex128Type:
+		return reflect.ValueOf(-x.Complex())
+	}
+	v := reflect.New(x.Type()).Elem()
+	v.SetComplex(-x.Complex())
+	return v
+}
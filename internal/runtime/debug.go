@@ -0,0 +1,97 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import "reflect"
+
+// A Debugger is called by the VM, when set with the SetDebugger method,
+// before the execution of each statement of the functions with statement
+// debug information.
+type Debugger interface {
+
+	// Statement is called before the execution of a statement, in the
+	// goroutine that executes it, so it can be called concurrently. The
+	// execution of the statement starts when Statement returns. frame is
+	// valid only during the call.
+	Statement(frame *DebugFrame)
+}
+
+// WatchFunc is called by the VM, when set with the SetWatchpoints method,
+// after the assignment of a watched global variable. global is the index of
+// the variable in the globals passed to Run. It is called in the goroutine
+// that executes the assignment, so it can be called concurrently, and frame
+// is valid only during the call.
+type WatchFunc func(frame *DebugFrame, global int)
+
+// DebugFrame is the frame of a function that is going to execute a
+// statement or that has assigned a watched global variable.
+type DebugFrame struct {
+	vm   *VM
+	info DebugInfo
+}
+
+// stmtDebugInfo returns the statement debug information of the statement
+// that is executing. If the function has no statement debug information, it
+// returns only the path of the file of the function.
+func (vm *VM) stmtDebugInfo() DebugInfo {
+	if len(vm.fn.StmtDebugInfo) > 0 {
+		for pc := vm.pc - 1; ; pc-- {
+			if info, ok := vm.fn.StmtDebugInfo[pc]; ok {
+				return info
+			}
+			if pc == 0 {
+				break
+			}
+		}
+	}
+	return DebugInfo{Path: vm.fn.File}
+}
+
+// Function returns the function.
+func (frame *DebugFrame) Function() *Function {
+	return frame.vm.fn
+}
+
+// Path returns the path of the file of the statement.
+func (frame *DebugFrame) Path() string {
+	return frame.info.Path
+}
+
+// Position returns the position of the statement.
+func (frame *DebugFrame) Position() Position {
+	return frame.info.Position
+}
+
+// Stack returns the stack trace of the goroutine that executes the function.
+func (frame *DebugFrame) Stack() []byte {
+	buf := make([]byte, 1024)
+	for {
+		n := frame.vm.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// Registers returns a copy of the registers of the function.
+func (frame *DebugFrame) Registers() Registers {
+	vm := frame.vm
+	n := vm.fn.NumReg
+	var regs Registers
+	if n[0] > 0 {
+		regs.Int = append([]int64(nil), vm.regs.int[vm.fp[0]+1:vm.fp[0]+1+Addr(n[0])]...)
+	}
+	if n[1] > 0 {
+		regs.Float = append([]float64(nil), vm.regs.float[vm.fp[1]+1:vm.fp[1]+1+Addr(n[1])]...)
+	}
+	if n[2] > 0 {
+		regs.String = append([]string(nil), vm.regs.string[vm.fp[2]+1:vm.fp[2]+1+Addr(n[2])]...)
+	}
+	if n[3] > 0 {
+		regs.General = append([]reflect.Value(nil), vm.regs.general[vm.fp[3]+1:vm.fp[3]+1+Addr(n[3])]...)
+	}
+	return regs
+}
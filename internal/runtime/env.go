@@ -5,13 +5,72 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"runtime"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/open2b/scriggo/ast"
 )
 
 type PrintFunc func(interface{})
 
+// FallbackPrinterFunc formats a shown value whose type cannot otherwise be
+// shown.
+type FallbackPrinterFunc func(interface{}) (string, error)
+
+// PostProcessFunc processes a text block, with the given format, before it
+// is rendered and returns the block to render.
+type PostProcessFunc func(format ast.Format, block []byte) []byte
+
+// TranslateFunc translates the text of a trans statement to the given locale
+// and returns the translated text.
+type TranslateFunc func(locale, text string) string
+
+// NativeCallHook is called in place of a native function or method with the
+// package and the name of the function, that can be empty strings, and the
+// arguments of the call, without the native.Env argument. call calls the
+// function and returns its results. The hook returns the results of the call.
+type NativeCallHook func(pkg, name string, args []reflect.Value, call func() []reflect.Value) []reflect.Value
+
+// Allocator allocates the values created by the new and make builtins and by
+// the composite literals. Its methods must return
+// values of the requested types and can be called concurrently. If a method
+// returns an error, the execution is terminated with the error.
+type Allocator interface {
+
+	// New returns a pointer to a new zero value of type typ.
+	New(typ reflect.Type) (reflect.Value, error)
+
+	// MakeSlice returns a new slice of type typ with length len and
+	// capacity cap.
+	MakeSlice(typ reflect.Type, len, cap int) (reflect.Value, error)
+
+	// MakeMap returns a new map of type typ with space for approximately n
+	// elements. n is zero if the size has not been specified.
+	MakeMap(typ reflect.Type, n int) (reflect.Value, error)
+
+	// MakeChan returns a new bidirectional channel of type typ with the
+	// given buffer size.
+	MakeChan(typ reflect.Type, buffer int) (reflect.Value, error)
+}
+
+// JSONNonFinite determines how the floating-point values NaN, +Inf and -Inf
+// are shown in JSON context.
+type JSONNonFinite int
+
+const (
+	JSONNonFiniteNull   JSONNonFinite = iota // shown as null.
+	JSONNonFiniteString                      // shown as the strings "NaN", "+Inf" and "-Inf".
+	JSONNonFiniteError                       // cannot be shown.
+)
+
 // Context represents a context in Show and Text instructions.
 type Context byte
 
@@ -19,13 +78,48 @@ type Context byte
 type env struct {
 	ctx     context.Context // context.
 	globals []reflect.Value // global variables.
+	watched map[uintptr]int // indexes of the watched global variables, by address.
+	locale  string          // locale.
+	loc     *time.Location  // location.
 	print   PrintFunc       // custom print builtin.
 	typeof  TypeOfFunc      // typeof function.
 
+	fallbackPrinter FallbackPrinterFunc // formats values that cannot be shown.
+	postProcess     PostProcessFunc     // processes the text blocks.
+	translate       TranslateFunc       // translates the texts of the trans statements.
+	nativeCallHook  NativeCallHook      // called in place of the native functions.
+	jsonNonFinite   JSONNonFinite       // how NaN and infinite values are shown in JSON.
+	debugger        Debugger            // called before the execution of the statements.
+	watch           WatchFunc           // called after the assignment of the watched globals.
+	watchGlobals    []int               // indexes of the watched global variables.
+	allocator       Allocator           // allocates the values of new, make and composite literals.
+
+	maxMarkdownSize     int // maximum size of a converted Markdown block.
+	maxMarkdownHTMLSize int // maximum size of the HTML of a converted Markdown block.
+
+	markdownHTML  map[string][]byte // HTML of the Markdown values converted before the execution.
+	markdownMu    sync.Mutex        // guards markdownCache.
+	markdownCache map[string][]byte // HTML of the Markdown values converted during the execution.
+
+	opLimits [numOperationCategories]int64 // maximum number of operations by category.
+	opCounts [numOperationCategories]int64 // number of operations by category.
+
+	memoryLimit int64 // maximum number of bytes that can be allocated.
+	memoryUsed  int64 // number of bytes allocated.
+
+	maxGoroutines int           // maximum number of parallel iterations.
+	parallelOnce  sync.Once     // initializes parallelSem.
+	parallelSem   chan struct{} // semaphore of the parallel iterations.
+
 	done     int32
 	doneChan <-chan struct{}
 	doneCase reflect.SelectCase
 
+	stopOnGoroutinePanic bool               // stop the execution when a goroutine panics.
+	cancel               context.CancelFunc // cancels the context when a goroutine panics.
+	goMu                 sync.Mutex         // guards goErr.
+	goErr                error              // error of the first goroutine that failed.
+
 	// Only the callPath field can be changed after the vm has been started
 	// and access to this field must be done with this mutex.
 	mu       sync.Mutex
@@ -47,6 +141,236 @@ func (env *env) Fatal(v interface{}) {
 	panic(&fatalError{env: env, msg: v})
 }
 
+func (env *env) Locale() string {
+	return env.locale
+}
+
+func (env *env) Location() *time.Location {
+	return env.loc
+}
+
+// goroutineFailed is called when a goroutine has terminated with the error
+// err. If the execution stops when a goroutine panics, it records the first
+// error and cancels the context, so that the other goroutines are stopped.
+func (env *env) goroutineFailed(err error) {
+	if env.cancel == nil || err == env.ctx.Err() {
+		return
+	}
+	env.goMu.Lock()
+	if env.goErr == nil {
+		env.goErr = err
+		env.cancel()
+	}
+	env.goMu.Unlock()
+}
+
+// goroutineError returns the error of the first goroutine that failed, or
+// nil if no goroutine has failed.
+func (env *env) goroutineError() error {
+	env.goMu.Lock()
+	err := env.goErr
+	env.goMu.Unlock()
+	return err
+}
+
+// countOperation counts an operation of category c. If the operations of
+// the category exceed the limit, it stops the execution with an
+// *OperationLimitError error.
+func (env *env) countOperation(c OperationCategory) {
+	if limit := env.opLimits[c]; limit > 0 {
+		if atomic.AddInt64(&env.opCounts[c], 1) > limit {
+			panic(stopError{&OperationLimitError{Category: c, Limit: int(limit)}})
+		}
+	}
+}
+
+// Approximate sizes of the headers of the maps and channels.
+const (
+	mapHeaderSize  = 48
+	chanHeaderSize = 96
+)
+
+// allocate charges bytes to the allocated memory. If the memory limit is
+// exceeded, it stops the execution with a *MemoryLimitError error with the
+// path and the position of the instruction at address pc of fn.
+func (env *env) allocate(fn *Function, pc Addr, bytes int64) {
+	limit := env.memoryLimit
+	if limit == 0 {
+		return
+	}
+	if bytes > limit || atomic.AddInt64(&env.memoryUsed, bytes) > limit {
+		debugInfo, ok := fn.DebugInfo[pc]
+		if !ok {
+			debugInfo.Path = fn.File
+		}
+		panic(stopError{&MemoryLimitError{Path: debugInfo.Path, Position: debugInfo.Position, Limit: int(limit)}})
+	}
+}
+
+// memorySize returns the number of bytes of a value with a header of header
+// bytes and n elements of size bytes. If the number of bytes does not fit in
+// an int64, it returns math.MaxInt64.
+func memorySize(header, size uintptr, n int) int64 {
+	if n <= 0 || size == 0 {
+		return int64(header)
+	}
+	if uint64(size) > uint64(math.MaxInt64-int64(header))/uint64(n) {
+		return math.MaxInt64
+	}
+	return int64(header) + int64(size)*int64(n)
+}
+
+// new returns a pointer to a new zero value of type t, allocated by the
+// allocator if it has been set.
+func (env *env) new(t reflect.Type) reflect.Value {
+	if env.allocator == nil {
+		return reflect.New(t)
+	}
+	v, err := env.allocator.New(t)
+	if err != nil {
+		panic(stopError{err})
+	}
+	return v
+}
+
+// makeSlice returns a new slice of type t with length len and capacity cap,
+// allocated by the allocator if it has been set.
+func (env *env) makeSlice(t reflect.Type, len, cap int) reflect.Value {
+	if env.allocator == nil {
+		return reflect.MakeSlice(t, len, cap)
+	}
+	v, err := env.allocator.MakeSlice(t, len, cap)
+	if err != nil {
+		panic(stopError{err})
+	}
+	return v
+}
+
+// makeMap returns a new map of type t with space for approximately n
+// elements, allocated by the allocator if it has been set.
+func (env *env) makeMap(t reflect.Type, n int) reflect.Value {
+	if env.allocator == nil {
+		if n > 0 {
+			return reflect.MakeMapWithSize(t, n)
+		}
+		return reflect.MakeMap(t)
+	}
+	v, err := env.allocator.MakeMap(t, n)
+	if err != nil {
+		panic(stopError{err})
+	}
+	return v
+}
+
+// makeChan returns a new channel of type t with the given buffer size,
+// allocated by the allocator if it has been set.
+func (env *env) makeChan(t reflect.Type, buffer int) reflect.Value {
+	dir := t.ChanDir()
+	if dir != reflect.BothDir {
+		t = reflect.ChanOf(reflect.BothDir, t.Elem())
+	}
+	var ch reflect.Value
+	if env.allocator == nil {
+		ch = reflect.MakeChan(t, buffer)
+	} else {
+		var err error
+		ch, err = env.allocator.MakeChan(t, buffer)
+		if err != nil {
+			panic(stopError{err})
+		}
+	}
+	if dir != reflect.BothDir {
+		ch = ch.Convert(reflect.ChanOf(dir, t.Elem()))
+	}
+	return ch
+}
+
+// parallelSemaphore returns the semaphore that limits the number of
+// goroutines started by the parallel for statements. Its capacity does not
+// count the goroutine that executes a statement, as it executes the
+// iterations itself when the semaphore is full.
+func (env *env) parallelSemaphore() chan struct{} {
+	env.parallelOnce.Do(func() {
+		n := env.maxGoroutines
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		env.parallelSem = make(chan struct{}, n-1)
+	})
+	return env.parallelSem
+}
+
+// convertMarkdown converts the Markdown block src to HTML with conv, and
+// writes the HTML to out. If the conversion fails or exceeds a size limit,
+// it returns a *MarkdownError error without the path and the position.
+func (env *env) convertMarkdown(conv Converter, src []byte, out io.Writer) error {
+	if max := env.maxMarkdownSize; max > 0 && len(src) > max {
+		return &MarkdownError{Block: src, Err: fmt.Errorf("size exceeds the limit of %d bytes", max)}
+	}
+	if max := env.maxMarkdownHTMLSize; max > 0 {
+		out = &limitedWriter{w: out, max: max}
+	}
+	ctx := env.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	err := conv(ctx, src, out)
+	if err != nil {
+		return &MarkdownError{Block: src, Err: err}
+	}
+	return nil
+}
+
+// convertMarkdownValue is like convertMarkdown but it converts a Markdown
+// value, and a value is converted at most once in an execution. If the value
+// has been converted before the execution, it is not converted again.
+func (env *env) convertMarkdownValue(conv Converter, src string, out io.Writer) error {
+	if html, ok := env.markdownHTML[src]; ok {
+		// Convert with a converter that writes the HTML, so that the limits
+		// are checked as for the other conversions.
+		conv = func(_ context.Context, _ []byte, out io.Writer) error {
+			_, err := out.Write(html)
+			return err
+		}
+		return env.convertMarkdown(conv, []byte(src), out)
+	}
+	env.markdownMu.Lock()
+	html, ok := env.markdownCache[src]
+	env.markdownMu.Unlock()
+	if !ok {
+		var b bytes.Buffer
+		err := env.convertMarkdown(conv, []byte(src), &b)
+		if err != nil {
+			return err
+		}
+		html = b.Bytes()
+		env.markdownMu.Lock()
+		if env.markdownCache == nil {
+			env.markdownCache = map[string][]byte{}
+		}
+		env.markdownCache[src] = html
+		env.markdownMu.Unlock()
+	}
+	_, err := out.Write(html)
+	return err
+}
+
+// limitedWriter writes to w at most max bytes, then it returns an error.
+type limitedWriter struct {
+	w   io.Writer
+	max int
+	n   int // written bytes.
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if lw.n+len(p) > lw.max {
+		return 0, fmt.Errorf("HTML size exceeds the limit of %d bytes", lw.max)
+	}
+	n, err := lw.w.Write(p)
+	lw.n += n
+	return n, err
+}
+
 func (env *env) Print(args ...interface{}) {
 	for _, arg := range args {
 		env.doPrint(arg)
@@ -80,27 +404,5 @@ func (env *env) doPrint(arg interface{}) {
 		env.print(arg)
 		return
 	}
-	r := reflect.ValueOf(arg)
-	switch r.Kind() {
-	case reflect.Invalid, reflect.Array, reflect.Func, reflect.Struct:
-		print(hex(reflect.ValueOf(&arg).Elem().InterfaceData()[1]))
-	case reflect.Bool:
-		print(r.Bool())
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		print(r.Int())
-	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		print(r.Uint())
-	case reflect.Float32, reflect.Float64:
-		print(r.Float())
-	case reflect.Complex64, reflect.Complex128:
-		print(r.Complex())
-	case reflect.Chan, reflect.Map, reflect.UnsafePointer:
-		print(hex(r.Pointer()))
-	case reflect.Interface, reflect.Ptr:
-		print(arg)
-	case reflect.Slice:
-		print("[", r.Len(), "/", r.Cap(), "]", hex(r.Pointer()))
-	case reflect.String:
-		print(r.String())
-	}
+	print(string(appendPrint(nil, arg)))
 }
@@ -7,8 +7,10 @@ package runtime
 import (
 	"reflect"
 	"runtime"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var errNilPointer = runtimeError("runtime error: invalid memory address or nil pointer dereference")
@@ -82,6 +84,101 @@ func (err stopError) Error() string {
 	return "stop: " + err.Error()
 }
 
+// OperationCategory is a category of operations that can be limited.
+type OperationCategory int
+
+const (
+	NativeCalls       OperationCategory = iota // calls of native functions and methods.
+	MapAllocations                             // allocations of maps.
+	ChannelOperations                          // channel allocations, sends, receives, closes and selects.
+	numOperationCategories
+)
+
+var operationCategoryNames = [...]string{"native calls", "map allocations", "channel operations"}
+
+// String returns the name of the category, for example "native calls".
+func (c OperationCategory) String() string {
+	return operationCategoryNames[c]
+}
+
+// OperationLimitError is the error returned by Run when the operations of a
+// category exceed the limit set with the SetOperationLimit method.
+type OperationLimitError struct {
+	Category OperationCategory
+	Limit    int
+}
+
+func (err *OperationLimitError) Error() string {
+	return "limit of " + strconv.Itoa(err.Limit) + " " + err.Category.String() + " exceeded"
+}
+
+// MemoryLimitError is the error returned by Run when the memory allocated
+// exceeds the limit set with the SetMemoryLimit method. Path and Position are
+// the path and the position of the statement, or expression, that allocates
+// the memory.
+type MemoryLimitError struct {
+	Path     string
+	Position Position
+	Limit    int
+}
+
+func (err *MemoryLimitError) Error() string {
+	return err.Path + ":" + err.Position.String() + ": memory limit of " + strconv.Itoa(err.Limit) + " bytes exceeded"
+}
+
+// MarkdownError is the error returned by Run when the conversion of a
+// Markdown block to HTML fails or exceeds a limit set with the
+// SetMarkdownLimits method. Path and Position are the path and the position
+// of the statement, or expression, that converts the block.
+type MarkdownError struct {
+	Path     string
+	Position Position
+	Block    []byte
+	Err      error
+}
+
+func (err *MarkdownError) Error() string {
+	return err.Path + ":" + err.Position.String() + ": cannot convert Markdown block " +
+		markdownBlockName(err.Block) + " to HTML: " + err.Err.Error()
+}
+
+func (err *MarkdownError) Unwrap() error {
+	return err.Err
+}
+
+// markdownBlockName returns the name of a Markdown block in the errors. It
+// is the quoted first line of the block, truncated if it is too long.
+func markdownBlockName(block []byte) string {
+	const maxLen = 30
+	s := strings.TrimSpace(string(block))
+	var truncated bool
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+		truncated = true
+	}
+	if utf8.RuneCountInString(s) > maxLen {
+		s = string([]rune(s)[:maxLen])
+		truncated = true
+	}
+	s = strconv.Quote(s)
+	if truncated {
+		s += "..."
+	}
+	return s
+}
+
+// InternalError is the error returned by Run when the virtual machine panics
+// for a reason other than a panic of the executed code, as it happens with a
+// bug in the emitted code. Stack is the stack trace of the panic.
+type InternalError struct {
+	Msg   interface{}
+	Stack []byte
+}
+
+func (err *InternalError) Error() string {
+	return "scriggo: internal error: " + panicToString(err.Msg)
+}
+
 // errIndexOutOfRange returns an index of range runtime error for the
 // currently running virtual machine instruction.
 func (vm *VM) errIndexOutOfRange() runtimeError {
@@ -104,12 +201,73 @@ func (vm *VM) errIndexOutOfRange() runtimeError {
 	return runtimeError(s)
 }
 
-// newPanic returns a new *PanicError with the given error message.
+// errConvertSliceToArray returns the error of a conversion of a slice with
+// length n to an array, or to a pointer to an array, with length m.
+func errConvertSliceToArray(n, m int) runtimeError {
+	s := "runtime error: cannot convert slice with length " + strconv.Itoa(n) +
+		" to array or pointer to array with length " + strconv.Itoa(m)
+	return runtimeError(s)
+}
+
+// newPanic returns a new *PanicError with the given error message. The path
+// and the position are those of the currently running instruction.
 func (vm *VM) newPanic(msg interface{}) *PanicError {
+	debugInfo := vm.fn.DebugInfo[vm.pc-1]
 	return &PanicError{
 		message:  msg,
-		path:     vm.fn.DebugInfo[vm.pc].Path,
-		position: vm.fn.DebugInfo[vm.pc].Position,
+		path:     debugInfo.Path,
+		position: debugInfo.Position,
+		stack:    vm.stackFrames(),
+	}
+}
+
+// StackFrame is a frame of the stack trace of a panic.
+type StackFrame struct {
+	Function *Function // function.
+	Path     string    // path of the file of the executing instruction.
+	Position Position  // position of the executing instruction, zero if unknown.
+}
+
+// stackFrames returns the frames of the call stack, starting from the
+// running function. The positions are taken from the position tables of the
+// functions.
+func (vm *VM) stackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, len(vm.calls)+1)
+	path, pos := vm.fn.PositionOf(vm.pc - 1)
+	frames = append(frames, StackFrame{Function: vm.fn, Path: path, Position: pos})
+	for i := len(vm.calls) - 1; i >= 0; i-- {
+		call := vm.calls[i]
+		fn := call.cl.fn
+		if fn == nil {
+			continue
+		}
+		frame := StackFrame{Function: fn, Path: fn.File}
+		switch call.status {
+		case started:
+			frame.Path, frame.Position = fn.PositionOf(call.pc - 2)
+		case tailed:
+			frame.Path, frame.Position = fn.PositionOf(call.pc - 1)
+		case deferred:
+			// The deferred function has not been called yet.
+			continue
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// stopOnMarkdownError stops the execution if err is a *MarkdownError. The
+// path and the position of err are set to those of the instruction at
+// address pc of fn.
+func stopOnMarkdownError(fn *Function, pc Addr, err error) {
+	if e, ok := err.(*MarkdownError); ok {
+		debugInfo, ok := fn.DebugInfo[pc]
+		if !ok {
+			debugInfo.Path = fn.File
+		}
+		e.Path = debugInfo.Path
+		e.Position = debugInfo.Position
+		panic(stopError{e})
 	}
 }
 
@@ -154,6 +312,8 @@ func (vm *VM) convertPanic(msg interface{}) error {
 		case *fatalError:
 			// TODO: check env.
 			return msg
+		case *InternalError:
+			return msg
 		case runtime.Error:
 			// TODO: check env.
 			break
@@ -187,13 +347,29 @@ func (vm *VM) convertPanic(msg interface{}) error {
 		if err, ok := msg.(error); ok {
 			return err
 		}
+	case OpParallel:
+		switch err := msg.(type) {
+		case *PanicError:
+			return err
+		case *fatalError:
+			return err
+		case *InternalError:
+			return err
+		}
 	case OpIf, -OpIf:
 		if err, ok := msg.(runtime.Error); ok {
 			if s := err.Error(); strings.HasPrefix(s, "runtime error: comparing uncomparable type ") {
 				return vm.newPanic(runtimeError(s))
 			}
 		}
-	case OpIndexString, -OpIndexString:
+	case OpIndexString, -OpIndexString, OpIndexStringIfInt, -OpIndexStringIfInt:
+		if err, ok := msg.(runtime.Error); ok {
+			if s := err.Error(); strings.HasPrefix(s, "runtime error: index out of range") {
+				return vm.newPanic(runtimeError(s))
+			}
+		}
+	case OpLoadBigEndian, OpLoadLittleEndian, OpStoreBigEndian, -OpStoreBigEndian,
+		OpStoreLittleEndian, -OpStoreLittleEndian:
 		if err, ok := msg.(runtime.Error); ok {
 			if s := err.Error(); strings.HasPrefix(s, "runtime error: index out of range") {
 				return vm.newPanic(runtimeError(s))
@@ -249,16 +425,16 @@ func (vm *VM) convertPanic(msg interface{}) error {
 	if _, ok := msg.(runtimeError); ok {
 		return vm.newPanic(msg)
 	}
-	return &fatalError{msg: msg}
+	return &InternalError{Msg: msg, Stack: debug.Stack()}
 }
 
 type PanicError struct {
-	message    interface{}
-	recovered  bool
-	stackTrace []byte
-	next       *PanicError
-	path       string
-	position   Position
+	message   interface{}
+	recovered bool
+	stack     []StackFrame
+	next      *PanicError
+	path      string
+	position  Position
 }
 
 // Error returns all currently active panics as a string.
@@ -310,6 +486,12 @@ func (p *PanicError) Position() Position {
 	return p.position
 }
 
+// Stack returns the stack trace of the goroutine that panicked, starting
+// from the function that panicked.
+func (p *PanicError) Stack() []StackFrame {
+	return p.stack
+}
+
 func panicToString(msg interface{}) string {
 	switch v := msg.(type) {
 	case nil:
@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -61,3 +62,33 @@ func TestPanicToString(t *testing.T) {
 		})
 	}
 }
+
+// TestInternalError tests that Run returns an *InternalError when the
+// virtual machine panics for a bug in the executed code.
+func TestInternalError(t *testing.T) {
+	// The instruction moves a general constant that does not exist.
+	fn := &Function{
+		Pkg:  "main",
+		Name: "main",
+		Type: reflect.FuncOf(nil, nil, false),
+		Body: []Instruction{
+			{Op: -OpMove, A: int8(generalRegister), B: 0, C: 1},
+			{Op: OpReturn},
+		},
+	}
+	fn.NumReg[generalRegister] = 1
+	err := NewVM().Run(fn, nil, nil)
+	if err == nil {
+		t.Fatal("expecting error, got nil")
+	}
+	e, ok := err.(*InternalError)
+	if !ok {
+		t.Fatalf("expecting *InternalError, got %T: %s", err, err)
+	}
+	if msg := "scriggo: internal error: runtime error: index out of range [0] with length 0"; e.Error() != msg {
+		t.Fatalf("expecting error %q, got %q", msg, e.Error())
+	}
+	if !strings.Contains(string(e.Stack), "runtime.(*VM).run(") {
+		t.Fatalf("expecting the stack of the panic, got:\n%s", e.Stack)
+	}
+}
@@ -17,80 +17,101 @@ type strWriter interface {
 	WriteString(s string) (int, error)
 }
 
+// htmlEscapes contains the bytes that must be escaped when placed inside
+// HTML.
+var htmlEscapes = []string{
+	'"':  "&#34;",
+	'&':  "&amp;",
+	'\'': "&#39;",
+	'<':  "&lt;",
+	'>':  "&gt;",
+}
+
+// htmlNoEntitiesEscapes is like htmlEscapes but does not escape the HTML
+// entities.
+var htmlNoEntitiesEscapes = []string{
+	'"':  "&#34;",
+	'\'': "&#39;",
+	'<':  "&lt;",
+	'>':  "&gt;",
+}
+
+// unquotedAttributeEscapes contains the bytes that must be escaped when
+// placed inside an unquoted HTML attribute value.
+var unquotedAttributeEscapes = []string{
+	'\t': "&#09;",
+	'\n': "&#10;",
+	'\f': "&#12;",
+	'\r': "&#13;",
+	' ':  "&#32;",
+	'"':  "&#34;",
+	'&':  "&amp;",
+	'\'': "&#39;",
+	'<':  "&lt;",
+	'=':  "&#61;",
+	'>':  "&gt;",
+	'`':  "&#96;",
+}
+
+// unquotedAttributeNoEntitiesEscapes is like unquotedAttributeEscapes but
+// does not escape the HTML entities.
+var unquotedAttributeNoEntitiesEscapes = []string{
+	'\t': "&#09;",
+	'\n': "&#10;",
+	'\f': "&#12;",
+	'\r': "&#13;",
+	' ':  "&#32;",
+	'"':  "&#34;",
+	'\'': "&#39;",
+	'<':  "&lt;",
+	'=':  "&#61;",
+	'>':  "&gt;",
+	'`':  "&#96;",
+}
+
 // htmlEscape escapes the string s, so it can be placed inside HTML, and
 // writes it on w.
 func htmlEscape(w strWriter, s string) error {
+	return escapeWithTable(w, s, htmlEscapes)
+}
+
+// htmlEscapeWriter is an io.Writer that escapes the bytes written to it, as
+// htmlEscape does, and writes them to w.
+type htmlEscapeWriter struct {
+	w strWriter
+}
+
+func (ew htmlEscapeWriter) Write(p []byte) (int, error) {
 	last := 0
-	for i := 0; i < len(s); i++ {
-		var esc string
-		switch s[i] {
-		case '"':
-			esc = "&#34;"
-		case '\'':
-			esc = "&#39;"
-		case '&':
-			esc = "&amp;"
-		case '<':
-			esc = "&lt;"
-		case '>':
-			esc = "&gt;"
-		default:
+	for i, c := range p {
+		if int(c) >= len(htmlEscapes) || htmlEscapes[c] == "" {
 			continue
 		}
 		if last != i {
-			_, err := w.WriteString(s[last:i])
+			_, err := ew.w.Write(p[last:i])
 			if err != nil {
-				return err
+				return last, err
 			}
 		}
-		_, err := w.WriteString(esc)
+		_, err := ew.w.WriteString(htmlEscapes[c])
 		if err != nil {
-			return err
+			return i, err
 		}
 		last = i + 1
 	}
-	if last != len(s) {
-		_, err := w.WriteString(s[last:])
-		return err
+	if last != len(p) {
+		_, err := ew.w.Write(p[last:])
+		if err != nil {
+			return last, err
+		}
 	}
-	return nil
+	return len(p), nil
 }
 
 // htmlNoEntitiesEscape escapes and writes to w the string s as htmlEscape
 // does but without escaping the HTML entities.
 func htmlNoEntitiesEscape(w strWriter, s string) error {
-	last := 0
-	for i := 0; i < len(s); i++ {
-		var esc string
-		switch s[i] {
-		case '"':
-			esc = "&#34;"
-		case '\'':
-			esc = "&#39;"
-		case '<':
-			esc = "&lt;"
-		case '>':
-			esc = "&gt;"
-		default:
-			continue
-		}
-		if last != i {
-			_, err := w.WriteString(s[last:i])
-			if err != nil {
-				return err
-			}
-		}
-		_, err := w.WriteString(esc)
-		if err != nil {
-			return err
-		}
-		last = i + 1
-	}
-	if last != len(s) {
-		_, err := w.WriteString(s[last:])
-		return err
-	}
-	return nil
+	return escapeWithTable(w, s, htmlNoEntitiesEscapes)
 }
 
 // attributeEscape escapes the string s, so it can be placed inside an HTML
@@ -103,38 +124,20 @@ func attributeEscape(w strWriter, s string, escapeEntities, quoted bool) error {
 		}
 		return htmlNoEntitiesEscape(w, s)
 	}
+	if escapeEntities {
+		return escapeWithTable(w, s, unquotedAttributeEscapes)
+	}
+	return escapeWithTable(w, s, unquotedAttributeNoEntitiesEscapes)
+}
+
+// escapeWithTable escapes the string s, replacing each byte c with
+// escapes[c] if it is not empty, and writes it to w. The bytes that are not
+// escaped are written in runs, with a single call to w.WriteString.
+func escapeWithTable(w strWriter, s string, escapes []string) error {
 	last := 0
 	for i := 0; i < len(s); i++ {
-		var esc string
-		switch s[i] {
-		case '<':
-			esc = "&lt;"
-		case '>':
-			esc = "&gt;"
-		case '&':
-			if escapeEntities {
-				esc = "&amp;"
-			}
-		case '\t':
-			esc = "&#09;"
-		case '\n':
-			esc = "&#10;"
-		case '\r':
-			esc = "&#13;"
-		case '\x0C':
-			esc = "&#12;"
-		case ' ':
-			esc = "&#32;"
-		case '"':
-			esc = "&#34;"
-		case '\'':
-			esc = "&#39;"
-		case '=':
-			esc = "&#61;"
-		case '`':
-			esc = "&#96;"
-		}
-		if esc == "" {
+		c := s[i]
+		if int(c) >= len(escapes) || escapes[c] == "" {
 			continue
 		}
 		if last != i {
@@ -143,7 +146,7 @@ func attributeEscape(w strWriter, s string, escapeEntities, quoted bool) error {
 				return err
 			}
 		}
-		_, err := w.WriteString(esc)
+		_, err := w.WriteString(escapes[c])
 		if err != nil {
 			return err
 		}
@@ -299,17 +302,26 @@ var jsStringEscapes = []string{
 
 // jsStringEscape escapes the string s so it can be placed within a JavaScript
 // and JSON string with single or double quotes, and write it to w.
+//
+// It reads s byte by byte, instead of rune by rune, as the runes U+2028 and
+// U+2029 are the only non-ASCII runes to escape and their encoding starts
+// with the byte 0xE2.
 func jsStringEscape(w strWriter, s string) error {
 	last := 0
-	for i, c := range s {
+	for i := 0; i < len(s); i++ {
 		var esc string
-		switch {
+		n := 1
+		switch c := s[i]; {
 		case int(c) < len(jsStringEscapes):
 			esc = jsStringEscapes[c]
-		case c == '\u2028':
-			esc = `\u2028`
-		case c == '\u2029':
-			esc = `\u2029`
+		case c == 0xE2 && i+2 < len(s) && s[i+1] == 0x80:
+			switch s[i+2] {
+			case 0xA8:
+				esc = `\u2028`
+			case 0xA9:
+				esc = `\u2029`
+			}
+			n = 3
 		}
 		if esc == "" {
 			continue
@@ -324,11 +336,8 @@ func jsStringEscape(w strWriter, s string) error {
 		if err != nil {
 			return err
 		}
-		if c == '\u2028' || c == '\u2029' {
-			last = i + 3
-		} else {
-			last = i + 1
-		}
+		i += n - 1
+		last = i + 1
 	}
 	if last != len(s) {
 		_, err := w.WriteString(s[last:])
@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"math/rand"
 	"strings"
 	"testing"
 )
@@ -72,3 +73,283 @@ func TestJSStringEscape(t *testing.T) {
 		t.Errorf("unexpected %q, expecting %q\n", b.String(), s)
 	}
 }
+
+// The following reference functions are the byte by byte implementations of
+// the escapers, used to test the table driven implementations.
+
+// referenceHTMLEscape escapes the string s, so it can be placed inside
+// HTML, and writes it on w.
+func referenceHTMLEscape(w strWriter, s string) error {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		default:
+			continue
+		}
+		if last != i {
+			_, err := w.WriteString(s[last:i])
+			if err != nil {
+				return err
+			}
+		}
+		_, err := w.WriteString(esc)
+		if err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	if last != len(s) {
+		_, err := w.WriteString(s[last:])
+		return err
+	}
+	return nil
+}
+
+// referenceHTMLNoEntitiesEscape escapes and writes to w the string s as
+// htmlEscape does but without escaping the HTML entities.
+func referenceHTMLNoEntitiesEscape(w strWriter, s string) error {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		default:
+			continue
+		}
+		if last != i {
+			_, err := w.WriteString(s[last:i])
+			if err != nil {
+				return err
+			}
+		}
+		_, err := w.WriteString(esc)
+		if err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	if last != len(s) {
+		_, err := w.WriteString(s[last:])
+		return err
+	}
+	return nil
+}
+
+// referenceAttributeEscape escapes the string s, so it can be placed inside
+// an HTML attribute value, and write it to w. If escapeEntities is true it
+// escapes also the HTML entities. quoted reports whether the attribute is
+// quoted.
+func referenceAttributeEscape(w strWriter, s string, escapeEntities, quoted bool) error {
+	if quoted {
+		if escapeEntities {
+			return referenceHTMLEscape(w, s)
+		}
+		return referenceHTMLNoEntitiesEscape(w, s)
+	}
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '&':
+			if escapeEntities {
+				esc = "&amp;"
+			}
+		case '\t':
+			esc = "&#09;"
+		case '\n':
+			esc = "&#10;"
+		case '\r':
+			esc = "&#13;"
+		case '\x0C':
+			esc = "&#12;"
+		case ' ':
+			esc = "&#32;"
+		case '"':
+			esc = "&#34;"
+		case '\'':
+			esc = "&#39;"
+		case '=':
+			esc = "&#61;"
+		case '`':
+			esc = "&#96;"
+		}
+		if esc == "" {
+			continue
+		}
+		if last != i {
+			_, err := w.WriteString(s[last:i])
+			if err != nil {
+				return err
+			}
+		}
+		_, err := w.WriteString(esc)
+		if err != nil {
+			return err
+		}
+		last = i + 1
+	}
+	if last != len(s) {
+		_, err := w.WriteString(s[last:])
+		return err
+	}
+	return nil
+}
+
+// referenceJSStringEscape escapes the string s so it can be placed within a
+// JavaScript and JSON string with single or double quotes, and write it to
+// w.
+func referenceJSStringEscape(w strWriter, s string) error {
+	last := 0
+	for i, c := range s {
+		var esc string
+		switch {
+		case int(c) < len(jsStringEscapes):
+			esc = jsStringEscapes[c]
+		case c == '\u2028':
+			esc = `\u2028`
+		case c == '\u2029':
+			esc = `\u2029`
+		}
+		if esc == "" {
+			continue
+		}
+		if last != i {
+			_, err := w.WriteString(s[last:i])
+			if err != nil {
+				return err
+			}
+		}
+		_, err := w.WriteString(esc)
+		if err != nil {
+			return err
+		}
+		if c == '\u2028' || c == '\u2029' {
+			last = i + 3
+		} else {
+			last = i + 1
+		}
+	}
+	if last != len(s) {
+		_, err := w.WriteString(s[last:])
+		return err
+	}
+	return nil
+}
+
+// escaperTests are the escapers tested against their reference functions.
+var escaperTests = []struct {
+	name      string
+	escape    func(strWriter, string) error
+	reference func(strWriter, string) error
+}{
+	{"html", htmlEscape, referenceHTMLEscape},
+	{"htmlNoEntities", htmlNoEntitiesEscape, referenceHTMLNoEntitiesEscape},
+	{"quotedAttribute", func(w strWriter, s string) error { return attributeEscape(w, s, true, true) },
+		func(w strWriter, s string) error { return referenceAttributeEscape(w, s, true, true) }},
+	{"unquotedAttribute", func(w strWriter, s string) error { return attributeEscape(w, s, true, false) },
+		func(w strWriter, s string) error { return referenceAttributeEscape(w, s, true, false) }},
+	{"unquotedAttributeNoEntities", func(w strWriter, s string) error { return attributeEscape(w, s, false, false) },
+		func(w strWriter, s string) error { return referenceAttributeEscape(w, s, false, false) }},
+	{"jsString", jsStringEscape, referenceJSStringEscape},
+}
+
+// TestEscapersAgainstReference tests that the escapers produce the same
+// output of their reference functions for every string of one and two bytes,
+// for every string of three bytes with the bytes of U+2028 and U+2029, and
+// for random strings.
+func TestEscapersAgainstReference(t *testing.T) {
+	var src []string
+	for i := 0; i < 256; i++ {
+		src = append(src, string([]byte{byte(i)}))
+		for j := 0; j < 256; j++ {
+			src = append(src, string([]byte{byte(i), byte(j)}))
+		}
+	}
+	chars := []byte("a \t\n\f\r\"&'<=>`\\\x00\x80\xa8\xa9\xe2\xff")
+	for _, c1 := range chars {
+		for _, c2 := range chars {
+			for _, c3 := range chars {
+				src = append(src, string([]byte{c1, c2, c3}))
+			}
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, r.Intn(64))
+		for j := range b {
+			b[j] = chars[r.Intn(len(chars))]
+		}
+		src = append(src, string(b))
+	}
+	for _, test := range escaperTests {
+		t.Run(test.name, func(t *testing.T) {
+			var got, expected strings.Builder
+			for _, s := range src {
+				got.Reset()
+				expected.Reset()
+				_ = test.escape(&got, s)
+				_ = test.reference(&expected, s)
+				if got.String() != expected.String() {
+					t.Fatalf("source %q: expecting %q, got %q", s, expected.String(), got.String())
+				}
+			}
+		})
+	}
+}
+
+// discardWriter is a strWriter that discards what is written.
+type discardWriter struct{}
+
+func (discardWriter) Write(b []byte) (int, error)       { return len(b), nil }
+func (discardWriter) WriteString(s string) (int, error) { return len(s), nil }
+
+// escaperBenchmarkSources are the sources of the escaper benchmarks: a text
+// without bytes to escape and a text with many bytes to escape.
+var escaperBenchmarkSources = []struct {
+	name string
+	src  string
+}{
+	{"Plain", strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)},
+	{"Escaped", strings.Repeat("The <quick> brown & fox \"jumps\" over the 'lazy' dog.\n", 100)},
+}
+
+func BenchmarkEscapers(b *testing.B) {
+	for _, test := range escaperTests {
+		for _, source := range escaperBenchmarkSources {
+			b.Run(test.name+source.name, func(b *testing.B) {
+				b.SetBytes(int64(len(source.src)))
+				for i := 0; i < b.N; i++ {
+					_ = test.escape(discardWriter{}, source.src)
+				}
+			})
+			b.Run(test.name+source.name+"Reference", func(b *testing.B) {
+				b.SetBytes(int64(len(source.src)))
+				for i := 0; i < b.N; i++ {
+					_ = test.reference(discardWriter{}, source.src)
+				}
+			})
+		}
+	}
+}
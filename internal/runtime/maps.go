@@ -0,0 +1,114 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"reflect"
+)
+
+// mapIndex sets the register c to the element of the map m with key k, and
+// sets the ok flag.
+func (vm *VM) mapIndex(m, k reflect.Value, c int8) {
+	t := m.Type().Elem()
+	index := m.MapIndex(k)
+	vm.ok = index.IsValid()
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64,
+		reflect.String:
+		// The element is copied to a register, so there is no need to copy
+		// it to a new value.
+		if !vm.ok {
+			index = reflect.Zero(t)
+		}
+		vm.setFromReflectValue(c, index)
+	default:
+		elem := reflect.New(t).Elem()
+		if vm.ok {
+			elem.Set(index)
+		}
+		vm.setFromReflectValue(c, elem)
+	}
+}
+
+// mapIndexInt is like mapIndex but the key type of m has kind Int or Int64.
+// The most common map types are indexed without allocations.
+func (vm *VM) mapIndexInt(m reflect.Value, k int64, c int8) {
+	switch mm := m.Interface().(type) {
+	case map[int]int:
+		v, ok := mm[int(k)]
+		vm.setInt(c, int64(v))
+		vm.ok = ok
+	case map[int]bool:
+		v, ok := mm[int(k)]
+		vm.setBool(c, v)
+		vm.ok = ok
+	case map[int]string:
+		v, ok := mm[int(k)]
+		vm.setString(c, v)
+		vm.ok = ok
+	case map[int]interface{}:
+		v, ok := mm[int(k)]
+		vm.setGeneral(c, reflect.ValueOf(v))
+		vm.ok = ok
+	case map[int64]int64:
+		v, ok := mm[k]
+		vm.setInt(c, v)
+		vm.ok = ok
+	case map[int64]string:
+		v, ok := mm[k]
+		vm.setString(c, v)
+		vm.ok = ok
+	default:
+		key := vm.mapKey(m.Type())
+		key.SetInt(k)
+		vm.mapIndex(m, key, c)
+	}
+}
+
+// mapIndexString is like mapIndex but the key type of m has kind String.
+// The most common map types are indexed without allocations.
+func (vm *VM) mapIndexString(m reflect.Value, k string, c int8) {
+	switch mm := m.Interface().(type) {
+	case map[string]int:
+		v, ok := mm[k]
+		vm.setInt(c, int64(v))
+		vm.ok = ok
+	case map[string]bool:
+		v, ok := mm[k]
+		vm.setBool(c, v)
+		vm.ok = ok
+	case map[string]string:
+		v, ok := mm[k]
+		vm.setString(c, v)
+		vm.ok = ok
+	case map[string]interface{}:
+		v, ok := mm[k]
+		vm.setGeneral(c, reflect.ValueOf(v))
+		vm.ok = ok
+	default:
+		key := vm.mapKey(m.Type())
+		key.SetString(k)
+		vm.mapIndex(m, key, c)
+		// Do not retain the string.
+		key.SetString("")
+	}
+}
+
+// mapKey returns a key, reused by the map index instructions, for the maps
+// of type t.
+func (vm *VM) mapKey(t reflect.Type) reflect.Value {
+	key, ok := vm.mapKeys[t]
+	if !ok {
+		if vm.mapKeys == nil {
+			vm.mapKeys = map[reflect.Type]reflect.Value{}
+		}
+		key = reflect.New(t.Key()).Elem()
+		vm.mapKeys[t] = key
+	}
+	return key
+}
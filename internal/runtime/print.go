@@ -0,0 +1,138 @@
+// Copyright 2019 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// WriterPrint returns a PrintFunc that formats its argument as the print
+// builtin does and writes the result to w. It does not depend on the
+// standard error, so it can be used on platforms, as js/wasm and
+// wasip1/wasm, where it is not available or not appropriate.
+//
+// Errors returned by w are ignored. It is safe to call the returned function
+// from multiple goroutines.
+func WriterPrint(w io.Writer) PrintFunc {
+	var mu sync.Mutex
+	var buf []byte
+	return func(arg interface{}) {
+		mu.Lock()
+		buf = appendPrint(buf[:0], arg)
+		_, _ = w.Write(buf)
+		mu.Unlock()
+	}
+}
+
+// appendPrint appends arg, formatted as the print builtin does, to b and
+// returns the extended buffer.
+func appendPrint(b []byte, arg interface{}) []byte {
+	r := reflect.ValueOf(arg)
+	switch r.Kind() {
+	case reflect.Invalid, reflect.Array, reflect.Func, reflect.Struct:
+		b = append(b, hex(reflect.ValueOf(&arg).Elem().InterfaceData()[1])...)
+	case reflect.Bool:
+		b = strconv.AppendBool(b, r.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = strconv.AppendInt(b, r.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = strconv.AppendUint(b, r.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		b = appendPrintFloat(b, r.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := r.Complex()
+		b = append(b, '(')
+		b = appendPrintFloat(b, real(c))
+		b = appendPrintFloat(b, imag(c))
+		b = append(b, "i)"...)
+	case reflect.Chan, reflect.Map, reflect.UnsafePointer:
+		b = append(b, hex(r.Pointer())...)
+	case reflect.Interface, reflect.Ptr:
+		data := reflect.ValueOf(&arg).Elem().InterfaceData()
+		b = append(b, '(')
+		b = append(b, hex(data[0])...)
+		b = append(b, ',')
+		b = append(b, hex(data[1])...)
+		b = append(b, ')')
+	case reflect.Slice:
+		b = append(b, '[')
+		b = strconv.AppendInt(b, int64(r.Len()), 10)
+		b = append(b, '/')
+		b = strconv.AppendInt(b, int64(r.Cap()), 10)
+		b = append(b, ']')
+		b = append(b, hex(r.Pointer())...)
+	case reflect.String:
+		b = append(b, r.String()...)
+	}
+	return b
+}
+
+// appendPrintFloat appends v, formatted as the print builtin does, to b and
+// returns the extended buffer.
+func appendPrintFloat(b []byte, v float64) []byte {
+	switch {
+	case v != v:
+		return append(b, "NaN"...)
+	case v+v == v && v > 0:
+		return append(b, "+Inf"...)
+	case v+v == v && v < 0:
+		return append(b, "-Inf"...)
+	}
+	const n = 7 // digits printed.
+	var buf [n + 7]byte
+	buf[0] = '+'
+	e := 0 // exponent.
+	if v == 0 {
+		if 1/v < 0 {
+			buf[0] = '-'
+		}
+	} else {
+		if v < 0 {
+			v = -v
+			buf[0] = '-'
+		}
+		// Normalize.
+		for v >= 10 {
+			e++
+			v /= 10
+		}
+		for v < 1 {
+			e--
+			v *= 10
+		}
+		// Round.
+		h := 5.0
+		for i := 0; i < n; i++ {
+			h /= 10
+		}
+		v += h
+		if v >= 10 {
+			e++
+			v /= 10
+		}
+	}
+	// Format +d.dddd+edd.
+	for i := 0; i < n; i++ {
+		s := int(v)
+		buf[i+2] = byte(s + '0')
+		v -= float64(s)
+		v *= 10
+	}
+	buf[1] = buf[2]
+	buf[2] = '.'
+	buf[n+2] = 'e'
+	buf[n+3] = '+'
+	if e < 0 {
+		e = -e
+		buf[n+3] = '-'
+	}
+	buf[n+4] = byte(e/100 + '0')
+	buf[n+5] = byte(e/10)%10 + '0'
+	buf[n+6] = byte(e%10) + '0'
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+var writerPrintTests = []struct {
+	val interface{}
+	str string
+}{
+	{true, "true"},
+	{-73, "-73"},
+	{uint8(200), "200"},
+	{"a\nb", "a\nb"},
+	{myString("c"), "c"},
+	{0.0, "+0.000000e+000"},
+	{math.Copysign(0, -1), "-0.000000e+000"},
+	{1.5, "+1.500000e+000"},
+	{-1234.5678, "-1.234568e+003"},
+	{float32(0.001), "+1.000000e-003"},
+	{math.Inf(1), "+Inf"},
+	{math.Inf(-1), "-Inf"},
+	{math.NaN(), "NaN"},
+	{complex(1, -2), "(+1.000000e+000-2.000000e+000i)"},
+	{make([]int, 2, 5)[:0], "[0/5]0x"},
+}
+
+func TestWriterPrint(t *testing.T) {
+	var b bytes.Buffer
+	print := WriterPrint(&b)
+	for _, test := range writerPrintTests {
+		b.Reset()
+		print(test.val)
+		got := b.String()
+		if test.str == "[0/5]0x" {
+			if len(got) <= len(test.str) || got[:len(test.str)] != test.str {
+				t.Errorf("unexpected %q, expecting prefix %q", got, test.str)
+			}
+			continue
+		}
+		if got != test.str {
+			t.Errorf("unexpected %q, expecting %q", got, test.str)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"html"
 	"io"
+	"math"
 	"reflect"
 	"sort"
 	"strconv"
@@ -24,6 +25,30 @@ import (
 
 var byteSliceType = reflect.TypeOf([]byte(nil))
 
+// numberTypes contains, for each numeric kind that can be shown with the
+// ShowInt, ShowUint and ShowFloat methods, the corresponding predeclared type.
+var numberTypes = [...]reflect.Type{
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+}
+
+// isPredeclaredNumber reports whether t is a predeclared numeric type that
+// can be shown with the ShowInt, ShowUint and ShowFloat methods.
+func isPredeclaredNumber(t reflect.Type) bool {
+	k := t.Kind()
+	return int(k) < len(numberTypes) && numberTypes[k] == t
+}
+
 // renderer is used by te Show and Text instructions to render template files.
 type renderer struct {
 
@@ -49,6 +74,10 @@ type renderer struct {
 	// removeQuestionMark reports whether a question mark must be removed
 	// before the next written text. It can be true only if it is in a URL.
 	removeQuestionMark bool
+
+	// buf is the buffer used by ShowInt, ShowUint and ShowFloat to format
+	// numbers without allocating.
+	buf []byte
 }
 
 // newRenderer returns a new renderer.
@@ -118,13 +147,49 @@ func (r *renderer) Show(v interface{}, context Context) error {
 	return err
 }
 
+// CanShowNumber reports whether a number can be shown in the given context
+// with the ShowInt, ShowUint and ShowFloat methods.
+func (r *renderer) CanShowNumber(context Context) bool {
+	ctx, inURL, _ := decodeRenderContext(context)
+	return !inURL && !r.inURL && (ctx == ast.ContextText || ctx == ast.ContextHTML)
+}
+
+// ShowInt shows n. It can be called only if CanShowNumber returns true for
+// the context.
+func (r *renderer) ShowInt(n int64) error {
+	r.buf = strconv.AppendInt(r.buf[:0], n, 10)
+	_, err := r.out.Write(r.buf)
+	return err
+}
+
+// ShowUint shows n. It can be called only if CanShowNumber returns true for
+// the context.
+func (r *renderer) ShowUint(n uint64) error {
+	r.buf = strconv.AppendUint(r.buf[:0], n, 10)
+	_, err := r.out.Write(r.buf)
+	return err
+}
+
+// ShowFloat shows f with the given bit size. It can be called only if
+// CanShowNumber returns true for the context.
+func (r *renderer) ShowFloat(f float64, bitSize int) error {
+	r.buf = strconv.AppendFloat(r.buf[:0], f, 'f', -1, bitSize)
+	_, err := r.out.Write(r.buf)
+	return err
+}
+
 // Out returns the out writer.
 func (r *renderer) Out() io.Writer {
 	return r.out
 }
 
-// Text shows txt in the given context.
-func (r *renderer) Text(txt []byte, inURL, isSet bool) error {
+// Text shows txt, with the given format, in the given context. If a post
+// process function has been set, txt is first passed to it.
+func (r *renderer) Text(txt []byte, format ast.Format, inURL, isSet bool) error {
+
+	if postProcess := r.env.postProcess; postProcess != nil {
+		txt = postProcess(format, txt)
+	}
 
 	// Check and eventually change the URL state.
 	if r.inURL != inURL {
@@ -138,7 +203,7 @@ func (r *renderer) Text(txt []byte, inURL, isSet bool) error {
 		if isSet && bytes.ContainsRune(txt, ',') {
 			r.query = false
 		} else if r.query {
-			if r.removeQuestionMark && txt[0] == '?' {
+			if r.removeQuestionMark && len(txt) > 0 && txt[0] == '?' {
 				txt = txt[1:]
 			}
 			if r.addAmpersand && len(txt) > 0 && txt[0] != '&' {
@@ -162,7 +227,7 @@ func (r *renderer) Text(txt []byte, inURL, isSet bool) error {
 
 func (r *renderer) WithConversion(from, to ast.Format) *renderer {
 	if from == ast.FormatMarkdown && to == ast.FormatHTML {
-		out := newMarkdownWriter(r.out, r.conv)
+		out := newMarkdownWriter(r.env, r.out, r.conv)
 		return &renderer{env: r.env, out: out, conv: r.conv}
 	}
 	return &renderer{env: r.env, out: r.out, conv: r.conv}
@@ -219,6 +284,7 @@ func (r *renderer) endURL() {
 // When the Close method is called, it converts the content in the buffer,
 // using converter, from Markdown to HTML and writes it to out.
 type markdownWriter struct {
+	env     *env
 	buf     bytes.Buffer
 	convert Converter
 	out     io.Writer
@@ -226,9 +292,8 @@ type markdownWriter struct {
 
 // newMarkdownWriter returns a *markdownWriter value that writes to out the
 // Markdown code converted to HTML by converter.
-func newMarkdownWriter(out io.Writer, converter Converter) *markdownWriter {
-	var buf bytes.Buffer
-	return &markdownWriter{buf, converter, out}
+func newMarkdownWriter(env *env, out io.Writer, converter Converter) *markdownWriter {
+	return &markdownWriter{env: env, convert: converter, out: out}
 }
 
 func (w *markdownWriter) Write(p []byte) (int, error) {
@@ -239,7 +304,7 @@ func (w *markdownWriter) Close() error {
 	if w.convert == nil {
 		return errors.New("no Markdown convert available")
 	}
-	return w.convert(w.buf.Bytes(), w.out)
+	return w.env.convertMarkdown(w.convert, w.buf.Bytes(), w.out)
 }
 
 type strWriterWrapper struct {
@@ -314,6 +379,9 @@ func toString(env *env, i interface{}) (string, error) {
 		}
 		return s, nil
 	default:
+		if env.fallbackPrinter != nil {
+			return env.fallbackPrinter(i)
+		}
 		return "", fmt.Errorf("cannot show value of type %s", env.TypeOf(reflect.ValueOf(i)))
 	}
 }
@@ -326,6 +394,9 @@ func showInText(env *env, out io.Writer, value interface{}) error {
 		s = v.String()
 	case native.EnvStringer:
 		s = v.String(env)
+	case io.WriterTo:
+		_, err := v.WriteTo(out)
+		return err
 	case error:
 		s = v.Error()
 	default:
@@ -353,10 +424,16 @@ func showInHTML(env *env, out io.Writer, conv Converter, value interface{}) erro
 	case native.HTMLEnvStringer:
 		_, err := w.WriteString(string(v.HTML(env)))
 		return err
+	case native.HTMLWriterTo:
+		_, err := v.WriteHTMLTo(out)
+		return err
 	case fmt.Stringer:
 		return htmlEscape(w, v.String())
 	case native.EnvStringer:
 		return htmlEscape(w, v.String(env))
+	case io.WriterTo:
+		_, err := v.WriteTo(htmlEscapeWriter{w})
+		return err
 	case []byte:
 		_, err := out.Write(v)
 		return err
@@ -364,7 +441,7 @@ func showInHTML(env *env, out io.Writer, conv Converter, value interface{}) erro
 		return htmlEscape(w, v.Error())
 	case native.Markdown:
 		if conv != nil {
-			return conv([]byte(v), out)
+			return env.convertMarkdownValue(conv, string(v), out)
 		}
 	}
 	s, err := toString(env, value)
@@ -712,6 +789,22 @@ func showInJS(env *env, out io.Writer, value interface{}) error {
 	return err
 }
 
+// showNonFiniteInJSON shows the floating-point value f, that is NaN or
+// infinite, in JSON context.
+func showNonFiniteInJSON(env *env, w strWriter, f float64) error {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	switch env.jsonNonFinite {
+	case JSONNonFiniteString:
+		s = `"` + s + `"`
+	case JSONNonFiniteError:
+		return fmt.Errorf("cannot show %s as JSON", s)
+	default:
+		s = "null"
+	}
+	_, err := w.WriteString(s)
+	return err
+}
+
 // showInJSON shows value in JSON context.
 func showInJSON(env *env, out io.Writer, value interface{}) error {
 
@@ -757,10 +850,12 @@ func showInJSON(env *env, out io.Writer, value interface{}) error {
 		s = strconv.FormatInt(v.Int(), 10)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		s = strconv.FormatUint(v.Uint(), 10)
-	case reflect.Float32:
-		s = strconv.FormatFloat(v.Float(), 'f', -1, 32)
-	case reflect.Float64:
-		s = strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return showNonFiniteInJSON(env, w, f)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, v.Type().Bits())
 	case reflect.String:
 		_, err := w.WriteString("\"")
 		if err == nil {
@@ -0,0 +1,290 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package runtime
+
+import (
+	"reflect"
+	"strings"
+)
+
+// hiddenFieldPrefix is the prefix of the names of the struct fields that, in
+// Scriggo, are unexported or blank.
+//
+// Keep in sync with compiler.encodeFieldName.
+const hiddenFieldPrefix = "𝗽"
+
+// ValueOf is like reflect.ValueOf but if v, or a value nested in v, has a
+// Scriggo type, it is replaced with a value with a Go type. The returned
+// value can be passed to the functions that do not know the Scriggo types,
+// as json.Marshal.
+//
+// The values nested in v are not changed, instead a copy of the values that
+// contain them is returned. The unexported and blank fields of the structs
+// declared in Scriggo are removed.
+func (env *env) ValueOf(v interface{}) reflect.Value {
+	gv, _ := goValue(env.typeof, reflect.ValueOf(v), map[uintptr]bool{})
+	return gv
+}
+
+// Interface returns the value v as a value of type t. It is the inverse of
+// ValueOf: if t is a Scriggo type, v must have the type of the values
+// returned by ValueOf for the values of type t. The values with an interface
+// type nested in v are not changed.
+func (env *env) Interface(v reflect.Value, t reflect.Type) interface{} {
+	st, ok := t.(ScriggoType)
+	if !ok {
+		return fromGoValue(v, t).Interface()
+	}
+	return st.Wrap(fromGoValue(v, st.GoType())).Interface()
+}
+
+// goValue returns the Go value of the value v with a concrete type. If v, or
+// a value nested in v, has a Scriggo type, it returns a copy of v with the
+// values with a Scriggo type replaced by values with a Go type, and true.
+// Otherwise it returns v and false.
+//
+// seen contains the pointers, maps and slices already visited, so that
+// cyclic values are visited only once.
+func goValue(typeof TypeOfFunc, v reflect.Value, seen map[uintptr]bool) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	var unwrapped bool
+	if st, ok := typeof(v).(ScriggoType); ok {
+		if uv, ok := st.Unwrap(v); ok {
+			v = uv
+			unwrapped = true
+		}
+	}
+	nv, ok := goNestedValues(typeof, v, seen)
+	return nv, unwrapped || ok
+}
+
+// goNestedValues is called by goValue to replace the values nested in v,
+// and the hidden fields of the structs.
+func goNestedValues(typeof TypeOfFunc, v reflect.Value, seen map[uintptr]bool) (reflect.Value, bool) {
+	t := v.Type()
+	gt, changed := goType(t)
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		e, ok := goValue(typeof, v.Elem(), seen)
+		if !ok || !e.Type().AssignableTo(t) {
+			return v, false
+		}
+		nv := reflect.New(t).Elem()
+		nv.Set(e)
+		return nv, true
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(gt), changed
+		}
+		if seen[v.Pointer()] {
+			return v, false
+		}
+		seen[v.Pointer()] = true
+		e, ok := goNestedValues(typeof, v.Elem(), seen)
+		if !ok {
+			return v, false
+		}
+		nv := reflect.New(e.Type())
+		nv.Elem().Set(e)
+		return nv, true
+	case reflect.Array, reflect.Slice:
+		var nv reflect.Value
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return reflect.Zero(gt), changed
+			}
+			if seen[v.Pointer()] {
+				return v, false
+			}
+			seen[v.Pointer()] = true
+		}
+		elems := make([]reflect.Value, v.Len())
+		for i := range elems {
+			e, ok := goNestedValues(typeof, v.Index(i), seen)
+			elems[i] = e
+			changed = changed || ok
+		}
+		if !changed {
+			return v, false
+		}
+		if v.Kind() == reflect.Slice {
+			nv = reflect.MakeSlice(gt, len(elems), len(elems))
+		} else {
+			nv = reflect.New(gt).Elem()
+		}
+		for i, e := range elems {
+			nv.Index(i).Set(e)
+		}
+		return nv, true
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(gt), changed
+		}
+		if seen[v.Pointer()] {
+			return v, false
+		}
+		seen[v.Pointer()] = true
+		keys := make([]reflect.Value, 0, v.Len())
+		elems := make([]reflect.Value, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			k, ok1 := goNestedValues(typeof, iter.Key(), seen)
+			e, ok2 := goNestedValues(typeof, iter.Value(), seen)
+			keys = append(keys, k)
+			elems = append(elems, e)
+			changed = changed || ok1 || ok2
+		}
+		if !changed {
+			return v, false
+		}
+		nv := reflect.MakeMapWithSize(gt, len(keys))
+		for i, k := range keys {
+			nv.SetMapIndex(k, elems[i])
+		}
+		return nv, true
+	case reflect.Struct:
+		if hasUnexportedFields(t) {
+			return v, false
+		}
+		var fields []reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if strings.HasPrefix(t.Field(i).Name, hiddenFieldPrefix) {
+				continue
+			}
+			f, ok := goNestedValues(typeof, v.Field(i), seen)
+			fields = append(fields, f)
+			changed = changed || ok
+		}
+		if !changed {
+			return v, false
+		}
+		nv := reflect.New(gt).Elem()
+		for i, f := range fields {
+			nv.Field(i).Set(f)
+		}
+		return nv, true
+	}
+	return v, false
+}
+
+// goType returns the type of the values returned by goValue for the values
+// of type t, and reports whether it is different from t. The returned type
+// is different if t is, or contains, a struct type with hidden fields.
+func goType(t reflect.Type) (reflect.Type, bool) {
+	switch t.Kind() {
+	case reflect.Array:
+		if e, ok := goType(t.Elem()); ok {
+			return reflect.ArrayOf(t.Len(), e), true
+		}
+	case reflect.Map:
+		k, ok1 := goType(t.Key())
+		e, ok2 := goType(t.Elem())
+		if ok1 || ok2 {
+			return reflect.MapOf(k, e), true
+		}
+	case reflect.Ptr:
+		if e, ok := goType(t.Elem()); ok {
+			return reflect.PtrTo(e), true
+		}
+	case reflect.Slice:
+		if e, ok := goType(t.Elem()); ok {
+			return reflect.SliceOf(e), true
+		}
+	case reflect.Struct:
+		if hasUnexportedFields(t) {
+			return t, false
+		}
+		var changed bool
+		fields := make([]reflect.StructField, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if strings.HasPrefix(f.Name, hiddenFieldPrefix) {
+				changed = true
+				continue
+			}
+			var ok bool
+			f.Type, ok = goType(f.Type)
+			f.Index = nil
+			f.Offset = 0
+			fields = append(fields, f)
+			changed = changed || ok
+		}
+		if changed {
+			return reflect.StructOf(fields), true
+		}
+	}
+	return t, false
+}
+
+// hasUnexportedFields reports whether the struct type t has unexported
+// fields. Only the struct types declared in Go can have unexported fields.
+func hasUnexportedFields(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fromGoValue returns the value v, returned by goValue, as a value of type t.
+// The hidden fields of the structs have the zero value.
+func fromGoValue(v reflect.Value, t reflect.Type) reflect.Value {
+	if v.Type() == t {
+		return v
+	}
+	switch t.Kind() {
+	case reflect.Array:
+		nv := reflect.New(t).Elem()
+		for i := 0; i < t.Len(); i++ {
+			nv.Index(i).Set(fromGoValue(v.Index(i), t.Elem()))
+		}
+		return nv
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		nv := reflect.MakeMapWithSize(t, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			nv.SetMapIndex(fromGoValue(iter.Key(), t.Key()), fromGoValue(iter.Value(), t.Elem()))
+		}
+		return nv
+	case reflect.Ptr:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		nv := reflect.New(t.Elem())
+		nv.Elem().Set(fromGoValue(v.Elem(), t.Elem()))
+		return nv
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(t)
+		}
+		nv := reflect.MakeSlice(t, v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			nv.Index(i).Set(fromGoValue(v.Index(i), t.Elem()))
+		}
+		return nv
+	case reflect.Struct:
+		nv := reflect.New(t).Elem()
+		j := 0
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if strings.HasPrefix(f.Name, hiddenFieldPrefix) {
+				continue
+			}
+			nv.Field(i).Set(fromGoValue(v.Field(j), f.Type))
+			j++
+		}
+		return nv
+	}
+	return v.Convert(t)
+}
@@ -5,6 +5,7 @@
 package runtime
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/native"
@@ -30,8 +32,9 @@ var envType = reflect.TypeOf((*native.Env)(nil)).Elem()
 var emptyInterfaceType = reflect.TypeOf(&[]interface{}{nil}[0]).Elem()
 var emptyInterfaceNil = reflect.ValueOf(&[]interface{}{nil}[0]).Elem()
 
-// Converter is implemented by format converters.
-type Converter func(src []byte, out io.Writer) error
+// Converter is implemented by format converters. ctx is the context of the
+// execution.
+type Converter func(ctx context.Context, src []byte, out io.Writer) error
 
 // A TypeOfFunc function returns a type of a value.
 type TypeOfFunc func(reflect.Value) reflect.Type
@@ -59,6 +62,20 @@ type ScriggoType interface {
 
 type StackShift [4]int8
 
+// Instruction is an instruction of the virtual machine. According to the
+// operation, an operand is a register, an immediate value or a part of a
+// wider value spread over more operands. A positive register operand r is
+// the register r of the current frame, a negative one is the register
+// pointed to by the general register -r, so an instruction can address
+// only the first 127 registers of each type.
+//
+// The Wide instruction is a prefix that extends the Move instruction that
+// follows it to 16-bit register operands: the B and C operands of Wide are
+// the high bytes of the source and destination registers, and the B and C
+// operands of Move are their low bytes. The registers from 128 to 32767 are
+// the wide registers of the function, the registers of Function.NumWideReg,
+// which can be accessed only with Wide. The operands of a wide Move cannot
+// be constants or indirect registers.
 type Instruction struct {
 	Op      Operation
 	A, B, C int8
@@ -87,6 +104,7 @@ type VM struct {
 	pc       Addr                 // program counter.
 	ok       bool                 // ok flag.
 	regs     registers            // registers.
+	wide     *registers           // wide registers of the running function.
 	fn       *Function            // running function.
 	vars     []reflect.Value      // global and closure variables.
 	env      *env                 // execution environment.
@@ -96,6 +114,10 @@ type VM struct {
 	cases    []reflect.SelectCase // select cases.
 	panic    *PanicError          // panic.
 	main     bool                 // reports whether this VM is executing the main goroutine.
+
+	// mapKeys contains the keys reused by the map index instructions,
+	// indexed by map type.
+	mapKeys map[reflect.Type]reflect.Value
 }
 
 // NewVM returns a new virtual machine.
@@ -114,6 +136,7 @@ func (vm *VM) Reset() {
 	vm.st[3] = Addr(len(vm.regs.general))
 	vm.pc = 0
 	vm.ok = false
+	vm.wide = nil
 	vm.fn = nil
 	vm.vars = nil
 	vm.env = &env{}
@@ -144,13 +167,43 @@ func (vm *VM) stop() (Addr, bool) {
 // If a context has been set and the context is canceled, Run returns
 // as soon as possible with the error returned by the Err method of the
 // context.
+//
+// If the execution stops when a goroutine panics, see
+// SetStopOnGoroutinePanic, Run returns as soon as possible with the error of
+// the first goroutine that panicked.
 func (vm *VM) Run(fn *Function, typeof TypeOfFunc, globals []reflect.Value) error {
 	if typeof == nil {
 		typeof = typeOfFunc
 	}
 	vm.env.typeof = typeof
 	vm.env.globals = globals
+	if vm.env.watch != nil {
+		// Index the watched global variables by address, so that also the
+		// assignments in closures, that have their own variables, are
+		// reported.
+		vm.env.watched = make(map[uintptr]int, len(vm.env.watchGlobals))
+		for _, i := range vm.env.watchGlobals {
+			if v := globals[i]; v.CanAddr() {
+				vm.env.watched[v.UnsafeAddr()] = i
+			}
+		}
+	}
+	if vm.env.stopOnGoroutinePanic {
+		ctx := vm.env.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		vm.SetContext(ctx)
+		vm.env.cancel = cancel
+	}
 	err := vm.runFunc(fn, globals)
+	if vm.env.cancel != nil && (err == nil || err == context.Canceled) {
+		if goErr := vm.env.goroutineError(); goErr != nil {
+			err = goErr
+		}
+	}
 	if err != nil {
 		switch e := err.(type) {
 		case *PanicError:
@@ -186,6 +239,16 @@ func (vm *VM) SetContext(ctx context.Context) {
 	vm.env.doneCase = reflect.SelectCase{}
 }
 
+// SetStopOnGoroutinePanic sets whether the execution stops when a goroutine,
+// started with the go statement, panics and the panic is not recovered. If
+// stop is true, Run returns the error of the goroutine. Otherwise the error
+// of the goroutine is discarded.
+//
+// SetStopOnGoroutinePanic must not be called after vm has been started.
+func (vm *VM) SetStopOnGoroutinePanic(stop bool) {
+	vm.env.stopOnGoroutinePanic = stop
+}
+
 // SetRenderer sets template output and markdown converter.
 //
 // SetRenderer must not be called after vm has been started.
@@ -193,6 +256,131 @@ func (vm *VM) SetRenderer(out io.Writer, conv Converter) {
 	vm.renderer = newRenderer(vm.env, out, conv)
 }
 
+// SetLocale sets the locale returned by the Locale method of
+// native.LocaleEnv.
+//
+// SetLocale must not be called after vm has been started.
+func (vm *VM) SetLocale(locale string) {
+	vm.env.locale = locale
+}
+
+// SetLocation sets the location returned by the Location method of
+// native.LocationEnv.
+//
+// SetLocation must not be called after vm has been started.
+func (vm *VM) SetLocation(loc *time.Location) {
+	vm.env.loc = loc
+}
+
+// SetMaxGoroutines sets the maximum number of iterations of the parallel for
+// statements that can be executed at the same time. If n is zero, it is the
+// value returned by runtime.GOMAXPROCS(0).
+//
+// SetMaxGoroutines must not be called after vm has been started.
+func (vm *VM) SetMaxGoroutines(n int) {
+	vm.env.maxGoroutines = n
+}
+
+// SetFallbackPrinter sets the function that formats the shown values whose
+// types cannot otherwise be shown.
+//
+// SetFallbackPrinter must not be called after vm has been started.
+func (vm *VM) SetFallbackPrinter(p FallbackPrinterFunc) {
+	vm.env.fallbackPrinter = p
+}
+
+// SetDebugger sets the debugger. The debugger is called only for the
+// functions with statement debug information.
+//
+// SetDebugger must not be called after vm has been started.
+func (vm *VM) SetDebugger(d Debugger) {
+	vm.env.debugger = d
+}
+
+// SetWatchpoints sets the global variables, by index in the globals passed
+// to Run, whose assignments are reported to watch. Only the assignments
+// executed by the SetVar instruction, also in closures, are reported.
+//
+// SetWatchpoints must not be called after vm has been started.
+func (vm *VM) SetWatchpoints(globals []int, watch WatchFunc) {
+	vm.env.watch = watch
+	vm.env.watchGlobals = globals
+}
+
+// SetJSONNonFinite sets how the floating-point values NaN, +Inf and -Inf are
+// shown in JSON context. By default they are shown as null.
+//
+// SetJSONNonFinite must not be called after vm has been started.
+func (vm *VM) SetJSONNonFinite(mode JSONNonFinite) {
+	vm.env.jsonNonFinite = mode
+}
+
+// SetMarkdownLimits sets the maximum size in bytes of a Markdown block
+// converted to HTML and the maximum size in bytes of the resulting HTML.
+// Zero means no limit.
+//
+// SetMarkdownLimits must not be called after vm has been started.
+func (vm *VM) SetMarkdownLimits(maxSize, maxHTMLSize int) {
+	vm.env.maxMarkdownSize = maxSize
+	vm.env.maxMarkdownHTMLSize = maxHTMLSize
+}
+
+// SetMarkdownHTML sets the HTML of the Markdown values converted before the
+// execution, indexed by Markdown source. html is not modified.
+//
+// SetMarkdownHTML must not be called after vm has been started.
+func (vm *VM) SetMarkdownHTML(html map[string][]byte) {
+	vm.env.markdownHTML = html
+}
+
+// SetPostProcess sets the function that processes the text blocks before
+// they are rendered.
+//
+// SetPostProcess must not be called after vm has been started.
+func (vm *VM) SetPostProcess(p PostProcessFunc) {
+	vm.env.postProcess = p
+}
+
+// SetTranslate sets the function that translates the texts of the trans
+// statements.
+//
+// SetTranslate must not be called after vm has been started.
+func (vm *VM) SetTranslate(t TranslateFunc) {
+	vm.env.translate = t
+}
+
+// SetNativeCallHook sets the hook that is called in place of the native
+// functions and methods.
+//
+// SetNativeCallHook must not be called after vm has been started.
+func (vm *VM) SetNativeCallHook(h NativeCallHook) {
+	vm.env.nativeCallHook = h
+}
+
+// SetAllocator sets the allocator of the values created by the new and make
+// builtins and by the composite literals.
+//
+// SetAllocator must not be called after vm has been started.
+func (vm *VM) SetAllocator(a Allocator) {
+	vm.env.allocator = a
+}
+
+// SetOperationLimit sets the maximum number of operations of category c that
+// can be executed. If n is zero, there is no limit.
+//
+// SetOperationLimit must not be called after vm has been started.
+func (vm *VM) SetOperationLimit(c OperationCategory, n int) {
+	vm.env.opLimits[c] = int64(n)
+}
+
+// SetMemoryLimit sets the maximum number of bytes that can be allocated by
+// the instructions that allocate memory. If n is zero, there is no limit.
+//
+// SetMemoryLimit must not be called after vm has been started.
+func (vm *VM) SetMemoryLimit(n int) {
+	vm.env.memoryLimit = int64(n)
+}
+
 // SetPrint sets the "print" builtin function.
 //
 // SetPrint must not be called after vm has been started.
@@ -239,8 +427,9 @@ func (vm *VM) Stack(buf []byte, all bool) int {
 			write("???")
 		}
 		write(":")
-		if debugInfo, ok := fn.DebugInfo[ppc]; ok {
-			write(strconv.Itoa(debugInfo.Position.Line))
+		_, pos := fn.PositionOf(ppc)
+		if line := pos.Line; line > 0 {
+			write(strconv.Itoa(line))
 		} else {
 			write("???")
 		}
@@ -263,6 +452,8 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 		panic(errNilPointer)
 	}
 
+	vm.env.countOperation(NativeCalls)
+
 	// Make a copy of the frame pointer.
 	fp := vm.fp
 
@@ -273,7 +464,7 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 	vm.fp[3] += Addr(shift[3])
 
 	// Call the function without the reflect.
-	if !fn.reflectCall {
+	if !fn.reflectCall && vm.env.nativeCallHook == nil {
 		if asGoroutine {
 			switch f := fn.function.(type) {
 			case func(string) int:
@@ -409,7 +600,11 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 	if asGoroutine {
 
 		// Start a goroutine.
-		if variadic {
+		if hook := vm.env.nativeCallHook; hook != nil {
+			go hook(fn.pkg, fn.name, hookArgs(typ, args), func() []reflect.Value {
+				return fn.call(args, variadic)
+			})
+		} else if variadic {
 			go fn.value.CallSlice(args)
 		} else {
 			go fn.value.Call(args)
@@ -419,7 +614,11 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 
 		// Call the function and get the results.
 		var out []reflect.Value
-		if variadic {
+		if hook := vm.env.nativeCallHook; hook != nil {
+			out = hook(fn.pkg, fn.name, hookArgs(typ, args), func() []reflect.Value {
+				return fn.call(args, variadic)
+			})
+		} else if variadic {
 			out = fn.value.CallSlice(args)
 		} else {
 			out = fn.value.Call(args)
@@ -440,6 +639,20 @@ func (vm *VM) callNative(fn *NativeFunction, numVariadic int8, shift StackShift,
 	return
 }
 
+// hookArgs returns the arguments args of a call of a native function with
+// type typ, without the native.Env argument, to pass to a native call hook.
+func hookArgs(typ reflect.Type, args []reflect.Value) []reflect.Value {
+	for i := 0; i < 2 && i < len(args); i++ {
+		if typ.In(i) == envType {
+			if i == 0 {
+				return args[1:]
+			}
+			return append(args[:i:i], args[i+1:]...)
+		}
+	}
+	return args
+}
+
 // equals reports whether x and y are equal.
 // It panics if x and y are not comparable.
 //
@@ -486,12 +699,149 @@ func (vm *VM) fieldByIndex(s reflect.Value, i uint8) reflect.Value {
 	return v
 }
 
+// fieldByName returns the field, or the map element, with the given name of
+// the value v, for a nil-safe selector with an interface operand. If v, or
+// a pointer traversed to reach the field, is nil, it returns the zero Value.
+// If v has no such field and it is not a map with string keys, it panics.
+func (vm *VM) fieldByName(v reflect.Value, name string) reflect.Value {
+	if !v.IsValid() {
+		return v
+	}
+	t := vm.env.typeof(v)
+	if st, ok := t.(ScriggoType); ok {
+		v, _ = st.Unwrap(v)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if field, ok := v.Type().FieldByName(name); ok && field.PkgPath == "" {
+			for i, x := range field.Index {
+				if i > 0 && v.Kind() == reflect.Ptr {
+					if v.IsNil() {
+						return reflect.Value{}
+					}
+					v = v.Elem()
+				}
+				v = v.Field(x)
+			}
+			return v
+		}
+	case reflect.Map:
+		if typ := v.Type(); typ.Key().Kind() == reflect.String {
+			k := reflect.New(typ.Key()).Elem()
+			k.SetString(name)
+			if e := v.MapIndex(k); e.IsValid() {
+				return e
+			}
+			return reflect.Zero(typ.Elem())
+		}
+	}
+	panic(runtimeError("runtime error: " + t.String() + " has no field " + name))
+}
+
 func (vm *VM) finalize(regs [][2]int8) {
 	for _, reg := range regs {
 		vm.setFromReflectValue(reg[1], vm.generalIndirect(reg[0]))
 	}
 }
 
+// getVar stores in the register c the value of the variable with index
+// encoded in a and b, copying it if it is not of a basic, function or
+// interface kind.
+func (vm *VM) getVar(a, b, c int8) {
+	v := vm.vars[decodeInt16(a, b)]
+	k := v.Kind()
+	switch {
+	case reflect.Bool <= k && k <= reflect.Float64:
+	case k == reflect.String:
+	case k == reflect.Func:
+	case k == reflect.Interface:
+	default:
+		v2 := reflect.New(v.Type()).Elem()
+		v2.Set(v)
+		v = v2
+	}
+	vm.setFromReflectValue(c, v)
+}
+
+// wideMove moves the value of the register src into the register dst, both
+// of type t, as the Move instruction does. A register greater than 127 is a
+// wide register. The wide registers of the running function are allocated
+// on its first wide move.
+func (vm *VM) wideMove(t registerType, src, dst int16) {
+	w := vm.wide
+	if w == nil {
+		n := vm.fn.NumWideReg
+		w = &registers{
+			int:     make([]int64, n[0]),
+			float:   make([]float64, n[1]),
+			string:  make([]string, n[2]),
+			general: make([]reflect.Value, n[3]),
+		}
+		vm.wide = w
+	}
+	switch t {
+	case intRegister:
+		var v int64
+		if src > 127 {
+			v = w.int[src-128]
+		} else {
+			v = vm.int(int8(src))
+		}
+		if dst > 127 {
+			w.int[dst-128] = v
+		} else {
+			vm.setInt(int8(dst), v)
+		}
+	case floatRegister:
+		var v float64
+		if src > 127 {
+			v = w.float[src-128]
+		} else {
+			v = vm.float(int8(src))
+		}
+		if dst > 127 {
+			w.float[dst-128] = v
+		} else {
+			vm.setFloat(int8(dst), v)
+		}
+	case stringRegister:
+		var v string
+		if src > 127 {
+			v = w.string[src-128]
+		} else {
+			v = vm.string(int8(src))
+		}
+		if dst > 127 {
+			w.string[dst-128] = v
+		} else {
+			vm.setString(int8(dst), v)
+		}
+	case generalRegister:
+		var rv reflect.Value
+		if src > 127 {
+			rv = w.general[src-128]
+		} else {
+			rv = vm.general(int8(src))
+		}
+		if k := rv.Kind(); k == reflect.Array || k == reflect.Struct {
+			newRv := reflect.New(rv.Type()).Elem()
+			newRv.Set(reflect.ValueOf(rv.Interface()))
+			rv = newRv
+		}
+		if dst > 127 {
+			w.general[dst-128] = rv
+		} else {
+			vm.setGeneral(int8(dst), rv)
+		}
+	}
+}
+
 func (vm *VM) moreIntStack() {
 	top := len(vm.regs.int) * 2
 	stack := make([]int64, top)
@@ -592,6 +942,7 @@ func (vm *VM) nextCall() bool {
 			if call.cl.fn != nil {
 				vm.calls = vm.calls[:i]
 				vm.fp = call.fp
+				vm.wide = call.wide
 				vm.pc = call.pc
 				vm.fn = call.cl.fn
 				vm.vars = call.cl.vars
@@ -653,11 +1004,71 @@ func (vm *VM) startGoroutine() bool {
 	copy(nvm.regs.float, vm.regs.float[vm.fp[1]+Addr(off.A):vm.fp[1]+127])
 	copy(nvm.regs.string, vm.regs.string[vm.fp[2]+Addr(off.B):vm.fp[2]+127])
 	copy(nvm.regs.general, vm.regs.general[vm.fp[3]+Addr(off.C):vm.fp[3]+127])
-	go nvm.runFunc(fn, vars)
+	go func() {
+		if err := nvm.runFunc(fn, vars); err != nil {
+			nvm.env.goroutineFailed(err)
+		}
+	}()
 	vm.pc++
 	return false
 }
 
+// parallel calls the function f for each element of s, that is a slice, an
+// array or a pointer to an array, executing the calls in parallel. Each call
+// renders to its own buffer and, when all the calls have returned, the
+// buffers are written in order. It reports whether s has at least one element
+// and returns the error of the first call, in order, that failed.
+func (vm *VM) parallel(f *callable, s reflect.Value) (bool, error) {
+	if s.Kind() == reflect.Ptr {
+		if s.IsNil() {
+			panic(errNilPointer)
+		}
+		s = s.Elem()
+	}
+	n := s.Len()
+	if n == 0 {
+		return false, nil
+	}
+	buffers := make([]bytes.Buffer, n)
+	errs := make([]error, n)
+	call := func(i int) {
+		nvm := create(vm.env)
+		nvm.renderer = vm.renderer.WithOut(&buffers[i])
+		nvm.setFromReflectValue(1, s.Index(i))
+		errs[i] = nvm.runFunc(f.fn, f.vars)
+	}
+	sem := vm.env.parallelSemaphore()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				call(i)
+				<-sem
+				wg.Done()
+			}(i)
+		default:
+			// Execute the call in the current goroutine.
+			call(i)
+		}
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return true, err
+		}
+	}
+	out := vm.renderer.Out()
+	for i := range buffers {
+		_, err := out.Write(buffers[i].Bytes())
+		if err != nil {
+			panic(outError{err})
+		}
+	}
+	return true, nil
+}
+
 // swapStack swaps the stacks pointed by a and b. bSize is the size of the
 // stack pointed by b. The stacks must be consecutive and a must precede b.
 //
@@ -778,22 +1189,33 @@ func NewNativeFunction(pkg, name string, function interface{}) *NativeFunction {
 	case func(string, string) bool:
 	default:
 		fn.reflectCall = true
-		if numIn := typ.NumIn(); numIn > 0 {
-			fn.argsPool = &sync.Pool{
-				New: func() interface{} {
-					args := make([]reflect.Value, numIn)
-					for i := 0; i < numIn; i++ {
-						t := typ.In(i)
-						args[i] = reflect.New(t).Elem()
-					}
-					return args
-				},
-			}
+	}
+	// The pool is also used by the functions that can be called without
+	// reflect, when they are called through a native call hook.
+	if numIn := typ.NumIn(); numIn > 0 {
+		fn.argsPool = &sync.Pool{
+			New: func() interface{} {
+				args := make([]reflect.Value, numIn)
+				for i := 0; i < numIn; i++ {
+					t := typ.In(i)
+					args[i] = reflect.New(t).Elem()
+				}
+				return args
+			},
 		}
 	}
 	return fn
 }
 
+// call calls fn with reflect with the arguments args and returns the
+// results. variadic reports whether fn is variadic.
+func (fn *NativeFunction) call(args []reflect.Value, variadic bool) []reflect.Value {
+	if variadic {
+		return fn.value.CallSlice(args)
+	}
+	return fn.value.Call(args)
+}
+
 func (fn *NativeFunction) Package() string {
 	return fn.pkg
 }
@@ -817,6 +1239,7 @@ type Function struct {
 	VarRefs         []int16
 	Types           []reflect.Type
 	NumReg          [4]int8
+	NumWideReg      [4]int16  // number of wide registers.
 	FinalRegs       [][2]int8 // [indirect -> return parameter registers]
 	Macro           bool
 	Format          ast.Format
@@ -827,6 +1250,30 @@ type Function struct {
 	Body            []Instruction
 	Text            [][]byte
 	DebugInfo       map[Addr]DebugInfo
+	StmtDebugInfo   map[Addr]DebugInfo // debug info of the first instruction of the statements.
+	Positions       []PositionEntry    // position table, sorted by address.
+}
+
+// PositionOf returns the path and the position in the source of the
+// instruction at address pc, as recorded in the position table of fn. If
+// the position table has no entry for pc, it returns the path of the file of
+// fn and a zero position.
+func (fn *Function) PositionOf(pc Addr) (string, Position) {
+	positions := fn.Positions
+	i, j := 0, len(positions)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if positions[h].Addr <= pc {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	if i == 0 {
+		return fn.File, Position{}
+	}
+	entry := positions[i-1]
+	return entry.Path, entry.Position
 }
 
 // Position represents a source position.
@@ -841,6 +1288,15 @@ func (p Position) String() string {
 	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
 }
 
+// PositionEntry is an entry of the position table of a function. The
+// instructions from address Addr up to the address of the next entry are
+// located at Position in the source with path Path.
+type PositionEntry struct {
+	Addr     Addr
+	Path     string
+	Position Position
+}
+
 // DebugInfo represents a set of debug information associated to a given
 // instruction. None of the fields below is mandatory.
 type DebugInfo struct {
@@ -868,6 +1324,7 @@ type callFrame struct {
 	cl          callable   // callable.
 	renderer    *renderer  // renderer
 	fp          [4]Addr    // frame pointers.
+	wide        *registers // wide registers.
 	pc          Addr       // program counter.
 	status      callStatus // status.
 	numVariadic int8       // number of variadic arguments.
@@ -939,6 +1396,12 @@ func (c *callable) Value(renderer *renderer, env *env) reflect.Value {
 				}
 				err = &fatalError{msg: msg}
 			}
+			switch err.(type) {
+			case *fatalError, *InternalError, stopError:
+			default:
+				// The context has been canceled.
+				err = stopError{err}
+			}
 			panic(err)
 		}
 		if fn.Macro {
@@ -1045,6 +1508,7 @@ const (
 	OpAdd
 	OpAddInt
 	OpAddFloat64
+	OpAddComplex
 
 	OpAddr
 
@@ -1093,13 +1557,18 @@ const (
 	OpDiv
 	OpDivInt
 	OpDivFloat64
+	OpDivComplex
 
 	OpField
 
+	OpFieldByName
+
 	OpGetVar
 
 	OpGetVarAddr
 
+	OpGetVarCallIndirect
+
 	OpGo
 
 	OpGoto
@@ -1111,13 +1580,19 @@ const (
 
 	OpIndex
 	OpIndexString
+	OpIndexStringIfInt
 
 	OpIndexRef
 
+	OpLeadingZeros
+
 	OpLen
 
 	OpLoad
 
+	OpLoadBigEndian
+	OpLoadLittleEndian
+
 	OpLoadFunc
 
 	OpMakeArray
@@ -1131,23 +1606,32 @@ const (
 	OpMakeStruct
 
 	OpMapIndex
+	OpMapIndexInt
+	OpMapIndexString
 
 	OpMethodValue
 
 	OpMove
+	OpMoveAddInt
 
 	OpMul
 	OpMulInt
 	OpMulFloat64
+	OpMulComplex
 
 	OpNeg
+	OpNegComplex
 
 	OpNew
 
+	OpOnesCount
+
 	OpOr
 
 	OpPanic
 
+	OpParallel
+
 	OpPrint
 
 	OpRange
@@ -1163,8 +1647,12 @@ const (
 	OpRem
 	OpRemInt
 
+	OpRepeat
+
 	OpReturn
 
+	OpRotateLeft
+
 	OpSelect
 
 	OpSend
@@ -1187,11 +1675,15 @@ const (
 
 	OpSlice
 
+	OpStoreBigEndian
+	OpStoreLittleEndian
+
 	OpStringSlice
 
 	OpSub
 	OpSubInt
 	OpSubFloat64
+	OpSubComplex
 
 	OpSubInv
 	OpSubInvInt
@@ -1201,8 +1693,12 @@ const (
 
 	OpText
 
+	OpTrans
+
 	OpTypify
 
+	OpWide
+
 	OpXor
 
 	OpZero
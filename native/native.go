@@ -9,9 +9,17 @@ package native
 
 import (
 	"context"
+	"io"
 	"reflect"
+	"time"
 )
 
+// The format types are the types of the content that is shown without being
+// escaped in the corresponding context. In templates, the values of these
+// types can be indexed, ranged over and passed to len as strings. Slicing a
+// value of a format type gives a value of type string, and not of the same
+// format type, because a part of a trusted content is not trusted, so it is
+// escaped when shown.
 type (
 
 	// HTML is the html type in templates.
@@ -65,6 +73,73 @@ type Env interface {
 	TypeOf(v reflect.Value) reflect.Type
 }
 
+// LocaleEnv is implemented by the Env values that provide the locale of the
+// execution. The Env values passed by Scriggo to the native functions and
+// methods implement LocaleEnv.
+//
+// It is an interface distinct from Env so that the existing implementations
+// of Env do not have to implement the Locale method.
+type LocaleEnv interface {
+	Env
+
+	// Locale returns the locale of the execution, as a BCP 47 language tag.
+	// It is the locale passed as an option for execution, or the empty
+	// string if no locale has been passed.
+	Locale() string
+}
+
+// LocationEnv is implemented by the Env values that provide the default time
+// zone of the execution. The Env values passed by Scriggo to the native
+// functions and methods implement LocationEnv.
+//
+// As for LocaleEnv, it is distinct from Env so that the existing
+// implementations of Env do not have to implement the Location method.
+type LocationEnv interface {
+	Env
+
+	// Location returns the default time zone of the execution. It is the
+	// location passed as an option for execution, or nil if no location has
+	// been passed.
+	Location() *time.Location
+}
+
+// ValueEnv is implemented by the Env values that convert the values with a
+// Scriggo type to values with a Go type, and back. The Env values passed by
+// Scriggo to the native functions and methods implement ValueEnv.
+//
+// For example, a native function can marshal a value of any type with:
+//
+//  data, err := json.Marshal(env.(native.ValueEnv).ValueOf(v).Interface())
+//
+type ValueEnv interface {
+	Env
+
+	// Interface returns v as a value of type t, that can be a Scriggo type.
+	// It is the inverse of ValueOf: if t is a Scriggo type, v must have the
+	// type of the value returned by ValueOf for a value of type t.
+	Interface(v reflect.Value, t reflect.Type) interface{}
+
+	// ValueOf is like reflect.ValueOf but if v, or a value nested in v, has a
+	// Scriggo type, it is replaced with a value of the corresponding Go type.
+	// The returned value can be passed to the functions that do not know the
+	// Scriggo types, as json.Marshal. The unexported fields of the structs
+	// declared in Scriggo are removed.
+	//
+	// The values nested in v are not changed, instead a copy of the values
+	// that contain them is returned. So, if v is a pointer to a value with
+	// unexported fields, the returned value points to a copy.
+	ValueOf(v interface{}) reflect.Value
+}
+
+// Number is an interface type that can hold only values of integer and
+// floating-point types. When used as the type of a parameter of a native
+// function, the compilation fails if the argument does not have an integer
+// or floating-point type and it is not an untyped numeric constant.
+//
+// Number is checked only at compile time, so a native function called from
+// Go code must still check the type of the value.
+type Number interface{}
+
 type (
 
 	// EnvStringer is like fmt.Stringer where the String method takes an native.Env
@@ -84,6 +159,16 @@ type (
 		HTML(Env) HTML
 	}
 
+	// HTMLWriterTo is like HTMLStringer but the WriteHTMLTo method writes the
+	// HTML code to w instead of returning it. The code is not escaped.
+	//
+	// The values that implement io.WriterTo, and not fmt.Stringer or
+	// EnvStringer, are written with the WriteTo method in text context and,
+	// escaped, in HTML context.
+	HTMLWriterTo interface {
+		WriteHTMLTo(w io.Writer) (int64, error)
+	}
+
 	// CSSStringer is implemented by values that are not escaped in CSS context.
 	CSSStringer interface {
 		CSS() CSS
@@ -132,11 +217,35 @@ type (
 	}
 )
 
+// ConstantChecker is implemented by types whose constant values are checked
+// at compile time. When an untyped constant is converted to a type that
+// implements ConstantChecker, for example when it is passed as argument to a
+// native function, the CheckConstant method is called on the converted value
+// and, if it returns an error, the compilation fails with this error.
+type ConstantChecker interface {
+	CheckConstant() error
+}
+
+// FormatChecker is implemented by string types whose constant values are
+// formats checked at compile time with the arguments they format. When a
+// variadic function is called with a constant argument for the parameter
+// that precedes the variadic parameter, and the type of this parameter
+// implements FormatChecker, the CheckFormat method is called on the
+// converted value with the types of the variadic arguments. If it returns an
+// error, the compilation fails with this error.
+//
+// The type of an argument is an interface type if its dynamic type is not
+// known at compile time.
+type FormatChecker interface {
+	CheckFormat(args []reflect.Type) error
+}
+
 // Declaration represents a declaration.
 //
 //  for a variable: a pointer to the value of the variable
 //  for a function: the function
 //  for a type: its reflect.Type value
+//  for an enumeration type: an Enum value returned by EnumOf
 //  for a typed constant: its value as a string, boolean or numeric value
 //  for an untyped constant: an UntypedStringConst, UntypedBooleanConst or UntypedNumericConst value
 //  for a package: an ImportablePackage value (used only for template globals)
@@ -144,8 +253,14 @@ type (
 type Declaration interface{}
 
 // Declarations represents a set of variables, constants, functions, types and
-// packages declarations and can be used for template globals and package
-// declarations.
+// packages declarations and can be used for template globals, script globals
+// and package declarations.
+//
+// The same Declarations value can be shared by programs, scripts and
+// templates: it can be passed as the Globals option of scripts and templates
+// and, as the declarations of a Package, imported by programs, scripts and
+// templates. Declarations are validated when the code that uses them is
+// built.
 //
 // The key is the declaration's name and the element is its value.
 type Declarations map[string]Declaration
@@ -160,3 +275,53 @@ type (
 	// UntypedNumericConst represents an untyped numeric constant.
 	UntypedNumericConst string
 )
+
+// Enum represents the declaration of an enumeration type, an integer type
+// whose values have names. Declaring an Enum value with a name declares the
+// type with that name and, for each value, a typed constant with the name of
+// the value.
+//
+// In templates, a value of an enumeration type declared as a global is shown
+// as its name, unless the type implements one of the shown interfaces, as
+// fmt.Stringer. A value without a name is shown as the type name followed by
+// the number in parentheses, for example "Status(5)".
+type Enum struct {
+	typ   reflect.Type
+	names []string
+}
+
+// EnumOf returns the declaration of the enumeration type typ, where the value
+// i has name names[i], as for the constants declared with iota. typ must be
+// an integer type and the names must be distinct and not empty.
+func EnumOf(typ reflect.Type, names []string) Enum {
+	if typ == nil {
+		panic("native: nil enum type")
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+	default:
+		panic("native: enum type " + typ.String() + " is not an integer type")
+	}
+	has := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" {
+			panic("native: empty enum name")
+		}
+		if has[name] {
+			panic("native: duplicate enum name " + name)
+		}
+		has[name] = true
+	}
+	return Enum{typ: typ, names: append([]string(nil), names...)}
+}
+
+// Type returns the enumeration type.
+func (e Enum) Type() reflect.Type {
+	return e.typ
+}
+
+// Names returns the names of the values.
+func (e Enum) Names() []string {
+	return append([]string(nil), e.names...)
+}
@@ -5,6 +5,7 @@
 package native
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,59 @@ func TestCombinedPackage(t *testing.T) {
 		t.Fatalf("unexpected name %s", name)
 	}
 }
+
+func TestCheckABIVersion(t *testing.T) {
+	current := VersionedPackage{Package: Package{Name: "current"}, ABI: ABIVersion}
+	old := VersionedPackage{Package: Package{Name: "old"}, ABI: ABIVersion - 1}
+	tests := []struct {
+		pkg ImportablePackage
+		err bool
+	}{
+		{Package{Name: "p"}, false},
+		{current, false},
+		{old, true},
+		{CombinedPackage{Package{Name: "p"}, current}, false},
+		{CombinedPackage{current, old}, true},
+	}
+	for _, test := range tests {
+		err := CheckABIVersion(test.pkg)
+		if test.err && err == nil {
+			t.Fatalf("package %s: expected error, got no error", test.pkg.PackageName())
+		}
+		if !test.err && err != nil {
+			t.Fatalf("package %s: unexpected error %q", test.pkg.PackageName(), err)
+		}
+	}
+}
+
+func TestEnumOf(t *testing.T) {
+	names := []string{"A", "B"}
+	enum := EnumOf(reflect.TypeOf(uint8(0)), names)
+	names[0] = "C"
+	if enum.Type() != reflect.TypeOf(uint8(0)) {
+		t.Fatalf("unexpected type %s", enum.Type())
+	}
+	if got := enum.Names(); len(got) != 2 || got[0] != "A" || got[1] != "B" {
+		t.Fatalf("unexpected names %v", got)
+	}
+	tests := []struct {
+		typ   reflect.Type
+		names []string
+		err   string
+	}{
+		{nil, nil, "native: nil enum type"},
+		{reflect.TypeOf(""), nil, "native: enum type string is not an integer type"},
+		{reflect.TypeOf(0), []string{"A", ""}, "native: empty enum name"},
+		{reflect.TypeOf(0), []string{"A", "B", "A"}, "native: duplicate enum name A"},
+	}
+	for _, test := range tests {
+		func() {
+			defer func() {
+				if err := recover(); err != test.err {
+					t.Fatalf("expecting panic %q, got %v", test.err, err)
+				}
+			}()
+			EnumOf(test.typ, test.names)
+		}()
+	}
+}
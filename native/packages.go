@@ -4,7 +4,16 @@
 
 package native
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
+
+// ABIVersion is the version of the ABI between the packages generated by the
+// scriggo import command and the Scriggo runtime. It is incremented every
+// time a change to the runtime makes the previously generated packages
+// incompatible.
+const ABIVersion = 1
 
 // StopLookup is used as return value from a LookupFunc function to indicate
 // that the lookup should be stopped.
@@ -101,6 +110,42 @@ func (p Package) LookupFunc(f LookupFunc) error {
 	return err
 }
 
+// VersionedPackage implements ImportablePackage as Package but it also
+// reports the ABI version for which it has been generated. The scriggo import
+// command generates packages of this type.
+type VersionedPackage struct {
+	Package
+	// ABI is the ABI version for which the package has been generated.
+	ABI int
+}
+
+// ABIVersion returns the ABI version for which the package has been
+// generated.
+func (p VersionedPackage) ABIVersion() int {
+	return p.ABI
+}
+
+// CheckABIVersion checks that pkg has been generated for the current ABI
+// version. If pkg, or a package combined into pkg, has been generated for
+// another ABI version, it returns an error. Packages that do not report an
+// ABI version are always compatible.
+func CheckABIVersion(pkg ImportablePackage) error {
+	switch p := pkg.(type) {
+	case CombinedPackage:
+		for _, pkg := range p {
+			if err := CheckABIVersion(pkg); err != nil {
+				return err
+			}
+		}
+	case interface{ ABIVersion() int }:
+		if v := p.ABIVersion(); v != ABIVersion {
+			return fmt.Errorf("package %s has been generated for ABI version %d, but the runtime has ABI version %d;"+
+				" regenerate it with the scriggo import command", pkg.PackageName(), v, ABIVersion)
+		}
+	}
+	return nil
+}
+
 // CombinedPackage implements an ImportablePackage by combining multiple
 // packages into one package with name the name of the first package and as
 // declarations the declarations of all packages.
@@ -7,11 +7,14 @@ package scriggo
 import (
 	"context"
 	"errors"
+	"io"
 	"io/fs"
 	"reflect"
+	"time"
 
 	"github.com/open2b/scriggo/ast"
 	"github.com/open2b/scriggo/internal/compiler"
+	"github.com/open2b/scriggo/internal/compiler/types"
 	"github.com/open2b/scriggo/internal/runtime"
 	"github.com/open2b/scriggo/native"
 )
@@ -19,15 +22,50 @@ import (
 // BuildOptions contains options for building programs and templates.
 type BuildOptions struct {
 
-	// AllowGoStmt, when true, allows the use of the go statement.
+	// AllowGoStmt, when true, allows the use of the go statement and, in
+	// templates, of the "for parallel" statement.
 	AllowGoStmt bool
 
+	// DisabledBuiltins are the names of the builtins, as "print" and
+	// "println", that cannot be used. If a disabled builtin is used, the
+	// build fails with the error "use of disabled builtin" followed by the
+	// name of the builtin. A declaration with the same name as a disabled
+	// builtin can be used.
+	DisabledBuiltins []string
+
 	// Packages is a package importer that makes native packages available
 	// in programs and templates through the import statement.
 	Packages native.Importer
 
+	// IntSize is the size in bits of the int, uint and uintptr values on the
+	// target, used in constant evaluation and arithmetic. It can be 0, 32 or
+	// 64. If it is 0, the size on the host is used. Set it to 32 to execute
+	// the code, on a 64-bit host, as it would be executed on a 32-bit host.
+	IntSize int
+
+	// MaxConstantStringSize is the maximum size in bytes of a constant
+	// string. If a constant expression concatenates strings exceeding this
+	// size, the build fails with the error "constant string too large". If
+	// it is zero, there is no limit.
+	MaxConstantStringSize int
+
+	// TypesRegistry, if not nil, is the registry of the types declared in
+	// the code. Builds with the same registry produce the same types for the
+	// same type declarations, so values of these types can be passed from
+	// a program or template to another.
+	TypesRegistry *TypesRegistry
+
+	// Metrics, if not nil, is filled with the metrics of the build, also if
+	// the build fails.
+	Metrics *BuildMetrics
+
+	// Debug, when true, records the position of the statements, so that the
+	// execution can be debugged with the Debugger run option.
+	Debug bool
+
 	// TreeTransformer is a function that transforms a tree. If it is not nil,
-	// it is called before the type checking.
+	// it is called before the type checking. The Apply function of the
+	// ast/astutil package can be used to rewrite the tree.
 	//
 	// Used for templates only.
 	TreeTransformer func(tree *ast.Tree) error
@@ -42,12 +80,59 @@ type BuildOptions struct {
 	// Used for templates only.
 	MarkdownConverter Converter
 
+	// MarkdownContextConverter is like MarkdownConverter but, when a
+	// template is run, it is called with the context of the execution, so
+	// it can stop a conversion when the context is canceled. At build time
+	// it is called with a background context. If it is not nil,
+	// MarkdownConverter is ignored.
+	//
+	// Used for templates only.
+	MarkdownContextConverter ContextConverter
+
+	// PreconvertMarkdownGlobals, when true, converts to HTML, at build time,
+	// the values of the global variables with type markdown, so they are
+	// not converted when they are shown in HTML. The values of the global
+	// variables passed to Run, and the values changed after the build, are
+	// converted at run time, once in each execution, as the other Markdown
+	// values.
+	//
+	// Used for templates only.
+	PreconvertMarkdownGlobals bool
+
+	// Sanitizers are the functions that can be used to convert a value from
+	// a format type to a different format type. A sanitizer is a function
+	// with a parameter and a result, for example func(native.JS) native.HTML,
+	// and it is called when a value with the parameter type is explicitly
+	// converted to the result type, as in html(v).
+	//
+	// The parameter type can also be string, while the conversion from
+	// markdown to html always uses MarkdownConverter. Without a sanitizer,
+	// the conversion of a value of type string or of a format type to a
+	// different format type is a compilation error, so html(s) does not
+	// compile if s is a string variable and there is no sanitizer from
+	// string to html. Only untyped constants can always be converted.
+	//
+	// Used for templates only.
+	Sanitizers []interface{}
+
 	// Globals declares constants, types, variables, functions and packages
 	// that are accessible from the code in the template.
 	//
 	// Used for templates only.
 	Globals native.Declarations
 
+	// AllowedGlobals, if not nil, restricts the globals that can be used in
+	// the template to those whose names match at least one of the patterns,
+	// with the syntax of path.Match, as in "html*". A declaration of a global
+	// package is matched as package.Name, so "strings.*" allows all the
+	// declarations of the global package strings.
+	//
+	// If a disallowed global is used, BuildTemplate returns an error that
+	// lists all the references to disallowed globals with their positions.
+	//
+	// Used for templates only.
+	AllowedGlobals []string
+
 	// DollarIdentifier, when true, keeps the backward compatibility by
 	// supporting the dollar identifier.
 	//
@@ -56,12 +141,177 @@ type BuildOptions struct {
 	//
 	// Used for templates only.
 	DollarIdentifier bool
+
+	// ExecuteMarkdownCodeFences, when true, keeps the backward
+	// compatibility by parsing and executing the statements in the fenced
+	// code blocks, delimited by ``` or ~~~, of the Markdown files. By default
+	// the content of a fenced code block is text, so the code examples in a
+	// Markdown file are not executed.
+	//
+	// Used for templates only.
+	ExecuteMarkdownCodeFences bool
+
+	// KeepTree, when true, keeps the tree of the template, with the trees of
+	// the extended, imported and rendered files, so that it can be read with
+	// the Tree method of Template after the build. The tree is the one
+	// returned by the parser and the TreeTransformer function, if any.
+	//
+	// Used for templates only.
+	KeepTree bool
+
+	// CheckUnusedMacros, when true, reports a build error if a macro
+	// declared in an imported file, or in a file that extends another file,
+	// is not used in any file of the template.
+	//
+	// Used for templates only.
+	CheckUnusedMacros bool
+
+	// Concurrency is the maximum number of imported template files that are
+	// type checked concurrently. A file is checked when the files it imports
+	// have been checked. If it is zero or one, the files are checked
+	// sequentially. The result of the build does not depend on Concurrency.
+	//
+	// If Concurrency is greater than one, Packages and the native values in
+	// Globals must be safe for concurrent use.
+	//
+	// Used for templates only.
+	Concurrency int
+
+	// MaxExpressionDepth is the maximum depth of the nested expressions,
+	// counting parentheses, composite literals, calls and unary operators.
+	// If it is zero, there is no limit.
+	//
+	// Used for templates only.
+	MaxExpressionDepth int
+
+	// MaxNestingDepth is the maximum depth of the nested statements, as if,
+	// for, switch and macro statements. If it is zero, there is no limit.
+	//
+	// Used for templates only.
+	MaxNestingDepth int
+
+	// MaxFileSize is the maximum size in bytes of a template file, including
+	// the extended, imported and rendered files. If it is zero, there is no
+	// limit.
+	//
+	// Used for templates only.
+	MaxFileSize int
+
+	// OrDefault, when true, changes the or operator when its left operand is
+	// a non-constant value that is not a boolean and the right operand is
+	// assignable to the type of the left operand. In this case, the result
+	// has the type of the left operand and it is the left operand if it is
+	// not the zero value, otherwise the right operand, so {{ title or
+	// "Untitled" }} shows "Untitled" if title is the empty string. In the
+	// other cases, or is the boolean operator.
+	//
+	// Used for templates only.
+	OrDefault bool
+
+	// StrictShows, when true, reports a build error if a value shown with a
+	// show statement has the empty interface type, instead of checking the
+	// dynamic type of the value at run time. The value must then be converted
+	// or formatted explicitly.
+	//
+	// Used for templates only.
+	StrictShows bool
+
+	// Prologue and Epilogue contain, by format, the text written to the
+	// output before and after the code rendered by a template with that
+	// format, for example an XML declaration or a trailing newline. The
+	// text is written as is, without being escaped, and the epilogue is
+	// written only if the execution ends without errors.
+	//
+	// Used for templates only.
+	Prologue map[Format]string
+	Epilogue map[Format]string
+
+	// Warn, if not nil, is called with the path, the position and the
+	// message of each warning reported by the type checker. A warning does
+	// not stop the build. A warning is reported, for example, for a
+	// floating-point value shown in JSON context, that can be NaN or
+	// infinite. See also the JSONNonFinite run option.
+	//
+	// If Concurrency is greater than one, Warn can be called concurrently.
+	//
+	// Used for templates only.
+	Warn func(path string, pos Position, msg string)
+}
+
+// TypesRegistry is a registry of the types declared in programs and
+// templates. Without a registry, every build creates new types, also for the
+// same type declarations. A registry can be shared by concurrent builds.
+type TypesRegistry struct {
+	types *types.Types
+}
+
+// NewTypesRegistry returns a new types registry.
+func NewTypesRegistry() *TypesRegistry {
+	return &TypesRegistry{types: types.NewTypes()}
+}
+
+// BuildMetrics contains the metrics of a build of a program or template.
+type BuildMetrics struct {
+
+	// ParseTime is the time spent parsing the source files and transforming
+	// the tree with the TreeTransformer function.
+	ParseTime time.Duration
+
+	// CheckTime is the time spent type checking the tree.
+	CheckTime time.Duration
+
+	// EmitTime is the time spent emitting the code.
+	EmitTime time.Duration
+
+	// Nodes is the number of nodes of the parsed tree, including the nodes of
+	// the extended, imported and rendered files.
+	Nodes int
+
+	// Functions contains the metrics of the emitted functions, including the
+	// function literals and, for templates, the macros. The first one is the
+	// main function.
+	Functions []FunctionMetrics
+}
+
+// FunctionMetrics contains the metrics of an emitted function.
+type FunctionMetrics struct {
+	Package string // package path or, for templates, "main".
+	Name    string // name, empty for function literals.
+	File    string // path of the template file, or of the package, of the function.
+
+	// Registers is the number of registers used by the function for each
+	// register type, in order: int, float, string and general.
+	Registers [4]int
+}
+
+// setBuildMetrics sets m with the metrics of a compilation.
+func setBuildMetrics(m *BuildMetrics, metrics *compiler.Metrics) {
+	*m = BuildMetrics{
+		ParseTime: metrics.ParseTime,
+		CheckTime: metrics.CheckTime,
+		EmitTime:  metrics.EmitTime,
+		Nodes:     metrics.Nodes,
+	}
+	if metrics.Functions != nil {
+		m.Functions = make([]FunctionMetrics, len(metrics.Functions))
+		for i, fn := range metrics.Functions {
+			m.Functions[i] = FunctionMetrics{Package: fn.Pkg, Name: fn.Name, File: fn.File, Registers: fn.Registers}
+		}
+	}
 }
 
 // PrintFunc represents a function that prints the arguments of the print and
 // println builtins.
 type PrintFunc func(interface{})
 
+// PrintTo returns a PrintFunc that formats the arguments of the print and
+// println builtins as they are formatted by default and writes them to w,
+// instead of to standard error. It is useful, for example, when running on
+// js/wasm or wasip1/wasm.
+func PrintTo(w io.Writer) PrintFunc {
+	return PrintFunc(runtime.WriterPrint(w))
+}
+
 // RunOptions are the run options.
 type RunOptions struct {
 
@@ -74,13 +324,230 @@ type RunOptions struct {
 	// If it is nil, the print and println builtins format their arguments as
 	// expected and write the result to standard error.
 	Print PrintFunc
+
+	// Locale is the locale, as a BCP 47 language tag such as "en-US" or
+	// "it", that can be read by native functions and methods via the Locale
+	// method of native.LocaleEnv. It is used, for example, by the number
+	// formatting functions of the builtin package.
+	Locale string
+
+	// Location is the default time zone that can be read by native functions
+	// and methods via the Location method of native.LocationEnv. It is used,
+	// for example, by the date formatting function of the builtin package.
+	Location *time.Location
+
+	// MaxGoroutines is the maximum number of iterations of the template
+	// "for parallel" statements that can be executed at the same time. If
+	// it is zero, it is the value returned by runtime.GOMAXPROCS(0). If it
+	// is one, the iterations are executed sequentially.
+	MaxGoroutines int
+
+	// OperationLimits, if not nil, limits the number of operations of some
+	// categories that can be executed, independently of each other.
+	OperationLimits *OperationLimits
+
+	// MemoryLimit, if greater than zero, is the maximum number of bytes that
+	// the execution can allocate with the new, make and append builtins, the
+	// composite literals and the string concatenations. The bytes are
+	// counted when allocated and never returned, also if the memory is
+	// released. The count is approximate, as the sizes of the headers of
+	// maps and channels are estimated and the growth of maps is not
+	// counted. If the limit is exceeded, the execution is terminated and Run
+	// returns a *MemoryLimitError error.
+	MemoryLimit int
+
+	// NativeCallHook, if not nil, is called in place of every call of a
+	// native function or method, including the functions of the native
+	// packages. pkg and name are the package name and the name of the called
+	// function, and can be empty strings, for example for methods. args are
+	// the arguments, without the native.Env argument, and call calls the
+	// function with args and returns its results.
+	//
+	// NativeCallHook returns the results of the call; a hook that does not
+	// call call, for example in a dry run, must return values of the result
+	// types of the function. The hook must not retain args after it returns
+	// and it can be called concurrently by different goroutines.
+	NativeCallHook func(pkg, name string, args []reflect.Value, call func() []reflect.Value) []reflect.Value
+
+	// Debugger, if not nil, debugs the execution. It stops the execution
+	// only if the program or template has been built with the Debug build
+	// option.
+	Debugger *Debugger
+
+	// WatchVars are the package-level variables whose assignments are
+	// reported to Watch. A variable is in the form "path:name", as returned
+	// by the InitOrder methods, for example "main:count", or "pkg.name" for
+	// a native variable, as returned by the NativeRefs methods.
+	//
+	// Only the assignments to the variables, also in closures, are reported,
+	// not the changes through pointers or made by native code.
+	WatchVars []string
+
+	// Watch, if not nil, is called after each assignment to a variable in
+	// WatchVars, in the goroutine that executes the assignment, so it can be
+	// called concurrently. The Var and Stack fields of the frame are the
+	// name of the variable and the stack trace. Watch does not require the
+	// Debug build option. Watch can be used, for example, to find the code
+	// that changes a variable unexpectedly.
+	Watch func(frame *DebugFrame)
+
+	// Allocator, if not nil, allocates the values created by the new and
+	// make builtins and by the composite literals of arrays, structs, slices
+	// and maps. It can be used to account the memory allocated by an
+	// execution, for example to enforce a quota, or to pool the values.
+	Allocator Allocator
+
+	// FallbackPrinter, if not nil, is called to format a value shown by a
+	// template when the value has an interface type and its dynamic type can
+	// not otherwise be shown in the context, for example a struct shown in
+	// HTML. The returned string is escaped as a string value. If it returns
+	// an error, the execution is terminated and Run returns the error.
+	//
+	// If it is nil, showing such a value terminates the execution with an
+	// error.
+	//
+	// Used for templates only.
+	FallbackPrinter func(v interface{}) (string, error)
+
+	// PostProcess, if not nil, is called with each contiguous block of
+	// literal text of a template, and with its format, before the block is
+	// rendered. The returned block is rendered in place of block. It can be
+	// used, for example, to rewrite the URLs of the assets. The values shown
+	// by the template are not passed to PostProcess, so they are always
+	// escaped as usual.
+	//
+	// PostProcess must not modify block, and it can be called concurrently
+	// by the "for parallel" statements.
+	//
+	// Used for templates only.
+	PostProcess func(format Format, block []byte) []byte
+
+	// Translate, if not nil, is called with the Locale option and with the
+	// text of each trans statement of a template, as in
+	//
+	//     {% trans %}Hello, world!{% end trans %}
+	//
+	// and the returned text is rendered in place of the text. As the text
+	// of the trans statement, the returned text is not escaped, so it can
+	// contain, for example, HTML markup in an HTML file. If Translate is nil,
+	// the text is rendered as is.
+	//
+	// Translate can be called concurrently by the "for parallel" statements.
+	// The texts of the trans statements of a template are returned by its
+	// TransTexts method.
+	//
+	// Used for templates only.
+	Translate func(locale, text string) string
+
+	// JSONNonFinite determines how the floating-point values NaN, +Inf and
+	// -Inf are shown in JSON context, where they cannot be represented as
+	// numbers. By default they are shown as null. If it is
+	// JSONNonFiniteError, the execution is terminated and Run returns an
+	// error.
+	//
+	// Used for templates only.
+	JSONNonFinite JSONNonFinite
+
+	// MaxMarkdownSize and MaxMarkdownHTMLSize, if not zero, are the maximum
+	// size in bytes of a Markdown block converted to HTML during the
+	// execution, and the maximum size in bytes of the resulting HTML. If a
+	// limit is exceeded, the execution is terminated and Run returns a
+	// *MarkdownError error.
+	//
+	// Used for templates only.
+	MaxMarkdownSize     int
+	MaxMarkdownHTMLSize int
+
+	// PanicHandler, if not nil, is called when the execution of a template
+	// panics and the panic is not recovered, for example for an assignment
+	// to an entry in a nil map. out is the output of the template, to which
+	// the handler can write a message, with the position of the panic, after
+	// the already rendered code, and err is the panic. Run returns the error
+	// returned by PanicHandler, that can be nil, instead of err.
+	//
+	// PanicHandler is not called for the errors returned by out.Write.
+	//
+	// Used for templates only.
+	PanicHandler func(out io.Writer, err *PanicError) error
+
+	// FlushThreshold, if greater than zero, streams the output of a template
+	// as it is rendered. If out has a Flush method, with signature Flush() as
+	// http.Flusher or Flush() error as bufio.Writer, Flush is called every
+	// time at least FlushThreshold bytes have been written to out since the
+	// last call, and when the execution ends without errors. An error
+	// returned by Flush is handled as an error returned by out.Write.
+	//
+	// If out does not have a Flush method, FlushThreshold is ignored.
+	//
+	// Used for templates only.
+	FlushThreshold int
+}
+
+// OperationLimits are the maximum numbers of operations, by category, that
+// can be executed by a single call to a Run method, including the operations
+// executed by the goroutines it starts. A zero value means no limit for that
+// category.
+//
+// If a limit is exceeded, the execution is terminated and Run returns an
+// *OperationLimitError error.
+type OperationLimits struct {
+
+	// NativeCalls is the maximum number of calls of native functions and
+	// methods, including the functions of the native packages.
+	NativeCalls int
+
+	// MapAllocations is the maximum number of maps created with the make
+	// builtin or with a composite literal.
+	MapAllocations int
+
+	// ChannelOperations is the maximum number of channel operations. Each
+	// make, send, receive, close and select counts as an operation.
+	ChannelOperations int
+}
+
+// Allocator allocates the values created by the new and make builtins and by
+// the composite literals of arrays, structs, slices and maps. It is set with
+// the Allocator run option.
+//
+// The methods must return values of the requested types, that are not
+// retained by other executions, and can be called concurrently by
+// different goroutines. If a method returns an error, the execution is
+// terminated and Run returns the error.
+type Allocator interface {
+
+	// New returns a pointer to a new zero value of type typ, as the reflect.New
+	// function.
+	New(typ reflect.Type) (reflect.Value, error)
+
+	// MakeSlice returns a new slice of type typ with length len and
+	// capacity cap, as the reflect.MakeSlice function. The elements must
+	// have the zero value.
+	MakeSlice(typ reflect.Type, len, cap int) (reflect.Value, error)
+
+	// MakeMap returns a new empty map of type typ with space for
+	// approximately n elements. n is zero if the size is not specified.
+	MakeMap(typ reflect.Type, n int) (reflect.Value, error)
+
+	// MakeChan returns a new bidirectional channel of type typ with the
+	// given buffer size, as the reflect.MakeChan function.
+	MakeChan(typ reflect.Type, buffer int) (reflect.Value, error)
+}
+
+// setOperationLimits sets the operation limits of vm.
+func setOperationLimits(vm *runtime.VM, limits *OperationLimits) {
+	vm.SetOperationLimit(runtime.NativeCalls, limits.NativeCalls)
+	vm.SetOperationLimit(runtime.MapAllocations, limits.MapAllocations)
+	vm.SetOperationLimit(runtime.ChannelOperations, limits.ChannelOperations)
 }
 
 // Program is a program compiled with the Build function.
 type Program struct {
-	fn      *runtime.Function
-	typeof  runtime.TypeOfFunc
-	globals []compiler.Global
+	fn         *runtime.Function
+	typeof     runtime.TypeOfFunc
+	globals    []compiler.Global
+	initOrder  []string
+	nativeRefs []string
+	goStmt     bool // reports whether the go statement is allowed.
 }
 
 // Build builds a program from the package in the root of fsys with the given
@@ -88,21 +555,60 @@ type Program struct {
 //
 // Current limitation: fsys can contain only one Go file in its root.
 //
-// If a build error occurs, it returns a *BuildError.
-func Build(fsys fs.FS, options *BuildOptions) (*Program, error) {
+// If a build error occurs, it returns a *BuildError. If an internal error
+// occurs, it returns an *InternalError.
+func Build(fsys fs.FS, options *BuildOptions) (_ *Program, err error) {
+	defer recoverInternalError(&err)
 	co := compiler.Options{}
 	if options != nil {
 		co.AllowGoStmt = options.AllowGoStmt
+		co.DisabledBuiltins = options.DisabledBuiltins
 		co.Importer = options.Packages
+		co.IntSize = options.IntSize
+		co.MaxConstantStringSize = options.MaxConstantStringSize
+		co.Debug = options.Debug
+		if options.TypesRegistry != nil {
+			co.Types = options.TypesRegistry.types
+		}
+		if options.Metrics != nil {
+			co.Metrics = &compiler.Metrics{}
+		}
 	}
 	code, err := compiler.BuildProgram(fsys, co)
+	if co.Metrics != nil {
+		setBuildMetrics(options.Metrics, co.Metrics)
+	}
 	if err != nil {
 		if e, ok := err.(compiler.Error); ok {
 			err = &BuildError{err: e}
 		}
 		return nil, err
 	}
-	return &Program{fn: code.Main, globals: code.Globals, typeof: code.TypeOf}, nil
+	return &Program{fn: code.Main, globals: code.Globals, typeof: code.TypeOf, initOrder: code.InitOrder, nativeRefs: code.NativeRefs, goStmt: co.AllowGoStmt}, nil
+}
+
+// InitOrder returns the package-level variables of the program, in the form
+// "path:name", in the order in which they are initialized. Variables of the
+// same package are in dependency order.
+//
+// If the initialization of the variables has a loop, Build returns an error
+// that explains the loop.
+func (p *Program) InitOrder() []string {
+	order := make([]string, len(p.initOrder))
+	copy(order, p.initOrder)
+	return order
+}
+
+// NativeRefs returns the native functions, variables and types referenced by
+// the program, in the form "pkg.name" where pkg is the name of the native
+// package. The returned slice is sorted.
+//
+// It can be used to verify that all the native declarations referenced by
+// the program are available before running it.
+func (p *Program) NativeRefs() []string {
+	refs := make([]string, len(p.nativeRefs))
+	copy(refs, p.nativeRefs)
+	return refs
 }
 
 // Disassemble disassembles the package with the given path and returns its
@@ -120,7 +626,9 @@ func (p *Program) Disassemble(pkgPath string) ([]byte, error) {
 // concurrently by multiple goroutines.
 //
 // If the executed program panics, and it is not recovered, Run returns a
-// *PanicError.
+// *PanicError. This is also the case if a goroutine started with the go
+// statement panics, in which case the execution is stopped and the other
+// goroutines are stopped as soon as possible.
 //
 // If the Stop method of native.Env is called, Run returns the argument passed
 // to Stop.
@@ -130,8 +638,17 @@ func (p *Program) Disassemble(pkgPath string) ([]byte, error) {
 //
 // If the context has been canceled, Run returns the error returned by the Err
 // method of the context.
-func (p *Program) Run(options *RunOptions) error {
+//
+// If an operation limit is exceeded, Run returns an *OperationLimitError.
+//
+// If the memory limit is exceeded, Run returns a *MemoryLimitError.
+//
+// If an internal error occurs, Run returns an *InternalError.
+func (p *Program) Run(options *RunOptions) (err error) {
+	var running bool
+	defer recoverRunInternalError(&err, &running)
 	vm := runtime.NewVM()
+	vm.SetStopOnGoroutinePanic(p.goStmt)
 	if options != nil {
 		if options.Context != nil {
 			vm.SetContext(options.Context)
@@ -139,11 +656,43 @@ func (p *Program) Run(options *RunOptions) error {
 		if options.Print != nil {
 			vm.SetPrint(runtime.PrintFunc(options.Print))
 		}
+		if options.Locale != "" {
+			vm.SetLocale(options.Locale)
+		}
+		if options.Location != nil {
+			vm.SetLocation(options.Location)
+		}
+		if options.OperationLimits != nil {
+			setOperationLimits(vm, options.OperationLimits)
+		}
+		if options.MemoryLimit > 0 {
+			vm.SetMemoryLimit(options.MemoryLimit)
+		}
+		if options.NativeCallHook != nil {
+			vm.SetNativeCallHook(options.NativeCallHook)
+		}
+		if options.Debugger != nil {
+			vm.SetDebugger(debuggerHook{options.Debugger})
+		}
+		setWatchpoints(vm, p.globals, options)
+		if options.Allocator != nil {
+			vm.SetAllocator(options.Allocator)
+		}
 	}
-	err := vm.Run(p.fn, p.typeof, initPackageLevelVariables(p.globals))
+	globals := initPackageLevelVariables(p.globals)
+	running = true
+	err = vm.Run(p.fn, p.typeof, globals)
+	running = false
 	if err != nil {
-		if p, ok := err.(*runtime.PanicError); ok {
-			err = &PanicError{p}
+		switch e := err.(type) {
+		case *runtime.PanicError:
+			err = &PanicError{e}
+		case *runtime.OperationLimitError:
+			err = &OperationLimitError{e}
+		case *runtime.MemoryLimitError:
+			err = &MemoryLimitError{e}
+		case *runtime.InternalError:
+			err = newInternalError(e.Msg, e.Stack)
 		}
 		return err
 	}
@@ -0,0 +1,261 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scanner provides a tokenizer for templates, programs and scripts.
+// It uses the same lexer as the compiler, so the tokens are the same that
+// the compiler parses, and it is intended, for example, for syntax
+// highlighters and editors.
+//
+// For example, the tokens of a template can be printed with:
+//
+//	s := scanner.ScanTemplate(src, ast.FormatHTML, nil)
+//	defer s.Stop()
+//	for {
+//		tok, err := s.Next()
+//		if err != nil {
+//			return err
+//		}
+//		if tok.Type == scanner.EOF {
+//			break
+//		}
+//		fmt.Printf("%s %s %q\n", tok.Pos, tok.Type, tok.Text)
+//	}
+package scanner
+
+import (
+	"fmt"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/internal/compiler"
+)
+
+// Type is the type of a token.
+type Type int
+
+const (
+	Text                     Type = iota // text
+	ShebangLine                          // #!
+	StartURL                             // start of an URL in an attribute value
+	EndURL                               // end of an URL in an attribute value
+	StartStatement                       // {%
+	EndStatement                         // %}
+	StartStatements                      // {%%
+	EndStatements                        // %%}
+	LeftBraces                           // {{
+	RightBraces                          // }}
+	Declaration                          // :=
+	SimpleAssignment                     // =
+	AdditionAssignment                   // +=
+	SubtractionAssignment                // -=
+	MultiplicationAssignment             // *=
+	DivisionAssignment                   // /=
+	ModuloAssignment                     // %=
+	AndAssignment                        // &=
+	OrAssignment                         // |=
+	XorAssignment                        // ^=
+	AndNotAssignment                     // &^=
+	LeftShiftAssignment                  // <<=
+	RightShiftAssignment                 // >>=
+	Package                              // package
+	For                                  // for
+	In                                   // in
+	Range                                // range
+	Break                                // break
+	Continue                             // continue
+	Switch                               // switch
+	Case                                 // case
+	Default                              // default
+	Fallthrough                          // fallthrough
+	Select                               // select
+	TypeKeyword                          // type
+	Interface                            // interface
+	Map                                  // map
+	Chan                                 // chan
+	If                                   // if
+	Else                                 // else
+	Defer                                // defer
+	Go                                   // go
+	Goto                                 // goto
+	Extends                              // extends
+	Import                               // import
+	Show                                 // show
+	Render                               // render
+	Macro                                // macro
+	Func                                 // func
+	Return                               // return
+	End                                  // end
+	Var                                  // var
+	Const                                // const
+	Comment                              // {# comment #}
+	InterpretedString                    // "abc"
+	RawString                            // `abc`
+	Rune                                 // 'a'
+	Identifier                           // customerName
+	Period                               // .
+	LeftParenthesis                      // (
+	RightParenthesis                     // )
+	LeftBracket                          // [
+	RightBracket                         // ]
+	LeftBrace                            // {
+	RightBrace                           // }
+	Colon                                // :
+	Comma                                // ,
+	Semicolon                            // ;
+	Ellipsis                             // ...
+	Float                                // 12.895
+	Int                                  // 18
+	Imaginary                            // 12.895i
+	Equal                                // ==
+	NotEqual                             // !=
+	Not                                  // !
+	Ampersand                            // &
+	VerticalBar                          // |
+	Less                                 // <
+	LessOrEqual                          // <=
+	Greater                              // >
+	GreaterOrEqual                       // >=
+	And                                  // &&
+	Or                                   // ||
+	Addition                             // +
+	Subtraction                          // -
+	Multiplication                       // *
+	Division                             // /
+	Modulo                               // %
+	Increment                            // ++
+	Decrement                            // --
+	Arrow                                // <-
+	Xor                                  // ^
+	AndNot                               // &^
+	LeftShift                            // <<
+	RightShift                           // >>
+	Struct                               // struct
+	EOF                                  // end of the source
+	ExtendedAnd                          // and
+	ExtendedNot                          // not
+	ExtendedOr                           // or
+	Dollar                               // $
+	Contains                             // contains
+	Raw                                  // raw
+	Using                                // using
+	NilSafePeriod                        // ?.
+	QuestionMark                         // ?
+	DoublePeriod                         // ..
+	Tilde                                // ~
+	Trans                                // trans
+)
+
+// typeNames contains the names of the types, as they are reported in the
+// syntax errors.
+var typeNames = compiler.TokenTypes()
+
+// String returns the name of the type, as it is reported in the syntax
+// errors. For example, "{%", "identifier" and "string".
+func (typ Type) String() string {
+	if typ < 0 || int(typ) >= len(typeNames) {
+		return fmt.Sprintf("Type(%d)", int(typ))
+	}
+	return typeNames[typ]
+}
+
+// IsKeyword reports whether typ is the type of a keyword.
+func (typ Type) IsKeyword() bool {
+	switch typ {
+	case Package, For, In, Range, Break, Continue, Switch, Case, Default,
+		Fallthrough, Select, TypeKeyword, Interface, Map, Chan, If, Else,
+		Defer, Go, Goto, Extends, Import, Show, Render, Macro, Func, Return,
+		End, Var, Const, Struct, ExtendedAnd, ExtendedNot, ExtendedOr,
+		Contains, Raw, Using, Trans:
+		return true
+	}
+	return false
+}
+
+// Token is a scanned token.
+type Token struct {
+	Type    Type         // type.
+	Pos     ast.Position // position in the source.
+	Text    []byte       // text, nil for the semicolons inserted automatically.
+	Context ast.Context  // context in which the token is.
+}
+
+// Options are the options of a template scanner.
+type Options struct {
+
+	// NoParseShortShowStmt, when true, does not scan the short show
+	// statements.
+	NoParseShortShowStmt bool
+
+	// DollarIdentifier, when true, scans the dollar identifier.
+	//
+	// NOTE: the dollar identifier is deprecated and will be removed in a
+	// future version of Scriggo.
+	DollarIdentifier bool
+
+	// ExecuteMarkdownCodeFences, when true, scans the fenced code blocks of
+	// the Markdown sources as the rest of the source, instead of as text.
+	ExecuteMarkdownCodeFences bool
+}
+
+// Error represents a syntax error occurred while scanning.
+type Error struct {
+	Pos ast.Position // position of the error.
+	Msg string       // message, without position.
+}
+
+// Error returns a string representing the error.
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s: syntax error: %s", err.Pos, err.Msg)
+}
+
+// Scanner scans the tokens of a source. The scanning proceeds concurrently
+// with the calls to Next, so Stop must be called if Next is not called
+// until it returns the EOF token or an error.
+type Scanner struct {
+	s *compiler.Scanner
+}
+
+// ScanProgram returns a scanner for the source of a program file, that has
+// the Go syntax.
+func ScanProgram(src []byte) *Scanner {
+	return &Scanner{compiler.NewProgramScanner(src)}
+}
+
+// ScanScript returns a scanner for the source of a script.
+func ScanScript(src []byte) *Scanner {
+	return &Scanner{compiler.NewScriptScanner(src)}
+}
+
+// ScanTemplate returns a scanner for the source of a template file with
+// the given format. options can be nil.
+func ScanTemplate(src []byte, format ast.Format, options *Options) *Scanner {
+	if format < ast.FormatText || format > ast.FormatMarkdown {
+		panic("scanner: invalid format")
+	}
+	var noParseShow, dollarIdentifier, executeCodeFences bool
+	if options != nil {
+		noParseShow = options.NoParseShortShowStmt
+		dollarIdentifier = options.DollarIdentifier
+		executeCodeFences = options.ExecuteMarkdownCodeFences
+	}
+	return &Scanner{compiler.NewTemplateScanner(src, format, noParseShow, dollarIdentifier, executeCodeFences)}
+}
+
+// Next returns the next token. At the end of the source it returns a token
+// with type EOF, and it continues to return it on the following calls. If a
+// syntax error occurs, it returns an *Error error.
+func (s *Scanner) Next() (Token, error) {
+	typ, pos, text, ctx, err := s.s.Next()
+	if err != nil {
+		if e, ok := err.(*compiler.SyntaxError); ok {
+			return Token{}, &Error{Pos: e.Position(), Msg: e.Message()}
+		}
+		return Token{}, err
+	}
+	return Token{Type: Type(typ), Pos: pos, Text: text, Context: ctx}, nil
+}
+
+// Stop stops the scanning. After Stop, Next returns the EOF token.
+func (s *Scanner) Stop() {
+	s.s.Stop()
+}
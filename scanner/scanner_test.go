@@ -0,0 +1,168 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scanner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo/ast"
+)
+
+func TestTypes(t *testing.T) {
+	if len(typeNames) != int(Trans)+1 {
+		t.Fatalf("expecting %d types, got %d", int(Trans)+1, len(typeNames))
+	}
+	names := map[Type]string{
+		Text: "text", StartStatements: "{%%", TypeKeyword: "type", Comment: "comment",
+		InterpretedString: "string", RawString: "string", Identifier: "identifier",
+		Struct: "struct", EOF: "EOF", ExtendedAnd: "and", Using: "using", DoublePeriod: "..", Tilde: "~", Trans: "trans",
+	}
+	for typ, name := range names {
+		if typ.String() != name {
+			t.Fatalf("expecting name %q for type %d, got %q", name, int(typ), typ.String())
+		}
+	}
+	if s := Type(-1).String(); s != "Type(-1)" {
+		t.Fatalf("expecting name %q, got %q", "Type(-1)", s)
+	}
+	if !Using.IsKeyword() || !Macro.IsKeyword() || Identifier.IsKeyword() || Addition.IsKeyword() {
+		t.Fatal("unexpected IsKeyword result")
+	}
+}
+
+// scan scans the source of s and returns the tokens, formatted as
+// "type:text", separated by spaces. The automatically inserted semicolons
+// have no text.
+func scan(t *testing.T, s *Scanner) string {
+	t.Helper()
+	var b strings.Builder
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		if tok.Type == EOF {
+			b.WriteString("EOF")
+			break
+		}
+		b.WriteString(tok.Type.String() + ":" + string(tok.Text))
+	}
+	return b.String()
+}
+
+func TestScanTemplate(t *testing.T) {
+	src := "<b>{{ a + 1 }}</b>{# c #}{% using %}x{% end using %}{%% if a { b := `s` } %%}"
+	expected := "text:<b> {{:{{ identifier:a +:+ int:1 }}:}} text:</b> comment:{# c #}" +
+		" {%:{% using:using %}:%} text:x {%:{% end:end using:using %}:%}" +
+		" {%%:{%% if:if identifier:a {:{ identifier:b :=::= string:`s` }:} semicolon: %%}:%%} EOF"
+	got := scan(t, ScanTemplate([]byte(src), ast.FormatHTML, nil))
+	if got != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, got)
+	}
+	// Markdown fenced code blocks.
+	src = "```\n{{ a }}\n```"
+	got = scan(t, ScanTemplate([]byte(src), ast.FormatMarkdown, nil))
+	if expected := "text:" + src + " EOF"; got != expected {
+		t.Fatalf("expecting %q, got %q", expected, got)
+	}
+	got = scan(t, ScanTemplate([]byte(src), ast.FormatMarkdown, &Options{ExecuteMarkdownCodeFences: true}))
+	if expected := "text:```\n {{:{{ identifier:a }}:}} text:\n``` EOF"; got != expected {
+		t.Fatalf("expecting %q, got %q", expected, got)
+	}
+	// Short show statements.
+	got = scan(t, ScanTemplate([]byte("{% a %}"), ast.FormatText, &Options{NoParseShortShowStmt: true}))
+	if expected := "{%:{% identifier:a %}:%} EOF"; got != expected {
+		t.Fatalf("expecting %q, got %q", expected, got)
+	}
+}
+
+func TestScanProgram(t *testing.T) {
+	src := "package main\n\nfunc main() { _ = 5 }\n"
+	expected := "package:package identifier:main semicolon: func:func identifier:main (:( ):) {:{" +
+		" identifier:_ =:= int:5 }:} semicolon: EOF"
+	got := scan(t, ScanProgram([]byte(src)))
+	if got != expected {
+		t.Fatalf("expecting:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestScanPositionAndContext(t *testing.T) {
+	s := ScanTemplate([]byte("<a href=\"{{ u }}\">\n{{ v }}"), ast.FormatHTML, nil)
+	defer s.Stop()
+	var idents []Token
+	for {
+		tok, err := s.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Type == EOF {
+			break
+		}
+		if tok.Type == Identifier {
+			idents = append(idents, tok)
+		}
+	}
+	if len(idents) != 2 {
+		t.Fatalf("expecting 2 identifiers, got %d", len(idents))
+	}
+	if pos := idents[0].Pos; pos.Line != 1 || pos.Column != 13 || pos.Start != 12 || pos.End != 12 {
+		t.Fatalf("unexpected position %#v", pos)
+	}
+	if ctx := idents[0].Context; ctx != ast.ContextQuotedAttr {
+		t.Fatalf("expecting context %s, got %s", ast.ContextQuotedAttr, ctx)
+	}
+	if pos := idents[1].Pos; pos.Line != 2 || pos.Column != 4 || pos.Start != 22 || pos.End != 22 {
+		t.Fatalf("unexpected position %#v", pos)
+	}
+	if ctx := idents[1].Context; ctx != ast.ContextHTML {
+		t.Fatalf("expecting context %s, got %s", ast.ContextHTML, ctx)
+	}
+	// EOF is returned again.
+	if tok, _ := s.Next(); tok.Type != EOF {
+		t.Fatalf("expecting EOF, got %s", tok.Type)
+	}
+}
+
+func TestScanError(t *testing.T) {
+	s := ScanTemplate([]byte("{{ a }}{{ \"b }}"), ast.FormatText, nil)
+	var err error
+	for err == nil {
+		var tok Token
+		tok, err = s.Next()
+		if tok.Type == EOF {
+			t.Fatal("expecting error, got EOF")
+		}
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expecting *Error, got %T", err)
+	}
+	if expected := "1:11: syntax error: string not terminated"; e.Error() != expected {
+		t.Fatalf("expecting error %q, got %q", expected, e.Error())
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := ScanProgram([]byte("package main\n\nfunc main() { }\n"))
+	tok, err := s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Type != Package {
+		t.Fatalf("expecting package, got %s", tok.Type)
+	}
+	s.Stop()
+	tok, err = s.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Type != EOF {
+		t.Fatalf("expecting EOF, got %s", tok.Type)
+	}
+}
@@ -5,6 +5,10 @@
 package scripts
 
 import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+
 	"github.com/open2b/scriggo"
 	"github.com/open2b/scriggo/internal/compiler"
 	"github.com/open2b/scriggo/internal/runtime"
@@ -79,3 +83,55 @@ func (p *PanicError) Position() scriggo.Position {
 	pos := p.p.Position()
 	return scriggo.Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}
 }
+
+// InternalError represents an internal error occurred building or running a
+// script. Build and the Run method return an *InternalError, instead of
+// panicking, when an unexpected panic occurs. It should be reported as a bug.
+type InternalError struct {
+	msg   string
+	stack []byte
+}
+
+// newInternalError returns a new internal error for the recovered panic
+// value r and the stack trace of the panic.
+func newInternalError(r interface{}, stack []byte) *InternalError {
+	msg := strings.TrimPrefix(fmt.Sprint(r), "scriggo: internal error: ")
+	return &InternalError{msg: msg, stack: stack}
+}
+
+// recoverInternalError recovers a panic, if any, and stores in *err an
+// *InternalError. It must be called directly as a deferred function.
+func recoverInternalError(err *error) {
+	if r := recover(); r != nil {
+		*err = newInternalError(r, debug.Stack())
+	}
+}
+
+// recoverRunInternalError is like recoverInternalError but, if *running is
+// true, it panics again with the recovered value. Run sets *running while
+// the virtual machine runs, so a panic raised by a call to the Fatal method
+// of native.Env is not recovered. It must be called directly as a deferred
+// function.
+func recoverRunInternalError(err *error, running *bool) {
+	if r := recover(); r != nil {
+		if *running {
+			panic(r)
+		}
+		*err = newInternalError(r, debug.Stack())
+	}
+}
+
+// Error returns a string representation of the error.
+func (err *InternalError) Error() string {
+	return "scriggo: internal error: " + err.msg
+}
+
+// Message returns the error message.
+func (err *InternalError) Message() string {
+	return err.msg
+}
+
+// Stack returns the stack trace of the panic that caused the error.
+func (err *InternalError) Stack() []byte {
+	return err.stack
+}
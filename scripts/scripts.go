@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"time"
 
 	"github.com/open2b/scriggo"
 	"github.com/open2b/scriggo/internal/compiler"
@@ -26,6 +27,13 @@ type BuildOptions struct {
 	// AllowGoStmt, when true, allows the use of the go statement.
 	AllowGoStmt bool
 
+	// DisabledBuiltins are the names of the builtins, as "print" and
+	// "println", that cannot be used. If a disabled builtin is used, the
+	// build fails with the error "use of disabled builtin" followed by the
+	// name of the builtin. A declaration with the same name as a disabled
+	// builtin can be used.
+	DisabledBuiltins []string
+
 	// Packages is a package importer that makes native packages available
 	// in scripts through the import statement.
 	Packages native.Importer
@@ -33,6 +41,11 @@ type BuildOptions struct {
 	// Globals declares constants, types, variables, functions and packages
 	// that are accessible from the code in the script.
 	Globals native.Declarations
+
+	// IntSize is the size in bits of the int, uint and uintptr values on the
+	// target. It can be 0, 32 or 64. If it is 0, the size on the host is
+	// used.
+	IntSize int
 }
 
 // RunOptions are the run options.
@@ -47,6 +60,17 @@ type RunOptions struct {
 	// If it is nil, the print and println builtins format their arguments as
 	// expected and write the result to standard error.
 	Print scriggo.PrintFunc
+
+	// Locale is the locale, as a BCP 47 language tag such as "en-US" or
+	// "it", that can be read by native functions and methods via the Locale
+	// method of native.LocaleEnv. It is used, for example, by the number
+	// formatting functions of the builtin package.
+	Locale string
+
+	// Location is the default time zone that can be read by native functions
+	// and methods via the Location method of native.LocationEnv. It is used,
+	// for example, by the date formatting function of the builtin package.
+	Location *time.Location
 }
 
 // Script is a script compiled with the Build function.
@@ -54,17 +78,22 @@ type Script struct {
 	fn      *runtime.Function
 	typeof  runtime.TypeOfFunc
 	globals []compiler.Global
+	goStmt  bool // reports whether the go statement is allowed.
 }
 
 // Build builds a script reading the source code from src.
 //
-// If a build error occurs, it returns a *BuildError.
-func Build(src io.Reader, options *BuildOptions) (*Script, error) {
+// If a build error occurs, it returns a *BuildError. If an internal error
+// occurs, it returns an *InternalError.
+func Build(src io.Reader, options *BuildOptions) (_ *Script, err error) {
+	defer recoverInternalError(&err)
 	co := compiler.Options{}
 	if options != nil {
 		co.Globals = options.Globals
 		co.AllowGoStmt = options.AllowGoStmt
+		co.DisabledBuiltins = options.DisabledBuiltins
 		co.Importer = options.Packages
+		co.IntSize = options.IntSize
 	}
 	code, err := compiler.BuildScript(src, co)
 	if err != nil {
@@ -73,7 +102,7 @@ func Build(src io.Reader, options *BuildOptions) (*Script, error) {
 		}
 		return nil, err
 	}
-	return &Script{fn: code.Main, globals: code.Globals, typeof: code.TypeOf}, nil
+	return &Script{fn: code.Main, globals: code.Globals, typeof: code.TypeOf, goStmt: co.AllowGoStmt}, nil
 }
 
 // Disassemble disassembles the script and returns its assembly code.
@@ -86,7 +115,8 @@ func (p *Script) Disassemble() []byte {
 // values of the global variables.
 //
 // If the executed script panics, and it is not recovered, Run returns a
-// *PanicError.
+// *PanicError. This is also the case if a goroutine started with the go
+// statement panics.
 //
 // If the Stop method of native.Env is called, Run returns the argument passed
 // to Stop.
@@ -99,8 +129,20 @@ func (p *Script) Disassemble() []byte {
 //
 // If the context has been canceled, Run returns the error returned by the Err
 // method of the context.
-func (p *Script) Run(vars map[string]interface{}, options *RunOptions) error {
+//
+// If a value of vars cannot initialize the global variable with the same
+// name, Run returns an error.
+//
+// If an internal error occurs, Run returns an *InternalError.
+func (p *Script) Run(vars map[string]interface{}, options *RunOptions) (err error) {
+	var running bool
+	defer recoverRunInternalError(&err, &running)
+	globals, err := initGlobalVariables(p.globals, vars)
+	if err != nil {
+		return err
+	}
 	vm := runtime.NewVM()
+	vm.SetStopOnGoroutinePanic(p.goStmt)
 	if options != nil {
 		if options.Context != nil {
 			vm.SetContext(options.Context)
@@ -108,11 +150,22 @@ func (p *Script) Run(vars map[string]interface{}, options *RunOptions) error {
 		if options.Print != nil {
 			vm.SetPrint(runtime.PrintFunc(options.Print))
 		}
+		if options.Locale != "" {
+			vm.SetLocale(options.Locale)
+		}
+		if options.Location != nil {
+			vm.SetLocation(options.Location)
+		}
 	}
-	err := vm.Run(p.fn, p.typeof, initGlobalVariables(p.globals, vars))
+	running = true
+	err = vm.Run(p.fn, p.typeof, globals)
+	running = false
 	if err != nil {
-		if p, ok := err.(*runtime.PanicError); ok {
-			err = &PanicError{p}
+		switch e := err.(type) {
+		case *runtime.PanicError:
+			err = &PanicError{e}
+		case *runtime.InternalError:
+			err = newInternalError(e.Msg, e.Stack)
 		}
 		return err
 	}
@@ -122,13 +175,13 @@ func (p *Script) Run(vars map[string]interface{}, options *RunOptions) error {
 var emptyInit = map[string]interface{}{}
 
 // initGlobalVariables initializes the global variables and returns their
-// values. It panics if init is not valid.
+// values. It returns an error if init is not valid.
 //
 // This function is a copy of the function in the scriggo package.
-func initGlobalVariables(variables []compiler.Global, init map[string]interface{}) []reflect.Value {
+func initGlobalVariables(variables []compiler.Global, init map[string]interface{}) ([]reflect.Value, error) {
 	n := len(variables)
 	if n == 0 {
-		return nil
+		return nil, nil
 	}
 	if init == nil {
 		init = emptyInit
@@ -138,10 +191,10 @@ func initGlobalVariables(variables []compiler.Global, init map[string]interface{
 		if variable.Pkg == "main" {
 			if value, ok := init[variable.Name]; ok {
 				if variable.Value.IsValid() {
-					panic(fmt.Sprintf("variable %q already initialized", variable.Name))
+					return nil, fmt.Errorf("variable %q already initialized", variable.Name)
 				}
 				if value == nil {
-					panic(fmt.Sprintf("variable initializer %q cannot be nil", variable.Name))
+					return nil, fmt.Errorf("variable initializer %q cannot be nil", variable.Name)
 				}
 				val := reflect.ValueOf(value)
 				if typ := val.Type(); typ == variable.Type {
@@ -150,11 +203,11 @@ func initGlobalVariables(variables []compiler.Global, init map[string]interface{
 					values[i] = v
 				} else {
 					if typ.Kind() != reflect.Ptr || typ.Elem() != variable.Type {
-						panic(fmt.Sprintf("variable initializer %q must have type %s or %s, but have %s",
-							variable.Name, variable.Type, reflect.PtrTo(variable.Type), typ))
+						return nil, fmt.Errorf("variable initializer %q must have type %s or %s, but have %s",
+							variable.Name, variable.Type, reflect.PtrTo(variable.Type), typ)
 					}
 					if val.IsNil() {
-						panic(fmt.Sprintf("variable initializer %q cannot be a nil pointer", variable.Name))
+						return nil, fmt.Errorf("variable initializer %q cannot be a nil pointer", variable.Name)
 					}
 					values[i] = reflect.ValueOf(value).Elem()
 				}
@@ -167,5 +220,5 @@ func initGlobalVariables(variables []compiler.Global, init map[string]interface{
 			values[i] = reflect.New(variable.Type).Elem()
 		}
 	}
-	return values
+	return values, nil
 }
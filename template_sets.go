@@ -0,0 +1,287 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scriggo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
+	"github.com/open2b/scriggo/internal/compiler"
+)
+
+// TemplateRoot is a root of the template files of a TemplateSet.
+type TemplateRoot struct {
+
+	// FS is the file system of the root. If it implements FormatFS, the
+	// file formats are read with its Format method, otherwise they depend
+	// on the file name extensions as for BuildTemplate.
+	FS fs.FS
+
+	// Exports contains the patterns, with the syntax of path.Match, of the
+	// files of the root that can be extended, imported and rendered by the
+	// files of the other roots. For example "partials/*.html".
+	Exports []string
+
+	// Imports contains the names of the other roots whose exported files
+	// can be extended, imported and rendered by the files of the root.
+	Imports []string
+}
+
+// TemplateSet is a set of templates whose files are organized in named
+// roots, for example "emails", "web" and "pdf". The templates of a set are
+// built with the same build options, so they share the native packages, the
+// globals and the types.
+//
+// The path of a file of a set starts with the name of its root prefixed with
+// '@', for example "@web/partials/button.html". So a file refers to the files
+// of its root with relative paths, and to the files of any root with absolute
+// paths, as "/@web/partials/button.html". A file can refer to a file of
+// another root only if the file is exported by the other root and the other
+// root is imported by its root.
+//
+// Each template is built once, the first time it is requested, so the
+// methods of a TemplateSet can be called concurrently by multiple
+// goroutines.
+type TemplateSet struct {
+	fsys      templateSetFS
+	options   BuildOptions
+	mu        sync.Mutex
+	templates map[string]*templateSetEntry
+}
+
+// templateSetEntry is a template of a template set, with its build error.
+type templateSetEntry struct {
+	once     sync.Once
+	template *Template
+	err      error
+}
+
+// NewTemplateSet returns a new template set with the given roots, indexed by
+// name, and build options. The names of the roots cannot contain '/' and if
+// options is not nil, its Metrics field must be nil.
+//
+// If the TypesRegistry option is nil, the templates of the set share a new
+// types registry.
+func NewTemplateSet(roots map[string]TemplateRoot, options *BuildOptions) (*TemplateSet, error) {
+	for name, root := range roots {
+		if name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("scriggo: invalid template root name %q", name)
+		}
+		if root.FS == nil {
+			return nil, fmt.Errorf("scriggo: template root %q has a nil file system", name)
+		}
+		for _, pattern := range root.Exports {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("scriggo: invalid export pattern %q of template root %q", pattern, name)
+			}
+		}
+		for _, imported := range root.Imports {
+			if _, ok := roots[imported]; !ok || imported == name {
+				return nil, fmt.Errorf("scriggo: template root %q imports the invalid root %q", name, imported)
+			}
+		}
+	}
+	set := &TemplateSet{
+		fsys:      templateSetFS{roots: roots},
+		templates: map[string]*templateSetEntry{},
+	}
+	if options != nil {
+		if options.Metrics != nil {
+			return nil, errors.New("scriggo: template set options cannot have metrics")
+		}
+		set.options = *options
+	}
+	if set.options.TypesRegistry == nil {
+		set.options.TypesRegistry = NewTypesRegistry()
+	}
+	transform := set.options.TreeTransformer
+	set.options.TreeTransformer = func(tree *ast.Tree) error {
+		err := set.checkVisibility(tree, map[*ast.Tree]bool{})
+		if err == nil && transform != nil {
+			err = transform(tree)
+		}
+		return err
+	}
+	return set, nil
+}
+
+// Template returns the template with the given name, in the root with the
+// given name, building it the first time. If the root or the named file does
+// not exist, Template returns an error satisfying errors.Is(err,
+// fs.ErrNotExist). Other errors are as for BuildTemplate.
+func (set *TemplateSet) Template(root, name string) (*Template, error) {
+	if _, ok := set.fsys.roots[root]; !ok || !fs.ValidPath(name) {
+		return nil, fmt.Errorf("scriggo: template %s in root %q: %w", name, root, fs.ErrNotExist)
+	}
+	p := "@" + root + "/" + name
+	set.mu.Lock()
+	entry, ok := set.templates[p]
+	if !ok {
+		entry = &templateSetEntry{}
+		set.templates[p] = entry
+	}
+	set.mu.Unlock()
+	entry.once.Do(func() {
+		entry.template, entry.err = BuildTemplate(set.fsys, p, &set.options)
+	})
+	return entry.template, entry.err
+}
+
+// checkVisibility checks that the files extended, imported and rendered by
+// tree, and recursively by their trees, are visible to the files that refer
+// to them. checked contains the trees already checked.
+func (set *TemplateSet) checkVisibility(tree *ast.Tree, checked map[*ast.Tree]bool) error {
+	if checked[tree] {
+		return nil
+	}
+	checked[tree] = true
+	var err error
+	check := func(node ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		var ref *ast.Tree
+		switch n := node.(type) {
+		case *ast.Extends:
+			ref = n.Tree
+		case *ast.Import:
+			ref = n.Tree
+		case *ast.Render:
+			ref = n.Tree
+		}
+		if ref == nil {
+			return true
+		}
+		if !set.visible(tree.Path, ref.Path) {
+			err = &visibilityError{path: tree.Path, pos: *node.Pos(), ref: ref.Path}
+			return false
+		}
+		err = set.checkVisibility(ref, checked)
+		return err == nil
+	}
+	for _, node := range tree.Nodes {
+		astutil.Inspect(node, check)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visible reports whether the file with path ref is visible to the file with
+// path p. Both paths start with the name of the root prefixed with '@'.
+func (set *TemplateSet) visible(p, ref string) bool {
+	root, _ := splitRootPath(p)
+	refRoot, name := splitRootPath(ref)
+	if root == refRoot {
+		return true
+	}
+	var imported bool
+	for _, r := range set.fsys.roots[root].Imports {
+		if r == refRoot {
+			imported = true
+			break
+		}
+	}
+	if !imported {
+		return false
+	}
+	for _, pattern := range set.fsys.roots[refRoot].Exports {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// splitRootPath splits a path of a template set file system into the name of
+// the root and the name of the file in the root.
+func splitRootPath(p string) (root, name string) {
+	p = strings.TrimPrefix(p, "@")
+	if i := strings.IndexByte(p, '/'); i > 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+// visibilityError is the error returned when a template file refers to a
+// file of another root that is not visible to it.
+type visibilityError struct {
+	path string
+	pos  ast.Position
+	ref  string
+}
+
+func (err *visibilityError) Error() string {
+	return err.path + ":" + err.pos.String() + ": " + err.Message()
+}
+
+func (err *visibilityError) Message() string {
+	root, _ := splitRootPath(err.path)
+	return "file /" + err.ref + " is not visible to the files of root " + root
+}
+
+func (err *visibilityError) Path() string {
+	return err.path
+}
+
+func (err *visibilityError) Position() ast.Position {
+	return err.pos
+}
+
+// templateSetFS is the file system of a template set. Its files are the files
+// of the roots, where the name of a file starts with the name of its root
+// prefixed with '@'.
+type templateSetFS struct {
+	roots map[string]TemplateRoot
+}
+
+// Open opens the named file.
+func (fsys templateSetFS) Open(name string) (fs.File, error) {
+	root, ok := fsys.root(name)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	_, n := splitRootPath(name)
+	f, err := root.FS.Open(n)
+	if e, ok := err.(*fs.PathError); ok {
+		err = &fs.PathError{Op: e.Op, Path: name, Err: e.Err}
+	}
+	return f, err
+}
+
+// Format returns the format of the named file.
+func (fsys templateSetFS) Format(name string) (ast.Format, error) {
+	root, ok := fsys.root(name)
+	if !ok {
+		return 0, &fs.PathError{Op: "format", Path: name, Err: fs.ErrNotExist}
+	}
+	_, n := splitRootPath(name)
+	if f, ok := root.FS.(FormatFS); ok {
+		format, err := f.Format(n)
+		return ast.Format(format), err
+	}
+	return compiler.ExtensionFormat(n), nil
+}
+
+// root returns the root of the named file and true, or false if the root does
+// not exist.
+func (fsys templateSetFS) root(name string) (TemplateRoot, bool) {
+	if !strings.HasPrefix(name, "@") {
+		return TemplateRoot{}, false
+	}
+	r, n := splitRootPath(name)
+	if n == "" {
+		return TemplateRoot{}, false
+	}
+	root, ok := fsys.roots[r]
+	return root, ok
+}
@@ -5,14 +5,18 @@
 package scriggo
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"reflect"
 	"sort"
+	"sync"
 
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/ast/astutil"
 	"github.com/open2b/scriggo/internal/compiler"
 	"github.com/open2b/scriggo/internal/runtime"
 	"github.com/open2b/scriggo/native"
@@ -36,15 +40,49 @@ func (format Format) String() string {
 	return ast.Format(format).String()
 }
 
+// JSONNonFinite determines how the floating-point values NaN, +Inf and -Inf,
+// that cannot be represented in JSON, are shown by a template in JSON
+// context.
+type JSONNonFinite int
+
+const (
+	JSONNonFiniteNull   JSONNonFinite = iota // shown as null
+	JSONNonFiniteString                      // shown as the strings "NaN", "+Inf" and "-Inf"
+	JSONNonFiniteError                       // the execution is terminated with an error
+)
+
 // Converter is implemented by format converters.
 type Converter func(src []byte, out io.Writer) error
 
+// ContextConverter is like Converter but it is also called with a context.
+type ContextConverter func(ctx context.Context, src []byte, out io.Writer) error
+
 // Template is a template compiled with the BuildTemplate function.
 type Template struct {
-	fn      *runtime.Function
-	typeof  runtime.TypeOfFunc
-	globals []compiler.Global
-	conv    runtime.Converter
+	fn         *runtime.Function
+	typeof     runtime.TypeOfFunc
+	globals    []compiler.Global
+	conv       runtime.Converter
+	tree       *ast.Tree
+	initOrder  []string
+	nativeRefs []string
+	transTexts []string
+	goStmt     bool // reports whether the go statement is allowed.
+
+	// markdownHTML contains the HTML of the pre-converted values of the
+	// Markdown global variables, indexed by Markdown source.
+	markdownHTML map[string][]byte
+
+	// vars is the plan to bind the vars argument of Run to the globals.
+	vars varsPlan
+
+	// prologue and epilogue are written to the output before and after the
+	// rendered code.
+	prologue string
+	epilogue string
+
+	fingerprintOnce sync.Once
+	fingerprint     string
 }
 
 // FormatFS is the interface implemented by a file system that can determine
@@ -90,33 +128,149 @@ var formatTypes = map[ast.Format]reflect.Type{
 // If the named file does not exist, BuildTemplate returns an error satisfying
 // errors.Is(err, fs.ErrNotExist).
 //
-// If a build error occurs, it returns a *BuildError.
-func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (*Template, error) {
+// If a build error occurs, it returns a *BuildError. If an internal error
+// occurs, it returns an *InternalError.
+func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (_ *Template, err error) {
+	defer recoverInternalError(&err)
 	if f, ok := fsys.(FormatFS); ok {
 		fsys = formatFS{f}
 	}
+	co := templateCompilerOptions(options)
+	code, err := compiler.BuildTemplate(fsys, name, co)
+	return newTemplate(code, err, co, options)
+}
+
+// sourcePath is the path of a template built with BuildTemplateSource.
+const sourcePath = "source"
+
+// BuildTemplateSource builds a template from the source src with the given
+// format. It is like BuildTemplate but src cannot extend, import and render
+// other files; if it does, BuildTemplateSource returns a *BuildError. It can
+// be used to build small templates, as email subjects, without a file
+// system.
+//
+// The path of the source, as reported in the errors, is "source".
+func BuildTemplateSource(src []byte, format Format, options *BuildOptions) (_ *Template, err error) {
+	defer recoverInternalError(&err)
+	co := templateCompilerOptions(options)
+	code, err := compiler.BuildTemplateSource(src, sourcePath, ast.Format(format), co)
+	return newTemplate(code, err, co, options)
+}
+
+// templateCompilerOptions returns the compiler options to build a template
+// with the given build options.
+func templateCompilerOptions(options *BuildOptions) compiler.Options {
 	co := compiler.Options{
 		FormatTypes: formatTypes,
+		Sources:     map[string][]byte{},
 	}
-	var conv Converter
 	if options != nil {
 		co.Globals = options.Globals
+		co.AllowedGlobals = options.AllowedGlobals
 		co.TreeTransformer = options.TreeTransformer
 		co.AllowGoStmt = options.AllowGoStmt
+		co.DisabledBuiltins = options.DisabledBuiltins
 		co.NoParseShortShowStmt = options.NoParseShortShowStmt
 		co.DollarIdentifier = options.DollarIdentifier
+		co.ExecuteMarkdownCodeFences = options.ExecuteMarkdownCodeFences
 		co.Importer = options.Packages
-		co.MDConverter = compiler.Converter(options.MarkdownConverter)
-		conv = options.MarkdownConverter
+		co.IntSize = options.IntSize
+		if conv := options.MarkdownContextConverter; conv != nil {
+			co.MDConverter = func(src []byte, out io.Writer) error {
+				return conv(context.Background(), src, out)
+			}
+		} else {
+			co.MDConverter = compiler.Converter(options.MarkdownConverter)
+		}
+		co.Sanitizers = options.Sanitizers
+		co.KeepTree = options.KeepTree
+		co.MaxExpressionDepth = options.MaxExpressionDepth
+		co.MaxNestingDepth = options.MaxNestingDepth
+		co.MaxFileSize = options.MaxFileSize
+		co.MaxConstantStringSize = options.MaxConstantStringSize
+		co.CheckUnusedMacros = options.CheckUnusedMacros
+		co.Concurrency = options.Concurrency
+		co.OrDefault = options.OrDefault
+		co.StrictShows = options.StrictShows
+		co.Debug = options.Debug
+		if warn := options.Warn; warn != nil {
+			co.Warn = func(path string, pos ast.Position, msg string) {
+				warn(path, Position{Line: pos.Line, Column: pos.Column, Start: pos.Start, End: pos.End}, msg)
+			}
+		}
+		if options.TypesRegistry != nil {
+			co.Types = options.TypesRegistry.types
+		}
+		if options.Metrics != nil {
+			co.Metrics = &compiler.Metrics{}
+		}
+	}
+	return co
+}
+
+// newTemplate returns a new template given the code and the error returned
+// by the compiler, the compiler options and the build options.
+func newTemplate(code *compiler.Code, err error, co compiler.Options, options *BuildOptions) (*Template, error) {
+	if co.Metrics != nil {
+		setBuildMetrics(options.Metrics, co.Metrics)
 	}
-	code, err := compiler.BuildTemplate(fsys, name, co)
 	if err != nil {
 		if e, ok := err.(compiler.Error); ok {
-			err = &BuildError{err: e}
+			err = &BuildError{err: e, src: co.Sources[e.Path()]}
 		}
 		return nil, err
 	}
-	return &Template{fn: code.Main, typeof: code.TypeOf, globals: code.Globals, conv: runtime.Converter(conv)}, nil
+	var conv runtime.Converter
+	if options != nil {
+		if c := options.MarkdownContextConverter; c != nil {
+			conv = runtime.Converter(c)
+		} else if c := options.MarkdownConverter; c != nil {
+			conv = func(_ context.Context, src []byte, out io.Writer) error {
+				return c(src, out)
+			}
+		}
+	}
+	t := &Template{fn: code.Main, typeof: code.TypeOf, globals: code.Globals, conv: conv, tree: code.Tree, initOrder: code.InitOrder, nativeRefs: code.NativeRefs, transTexts: code.TransTexts, goStmt: co.AllowGoStmt}
+	t.vars = newVarsPlan(code.Globals)
+	if options != nil {
+		format := Format(code.Main.Format)
+		t.prologue = options.Prologue[format]
+		t.epilogue = options.Epilogue[format]
+	}
+	if options != nil && options.PreconvertMarkdownGlobals && conv != nil {
+		t.markdownHTML, err = preconvertMarkdownGlobals(code.Globals, conv)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// preconvertMarkdownGlobals converts to HTML, with conv, the values of the
+// global variables with type markdown. It returns the HTML indexed by
+// Markdown source.
+func preconvertMarkdownGlobals(globals []compiler.Global, conv runtime.Converter) (map[string][]byte, error) {
+	markdownType := formatTypes[ast.FormatMarkdown]
+	var html map[string][]byte
+	for _, global := range globals {
+		if global.Type != markdownType || !global.Value.IsValid() {
+			continue
+		}
+		src := global.Value.String()
+		if _, ok := html[src]; ok {
+			continue
+		}
+		var b bytes.Buffer
+		err := conv(context.Background(), []byte(src), &b)
+		if err != nil {
+			return nil, fmt.Errorf("scriggo: cannot convert global %s to HTML: %w", global.Name, err)
+		}
+		if html == nil {
+			html = map[string][]byte{}
+		}
+		html[src] = b.Bytes()
+	}
+	return html, nil
 }
 
 // Run runs the template and write the rendered code to out. vars contains
@@ -124,7 +278,8 @@ func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (*Template, e
 // multiple goroutines.
 //
 // If the executed template panics, and it is not recovered, Run returns a
-// *PanicError.
+// *PanicError, or the error returned by the PanicHandler option if it is not
+// nil.
 //
 // If the Stop method of native.Env is called, Run returns the argument passed
 // to Stop.
@@ -135,14 +290,33 @@ func BuildTemplate(fsys fs.FS, name string, options *BuildOptions) (*Template, e
 // If the context has been canceled, Run returns the error returned by the Err
 // method of the context.
 //
+// If an operation limit is exceeded, Run returns an *OperationLimitError.
+//
+// If the memory limit is exceeded, Run returns a *MemoryLimitError.
+//
+// If the conversion of a Markdown block to HTML fails or exceeds a size
+// limit, Run returns a *MarkdownError.
+//
+// If a value of vars cannot initialize the global variable with the same
+// name, Run returns an error, as the CheckVars method does.
+//
+// If an internal error occurs, Run returns an *InternalError.
+//
 // If a call to out.Write returns an error, a panic occurs. If the executed
 // code does not recover the panic, Run returns the error returned by
 // out.Write.
-func (t *Template) Run(out io.Writer, vars map[string]interface{}, options *RunOptions) error {
+func (t *Template) Run(out io.Writer, vars map[string]interface{}, options *RunOptions) (err error) {
+	var running bool
+	defer recoverRunInternalError(&err, &running)
 	if out == nil {
 		return errors.New("invalid nil out")
 	}
+	globals, err := t.vars.bind(vars)
+	if err != nil {
+		return err
+	}
 	vm := runtime.NewVM()
+	vm.SetStopOnGoroutinePanic(t.goStmt)
 	if options != nil {
 		if options.Context != nil {
 			vm.SetContext(options.Context)
@@ -150,18 +324,148 @@ func (t *Template) Run(out io.Writer, vars map[string]interface{}, options *RunO
 		if options.Print != nil {
 			vm.SetPrint(runtime.PrintFunc(options.Print))
 		}
+		if options.Locale != "" {
+			vm.SetLocale(options.Locale)
+		}
+		if options.Location != nil {
+			vm.SetLocation(options.Location)
+		}
+		if options.MaxGoroutines != 0 {
+			vm.SetMaxGoroutines(options.MaxGoroutines)
+		}
+		if options.FallbackPrinter != nil {
+			vm.SetFallbackPrinter(options.FallbackPrinter)
+		}
+		if postProcess := options.PostProcess; postProcess != nil {
+			vm.SetPostProcess(func(format ast.Format, block []byte) []byte {
+				return postProcess(Format(format), block)
+			})
+		}
+		if options.Translate != nil {
+			vm.SetTranslate(options.Translate)
+		}
+		if options.OperationLimits != nil {
+			setOperationLimits(vm, options.OperationLimits)
+		}
+		if options.MemoryLimit > 0 {
+			vm.SetMemoryLimit(options.MemoryLimit)
+		}
+		if options.NativeCallHook != nil {
+			vm.SetNativeCallHook(options.NativeCallHook)
+		}
+		if options.Debugger != nil {
+			vm.SetDebugger(debuggerHook{options.Debugger})
+		}
+		setWatchpoints(vm, t.globals, options)
+		if options.Allocator != nil {
+			vm.SetAllocator(options.Allocator)
+		}
+		if options.JSONNonFinite != JSONNonFiniteNull {
+			vm.SetJSONNonFinite(runtime.JSONNonFinite(options.JSONNonFinite))
+		}
+		if options.MaxMarkdownSize != 0 || options.MaxMarkdownHTMLSize != 0 {
+			vm.SetMarkdownLimits(options.MaxMarkdownSize, options.MaxMarkdownHTMLSize)
+		}
+	}
+	var fw *flushWriter
+	if options != nil && options.FlushThreshold > 0 {
+		fw = newFlushWriter(out, options.FlushThreshold)
+	}
+	var w io.Writer = out
+	if fw != nil {
+		w = fw
+	}
+	vm.SetRenderer(w, t.conv)
+	if t.markdownHTML != nil {
+		vm.SetMarkdownHTML(t.markdownHTML)
+	}
+	if t.prologue != "" {
+		_, err = io.WriteString(w, t.prologue)
+	}
+	if err == nil {
+		running = true
+		err = vm.Run(t.fn, t.typeof, globals)
+		running = false
+	}
+	if err == nil && t.epilogue != "" {
+		_, err = io.WriteString(w, t.epilogue)
+	}
+	if err == nil && fw != nil && fw.n > 0 {
+		err = fw.Flush()
 	}
-	vm.SetRenderer(out, t.conv)
-	err := vm.Run(t.fn, t.typeof, initGlobalVariables(t.globals, vars))
 	if err != nil {
-		if p, ok := err.(*runtime.PanicError); ok {
-			err = &PanicError{p}
+		switch e := err.(type) {
+		case *runtime.PanicError:
+			err = &PanicError{e}
+			if options != nil && options.PanicHandler != nil {
+				err = options.PanicHandler(out, err.(*PanicError))
+			}
+		case *runtime.OperationLimitError:
+			err = &OperationLimitError{e}
+		case *runtime.MemoryLimitError:
+			err = &MemoryLimitError{e}
+		case *runtime.MarkdownError:
+			err = &MarkdownError{e}
+		case *runtime.InternalError:
+			err = newInternalError(e.Msg, e.Stack)
 		}
 		return err
 	}
 	return nil
 }
 
+// flushWriter wraps the out argument of Run, when the FlushThreshold option
+// is set, and flushes it every time at least threshold bytes have been
+// written since the last flush.
+type flushWriter struct {
+	w         io.Writer
+	flush     func() error
+	threshold int
+	n         int // bytes written since the last flush.
+}
+
+// newFlushWriter returns a new flushWriter that flushes w every threshold
+// bytes. It returns nil if w does not have a Flush method.
+func newFlushWriter(w io.Writer, threshold int) *flushWriter {
+	fw := &flushWriter{w: w, threshold: threshold}
+	switch f := w.(type) {
+	case interface{ Flush() error }:
+		fw.flush = f.Flush
+	case interface{ Flush() }:
+		fw.flush = func() error {
+			f.Flush()
+			return nil
+		}
+	default:
+		return nil
+	}
+	return fw
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.n += n
+	if err == nil && fw.n >= fw.threshold {
+		err = fw.Flush()
+	}
+	return n, err
+}
+
+func (fw *flushWriter) WriteString(s string) (int, error) {
+	n, err := io.WriteString(fw.w, s)
+	fw.n += n
+	if err == nil && fw.n >= fw.threshold {
+		err = fw.Flush()
+	}
+	return n, err
+}
+
+// Flush flushes the wrapped writer.
+func (fw *flushWriter) Flush() error {
+	fw.n = 0
+	return fw.flush()
+}
+
 // Disassemble disassembles a template and returns its assembly code.
 //
 // n determines the maximum length, in runes, of a disassembled text:
@@ -175,6 +479,17 @@ func (t *Template) Disassemble(n int) []byte {
 	return assemblies["main"]
 }
 
+// Tree returns a copy of the tree of the template, with the trees of the
+// extended, imported and rendered files. The returned tree can be freely
+// changed by the caller. It returns nil if the template has not been built
+// with the KeepTree option.
+func (t *Template) Tree() *ast.Tree {
+	if t.tree == nil {
+		return nil
+	}
+	return astutil.CloneTree(t.tree)
+}
+
 // UsedVars returns the names of the global variables used in the template.
 // A variable used in dead code may not be returned as used.
 func (t *Template) UsedVars() []string {
@@ -186,53 +501,182 @@ func (t *Template) UsedVars() []string {
 	return vars
 }
 
-var emptyInit = map[string]interface{}{}
+// InitOrder returns the package-level variables of the template, in the form
+// "path:name", in the order in which they are initialized. Package-level
+// variables are those declared in imported files and in extending files.
+//
+// If the initialization of the variables has a loop, BuildTemplate returns
+// an error that explains the loop.
+func (t *Template) InitOrder() []string {
+	order := make([]string, len(t.initOrder))
+	copy(order, t.initOrder)
+	return order
+}
 
-// initGlobalVariables initializes the global variables and returns their
-// values. It panics if init is not valid.
-func initGlobalVariables(variables []compiler.Global, init map[string]interface{}) []reflect.Value {
-	n := len(variables)
-	if n == 0 {
-		return nil
+// NativeRefs returns the native functions, variables and types referenced by
+// the template, in the form "pkg.name" where pkg is the name of the native
+// package. Globals are in the form "main.name". The returned slice is sorted.
+//
+// Only the references in the code that is emitted are returned.
+func (t *Template) NativeRefs() []string {
+	refs := make([]string, len(t.nativeRefs))
+	copy(refs, t.nativeRefs)
+	return refs
+}
+
+// TransTexts returns the texts of the trans statements of the template,
+// including the extended, imported and rendered files, without duplicates.
+// It can be used to extract the texts to translate. The returned slice is
+// sorted.
+func (t *Template) TransTexts() []string {
+	texts := make([]string, len(t.transTexts))
+	copy(texts, t.transTexts)
+	return texts
+}
+
+// Fingerprint returns a fingerprint of the template, as a hexadecimal
+// string. Two templates have the same fingerprint if they have the same
+// code, the same global variables and the same native references, so the
+// fingerprint can be used as the version of a template in the cache keys.
+//
+// The fingerprint takes into account the build options, as the globals and
+// the prologue and epilogue, but not the Markdown converter. It can change
+// between versions of Scriggo.
+func (t *Template) Fingerprint() string {
+	t.fingerprintOnce.Do(func() {
+		t.fingerprint = fingerprint(t.fn, t.globals, t.nativeRefs, t.markdownHTML, t.prologue, t.epilogue)
+	})
+	return t.fingerprint
+}
+
+// CheckVars checks that the variables with the given types can be passed to
+// Run to initialize the global variables of the template. vars contains the
+// types of the variables indexed by name, as the types of the values of the
+// vars argument of Run.
+//
+// It returns an error if a variable has a type other than the type T of the
+// global variable or *T, or if the global variable is already initialized.
+// Variables not used by the template are ignored.
+//
+// CheckVars can be called once, for example at startup, to check the types
+// of the variables that will be passed to Run.
+func (t *Template) CheckVars(vars map[string]reflect.Type) error {
+	for _, b := range t.vars.bindings {
+		typ, ok := vars[b.name]
+		if !ok {
+			continue
+		}
+		if b.initialized {
+			return fmt.Errorf("variable %q already initialized", b.name)
+		}
+		if typ == nil {
+			return fmt.Errorf("variable initializer %q cannot be nil", b.name)
+		}
+		if typ != b.typ && typ != b.ptr {
+			return fmt.Errorf("variable initializer %q must have type %s or %s, but have %s",
+				b.name, b.typ, b.ptr, typ)
+		}
 	}
-	if init == nil {
-		init = emptyInit
+	return nil
+}
+
+// varsPlan is the plan to bind the values of the vars argument of Run to the
+// global variables of a template. It is computed when the template is built
+// so that Run only iterates over the variables that can be initialized.
+type varsPlan struct {
+	defaults []reflect.Value // values of the initialized global variables.
+	types    []reflect.Type  // types of the global variables.
+	zeros    []int           // indexes of the not initialized global variables.
+	bindings []varBinding    // global variables that can be initialized by vars.
+}
+
+// varBinding is a global variable, of the main package, that can be
+// initialized by the vars argument of Run.
+type varBinding struct {
+	index       int
+	name        string
+	typ         reflect.Type
+	ptr         reflect.Type // pointer to typ.
+	initialized bool
+}
+
+// newVarsPlan returns the plan to bind vars to the global variables.
+func newVarsPlan(variables []compiler.Global) varsPlan {
+	plan := varsPlan{
+		defaults: make([]reflect.Value, len(variables)),
+		types:    make([]reflect.Type, len(variables)),
 	}
-	values := make([]reflect.Value, n)
 	for i, variable := range variables {
+		plan.types[i] = variable.Type
+		initialized := variable.Value.IsValid()
+		if initialized {
+			plan.defaults[i] = variable.Value
+		} else {
+			plan.zeros = append(plan.zeros, i)
+		}
 		if variable.Pkg == "main" {
-			if value, ok := init[variable.Name]; ok {
-				if variable.Value.IsValid() {
-					panic(fmt.Sprintf("variable %q already initialized", variable.Name))
-				}
-				if value == nil {
-					panic(fmt.Sprintf("variable initializer %q cannot be nil", variable.Name))
-				}
-				val := reflect.ValueOf(value)
-				if typ := val.Type(); typ == variable.Type {
-					v := reflect.New(typ).Elem()
-					v.Set(val)
-					values[i] = v
-				} else {
-					if typ.Kind() != reflect.Ptr || typ.Elem() != variable.Type {
-						panic(fmt.Sprintf("variable initializer %q must have type %s or %s, but have %s",
-							variable.Name, variable.Type, reflect.PtrTo(variable.Type), typ))
-					}
-					if val.IsNil() {
-						panic(fmt.Sprintf("variable initializer %q cannot be a nil pointer", variable.Name))
-					}
-					values[i] = reflect.ValueOf(value).Elem()
-				}
+			plan.bindings = append(plan.bindings, varBinding{
+				index:       i,
+				name:        variable.Name,
+				typ:         variable.Type,
+				ptr:         reflect.PtrTo(variable.Type),
+				initialized: initialized,
+			})
+		}
+	}
+	return plan
+}
+
+// bind binds init to the global variables and returns their values. It
+// returns an error if init is not valid.
+func (plan varsPlan) bind(init map[string]interface{}) ([]reflect.Value, error) {
+	n := len(plan.defaults)
+	if n == 0 {
+		return nil, nil
+	}
+	values := make([]reflect.Value, n)
+	copy(values, plan.defaults)
+	if len(init) > 0 {
+		for _, b := range plan.bindings {
+			value, ok := init[b.name]
+			if !ok {
 				continue
 			}
+			if b.initialized {
+				return nil, fmt.Errorf("variable %q already initialized", b.name)
+			}
+			if value == nil {
+				return nil, fmt.Errorf("variable initializer %q cannot be nil", b.name)
+			}
+			val := reflect.ValueOf(value)
+			switch val.Type() {
+			case b.typ:
+				v := reflect.New(b.typ).Elem()
+				v.Set(val)
+				values[b.index] = v
+			case b.ptr:
+				if val.IsNil() {
+					return nil, fmt.Errorf("variable initializer %q cannot be a nil pointer", b.name)
+				}
+				values[b.index] = val.Elem()
+			default:
+				return nil, fmt.Errorf("variable initializer %q must have type %s or %s, but have %s",
+					b.name, b.typ, b.ptr, val.Type())
+			}
 		}
-		if variable.Value.IsValid() {
-			values[i] = variable.Value
-		} else {
-			values[i] = reflect.New(variable.Type).Elem()
+	}
+	for _, i := range plan.zeros {
+		if !values[i].IsValid() {
+			values[i] = reflect.New(plan.types[i]).Elem()
 		}
 	}
-	return values
+	return values, nil
+}
+
+// initGlobalVariables initializes the global variables and returns their
+// values. It returns an error if init is not valid.
+func initGlobalVariables(variables []compiler.Global, init map[string]interface{}) ([]reflect.Value, error) {
+	return newVarsPlan(variables).bind(init)
 }
 
 // HTMLEscape escapes s, replacing the characters <, >, &, " and ' and returns
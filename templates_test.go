@@ -7,6 +7,7 @@ package scriggo
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/open2b/scriggo/ast"
@@ -17,7 +18,10 @@ import (
 func TestInitGlobals(t *testing.T) {
 
 	// Test no globals.
-	globals := initGlobalVariables([]compiler.Global{}, nil)
+	globals, err := initGlobalVariables([]compiler.Global{}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
 	if globals != nil {
 		t.Fatalf("expected nil, got %v", globals)
 	}
@@ -28,7 +32,10 @@ func TestInitGlobals(t *testing.T) {
 		Name: "a",
 		Type: reflect.TypeOf(0),
 	}
-	globals = initGlobalVariables([]compiler.Global{global}, nil)
+	globals, err = initGlobalVariables([]compiler.Global{global}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
 	g := globals[0]
 	if g.Kind() != reflect.Int {
 		t.Fatalf("unexpected kind %v", g.Kind())
@@ -45,7 +52,10 @@ func TestInitGlobals(t *testing.T) {
 		Type:  reflect.TypeOf(n),
 		Value: reflect.ValueOf(&n).Elem(),
 	}
-	globals = initGlobalVariables([]compiler.Global{global}, nil)
+	globals, err = initGlobalVariables([]compiler.Global{global}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
 	n = 2
 	g = globals[0]
 	if g.Kind() != reflect.Int {
@@ -63,7 +73,10 @@ func TestInitGlobals(t *testing.T) {
 		Type: reflect.TypeOf(n),
 	}
 	init := map[string]interface{}{"a": &n}
-	globals = initGlobalVariables([]compiler.Global{global}, init)
+	globals, err = initGlobalVariables([]compiler.Global{global}, init)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
 	if globals == nil {
 		t.Fatalf("unexpected %v, expecting nil", globals)
 	}
@@ -84,7 +97,10 @@ func TestInitGlobals(t *testing.T) {
 		Type: reflect.TypeOf(n),
 	}
 	init = map[string]interface{}{"a": n}
-	globals = initGlobalVariables([]compiler.Global{global}, init)
+	globals, err = initGlobalVariables([]compiler.Global{global}, init)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
 	if globals == nil {
 		t.Fatalf("unexpected %v, expecting nil", globals)
 	}
@@ -99,21 +115,17 @@ func TestInitGlobals(t *testing.T) {
 
 }
 
-func recoverInitGlobalsPanic(t *testing.T, expected string) {
-	got := recover()
-	if got == nil {
-		t.Fatalf("expecting panic")
-	}
-	if _, ok := got.(string); !ok {
-		panic(got)
+func checkInitGlobalsError(t *testing.T, global compiler.Global, init map[string]interface{}, expected string) {
+	_, err := initGlobalVariables([]compiler.Global{global}, init)
+	if err == nil {
+		t.Fatalf("expecting error")
 	}
-	if got.(string) != expected {
-		t.Fatalf("unexpected panic %q, expecting panic %q", got, expected)
+	if err.Error() != expected {
+		t.Fatalf("unexpected error %q, expecting error %q", err, expected)
 	}
 }
 
 func TestInitGlobalsAlreadyInitializedError(t *testing.T) {
-	defer recoverInitGlobalsPanic(t, "variable \"a\" already initialized")
 	n := 2
 	global := compiler.Global{
 		Pkg:   "main",
@@ -122,40 +134,37 @@ func TestInitGlobalsAlreadyInitializedError(t *testing.T) {
 		Value: reflect.ValueOf(&n).Elem(),
 	}
 	init := map[string]interface{}{"a": 5}
-	_ = initGlobalVariables([]compiler.Global{global}, init)
+	checkInitGlobalsError(t, global, init, "variable \"a\" already initialized")
 }
 
 func TestInitGlobalsNilError(t *testing.T) {
-	defer recoverInitGlobalsPanic(t, "variable initializer \"a\" cannot be nil")
 	global := compiler.Global{
 		Pkg:  "main",
 		Name: "a",
 		Type: reflect.TypeOf(0),
 	}
 	init := map[string]interface{}{"a": nil}
-	_ = initGlobalVariables([]compiler.Global{global}, init)
+	checkInitGlobalsError(t, global, init, "variable initializer \"a\" cannot be nil")
 }
 
 func TestInitGlobalsInvalidTypeError(t *testing.T) {
-	defer recoverInitGlobalsPanic(t, "variable initializer \"a\" must have type int or *int, but have bool")
 	global := compiler.Global{
 		Pkg:  "main",
 		Name: "a",
 		Type: reflect.TypeOf(0),
 	}
 	init := map[string]interface{}{"a": true}
-	_ = initGlobalVariables([]compiler.Global{global}, init)
+	checkInitGlobalsError(t, global, init, "variable initializer \"a\" must have type int or *int, but have bool")
 }
 
 func TestInitGlobalsNilPointerError(t *testing.T) {
-	defer recoverInitGlobalsPanic(t, "variable initializer \"a\" cannot be a nil pointer")
 	global := compiler.Global{
 		Pkg:  "main",
 		Name: "a",
 		Type: reflect.TypeOf(0),
 	}
 	init := map[string]interface{}{"a": (*int)(nil)}
-	_ = initGlobalVariables([]compiler.Global{global}, init)
+	checkInitGlobalsError(t, global, init, "variable initializer \"a\" cannot be a nil pointer")
 }
 
 type testFormatFS struct {
@@ -187,3 +196,28 @@ func TestFormatFS(t *testing.T) {
 		}
 	}
 }
+
+// TestBuildTemplateInternalError tests that BuildTemplate returns an
+// *InternalError, instead of panicking, when an unexpected panic occurs.
+func TestBuildTemplateInternalError(t *testing.T) {
+	fsys := fstest.Files{"index.txt": "a"}
+	options := BuildOptions{
+		TreeTransformer: func(tree *ast.Tree) error {
+			panic("transformer bug")
+		},
+	}
+	_, err := BuildTemplate(fsys, "index.txt", &options)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	e, ok := err.(*InternalError)
+	if !ok {
+		t.Fatalf("expected *InternalError, got %T: %s", err, err)
+	}
+	if e.Message() != "transformer bug" {
+		t.Fatalf("expected message %q, got %q", "transformer bug", e.Message())
+	}
+	if !strings.Contains(string(e.Stack()), "TestBuildTemplateInternalError") {
+		t.Fatalf("expected the stack of the panic, got:\n%s", e.Stack())
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package templatetest implements utilities to test templates.
+//
+// RunGolden compares the output of a template with a golden file. Running
+// the tests with the -update flag writes the output to the golden files
+// instead:
+//
+//	go test -update
+package templatetest
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/native"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the templates")
+
+// RunGolden builds the named template file of fsys, runs it and compares its
+// output with the content of the golden file at goldenPath. If they differ,
+// it reports, with t.Fatal, the differing lines. If the -update flag is set,
+// it writes the output to the golden file instead.
+//
+// vars are declared as global variables of the template, with the types of
+// their values, and initialized with their values.
+//
+// The template is run in a deterministic way: the location is UTC and the
+// iterations of the parallel for statements are executed one at a time. The
+// iteration order of a for statement on a map is not deterministic, so the
+// templates should iterate on sorted keys instead.
+func RunGolden(t testing.TB, fsys fs.FS, name string, vars map[string]interface{}, goldenPath string) {
+	t.Helper()
+	got, err := render(fsys, name, vars)
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+		return
+	}
+	if *update {
+		err = os.MkdirAll(filepath.Dir(goldenPath), 0755)
+		if err == nil {
+			err = os.WriteFile(goldenPath, got, 0644)
+		}
+		if err != nil {
+			t.Fatalf("%s: cannot update golden file: %s", name, err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(goldenPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("%s: golden file %s does not exist; run the test with -update to create it", name, goldenPath)
+		} else {
+			t.Fatalf("%s: cannot read golden file: %s", name, err)
+		}
+		return
+	}
+	if !bytes.Equal(got, expected) {
+		t.Fatalf("%s: output differs from golden file %s (-expected +got):\n%s", name, goldenPath, diff(string(expected), string(got)))
+	}
+}
+
+// render builds and runs the named template file of fsys with the given
+// variables and returns its output.
+func render(fsys fs.FS, name string, vars map[string]interface{}) ([]byte, error) {
+	globals := make(native.Declarations, len(vars))
+	for n, v := range vars {
+		if v == nil {
+			return nil, fmt.Errorf("variable %s has a nil value", n)
+		}
+		rv := reflect.ValueOf(v)
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		globals[n] = ptr.Interface()
+	}
+	template, err := scriggo.BuildTemplate(fsys, name, &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, &scriggo.RunOptions{Location: time.UTC, MaxGoroutines: 1})
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// diff returns the differences between the lines of expected and got. The
+// removed lines are prefixed with '-', the added lines with '+' and the
+// common lines with a space. At most three common lines are reported around
+// each difference.
+func diff(expected, got string) string {
+
+	const context = 3
+
+	a := splitLines(expected)
+	b := splitLines(got)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, line{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j]})
+			j++
+		}
+	}
+
+	var s strings.Builder
+	skipped := false
+	for k, l := range lines {
+		if l.op == ' ' {
+			near := false
+			for h := k - context; h <= k+context; h++ {
+				if h >= 0 && h < len(lines) && lines[h].op != ' ' {
+					near = true
+					break
+				}
+			}
+			if !near {
+				if !skipped {
+					s.WriteString("...\n")
+					skipped = true
+				}
+				continue
+			}
+		}
+		skipped = false
+		s.WriteByte(l.op)
+		s.WriteString(strings.TrimSuffix(l.text, "\n"))
+		if !strings.HasSuffix(l.text, "\n") {
+			s.WriteString(" (no newline at end)")
+		}
+		s.WriteByte('\n')
+	}
+	return s.String()
+}
+
+// splitLines splits s after each newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
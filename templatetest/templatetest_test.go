@@ -0,0 +1,94 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package templatetest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open2b/scriggo"
+)
+
+// failRecorder is a testing.TB that records the failures.
+type failRecorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *failRecorder) Helper() {}
+
+func (r *failRecorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+}
+
+func TestRunGolden(t *testing.T) {
+
+	fsys := scriggo.Files{
+		"index.html": []byte("<h1>{{ title }}</h1>\n{% for i := 0; i < 3; i++ %}<p>{{ i }}</p>\n{% end %}"),
+	}
+	vars := map[string]interface{}{"title": "Scriggo"}
+	golden := filepath.Join(t.TempDir(), "golden", "index.html")
+
+	// The golden file does not exist.
+	r := &failRecorder{TB: t}
+	RunGolden(r, fsys, "index.html", vars, golden)
+	expected := "index.html: golden file " + golden + " does not exist; run the test with -update to create it"
+	if r.failure != expected {
+		t.Fatalf("expected failure %q, got %q", expected, r.failure)
+	}
+
+	// Update the golden file.
+	*update = true
+	RunGolden(t, fsys, "index.html", vars, golden)
+	*update = false
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<h1>Scriggo</h1>\n<p>0</p>\n<p>1</p>\n<p>2</p>\n" {
+		t.Fatalf("unexpected golden file content %q", data)
+	}
+
+	// The output is equal to the golden file.
+	RunGolden(t, fsys, "index.html", vars, golden)
+
+	// The output differs from the golden file.
+	r = &failRecorder{TB: t}
+	RunGolden(r, fsys, "index.html", map[string]interface{}{"title": "Go"}, golden)
+	expected = "index.html: output differs from golden file " + golden + " (-expected +got):\n-<h1>Scriggo</h1>\n+<h1>Go</h1>\n <p>0</p>\n <p>1</p>\n <p>2</p>\n"
+	if r.failure != expected {
+		t.Fatalf("expected failure %q, got %q", expected, r.failure)
+	}
+
+	// The template fails to build.
+	r = &failRecorder{TB: t}
+	RunGolden(r, fsys, "index.html", nil, golden)
+	expected = "index.html: index.html:1:8: undefined: title"
+	if r.failure != expected {
+		t.Fatalf("expected failure %q, got %q", expected, r.failure)
+	}
+
+}
+
+var diffTests = []struct {
+	expected, got string
+	diff          string
+}{
+	{"a\n", "b\n", "-a\n+b\n"},
+	{"a\nb\n", "a\nb", " a\n-b\n+b (no newline at end)\n"},
+	{"a\nb\nc\nd\ne\nf\ng\n", "a\nb\nc\nd\ne\nf\nh\n", "...\n d\n e\n f\n-g\n+h\n"},
+	{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\ny\n", "-1\n+x\n 2\n 3\n 4\n...\n 7\n 8\n 9\n-10\n+y\n"},
+}
+
+func TestDiff(t *testing.T) {
+	for _, test := range diffTests {
+		got := diff(test.expected, test.got)
+		if got != test.diff {
+			t.Errorf("diff(%q, %q): expected %q, got %q", test.expected, test.got, test.diff, got)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+// errorcheck
+
+package main
+
+type List[T any] []T // ERROR `generic types are not supported in this release of Scriggo`
+
+func main() {}
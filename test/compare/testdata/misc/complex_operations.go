@@ -0,0 +1,48 @@
+// run
+
+package main
+
+import "fmt"
+
+type C complex64
+
+func square(x complex128) complex128 { return x * x }
+
+func main() {
+
+	x := 5 + 0i
+	x -= 1
+	x /= 2i
+	fmt.Println(x)
+
+	var c C = 1 + 2i
+	d := c * c
+	d -= c
+	e := -d
+	fmt.Println(complex64(d), complex64(e))
+
+	m := map[string]complex128{"a": 1i}
+	m["a"] *= 3
+	m["a"] += square(2 + 1i)
+	fmt.Println(m["a"])
+
+	var i interface{} = x + 1
+	fmt.Println(i)
+
+	a := [2]complex64{1, 2i}
+	a[1] /= a[0] - 3i
+	fmt.Println(a, -a[1], real(-a[1]))
+
+	const k = (1 + 2i) * (3 - 1i) / (2 + 0.5i)
+	fmt.Println(k, real(k), imag(k))
+
+	var z complex64
+	fmt.Println(a[0]/z, 1/z)
+
+	p := &x
+	*p = -*p + x*x
+	fmt.Println(x, *p, x == -x, x != 0)
+
+	f32 := complex64(complex(1.1, 2.2))
+	fmt.Println(f32*f32, f32/3, complex128(f32)*complex128(f32))
+}
@@ -0,0 +1,65 @@
+// run
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Number interface {
+	~int | ~float64
+}
+
+
+func Map[T, U any](s []T, f func(T) U) []U {
+	r := make([]U, 0, len(s))
+	for _, v := range s {
+		r = append(r, f(v))
+	}
+	return r
+}
+
+func Sum[T Number](s ...T) T {
+	var t T
+	for _, v := range s {
+		t += v
+	}
+	return t
+}
+
+func Keys[K comparable, V any](m map[K]V) int {
+	return len(m)
+}
+
+func Max[T int | float64 | string](a, b T) T {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func Fact[T Number](n T) T {
+	if n <= 1 {
+		return 1
+	}
+	return n * Fact(n-1)
+}
+
+func First[S ~[]E, E any](s S) E {
+	return s[0]
+}
+
+type Ints []int
+
+func main() {
+	fmt.Println(Map([]int{1, 2, 3}, strconv.Itoa))
+	fmt.Println(Sum(1, 2, 3), Sum(1.5, 2), Sum[int](4, 5))
+	fmt.Println(Keys(map[string]bool{"a": true}))
+	fmt.Println(Max("a", "b"), Max(3, 2.5))
+	f := Map[string, int]
+	fmt.Println(f([]string{"a", "bb"}, func(s string) int { return len(s) }))
+	fmt.Println(Fact(5), Fact(5.0))
+	fmt.Println(First(Ints{7, 8}))
+	defer fmt.Println(Sum(1, 2))
+}
@@ -0,0 +1,72 @@
+// run
+
+package main
+
+import "fmt"
+
+var strings = []string{
+	"",
+	"abc",
+	"aé€😀",
+	"\x80",
+	"a\xffb",
+	"\xc3",
+	"\xc3a",
+	"\xe2\x82",
+	"\xe2\x82c",
+	"\xf0\x9f\x98",
+	"\xf0\x9f\x98c",
+	"\xc0\x80",
+	"\xc1\xbf",
+	"\xe0\x80\x80",
+	"\xed\xa0\x80",
+	"\xed\x9f\xbf",
+	"\xf4\x8f\xbf\xbf",
+	"\xf4\x90\x80\x80",
+	"\xf8\x88\x80\x80\x80",
+	"é\x80\x80€\xff😀\xe2",
+}
+
+func main() {
+
+	for _, s := range strings {
+		fmt.Printf("%q:", s)
+		for i, r := range s {
+			fmt.Printf(" %d:%U", i, r)
+		}
+		fmt.Println()
+	}
+
+	// Range with only the index.
+	for _, s := range strings {
+		n := 0
+		for i := range s {
+			n += i
+		}
+		fmt.Print(n, " ")
+	}
+	fmt.Println()
+
+	// Range with only the rune.
+	for _, s := range strings {
+		var rs []rune
+		for _, r := range s {
+			rs = append(rs, r)
+		}
+		fmt.Print(len(rs), string(rs) == string([]rune(s)), " ")
+	}
+	fmt.Println()
+
+	// Break and continue after an invalid byte.
+	for i, r := range "a\xffb\xffc" {
+		if r == 'b' {
+			continue
+		}
+		if i == 3 {
+			break
+		}
+		fmt.Print(i, " ", r, " ")
+	}
+	fmt.Println()
+
+}
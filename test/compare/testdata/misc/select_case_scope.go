@@ -0,0 +1,22 @@
+// run
+
+package main
+
+import "fmt"
+
+func main() {
+	m := "outer"
+	c1 := make(chan string, 1)
+	c2 := make(chan string, 1)
+	c1 <- "one"
+	for i := 0; i < 2; i++ {
+		select {
+		case m := <-c1:
+			fmt.Println(m)
+			c2 <- "two"
+		case m := <-c2:
+			fmt.Println(m)
+		}
+	}
+	fmt.Println(m)
+}
@@ -0,0 +1,188 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package misc
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/internal/fstest"
+)
+
+// differentialSeed is the seed used to generate the programs of the
+// differential test. It can be changed with the SCRIGGO_DIFF_SEED
+// environment variable.
+const differentialSeed = 1
+
+// TestDifferential tests that randomly generated programs print the same
+// output, and panic in the same way, when they are run by Scriggo and when
+// they are compiled by gc. It is skipped in short mode and if the go command
+// is not available.
+func TestDifferential(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not available")
+	}
+	seed := int64(differentialSeed)
+	if s := os.Getenv("SCRIGGO_DIFF_SEED"); s != "" {
+		_, err = fmt.Sscan(s, &seed)
+		if err != nil {
+			t.Fatalf("invalid SCRIGGO_DIFF_SEED: %s", err)
+		}
+	}
+	g := &programGenerator{rand: rand.New(rand.NewSource(seed))}
+	src := g.program(50)
+
+	// Run the program with gc.
+	dir := t.TempDir()
+	err = os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(goCmd, "run", "main.go")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=off")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		t.Fatalf("cannot run the program with gc: %s\n%s", err, stderr.String())
+	}
+	expected := stderr.String()
+
+	// Run the program with Scriggo.
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected build error: %s\n%s", err, src)
+	}
+	var b bytes.Buffer
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected run error: %s", err)
+	}
+
+	// Compare the outputs.
+	got := b.String()
+	if got != expected {
+		expectedLines := strings.Split(expected, "\n")
+		gotLines := strings.Split(got, "\n")
+		for i, line := range expectedLines {
+			var gotLine string
+			if i < len(gotLines) {
+				gotLine = gotLines[i]
+			}
+			if gotLine != line {
+				fn := strings.SplitN(line, ":", 2)[0]
+				t.Fatalf("seed %d: function %s: expected %q, got %q\n%s", seed, fn, line, gotLine, g.funcs[fn])
+			}
+		}
+		t.Fatalf("seed %d: expected output %q, got %q", seed, expected, got)
+	}
+}
+
+// differentialTypes are the types of the variables of the generated
+// functions.
+var differentialTypes = []string{
+	"int", "int8", "int16", "int32", "int64",
+	"uint", "uint8", "uint16", "uint32", "uint64",
+}
+
+// programGenerator generates random programs for the differential test.
+type programGenerator struct {
+	rand  *rand.Rand
+	b     strings.Builder
+	funcs map[string]string // source of the generated functions.
+}
+
+// program returns a program with n random functions, called in sequence by
+// the main function. Every function prints the values of its variables or,
+// if it panics, the recovered error.
+func (g *programGenerator) program(n int) string {
+	g.funcs = map[string]string{}
+	var src strings.Builder
+	src.WriteString("package main\n\nfunc main() {\n")
+	for i := 0; i < n; i++ {
+		_, _ = fmt.Fprintf(&src, "\tf%d()\n", i)
+	}
+	src.WriteString("}\n")
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("f%d", i)
+		g.funcs[name] = g.function(name)
+		src.WriteString("\n")
+		src.WriteString(g.funcs[name])
+	}
+	return src.String()
+}
+
+// function returns a random function with the given name.
+func (g *programGenerator) function(name string) string {
+	g.b.Reset()
+	typ := differentialTypes[g.rand.Intn(len(differentialTypes))]
+	_, _ = fmt.Fprintf(&g.b, "func %s() {\n", name)
+	_, _ = fmt.Fprintf(&g.b, "\tdefer func() {\n\t\tif r := recover(); r != nil {\n")
+	_, _ = fmt.Fprintf(&g.b, "\t\t\tprint(%q, r.(error).Error(), \"\\n\")\n\t\t}\n\t}()\n", name+": panic: ")
+	for i := 0; i < 4; i++ {
+		v := g.rand.Intn(200)
+		if typ[0] == 'i' {
+			v -= 100
+		}
+		_, _ = fmt.Fprintf(&g.b, "\tv%d := %s(%d)\n", i, typ, v)
+	}
+	for i, n := 0, 3+g.rand.Intn(4); i < n; i++ {
+		g.statement()
+	}
+	_, _ = fmt.Fprintf(&g.b, "\tprint(%q, v0, \" \", v1, \" \", v2, \" \", v3, \"\\n\")\n", name+": ")
+	g.b.WriteString("}\n")
+	return g.b.String()
+}
+
+// statement writes a random statement.
+func (g *programGenerator) statement() {
+	v := g.rand.Intn(4)
+	switch g.rand.Intn(4) {
+	case 0:
+		_, _ = fmt.Fprintf(&g.b, "\tv%d = %s\n", v, g.expr(3))
+	case 1:
+		ops := []string{"+=", "-=", "*=", "|=", "^=", "&="}
+		_, _ = fmt.Fprintf(&g.b, "\tv%d %s %s\n", v, ops[g.rand.Intn(len(ops))], g.expr(2))
+	case 2:
+		_, _ = fmt.Fprintf(&g.b, "\tfor i := 0; i < %d; i++ {\n\t\tv%d = %s\n\t}\n", 1+g.rand.Intn(5), v, g.expr(2))
+	case 3:
+		cmps := []string{"==", "!=", "<", "<=", ">", ">="}
+		_, _ = fmt.Fprintf(&g.b, "\tif %s %s %s {\n\t\tv%d = %s\n\t} else {\n\t\tv%d = %s\n\t}\n",
+			g.expr(1), cmps[g.rand.Intn(len(cmps))], g.expr(1), v, g.expr(2), v, g.expr(2))
+	}
+}
+
+// expr returns a random expression with the given maximum depth. The
+// expressions contain only variables, so they are never constant.
+func (g *programGenerator) expr(depth int) string {
+	if depth == 0 || g.rand.Intn(4) == 0 {
+		return fmt.Sprintf("v%d", g.rand.Intn(4))
+	}
+	x, y := g.expr(depth-1), g.expr(depth-1)
+	switch g.rand.Intn(12) {
+	case 0:
+		return "(-" + x + ")"
+	case 1:
+		return "(^" + x + ")"
+	case 2:
+		return fmt.Sprintf("(%s << (uint(%s) %% 16))", x, y)
+	case 3:
+		return fmt.Sprintf("(%s >> (uint(%s) %% 16))", x, y)
+	}
+	ops := []string{"+", "-", "*", "/", "%", "&", "|", "^", "&^"}
+	return fmt.Sprintf("(%s %s %s)", x, ops[g.rand.Intn(len(ops))], y)
+}
@@ -9,10 +9,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/open2b/scriggo"
+	"github.com/open2b/scriggo/builtin"
 	"github.com/open2b/scriggo/internal/fstest"
 	"github.com/open2b/scriggo/native"
 
@@ -219,3 +223,189 @@ func TestStopWithExit(t *testing.T) {
 		t.Fatalf("expected exit error, got %q", err)
 	}
 }
+
+// TestLocale tests the Locale method of native.LocaleEnv and the compile
+// time checking of the native.Number parameters.
+func TestLocale(t *testing.T) {
+	fsys := fstest.Files{"index.txt": `{{ locale() }} {{ formatNumber(1234.5, 2) }} {{ formatNumber(int8(-5), 0) }} {{ formatCurrency(3, "EUR") }}`}
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"locale":         func(env native.Env) string { return env.(native.LocaleEnv).Locale() },
+			"formatNumber":   builtin.FormatNumber,
+			"formatCurrency": builtin.FormatCurrency,
+		},
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		locale   string
+		expected string
+	}{
+		{"", " 1,234.50 -5 €3.00"},
+		{"it-IT", "it-IT 1.234,50 -5 3,00\u00a0€"},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		err = template.Run(&b, nil, &scriggo.RunOptions{Locale: test.locale})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("locale %q: expected %q, got %q", test.locale, test.expected, b.String())
+		}
+	}
+	// Non-numeric values.
+	for _, src := range []string{`{{ formatNumber("5", 2) }}`, `{{ formatCurrency(true, "EUR") }}`, `{{ formatNumber(v, 2) }}`} {
+		fsys := fstest.Files{"index.txt": `{% var v interface{} = 5 %}` + src}
+		_, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+		if err == nil {
+			t.Fatalf("%s: expected error, got no error", src)
+		}
+		if !strings.Contains(err.Error(), "as type native.Number in argument to") {
+			t.Fatalf("%s: unexpected error %q", src, err)
+		}
+	}
+}
+
+// TestLocation tests the Location method of native.LocationEnv and the
+// compile time validation of constant layouts.
+func TestLocation(t *testing.T) {
+	loc := time.FixedZone("XYZ", 2*60*60)
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"formatDate": builtin.FormatDate,
+		},
+	}
+	fsys := fstest.Files{"index.txt": `{{ formatDate("2021-03-27T11:21:14Z", "15:04 MST") }}`}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, &scriggo.RunOptions{Location: loc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "13:21 XYZ"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	fsys = fstest.Files{"index.txt": `{{ formatDate("2021-03-27T11:21:14Z", "YYYY-MM-DD") }}`}
+	_, err = scriggo.BuildTemplate(fsys, "index.txt", opts)
+	expected := `index.txt:1:14: invalid layout "YYYY-MM-DD": it does not contain any element of the reference time Mon Jan 2 15:04:05 MST 2006`
+	if err == nil {
+		t.Fatalf("expected error %q, got no error", expected)
+	}
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+}
+
+// TestRepeat tests the calls to the builtin.Repeat function.
+func TestRepeat(t *testing.T) {
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"repeat": builtin.Repeat,
+		},
+	}
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{{ repeat("-", 3) }}`, "---"},
+		{`{{ repeat("ab", 0) }}`, ""},
+		{`{% n := 2 %}{{ repeat("ab", n) }}`, "abab"},
+		{`{% s := "x" %}{{ repeat(s, 5) }}`, "xxxxx"},
+		{`{{ repeat("-", 5000) == repeat("-", 5000) }}`, "true"},
+	}
+	for _, test := range tests {
+		fsys := fstest.Files{"index.txt": test.src}
+		template, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+		if err != nil {
+			t.Fatalf("%s: %s", test.src, err)
+		}
+		var b bytes.Buffer
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", test.src, err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("%s: expected %q, got %q", test.src, test.expected, b.String())
+		}
+	}
+	// Negative constant count.
+	fsys := fstest.Files{"index.txt": `{{ repeat("-", -1) }}`}
+	_, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+	expected := "index.txt:1:16: invalid argument: negative count -1 in call to repeat"
+	if err == nil {
+		t.Fatalf("expected error %q, got no error", expected)
+	}
+	if err.Error() != expected {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+	// Negative count.
+	fsys = fstest.Files{"index.txt": `{% n := -1 %}{{ repeat("-", n) }}`}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(io.Discard, nil, nil)
+	if err == nil {
+		t.Fatal("expected error, got no error")
+	}
+	if !strings.Contains(err.Error(), "strings: negative Repeat count") {
+		t.Fatalf("unexpected error %q", err)
+	}
+	// Memory limit.
+	for _, src := range []string{`{% s := repeat("x", 200000000) %}`, `{% n := 200000000 %}{% s := repeat("x", n) %}`} {
+		fsys = fstest.Files{"index.txt": src + `{{ len(s) }}`}
+		template, err = scriggo.BuildTemplate(fsys, "index.txt", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = template.Run(io.Discard, nil, &scriggo.RunOptions{MemoryLimit: 1 << 20})
+		if _, ok := err.(*scriggo.MemoryLimitError); !ok {
+			t.Fatalf("%s: expected *scriggo.MemoryLimitError, got %T: %v", src, err, err)
+		}
+	}
+}
+
+func TestPrintfFormatCheck(t *testing.T) {
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{
+			"printf": builtin.Printf,
+		},
+	}
+	fsys := fstest.Files{"index.html": `{% n := 3 %}{{ printf("%d < %s", n, "<b>") }}`}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "3 &lt; &lt;b&gt;"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`{{ printf("%d", "a") }}`, `index.txt:1:11: format %d has arg #1 of wrong type string`},
+		{`{{ printf("%s %s", 1.5) }}`, `index.txt:1:11: format %s has arg #1 of wrong type float64`},
+		{`{% var v interface{} %}{{ printf("%d %d", v) }}`, `index.txt:1:34: format %d reads arg #2, but call has 1 arg`},
+	}
+	for _, test := range tests {
+		fsys = fstest.Files{"index.txt": test.src}
+		_, err = scriggo.BuildTemplate(fsys, "index.txt", opts)
+		if err == nil {
+			t.Fatalf("expected error %q, got no error", test.err)
+		}
+		if err.Error() != test.err {
+			t.Fatalf("expected error %q, got %q", test.err, err)
+		}
+	}
+}
@@ -5,8 +5,14 @@
 package misc
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/fs"
+	"math/bits"
 	"reflect"
 	"strings"
 	"testing"
@@ -450,6 +456,68 @@ func TestImportPackageName2(t *testing.T) {
 	}
 }
 
+// TestImportABIVersion tests that importing a native package generated for
+// another ABI version results in a build error.
+func TestImportABIVersion(t *testing.T) {
+	fsys := fstest.Files{
+		"main.go": `package main; import "a.b/p"; func main() { p.F() }`,
+	}
+	options := &scriggo.BuildOptions{
+		Packages: native.Packages{
+			"a.b/p": native.VersionedPackage{
+				Package: native.Package{
+					Name:         "p",
+					Declarations: native.Declarations{"F": func() {}},
+				},
+				ABI: native.ABIVersion + 1,
+			},
+		},
+	}
+	_, err := scriggo.Build(fsys, options)
+	if err == nil {
+		t.Fatalf("expected error, got no error")
+	}
+	if err, ok := err.(*scriggo.BuildError); ok {
+		if msg := err.Message(); !strings.HasPrefix(msg, `cannot import "a.b/p": package p has been generated for ABI version`) {
+			t.Fatalf("unexpected error %q", msg)
+		}
+	} else {
+		t.Fatalf("expected a *scriggo.BuildError, got %T", err)
+	}
+	options.Packages.(native.Packages)["a.b/p"] = native.VersionedPackage{
+		Package: native.Package{
+			Name:         "p",
+			Declarations: native.Declarations{"F": func() {}},
+		},
+		ABI: native.ABIVersion,
+	}
+	_, err = scriggo.Build(fsys, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	// Auto-imported packages.
+	old := native.VersionedPackage{
+		Package: native.Package{Name: "p", Declarations: native.Declarations{"F": func() {}}},
+		ABI:     native.ABIVersion + 1,
+	}
+	tfsys := fstest.Files{"index.html": `{% import "a.b/q" %}{{ p.F() }}`}
+	_, err = scriggo.BuildTemplate(tfsys, "index.html", &scriggo.BuildOptions{
+		Globals: native.Declarations{"p": old},
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "scriggo: cannot import p: package p has been generated for ABI version") {
+		t.Fatalf("expected ABI version error, got %v", err)
+	}
+	_, err = scriggo.BuildTemplate(tfsys, "index.html", &scriggo.BuildOptions{
+		Packages: native.Packages{"a.b/q": native.Package{Name: "q", Declarations: native.Declarations{"p": old}}},
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot import p: package p has been generated for ABI version") {
+		t.Fatalf("expected ABI version error, got %v", err)
+	}
+	if _, ok := err.(*scriggo.BuildError); !ok {
+		t.Fatalf("expected a *scriggo.BuildError, got %T", err)
+	}
+}
+
 func TestIssue523(t *testing.T) {
 	// See https://github.com/open2b/scriggo/issues/523.
 	src := `package main
@@ -552,3 +620,1364 @@ func TestIssue855(t *testing.T) {
 		t.Fatalf("expected error %q, got %q", expectedErr, gotErr)
 	}
 }
+
+// TestIntSize tests the IntSize build option.
+func TestIntSize(t *testing.T) {
+	src := `package main
+
+	func main() {
+		x := 2147483647
+		x++
+		var u uint
+		u--
+		var z int64 = 1<<40 + 5
+		m := 65536
+		m *= m
+		print(x, " ", u, " ", int(z), " ", m)
+	}`
+	fsys := fstest.Files{"main.go": src}
+	tests := []struct {
+		size     int
+		expected string
+	}{
+		{0, "2147483648 18446744073709551615 1099511627781 4294967296"},
+		{64, "2147483648 18446744073709551615 1099511627781 4294967296"},
+		{32, "-2147483648 4294967295 5 0"},
+	}
+	for _, test := range tests {
+		program, err := scriggo.Build(fsys, &scriggo.BuildOptions{IntSize: test.size})
+		if err != nil {
+			t.Fatalf("size %d: unexpected error: %s", test.size, err)
+		}
+		var b strings.Builder
+		err = program.Run(&scriggo.RunOptions{Print: func(v interface{}) { b.WriteString(fmt.Sprint(v)) }})
+		if err != nil {
+			t.Fatalf("size %d: unexpected error: %s", test.size, err)
+		}
+		if got := b.String(); got != test.expected {
+			t.Fatalf("size %d: expected %q, got %q", test.size, test.expected, got)
+		}
+	}
+	errorTests := []struct {
+		src string
+		msg string
+	}{
+		{`package main; func main() { var x int = 1 << 31; _ = x }`, "constant 2147483648 overflows int"},
+		{`package main; func main() { const c uint = 1 << 32; _ = c }`, "constant 4294967296 overflows uint"},
+		{`package main; func main() { var s []int; _ = s[1<<31] }`, "constant 2147483648 overflows int"},
+	}
+	for _, test := range errorTests {
+		_, err := scriggo.Build(fstest.Files{"main.go": test.src}, &scriggo.BuildOptions{IntSize: 32})
+		if err == nil {
+			t.Fatalf("expected error %q, got no error", test.msg)
+		}
+		if err, ok := err.(*scriggo.BuildError); !ok || err.Message() != test.msg {
+			t.Fatalf("expected error %q, got %q", test.msg, err)
+		}
+	}
+	_, err := scriggo.Build(fsys, &scriggo.BuildOptions{IntSize: 16})
+	if err == nil || err.Error() != "scriggo: invalid IntSize 16" {
+		t.Fatalf("expected invalid IntSize error, got %v", err)
+	}
+}
+
+// TestPrintTo tests the PrintTo function.
+func TestPrintTo(t *testing.T) {
+	src := `package main
+
+	func main() {
+		print(1.5, " ", true)
+		println(-3, "a")
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "+1.500000e+000 true-3 a\n"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestAssignmentOperandsEvaluatedOnce tests that the operands of the
+// assignment operations and of the increment and decrement statements are
+// evaluated only once and in the Go order.
+func TestAssignmentOperandsEvaluatedOnce(t *testing.T) {
+	src := `package main
+
+	type T struct{ A int }
+
+	var log string
+
+	func f(s string, v int) int {
+		log += s
+		return v
+	}
+
+	func main() {
+		m := map[int]int{}
+		m[f("a", 1)] += f("b", 2)
+		m[f("c", 1)]++
+		s := []int{0, 0}
+		s[f("d", 1)] -= f("e", 3)
+		s[f("f", 1)]--
+		var a [2]T
+		a[f("g", 0)].A += f("h", 4)
+		p := &T{}
+		[]*T{p}[f("i", 0)].A++
+		*[]*int{&s[0]}[f("j", 0)] += f("k", 5)
+		print(log, " ", m[1], " ", s[0], " ", s[1], " ", a[0].A, " ", p.A)
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "abcdefghijk 3 5 -4 4 1"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestMultipleAssignmentOrder tests that a multiple assignment evaluates
+// the operands on the left and the expressions on the right before assigning
+// the values from left to right.
+func TestMultipleAssignmentOrder(t *testing.T) {
+	src := `package main
+
+	type T struct{ A int }
+
+	var gi int
+	var gs = []int{0, 0}
+	var gm = map[string]int{}
+	var gp = &T{1}
+
+	func main() {
+		a, b := 1, 2
+		a, b = b, a+b
+		println(a, b)
+		i, s := 0, []int{0, 0}
+		i, s[i] = 1, 2
+		s[i], i = 3, 0
+		println(i, s[0], s[1])
+		k, m := "a", map[string]int{}
+		k, m[k] = "b", 1
+		println(k, m["a"], m["b"])
+		p := &T{1}
+		q := p
+		p, p.A = &T{5}, 3
+		println(p.A, q.A)
+		str := "x"
+		ps := &str
+		ps, *ps = new(string), "y"
+		println(str, *ps == "")
+		gi, gs[gi] = 1, 2
+		println(gi, gs[0], gs[1])
+		om, op, os := gm, gp, gs
+		gm, gm["a"] = map[string]int{}, 1
+		gp, gp.A = &T{5}, 3
+		gs, gs[1] = []int{9}, 7
+		println(len(gm), om["a"], gp.A, op.A, len(gs), os[1])
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "2 3\n0 2 3\nb 1 0\n5 3\ny true\n1 2 0\n0 1 5 3 1 7\n"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestSliceToArrayConversion tests the conversions of slices to arrays and
+// to array pointers.
+func TestSliceToArrayConversion(t *testing.T) {
+	src := `package main
+
+	func main() {
+		s := []byte{1, 2, 3, 4, 5}
+		p := (*[4]byte)(s)
+		a := [4]byte(s)
+		p[0] = 9
+		(*p)[1] = 8
+		a[2] = 7
+		println(s[0], s[1], s[2], a[0], a[2], len(p))
+		func() {
+			defer func() {
+				r := recover()
+				println(r.(error).Error())
+			}()
+			_ = [4]byte(s[:2])
+		}()
+		_ = (*[4]byte)(s[:3])
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err == nil {
+		t.Fatal("expected error, got no error")
+	}
+	if expected := "runtime error: cannot convert slice with length 3 to array or pointer to array with length 4"; !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error %q, got %q", expected, err)
+	}
+	expected := "9 8 3 1 7 4\nruntime error: cannot convert slice with length 2 to array or pointer to array with length 4\n"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestGenerics(t *testing.T) {
+	src := `package main
+
+	type Number interface {
+		~int | ~float64
+	}
+
+	type MyInt int
+
+	func Map[T, U any](s []T, f func(T) U) []U {
+		r := make([]U, 0, len(s))
+		for _, v := range s {
+			r = append(r, f(v))
+		}
+		return r
+	}
+
+	func Sum[T Number](s ...T) T {
+		var t T
+		for _, v := range s {
+			t += v
+		}
+		return t
+	}
+
+	func Max[T int | float64 | string](a, b T) T {
+		if a > b {
+			return a
+		}
+		return b
+	}
+
+	func Fact[T Number](n T) T {
+		if n <= 1 {
+			return 1
+		}
+		return n * Fact(n-1)
+	}
+
+	func First[S ~[]E, E any](s S) E {
+		return s[0]
+	}
+
+	type Ints []int
+
+	func main() {
+		l := Map([]int{1, 2, 3}, func(n int) string { return string(rune('a' + n)) })
+		println(len(l), l[0], l[2])
+		println(Sum(1, 2, 3), Sum(1.5, 2), int(Sum[MyInt](4, 5)))
+		println(Max("a", "b"), Max(3, 2.5))
+		f := Map[string, int]
+		println(f([]string{"a", "bb"}, func(s string) int { return len(s) })[1])
+		println(Fact(5), Fact(5.0))
+		println(First(Ints{7, 8}))
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "3 b d\n6 +3.500000e+000 9\nb +3.000000e+000\n2\n120 +1.200000e+002\n7\n"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	// Generic functions declared in another package.
+	fsys := fstest.Files{
+		"go.mod":  "module a.b\ngo 1.18",
+		"main.go": `package main; import "a.b/p"; func main() { f := p.Sum[int]; println(p.Sum(1, 2), f(3)) }`,
+		"p/p.go":  `package p; func Sum[T ~int](s ...T) T { var t T; for _, v := range s { t += double(v) }; return t }; func double[T ~int](v T) T { return v * 2 }`,
+	}
+	program, err = scriggo.Build(fsys, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b.Reset()
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := b.String(); got != "6 6\n" {
+		t.Fatalf("expected %q, got %q", "6 6\n", got)
+	}
+}
+
+func TestGenericsErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{"func F[T, U any](x T) {}\nfunc main() { F(1) }", "main:3:16: in call to F, cannot infer U"},
+		{"func F[T, U any](x T) {}\nfunc main() { F[int, int, int](1) }", "main:3:27: got 3 type arguments but want 2"},
+		{"func F[T any](x T) {}\nfunc main() { f := F; _ = f }", "main:3:20: cannot use generic function F without instantiation"},
+		{"type N interface{ ~int | ~float64 }\nfunc F[T N](x T) {}\nfunc main() { F(\"a\") }", "main:4:16: string does not satisfy N (string missing in ~int | ~float64)"},
+		{"func F[T comparable](x T) {}\nfunc main() { F([]int{}) }", "main:3:16: []int does not satisfy comparable"},
+		{"type N interface{ ~int }\nfunc main() { var n N; _ = n }", "main:3:21: cannot use type N outside a type constraint: interface contains type constraints"},
+		{"func F[T any](a, b T) {}\nfunc main() { F(1, \"a\") }", "main:3:16: in call to F, mismatched types untyped int and untyped string (cannot infer T)"},
+		{"func F[T any](x T) { F([]T{x}) }\nfunc main() { F(1) }", "main:2:23: instantiation cycle"},
+	}
+	for _, test := range tests {
+		src := "package main\n" + test.src
+		_, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err == nil {
+			t.Errorf("source %q: expected error %q, got no error", test.src, test.err)
+			continue
+		}
+		if err.Error() != test.err {
+			t.Errorf("source %q: expected error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
+
+// TestIntrinsics tests that the calls to the functions of math/bits and to
+// the methods of binary.BigEndian and binary.LittleEndian are emitted as
+// dedicated instructions, with the same results of the native calls.
+func TestIntrinsics(t *testing.T) {
+	packages := native.Packages{
+		"math/bits": native.Package{
+			Name: "bits",
+			Declarations: native.Declarations{
+				"LeadingZeros":   bits.LeadingZeros,
+				"LeadingZeros8":  bits.LeadingZeros8,
+				"LeadingZeros32": bits.LeadingZeros32,
+				"OnesCount16":    bits.OnesCount16,
+				"OnesCount64":    bits.OnesCount64,
+				"RotateLeft8":    bits.RotateLeft8,
+				"RotateLeft32":   bits.RotateLeft32,
+			},
+		},
+		"encoding/binary": native.Package{
+			Name: "binary",
+			Declarations: native.Declarations{
+				"BigEndian":    &binary.BigEndian,
+				"LittleEndian": &binary.LittleEndian,
+			},
+		},
+	}
+	src := `package main
+
+	import (
+		"encoding/binary"
+		"math/bits"
+	)
+
+	func main() {
+		x := uint32(0x00f0000f)
+		var b8 uint8 = 0x81
+		k := -4
+		println(bits.LeadingZeros(1), bits.LeadingZeros8(b8), bits.LeadingZeros32(x))
+		println(bits.OnesCount16(0xffff), bits.OnesCount64(uint64(x)))
+		println(bits.RotateLeft8(b8, 1), bits.RotateLeft32(x, k), bits.RotateLeft32(x, 8), x)
+		lz := bits.LeadingZeros32
+		println(lz(x))
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b, 0x01020304)
+		binary.LittleEndian.PutUint16(b[4:], uint16(x))
+		println(b[0], b[1], b[2], b[3], b[4], b[5])
+		println(binary.BigEndian.Uint16(b), binary.LittleEndian.Uint32(b), binary.BigEndian.Uint64(b))
+		be := binary.BigEndian
+		println(be.Uint32(b[2:]))
+		defer func() {
+			r := recover()
+			println(r.(error).Error())
+		}()
+		binary.LittleEndian.Uint64(b[4:])
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	asm, err := program.Disassemble("main")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, name := range []string{"LeadingZeros", "OnesCount", "RotateLeft", "LoadBigEndian",
+		"LoadLittleEndian", "StoreBigEndian", "StoreLittleEndian"} {
+		if !strings.Contains(string(asm), "\t"+name+" ") {
+			t.Fatalf("expected instruction %s, got no instruction", name)
+		}
+	}
+	if strings.Contains(string(asm), "Call bits.") || strings.Contains(string(asm), "Call .") {
+		t.Fatalf("expected no native calls, got:\n%s", asm)
+	}
+	var out strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&out)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b [8]byte
+	func() {
+		defer func() {
+			r := recover()
+			err = r.(error)
+		}()
+		binary.LittleEndian.Uint64(b[4:])
+	}()
+	expected := fmt.Sprintf("%d 0 8\n16 8\n3 4027514880 4026535680 15728655\n8\n1 2 3 4 15 0\n258 67305985 72623859957760000\n50597632\n%s\n",
+		bits.UintSize-1, err)
+	if got := out.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestTypesRegistry tests that builds sharing a types registry produce the
+// same types for the same type declarations.
+func TestTypesRegistry(t *testing.T) {
+	var value interface{}
+	packages := native.Packages{
+		"shared": native.Package{
+			Name: "shared",
+			Declarations: native.Declarations{
+				"Value": &value,
+			},
+		},
+	}
+	src := `package main
+
+	import "shared"
+
+	type T struct{ A int }
+
+	func main() {
+		if shared.Value == nil {
+			shared.Value = T{5}
+			return
+		}
+		v, ok := shared.Value.(T)
+		println(v.A, ok)
+	}`
+	fsys := fstest.Files{"main.go": src}
+	tests := []struct {
+		registry *scriggo.TypesRegistry
+		expected string
+	}{
+		{nil, "0 false\n"},
+		{scriggo.NewTypesRegistry(), "5 true\n"},
+	}
+	for _, test := range tests {
+		value = nil
+		opts := &scriggo.BuildOptions{Packages: packages, TypesRegistry: test.registry}
+		var b strings.Builder
+		for i := 0; i < 2; i++ {
+			program, err := scriggo.Build(fsys, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		}
+		if got := b.String(); got != test.expected {
+			t.Fatalf("expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+// TestProgramInitOrder tests the InitOrder method of Program.
+func TestProgramInitOrder(t *testing.T) {
+	src := `package main
+
+	var a = b + c
+	var b = c * 2
+	var c, d = 1, 2
+	var _ = a
+
+	func main() {}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"main:c", "main:b", "main:a", "main:d", "main:_"}
+	if got := program.InitOrder(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+	src = `package main
+
+	var a = f()
+	var b = a
+
+	func f() int { return b }
+
+	func main() {}`
+	_, err = scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	expectedErr := "main:3:2: typechecking loop involving var a = f()\n\t3:6: a\n\t3:10: f\n\t6:24: b\n\t4:10: a\n"
+	if got := err.Error(); got != expectedErr {
+		t.Fatalf("expected error %q, got %q", expectedErr, got)
+	}
+}
+
+// TestProgramNativeRefs tests the NativeRefs method of Program.
+func TestProgramNativeRefs(t *testing.T) {
+	var v int
+	packages := native.Packages{
+		"pkg": native.Package{
+			Name: "pkg",
+			Declarations: native.Declarations{
+				"F":      func() int { return 1 },
+				"G":      func() {},
+				"V":      &v,
+				"T":      reflect.TypeOf(0),
+				"Unused": func() {},
+				"C":      1,
+			},
+		},
+	}
+	src := `package main
+
+	import "pkg"
+
+	var x pkg.T = pkg.T(pkg.C)
+
+	func main() {
+		_ = pkg.F() + pkg.V + int(x)
+		f := pkg.G
+		f()
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{"pkg.F", "pkg.G", "pkg.T", "pkg.V"}
+	if got := program.NativeRefs(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+// TestEnvValueOf tests the ValueOf and Interface methods of native.ValueEnv.
+func TestEnvValueOf(t *testing.T) {
+	src := `package main
+
+	import "pkg"
+
+	type Point struct {
+		X, Y int
+		z    int
+	}
+
+	type Points []Point
+
+	type Size struct {
+		W, H int
+	}
+
+	func main() {
+		p := Point{1, 2, 3}
+		println(pkg.Marshal(p))
+		println(pkg.Marshal(Points{p, {X: 4}}))
+		println(pkg.Marshal(map[string]interface{}{"a": []interface{}{p, &p}}))
+		s := Size{1, 2}
+		pkg.Unmarshal("{\"W\":5}", &s)
+		println(s.W, s.H)
+		q := pkg.Decode("{\"Y\":6}", p).(Point)
+		println(q.X, q.Y, q.z)
+		ps := pkg.Decode("[{\"X\":7}]", Points{}).(Points)
+		println(len(ps), ps[0].X)
+	}`
+	packages := native.Packages{"pkg": native.Package{Name: "pkg", Declarations: native.Declarations{
+		"Marshal": func(env native.Env, v interface{}) string {
+			data, err := json.Marshal(env.(native.ValueEnv).ValueOf(v).Interface())
+			if err != nil {
+				env.Fatal(err)
+			}
+			return string(data)
+		},
+		"Unmarshal": func(env native.Env, data string, v interface{}) {
+			err := json.Unmarshal([]byte(data), env.(native.ValueEnv).ValueOf(v).Interface())
+			if err != nil {
+				env.Fatal(err)
+			}
+		},
+		"Decode": func(env native.Env, data string, zero interface{}) interface{} {
+			venv := env.(native.ValueEnv)
+			v := reflect.New(venv.ValueOf(zero).Type())
+			err := json.Unmarshal([]byte(data), v.Interface())
+			if err != nil {
+				env.Fatal(err)
+			}
+			return venv.Interface(v.Elem(), env.TypeOf(reflect.ValueOf(zero)))
+		},
+	}}}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := `{"X":1,"Y":2}
+[{"X":1,"Y":2},{"X":4,"Y":0}]
+{"a":[{"X":1,"Y":2},{"X":1,"Y":2}]}
+5 2
+0 6 0
+1 7
+`
+	if b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+}
+
+// TestReproducibleBuilds tests that builds of the same source produce the
+// same code.
+func TestReproducibleBuilds(t *testing.T) {
+	src := `package main
+
+	var a, b, c, d, e, f, g, h = values()
+
+	func values() (int, string, float64, []int, int, rune, bool, int) {
+		return 1, "b", 3.0, []int{4}, 5, '6', true, 8
+	}
+
+	func main() {
+		println(a, b, c, d[0], e, f, g, h)
+	}`
+	fsys := fstest.Files{"main.go": src}
+	var expected []byte
+	for i := 0; i < 20; i++ {
+		program, err := scriggo.Build(fsys, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		asm, err := program.Disassemble("main")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if expected == nil {
+			expected = asm
+			continue
+		}
+		if !bytes.Equal(asm, expected) {
+			t.Fatalf("expected code:\n%s\ngot:\n%s", expected, asm)
+		}
+	}
+}
+
+// TestBuildMetrics tests the Metrics build option.
+func TestBuildMetrics(t *testing.T) {
+	src := `package main
+
+	func inc(a int) int { return a + 1 }
+
+	func main() {
+		f := func(s string) string { return s + "!" }
+		println(inc(1), f("a"))
+	}`
+	metrics := &scriggo.BuildMetrics{}
+	_, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Metrics: metrics})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if metrics.ParseTime <= 0 || metrics.CheckTime <= 0 || metrics.EmitTime <= 0 {
+		t.Fatalf("expected positive durations, got %s, %s and %s", metrics.ParseTime, metrics.CheckTime, metrics.EmitTime)
+	}
+	if metrics.Nodes < 20 {
+		t.Fatalf("expected at least 20 nodes, got %d", metrics.Nodes)
+	}
+	if len(metrics.Functions) != 3 {
+		t.Fatalf("expected 3 functions, got %d", len(metrics.Functions))
+	}
+	names := map[string]scriggo.FunctionMetrics{}
+	for _, fn := range metrics.Functions {
+		if fn.Package != "main" || fn.File != "main" {
+			t.Fatalf("unexpected package %q and file %q for function %q", fn.Package, fn.File, fn.Name)
+		}
+		names[fn.Name] = fn
+	}
+	if metrics.Functions[0].Name != "main" {
+		t.Fatalf("expected main as first function, got %q", metrics.Functions[0].Name)
+	}
+	if inc, ok := names["inc"]; !ok || inc.Registers[0] == 0 {
+		t.Fatalf("expected function inc using int registers, got %v", inc)
+	}
+	if lit, ok := names[""]; !ok || lit.Registers[2] == 0 {
+		t.Fatalf("expected function literal using string registers, got %v", lit)
+	}
+
+	// Only the parse metrics are set if the type checking fails.
+	metrics = &scriggo.BuildMetrics{}
+	_, err = scriggo.Build(fstest.Files{"main.go": "package main\n\nfunc main() { a }"}, &scriggo.BuildOptions{Metrics: metrics})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if metrics.ParseTime <= 0 || metrics.Nodes == 0 || metrics.CheckTime != 0 || metrics.Functions != nil {
+		t.Fatalf("unexpected metrics %v", metrics)
+	}
+}
+
+// TestOperationLimits tests the OperationLimits run option.
+func TestOperationLimits(t *testing.T) {
+	src := `package main
+
+	import "strings"
+
+	func main() {
+		defer func() { recover() }()
+		for i := 0; i < 5; i++ {
+			_ = strings.ToUpper("a")
+		}
+		for i := 0; i < 3; i++ {
+			m := map[int]int{}
+			n := make(map[string]int)
+			_, _ = m, n
+		}
+		ch := make(chan int, 1)
+		ch <- 1
+		<-ch
+		close(ch)
+		println("done")
+	}`
+	packages := native.Packages{"strings": native.Package{Name: "strings", Declarations: native.Declarations{"ToUpper": strings.ToUpper}}}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tests := []struct {
+		limits   scriggo.OperationLimits
+		expected string
+	}{
+		{scriggo.OperationLimits{}, ""},
+		{scriggo.OperationLimits{NativeCalls: 5, MapAllocations: 6, ChannelOperations: 4}, ""},
+		{scriggo.OperationLimits{NativeCalls: 4}, "limit of 4 native calls exceeded"},
+		{scriggo.OperationLimits{MapAllocations: 5}, "limit of 5 map allocations exceeded"},
+		{scriggo.OperationLimits{ChannelOperations: 3}, "limit of 3 channel operations exceeded"},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		limits := test.limits
+		err = program.Run(&scriggo.RunOptions{OperationLimits: &limits, Print: scriggo.PrintTo(&b)})
+		if test.expected == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if b.String() != "done\n" {
+				t.Fatalf("expected %q, got %q", "done\n", b.String())
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected error %q, got no error", test.expected)
+		}
+		e, ok := err.(*scriggo.OperationLimitError)
+		if !ok {
+			t.Fatalf("expected *scriggo.OperationLimitError, got %T: %s", err, err)
+		}
+		if e.Error() != test.expected {
+			t.Fatalf("expected error %q, got %q", test.expected, e.Error())
+		}
+		if b.Len() > 0 {
+			t.Fatalf("unexpected output %q", b.String())
+		}
+	}
+}
+
+// TestMemoryLimit tests the MemoryLimit run option.
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		src      string
+		limit    int
+		expected string
+	}{
+		{"s := make([]int64, 100)\n_ = s", 800, ""},
+		{"s := make([]int64, 100)\n_ = s", 799, "main:5:10: memory limit of 799 bytes exceeded"},
+		{"var s []byte\nfor i := 0; i < 1000; i++ {\ns = append(s, 'a')\n}", 1000, "main:7:11: memory limit of 1000 bytes exceeded"},
+		{"s := \"a\"\nfor i := 0; i < 10; i++ {\ns = s + s\n}", 1000, "main:7:7: memory limit of 1000 bytes exceeded"},
+		{"m := map[string]int{}\n_ = m", 48, ""},
+		{"m := make(map[int64]int64, 10)\n_ = m", 200, "main:5:10: memory limit of 200 bytes exceeded"},
+		{"ch := make(chan int64, 1000)\n_ = ch", 1000, "main:5:11: memory limit of 1000 bytes exceeded"},
+		{"s := make([]int, 1<<60)\n_ = s", 1 << 30, "main:5:10: memory limit of 1073741824 bytes exceeded"},
+	}
+	for _, test := range tests {
+		src := "package main\n\nfunc main() {\n\n" + test.src + "\n}"
+		program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		err = program.Run(&scriggo.RunOptions{MemoryLimit: test.limit})
+		if test.expected == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expected error %q, got no error", test.expected)
+		}
+		e, ok := err.(*scriggo.MemoryLimitError)
+		if !ok {
+			t.Fatalf("expected *scriggo.MemoryLimitError, got %T: %s", err, err)
+		}
+		if e.Error() != test.expected {
+			t.Fatalf("expected error %q, got %q", test.expected, e.Error())
+		}
+		if e.Limit() != test.limit {
+			t.Fatalf("expected limit %d, got %d", test.limit, e.Limit())
+		}
+	}
+}
+
+// TestMaxConstantStringSize tests the MaxConstantStringSize build option.
+// TestMapIndexAllocs tests that indexing maps with int and string keys does
+// not allocate.
+func TestPanicStack(t *testing.T) {
+	src := "package main\n\nfunc f(s []int) int {\n\treturn s[3]\n}\n\nfunc main() {\n\tdefer func() {}()\n\tg := func() { f(nil) }\n\tg()\n}\n"
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = program.Run(nil)
+	p, ok := err.(*scriggo.PanicError)
+	if !ok {
+		t.Fatalf("expected *scriggo.PanicError, got %T: %v", err, err)
+	}
+	var stack []string
+	for _, frame := range p.Stack() {
+		stack = append(stack, fmt.Sprintf("%s %s:%s", frame.Function, frame.Path, frame.Position))
+	}
+	expected := []string{"main.f main:4:10", "main. main:9:17", "main.main main:10:3"}
+	if !reflect.DeepEqual(stack, expected) {
+		t.Fatalf("expected stack %q, got %q", expected, stack)
+	}
+	asm, err := program.Disassemble("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(asm, []byte("\t; main:10:3\n")) {
+		t.Fatalf("expected position main:10:3 in disassembly, got:\n%s", asm)
+	}
+}
+
+// TestFusedInstructions tests the execution of the fused instructions.
+func TestFusedInstructions(t *testing.T) {
+	src := `package main
+
+	var next = func() int { return 10 }
+
+	func count(s string, c byte) int {
+		n := 0
+		for i := 0; i < len(s); i++ {
+			if s[i] == c {
+				n++
+			}
+		}
+		return n
+	}
+
+	func main() {
+		x := 3
+		y := 4
+		y += x
+		print(count("banana", 'a'), " ", y, " ", next())
+		if "abc"[x] == 'c' {
+			print(" unreachable")
+		}
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := program.Disassemble("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Move+", "Index+", "GetVar+"} {
+		if !bytes.Contains(asm, []byte("\t"+name+" ")) {
+			t.Fatalf("expected %s in disassembly, got:\n%s", name, asm)
+		}
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err == nil {
+		t.Fatal("expected error, got no error")
+	}
+	p, ok := err.(*scriggo.PanicError)
+	if !ok {
+		t.Fatalf("expected *scriggo.PanicError, got %T: %s", err, err)
+	}
+	if expected := "runtime error: index out of range [3] with length 3"; p.String() != expected {
+		t.Fatalf("expected panic %q, got %q", expected, p.String())
+	}
+	expected := "3 7 10"
+	if got := b.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestWideRegisters(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("package main\n\nfunc f(n int) (int, string, int, int) {\n\tdefer func() {}()\n")
+	for i := 1; i <= 200; i++ {
+		_, _ = fmt.Fprintf(&b, "\tv%d := %d\n", i, i)
+		_, _ = fmt.Fprintf(&b, "\tvar s%d = \"%d\"\n", i, i%10)
+	}
+	for i := 1; i <= 150; i++ {
+		_, _ = fmt.Fprintf(&b, "\tg%d := []int{%d}\n", i, i)
+	}
+	for i := 1; i <= 120; i++ {
+		_, _ = fmt.Fprintf(&b, "\tx%d := %d.5\n", i, i)
+	}
+	b.WriteString("\tvar e interface{} = v150\n" +
+		"\tv200 += n\n" +
+		"\tv199++\n" +
+		"\tv198, v197 = v197, v198\n" +
+		"\tfor v196 = range []int{0, 1, 2} {\n\t}\n" +
+		"\tv195, k := 5, 1\n" +
+		"\tif n > 0 {\n\t\tv180, _, _, _ = f(n - k)\n\t}\n")
+	b.WriteString("\tv, s, g, x := 0, \"\", e.(int), 0.0\n")
+	for i := 1; i <= 200; i++ {
+		_, _ = fmt.Fprintf(&b, "\tv += v%d\n\ts += s%d\n", i, i)
+	}
+	for i := 1; i <= 150; i++ {
+		_, _ = fmt.Fprintf(&b, "\tg += g%d[0]\n", i)
+	}
+	for i := 1; i <= 120; i++ {
+		_, _ = fmt.Fprintf(&b, "\tx += x%d\n", i)
+	}
+	b.WriteString("\treturn v, s, g, int(x)\n}\n\n" +
+		"func main() {\n\tv, s, g, x := f(2)\n\tprint(v, \" \", s[190:], \" \", len(s), \" \", g, \" \", x)\n}\n")
+	program, err := scriggo.Build(fstest.Files{"main.go": b.String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asm, err := program.Disassemble("main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(asm, []byte("\tWide Move ")) {
+		t.Fatalf("expected Wide Move in disassembly, got:\n%s", asm)
+	}
+	var out strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&out)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "58794 1234567890 200 11475 7320"
+	if got := out.String(); got != expected {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestMapIndexAllocs(t *testing.T) {
+	var programs [2]*scriggo.Program
+	for i, n := range []int{1, 1001} {
+		src := fmt.Sprintf("package main\n\nfunc main() {\n"+
+			"\tmi := map[int]int{1000: 1}\n"+
+			"\tms := map[string]string{\"a\": \"b\"}\n"+
+			"\tme := map[int]interface{}{2000: 3}\n"+
+			"\tk := \"a\"\n"+
+			"\tfor i := 0; i < %d; i++ {\n"+
+			"\t\t_ = mi[i+1000]\n"+
+			"\t\t_, _ = ms[k]\n"+
+			"\t\t_ = me[i+2000]\n"+
+			"\t}\n}\n", n)
+		program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs[i] = program
+	}
+	var allocs [2]float64
+	for i, program := range programs {
+		allocs[i] = testing.AllocsPerRun(10, func() {
+			err := program.Run(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if allocs[1] != allocs[0] {
+		t.Errorf("indexing maps allocates %.0f times more for 1000 iterations", allocs[1]-allocs[0])
+	}
+}
+
+func TestMaxConstantStringSize(t *testing.T) {
+	tests := []struct {
+		src      string
+		limit    int
+		expected string
+	}{
+		{"const s = \"abc\" + \"def\"\n_ = s", 0, ""},
+		{"const s = \"abc\" + \"def\"\n_ = s", 6, ""},
+		{"const s = \"abc\" + \"def\"\n_ = s", 5, "main:7:17: constant string too large"},
+		{"const a = \"abcdefgh\"\nconst b = a + a\nconst c = b + b\n_ = c", 20, "main:9:13: constant string too large"},
+		{"s := \"abc\"\ns = s + \"def\"\n_ = s", 5, ""},
+		{"_ = pkg.S", 0, ""},
+		{"_ = pkg.S", 100, ""},
+		{"_ = pkg.S", 99, "main:7:1: constant string too large"},
+	}
+	packages := native.Packages{"pkg": native.Package{Name: "pkg", Declarations: native.Declarations{
+		"S": native.UntypedStringConst(strings.Repeat("a", 100)),
+	}}}
+	for _, test := range tests {
+		imports := "\n"
+		if strings.Contains(test.src, "pkg.") {
+			imports = "import \"pkg\"\n"
+		}
+		src := "package main\n\n" + imports + "\nfunc main() {\n\n" + test.src + "\n}"
+		_, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages, MaxConstantStringSize: test.limit})
+		if err != nil {
+			if test.expected == "" {
+				t.Fatalf("source %q: unexpected error: %s", test.src, err)
+			}
+			if got := err.Error(); got != test.expected {
+				t.Fatalf("source %q: expected error %q, got %q", test.src, test.expected, got)
+			}
+			continue
+		}
+		if test.expected != "" {
+			t.Fatalf("source %q: expected error %q, got no error", test.src, test.expected)
+		}
+	}
+}
+
+// TestNativeCallHook tests the NativeCallHook run option.
+func TestNativeCallHook(t *testing.T) {
+	src := `package main
+
+	import "pkg"
+
+	func main() {
+		println(pkg.Upper("a"), pkg.Join("-", "b", "c"), pkg.Locale(), pkg.Delete("d"))
+	}`
+	var deleted []string
+	packages := native.Packages{"pkg": native.Package{Name: "pkg", Declarations: native.Declarations{
+		"Upper":  strings.ToUpper,
+		"Join":   func(sep string, s ...string) string { return strings.Join(s, sep) },
+		"Locale": func(env native.Env) string { return env.(native.LocaleEnv).Locale() },
+		"Delete": func(name string) bool { deleted = append(deleted, name); return true },
+	}}}
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{Packages: packages})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var calls []string
+	hook := func(pkg, name string, args []reflect.Value, call func() []reflect.Value) []reflect.Value {
+		values := make([]interface{}, len(args))
+		for i, arg := range args {
+			values[i] = arg.Interface()
+		}
+		calls = append(calls, fmt.Sprintf("%s.%s%v", pkg, name, values))
+		if name == "Delete" {
+			return []reflect.Value{reflect.ValueOf(false)}
+		}
+		return call()
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{NativeCallHook: hook, Locale: "it", Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "A b-c it false\n"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	expected := []string{"pkg.Upper[a]", "pkg.Join[- [b c]]", "pkg.Locale[]", "pkg.Delete[d]"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("expected calls %q, got %q", expected, calls)
+	}
+	if deleted != nil {
+		t.Fatalf("unexpected call of Delete with %q", deleted)
+	}
+	b.Reset()
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "A b-c  true\n"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+}
+
+// quotaAllocator is a scriggo.Allocator that records the allocations and
+// returns an error if the allocated bytes exceed a quota.
+type quotaAllocator struct {
+	quota  uintptr
+	size   uintptr
+	allocs []string
+}
+
+var errQuotaExceeded = errors.New("quota exceeded")
+
+func (a *quotaAllocator) alloc(kind string, typ reflect.Type, size uintptr) error {
+	a.allocs = append(a.allocs, kind+" "+typ.String())
+	a.size += size
+	if a.quota > 0 && a.size > a.quota {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+func (a *quotaAllocator) New(typ reflect.Type) (reflect.Value, error) {
+	return reflect.New(typ), a.alloc("new", typ, typ.Size())
+}
+
+func (a *quotaAllocator) MakeSlice(typ reflect.Type, len, cap int) (reflect.Value, error) {
+	return reflect.MakeSlice(typ, len, cap), a.alloc("slice", typ, typ.Elem().Size()*uintptr(cap))
+}
+
+func (a *quotaAllocator) MakeMap(typ reflect.Type, n int) (reflect.Value, error) {
+	return reflect.MakeMapWithSize(typ, n), a.alloc("map", typ, 48)
+}
+
+func (a *quotaAllocator) MakeChan(typ reflect.Type, buffer int) (reflect.Value, error) {
+	return reflect.MakeChan(typ, buffer), a.alloc("chan", typ, 96)
+}
+
+// TestAllocator tests the Allocator run option.
+func TestAllocator(t *testing.T) {
+	src := `package main
+
+	type point struct{ X, Y int }
+
+	func main() {
+		p := new(int)
+		*p = 3
+		s := make([]int, 2, 4)
+		m := map[string]int{"a": 1}
+		var ch <-chan int = make(chan int, 1)
+		pt := point{1, 2}
+		a := [2]string{"b", "c"}
+		println(*p, len(s), cap(s), m["a"], cap(ch), pt.Y, a[1])
+		for {
+			_ = make([]byte, 1024)
+		}
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	allocator := &quotaAllocator{quota: 10000}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Allocator: allocator, Print: scriggo.PrintTo(&b)})
+	if err != errQuotaExceeded {
+		t.Fatalf("expected error %q, got %v", errQuotaExceeded, err)
+	}
+	if expected := "3 2 4 1 1 2 c\n"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	expected := []string{"new int", "slice []int", "map map[string]int", "chan chan int", "new struct { X int; Y int }", "new [2]string"}
+	if len(allocator.allocs) < len(expected) || !reflect.DeepEqual(allocator.allocs[:len(expected)], expected) {
+		t.Fatalf("expected allocations %q, got %q", expected, allocator.allocs)
+	}
+	for _, alloc := range allocator.allocs[len(expected):] {
+		if alloc != "slice []uint8" {
+			t.Fatalf("unexpected allocation %q", alloc)
+		}
+	}
+}
+
+// TestGoroutines tests the go statement.
+func TestGoroutines(t *testing.T) {
+	src := `package main
+
+	func worker(jobs <-chan int, results chan<- int) {
+		for j := range jobs {
+			results <- j * 2
+		}
+	}
+
+	func main() {
+		jobs := make(chan int, 9)
+		results := make(chan int, 9)
+		for w := 0; w < 3; w++ {
+			go worker(jobs, results)
+		}
+		for j := 1; j <= 9; j++ {
+			jobs <- j
+		}
+		close(jobs)
+		sum := 0
+		for i := 0; i < 9; i++ {
+			sum += <-results
+		}
+		println(sum)
+		c1 := make(chan string)
+		c2 := make(chan string)
+		go func() { c1 <- "a" }()
+		go func(s string) { c2 <- s }("b")
+		n := 0
+		for i := 0; i < 2; i++ {
+			select {
+			case m := <-c1:
+				n += len(m)
+			case m := <-c2:
+				n += len(m)
+			}
+		}
+		println(n)
+		done := make(chan bool)
+		go func() {
+			defer func() {
+				recover()
+				done <- true
+			}()
+			panic("recovered")
+		}()
+		<-done
+		go func() {
+			panic("boom")
+		}()
+		select {}
+	}`
+	program, err := scriggo.Build(fstest.Files{"main.go": src}, &scriggo.BuildOptions{AllowGoStmt: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Print: scriggo.PrintTo(&b)})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	p, ok := err.(*scriggo.PanicError)
+	if !ok {
+		t.Fatalf("expected *scriggo.PanicError, got %T: %s", err, err)
+	}
+	if p.Message() != "boom" {
+		t.Fatalf("expected panic message %q, got %v", "boom", p.Message())
+	}
+	if expected := "90\n2\n"; b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+}
+
+// TestDebugger tests the Debug build option and the Debugger run option.
+func TestDebugger(t *testing.T) {
+	src := "package main\n\nfunc inc(n int) int {\n\treturn n + 1\n}\n\nfunc main() {\n\ta := 5\n\tb := inc(a)\n\tprint(a + b)\n}\n"
+	fsys := fstest.Files{"main.go": src}
+	program, err := scriggo.Build(fsys, &scriggo.BuildOptions{Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stops []string
+	var d *scriggo.Debugger
+	d = scriggo.NewDebugger(func(frame *scriggo.DebugFrame) {
+		stops = append(stops, fmt.Sprintf("%s:%s %s", frame.Path, frame.Position, frame.Function))
+		if frame.Position.Line == 9 {
+			if regs := frame.Registers.Int; len(regs) == 0 || regs[0] != 5 {
+				t.Errorf("expected first int register with value 5, got %v", regs)
+			}
+			d.Step()
+		}
+	})
+	d.SetBreakpoint("main", 9)
+	var b strings.Builder
+	err = program.Run(&scriggo.RunOptions{Debugger: d, Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != "11" {
+		t.Fatalf("expected output %q, got %q", "11", b.String())
+	}
+	expected := []string{"main:9:2 main.main", "main:4:2 main.inc"}
+	if !reflect.DeepEqual(stops, expected) {
+		t.Fatalf("expected stops %q, got %q", expected, stops)
+	}
+	// Without the Debug build option, the debugger never stops.
+	program, err = scriggo.Build(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stops = nil
+	err = program.Run(&scriggo.RunOptions{Debugger: d, Print: scriggo.PrintTo(&b)})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if stops != nil {
+		t.Fatalf("expected no stops, got %q", stops)
+	}
+}
+
+func TestWatchVars(t *testing.T) {
+	src := "package main\n\nvar count, other int\n\nfunc main() {\n\tcount = 2\n\tother = 3\n\tf := func() { count++ }\n\tf()\n\tp := &count\n\t*p = 7\n}\n"
+	fsys := fstest.Files{"main.go": src}
+	// Standalone, without the Debug build option.
+	program, err := scriggo.Build(fsys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits []string
+	watch := func(frame *scriggo.DebugFrame) {
+		hits = append(hits, fmt.Sprintf("%s %s:%s %s", frame.Var, frame.Path, frame.Position, frame.Function))
+		if !strings.Contains(string(frame.Stack), "main.main()") {
+			t.Errorf("expected stack with main.main, got %q", frame.Stack)
+		}
+	}
+	err = program.Run(&scriggo.RunOptions{WatchVars: []string{"main:count"}, Watch: watch})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []string{
+		"main:count main:0:0 main.$initvars",
+		"main:count main:0:0 main.main",
+		"main:count main:0:0 main.",
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Fatalf("expected hits %q, got %q", expected, hits)
+	}
+	// With the Debug build option.
+	program, err = scriggo.Build(fsys, &scriggo.BuildOptions{Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits = nil
+	err = program.Run(&scriggo.RunOptions{WatchVars: []string{"main:count"}, Watch: watch})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = []string{
+		"main:count main:0:0 main.$initvars",
+		"main:count main:6:2 main.main",
+		"main:count main:8:16 main.",
+	}
+	if !reflect.DeepEqual(hits, expected) {
+		t.Fatalf("expected hits %q, got %q", expected, hits)
+	}
+	// With a debugger.
+	var stops []string
+	d := scriggo.NewDebugger(func(frame *scriggo.DebugFrame) {
+		stops = append(stops, fmt.Sprintf("%s %s:%s", frame.Var, frame.Path, frame.Position))
+	})
+	d.Watch("main:count")
+	d.Watch("main:other")
+	d.Unwatch("main:count")
+	err = program.Run(&scriggo.RunOptions{Debugger: d})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = []string{"main:other main:0:0", "main:other main:7:2"}
+	if !reflect.DeepEqual(stops, expected) {
+		t.Fatalf("expected stops %q, got %q", expected, stops)
+	}
+}
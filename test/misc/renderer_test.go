@@ -6,6 +6,8 @@ package misc
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"reflect"
 	"testing"
 	"time"
@@ -44,6 +46,10 @@ var htmlContextTests = []struct {
 	{`5479159814589435423678645745.523785742365476`, "5479159814589435000000000000", nil},
 	{`0.0000000000000000000000000000000000000000000000000000000001`, "0.0000000000000000000000000000000000000000000000000000000001", nil},
 	{`-0.1000000`, "-0.1", nil},
+	{`int8(-3)`, "-3", nil},
+	{`uint64(18446744073709551615)`, "18446744073709551615", nil},
+	{`float32(0.1)`, "0.1", nil},
+	{`d`, "1.5s", Vars{"d": 1500 * time.Millisecond}},
 	{`true`, "true", nil},
 	{`false`, "false", nil},
 	{`s["a"]`, "", Vars{"s": map[string]string{}}},
@@ -73,6 +79,56 @@ func TestHTMLContext(t *testing.T) {
 	}
 }
 
+// TestShowNumberAllocs tests that showing numbers in text and HTML contexts
+// does not allocate.
+func TestShowNumberAllocs(t *testing.T) {
+	for _, name := range []string{"index.txt", "index.html"} {
+		var templates [2]*scriggo.Template
+		for i, n := range []int{1, 1001} {
+			src := fmt.Sprintf("{%% for i := 0; i < %d; i++ %%}{{ i }} {{ float64(i) / 4 }} {{ uint8(i) }}{%% end %%}", n)
+			template, err := scriggo.BuildTemplate(fstest.Files{name: src}, name, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			templates[i] = template
+		}
+		var allocs [2]float64
+		for i, template := range templates {
+			allocs[i] = testing.AllocsPerRun(10, func() {
+				err := template.Run(io.Discard, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+		if allocs[1] != allocs[0] {
+			t.Errorf("%s: showing numbers allocates %.0f times more for 1000 iterations", name, allocs[1]-allocs[0])
+		}
+	}
+}
+
+func BenchmarkShowNumber(b *testing.B) {
+	for _, name := range []string{"index.txt", "index.html"} {
+		fsys := fstest.Files{name: "{{ n }} {{ f }}"}
+		template, err := scriggo.BuildTemplate(fsys, name, &scriggo.BuildOptions{
+			Globals: native.Declarations{"n": (*int)(nil), "f": (*float64)(nil)},
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		vars := map[string]interface{}{"n": 4503, "f": 3.25}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := template.Run(io.Discard, vars, nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 var quotedAttrContextTests = []struct {
 	src  string
 	res  string
@@ -270,3 +270,29 @@ func TestScriptsChainMessages(t *testing.T) {
 		t.Fatalf("Message should be %q, got %q", "external,script1,script2", Message)
 	}
 }
+
+func TestScriptRunVarsErrors(t *testing.T) {
+	options := &scripts.BuildOptions{
+		Globals: native.Declarations{
+			"N": (*int)(nil),
+		},
+	}
+	script, err := scripts.Build(strings.NewReader(`_ = N`), options)
+	if err != nil {
+		t.Fatalf("unable to build script: %s", err)
+	}
+	tests := map[string]map[string]interface{}{
+		`variable initializer "N" must have type int or *int, but have string`: {"N": "5"},
+		`variable initializer "N" cannot be nil`:                               {"N": nil},
+		`variable initializer "N" cannot be a nil pointer`:                     {"N": (*int)(nil)},
+	}
+	for expected, vars := range tests {
+		err = script.Run(vars, nil)
+		if err == nil {
+			t.Fatalf("expecting error %q, got no error", expected)
+		}
+		if err.Error() != expected {
+			t.Fatalf("expecting error %q, got %q", expected, err)
+		}
+	}
+}
@@ -6,20 +6,28 @@ package misc
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
+	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/open2b/scriggo"
 	"github.com/open2b/scriggo/ast"
+	"github.com/open2b/scriggo/builtin"
 	"github.com/open2b/scriggo/internal/fstest"
 	"github.com/open2b/scriggo/native"
+	"github.com/open2b/scriggo/watch"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -522,6 +530,90 @@ var rendererStmtTests = []struct {
 	{`{% if s, ok := interface{}(byte(5)).(byte); ok %}{{ s }}{% end %}`, "5", nil},
 	{`{% if s, ok := interface{}(byte(255)).(byte); ok %}{{ s }}{% end %}`, "255", nil},
 
+	// indexing, slicing and ranging over format types
+	{`{% var s html = "<b>x</b>" %}{{ s[0] }} {{ s[0:3] }} {{ len(s) }}`, "60 &lt;b&gt; 8", nil},
+	{`{% s := html("<i>") %}{% i := 1 %}{{ s[i] }} {{ s[i:] }} {{ s[:i+1] }}`, "105 i&gt; &lt;i", nil},
+	{`{{ html("<b>a</b>")[0:2] }}`, "&lt;b", nil},
+	{`{% s := html("<b>") %}{% t := s[1:] %}{% var u string = t %}{{ u }}`, "b&gt;", nil},
+	{`{% var s markdown = "abc" %}{% for i, c := range s[1:] %}{{ i }}{{ c }},{% end %}`, "098,199,", nil},
+	{`{% s := []css{"abc"} %}{{ s[0][1] }} {{ s[0][1:] }}`, "98 bc", nil},
+	{`{% var s interface{} = js("abc") %}{{ s.(js)[2] }} {{ string(s.(js)[1:]) }}`, "99 bc", nil},
+	{`{% m := map[string]json{"a": "xyz"} %}{{ m["a"][1] }} {{ string(m["a"][1:]) }} {{ len(m["a"]) }}`, "121 yz 3", nil},
+	{`{% s := html("abc") %}{% p := &s %}{{ (*p)[1:] == "bc" }}`, "true", nil},
+
+	// nil-safe selector
+	{"{% type B struct{ C string } %}{% type A struct{ B *B } %}{% var a *A %}{{ a?.B?.C }}|{{ a?.B == nil }}", "|true", nil},
+	{"{% type B struct{ C string } %}{% type A struct{ B *B } %}{% a := &A{} %}{{ a?.B?.C }}|{{ a?.B == nil }}", "|true", nil},
+	{"{% type B struct{ C string } %}{% type A struct{ B *B } %}{% a := &A{&B{\"c\"}} %}{{ a?.B?.C }}", "c", nil},
+	{"{% type T struct{ N int; F float64; S []int; I interface{}; P struct{ X bool } } %}{% var t *T %}{{ t?.N }} {{ t?.F }} {{ len(t?.S) }} {{ t?.I == nil }} {{ t?.P.X }}", "0 0 0 true false", nil},
+	{"{% type T struct{ N int } %}{% t := &T{5} %}{% var i interface{} = t?.N %}{{ i }} {{ t?.N + 1 }}", "5 6", nil},
+	{"{% type B struct{ X int } %}{% type A struct{ *B } %}{% a := &A{} %}{{ a?.X }}|{% b := &A{&B{3}} %}{{ b?.X }}", "0|3", nil},
+	{"{% type C struct{ X string } %}{% type B struct{ *C } %}{% type A struct{ B } %}{% a := &A{} %}{{ a?.X }}|{% a.C = &C{\"x\"} %}{{ a?.X }}", "|x", nil},
+	{"{% m := map[string]int{\"a\": 1} %}{% var n map[string]int %}{{ m?.a }} {{ m?.b }} {{ n?.a }}", "1 0 0", nil},
+	{"{% type T struct{ N int } %}{% var i interface{} = &T{5} %}{% var j interface{} = T{6} %}{% var k interface{} %}{% var p *T %}{% var l interface{} = p %}{{ i?.N }} {{ j?.N }} {{ k?.N == nil }} {{ l?.N == nil }}", "5 6 true true", nil},
+
+	// conditional expression
+	{`{% a := 5 %}{{ a > 3 ? "big" : "small" }} {{ a > 10 ? "big" : "small" }}`, "big small", nil},
+	{`{% a := 0 %}{% b := "x" %}{{ a ? 1 : 2 }} {{ b ? 1 : 2.5 }} {{ true ? 1 : 2 }} {{ false ? 'a' : 2 }}`, "2 1 1 2", nil},
+	{`{% a, b := 1, 2 %}{{ a > b ? a : b }} {{ a < b ? a : b }}`, "2 1", nil},
+	{`{% s := "" %}{{ s == "" ? html("<i>") : "<b>" }}|{{ s != "" ? html("<i>") : "<b>" }}|{{ s == "" ? "<i>" : "<b>" }}`, "<i>|<b>|&lt;i&gt;", nil},
+	{`{% var i interface{} = 3 %}{% v := true ? i : "x" %}{{ v }} {% v = false ? i : "x" %}{{ v }}`, "3 x", nil},
+	{`{% var p *int %}{% n := 7 %}{% q := p == nil ? &n : p %}{{ *q }}`, "7", nil},
+	{`{% a := 2 %}{{ a == 1 ? "one" : a == 2 ? "two" : "many" }}`, "two", nil},
+	{`{% s := []int{1, 2, 3} %}{{ s[len(s) > 2 ? 1 : 0] }} {{ len(s[true ? 1 : 0:]) }}`, "2 2", nil},
+	{`{% var f float64 = false ? 1 : 2.5 %}{{ f }}`, "2.5", nil},
+	{`{% x := 1 ? .5 : 1.5 %}{{ x }}`, "0.5", nil},
+	{`{% x := true ? 1 : 2.5 %}{{ x / 2 }} {{ (true ? 1 : 2.5) / 2 }} {% c := true %}{{ (c ? 1 : 2.5) / 2 }}`, "0.5 0.5 0.5", nil},
+
+	// or with a non-boolean left operand
+	{`{% title := "" %}{{ title or "Untitled" }} {{ title or "" }}`, "true false", nil},
+	{`{% n := 0 %}{{ n or 0 }} {{ n or 5 }}`, "false true", nil},
+
+	// integer range
+	{`{% for i in 1..5 %}{{ i }}{% end %}`, "12345", nil},
+	{`{% for i in 3..3 %}{{ i }}{% else %}empty{% end %}|{% for i in 3..2 %}{{ i }}{% else %}empty{% end %}`, "3|empty", nil},
+	{`{% for i in -2..1 %}{{ i }} {% end %}`, "-2 -1 0 1 ", nil},
+	{`{% n := 4 %}{% for i in 1..n %}{% n = 2 %}{{ i }}{% end %}`, "1234", nil},
+	{`{% for i in 1..5 %}{% i = 10 %}{{ i }} {% end %}`, "10 10 10 10 10 ", nil},
+	{`{% for i in 1..10 %}{% if i%2 == 0 %}{% continue %}{% end %}{% if i > 7 %}{% break %}{% end %}{{ i }}{% else %}empty{% end %}`, "1357", nil},
+	{`{% for i in 1..2 %}{% for j in i..3 %}{{ i }}{{ j }} {% end %}{% end %}`, "11 12 13 22 23 ", nil},
+	{`{% for i in int8(125)..127 %}{{ i }} {% end %}`, "125 126 127 ", nil},
+	{`{% for i in uint8(254)..255 %}{{ i }} {% end %}`, "254 255 ", nil},
+	{`{% var f func() int %}{% for i in 1..3 %}{% f = func() int { return i } %}{{ f() }}{% end %}`, "123", nil},
+	{`{%% for i in 1..3 { show i } %%}`, "123", nil},
+	{`{% type T struct{ A int } %}{% s := []*T{{A: 1}, {2}} %}{% m := map[string]*T{"a": {3}} %}{{ s[0].A }}{{ s[1].A }}{{ m["a"].A }}`, "123", nil},
+	// range over strings with invalid UTF-8
+	{`{% for r in "a\xffb\xe2\x82c" %}{{ r }} {% end %}`, "97 65533 98 65533 65533 99 ", nil},
+	{`{% for i, r := range "\xf0\x9f\x98c\xc0\x80é" %}{{ i }}:{{ r }} {% end %}`, "0:65533 1:65533 2:65533 3:99 4:65533 5:65533 6:233 ", nil},
+	{`{% s := "a\xffb\xe2\x82c\xf0\x9f\x98\x80\xc0" %}{% for i := range s %}{{ i }} {% end %}`, "0 1 2 3 4 5 6 10 ", nil},
+	{`{% s := "a\xffb\xe2\x82c\xf0\x9f\x98\x80\xc0" %}{% for i, r := range s %}{% if r == 0xFFFD %}{{ i }} {% end %}{% end %}`, "1 3 4 10 ", nil},
+	// goto
+	{`{%% goto L %%}a{%% L: %%}b`, "b", nil},
+	{`{%% i := 0 %%}{%% L: %%}a{% i++ %}{% if i < 3 %}{%% goto L %%}{% end %}{{ i }}`, "aaa3", nil},
+	{`{% for i in 1..3 %}{{ i }}{% if i == 2 %}{%% goto E %%}{% end %}{% end %}{%% E: %%}.`, "12.", nil},
+	{`{% macro M %}{%% goto L %%}a{%% L: %%}b{% end %}{{ M() }}`, "b", nil},
+	// parallel for
+	{`{% parallel := []int{1} %}{% for parallel in parallel %}{{ parallel }}{% end %}`, "1", nil},
+
+	// destructuring
+	{`{% pair := [2]int{1, 2} %}{% a, b := pair %}{{ a }} {{ b }}`, "1 2", nil},
+	{`{% a, b, c := []string{"x", "y", "z"} %}{{ a }}{{ b }}{{ c }}`, "xyz", nil},
+	{`{% a, _ := []string{"x", "y", "z"} %}{{ a }}`, "x", nil},
+	{`{% s := [][]int{{1, 2}} %}{% a, b := s[0] %}{{ a }} {{ b }}`, "1 2", nil},
+	{`{% n := 0 %}{% f := func() []int { n++; return []int{n, 10} } %}{% a, b := f() %}{{ a }} {{ b }} {{ n }}`, "1 10 1", nil},
+	{`{% n := 0 %}{% f := func() []int { n++; return []int{n, 10} } %}{% var a, b = f() %}{{ a }} {{ b }} {{ n }}`, "1 10 1", nil},
+	{`{% var a, b int %}{% a, b = []int{3, 4} %}{{ a }} {{ b }}`, "3 4", nil},
+	{`{% m := map[string]int{"a": 1} %}{% v, ok := m["a"] %}{{ v }} {{ ok }}`, "1 true", nil},
+
+	// chained comparisons
+	{`{% x := 5 %}{{ 1 <= x <= 10 }} {{ 1 <= x < 5 }} {{ 10 > x >= 5 }}`, "true false true", nil},
+	{`{% x := 5 %}{% if 0 < 1 < x < 10 <= 10 %}ok{% end %}`, "ok", nil},
+	{`{% x := 5 %}{% if 1 <= x <= 10 and x != 3 %}ok{% end %}`, "ok", nil},
+	{`{% n := 0 %}{% f := func() int { n++; return n * 3 } %}{{ 1 <= f() <= 10 }} {{ n }}`, "true 1", nil},
+	{`{% n := 0 %}{% f := func() int { n++; return n } %}{{ 5 < f() <= 10 }} {{ n }}`, "false 1", nil},
+	{`{% var a int8 = 1 %}{% var b float64 = 10 %}{{ a <= 5 <= b }} {{ a < 5 < 4.5 }}`, "true false", nil},
+	{`{{ 1 <= 5 <= 10 }} {{ "a" < "b" < "c" }}`, "true true", nil},
+
 	// map
 	// {`{% if _, ok := map[interface{}]interface{}(a).(map[interface{}]interface{}); ok %}ok{% end %}`, "ok", Vars{"a": map[interface{}]interface{}{}}},
 	// {`{% if map[interface{}]interface{}(a) != nil %}ok{% end %}`, "ok", Vars{"a": map[interface{}]interface{}{}}},
@@ -689,15 +781,16 @@ type aStruct struct {
 }
 
 var templateMultiFileCases = map[string]struct {
-	sources          fstest.Files
-	expectedBuildErr string                 // default to empty string (no build error). Mutually exclusive with expectedOut.
-	expectedOut      string                 // default to "". Mutually exclusive with expectedBuildErr.
-	main             native.Package         // default to nil
-	vars             map[string]interface{} // default to nil
-	entryPoint       string                 // default to "index.html"
-	importer         native.Importer        // default to nil
-	noParseShow      bool
-	dollarIdentifier bool // default to false
+	sources           fstest.Files
+	expectedBuildErr  string                 // default to empty string (no build error). Mutually exclusive with expectedOut.
+	expectedOut       string                 // default to "". Mutually exclusive with expectedBuildErr.
+	main              native.Package         // default to nil
+	vars              map[string]interface{} // default to nil
+	entryPoint        string                 // default to "index.html"
+	importer          native.Importer        // default to nil
+	noParseShow       bool
+	dollarIdentifier  bool // default to false
+	executeCodeFences bool // default to false
 }{
 
 	"Empty template": {
@@ -927,6 +1020,42 @@ var templateMultiFileCases = map[string]struct {
 		expectedOut: `body`,
 	},
 
+	"Macro definition with auxiliary results": {
+		sources: fstest.Files{
+			"index.txt": `{% macro Stats(s []string) (html, int, bool) %}{% for _, v := range s %}<b>{{ v }}</b>{% end %}{% return len(s), true %}{% end %}` +
+				`{% content, count, ok := Stats([]string{"a", "b"}) %}{{ content }}|{{ count }}|{{ ok }}`,
+		},
+		expectedOut: `<b>a</b><b>b</b>|2|true`,
+	},
+
+	"Macro definition with auxiliary results and a return without values": {
+		sources: fstest.Files{
+			"index.txt": `{% macro M() (string, int) %}a{% return %}b{% end %}{% s, n := M() %}{{ s }}|{{ n }}`,
+		},
+		expectedOut: `a|0`,
+	},
+
+	"Macro definition with auxiliary results used in a single-value context": {
+		sources: fstest.Files{
+			"index.txt": `{% macro M() (html, int) %}a{% end %}{{ M() }}`,
+		},
+		expectedBuildErr: "multiple-value M() in single-value context",
+	},
+
+	"Macro definition with named results": {
+		sources: fstest.Files{
+			"index.txt": `{% macro M() (s html, n int) %}a{% end %}`,
+		},
+		expectedBuildErr: "syntax error: macro results cannot be named",
+	},
+
+	"Macro definition returning a value without auxiliary results": {
+		sources: fstest.Files{
+			"index.txt": `{% macro M %}a{% return 1 %}{% end %}`,
+		},
+		expectedBuildErr: "too many arguments to return\n\thave (number)\n\twant ()",
+	},
+
 	"Macro definition (with arguments)": {
 		sources: fstest.Files{
 			"index.txt": `{% macro M(v int) %}v is {{ v }}{% end %}`,
@@ -1024,6 +1153,27 @@ var templateMultiFileCases = map[string]struct {
 		expectedOut: "abc",
 	},
 
+	"Destructuring - array with a different length": {
+		sources: fstest.Files{
+			"index.txt": `{% a, b := [3]int{1, 2, 3} %}{{ a }}{{ b }}`,
+		},
+		expectedBuildErr: "assignment mismatch: 2 variables but [3]int{...} has 3 elements",
+	},
+
+	"Destructuring - slice returned by a global function": {
+		sources: fstest.Files{
+			"index.txt": `{% name, value := pair() %}{{ name }}={{ value }}`,
+		},
+		main: native.Package{
+			Name: "main",
+			Declarations: native.Declarations{
+				"pair": func() []string { return []string{"a", "b"} },
+			},
+		},
+		entryPoint:  "index.txt",
+		expectedOut: "a=b",
+	},
+
 	"Render - Render file that uses external variable": {
 		sources: fstest.Files{
 			"index.txt":   `{% var a = 10 %}a: {{ render "/partial.txt" }}`,
@@ -1175,6 +1325,34 @@ var templateMultiFileCases = map[string]struct {
 		expectedOut: "I am an extended file.",
 	},
 
+	"Extends - Extending a file that extends another file": {
+		sources: fstest.Files{
+			"index.txt":  `{% extends "/middle.txt" %}{% macro Title %}title{% end %}{% macro Body %}body{% end %}`,
+			"middle.txt": `{% extends "/layout.txt" %}{% macro Main %}[{{ Body() }}]{% end %}`,
+			"layout.txt": `{{ Title() }} {{ Main() }}`,
+		},
+		expectedOut: "title [body]",
+	},
+
+	"Extends - Extends chain with four files": {
+		sources: fstest.Files{
+			"index.txt":  `{% extends "/a.txt" %}{% var V = "v" %}{% macro I %}i{{ V }}{% end %}`,
+			"a.txt":      `{% extends "/b.txt" %}{% macro A %}a{{ I() }}{% end %}`,
+			"b.txt":      `{% extends "/layout.txt" %}{% macro B %}b{{ A() }}{% end %}`,
+			"layout.txt": `{{ B() }} {{ I() }} {{ V }} {{ A() }} {{ N() default "n" }}`,
+		},
+		expectedOut: "baiv iv v aiv n",
+	},
+
+	"Extends - Macro redeclared in an extends chain": {
+		sources: fstest.Files{
+			"index.txt":  `{% extends "/middle.txt" %}{% macro M %}index{% end %}`,
+			"middle.txt": `{% extends "/layout.txt" %}{% macro M %}middle{% end %}`,
+			"layout.txt": `{{ M() }}`,
+		},
+		expectedBuildErr: "middle.txt:1:37: M redeclared in this block",
+	},
+
 	"File imported twice": {
 		sources: fstest.Files{
 			"index.txt": `{% import "/a.txt" %}{% import "/b.txt" %}`,
@@ -2112,6 +2290,34 @@ var templateMultiFileCases = map[string]struct {
 		expectedBuildErr: "syntax error: unexpected EOF, expecting }}",
 	},
 
+	"goto between {% and %}": {
+		sources: fstest.Files{
+			"index.txt": `{% goto L %}`,
+		},
+		expectedBuildErr: "index.txt:1:4: syntax error: cannot use goto between {% and %}",
+	},
+
+	"goto into a block": {
+		sources: fstest.Files{
+			"index.txt": `{%% goto L %%}{% if true %}{%% L: %%}{% end %}`,
+		},
+		expectedBuildErr: "index.txt:1:10: goto L jumps into block starting at index.txt:1:18",
+	},
+
+	"goto over a declaration": {
+		sources: fstest.Files{
+			"index.txt": `{%% goto L %%}{% a := 1 %}{%% L: %%}{{ a }}`,
+		},
+		expectedBuildErr: "index.txt:1:10: goto L jumps over declaration of a at index.txt:1:18",
+	},
+
+	"goto label not defined": {
+		sources: fstest.Files{
+			"index.txt": `{%% goto L %%}`,
+		},
+		expectedBuildErr: "index.txt:1:10: label L not defined",
+	},
+
 	"Multi line statements #1": {
 		sources: fstest.Files{
 			"index.txt": `{%%
@@ -2288,6 +2494,28 @@ var templateMultiFileCases = map[string]struct {
 		expectedBuildErr: `syntax error: macro declaration not allowed in spaces code block`,
 	},
 
+	"Markdown fenced code block": {
+		sources: fstest.Files{
+			"index.md": "```\n{{ \"a\" }}{% if true %}b{% end %}\n```\n{{ 1 }}",
+		},
+		expectedOut: "```\n{{ \"a\" }}{% if true %}b{% end %}\n```\n1",
+	},
+
+	"Markdown fenced code block - executed": {
+		sources: fstest.Files{
+			"index.md": "```\n{{ \"a\" }}{% if true %}b{% end %}\n```\n{{ 1 }}",
+		},
+		executeCodeFences: true,
+		expectedOut:       "```\nab\n```\n1",
+	},
+
+	"Markdown HTML block": {
+		sources: fstest.Files{
+			"index.md": "<div>{{ \"<b>\" }}</div>\n\n{{ \"<b>\" }}",
+		},
+		expectedOut: "<div>&lt;b&gt;</div>\n\n\\<b\\>",
+	},
+
 	"Macro used in function call - an empty string is returned": {
 		sources: fstest.Files{
 			"index.html": `{% macro M %}{% end %}{% var str = M() %}{{ len(str) }}`,
@@ -3725,6 +3953,27 @@ var templateMultiFileCases = map[string]struct {
 		expectedBuildErr: "syntax error: unexpected {, expecting expression",
 	},
 
+	"Switch with an assignment without variables": {
+		sources: fstest.Files{
+			"index.txt": `{% switch = 0 %}{% end %}`,
+		},
+		expectedBuildErr: "index.txt:1:11: syntax error: unexpected =, expecting expression",
+	},
+
+	"Label followed by a closing brace": {
+		sources: fstest.Files{
+			"index.txt": `{%% L: } %%}`,
+		},
+		expectedBuildErr: "index.txt:1:8: syntax error: unexpected }, expecting statement",
+	},
+
+	"If with two else": {
+		sources: fstest.Files{
+			"index.txt": `{% if a %}b{% else %}c{% else %}d{% end %}`,
+		},
+		expectedBuildErr: "index.txt:1:26: syntax error: unexpected else",
+	},
+
 	"https://github.com/open2b/scriggo/issues/850": {
 		sources: fstest.Files{
 			"index.txt": `{{ struct{T}{T{true}} }}`,
@@ -3772,9 +4021,9 @@ var templateMultiFileCases = map[string]struct {
 			"extended2.html": `{% extends "extended3.html" %}`,
 			"extended3.html": `{% extends "extended4.html" %}{% var V3 = 3 %}`,
 			"extended4.html": `{% extends "extended5.html" %}{% var V4 = 4 %}`,
-			"extended5.html": `{{ V3 }}{{ V4 }}`,
+			"extended5.html": `{{ V3 }}{{ V4 }}{{ V5 }}`,
 		},
-		expectedBuildErr: "extended5.html:1:4: undefined: V3",
+		expectedBuildErr: "extended5.html:1:20: undefined: V5",
 	},
 
 	"Multiple extends - with imports": {
@@ -4128,11 +4377,12 @@ func TestMultiFileTemplate(t *testing.T) {
 				globals[k] = v
 			}
 			opts := &scriggo.BuildOptions{
-				Globals:              globals,
-				Packages:             cas.importer,
-				MarkdownConverter:    markdownConverter,
-				NoParseShortShowStmt: cas.noParseShow,
-				DollarIdentifier:     cas.dollarIdentifier,
+				Globals:                   globals,
+				Packages:                  cas.importer,
+				MarkdownConverter:         markdownConverter,
+				NoParseShortShowStmt:      cas.noParseShow,
+				DollarIdentifier:          cas.dollarIdentifier,
+				ExecuteMarkdownCodeFences: cas.executeCodeFences,
 			}
 			template, err := scriggo.BuildTemplate(cas.sources, entryPoint, opts)
 			switch {
@@ -4161,6 +4411,75 @@ func TestMultiFileTemplate(t *testing.T) {
 	}
 }
 
+// TestConcurrentTypeChecking tests that the templates built with the
+// Concurrency option are the same as the templates built sequentially.
+func TestConcurrentTypeChecking(t *testing.T) {
+	for name, cas := range templateMultiFileCases {
+		t.Run(name, func(t *testing.T) {
+			entryPoint := cas.entryPoint
+			if entryPoint == "" {
+				for p := range cas.sources {
+					if strings.TrimSuffix(p, path.Ext(p)) == "index" {
+						entryPoint = p
+					}
+				}
+			}
+			globals := globals()
+			for k, v := range cas.main.Declarations {
+				globals[k] = v
+			}
+			var errs [2]string
+			var asm [2][]byte
+			var initOrder [2][]string
+			for i, concurrency := range []int{0, 4} {
+				opts := &scriggo.BuildOptions{
+					Globals:                   globals,
+					Packages:                  cas.importer,
+					MarkdownConverter:         markdownConverter,
+					NoParseShortShowStmt:      cas.noParseShow,
+					DollarIdentifier:          cas.dollarIdentifier,
+					ExecuteMarkdownCodeFences: cas.executeCodeFences,
+					Concurrency:               concurrency,
+				}
+				template, err := scriggo.BuildTemplate(cas.sources, entryPoint, opts)
+				if err != nil {
+					errs[i] = err.Error()
+					continue
+				}
+				asm[i] = disassembleTemplate(template)
+				initOrder[i] = template.InitOrder()
+			}
+			if errs[0] != errs[1] {
+				t.Fatalf("expected error %q, got %q", errs[0], errs[1])
+			}
+			if !bytes.Equal(asm[0], asm[1]) {
+				t.Fatalf("expected code:\n%s\ngot:\n%s", asm[0], asm[1])
+			}
+			if !reflect.DeepEqual(initOrder[0], initOrder[1]) {
+				t.Fatalf("expected initialization order %q, got %q", initOrder[0], initOrder[1])
+			}
+		})
+	}
+}
+
+// disassembleTemplate returns the disassembly of template, with the functions
+// sorted, or nil if the disassembler does not support its code.
+func disassembleTemplate(template *scriggo.Template) (asm []byte) {
+	defer func() {
+		if recover() != nil {
+			asm = nil
+		}
+	}()
+	functions := bytes.Split(template.Disassemble(-1), []byte("\n\n"))
+	for i, fn := range functions {
+		functions[i] = bytes.TrimSpace(fn)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return bytes.Compare(functions[i], functions[j]) < 0
+	})
+	return bytes.Join(functions, []byte("\n\n"))
+}
+
 // printFunc returns a function that print its argument to the writer w with
 // the same format used by the builtin print to print to the standard error.
 // The returned function can be used for the PrintFunc option.
@@ -4228,183 +4547,1770 @@ func TestVars(t *testing.T) {
 	}
 }
 
-var envCallPathCases = []struct {
-	name    string
-	sources fstest.Files
-	want    string
-}{
-
-	{
-		name: "Just one file",
-		sources: fstest.Files{
-			"index.html": `{{ path() }}`,
-		},
-		want: "index.html",
-	},
+// TestTemplateInitOrder tests the InitOrder method of Template.
+func TestTemplateInitOrder(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": `{% import "vars.html" %}{{ A }}`,
+		"vars.html":  `{% var A = B * 2 %}{% var B, C = 3, 4 %}`,
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"vars.html:B", "vars.html:A", "vars.html:C"}
+	if got := template.InitOrder(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
+	}
+}
 
-	{
-		name: "File rendering another file",
-		sources: fstest.Files{
-			"index.html":   `{{ path() }}, {{ render "partial.html" }}, {{ path() }}`,
-			"partial.html": `{{ path() }}`,
-		},
-		want: `index.html, partial.html, index.html`,
-	},
+// TestBuildTemplateSource tests the BuildTemplateSource function.
+func TestBuildTemplateSource(t *testing.T) {
+	opts := &scriggo.BuildOptions{Globals: native.Declarations{"name": (*string)(nil)}}
+	template, err := scriggo.BuildTemplateSource([]byte(`Hello {{ name }}, <b>{{ len(name) }}</b>`), scriggo.FormatHTML, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, map[string]interface{}{"name": "<Scriggo>"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "Hello &lt;Scriggo&gt;, <b>9</b>"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
+	}
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{% extends "layout.html" %}`, `source:1:4: syntax error: extends is not allowed in a template source`},
+		{`{% import "imp.html" %}`, `source:1:11: syntax error: import is not allowed in a template source`},
+		{`a {{ render "partial.html" }}`, `source:1:6: syntax error: render is not allowed in a template source`},
+		{`{{ a }}`, `source:1:4: undefined: a`},
+	}
+	for _, test := range tests {
+		_, err := scriggo.BuildTemplateSource([]byte(test.src), scriggo.FormatHTML, nil)
+		if err == nil {
+			t.Fatalf("%s: expected error %q, got no error", test.src, test.expected)
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("%s: expected error %q, got %q", test.src, test.expected, err)
+		}
+		if e, ok := err.(*scriggo.BuildError); !ok || e.Excerpt() == "" {
+			t.Fatalf("%s: expected a *scriggo.BuildError with an excerpt, got %#v", test.src, err)
+		}
+	}
+}
 
-	{
-		name: "File rendering a file in a sub-directory",
-		sources: fstest.Files{
-			"index.html":             `{{ path() }}, {{ render "partials/partial1.html" }}, {{ path() }}`,
-			"partials/partial1.html": `{{ path() }}, {{ render "partial2.html" }}`,
-			"partials/partial2.html": `{{ path() }}`,
+// TestTemplateSet tests the TemplateSet type.
+func TestTemplateSet(t *testing.T) {
+	roots := map[string]scriggo.TemplateRoot{
+		"web": {
+			FS: fstest.Files{
+				"partials/button.html": `{% import "icons.html" %}{% macro Button(s string) %}<button>{{ Icon() }}{{ s }}</button>{% end %}`,
+				"partials/icons.html":  `{% macro Icon %}<i></i>{% end %}`,
+				"private.html":         `{% macro Secret %}secret{% end %}`,
+				"index.html":           `{% import "partials/button.html" %}{{ Button(title) }}`,
+			},
+			Exports: []string{"partials/button.html"},
 		},
-		want: `index.html, partials/partial1.html, partials/partial2.html, index.html`,
-	},
-
-	{
-		name: "File importing another file, which defines a macro",
-		sources: fstest.Files{
-			"index.html":    `{% import "imported.html" %}{{ path() }}, {% show Path() %}, {{ path() }}`,
-			"imported.html": `{% macro Path %}{{ path() }}{% end %}`,
+		"emails": {
+			FS: fstest.Files{
+				"welcome.html": `{% import "/@web/partials/button.html" %}<p>{{ Button(title) }}</p>`,
+				"icon.html":    `{% import "/@web/partials/icons.html" %}{{ Icon() }}`,
+				"secret.html":  `{{ render "/@web/private.html" }}`,
+			},
+			Imports: []string{"web"},
 		},
-		want: `index.html, imported.html, index.html`,
-	},
-
-	{
-		name: "File extending another file",
-		sources: fstest.Files{
-			"index.html":    `{% extends "extended.html" %}{% macro Path %}{{ path() }}{% end %}`,
-			"extended.html": `{{ path() }}, {% show Path() %}`,
+		"pdf": {
+			FS: fstest.Files{
+				"doc.html": `{% import "/@web/partials/button.html" %}{{ Button(title) }}`,
+			},
 		},
-		want: `extended.html, index.html`,
-	},
-}
-
-func Test_envCallPath(t *testing.T) {
-	globals := native.Declarations{
-		"path": func(env native.Env) string { return env.CallPath() },
 	}
-	for _, cas := range envCallPathCases {
-		t.Run(cas.name, func(t *testing.T) {
-			opts := &scriggo.BuildOptions{
-				Globals: globals,
-			}
-			template, err := scriggo.BuildTemplate(cas.sources, "index.html", opts)
-			if err != nil {
-				t.Fatal(err)
-			}
-			w := &bytes.Buffer{}
-			err = template.Run(w, nil, nil)
-			if err != nil {
-				t.Fatal(err)
+	title := "Go"
+	set, err := scriggo.NewTemplateSet(roots, &scriggo.BuildOptions{Globals: native.Declarations{"title": &title}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		root, name string
+		expected   string
+		err        string
+	}{
+		{"web", "index.html", `<button><i></i>Go</button>`, ""},
+		{"emails", "welcome.html", `<p><button><i></i>Go</button></p>`, ""},
+		{"emails", "icon.html", "", "@emails/icon.html:1:11: file /@web/partials/icons.html is not visible to the files of root emails"},
+		{"emails", "secret.html", "", "@emails/secret.html:1:4: file /@web/private.html is not visible to the files of root emails"},
+		{"pdf", "doc.html", "", "@pdf/doc.html:1:11: file /@web/partials/button.html is not visible to the files of root pdf"},
+		{"pdf", "missing.html", "", "open @pdf/missing.html: file does not exist"},
+	}
+	for _, test := range tests {
+		template, err := set.Template(test.root, test.name)
+		if test.err != "" {
+			if err == nil {
+				t.Fatalf("%s %s: expected error %q, got no error", test.root, test.name, test.err)
 			}
-			if diff := cmp.Diff(cas.want, w.String()); diff != "" {
-				t.Fatalf("(-want, +got):\n%s", diff)
+			if err.Error() != test.err {
+				t.Fatalf("%s %s: expected error %q, got %q", test.root, test.name, test.err, err)
 			}
-		})
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %s", test.root, test.name, err)
+		}
+		if again, _ := set.Template(test.root, test.name); again != template {
+			t.Fatalf("%s %s: expected the same template", test.root, test.name)
+		}
+		var b bytes.Buffer
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("%s %s: unexpected error: %s", test.root, test.name, err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("%s %s: expected %q, got %q", test.root, test.name, test.expected, b.String())
+		}
+	}
+	_, err = set.Template("mobile", "index.html")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a not exist error, got %v", err)
 	}
 }
 
-func Test_treeTransformer(t *testing.T) {
-	stdout := &strings.Builder{}
-	fsys := fstest.Files{"index.html": `{% w := "hi, " %}{{ w }}world!`}
-	opts := &scriggo.BuildOptions{
-		TreeTransformer: func(tree *ast.Tree) error {
-			assignment := tree.Nodes[0].(*ast.Assignment)
-			assignment.Rhs[0].(*ast.BasicLiteral).Value = `"hello, "`
-			text := tree.Nodes[2].(*ast.Text)
-			text.Text = []byte("scriggo!")
-			return nil
-		},
+// TestTemplateNativeRefs tests the NativeRefs method of Template.
+func TestTemplateNativeRefs(t *testing.T) {
+	var title = "Scriggo"
+	globals := native.Declarations{
+		"title":   &title,
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"unused":  strings.TrimSpace,
+		"Builder": reflect.TypeOf(strings.Builder{}),
+		"missing": (*string)(nil),
 	}
-	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
-	if err != nil {
-		t.Fatal(err)
+	fsys := fstest.Files{
+		"index.html":  `{% import "macros.html" %}{{ M(title) }}{{ missing default lower("a") }}`,
+		"macros.html": `{% macro M(s string) %}{% var b Builder %}{{ upper(s) }}{{ b.Len() }}{% end %}`,
 	}
-	err = template.Run(stdout, nil, nil)
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
 	if err != nil {
 		t.Fatal(err)
 	}
-	expectedOutput := "hello, scriggo!"
-	if stdout.String() != expectedOutput {
-		t.Fatalf("expecting output %q, got %q", expectedOutput, stdout.String())
+	expected := []string{"main.Builder", "main.missing", "main.title", "main.upper"}
+	if got := template.NativeRefs(); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected %q, got %q", expected, got)
 	}
 }
 
-var mdStart = []byte("--- start Markdown ---\n")
-var mdEnd = []byte("--- end Markdown ---\n")
-
-// markdownConverter is a scriggo.Converter that it used to check that the
-// markdown converter is called. To do this, markdownConverter does not
-// convert but only wraps the Markdown code.
-func markdownConverter(src []byte, out io.Writer) error {
-	_, err := out.Write(mdStart)
-	if err == nil {
-		_, err = out.Write(src)
+func TestTemplateFingerprint(t *testing.T) {
+	var title = "Scriggo"
+	var count = 3
+	var count8 = int8(3)
+	fsys := fstest.Files{
+		"index.html":  `{% import "macros.html" %}{{ M(title) }}{{ count }}{% type T struct{ A int } %}{{ T{A: 1}.A }}`,
+		"macros.html": `{% macro M(s string) %}{{ upper(s) }}{% end %}`,
 	}
-	if err == nil {
-		_, err = out.Write(mdEnd)
+	build := func(fsys fstest.Files, globals native.Declarations) string {
+		template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprint := template.Fingerprint()
+		if fingerprint != template.Fingerprint() {
+			t.Fatal("expecting the same fingerprint for the same template")
+		}
+		return fingerprint
+	}
+	globals := native.Declarations{"title": &title, "count": &count, "upper": strings.ToUpper}
+	fingerprint := build(fsys, globals)
+	if len(fingerprint) != 64 {
+		t.Fatalf("expecting a fingerprint of 64 hexadecimal digits, got %q", fingerprint)
+	}
+	if fp := build(fsys, globals); fp != fingerprint {
+		t.Fatalf("expecting fingerprint %s for the same build, got %s", fingerprint, fp)
+	}
+	changes := []struct {
+		fsys    fstest.Files
+		globals native.Declarations
+	}{
+		{fstest.Files{"index.html": fsys["index.html"], "macros.html": `{% macro M(s string) %}{{ upper(s) }}!{% end %}`}, globals},
+		{fstest.Files{"index.html": strings.Replace(fsys["index.html"], "A int", "A int8", 1), "macros.html": fsys["macros.html"]}, globals},
+		{fsys, native.Declarations{"title": &title, "count": &count8, "upper": strings.ToUpper}},
+	}
+	for i, change := range changes {
+		if fp := build(change.fsys, change.globals); fp == fingerprint {
+			t.Fatalf("change %d: expecting a different fingerprint", i)
+		}
 	}
-	return err
 }
 
-// testErrorWriter is a writer that always return an error.
-type testErrorWriter struct {
-	err error
-}
+func TestTemplateCheckVars(t *testing.T) {
+	var title = "Scriggo"
+	fsys := fstest.Files{"index.html": `{{ title }}{{ name }}{{ count }}`}
+	globals := native.Declarations{
+		"title": &title,
+		"name":  (*string)(nil),
+		"count": (*int)(nil),
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringType := reflect.TypeOf("")
+	intType := reflect.TypeOf(0)
+	tests := []struct {
+		vars map[string]reflect.Type
+		err  string
+	}{
+		{nil, ""},
+		{map[string]reflect.Type{"name": stringType, "count": intType}, ""},
+		{map[string]reflect.Type{"name": reflect.PtrTo(stringType), "count": reflect.PtrTo(intType)}, ""},
+		{map[string]reflect.Type{"name": stringType, "other": intType}, ""},
+		{map[string]reflect.Type{"count": stringType}, `variable initializer "count" must have type int or *int, but have string`},
+		{map[string]reflect.Type{"name": nil}, `variable initializer "name" cannot be nil`},
+		{map[string]reflect.Type{"title": stringType}, `variable "title" already initialized`},
+	}
+	for _, test := range tests {
+		err := template.CheckVars(test.vars)
+		if err == nil {
+			if test.err != "" {
+				t.Fatalf("vars %v: expecting error %q, got no error", test.vars, test.err)
+			}
+			continue
+		}
+		if err.Error() != test.err {
+			t.Fatalf("vars %v: expecting error %q, got %q", test.vars, test.err, err)
+		}
+	}
+	// Run with the checked variables.
+	var b strings.Builder
+	err = template.Run(&b, map[string]interface{}{"name": "Ada", "count": 5}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "ScriggoAda5" {
+		t.Fatalf("expecting %q, got %q", "ScriggoAda5", b.String())
+	}
+	// Run with invalid variables returns the same errors of CheckVars.
+	for expected, vars := range map[string]map[string]interface{}{
+		`variable initializer "count" must have type int or *int, but have string`: {"count": "5"},
+		`variable initializer "name" cannot be nil`:                                {"name": nil},
+		`variable initializer "name" cannot be a nil pointer`:                      {"name": (*string)(nil)},
+		`variable "title" already initialized`:                                     {"title": "Go"},
+	} {
+		b.Reset()
+		err = template.Run(&b, vars, nil)
+		if err == nil {
+			t.Fatalf("expecting error %q, got no error", expected)
+		}
+		if err.Error() != expected {
+			t.Fatalf("expecting error %q, got %q", expected, err)
+		}
+		if b.Len() > 0 {
+			t.Fatalf("expecting no output, got %q", b.String())
+		}
+	}
+}
 
-func (t testErrorWriter) Write(p []byte) (int, error) { return 0, t.err }
+// testHTMLWriterTo implements native.HTMLWriterTo.
+type testHTMLWriterTo struct {
+	html string
+}
 
-// TestOutError tests that in case of an out error, the Run method returns it.
-func TestOutError(t *testing.T) {
-	fsys := fstest.Files{"index.txt": "a"}
+func (h testHTMLWriterTo) WriteHTMLTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, h.html)
+	return int64(n), err
+}
+
+func TestShowWriterTo(t *testing.T) {
+	reader := func(s string) **strings.Reader {
+		r := strings.NewReader(s)
+		return &r
+	}
+	html := func(s string) *testHTMLWriterTo {
+		return &testHTMLWriterTo{s}
+	}
+	tests := []struct {
+		name  string
+		src   string
+		value interface{}
+		want  string
+		err   string
+	}{
+		{"index.txt", `{{ v }}`, reader(`<a href="x">'b'</a>`), `<a href="x">'b'</a>`, ""},
+		{"index.html", `{{ v }}`, reader(`<a href="x">'b'</a> &`), `&lt;a href=&#34;x&#34;&gt;&#39;b&#39;&lt;/a&gt; &amp;`, ""},
+		{"index.html", `{{ v }}`, html(`<a href="x">b</a>`), `<a href="x">b</a>`, ""},
+		{"index.html", `<a href="{{ v }}">`, reader("b"), "", "index.html:1:10: cannot show v (cannot show type *strings.Reader as quoted attribute)"},
+		{"index.css", `{{ v }}`, html("b"), "", "index.css:1:1: cannot show v (cannot show type misc.testHTMLWriterTo as CSS)"},
+	}
+	for _, test := range tests {
+		fsys := fstest.Files{test.name: test.src}
+		globals := native.Declarations{"v": test.value}
+		template, err := scriggo.BuildTemplate(fsys, test.name, &scriggo.BuildOptions{Globals: globals})
+		if err != nil {
+			if test.err == "" {
+				t.Fatalf("%s: unexpected error: %s", test.src, err)
+			}
+			if err.Error() != test.err {
+				t.Fatalf("%s: expecting error %q, got %q", test.src, test.err, err)
+			}
+			continue
+		}
+		if test.err != "" {
+			t.Fatalf("%s: expecting error %q, got no error", test.src, test.err)
+		}
+		var b strings.Builder
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.src, err)
+		}
+		if b.String() != test.want {
+			t.Fatalf("%s: expecting %q, got %q", test.src, test.want, b.String())
+		}
+	}
+}
+
+// testFlushWriter is a writer that records the length of the written output
+// each time it is flushed.
+type testFlushWriter struct {
+	strings.Builder
+	flushes []int
+	err     error
+}
+
+func (w *testFlushWriter) Flush() error {
+	w.flushes = append(w.flushes, w.Len())
+	return w.err
+}
+
+func TestFlushThreshold(t *testing.T) {
+	fsys := fstest.Files{"index.txt": `{% for i := 0; i < 5; i++ %}0123456789{% end %}`}
 	template, err := scriggo.BuildTemplate(fsys, "index.txt", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	out := testErrorWriter{errors.New("out error")}
-	panicked := true
-	var rec interface{}
-	func() {
-		defer func() {
-			rec = recover()
-		}()
-		err = template.Run(out, nil, nil)
-		panicked = false
-	}()
-	if panicked {
-		t.Fatalf("expecting error, got panic: %v", rec)
+	tests := []struct {
+		threshold int
+		flushes   []int
+	}{
+		{0, nil},
+		{10, []int{10, 20, 30, 40, 50}},
+		{15, []int{20, 40, 50}},
+		{100, []int{50}},
+	}
+	for _, test := range tests {
+		w := &testFlushWriter{}
+		err = template.Run(w, nil, &scriggo.RunOptions{FlushThreshold: test.threshold})
+		if err != nil {
+			t.Fatalf("threshold %d: unexpected error: %s", test.threshold, err)
+		}
+		if w.Len() != 50 {
+			t.Fatalf("threshold %d: expecting 50 bytes, got %d", test.threshold, w.Len())
+		}
+		if !reflect.DeepEqual(w.flushes, test.flushes) {
+			t.Fatalf("threshold %d: expecting flushes %v, got %v", test.threshold, test.flushes, w.flushes)
+		}
+	}
+	// An error returned by Flush is returned by Run.
+	w := &testFlushWriter{err: errors.New("flush error")}
+	err = template.Run(w, nil, &scriggo.RunOptions{FlushThreshold: 10})
+	if err != w.err {
+		t.Fatalf("expecting error %v, got %v", w.err, err)
+	}
+}
+
+func TestJSONNonFinite(t *testing.T) {
+	fsys := fstest.Files{"index.json": `{{ a }}`}
+	tests := []struct {
+		value interface{}
+		mode  scriggo.JSONNonFinite
+		want  string
+		err   string
+	}{
+		{math.NaN(), scriggo.JSONNonFiniteNull, `null`, ""},
+		{math.Inf(1), scriggo.JSONNonFiniteNull, `null`, ""},
+		{[]float64{1.5, math.Inf(-1)}, scriggo.JSONNonFiniteNull, `[1.5,null]`, ""},
+		{float32(math.NaN()), scriggo.JSONNonFiniteString, `"NaN"`, ""},
+		{math.Inf(1), scriggo.JSONNonFiniteString, `"+Inf"`, ""},
+		{map[string]float64{"a": math.Inf(-1)}, scriggo.JSONNonFiniteString, `{"a":"-Inf"}`, ""},
+		{1.5, scriggo.JSONNonFiniteError, `1.5`, ""},
+		{math.NaN(), scriggo.JSONNonFiniteError, ``, "cannot show NaN as JSON"},
+		{[]float64{1.5, math.Inf(1)}, scriggo.JSONNonFiniteError, `[1.5,`, "cannot show +Inf as JSON"},
+	}
+	for _, test := range tests {
+		globals := native.Declarations{"a": &test.value}
+		template, err := scriggo.BuildTemplate(fsys, "index.json", &scriggo.BuildOptions{Globals: globals})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		err = template.Run(&b, nil, &scriggo.RunOptions{JSONNonFinite: test.mode})
+		if err != nil {
+			if test.err == "" {
+				t.Fatalf("%v: unexpected error: %s", test.value, err)
+			}
+			if err.Error() != test.err {
+				t.Fatalf("%v: expecting error %q, got %q", test.value, test.err, err)
+			}
+		} else if test.err != "" {
+			t.Fatalf("%v: expecting error %q, got no error", test.value, test.err)
+		}
+		if b.String() != test.want {
+			t.Fatalf("%v: expecting %q, got %q", test.value, test.want, b.String())
+		}
+	}
+}
+
+func TestJSONNonFiniteWarnings(t *testing.T) {
+	type S struct {
+		A int
+		B float32
+		C float64 `json:"-"`
+	}
+	fsys := fstest.Files{"index.json": `{"a": {{ 1.5 }}, "b": {{ f }}, "c": {{ n }}, "d": {{ s }}, "e": {{ []S{} }}, "f": "{{ f }}"}`}
+	globals := native.Declarations{
+		"f": (*float64)(nil),
+		"n": (*int)(nil),
+		"s": (*[]string)(nil),
+		"S": reflect.TypeOf(S{}),
+	}
+	var warnings []string
+	options := &scriggo.BuildOptions{
+		Globals: globals,
+		Warn: func(path string, pos scriggo.Position, msg string) {
+			warnings = append(warnings, path+":"+pos.String()+": "+msg)
+		},
+	}
+	_, err := scriggo.BuildTemplate(fsys, "index.json", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"index.json:1:26: f shown in JSON context can be NaN or infinite",
+		"index.json:1:71: []S{} shown in JSON context can be NaN or infinite",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Fatalf("expecting warnings %q, got %q", expected, warnings)
+	}
+}
+
+// TestTemplateDebugger tests the Debugger run option with templates.
+func TestTemplateDebugger(t *testing.T) {
+	fsys := fstest.Files{
+		"index.txt": "{% import \"imp.txt\" %}\n{% s := \"a\" %}\n{{ s }}\n{{ M(s) }}\n{% s = \"b\" %}",
+		"imp.txt":   "{% macro M(s string) %}\n{{ s }}\n{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", &scriggo.BuildOptions{Debug: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stops []string
+	var d *scriggo.Debugger
+	d = scriggo.NewDebugger(func(frame *scriggo.DebugFrame) {
+		stops = append(stops, frame.Path+":"+frame.Position.String())
+		if frame.Path == "index.txt" && frame.Position.Line == 2 {
+			d.Step()
+		}
+	})
+	d.SetBreakpoint("index.txt", 2)
+	d.SetBreakpoint("imp.txt", 2)
+	var b strings.Builder
+	err = template.Run(&b, nil, &scriggo.RunOptions{Debugger: d})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := "a\na\n\n"; b.String() != expected {
+		t.Fatalf("expected output %q, got %q", expected, b.String())
+	}
+	expected := []string{"index.txt:2:4", "index.txt:3:1", "imp.txt:2:1"}
+	if !reflect.DeepEqual(stops, expected) {
+		t.Fatalf("expected stops %q, got %q", expected, stops)
+	}
+}
+
+// TestPrologueEpilogue tests the Prologue and Epilogue options.
+func TestPrologueEpilogue(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":  "{% extends \"layout.html\" %}{% macro Body %}<b>{{ s }}</b>{% end %}",
+		"layout.html": "<p>{{ Body() }}</p>",
+		"index.json":  "{\"s\": {{ s }}}",
+		"index.txt":   "{{ s }}",
+		"error.json":  "{{ 1 / z }}",
+	}
+	options := &scriggo.BuildOptions{
+		Globals: native.Declarations{"s": (*string)(nil), "z": (*int)(nil)},
+		Prologue: map[scriggo.Format]string{
+			scriggo.FormatHTML: "<!DOCTYPE html>\n",
+			scriggo.FormatJSON: ")]}',\n",
+		},
+		Epilogue: map[scriggo.Format]string{
+			scriggo.FormatHTML: "\n",
+			scriggo.FormatJSON: "\n",
+		},
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"index.html", "<!DOCTYPE html>\n<p><b>a&lt;b</b></p>\n"},
+		{"index.json", ")]}',\n{\"s\": \"a\\u003cb\"}\n"},
+		{"index.txt", "a<b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := scriggo.BuildTemplate(fsys, test.name, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b strings.Builder
+			err = template.Run(&b, map[string]interface{}{"s": "a<b"}, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if b.String() != test.expected {
+				t.Fatalf("expected %q, got %q", test.expected, b.String())
+			}
+		})
+	}
+	// The epilogue is not written if the execution fails.
+	template, err := scriggo.BuildTemplate(fsys, "error.json", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = template.Run(&b, nil, nil)
+	if _, ok := err.(*scriggo.PanicError); !ok {
+		t.Fatalf("expected a *scriggo.PanicError error, got %#v", err)
+	}
+	if expected := ")]}',\n"; b.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, b.String())
 	}
+}
+
+// TestAllowedGlobals tests the AllowedGlobals option.
+func TestAllowedGlobals(t *testing.T) {
+	var title = "Scriggo"
+	globals := native.Declarations{
+		"title":     &title,
+		"htmlEsc":   func(s string) string { return s },
+		"htmlTrim":  strings.TrimSpace,
+		"secret":    "s3cr3t",
+		"Secret":    reflect.TypeOf(""),
+		"strings":   native.Package{Name: "strings", Declarations: native.Declarations{"ToUpper": strings.ToUpper, "ToLower": strings.ToLower}},
+		"untrusted": func() string { return "" },
+	}
+	tests := []struct {
+		src      string
+		allowed  []string
+		expected string
+	}{
+		{`{{ title }}{{ secret }}`, nil, ""},
+		{`{{ title }}{{ htmlEsc("a") }}{{ strings.ToUpper("b") }}`, []string{"title", "html*", "strings.*"}, ""},
+		{`{{ title }}`, []string{}, "index.html:1:4: use of disallowed global title\n\tindex.html:1:4: title"},
+		{`{{ title }}{{ htmlTrim(secret) }}{% var s Secret %}{{ s }}{{ strings.ToLower(untrusted()) }}`,
+			[]string{"title", "htmlTrim", "strings.ToUpper"},
+			"index.html:1:24: use of disallowed global secret\n\tindex.html:1:24: secret\n\tindex.html:1:43: Secret" +
+				"\n\tindex.html:1:69: strings.ToLower\n\tindex.html:1:78: untrusted"},
+		{`{% import "imported.html" %}{{ secret default "" }}{{ A }}`, []string{"secret"},
+			"imported.html:1:12: use of disallowed global title\n\timported.html:1:12: title"},
+		{`{% import "imported.html" %}{{ secret default "" }}{{ A }}`, []string{"title"},
+			"index.html:1:32: use of disallowed global secret\n\tindex.html:1:32: secret"},
+	}
+	for _, test := range tests {
+		fsys := fstest.Files{"index.html": test.src, "imported.html": `{% var A = title %}`}
+		opts := &scriggo.BuildOptions{Globals: globals, AllowedGlobals: test.allowed}
+		_, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+		if err != nil {
+			if test.expected == "" {
+				t.Fatalf("source %q: unexpected error: %s", test.src, err)
+			}
+			if got := err.Error(); got != test.expected {
+				t.Fatalf("source %q: expected error %q, got %q", test.src, test.expected, got)
+			}
+			continue
+		}
+		if test.expected != "" {
+			t.Fatalf("source %q: expected error %q, got no error", test.src, test.expected)
+		}
+	}
+	opts := &scriggo.BuildOptions{AllowedGlobals: []string{"[a-"}}
+	_, err := scriggo.BuildTemplate(fstest.Files{"index.html": ``}, "index.html", opts)
 	if err == nil {
-		t.Fatalf("expecting error, got no error")
+		t.Fatal("expected error for an invalid pattern, got no error")
 	}
-	if err != out.err {
-		t.Fatalf("expecting out error, got error %q", err)
+}
+
+// TestDisabledBuiltins tests the DisabledBuiltins option.
+func TestDisabledBuiltins(t *testing.T) {
+	tests := []struct {
+		src      string
+		disabled []string
+		expected string
+	}{
+		{`{{ len("a") }}{% print("b") %}`, nil, ""},
+		{`{{ len("a") }}{% print("b") %}`, []string{"println", "panic"}, ""},
+		{`{{ len("a") }}{% print("b") %}`, []string{"print"}, "index.html:1:18: use of disabled builtin print"},
+		{`{% defer println("a") %}`, []string{"println"}, "index.html:1:10: use of disabled builtin println"},
+		{`{% if false %}{% panic("a") %}{% end %}`, []string{"panic"}, "index.html:1:18: use of disabled builtin panic"},
+		{`{{ html("<b>") }}`, []string{"html"}, "index.html:1:4: use of disabled builtin html"},
+		{`{% var s html %}{{ s }}`, []string{"html"}, "index.html:1:10: use of disabled builtin html"},
+		{`{% print := func(s string) string { return s } %}{{ print("a") }}`, []string{"print"}, ""},
+	}
+	for _, test := range tests {
+		fsys := fstest.Files{"index.html": test.src}
+		opts := &scriggo.BuildOptions{DisabledBuiltins: test.disabled}
+		_, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+		if err != nil {
+			if test.expected == "" {
+				t.Fatalf("source %q: unexpected error: %s", test.src, err)
+			}
+			if got := err.Error(); got != test.expected {
+				t.Fatalf("source %q: expected error %q, got %q", test.src, test.expected, got)
+			}
+			continue
+		}
+		if test.expected != "" {
+			t.Fatalf("source %q: expected error %q, got no error", test.src, test.expected)
+		}
 	}
 }
 
-// TestRecoveredOutError tests that in case of an out error, it can be
-// recovered.
-func TestRecoveredOutError(t *testing.T) {
-	fsys := fstest.Files{"index.txt": "{% defer func() { recover() }() %}a"}
-	template, err := scriggo.BuildTemplate(fsys, "index.txt", nil)
+// TestTemplateBuildMetrics tests the Metrics build option with templates.
+func TestTemplateBuildMetrics(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":  `{% extends "layout.html" %}{% import "macros.html" %}{% macro Body %}{{ Button("ok") }}{% end %}`,
+		"layout.html": `<body>{{ Body() }}{{ render "footer.html" }}</body>`,
+		"macros.html": `{% macro Button(label string) %}<button>{{ label }}</button>{% end %}`,
+		"footer.html": `{{ 1 + 2 }}`,
+	}
+	metrics := &scriggo.BuildMetrics{}
+	_, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Metrics: metrics})
 	if err != nil {
 		t.Fatal(err)
 	}
-	out := testErrorWriter{errors.New("out error")}
-	panicked := true
-	var rec interface{}
-	func() {
-		defer func() {
-			rec = recover()
-		}()
-		err = template.Run(out, nil, nil)
-		panicked = false
-	}()
-	if panicked {
-		t.Fatalf("expecting no error, got panic: %v", rec)
+	if metrics.ParseTime <= 0 || metrics.CheckTime <= 0 || metrics.EmitTime <= 0 {
+		t.Fatalf("expected positive durations, got %s, %s and %s", metrics.ParseTime, metrics.CheckTime, metrics.EmitTime)
+	}
+	if metrics.Nodes < 15 {
+		t.Fatalf("expected at least 15 nodes, got %d", metrics.Nodes)
+	}
+	files := map[string]bool{}
+	for _, fn := range metrics.Functions {
+		files[fn.File] = true
 	}
+	for _, file := range []string{"index.html", "layout.html", "macros.html", "footer.html"} {
+		if !files[file] {
+			t.Fatalf("expected a function in file %s, got %v", file, metrics.Functions)
+		}
+	}
+}
+
+// TestTemplateTree tests the Tree method of Template.
+func TestTemplateTree(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": `{% extends "layout.html" %}{% import "macros.html" %}{% macro Body %}{{ Button("ok") }}{% end %}`,
+		"layout.html": `<body>{{ Body() }}{% for parallel v in []int{1} %}{{ v }}{% end %}` +
+			`{% for i in 1..2 %}{{ i }}{% end %}{{ render "footer.html" }}</body>`,
+		"macros.html": `{# Button renders a button. #}{% macro Button(label string) %}<button>{{ label }}</button>{% end %}`,
+		"footer.html": `{% switch %}{% case true %}{{ 1 > 0 ? "a" : "b" }}{% end %}{% raw %}{{ x }}{% end %}`,
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{AllowGoStmt: true})
 	if err != nil {
-		t.Fatalf("expecting no error, got error %v", err)
+		t.Fatal(err)
+	}
+	if tree := template.Tree(); tree != nil {
+		t.Fatalf("expecting nil tree, got %v", tree)
+	}
+	template, err = scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{AllowGoStmt: true, KeepTree: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := template.Tree()
+	if tree == nil {
+		t.Fatal("expecting tree, got nil")
+	}
+	if tree.Path != "index.html" {
+		t.Fatalf("expecting path %q, got %q", "index.html", tree.Path)
+	}
+	extends, ok := tree.Nodes[0].(*ast.Extends)
+	if !ok {
+		t.Fatalf("expecting *ast.Extends node, got %T", tree.Nodes[0])
+	}
+	if extends.Tree == nil || extends.Tree.Path != "layout.html" {
+		t.Fatalf("expecting the tree of %q in the extends node", "layout.html")
+	}
+	imp, ok := tree.Nodes[1].(*ast.Import)
+	if !ok {
+		t.Fatalf("expecting *ast.Import node, got %T", tree.Nodes[1])
+	}
+	if imp.Tree == nil || len(imp.Tree.Nodes) != 2 {
+		t.Fatalf("expecting the tree of %q with two nodes in the import node", "macros.html")
+	}
+	if c, ok := imp.Tree.Nodes[0].(*ast.Comment); !ok || c.Text != " Button renders a button. " {
+		t.Fatalf("expecting the comment of the Button macro, got %v", imp.Tree.Nodes[0])
+	}
+	if m, ok := imp.Tree.Nodes[1].(*ast.Func); !ok || m.Ident.Name != "Button" {
+		t.Fatalf("expecting the Button macro, got %v", imp.Tree.Nodes[1])
+	}
+	// Changing the returned tree must not change the tree of the template.
+	tree.Nodes = nil
+	if tree = template.Tree(); len(tree.Nodes) != 3 {
+		t.Fatalf("expecting 3 nodes, got %d", len(tree.Nodes))
+	}
+}
+
+// TestTemplateParserLimits tests the parser limits of the build options.
+func TestTemplateParserLimits(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":  `{% import "macros.html" %}{{ Box("a") }}`,
+		"macros.html": `{% macro Box(s string) %}{% if s != "" %}{% for c in s %}{{ ((c)) }}{% end %}{% end %}{% end %}`,
+	}
+	tests := []struct {
+		options  scriggo.BuildOptions
+		expected string
+	}{
+		{scriggo.BuildOptions{MaxExpressionDepth: 3, MaxNestingDepth: 3, MaxFileSize: 100}, ""},
+		{scriggo.BuildOptions{MaxExpressionDepth: 2}, "macros.html:1:63: syntax error: expression nested too deeply (maximum depth is 2)"},
+		{scriggo.BuildOptions{MaxNestingDepth: 2}, "macros.html:1:45: syntax error: statements nested too deeply (maximum depth is 2)"},
+		{scriggo.BuildOptions{MaxFileSize: 50}, "macros.html:1:51: syntax error: file size exceeds the maximum of 50 bytes"},
+	}
+	for _, test := range tests {
+		_, err := scriggo.BuildTemplate(fsys, "index.html", &test.options)
+		if err == nil {
+			if test.expected != "" {
+				t.Fatalf("expecting error %q, got nothing", test.expected)
+			}
+			continue
+		}
+		if err.Error() != test.expected {
+			t.Fatalf("expecting error %q, got %q", test.expected, err)
+		}
+	}
+}
+
+// TestBuildErrorExcerpt tests the Excerpt method of BuildError.
+func TestBuildErrorExcerpt(t *testing.T) {
+	tests := []struct {
+		files    fstest.Files
+		expected string
+	}{
+		{fstest.Files{"index.html": "a\n{{ 1 + \"b\" }}\nc"}, "{{ 1 + \"b\" }}\n   ^"},
+		{fstest.Files{"index.html": "<p>\r\n\t\t{{ undefinedName }}\r\n</p>"}, "\t\t{{ undefinedName }}\n\t\t   ^"},
+		{fstest.Files{"index.html": "{% import \"imported.html\" %}", "imported.html": "{% var a = 1 %}\n{% macro M %}àè{% if %}{% end %}{% end %}"}, "{% macro M %}àè{% if %}{% end %}{% end %}\n                     ^"},
+		{fstest.Files{"index.html": "{% extends \"layout.html\" %}", "layout.html": "{{ 5 }"}, "{{ 5 }\n     ^"},
+	}
+	for _, test := range tests {
+		_, err := scriggo.BuildTemplate(test.files, "index.html", nil)
+		if err == nil {
+			t.Fatalf("expecting error, got no error")
+		}
+		e, ok := err.(*scriggo.BuildError)
+		if !ok {
+			t.Fatalf("expecting a *scriggo.BuildError error, got %T", err)
+		}
+		if excerpt := e.Excerpt(); excerpt != test.expected {
+			t.Fatalf("error %q: expecting excerpt %q, got %q", err, test.expected, excerpt)
+		}
+	}
+}
+
+var envCallPathCases = []struct {
+	name    string
+	sources fstest.Files
+	want    string
+}{
+
+	{
+		name: "Just one file",
+		sources: fstest.Files{
+			"index.html": `{{ path() }}`,
+		},
+		want: "index.html",
+	},
+
+	{
+		name: "File rendering another file",
+		sources: fstest.Files{
+			"index.html":   `{{ path() }}, {{ render "partial.html" }}, {{ path() }}`,
+			"partial.html": `{{ path() }}`,
+		},
+		want: `index.html, partial.html, index.html`,
+	},
+
+	{
+		name: "File rendering a file in a sub-directory",
+		sources: fstest.Files{
+			"index.html":             `{{ path() }}, {{ render "partials/partial1.html" }}, {{ path() }}`,
+			"partials/partial1.html": `{{ path() }}, {{ render "partial2.html" }}`,
+			"partials/partial2.html": `{{ path() }}`,
+		},
+		want: `index.html, partials/partial1.html, partials/partial2.html, index.html`,
+	},
+
+	{
+		name: "File importing another file, which defines a macro",
+		sources: fstest.Files{
+			"index.html":    `{% import "imported.html" %}{{ path() }}, {% show Path() %}, {{ path() }}`,
+			"imported.html": `{% macro Path %}{{ path() }}{% end %}`,
+		},
+		want: `index.html, imported.html, index.html`,
+	},
+
+	{
+		name: "File extending another file",
+		sources: fstest.Files{
+			"index.html":    `{% extends "extended.html" %}{% macro Path %}{{ path() }}{% end %}`,
+			"extended.html": `{{ path() }}, {% show Path() %}`,
+		},
+		want: `extended.html, index.html`,
+	},
+}
+
+func Test_envCallPath(t *testing.T) {
+	globals := native.Declarations{
+		"path": func(env native.Env) string { return env.CallPath() },
+	}
+	for _, cas := range envCallPathCases {
+		t.Run(cas.name, func(t *testing.T) {
+			opts := &scriggo.BuildOptions{
+				Globals: globals,
+			}
+			template, err := scriggo.BuildTemplate(cas.sources, "index.html", opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &bytes.Buffer{}
+			err = template.Run(w, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(cas.want, w.String()); diff != "" {
+				t.Fatalf("(-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func Test_treeTransformer(t *testing.T) {
+	stdout := &strings.Builder{}
+	fsys := fstest.Files{"index.html": `{% w := "hi, " %}{{ w }}world!`}
+	opts := &scriggo.BuildOptions{
+		TreeTransformer: func(tree *ast.Tree) error {
+			assignment := tree.Nodes[0].(*ast.Assignment)
+			assignment.Rhs[0].(*ast.BasicLiteral).Value = `"hello, "`
+			text := tree.Nodes[2].(*ast.Text)
+			text.Text = []byte("scriggo!")
+			return nil
+		},
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(stdout, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOutput := "hello, scriggo!"
+	if stdout.String() != expectedOutput {
+		t.Fatalf("expecting output %q, got %q", expectedOutput, stdout.String())
+	}
+}
+
+var mdStart = []byte("--- start Markdown ---\n")
+var mdEnd = []byte("--- end Markdown ---\n")
+
+// markdownConverter is a scriggo.Converter that it used to check that the
+// markdown converter is called. To do this, markdownConverter does not
+// convert but only wraps the Markdown code.
+func markdownConverter(src []byte, out io.Writer) error {
+	_, err := out.Write(mdStart)
+	if err == nil {
+		_, err = out.Write(src)
+	}
+	if err == nil {
+		_, err = out.Write(mdEnd)
+	}
+	return err
+}
+
+// testErrorWriter is a writer that always return an error.
+type testErrorWriter struct {
+	err error
+}
+
+func (t testErrorWriter) Write(p []byte) (int, error) { return 0, t.err }
+
+// TestOutError tests that in case of an out error, the Run method returns it.
+func TestOutError(t *testing.T) {
+	fsys := fstest.Files{"index.txt": "a"}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := testErrorWriter{errors.New("out error")}
+	panicked := true
+	var rec interface{}
+	func() {
+		defer func() {
+			rec = recover()
+		}()
+		err = template.Run(out, nil, nil)
+		panicked = false
+	}()
+	if panicked {
+		t.Fatalf("expecting error, got panic: %v", rec)
+	}
+	if err == nil {
+		t.Fatalf("expecting error, got no error")
+	}
+	if err != out.err {
+		t.Fatalf("expecting out error, got error %q", err)
+	}
+}
+
+// TestRecoveredOutError tests that in case of an out error, it can be
+// recovered.
+func TestRecoveredOutError(t *testing.T) {
+	fsys := fstest.Files{"index.txt": "{% defer func() { recover() }() %}a"}
+	template, err := scriggo.BuildTemplate(fsys, "index.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := testErrorWriter{errors.New("out error")}
+	panicked := true
+	var rec interface{}
+	func() {
+		defer func() {
+			rec = recover()
+		}()
+		err = template.Run(out, nil, nil)
+		panicked = false
+	}()
+	if panicked {
+		t.Fatalf("expecting no error, got panic: %v", rec)
+	}
+	if err != nil {
+		t.Fatalf("expecting no error, got error %v", err)
+	}
+}
+
+// TestSanitizers tests the conversions between format types with sanitizers.
+func TestSanitizers(t *testing.T) {
+	sanitizers := []interface{}{
+		func(s native.JS) native.HTML {
+			return native.HTML("<script>" + strings.ReplaceAll(string(s), "<", `\x3c`) + "</script>")
+		},
+		func(s string) native.CSS { return native.CSS(strings.Trim(string(s), "{}")) },
+	}
+	tests := []struct {
+		src      string
+		expected string
+		err      string
+	}{
+		{`{% var s js = "a<b" %}{{ html(s) }}`, `<script>a\x3cb</script>`, ""},
+		{`{% var s js = "a<b" %}{% h := html(s) %}{{ len(h) }}`, "23", ""},
+		{`{% const s js = "a<b" %}{{ html(s) }}`, `<script>a\x3cb</script>`, ""},
+		{`{% s := "{x}" %}<style>{{ css(s) }}</style>`, "<style>x</style>", ""},
+		{`{{ css("{x}") }}`, "{x}", ""},
+		{`{% var s css = "x" %}{{ html(s) }}`, "", `cannot convert s (type native.CSS) to type native.HTML`},
+		{`{% var s js = "x" %}{{ json(s) }}`, "", `cannot convert s (type native.JS) to type native.JSON`},
+		{`{% var s js = "x" %}{% defer html(s) %}`, "", `defer requires function call, not conversion`},
+	}
+	for _, test := range tests {
+		fsys := fstest.Files{"index.html": test.src}
+		template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Sanitizers: sanitizers})
+		if err != nil {
+			if test.err == "" {
+				t.Fatalf("source %q: unexpected error: %s", test.src, err)
+			}
+			if e, ok := err.(*scriggo.BuildError); !ok || e.Message() != test.err {
+				t.Fatalf("source %q: expecting error %q, got %q", test.src, test.err, err)
+			}
+			continue
+		}
+		if test.err != "" {
+			t.Fatalf("source %q: expecting error %q, got no error", test.src, test.err)
+		}
+		var b strings.Builder
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("source %q: unexpected error: %s", test.src, err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("source %q: expecting %q, got %q", test.src, test.expected, b.String())
+		}
+	}
+	// Without sanitizers, the non-constant values cannot be converted.
+	for _, src := range []string{
+		`{% s := "<b>" %}{{ html(s) }}`,
+		`{% var s string = "<b>" %}<script>{{ js(s) }}</script>`,
+		`{% s := "{x}" %}<style>{{ css(s) }}</style>`,
+		`{% var s js = "x" %}{{ html(s) }}`,
+		`{{ html(v) }}`,
+	} {
+		fsys := fstest.Files{"index.html": src}
+		_, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{
+			Globals: native.Declarations{"v": (*string)(nil)},
+		})
+		if err == nil {
+			t.Fatalf("source %q: expecting error, got no error", src)
+		}
+		if e, ok := err.(*scriggo.BuildError); !ok || !strings.HasPrefix(e.Message(), "cannot convert ") {
+			t.Fatalf("source %q: expecting conversion error, got %q", src, err)
+		}
+	}
+	invalid := []struct {
+		sanitizer interface{}
+		err       string
+	}{
+		{func(s native.JS) string { return "" }, "scriggo: invalid sanitizer type func(native.JS) string"},
+		{func(s native.JS) native.JS { return s }, "scriggo: invalid sanitizer type func(native.JS) native.JS"},
+		{func(s int) native.HTML { return "" }, "scriggo: invalid sanitizer type func(int) native.HTML"},
+		{func(s native.JS, t native.JS) native.HTML { return "" }, "scriggo: invalid sanitizer type func(native.JS, native.JS) native.HTML"},
+		{func(s native.Markdown) native.HTML { return "" }, "scriggo: invalid sanitizer type func(native.Markdown) native.HTML: conversion from markdown to html uses the Markdown converter"},
+		{sanitizers[0], "scriggo: duplicate sanitizer for conversion from native.JS to native.HTML"},
+	}
+	for _, test := range invalid {
+		fsys := fstest.Files{"index.html": ""}
+		_, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Sanitizers: append(sanitizers[:2:2], test.sanitizer)})
+		if err == nil {
+			t.Fatalf("expecting error %q, got no error", test.err)
+		}
+		if err.Error() != test.err {
+			t.Fatalf("expecting error %q, got %q", test.err, err)
+		}
+	}
+}
+
+// TestParallelFor tests the execution of the parallel for statement with
+// different values of the MaxGoroutines option and the propagation of the
+// panics raised in the iterations.
+func TestParallelFor(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{`{% for parallel v in []int{1, 2, 3, 4, 5} %}<{{ v }}>{% end %}`, "<1><2><3><4><5>"},
+		{`{% for parallel v in []string{} %}{{ v }}{% else %}empty{% end %}`, "empty"},
+		{`{% n := 3 %}{% for parallel v in []int{1, 2} %}{% s := v * n %}{{ s }} {% end %}`, "3 6 "},
+		{`{% for parallel i in []int{1, 2} %}{% for parallel j in []int{3, 4} %}{{ i }}{{ j }} {% end %}{% end %}`, "13 14 23 24 "},
+		{`{% a := [3]int{1, 2, 3} %}{% for parallel v in &a %}{{ v }}{% end %}`, "123"},
+		{`{% for parallel v in []string{"a", "b"} %}{{ upper(v) }}{% f := func() string { return v } %}{{ f() }}{% end %}`, "AaBb"},
+	}
+	opts := &scriggo.BuildOptions{AllowGoStmt: true, Globals: native.Declarations{"upper": strings.ToUpper}}
+	for _, test := range tests {
+		fsys := fstest.Files{"index.html": test.src}
+		template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+		if err != nil {
+			t.Fatalf("source %q: build error: %s", test.src, err)
+		}
+		var b bytes.Buffer
+		err = template.Run(&b, nil, nil)
+		if err != nil {
+			t.Fatalf("source %q: run error: %s", test.src, err)
+		}
+		if b.String() != test.expected {
+			t.Fatalf("source %q: expecting %q, got %q", test.src, test.expected, b.String())
+		}
+	}
+	// Without the AllowGoStmt option, the parallel for is not available.
+	fsys := fstest.Files{"index.html": tests[0].src}
+	_, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+	if !strings.Contains(err.Error(), `"for parallel" statement not available`) {
+		t.Fatalf("unexpected error %q", err)
+	}
+	fsys = fstest.Files{"index.html": `{% for parallel v in s %}{% if v == 0 %}{{ 1 / v }}{% end %}{{ v * 2 }},{% else %}empty{% end %}`}
+	var s []int
+	opts = &scriggo.BuildOptions{AllowGoStmt: true, Globals: native.Declarations{"s": &s}}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = make([]int, 100)
+	var expected strings.Builder
+	for i := range s {
+		s[i] = i + 1
+		expected.WriteString(strconv.Itoa(2*(i+1)) + ",")
+	}
+	for _, n := range []int{0, 1, 2, 200} {
+		var b bytes.Buffer
+		err = template.Run(&b, nil, &scriggo.RunOptions{MaxGoroutines: n})
+		if err != nil {
+			t.Fatalf("max goroutines %d: unexpected error: %s", n, err)
+		}
+		if b.String() != expected.String() {
+			t.Fatalf("max goroutines %d: expecting %q, got %q", n, expected.String(), b.String())
+		}
+	}
+	s = []int{}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if b.String() != "empty" {
+		t.Fatalf("expecting %q, got %q", "empty", b.String())
+	}
+	s = []int{1, 0, 2}
+	b.Reset()
+	err = template.Run(&b, nil, nil)
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+	if !strings.Contains(err.Error(), "integer divide by zero") {
+		t.Fatalf("expecting integer divide by zero error, got %q", err)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("expecting no output, got %q", b.String())
+	}
+}
+
+// TestNilSafeSelector tests the nil-safe selector with interface operands.
+func TestNilSafeSelector(t *testing.T) {
+	type user struct {
+		Name  string
+		email string
+	}
+	data := map[string]interface{}{
+		"user":  map[string]interface{}{"name": "ann"},
+		"admin": &user{Name: "bob", email: "bob@example.com"},
+		"count": 2,
+	}
+	fsys := fstest.Files{"index.html": `{{ data?.user?.name }}|{{ data?.group?.name == nil }}|{{ data?.admin?.Name }}|{{ data?.count }}`}
+	opts := &scriggo.BuildOptions{Globals: native.Declarations{"data": &data}}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "ann|true|bob|2"; b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	// Unexported fields and fields of values that are not structs or maps
+	// cannot be selected.
+	fsys = fstest.Files{"index.html": `{{ data?.admin?.email }}`}
+	template, err = scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(io.Discard, nil, nil)
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+	if !strings.Contains(err.Error(), "runtime error: *misc.user has no field email") {
+		t.Fatalf("unexpected error %q", err)
+	}
+	fsys = fstest.Files{"index.html": `{% type T struct{ N int } %}{% var i interface{} = T{} %}{{ i?.M }}`}
+	template, err = scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(io.Discard, nil, nil)
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+	if !strings.Contains(err.Error(), "runtime error: T has no field M") {
+		t.Fatalf("unexpected error %q", err)
+	}
+}
+
+func TestFallbackPrinter(t *testing.T) {
+	fsys := fstest.Files{"index.html": `<p>{{ v }}</p><a title="{{ v }}">{{ n }}</a>`}
+	type point struct{ X, Y int }
+	var v interface{} = point{1, 2}
+	opts := &scriggo.BuildOptions{Globals: native.Declarations{"v": &v, "n": 3}}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err == nil {
+		t.Fatal("expecting error, got no error")
+	}
+	if expected := "cannot show value of type misc.point"; err.Error() != expected {
+		t.Fatalf("expecting error %q, got %q", expected, err)
+	}
+	printer := func(v interface{}) (string, error) {
+		if p, ok := v.(point); ok {
+			return fmt.Sprintf("<%d,%d>", p.X, p.Y), nil
+		}
+		return "", errors.New("unexpected value")
+	}
+	b.Reset()
+	err = template.Run(&b, nil, &scriggo.RunOptions{FallbackPrinter: printer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<p>&lt;1,2&gt;</p><a title="&lt;1,2&gt;">3</a>`; b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	v = []int{1}
+	b.Reset()
+	err = template.Run(&b, nil, &scriggo.RunOptions{FallbackPrinter: printer})
+	if err == nil || err.Error() != "unexpected value" {
+		t.Fatalf("expecting error %q, got %v", "unexpected value", err)
+	}
+}
+
+func TestPostProcess(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": `{% import "macros.md" %}<img src="/img/a.png">{{ v }}{{ M() }}`,
+		"macros.md":  `{% macro M %}![b](/img/b.png){% end %}`,
+	}
+	opts := &scriggo.BuildOptions{
+		Globals:           native.Declarations{"v": "/img/c.png"},
+		MarkdownConverter: markdownConverter,
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var formats []scriggo.Format
+	postProcess := func(format scriggo.Format, block []byte) []byte {
+		formats = append(formats, format)
+		return bytes.ReplaceAll(block, []byte("/img/"), []byte("https://cdn/img/"))
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, &scriggo.RunOptions{PostProcess: postProcess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<img src=\"https://cdn/img/a.png\">/img/c.png" +
+		"--- start Markdown ---\n![b](https://cdn/img/b.png)--- end Markdown ---\n"
+	if b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	expectedFormats := []scriggo.Format{scriggo.FormatHTML, scriggo.FormatMarkdown}
+	if !reflect.DeepEqual(formats, expectedFormats) {
+		t.Fatalf("expecting formats %v, got %v", expectedFormats, formats)
+	}
+}
+
+// TestOrDefault tests the or operator with a non-boolean left operand when
+// the OrDefault option is set.
+func TestOrDefault(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+		vars     Vars
+	}{
+		{`{% title := "" %}{{ title or "Untitled" }}|{% title = "Home" %}{{ title or "Untitled" }}`, "Untitled|Home", nil},
+		{`{% n := 0 %}{{ n or 5 }} {% n = 3 %}{{ n or 5 }} {{ n or n + 1 }}`, "5 3 3", nil},
+		{`{% f := 0.0 %}{% v := f or 1.5 %}{{ v }} {{ v * 2 }}`, "1.5 3", nil},
+		{`{% var s []int %}{{ len(s or []int{1, 2}) }}`, "2", nil},
+		{`{% var i interface{} %}{{ i or "none" }} {% i = 0 %}{{ i or "none" }} {% i = 7 %}{{ i or "none" }}`, "none none 7", nil},
+		{`{% a, b := "", "b" %}{{ a or b or "c" }} {{ a or "" or "c" }}`, "b c", nil},
+		{`{% a, b := "", 2 %}{{ a or b }} {% if a or b %}ok{% end %}`, "true ok", nil},
+		{`{% s := "<b>" %}{{ s or "<i>" }}|{% s = "" %}{{ s or "<i>" }}`, "&lt;b&gt;|&lt;i&gt;", nil},
+		{`{% var h html %}{{ h or "<i>" }}`, "<i>", nil},
+		{`{% a := true %}{% if a or 0 %}ok{% end %} {{ 0 or 5 }}`, "ok true", nil},
+	}
+	options := &scriggo.BuildOptions{OrDefault: true}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			fsys := fstest.Files{"index.html": test.src}
+			template, err := scriggo.BuildTemplate(fsys, "index.html", options)
+			if err != nil {
+				t.Fatalf("build error: %s", err)
+			}
+			b := &bytes.Buffer{}
+			err = template.Run(b, test.vars, nil)
+			if err != nil {
+				t.Fatalf("run error: %s", err)
+			}
+			if test.expected != b.String() {
+				t.Fatalf("expecting %q, got %q", test.expected, b)
+			}
+		})
+	}
+}
+
+// TestQuote tests that the values returned by the quote builtin are shown
+// according to the context.
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"index.html": "{{ quote(v) }}<script>var a = {{ quote(v) }};</script>",
+		"index.json": "{{ quote(v) }}",
+		"index.txt":  "{{ quote(v) }}",
+	}
+	expected := map[string]string{
+		"index.html": `&#34;a\&#34;&lt;b&gt;&#34;<script>var a = "a\"\u003cb\u003e";</script>`,
+		"index.json": `"a\"\u003cb\u003e"`,
+		"index.txt":  `"a\"<b>"`,
+	}
+	options := &scriggo.BuildOptions{
+		Globals: native.Declarations{"quote": builtin.Quote, "v": (*string)(nil)},
+	}
+	for name, src := range tests {
+		template, err := scriggo.BuildTemplate(fstest.Files{name: src}, name, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b strings.Builder
+		err = template.Run(&b, map[string]interface{}{"v": `a"<b>`}, nil)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", name, err)
+		}
+		if b.String() != expected[name] {
+			t.Fatalf("%s: expected %q, got %q", name, expected[name], b.String())
+		}
+	}
+}
+
+// TestTemplateFatal tests that Run panics with the argument passed to the
+// Fatal method of native.Env, and does not return an internal error.
+func TestTemplateFatal(t *testing.T) {
+	fsys := fstest.Files{"index.html": `{% fatal() %}`}
+	globals := native.Declarations{"fatal": func(env native.Env) { env.Fatal("boom") }}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expecting panic %q, got %v", "boom", r)
+		}
+	}()
+	_ = template.Run(io.Discard, nil, nil)
+	t.Fatal("expecting panic")
+}
+
+// TestTemplatePanicStack tests the stack trace of a panic across extended
+// and imported files.
+func TestTemplatePanicStack(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":  "{% extends \"layout.html\" %}{% import imp \"imp.html\" %}\n{% macro M %}\n  {{ imp.F(0) }}\n{% end %}",
+		"layout.html": "<b>\n{{ M() }}</b>",
+		"imp.html":    "{% macro F(n int) %}{{ 1 / n }}{% end %}",
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = template.Run(io.Discard, nil, nil)
+	p, ok := err.(*scriggo.PanicError)
+	if !ok {
+		t.Fatalf("expected a *scriggo.PanicError error, got %#v", err)
+	}
+	var stack []string
+	for _, frame := range p.Stack() {
+		stack = append(stack, fmt.Sprintf("%s %s:%s", frame.Function, frame.Path, frame.Position))
+	}
+	expected := []string{"main.F imp.html:1:26", "main.M index.html:3:11", "main.main layout.html:2:5"}
+	if !reflect.DeepEqual(stack, expected) {
+		t.Fatalf("expected stack %q, got %q", expected, stack)
+	}
+}
+
+func TestTrans(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html":  `{% import "macros.html" %}<p>{% trans %}Hello{% end trans %}, {{ name }}!</p>{{ M() }}`,
+		"macros.html": `{% macro M %}{% trans %}<b>Bye</b>{% end %}{% trans %}Hello{% end %}{% end %}`,
+	}
+	opts := &scriggo.BuildOptions{
+		Globals: native.Declarations{"name": "<Joe>"},
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTexts := []string{"<b>Bye</b>", "Hello"}
+	if got := template.TransTexts(); !reflect.DeepEqual(got, expectedTexts) {
+		t.Fatalf("expecting texts %q, got %q", expectedTexts, got)
+	}
+	// Without a translator.
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<p>Hello, &lt;Joe&gt;!</p><b>Bye</b>Hello"
+	if b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	// With a translator.
+	translations := map[string]string{"Hello": "Ciao", "<b>Bye</b>": "<b>Arrivederci</b>"}
+	var locales []string
+	translate := func(locale, text string) string {
+		locales = append(locales, locale)
+		return translations[text]
+	}
+	b.Reset()
+	err = template.Run(&b, nil, &scriggo.RunOptions{Locale: "it", Translate: translate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "<p>Ciao, &lt;Joe&gt;!</p><b>Arrivederci</b>Ciao"
+	if b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	expectedLocales := []string{"it", "it", "it"}
+	if !reflect.DeepEqual(locales, expectedLocales) {
+		t.Fatalf("expecting locales %q, got %q", expectedLocales, locales)
+	}
+	// Errors.
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`<a href="{% trans %}a{% end %}">`, "index.html:1:13: syntax error: cannot use trans in quoted attribute"},
+		{`{{ a }}{% trans %}a`, "index.html:1:20: syntax error: unexpected EOF, expecting {% end %} or {% end trans %}"},
+		{`{% trans %}a{% end if %}`, "index.html:1:25: syntax error: unexpected EOF, expecting {% end %} or {% end trans %}"},
+		{`{% trans %}{{ undefined }}{% end trans %}`, ""},
+	}
+	for _, test := range tests {
+		_, err := scriggo.BuildTemplate(fstest.Files{"index.html": test.src}, "index.html", nil)
+		if err == nil {
+			if test.err != "" {
+				t.Fatalf("source %q: expecting error %q, got no error", test.src, test.err)
+			}
+			continue
+		}
+		if err.Error() != test.err {
+			t.Fatalf("source %q: expecting error %q, got %q", test.src, test.err, err)
+		}
+	}
+}
+
+type enumStatus int8
+
+func TestEnum(t *testing.T) {
+	status := enumStatus(1)
+	globals := native.Declarations{
+		"Status": native.EnumOf(reflect.TypeOf(status), []string{"Inactive", "Active", "Deleted"}),
+		"status": &status,
+	}
+	src := `{{ status }} {{ Deleted }} {% if status == Active %}active{% end %} {{ int(status) }} {{ Status(5) }}` +
+		`{% var s Status = Inactive %} {{ s }} {% show status, s %} <script>var s = {{ status }};</script>`
+	fsys := fstest.Files{"index.html": src}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", &scriggo.BuildOptions{Globals: globals})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `Active Deleted active 1 enumStatus(5) Inactive ActiveInactive <script>var s = "Active";</script>`
+	if b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+}
+
+// TestTemplateContextCancellation tests that the cancellation of the context
+// interrupts the execution of a template in a loop.
+func TestTemplateContextCancellation(t *testing.T) {
+	sources := []string{
+		`{% for %}{% end %}`,
+		`{% for i := 0; ; i++ %}{% end %}`,
+		`{% macro M %}{{ M() }}{% end %}{{ M() }}`,
+	}
+	for _, src := range sources {
+		fsys := fstest.Files{"index.txt": src}
+		template, err := scriggo.BuildTemplate(fsys, "index.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		err = template.Run(io.Discard, nil, &scriggo.RunOptions{Context: ctx})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("%s: expecting deadline error, got %v", src, err)
+		}
+	}
+}
+
+func TestTemplateOperationLimits(t *testing.T) {
+	fsys := fstest.Files{"index.html": `{% for i in 1..3 %}{{ f() }}{% end %}`}
+	opts := &scriggo.BuildOptions{Globals: native.Declarations{"f": func() string { return "a" }}}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	err = template.Run(&b, nil, &scriggo.RunOptions{OperationLimits: &scriggo.OperationLimits{NativeCalls: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "aaa" {
+		t.Fatalf("expecting %q, got %q", "aaa", b.String())
+	}
+	b.Reset()
+	err = template.Run(&b, nil, &scriggo.RunOptions{OperationLimits: &scriggo.OperationLimits{NativeCalls: 2}})
+	e, ok := err.(*scriggo.OperationLimitError)
+	if !ok {
+		t.Fatalf("expecting *scriggo.OperationLimitError, got %T", err)
+	}
+	if e.Operations() != "native calls" || e.Limit() != 2 {
+		t.Fatalf("unexpected error %q", e)
+	}
+	if b.String() != "aa" {
+		t.Fatalf("expecting %q, got %q", "aa", b.String())
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	fsys := fstest.Files{"index.html": "<p>a</p>\n{% var m map[string]int %}{% m[\"b\"] = 1 %}<p>b</p>"}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Render the error inline.
+	var b bytes.Buffer
+	options := &scriggo.RunOptions{
+		PanicHandler: func(out io.Writer, err *scriggo.PanicError) error {
+			_, e := fmt.Fprintf(out, "<pre>%s:%s: %s</pre>", err.Path(), err.Position(), err.String())
+			return e
+		},
+	}
+	err = template.Run(&b, nil, options)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := "<p>a</p>\n<pre>index.html:2:31: assignment to entry in nil map</pre>"
+	if b.String() != expected {
+		t.Fatalf("expecting %q, got %q", expected, b.String())
+	}
+	// Return a different error.
+	errPage := errors.New("page error")
+	options.PanicHandler = func(out io.Writer, err *scriggo.PanicError) error {
+		return fmt.Errorf("%w: %s", errPage, err.String())
+	}
+	err = template.Run(io.Discard, nil, options)
+	if !errors.Is(err, errPage) {
+		t.Fatalf("expecting page error, got %v", err)
+	}
+}
+
+type markdownContextKey struct{}
+
+func TestMarkdownConversionLimits(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": "{% import \"macros.md\" %}{{ m }}\n{{ M() }}",
+		"macros.md":  "{% macro M %}# Title\n\nsome text{% end %}",
+	}
+	errConversion := errors.New("conversion error")
+	converter := func(ctx context.Context, src []byte, out io.Writer) error {
+		if ctx.Value(markdownContextKey{}) == nil {
+			return errConversion
+		}
+		return markdownConverter(src, out)
+	}
+	opts := &scriggo.BuildOptions{
+		Globals:                  native.Declarations{"m": native.Markdown("*a*")},
+		MarkdownContextConverter: converter,
+	}
+	template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), markdownContextKey{}, true)
+	tests := []struct {
+		options *scriggo.RunOptions
+		err     string
+		path    string
+		pos     string
+		block   string
+		is      error
+	}{
+		{&scriggo.RunOptions{Context: ctx}, "", "", "", "", nil},
+		{nil, "index.html:1:28: cannot convert Markdown block \"*a*\" to HTML: conversion error", "index.html", "1:28", "*a*", errConversion},
+		{&scriggo.RunOptions{Context: ctx, MaxMarkdownSize: 10},
+			"index.html:2:5: cannot convert Markdown block \"# Title\"... to HTML: size exceeds the limit of 10 bytes", "index.html", "2:5", "# Title\n\nsome text", nil},
+		{&scriggo.RunOptions{Context: ctx, MaxMarkdownHTMLSize: 30},
+			"index.html:1:28: cannot convert Markdown block \"*a*\" to HTML: HTML size exceeds the limit of 30 bytes", "index.html", "1:28", "*a*", nil},
+	}
+	for _, test := range tests {
+		var b bytes.Buffer
+		err := template.Run(&b, nil, test.options)
+		if test.err == "" {
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			expected := "--- start Markdown ---\n*a*--- end Markdown ---\n\n--- start Markdown ---\n# Title\n\nsome text--- end Markdown ---\n"
+			if b.String() != expected {
+				t.Fatalf("expecting %q, got %q", expected, b.String())
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("expecting error %q, got no error", test.err)
+		}
+		var mdErr *scriggo.MarkdownError
+		if !errors.As(err, &mdErr) {
+			t.Fatalf("expecting a *scriggo.MarkdownError error, got %T", err)
+		}
+		if err.Error() != test.err {
+			t.Fatalf("expecting error %q, got %q", test.err, err.Error())
+		}
+		if mdErr.Path() != test.path || mdErr.Position().String() != test.pos {
+			t.Fatalf("expecting position %s:%s, got %s:%s", test.path, test.pos, mdErr.Path(), mdErr.Position())
+		}
+		if string(mdErr.Block()) != test.block {
+			t.Fatalf("expecting block %q, got %q", test.block, mdErr.Block())
+		}
+		if test.is != nil && !errors.Is(err, test.is) {
+			t.Fatalf("expecting error to wrap %q", test.is)
+		}
+	}
+}
+
+func TestMarkdownConversionCache(t *testing.T) {
+	fsys := fstest.Files{
+		"index.html": "{{ a }}{{ b }}{{ a }}{% for i := 0; i < 2; i++ %}{{ b }}{% end %}{{ c }}",
+	}
+	var conversions []string
+	converter := func(src []byte, out io.Writer) error {
+		conversions = append(conversions, string(src))
+		return markdownConverter(src, out)
+	}
+	a, b := native.Markdown("*a*"), native.Markdown("*b*")
+	tests := []struct {
+		preconvert bool
+		build      []string
+		run        []string
+	}{
+		{false, nil, []string{"*a*", "*b*", "*c*"}},
+		{true, []string{"*a*", "*b*"}, []string{"*c*"}},
+	}
+	for _, test := range tests {
+		conversions = nil
+		opts := &scriggo.BuildOptions{
+			Globals:                   native.Declarations{"a": &a, "b": &b, "c": (*native.Markdown)(nil)},
+			MarkdownConverter:         converter,
+			PreconvertMarkdownGlobals: test.preconvert,
+		}
+		template, err := scriggo.BuildTemplate(fsys, "index.html", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(conversions)
+		if !reflect.DeepEqual(conversions, test.build) {
+			t.Fatalf("expecting build conversions %q, got %q", test.build, conversions)
+		}
+		for i := 0; i < 2; i++ {
+			conversions = nil
+			var out bytes.Buffer
+			err = template.Run(&out, map[string]interface{}{"c": native.Markdown("*c*")}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(conversions, test.run) {
+				t.Fatalf("expecting run conversions %q, got %q", test.run, conversions)
+			}
+			var expected string
+			for _, s := range []string{"*a*", "*b*", "*a*", "*b*", "*b*", "*c*"} {
+				expected += "--- start Markdown ---\n" + s + "--- end Markdown ---\n"
+			}
+			if out.String() != expected {
+				t.Fatalf("expecting %q, got %q", expected, out.String())
+			}
+		}
+	}
+}
+
+func TestWatchTemplate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, src string) {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.html", `{% import "button.html" %}{{ Button() }}`)
+	write("button.html", `{% macro Button %}<button>a</button>{% end %}`)
+	w, err := watch.Template(os.DirFS(dir), dir, "index.html", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	// render waits for the template to render expected, or to fail to build
+	// with the expected error.
+	render := func(expected, expectedErr string) {
+		var got, gotErr string
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			got, gotErr = "", ""
+			template, err := w.Template()
+			if err != nil {
+				gotErr = err.Error()
+			} else {
+				var b strings.Builder
+				err = template.Run(&b, nil, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = b.String()
+			}
+			if got == expected && gotErr == expectedErr {
+				return
+			}
+		}
+		if gotErr != expectedErr {
+			t.Fatalf("expected error %q, got %q", expectedErr, gotErr)
+		}
+		t.Fatalf("expected output %q, got %q", expected, got)
+	}
+	render("<button>a</button>", "")
+	write("button.html", `{% macro Button %}<button>b</button>{% end %}`)
+	render("<button>b</button>", "")
+	write("button.html", `{% macro Button %}`)
+	render("", "button.html:1:19: syntax error: unexpected EOF, expecting {% end %} or {% end macro %}")
+	err = os.Remove(filepath.Join(dir, "button.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	render("", `index.html:1:11: cannot find package "button.html"`)
+	write("button.html", `{% macro Button %}<button>c</button>{% end %}`)
+	render("<button>c</button>", "")
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	write("button.html", `{% macro Button %}<button>d</button>{% end %}`)
+	time.Sleep(100 * time.Millisecond)
+	render("<button>c</button>", "")
+}
+
+type testWatchFormatFS struct {
+	fs.FS
+}
+
+func (fsys testWatchFormatFS) Format(name string) (scriggo.Format, error) {
+	return scriggo.FormatHTML, nil
+}
+
+// TestWatchTemplateFormatFS tests that watch.Template builds the template
+// with the format returned by the Format method of the file system.
+func TestWatchTemplateFormatFS(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "index"), []byte(`{{ "<b>" }}`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := watch.Template(testWatchFormatFS{os.DirFS(dir)}, dir, "index", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	template, err := w.Template()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	err = template.Run(&b, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "&lt;b&gt;" {
+		t.Fatalf("expected output %q, got %q", "&lt;b&gt;", b.String())
 	}
 }
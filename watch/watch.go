@@ -0,0 +1,220 @@
+// Copyright 2021 The Scriggo Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !js && !wasip1
+// +build !js,!wasip1
+
+// Package watch rebuilds the templates when the files they have been built
+// from change. It is intended for development, so a long-running server
+// serves the changed templates without restarting.
+//
+// Package watch is not available on js and wasip1.
+package watch
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open2b/scriggo"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is the time a Watcher waits, after a file has changed,
+// before rebuilding the template. The changes occurring in the meantime,
+// as the several writes of an editor saving a file, are rebuilt together.
+const watchDelay = 50 * time.Millisecond
+
+// Watcher is a template, built from the files in a directory, that is
+// rebuilt when the files it has been built from change.
+//
+// The methods of a Watcher can be called concurrently by multiple
+// goroutines.
+type Watcher struct {
+	fsys    fs.FS
+	dir     string
+	name    string
+	options scriggo.BuildOptions
+	watcher *fsnotify.Watcher
+	builds  sync.Mutex // serializes the builds.
+
+	mu       sync.Mutex
+	template *scriggo.Template
+	err      error
+	files    map[string]bool // files read by the last build.
+	dirs     map[string]bool // watched directories.
+	timer    *time.Timer
+	closed   bool
+}
+
+// Template builds the named template file from fsys, as scriggo.BuildTemplate
+// does, and returns a Watcher that rebuilds it every time one of the files it
+// has been built from is written, created, renamed or removed.
+//
+// fsys must read the files from the directory dir, as os.DirFS(dir) does,
+// because the changes are detected watching dir. If fsys implements
+// scriggo.FormatFS, its Format method is used as BuildTemplate does.
+//
+// A template that fails to build is also rebuilt when its files change, so
+// Template returns an error only if the files cannot be watched. The build
+// error is returned by the Template method of the Watcher.
+//
+// Close should be called when the Watcher is no longer used.
+func Template(fsys fs.FS, dir, name string, options *scriggo.BuildOptions) (*Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		fsys:    fsys,
+		dir:     dir,
+		name:    name,
+		watcher: watcher,
+		dirs:    map[string]bool{},
+	}
+	if options != nil {
+		w.options = *options
+	}
+	w.build()
+	go w.watch()
+	return w, nil
+}
+
+// Template returns the template built after the last change of its files.
+// If the build failed, it returns the build error.
+func (w *Watcher) Template() (*scriggo.Template, error) {
+	w.mu.Lock()
+	template, err := w.template, w.err
+	w.mu.Unlock()
+	return template, err
+}
+
+// Close stops watching the files. After Close, the template is no longer
+// rebuilt and the Template method returns the last built template. Calling
+// Close again has no effect.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
+
+// build builds the template and replaces the previous one. Then it watches
+// the directories of the files read by the build.
+func (w *Watcher) build() {
+	w.builds.Lock()
+	defer w.builds.Unlock()
+	watched := &watchedFS{fsys: w.fsys, names: map[string]bool{}}
+	var fsys fs.FS = watched
+	if f, ok := w.fsys.(scriggo.FormatFS); ok {
+		fsys = watchedFormatFS{watched, f}
+	}
+	template, err := scriggo.BuildTemplate(fsys, w.name, &w.options)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.template, w.err = template, err
+	w.files = watched.names
+	for name := range w.files {
+		dir := filepath.Join(w.dir, filepath.FromSlash(path.Dir(name)))
+		if w.dirs[dir] {
+			continue
+		}
+		// A directory that does not exist cannot be watched; it is watched
+		// after a build that finds it.
+		if w.watcher.Add(dir) == nil {
+			w.dirs[dir] = true
+		}
+	}
+}
+
+// watch receives the file system events and schedules a build when a file
+// read by the last build changes. It returns when the watcher is closed.
+func (w *Watcher) watch() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			rel, err := filepath.Rel(w.dir, event.Name)
+			if err != nil {
+				continue
+			}
+			w.mu.Lock()
+			if !w.closed && w.affects(filepath.ToSlash(rel)) {
+				if w.timer == nil {
+					w.timer = time.AfterFunc(watchDelay, w.build)
+				} else {
+					w.timer.Reset(watchDelay)
+				}
+			}
+			w.mu.Unlock()
+		case _, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// affects reports whether a change of the named file, or directory, affects
+// the files read by the last build. It must be called with w.mu locked.
+func (w *Watcher) affects(name string) bool {
+	if w.files[name] {
+		return true
+	}
+	prefix := name + "/"
+	for file := range w.files {
+		if strings.HasPrefix(file, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchedFS wraps a file system and records the names of the files opened,
+// also if they do not exist.
+type watchedFS struct {
+	fsys  fs.FS
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+// Open opens the named file.
+func (fsys *watchedFS) Open(name string) (fs.File, error) {
+	if fs.ValidPath(name) {
+		fsys.mu.Lock()
+		fsys.names[name] = true
+		fsys.mu.Unlock()
+	}
+	return fsys.fsys.Open(name)
+}
+
+// watchedFormatFS is a watchedFS that wraps a scriggo.FormatFS.
+type watchedFormatFS struct {
+	*watchedFS
+	formats scriggo.FormatFS
+}
+
+// Format returns the format of the named file.
+func (fsys watchedFormatFS) Format(name string) (scriggo.Format, error) {
+	return fsys.formats.Format(name)
+}